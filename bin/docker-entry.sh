@@ -18,6 +18,9 @@ adapter)
 mysql-adapter)
     exec /app/cql-mysql-adapter -config "${COVENANT_CONF}" "${@}"
     ;;
+pg-adapter)
+    exec /app/cql-pg-adapter -config "${COVENANT_CONF}" "${@}"
+    ;;
 cli)
     exec /app/cql -config ${COVENANT_CONF} "${@}"
     ;;
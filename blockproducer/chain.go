@@ -25,7 +25,6 @@ import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto"
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/merkle"
@@ -342,7 +341,7 @@ func (c *Chain) pushBlock(b *pt.Block) error {
 }
 
 func (c *Chain) produceBlock(now time.Time) error {
-	priv, err := kms.GetLocalPrivateKey()
+	signer, err := kms.GetLocalSigner()
 	if err != nil {
 		return err
 	}
@@ -359,7 +358,7 @@ func (c *Chain) produceBlock(now time.Time) error {
 		Transactions: c.ms.pullTxs(),
 	}
 
-	err = b.PackAndSignBlock(priv)
+	err = b.PackAndSignBlock(signer)
 	if err != nil {
 		return err
 	}
@@ -426,13 +425,13 @@ func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err
 	}
 
 	// add block producer signature
-	var privKey *asymmetric.PrivateKey
-	privKey, err = kms.GetLocalPrivateKey()
+	var signer kms.Signer
+	signer, err = kms.GetLocalSigner()
 	if err != nil {
 		return
 	}
 
-	if _, _, err = br.SignRequestHeader(privKey, false); err != nil {
+	if _, _, err = br.SignRequestHeader(signer, false); err != nil {
 		return
 	}
 
@@ -446,7 +445,7 @@ func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err
 		tc = pt.NewBillingHeader(nc, br, accountAddress, receivers, fees, rewards)
 		tb = pt.NewBilling(tc)
 	)
-	if err = tb.Sign(privKey); err != nil {
+	if err = tb.Sign(signer); err != nil {
 		return
 	}
 	log.Debugf("response is %s", br.RequestHash)
@@ -753,6 +752,21 @@ func (c *Chain) syncHead() {
 	}
 }
 
+// LoadMultiSig returns the multisig key set bound to the account.
+func (c *Chain) LoadMultiSig(addr proto.AccountAddress) (config *pt.MultiSigConfig, ok bool) {
+	var o *accountObject
+	if o, ok = c.ms.loadAccountObject(addr); !ok {
+		return
+	}
+	o.RLock()
+	defer o.RUnlock()
+	if o.MultiSig == nil {
+		return nil, false
+	}
+	var copied = *o.MultiSig
+	return &copied, true
+}
+
 // Stop stops the main process of the sql-chain.
 func (c *Chain) Stop() (err error) {
 	// Stop main process
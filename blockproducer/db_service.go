@@ -21,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
@@ -62,6 +63,10 @@ type DBService struct {
 	Consistent       *consistent.Consistent
 	NodeMetrics      *metric.NodeMetricMap
 
+	// LoadMultiSig loads the multisig key set bound to the wallet from main chain, it's required
+	// by databases owned by multisig wallets.
+	LoadMultiSig func(addr proto.AccountAddress) (config *pt.MultiSigConfig, ok bool)
+
 	// include block producer nodes for database allocation, for test case injection
 	includeBPNodesForAllocation bool
 }
@@ -73,8 +78,10 @@ func (s *DBService) CreateDatabase(req *CreateDatabaseRequest, resp *CreateDatab
 		return
 	}
 
-	// TODO(xq262144): verify identity
-	// verify identity
+	// verify identity of the multisig owner wallet
+	if err = s.checkOwnerWallet(req.Header.OwnerWallet, req.Header.HeaderHash, req.OwnerSignatures); err != nil {
+		return
+	}
 
 	// create random DatabaseID
 	var dbID proto.DatabaseID
@@ -101,8 +108,8 @@ func (s *DBService) CreateDatabase(req *CreateDatabaseRequest, resp *CreateDatab
 	}()
 
 	// call miner nodes to provide service
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -113,7 +120,7 @@ func (s *DBService) CreateDatabase(req *CreateDatabaseRequest, resp *CreateDatab
 		Peers:        peers,
 		GenesisBlock: genesisBlock,
 	}
-	if err = initSvcReq.Sign(privateKey); err != nil {
+	if err = initSvcReq.Sign(signer); err != nil {
 		return
 	}
 
@@ -122,7 +129,7 @@ func (s *DBService) CreateDatabase(req *CreateDatabaseRequest, resp *CreateDatab
 	rollbackReq.Header.Instance = wt.ServiceInstance{
 		DatabaseID: dbID,
 	}
-	if err = rollbackReq.Sign(privateKey); err != nil {
+	if err = rollbackReq.Sign(signer); err != nil {
 		return
 	}
 
@@ -136,6 +143,8 @@ func (s *DBService) CreateDatabase(req *CreateDatabaseRequest, resp *CreateDatab
 		Peers:        peers,
 		ResourceMeta: req.Header.ResourceMeta,
 		GenesisBlock: genesisBlock,
+		Owner:        req.Header.Signee,
+		OwnerWallet:  req.Header.OwnerWallet,
 	}
 
 	log.Debugf("generated instance meta: %v", instanceMeta)
@@ -150,7 +159,7 @@ func (s *DBService) CreateDatabase(req *CreateDatabaseRequest, resp *CreateDatab
 	resp.Header.InstanceMeta = instanceMeta
 
 	// sign the response
-	err = resp.Sign(privateKey)
+	err = resp.Sign(signer)
 
 	return
 }
@@ -162,15 +171,19 @@ func (s *DBService) DropDatabase(req *DropDatabaseRequest, resp *DropDatabaseRes
 		return
 	}
 
-	// TODO(xq262144): verify identity
-	// verify identity and database belonging
-
 	// get database peers
 	var instanceMeta wt.ServiceInstance
 	if instanceMeta, err = s.ServiceMap.Get(req.Header.DatabaseID); err != nil {
 		return
 	}
 
+	// verify identity, only the database owner could drop the database
+	if err = s.checkDatabaseOwner(
+		&instanceMeta, req.Header.Signee, req.Header.HeaderHash, req.OwnerSignatures,
+	); err != nil {
+		return
+	}
+
 	// call miner nodes to drop database
 	dropDBSvcReq := new(wt.UpdateService)
 	dropDBSvcReq.Header.Op = wt.DropDB
@@ -180,11 +193,11 @@ func (s *DBService) DropDatabase(req *DropDatabaseRequest, resp *DropDatabaseRes
 	if dropDBSvcReq.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
 		return
 	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
-	if dropDBSvcReq.Sign(privateKey); err != nil {
+	if dropDBSvcReq.Sign(signer); err != nil {
 		return
 	}
 
@@ -208,6 +221,104 @@ func (s *DBService) DropDatabase(req *DropDatabaseRequest, resp *DropDatabaseRes
 	return
 }
 
+// UpdateDatabasePolicy defines block producer update database sql policy logic.
+func (s *DBService) UpdateDatabasePolicy(req *UpdateDatabasePolicyRequest, resp *UpdateDatabasePolicyResponse) (err error) {
+	// verify signature
+	if err = req.Verify(); err != nil {
+		return
+	}
+
+	if err = req.Header.Policy.Validate(); err != nil {
+		return
+	}
+
+	var instanceMeta wt.ServiceInstance
+	if instanceMeta, err = s.ServiceMap.Get(req.Header.DatabaseID); err != nil {
+		return
+	}
+
+	// verify identity, only the database owner could update the policy
+	if err = s.checkDatabaseOwner(
+		&instanceMeta, req.Header.Signee, req.Header.HeaderHash, req.OwnerSignatures,
+	); err != nil {
+		return
+	}
+
+	// save to meta first, miner nodes failed to update get the policy from meta on restart
+	instanceMeta.SQLPolicy = req.Header.Policy
+	if err = s.ServiceMap.Set(instanceMeta); err != nil {
+		return
+	}
+
+	// call miner nodes to update policy
+	updatePolicyReq := new(wt.UpdateService)
+	updatePolicyReq.Header.Op = wt.UpdatePolicy
+	updatePolicyReq.Header.Instance = wt.ServiceInstance{
+		DatabaseID: req.Header.DatabaseID,
+		SQLPolicy:  req.Header.Policy,
+	}
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+	if err = updatePolicyReq.Sign(signer); err != nil {
+		return
+	}
+
+	err = s.batchSendSvcReq(updatePolicyReq, nil, s.peersToNodes(instanceMeta.Peers))
+
+	return
+}
+
+// checkDatabaseOwner returns error if the request is not from the owner of the database. The
+// request of a database owned by a multisig wallet must carry threshold signatures of the wallet
+// key set, otherwise the request signee must be the owner.
+func (s *DBService) checkDatabaseOwner(
+	instanceMeta *wt.ServiceInstance, signee *asymmetric.PublicKey, h hash.Hash,
+	sigs []*pt.MultiSignature) (err error,
+) {
+	var empty proto.AccountAddress
+	if instanceMeta.OwnerWallet != empty {
+		return s.checkOwnerWallet(instanceMeta.OwnerWallet, h, sigs)
+	}
+	return checkOwnerKey(instanceMeta, signee)
+}
+
+// checkOwnerWallet returns error if sigs are not threshold signatures of h by the key set bound
+// to wallet, an empty wallet is skipped.
+func (s *DBService) checkOwnerWallet(
+	wallet proto.AccountAddress, h hash.Hash, sigs []*pt.MultiSignature) (err error,
+) {
+	var empty proto.AccountAddress
+	if wallet == empty {
+		return
+	}
+	if s.LoadMultiSig == nil {
+		return ErrNoPermission
+	}
+	config, ok := s.LoadMultiSig(wallet)
+	if !ok {
+		return ErrMultiSigNotBound
+	}
+	return config.VerifySignatures(h, sigs)
+}
+
+// checkOwnerKey returns error if signee is not the owner of the database. Databases created
+// before the owner is recorded have no Owner, the block producer is regarded as their owner, so
+// the operator could still manage them with the block producer key.
+func checkOwnerKey(instanceMeta *wt.ServiceInstance, signee *asymmetric.PublicKey) (err error) {
+	owner := instanceMeta.Owner
+	if owner == nil {
+		if owner, err = kms.GetLocalPublicKey(); err != nil {
+			return
+		}
+	}
+	if signee == nil || !owner.IsEqual(signee) {
+		err = ErrNoPermission
+	}
+	return
+}
+
 // GetDatabase defines block producer get database logic.
 func (s *DBService) GetDatabase(req *GetDatabaseRequest, resp *GetDatabaseResponse) (err error) {
 	// verify signature
@@ -230,13 +341,13 @@ func (s *DBService) GetDatabase(req *GetDatabaseRequest, resp *GetDatabaseRespon
 		return
 	}
 
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
 	// sign the response
-	err = resp.Sign(privateKey)
+	err = resp.Sign(signer)
 
 	return
 }
@@ -253,11 +364,11 @@ func (s *DBService) GetNodeDatabases(req *wt.InitService, resp *wt.InitServiceRe
 
 	// send response to client
 	resp.Header.Instances = instances
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
-	err = resp.Sign(privateKey)
+	err = resp.Sign(signer)
 
 	return
 }
@@ -295,15 +406,34 @@ func (s *DBService) generateDatabaseID(reqNodeID *proto.RawNodeID) (dbID proto.D
 }
 
 func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resourceMeta wt.ResourceMeta) (peers *kayak.Peers, err error) {
-	curRange := int(resourceMeta.Node)
+	var nodes []proto.Node
+	var nodeAllocated []proto.NodeID
+
+	if nodes, nodeAllocated, err = s.pickNodes(dbID, int(resourceMeta.Node), resourceMeta, nil); err != nil {
+		return
+	}
+
+	// build peers
+	return s.buildPeers(lastTerm+1, nodes, nodeAllocated)
+}
+
+// pickNodes chooses count nodes meeting the resource requirements except the excluded and unhealthy
+// nodes, the returned nodes contain the info of allocated node ids.
+func (s *DBService) pickNodes(dbID proto.DatabaseID, count int, resourceMeta wt.ResourceMeta,
+	exclude map[proto.NodeID]bool) (nodes []proto.Node, nodeAllocated []proto.NodeID, err error) {
+	curRange := count
 	excludeNodes := make(map[proto.NodeID]bool)
 	var allocated []allocatedNode
 
-	if resourceMeta.Node <= 0 {
+	if count <= 0 {
 		err = ErrDatabaseAllocation
 		return
 	}
 
+	for nodeID := range exclude {
+		excludeNodes[nodeID] = true
+	}
+
 	if !s.includeBPNodesForAllocation {
 		// add block producer nodes to exclude node list
 		for _, nodeID := range route.GetBPs() {
@@ -314,8 +444,6 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 	for i := 0; i != s.AllocationRounds; i++ {
 		log.Debugf("node allocation round %d", i+1)
 
-		var nodes []proto.Node
-
 		// clear previous allocated
 		allocated = allocated[:0]
 		rolesFilter := []proto.ServerRole{
@@ -334,14 +462,20 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 		var nodeIDs []proto.NodeID
 
 		for _, node := range nodes {
-			if _, ok := excludeNodes[node.ID]; !ok {
-				nodeIDs = append(nodeIDs, node.ID)
+			if _, ok := excludeNodes[node.ID]; ok {
+				continue
 			}
+			if !s.Consistent.IsNodeHealthy(node.ID) {
+				log.Debugf("skip unhealthy node %s", node.ID)
+				excludeNodes[node.ID] = true
+				continue
+			}
+			nodeIDs = append(nodeIDs, node.ID)
 		}
 
 		log.Debugf("found %d suitable nodes: %v", len(nodeIDs), nodeIDs)
 
-		if len(nodeIDs) < int(resourceMeta.Node) {
+		if len(nodeIDs) < count {
 			continue
 		}
 
@@ -378,26 +512,27 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 			}
 		}
 
-		if len(allocated) >= int(resourceMeta.Node) {
+		if len(allocated) >= count {
 			// sort allocated node by metric
 			sort.Slice(allocated, func(i, j int) bool {
 				return allocated[i].MemoryMetric > allocated[j].MemoryMetric
 			})
 
-			allocated = allocated[:int(resourceMeta.Node)]
+			allocated = allocated[:count]
 
 			// build plain allocated slice
-			nodeAllocated := make([]proto.NodeID, 0, len(allocated))
+			nodeAllocated = make([]proto.NodeID, 0, len(allocated))
 
 			for _, node := range allocated {
 				nodeAllocated = append(nodeAllocated, node.NodeID)
 			}
 
-			// build peers
-			return s.buildPeers(lastTerm+1, nodes, nodeAllocated)
+			// ignore metric errors of the excluded nodes
+			err = nil
+			return
 		}
 
-		curRange += int(resourceMeta.Node)
+		curRange += count
 	}
 
 	// allocation failed
@@ -437,8 +572,8 @@ func (s *DBService) buildPeers(term uint64, nodes []proto.Node, allocated []prot
 		return
 	}
 
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -476,7 +611,7 @@ func (s *DBService) buildPeers(term uint64, nodes []proto.Node, allocated []prot
 	peers.Leader = peers.Servers[0]
 
 	// sign the peers structure
-	err = peers.Sign(privKey)
+	err = peers.Sign(signer)
 
 	return
 }
@@ -485,8 +620,8 @@ func (s *DBService) generateGenesisBlock(dbID proto.DatabaseID, resourceMeta wt.
 	// TODO(xq262144): following is stub code, real logic should be implemented in the future
 	emptyHash := hash.Hash{}
 
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 	var nodeID proto.NodeID
@@ -505,7 +640,7 @@ func (s *DBService) generateGenesisBlock(dbID proto.DatabaseID, resourceMeta wt.
 			},
 		},
 	}
-	err = genesisBlock.PackAndSignBlock(privKey)
+	err = genesisBlock.PackAndSignBlock(signer)
 
 	return
 }
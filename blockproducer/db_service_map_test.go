@@ -21,8 +21,10 @@ import (
 	"sync"
 	"testing"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
@@ -122,3 +124,69 @@ func TestServiceMap(t *testing.T) {
 		So(instances[0].DatabaseID, ShouldResemble, proto.DatabaseID("db"))
 	})
 }
+
+func TestCheckDatabaseOwner(t *testing.T) {
+	Convey("test database owner check", t, func() {
+		var err error
+		conf.GConf, err = conf.LoadConfig("../test/node_standalone/config.yaml")
+		So(err, ShouldBeNil)
+		err = kms.InitLocalKeyPair("../test/node_standalone/private.key", []byte(""))
+		So(err, ShouldBeNil)
+
+		bpPubKey, err := kms.GetLocalPublicKey()
+		So(err, ShouldBeNil)
+		_, ownerPubKey, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		instance := &wt.ServiceInstance{Owner: ownerPubKey}
+		So(checkOwnerKey(instance, ownerPubKey), ShouldBeNil)
+		So(checkOwnerKey(instance, bpPubKey), ShouldEqual, ErrNoPermission)
+		So(checkOwnerKey(instance, nil), ShouldEqual, ErrNoPermission)
+
+		// legacy database without owner is owned by the block producer
+		instance.Owner = nil
+		So(checkOwnerKey(instance, bpPubKey), ShouldBeNil)
+		So(checkOwnerKey(instance, ownerPubKey), ShouldEqual, ErrNoPermission)
+
+		// database owned by multisig wallet requires threshold signatures of the bound key set
+		var (
+			privKeys []*asymmetric.PrivateKey
+			cfg      = &pt.MultiSigConfig{Threshold: 2}
+			h        = hash.THashH([]byte("drop database"))
+			sigs     []*pt.MultiSignature
+		)
+		for i := 0; i < 3; i++ {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			privKeys = append(privKeys, priv)
+			cfg.PublicKeys = append(cfg.PublicKeys, pub)
+		}
+		wallet, err := cfg.Address()
+		So(err, ShouldBeNil)
+		instance.Owner = ownerPubKey
+		instance.OwnerWallet = wallet
+
+		dbService := &DBService{}
+		So(dbService.checkDatabaseOwner(instance, ownerPubKey, h, sigs), ShouldEqual, ErrNoPermission)
+		dbService.LoadMultiSig = func(addr proto.AccountAddress) (*pt.MultiSigConfig, bool) {
+			return nil, false
+		}
+		So(dbService.checkDatabaseOwner(instance, ownerPubKey, h, sigs), ShouldEqual, ErrMultiSigNotBound)
+		dbService.LoadMultiSig = func(addr proto.AccountAddress) (*pt.MultiSigConfig, bool) {
+			return cfg, addr == wallet
+		}
+		sigs, err = pt.AddMultiSignature(h, sigs, privKeys[0])
+		So(err, ShouldBeNil)
+		So(dbService.checkDatabaseOwner(instance, ownerPubKey, h, sigs), ShouldEqual, pt.ErrMultiSigThreshold)
+		sigs, err = pt.AddMultiSignature(h, sigs, privKeys[2])
+		So(err, ShouldBeNil)
+		So(dbService.checkDatabaseOwner(instance, nil, h, sigs), ShouldBeNil)
+		So(dbService.checkDatabaseOwner(instance, ownerPubKey, hash.THashH([]byte("other")), sigs),
+			ShouldEqual, pt.ErrSignVerification)
+
+		// single key owner is checked without wallet
+		instance.OwnerWallet = proto.AccountAddress{}
+		So(dbService.checkDatabaseOwner(instance, ownerPubKey, h, nil), ShouldBeNil)
+		So(dbService.checkDatabaseOwner(instance, bpPubKey, h, sigs), ShouldEqual, ErrNoPermission)
+	})
+}
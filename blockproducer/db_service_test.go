@@ -22,6 +22,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/kayak"
 	"github.com/CovenantSQL/CovenantSQL/metric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
@@ -157,6 +158,27 @@ func TestService(t *testing.T) {
 		So(queryRes.Payload.Rows[0].Values, ShouldNotBeEmpty)
 		So(queryRes.Payload.Rows[0].Values[0], ShouldEqual, 1)
 
+		// stale metrics mark the node unhealthy, no healthy node left for allocation
+		checker := NewNodeHealthChecker(dbService, &metric.HealthCriteria{MetricTimeout: time.Minute}, time.Minute)
+		checker.check(time.Now().Add(2 * time.Minute))
+		So(dht.Consistent.IsNodeHealthy(nodeID), ShouldBeFalse)
+		err = rpc.NewCaller().CallNode(nodeID, route.BPDBCreateDatabase.String(), createDBReq, new(CreateDatabaseResponse))
+		So(err, ShouldNotBeNil)
+
+		// fresh metrics recover the node
+		checker.check(time.Now())
+		So(dht.Consistent.IsNodeHealthy(nodeID), ShouldBeTrue)
+
+		// the healthy follower is promoted on replacing the unhealthy leader
+		prevPeers := &kayak.Peers{Term: 1, Leader: &kayak.Server{Role: proto.Leader, ID: proto.NodeID("dead")}}
+		prevPeers.Servers = []*kayak.Server{prevPeers.Leader, {Role: proto.Follower, ID: nodeID}}
+		replacedPeers, err := dbService.buildReplacedPeers(prevPeers, prevPeers.Servers[1:], nil, nil)
+		So(err, ShouldBeNil)
+		So(replacedPeers.Term, ShouldEqual, uint64(2))
+		So(replacedPeers.Servers, ShouldHaveLength, 1)
+		So(replacedPeers.Leader.ID, ShouldEqual, nodeID)
+		So(replacedPeers.Verify(), ShouldBeTrue)
+
 		// drop database
 		dropDBReq := new(DropDatabaseRequest)
 		dropDBReq.Header.DatabaseID = createDBRes.Header.InstanceMeta.DatabaseID
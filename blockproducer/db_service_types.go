@@ -17,8 +17,13 @@
 package blockproducer
 
 import (
+	"bytes"
+	"encoding/binary"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
 )
@@ -26,6 +31,9 @@ import (
 // CreateDatabaseRequestHeader defines client create database rpc header.
 type CreateDatabaseRequestHeader struct {
 	ResourceMeta wt.ResourceMeta
+	// OwnerWallet is the multisig wallet owning the database, the database owner operations
+	// require threshold signatures of its bound key set, leave it empty for single key owner.
+	OwnerWallet proto.AccountAddress
 }
 
 // Serialize structure to bytes.
@@ -34,7 +42,11 @@ func (h *CreateDatabaseRequestHeader) Serialize() []byte {
 		return []byte{'\000'}
 	}
 
-	return h.ResourceMeta.Serialize()
+	buf := new(bytes.Buffer)
+	buf.Write(h.ResourceMeta.Serialize())
+	buf.Write(h.OwnerWallet[:])
+
+	return buf.Bytes()
 }
 
 // SignedCreateDatabaseRequestHeader defines signed client create database request header.
@@ -59,7 +71,7 @@ func (sh *SignedCreateDatabaseRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedCreateDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedCreateDatabaseRequestHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.CreateDatabaseRequestHeader, &sh.HeaderHash)
 
@@ -74,6 +86,8 @@ func (sh *SignedCreateDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey)
 type CreateDatabaseRequest struct {
 	proto.Envelope
 	Header SignedCreateDatabaseRequestHeader
+	// OwnerSignatures are signatures of the header hash by the key set of the multisig owner wallet.
+	OwnerSignatures []*pt.MultiSignature
 }
 
 // Verify checks hash and signature in request header.
@@ -82,11 +96,18 @@ func (r *CreateDatabaseRequest) Verify() error {
 }
 
 // Sign the request.
-func (r *CreateDatabaseRequest) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *CreateDatabaseRequest) Sign(signer kms.Signer) (err error) {
 	// sign
 	return r.Header.Sign(signer)
 }
 
+// SignOwner adds the signature of the multisig owner wallet key holder, the header must be signed
+// first to build the header hash.
+func (r *CreateDatabaseRequest) SignOwner(signer kms.Signer) (err error) {
+	r.OwnerSignatures, err = pt.AddMultiSignature(r.Header.HeaderHash, r.OwnerSignatures, signer)
+	return
+}
+
 // CreateDatabaseResponseHeader defines client create database rpc response header.
 type CreateDatabaseResponseHeader struct {
 	InstanceMeta wt.ServiceInstance
@@ -123,7 +144,7 @@ func (sh *SignedCreateDatabaseResponseHeader) Verify() (err error) {
 }
 
 // Sign the response.
-func (sh *SignedCreateDatabaseResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedCreateDatabaseResponseHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.CreateDatabaseResponseHeader, &sh.HeaderHash)
 
@@ -146,7 +167,7 @@ func (r *CreateDatabaseResponse) Verify() error {
 }
 
 // Sign the response.
-func (r *CreateDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *CreateDatabaseResponse) Sign(signer kms.Signer) (err error) {
 	// sign
 	return r.Header.Sign(signer)
 }
@@ -187,7 +208,7 @@ func (sh *SignedDropDatabaseRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedDropDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedDropDatabaseRequestHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.DropDatabaseRequestHeader, &sh.HeaderHash)
 
@@ -202,6 +223,8 @@ func (sh *SignedDropDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (
 type DropDatabaseRequest struct {
 	proto.Envelope
 	Header SignedDropDatabaseRequestHeader
+	// OwnerSignatures are signatures of the header hash by the key set of the multisig owner wallet.
+	OwnerSignatures []*pt.MultiSignature
 }
 
 // Verify checks hash and signature in request header.
@@ -210,13 +233,103 @@ func (r *DropDatabaseRequest) Verify() error {
 }
 
 // Sign the request.
-func (r *DropDatabaseRequest) Sign(signer *asymmetric.PrivateKey) error {
+func (r *DropDatabaseRequest) Sign(signer kms.Signer) error {
 	return r.Header.Sign(signer)
 }
 
+// SignOwner adds the signature of the multisig owner wallet key holder, the header must be signed
+// first to build the header hash.
+func (r *DropDatabaseRequest) SignOwner(signer kms.Signer) (err error) {
+	r.OwnerSignatures, err = pt.AddMultiSignature(r.Header.HeaderHash, r.OwnerSignatures, signer)
+	return
+}
+
 // DropDatabaseResponse defines client drop database rpc response entity.
 type DropDatabaseResponse struct{}
 
+// UpdateDatabasePolicyRequestHeader defines client update database sql policy rpc request header.
+type UpdateDatabasePolicyRequestHeader struct {
+	DatabaseID proto.DatabaseID
+	Policy     wt.SQLPolicy
+}
+
+// Serialize structure to bytes.
+func (h *UpdateDatabasePolicyRequestHeader) Serialize() []byte {
+	if h == nil {
+		return []byte{'\000'}
+	}
+
+	buf := new(bytes.Buffer)
+
+	// length-prefix the database id to separate it from the policy
+	binary.Write(buf, binary.LittleEndian, uint64(len(h.DatabaseID)))
+	buf.WriteString(string(h.DatabaseID))
+	buf.Write(h.Policy.Serialize())
+
+	return buf.Bytes()
+}
+
+// SignedUpdateDatabasePolicyRequestHeader defines signed client update database sql policy rpc request header.
+type SignedUpdateDatabasePolicyRequestHeader struct {
+	UpdateDatabasePolicyRequestHeader
+	HeaderHash hash.Hash
+	Signee     *asymmetric.PublicKey
+	Signature  *asymmetric.Signature
+}
+
+// Verify checks hash and signature in request header.
+func (sh *SignedUpdateDatabasePolicyRequestHeader) Verify() (err error) {
+	// verify hash
+	if err = verifyHash(&sh.UpdateDatabasePolicyRequestHeader, &sh.HeaderHash); err != nil {
+		return
+	}
+	// verify sign
+	if sh.Signee == nil || sh.Signature == nil || !sh.Signature.Verify(sh.HeaderHash[:], sh.Signee) {
+		return wt.ErrSignVerification
+	}
+	return
+}
+
+// Sign the request.
+func (sh *SignedUpdateDatabasePolicyRequestHeader) Sign(signer kms.Signer) (err error) {
+	// build hash
+	buildHash(&sh.UpdateDatabasePolicyRequestHeader, &sh.HeaderHash)
+
+	// sign
+	sh.Signature, err = signer.Sign(sh.HeaderHash[:])
+	sh.Signee = signer.PubKey()
+
+	return
+}
+
+// UpdateDatabasePolicyRequest defines client update database sql policy rpc request entity.
+type UpdateDatabasePolicyRequest struct {
+	proto.Envelope
+	Header SignedUpdateDatabasePolicyRequestHeader
+	// OwnerSignatures are signatures of the header hash by the key set of the multisig owner wallet.
+	OwnerSignatures []*pt.MultiSignature
+}
+
+// Verify checks hash and signature in request header.
+func (r *UpdateDatabasePolicyRequest) Verify() error {
+	return r.Header.Verify()
+}
+
+// Sign the request.
+func (r *UpdateDatabasePolicyRequest) Sign(signer kms.Signer) error {
+	return r.Header.Sign(signer)
+}
+
+// SignOwner adds the signature of the multisig owner wallet key holder, the header must be signed
+// first to build the header hash.
+func (r *UpdateDatabasePolicyRequest) SignOwner(signer kms.Signer) (err error) {
+	r.OwnerSignatures, err = pt.AddMultiSignature(r.Header.HeaderHash, r.OwnerSignatures, signer)
+	return
+}
+
+// UpdateDatabasePolicyResponse defines client update database sql policy rpc response entity.
+type UpdateDatabasePolicyResponse struct{}
+
 // GetDatabaseRequestHeader defines client get database rpc request header entity.
 type GetDatabaseRequestHeader struct {
 	DatabaseID proto.DatabaseID
@@ -253,7 +366,7 @@ func (sh *SignedGetDatabaseRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedGetDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedGetDatabaseRequestHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.GetDatabaseRequestHeader, &sh.HeaderHash)
 
@@ -276,7 +389,7 @@ func (r *GetDatabaseRequest) Verify() error {
 }
 
 // Sign the request.
-func (r *GetDatabaseRequest) Sign(signer *asymmetric.PrivateKey) error {
+func (r *GetDatabaseRequest) Sign(signer kms.Signer) error {
 	return r.Header.Sign(signer)
 }
 
@@ -316,7 +429,7 @@ func (sh *SignedGetDatabaseResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedGetDatabaseResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedGetDatabaseResponseHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.GetDatabaseResponseHeader, &sh.HeaderHash)
 
@@ -339,7 +452,7 @@ func (r *GetDatabaseResponse) Verify() (err error) {
 }
 
 // Sign the request.
-func (r *GetDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *GetDatabaseResponse) Sign(signer kms.Signer) (err error) {
 	return r.Header.Sign(signer)
 }
 
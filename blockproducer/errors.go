@@ -27,6 +27,10 @@ var (
 	ErrDatabaseAllocation = errors.New("allocate database failed")
 	// ErrMetricNotCollected defines errors collected.
 	ErrMetricNotCollected = errors.New("metric not collected")
+	// ErrNoPermission defines database manipulation from non-owner error.
+	ErrNoPermission = errors.New("no permission to manipulate the database")
+	// ErrNoHealthyPeer defines database peers replacement failure on all peers unhealthy.
+	ErrNoHealthyPeer = errors.New("no healthy peer left in database")
 
 	// Errors on main chain
 
@@ -74,6 +78,18 @@ var (
 	ErrUnknownTransactionType = errors.New("unknown transaction type")
 	// ErrTransactionMismatch indicates that transactions to be committed mismatch the pool.
 	ErrTransactionMismatch = errors.New("transaction mismatch")
+	// ErrMultiSigRequired indicates that a transaction from a multisig account is not wrapped in
+	// a multisig envelope.
+	ErrMultiSigRequired = errors.New("multisig envelope required for multisig account")
+	// ErrMultiSigNotBound indicates that a multisig envelope is sent from an account which is not
+	// bound to a multisig key set.
+	ErrMultiSigNotBound = errors.New("account not bound to multisig key set")
+	// ErrMultiSigConfigMismatch indicates that the multisig envelope is not signed by the key set
+	// bound to the account.
+	ErrMultiSigConfigMismatch = errors.New("multisig key set doesn't match the bound one")
+	// ErrMultiSigBaseAccount indicates that a BaseAccount transaction with multisig config is
+	// submitted out of genesis.
+	ErrMultiSigBaseAccount = errors.New("multisig binding of base account is only allowed in genesis")
 	// ErrMetaStateNotFound indicates that meta state not found in db.
 	ErrMetaStateNotFound = errors.New("meta state not found in db")
 )
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/kayak"
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+)
+
+const (
+	// DefaultHealthCheckInterval defines the interval to evaluate node health from metrics.
+	DefaultHealthCheckInterval = time.Minute
+)
+
+// NodeHealthChecker periodically evaluates node health from the metrics uploaded to block producer,
+// marks the unhealthy nodes in consistent ring and replaces them in the database peers.
+type NodeHealthChecker struct {
+	service  *DBService
+	criteria *metric.HealthCriteria
+	interval time.Duration
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewNodeHealthChecker returns a new health checker of nodes serving the database service.
+func NewNodeHealthChecker(
+	service *DBService, criteria *metric.HealthCriteria, interval time.Duration) *NodeHealthChecker {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	return &NodeHealthChecker{
+		service:  service,
+		criteria: criteria,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start starts the periodic health check.
+func (c *NodeHealthChecker) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case now := <-ticker.C:
+				c.check(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic health check and waits for the running check.
+func (c *NodeHealthChecker) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+	c.wg.Wait()
+}
+
+func (c *NodeHealthChecker) check(now time.Time) {
+	health := c.service.NodeMetrics.EvaluateHealth(c.criteria, now)
+	unhealthy := make(map[proto.NodeID]bool)
+
+	for nodeID, h := range health {
+		if c.service.Consistent.IsNodeHealthy(nodeID) != h.Healthy {
+			log.WithFields(log.Fields{
+				"node":       nodeID,
+				"healthy":    h.Healthy,
+				"alive":      h.Alive,
+				"score":      h.Score,
+				"lastUpdate": h.LastUpdate,
+			}).Info("node health changed")
+		}
+
+		c.service.Consistent.SetNodeHealth(nodeID, h.Healthy)
+
+		if !h.Healthy {
+			unhealthy[nodeID] = true
+		}
+	}
+
+	unhealthyNodes.Set(float64(len(unhealthy)))
+
+	// collect databases served by unhealthy nodes
+	instances := make(map[proto.DatabaseID]wt.ServiceInstance)
+	for nodeID := range unhealthy {
+		dbs, err := c.service.ServiceMap.GetDatabases(nodeID)
+		if err != nil {
+			log.WithError(err).WithField("node", nodeID).Warning("get node databases failed")
+			continue
+		}
+		for _, db := range dbs {
+			instances[db.DatabaseID] = db
+		}
+	}
+
+	for dbID, instance := range instances {
+		if err := c.service.replaceUnhealthyPeers(instance, unhealthy); err != nil {
+			peerReplacements.WithLabelValues("error").Inc()
+			log.WithError(err).WithField("db", dbID).Warning("replace unhealthy database peers failed")
+			continue
+		}
+		peerReplacements.WithLabelValues("success").Inc()
+		log.WithField("db", dbID).Info("replaced unhealthy database peers")
+	}
+}
+
+// replaceUnhealthyPeers allocates new nodes for the unhealthy peers of database, the new nodes are
+// deployed with the database first, then the remaining peers are updated to the new peers config.
+// The leader is kept if healthy, otherwise the first healthy follower is promoted. The new nodes
+// catch up the committed logs from leader on deploying, before they join the kayak peers, the
+// logs committed in the meantime are caught up on the first prepare, see kayak.LogFetcher.
+func (s *DBService) replaceUnhealthyPeers(instance wt.ServiceInstance, unhealthy map[proto.NodeID]bool) (err error) {
+	if instance.Peers == nil {
+		return ErrInvalidDBPeersConfig
+	}
+
+	exclude := make(map[proto.NodeID]bool)
+	var kept []*kayak.Server
+
+	for _, server := range instance.Peers.Servers {
+		exclude[server.ID] = true
+		if !unhealthy[server.ID] {
+			kept = append(kept, server)
+		}
+	}
+
+	if len(kept) == len(instance.Peers.Servers) {
+		return
+	}
+	if len(kept) == 0 {
+		return ErrNoHealthyPeer
+	}
+
+	var nodes []proto.Node
+	var allocated []proto.NodeID
+	if nodes, allocated, err = s.pickNodes(instance.DatabaseID,
+		len(instance.Peers.Servers)-len(kept), instance.ResourceMeta, exclude); err != nil {
+		return
+	}
+
+	var peers *kayak.Peers
+	if peers, err = s.buildReplacedPeers(instance.Peers, kept, nodes, allocated); err != nil {
+		return
+	}
+
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+
+	// deploy database to the new nodes
+	createReq := new(wt.UpdateService)
+	createReq.Header.Op = wt.CreateDB
+	createReq.Header.Instance = wt.ServiceInstance{
+		DatabaseID:   instance.DatabaseID,
+		Peers:        peers,
+		ResourceMeta: instance.ResourceMeta,
+		GenesisBlock: instance.GenesisBlock,
+		SQLPolicy:    instance.SQLPolicy,
+	}
+	if err = createReq.Sign(signer); err != nil {
+		return
+	}
+
+	rollbackReq := new(wt.UpdateService)
+	rollbackReq.Header.Op = wt.DropDB
+	rollbackReq.Header.Instance = wt.ServiceInstance{
+		DatabaseID: instance.DatabaseID,
+	}
+	if err = rollbackReq.Sign(signer); err != nil {
+		return
+	}
+
+	if err = s.batchSendSvcReq(createReq, rollbackReq, allocated); err != nil {
+		return
+	}
+
+	// update peers config of the remaining nodes
+	updateReq := new(wt.UpdateService)
+	updateReq.Header.Op = wt.UpdateDB
+	updateReq.Header.Instance = wt.ServiceInstance{
+		DatabaseID: instance.DatabaseID,
+		Peers:      peers,
+	}
+	if err = updateReq.Sign(signer); err != nil {
+		return
+	}
+
+	keptNodes := make([]proto.NodeID, 0, len(kept))
+	for _, server := range kept {
+		keptNodes = append(keptNodes, server.ID)
+	}
+
+	if err = s.batchSendSingleSvcReq(updateReq, keptNodes); err != nil {
+		s.batchSendSingleSvcReq(rollbackReq, allocated)
+		return
+	}
+
+	// save to meta
+	instance.Peers = peers
+	return s.ServiceMap.Set(instance)
+}
+
+// buildReplacedPeers builds the next term peers config with the kept servers and allocated nodes.
+func (s *DBService) buildReplacedPeers(prev *kayak.Peers, kept []*kayak.Server,
+	nodes []proto.Node, allocated []proto.NodeID) (peers *kayak.Peers, err error) {
+	var pubKey *asymmetric.PublicKey
+	if pubKey, err = kms.GetLocalPublicKey(); err != nil {
+		return
+	}
+
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+
+	leaderID := kept[0].ID
+	for _, server := range kept {
+		if prev.Leader != nil && server.ID == prev.Leader.ID {
+			leaderID = server.ID
+			break
+		}
+	}
+
+	peers = &kayak.Peers{
+		Term:    prev.Term + 1,
+		PubKey:  pubKey,
+		Servers: make([]*kayak.Server, 0, len(kept)+len(allocated)),
+	}
+
+	for _, server := range kept {
+		newServer := &kayak.Server{
+			Role:   proto.Follower,
+			ID:     server.ID,
+			PubKey: server.PubKey,
+		}
+		if server.ID == leaderID {
+			newServer.Role = proto.Leader
+			peers.Leader = newServer
+		}
+		peers.Servers = append(peers.Servers, newServer)
+	}
+
+	allocatedMap := make(map[proto.NodeID]bool)
+	for _, nodeID := range allocated {
+		allocatedMap[nodeID] = true
+	}
+
+	for _, node := range nodes {
+		if allocatedMap[node.ID] {
+			peers.Servers = append(peers.Servers, &kayak.Server{
+				Role:   proto.Follower,
+				ID:     node.ID,
+				PubKey: node.PublicKey,
+			})
+		}
+	}
+
+	// sign the peers structure
+	err = peers.Sign(signer)
+
+	return
+}
@@ -19,8 +19,8 @@ package interfaces
 import (
 	"encoding/binary"
 
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -63,6 +63,10 @@ const (
 	TransactionTypeBaseAccount
 	// TransactionTypeCreateDatabase defines database creation transaction type.
 	TransactionTypeCreateDatabase
+	// TransactionTypeMultiSig defines multi-signature transaction envelope type.
+	TransactionTypeMultiSig
+	// TransactionTypeBindMultiSig defines multisig key set binding transaction type.
+	TransactionTypeBindMultiSig
 	// TransactionTypeNumber defines transaction types number.
 	TransactionTypeNumber
 )
@@ -87,6 +91,10 @@ func (t TransactionType) String() string {
 		return "BaseAccount"
 	case TransactionTypeCreateDatabase:
 		return "CreateDatabase"
+	case TransactionTypeMultiSig:
+		return "MultiSig"
+	case TransactionTypeBindMultiSig:
+		return "BindMultiSig"
 	default:
 		return "Unknown"
 	}
@@ -99,7 +107,7 @@ type Transaction interface {
 	GetAccountNonce() AccountNonce
 	GetHash() hash.Hash
 	GetTransactionType() TransactionType
-	Sign(signer *asymmetric.PrivateKey) error
+	Sign(signer kms.Signer) error
 	Verify() error
 	MarshalHash() ([]byte, error)
 	Msgsize() int
@@ -118,7 +118,8 @@ func (s *metaState) loadAccountCovenantBalance(addr proto.AccountAddress) (b uin
 func (s *metaState) storeBaseAccount(k proto.AccountAddress, v *accountObject) (err error) {
 	log.Debugf("store account %v to %v", k.String(), v)
 	// Since a transfer tx may create an empty receiver account, this method should try to cover
-	// the side effect.
+	// the side effect. The multisig config of genesis accounts is bound here as well, as long as
+	// the account has never sent any transaction.
 	if ao, ok := s.loadOrStoreAccountObject(k, v); ok {
 		ao.Lock()
 		defer ao.Unlock()
@@ -138,6 +139,9 @@ func (s *metaState) storeBaseAccount(k proto.AccountAddress, v *accountObject) (
 		}
 		ao.CovenantCoinBalance = cb
 		ao.StableCoinBalance = sb
+		if ao.MultiSig == nil {
+			ao.MultiSig = v.Account.MultiSig
+		}
 	}
 	return
 }
@@ -234,6 +238,7 @@ func (s *metaState) commitProcedure() (_ func(*bolt.Tx) error) {
 		// Clean dirty map and tx pool
 		s.dirty = newMetaIndex()
 		s.pool = newTxPool()
+		txPoolSize.Set(0)
 		return
 	}
 }
@@ -319,6 +324,7 @@ func (s *metaState) partialCommitProcedure(txs []pi.Transaction) (_ func(*bolt.T
 
 		// Clean dirty map and tx pool
 		s.pool = cp
+		txPoolSize.Set(float64(cp.size()))
 		s.readonly = cm.readonly
 		s.dirty = cm.dirty
 		return
@@ -664,14 +670,119 @@ func (s *metaState) applyBilling(tx *pt.Billing) (err error) {
 	return
 }
 
+// checkSingleSigAccount returns error if addr is a multisig account, which should only send
+// transactions within multisig envelopes.
+func (s *metaState) checkSingleSigAccount(addr proto.AccountAddress) (err error) {
+	if o, loaded := s.loadAccountObject(addr); loaded && o.MultiSig != nil {
+		err = ErrMultiSigRequired
+	}
+	return
+}
+
+// checkMultiSigAccount returns error if addr is not bound to the multisig key set config of the
+// envelope.
+func (s *metaState) checkMultiSigAccount(
+	addr proto.AccountAddress, config *pt.MultiSigConfig) (err error,
+) {
+	o, loaded := s.loadAccountObject(addr)
+	if !loaded || o.MultiSig == nil {
+		return ErrMultiSigNotBound
+	}
+	if !o.MultiSig.Equal(config) {
+		return ErrMultiSigConfigMismatch
+	}
+	return
+}
+
+// bindAccountMultiSig binds the account to the key set config of the binding transaction. The
+// envelope of the first binding must be signed by the key set deriving the account address, and
+// the following ones must be signed by the key set currently bound to the account.
+func (s *metaState) bindAccountMultiSig(config *pt.MultiSigConfig, tx *pt.BindMultiSig) (err error) {
+	var addr proto.AccountAddress
+	if _, err = tx.Config.Address(); err != nil {
+		return
+	}
+	o, loaded := s.loadAccountObject(tx.Address)
+	if !loaded {
+		return ErrAccountNotFound
+	}
+	if o.MultiSig != nil {
+		if !o.MultiSig.Equal(config) {
+			return ErrMultiSigConfigMismatch
+		}
+	} else {
+		if addr, err = config.Address(); err != nil {
+			return
+		}
+		if addr != tx.Address {
+			return pt.ErrMultiSigAddressMismatch
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *accountObject
+		ok       bool
+	)
+	if dst, ok = s.dirty.accounts[tx.Address]; !ok {
+		if src, ok = s.readonly.accounts[tx.Address]; !ok {
+			return ErrAccountNotFound
+		}
+		dst = &accountObject{}
+		deepcopier.Copy(&src.Account).To(&dst.Account)
+		s.dirty.accounts[tx.Address] = dst
+	}
+	var bound = tx.Config
+	dst.MultiSig = &bound
+	return
+}
+
+// applyMultiSigTx checks the signature threshold of the multisig envelope and applies the
+// transaction within.
+func (s *metaState) applyMultiSigTx(t *pt.MultiSigTx) (err error) {
+	if err = t.VerifyThreshold(); err != nil {
+		return
+	}
+	switch inner := t.Unwrap().(type) {
+	case *pt.Transfer:
+		if err = s.checkMultiSigAccount(inner.Sender, &t.Config); err != nil {
+			return
+		}
+		err = s.transferAccountStableBalance(inner.Sender, inner.Receiver, inner.Amount)
+	case *pt.BindMultiSig:
+		err = s.bindAccountMultiSig(&t.Config, inner)
+	default:
+		err = ErrUnknownTransactionType
+	}
+	return
+}
+
 func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
 	switch t := tx.(type) {
 	case *pt.Transfer:
+		if err = s.checkSingleSigAccount(t.Sender); err != nil {
+			return
+		}
 		err = s.transferAccountStableBalance(t.Sender, t.Receiver, t.Amount)
 	case *pt.Billing:
+		if err = s.checkSingleSigAccount(t.Producer); err != nil {
+			return
+		}
 		err = s.applyBilling(t)
 	case *pt.BaseAccount:
+		if t.MultiSig != nil {
+			var addr proto.AccountAddress
+			if addr, err = t.MultiSig.Address(); err != nil {
+				return
+			}
+			if addr != t.Address {
+				return pt.ErrMultiSigAddressMismatch
+			}
+		}
 		err = s.storeBaseAccount(t.Address, &accountObject{Account: t.Account})
+	case *pt.MultiSigTx:
+		err = s.applyMultiSigTx(t)
 	case *pi.TransactionWrapper:
 		// call again using unwrapped transaction
 		err = s.applyTransaction(t.Unwrap())
@@ -752,6 +863,7 @@ func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx
 		}
 		// Push to pool
 		s.pool.addTx(t, nextNonce)
+		txPoolSize.Set(float64(s.pool.size()))
 		return
 	}
 }
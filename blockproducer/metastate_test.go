@@ -24,6 +24,7 @@ import (
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/coreos/bbolt"
 	. "github.com/smartystreets/goconvey/convey"
@@ -843,3 +844,280 @@ func TestMetaState(t *testing.T) {
 		})
 	})
 }
+
+func TestMetaStateMultiSig(t *testing.T) {
+	Convey("Given a new metaState object with a multisig account", t, func() {
+		var (
+			ms       = newMetaState()
+			fl       = path.Join(testDataDir, t.Name())
+			db, err  = bolt.Open(fl, 0600, nil)
+			privKeys []*asymmetric.PrivateKey
+			cfg      = &pt.MultiSigConfig{Threshold: 2}
+			addr2    = proto.AccountAddress{0x0, 0x0, 0x0, 0x2}
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaAccountIndexBucket); err != nil {
+				return
+			}
+			if _, err = meta.CreateBucket(metaSQLChainIndexBucket); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucket(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+		for i := 0; i < 3; i++ {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			privKeys = append(privKeys, priv)
+			cfg.PublicKeys = append(cfg.PublicKeys, pub)
+		}
+		addr1, err := cfg.Address()
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+			Address:           addr1,
+			StableCoinBalance: 100,
+			MultiSig:          cfg,
+		})))
+		So(err, ShouldBeNil)
+
+		Convey("Single signed transaction from the account should be rejected", func() {
+			tx := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    1,
+				Amount:   10,
+			})
+			err = tx.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrMultiSigRequired)
+		})
+		Convey("Multisig transaction below threshold should be rejected", func() {
+			tx := pt.NewMultiSigTx(cfg, pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    1,
+				Amount:   10,
+			}))
+			err = tx.Sign(privKeys[1])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, pt.ErrMultiSigThreshold)
+		})
+		Convey("Multisig transaction reaching threshold should be applied", func() {
+			tx := pt.NewMultiSigTx(cfg, pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    1,
+				Amount:   10,
+			}))
+			err = tx.Sign(privKeys[1])
+			So(err, ShouldBeNil)
+			err = tx.Sign(privKeys[2])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldBeNil)
+			So(ms.pool.hasTx(tx), ShouldBeTrue)
+			bl, loaded := ms.loadAccountStableBalance(addr1)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 90)
+			bl, loaded = ms.loadAccountStableBalance(addr2)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 10)
+
+			Convey("The multisig config should be persisted on commit", func() {
+				err = db.Update(ms.commitProcedure())
+				So(err, ShouldBeNil)
+				err = db.View(ms.reloadProcedure())
+				So(err, ShouldBeNil)
+				ao, loaded := ms.loadAccountObject(addr1)
+				So(loaded, ShouldBeTrue)
+				So(ao.MultiSig, ShouldNotBeNil)
+				So(ao.MultiSig.Threshold, ShouldEqual, 2)
+				So(ao.MultiSig.PublicKeys, ShouldHaveLength, 3)
+			})
+		})
+		Convey("Multisig transaction from an unbound account should be rejected", func() {
+			var ucfg = &pt.MultiSigConfig{Threshold: 1, PublicKeys: cfg.PublicKeys[:2]}
+			addr3, err := ucfg.Address()
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+				Address:           addr3,
+				StableCoinBalance: 100,
+			})))
+			So(err, ShouldBeNil)
+			tx := pt.NewMultiSigTx(ucfg, pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr3,
+				Receiver: addr2,
+				Nonce:    1,
+				Amount:   10,
+			}))
+			err = tx.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrMultiSigNotBound)
+
+			Convey("Binding after the account sent transactions should be rejected", func() {
+				tr := pt.NewTransfer(&pt.TransferHeader{
+					Sender:   addr3,
+					Receiver: addr2,
+					Nonce:    1,
+					Amount:   10,
+				})
+				err = tr.Sign(privKeys[0])
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(tr))
+				So(err, ShouldBeNil)
+				err = ms.applyTransaction(pt.NewBaseAccount(&pt.Account{
+					Address:  addr3,
+					MultiSig: ucfg,
+				}))
+				So(err, ShouldEqual, ErrAccountExists)
+			})
+			Convey("Binding by multisig binding transaction should be applied", func() {
+				bind := pt.NewMultiSigTx(ucfg, pt.NewBindMultiSig(&pt.BindMultiSigHeader{
+					Address: addr3,
+					Config:  *ucfg,
+					Nonce:   1,
+				}))
+				err = bind.Sign(privKeys[1])
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(bind))
+				So(err, ShouldBeNil)
+				tx := pt.NewMultiSigTx(ucfg, pt.NewTransfer(&pt.TransferHeader{
+					Sender:   addr3,
+					Receiver: addr2,
+					Nonce:    2,
+					Amount:   10,
+				}))
+				err = tx.Sign(privKeys[0])
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(tx))
+				So(err, ShouldBeNil)
+				tr := pt.NewTransfer(&pt.TransferHeader{
+					Sender:   addr3,
+					Receiver: addr2,
+					Nonce:    3,
+					Amount:   10,
+				})
+				err = tr.Sign(privKeys[0])
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(tr))
+				So(err, ShouldEqual, ErrMultiSigRequired)
+			})
+			Convey("Binding signed by a key set not deriving the address should be rejected", func() {
+				bind := pt.NewMultiSigTx(cfg, pt.NewBindMultiSig(&pt.BindMultiSigHeader{
+					Address: addr3,
+					Config:  *ucfg,
+					Nonce:   1,
+				}))
+				err = bind.Sign(privKeys[0])
+				So(err, ShouldBeNil)
+				err = bind.Sign(privKeys[2])
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(bind))
+				So(err, ShouldEqual, pt.ErrMultiSigAddressMismatch)
+			})
+			Convey("Binding without multisig envelope should be rejected", func() {
+				bind := pt.NewBindMultiSig(&pt.BindMultiSigHeader{
+					Address: addr3,
+					Config:  *ucfg,
+					Nonce:   1,
+				})
+				err = bind.Sign(privKeys[0])
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(bind))
+				So(err, ShouldEqual, ErrUnknownTransactionType)
+			})
+		})
+		Convey("Key set update should be signed by the bound key set", func() {
+			var ncfg = &pt.MultiSigConfig{Threshold: 1, PublicKeys: cfg.PublicKeys[:1]}
+			bind := pt.NewMultiSigTx(ncfg, pt.NewBindMultiSig(&pt.BindMultiSigHeader{
+				Address: addr1,
+				Config:  *ncfg,
+				Nonce:   1,
+			}))
+			err = bind.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(bind))
+			So(err, ShouldEqual, ErrMultiSigConfigMismatch)
+
+			bind = pt.NewMultiSigTx(cfg, pt.NewBindMultiSig(&pt.BindMultiSigHeader{
+				Address: addr1,
+				Config:  *ncfg,
+				Nonce:   1,
+			}))
+			err = bind.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			err = bind.Sign(privKeys[1])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(bind))
+			So(err, ShouldBeNil)
+			ao, loaded := ms.loadAccountObject(addr1)
+			So(loaded, ShouldBeTrue)
+			So(ao.MultiSig.Equal(ncfg), ShouldBeTrue)
+
+			tx := pt.NewMultiSigTx(cfg, pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    2,
+				Amount:   10,
+			}))
+			err = tx.Sign(privKeys[1])
+			So(err, ShouldBeNil)
+			err = tx.Sign(privKeys[2])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrMultiSigConfigMismatch)
+
+			tx = pt.NewMultiSigTx(ncfg, pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    2,
+				Amount:   10,
+			}))
+			err = tx.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldBeNil)
+		})
+		Convey("Multisig transaction of database creation should be rejected", func() {
+			tx := pt.NewMultiSigTx(cfg, pt.NewCreateDatabase(&pt.CreateDatabaseHeader{
+				Owner: addr1,
+				Nonce: 1,
+			}))
+			err = tx.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			err = tx.Sign(privKeys[1])
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, pt.ErrMultiSigInvalidTx)
+		})
+		Convey("Base account with mismatched multisig config should be rejected", func() {
+			err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+				Address:  addr2,
+				MultiSig: cfg,
+			})))
+			So(err, ShouldEqual, pt.ErrMultiSigAddressMismatch)
+		})
+	})
+}
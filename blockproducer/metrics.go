@@ -0,0 +1,46 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	txPoolSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "covenantsql",
+		Subsystem: "blockproducer",
+		Name:      "tx_pool_size",
+		Help:      "Count of transactions pending in the tx pool.",
+	})
+	unhealthyNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "covenantsql",
+		Subsystem: "blockproducer",
+		Name:      "unhealthy_nodes",
+		Help:      "Count of nodes evaluated unhealthy from the uploaded metrics.",
+	})
+	peerReplacements = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "blockproducer",
+		Name:      "peer_replacements_total",
+		Help:      "Count of database peers replacements triggered by unhealthy nodes.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(txPoolSize, unhealthyNodes, peerReplacements)
+}
@@ -193,6 +193,15 @@ func (s *ChainRPCService) AddTx(req *AddTxReq, resp *AddTxResp) (err error) {
 	if req.Tx == nil {
 		return ErrUnknownTransactionType
 	}
+	// BaseAccount transaction is unsigned, so the multisig binding must be signed by the key set
+	// with a BindMultiSig transaction, and the BaseAccount binding is only allowed in genesis.
+	var tx = req.Tx
+	if w, ok := tx.(*pi.TransactionWrapper); ok {
+		tx = w.Unwrap()
+	}
+	if t, ok := tx.(*types.BaseAccount); ok && t.MultiSig != nil {
+		return ErrMultiSigBaseAccount
+	}
 
 	s.chain.pendingTxs <- req.Tx
 
@@ -121,6 +121,13 @@ func (p *txPool) cmpAndMoveNextTx(tx pi.Transaction) (ok bool) {
 	return
 }
 
+func (p *txPool) size() (n int) {
+	for _, v := range p.entries {
+		n += len(v.transactions)
+	}
+	return
+}
+
 func (p *txPool) halfDeepCopy() (cpy *txPool) {
 	cpy = newTxPool()
 	for k, v := range p.entries {
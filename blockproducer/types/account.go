@@ -71,4 +71,7 @@ type Account struct {
 	CovenantCoinBalance uint64
 	Rating              float64
 	NextNonce           pi.AccountNonce
+	// MultiSig is set if the account is a multisig account, transactions of the account
+	// should be wrapped in MultiSigTx and signed by enough keys.
+	MultiSig *MultiSigConfig
 }
@@ -18,8 +18,8 @@ package types
 
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -56,7 +56,7 @@ func (b *BaseAccount) GetHash() (h hash.Hash) {
 }
 
 // Sign implements interfaces/Transaction.Sign.
-func (b *BaseAccount) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (b *BaseAccount) Sign(signer kms.Signer) (err error) {
 	return
 }
 
@@ -18,7 +18,7 @@ package types
 
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -68,7 +68,7 @@ func NewBilling(header *BillingHeader) *Billing {
 }
 
 // Sign implements interfaces/Transaction.Sign.
-func (tb *Billing) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (tb *Billing) Sign(signer kms.Signer) (err error) {
 	return tb.DefaultHashSignVerifierImpl.Sign(&tb.BillingHeader, signer)
 }
 
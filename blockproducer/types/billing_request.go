@@ -21,6 +21,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -35,7 +36,9 @@ type BillingRequestHeader struct {
 	LowHeight  int32
 	HighBlock  hash.Hash
 	HighHeight int32
-	GasAmounts []*proto.AddrAndGas
+	// database state root committed in the high block
+	HighStateRoot hash.Hash
+	GasAmounts    []*proto.AddrAndGas
 }
 
 // BillingRequest defines periodically Billing sync.
@@ -59,7 +62,7 @@ func (br *BillingRequest) PackRequestHeader() (h *hash.Hash, err error) {
 }
 
 // SignRequestHeader first computes the hash of BillingRequestHeader, then signs the request.
-func (br *BillingRequest) SignRequestHeader(signer *asymmetric.PrivateKey, calcHash bool) (
+func (br *BillingRequest) SignRequestHeader(signer kms.Signer, calcHash bool) (
 	signee *asymmetric.PublicKey, signature *asymmetric.Signature, err error) {
 	if calcHash {
 		if _, err = br.PackRequestHeader(); err != nil {
@@ -130,7 +133,8 @@ func (br *BillingRequest) VerifySignatures() (err error) {
 // Compare returns if two billing records are identical.
 func (br *BillingRequest) Compare(r *BillingRequest) (err error) {
 	if !br.Header.LowBlock.IsEqual(&r.Header.LowBlock) ||
-		!br.Header.HighBlock.IsEqual(&br.Header.HighBlock) {
+		!br.Header.HighBlock.IsEqual(&r.Header.HighBlock) ||
+		!br.Header.HighStateRoot.IsEqual(&r.Header.HighStateRoot) {
 		err = ErrBillingNotMatch
 		return
 	}
@@ -78,8 +78,8 @@ func (z *BillingRequest) Msgsize() (s int) {
 func (z *BillingRequestHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 6
-	o = append(o, 0x86, 0x86)
+	// map header, size 7
+	o = append(o, 0x87, 0x87)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.GasAmounts)))
 	for za0001 := range z.GasAmounts {
 		if z.GasAmounts[za0001] == nil {
@@ -92,23 +92,29 @@ func (z *BillingRequestHeader) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	if oTemp, err := z.LowBlock.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	if oTemp, err := z.HighBlock.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x87)
+	if oTemp, err := z.HighStateRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x87)
 	o = hsp.AppendInt32(o, z.LowHeight)
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	o = hsp.AppendInt32(o, z.HighHeight)
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -127,6 +133,6 @@ func (z *BillingRequestHeader) Msgsize() (s int) {
 			s += z.GasAmounts[za0001].Msgsize()
 		}
 	}
-	s += 9 + z.LowBlock.Msgsize() + 10 + z.HighBlock.Msgsize() + 10 + hsp.Int32Size + 11 + hsp.Int32Size + 11 + z.DatabaseID.Msgsize()
+	s += 9 + z.LowBlock.Msgsize() + 10 + z.HighBlock.Msgsize() + 14 + z.HighStateRoot.Msgsize() + 10 + hsp.Int32Size + 11 + hsp.Int32Size + 11 + z.DatabaseID.Msgsize()
 	return
 }
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// BindMultiSigHeader defines the multisig binding transaction header.
+type BindMultiSigHeader struct {
+	Address proto.AccountAddress
+	Config  MultiSigConfig
+	Nonce   pi.AccountNonce
+}
+
+// BindMultiSig defines the transaction which binds an account to a multisig key set, or
+// replaces the key set of a bound account. It's only accepted within a MultiSigTx envelope,
+// which is signed by the key set deriving the account address for the first binding, or by the
+// key set currently bound to the account.
+type BindMultiSig struct {
+	BindMultiSigHeader
+	pi.TransactionTypeMixin
+	DefaultHashSignVerifierImpl
+}
+
+// NewBindMultiSig returns new instance.
+func NewBindMultiSig(header *BindMultiSigHeader) *BindMultiSig {
+	return &BindMultiSig{
+		BindMultiSigHeader:   *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeBindMultiSig),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *BindMultiSig) GetAccountAddress() proto.AccountAddress {
+	return t.Address
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *BindMultiSig) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *BindMultiSig) Sign(signer kms.Signer) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.BindMultiSigHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *BindMultiSig) Verify() (err error) {
+	return t.DefaultHashSignVerifierImpl.Verify(&t.BindMultiSigHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeBindMultiSig, (*BindMultiSig)(nil))
+}
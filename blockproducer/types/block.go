@@ -22,6 +22,7 @@ import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
@@ -74,7 +75,7 @@ func (b *Block) GetTxHashes() []*hash.Hash {
 }
 
 // PackAndSignBlock computes block's hash and sign it.
-func (b *Block) PackAndSignBlock(signer *asymmetric.PrivateKey) error {
+func (b *Block) PackAndSignBlock(signer kms.Signer) error {
 	hs := b.GetTxHashes()
 
 	b.SignedHeader.MerkleRoot = *merkle.NewMerkle(hs).GetRoot()
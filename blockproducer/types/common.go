@@ -19,6 +19,7 @@ package types
 import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 )
 
 type marshalHasher interface {
@@ -39,7 +40,7 @@ func (i *DefaultHashSignVerifierImpl) GetHash() hash.Hash {
 
 // Sign implements hashSignVerifier.Sign.
 func (i *DefaultHashSignVerifierImpl) Sign(
-	obj marshalHasher, signer *asymmetric.PrivateKey) (err error,
+	obj marshalHasher, signer kms.Signer) (err error,
 ) {
 	var enc []byte
 	if enc, err = obj.MarshalHash(); err != nil {
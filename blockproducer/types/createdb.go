@@ -18,7 +18,7 @@ package types
 
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -56,7 +56,7 @@ func NewCreateDatabase(header *CreateDatabaseHeader) *CreateDatabase {
 }
 
 // Sign implements interfaces/Transaction.Sign.
-func (cd *CreateDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (cd *CreateDatabase) Sign(signer kms.Signer) (err error) {
 	return cd.DefaultHashSignVerifierImpl.Sign(&cd.CreateDatabaseHeader, signer)
 }
 
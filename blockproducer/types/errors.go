@@ -36,4 +36,17 @@ var (
 
 	// ErrBillingNotMatch indicates that the billing request doesn't match the local result.
 	ErrBillingNotMatch = errors.New("billing request doesn't match")
+
+	// ErrMultiSigInvalidTx indicates that the transaction is not allowed in a multisig envelope.
+	ErrMultiSigInvalidTx = errors.New("invalid transaction in multisig envelope")
+
+	// ErrMultiSigAddressMismatch indicates that the transaction account address doesn't match the
+	// multisig key set.
+	ErrMultiSigAddressMismatch = errors.New("multisig account address doesn't match")
+
+	// ErrMultiSigUnknownSignee indicates that the signee is not in the multisig key set.
+	ErrMultiSigUnknownSignee = errors.New("signee not in multisig key set")
+
+	// ErrMultiSigThreshold indicates that the multisig envelope doesn't have enough signatures.
+	ErrMultiSigThreshold = errors.New("multisig threshold not reached")
 )
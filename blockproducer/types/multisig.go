@@ -0,0 +1,249 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// MultiSigConfig defines the key set and signature threshold of a multisig account.
+type MultiSigConfig struct {
+	Threshold  uint32
+	PublicKeys []*asymmetric.PublicKey
+}
+
+// Address returns the account address derived from the key set and threshold.
+func (c *MultiSigConfig) Address() (proto.AccountAddress, error) {
+	return crypto.MultiSigPubKeyHash(c.Threshold, c.PublicKeys)
+}
+
+// hasKey returns if the key is in the key set.
+func (c *MultiSigConfig) hasKey(key *asymmetric.PublicKey) bool {
+	for _, k := range c.PublicKeys {
+		if k != nil && k.IsEqual(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal returns if the two configs have the same threshold and key set, the key order is
+// irrelevant as it is to the derived address.
+func (c *MultiSigConfig) Equal(o *MultiSigConfig) bool {
+	if c == nil || o == nil {
+		return c == o
+	}
+	a, err := c.Address()
+	if err != nil {
+		return false
+	}
+	b, err := o.Address()
+	if err != nil {
+		return false
+	}
+	return a == b
+}
+
+// verifySignatures checks that all the signatures are valid signatures of h by distinct keys
+// in the key set, the threshold is not checked.
+func (c *MultiSigConfig) verifySignatures(h hash.Hash, sigs []*MultiSignature) (err error) {
+	for i, v := range sigs {
+		if v == nil || v.Signee == nil || v.Signature == nil || !c.hasKey(v.Signee) {
+			return ErrSignVerification
+		}
+		for _, w := range sigs[:i] {
+			if w.Signee.IsEqual(v.Signee) {
+				return ErrSignVerification
+			}
+		}
+		if !v.Signature.Verify(h[:], v.Signee) {
+			return ErrSignVerification
+		}
+	}
+	return
+}
+
+// VerifySignatures checks that sigs are valid signatures of h by distinct keys in the key set,
+// and the signature count reaches the threshold.
+func (c *MultiSigConfig) VerifySignatures(h hash.Hash, sigs []*MultiSignature) (err error) {
+	if err = c.verifySignatures(h, sigs); err != nil {
+		return
+	}
+	if uint32(len(sigs)) < c.Threshold {
+		return ErrMultiSigThreshold
+	}
+	return
+}
+
+// MultiSignature defines a signature of one key in the multisig key set.
+type MultiSignature struct {
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// AddMultiSignature signs h by signer and adds the signature to sigs, the signature of the same
+// key is replaced.
+func AddMultiSignature(
+	h hash.Hash, sigs []*MultiSignature, signer kms.Signer) (_ []*MultiSignature, err error,
+) {
+	var (
+		signee = signer.PubKey()
+		sig    *asymmetric.Signature
+	)
+	if sig, err = signer.Sign(h[:]); err != nil {
+		return sigs, err
+	}
+	for _, v := range sigs {
+		if v.Signee.IsEqual(signee) {
+			v.Signature = sig
+			return sigs, nil
+		}
+	}
+	return append(sigs, &MultiSignature{Signee: signee, Signature: sig}), nil
+}
+
+// MultiSigHeader defines the multi-signature transaction header.
+type MultiSigHeader struct {
+	Config MultiSigConfig
+	Tx     pi.Transaction
+}
+
+// MultiSigTx defines the multi-signature transaction envelope, which carries a transaction
+// originating from a multisig account with signatures of the account keys.
+type MultiSigTx struct {
+	MultiSigHeader
+	pi.TransactionTypeMixin
+	Hash       hash.Hash
+	Signatures []*MultiSignature
+}
+
+// NewMultiSigTx returns new instance.
+func NewMultiSigTx(config *MultiSigConfig, tx pi.Transaction) *MultiSigTx {
+	return &MultiSigTx{
+		MultiSigHeader: MultiSigHeader{
+			Config: *config,
+			Tx:     tx,
+		},
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeMultiSig),
+	}
+}
+
+// Unwrap returns the transaction within the envelope.
+func (t *MultiSigTx) Unwrap() pi.Transaction {
+	if w, ok := t.Tx.(*pi.TransactionWrapper); ok {
+		return w.Unwrap()
+	}
+	return t.Tx
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *MultiSigTx) GetAccountAddress() (addr proto.AccountAddress) {
+	if t.Tx == nil {
+		return
+	}
+	return t.Tx.GetAccountAddress()
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *MultiSigTx) GetAccountNonce() (nonce pi.AccountNonce) {
+	if t.Tx == nil {
+		return
+	}
+	return t.Tx.GetAccountNonce()
+}
+
+// GetHash implements interfaces/Transaction.GetHash.
+func (t *MultiSigTx) GetHash() hash.Hash {
+	return t.Hash
+}
+
+func (t *MultiSigTx) headerHash() (h hash.Hash, err error) {
+	if t.Tx == nil {
+		err = ErrMultiSigInvalidTx
+		return
+	}
+	var enc []byte
+	if enc, err = t.MultiSigHeader.MarshalHash(); err != nil {
+		return
+	}
+	h = hash.THashH(enc)
+	return
+}
+
+// Sign implements interfaces/Transaction.Sign, the signature of signer is added to the
+// envelope, so the envelope could be passed around and signed by each key holder.
+func (t *MultiSigTx) Sign(signer kms.Signer) (err error) {
+	var h hash.Hash
+	if h, err = t.headerHash(); err != nil {
+		return
+	}
+	if !t.Config.hasKey(signer.PubKey()) {
+		return ErrMultiSigUnknownSignee
+	}
+	var sigs = t.Signatures
+	if !t.Hash.IsEqual(&h) {
+		// header changed, drop stale signatures
+		sigs = nil
+	}
+	if sigs, err = AddMultiSignature(h, sigs, signer); err != nil {
+		return
+	}
+	t.Hash = h
+	t.Signatures = sigs
+	return
+}
+
+// Verify implements interfaces/Transaction.Verify. It checks the envelope header and all the
+// signatures, the threshold is checked by VerifyThreshold. The envelope config is checked
+// against the multisig config bound to the account by the chain state.
+func (t *MultiSigTx) Verify() (err error) {
+	var h hash.Hash
+	if h, err = t.headerHash(); err != nil {
+		return
+	}
+	if !t.Hash.IsEqual(&h) {
+		return ErrHashVerification
+	}
+	switch t.Tx.GetTransactionType() {
+	case pi.TransactionTypeTransfer, pi.TransactionTypeBindMultiSig:
+	default:
+		return ErrMultiSigInvalidTx
+	}
+	return t.Config.verifySignatures(h, t.Signatures)
+}
+
+// VerifyThreshold verifies the envelope and checks it carries enough signatures.
+func (t *MultiSigTx) VerifyThreshold() (err error) {
+	if err = t.Verify(); err != nil {
+		return
+	}
+	if uint32(len(t.Signatures)) < t.Config.Threshold {
+		return ErrMultiSigThreshold
+	}
+	return
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeMultiSig, (*MultiSigTx)(nil))
+}
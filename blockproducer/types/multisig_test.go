@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultiSigTx(t *testing.T) {
+	Convey("Given a 2-of-3 multisig account", t, func() {
+		var (
+			privKeys []*asymmetric.PrivateKey
+			cfg      = &MultiSigConfig{Threshold: 2}
+		)
+		for i := 0; i < 3; i++ {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			privKeys = append(privKeys, priv)
+			cfg.PublicKeys = append(cfg.PublicKeys, pub)
+		}
+		addr, err := cfg.Address()
+		So(err, ShouldBeNil)
+
+		tx := NewMultiSigTx(cfg, NewTransfer(&TransferHeader{
+			Sender: addr,
+			Nonce:  1,
+			Amount: 10,
+		}))
+		So(tx.GetAccountAddress(), ShouldEqual, addr)
+		So(tx.GetAccountNonce(), ShouldEqual, 1)
+
+		Convey("The envelope should reach threshold after enough signatures", func() {
+			err = tx.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			So(tx.Verify(), ShouldBeNil)
+			So(tx.VerifyThreshold(), ShouldEqual, ErrMultiSigThreshold)
+
+			// signing twice with the same key doesn't count
+			err = tx.Sign(privKeys[0])
+			So(err, ShouldBeNil)
+			So(tx.Signatures, ShouldHaveLength, 1)
+			So(tx.VerifyThreshold(), ShouldEqual, ErrMultiSigThreshold)
+
+			err = tx.Sign(privKeys[2])
+			So(err, ShouldBeNil)
+			So(tx.VerifyThreshold(), ShouldBeNil)
+			So(tx.GetHash(), ShouldResemble, tx.Hash)
+
+			Convey("The envelope should survive msgpack encoding", func() {
+				buf, err := utils.EncodeMsgPack(tx)
+				So(err, ShouldBeNil)
+				var out pi.Transaction
+				err = utils.DecodeMsgPack(buf.Bytes(), &out)
+				So(err, ShouldBeNil)
+				So(out.GetTransactionType(), ShouldEqual, pi.TransactionTypeMultiSig)
+				So(out.Verify(), ShouldBeNil)
+				So(out.GetHash(), ShouldResemble, tx.GetHash())
+				dec, ok := out.(*pi.TransactionWrapper).Unwrap().(*MultiSigTx)
+				So(ok, ShouldBeTrue)
+				So(dec.VerifyThreshold(), ShouldBeNil)
+				So(dec.Unwrap().GetTransactionType(), ShouldEqual, pi.TransactionTypeTransfer)
+			})
+			Convey("The envelope should fail on tampered transaction", func() {
+				tx.Unwrap().(*Transfer).Amount = 100
+				So(tx.Verify(), ShouldEqual, ErrHashVerification)
+			})
+			Convey("The envelope should fail on tampered signature", func() {
+				tx.Signatures[1].Signature = tx.Signatures[0].Signature
+				So(tx.Verify(), ShouldEqual, ErrSignVerification)
+			})
+			Convey("The envelope should fail on duplicated signature", func() {
+				tx.Signatures[1] = tx.Signatures[0]
+				So(tx.Verify(), ShouldEqual, ErrSignVerification)
+			})
+		})
+		Convey("The envelope should reject unknown signee", func() {
+			priv, _, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			So(tx.Sign(priv), ShouldEqual, ErrMultiSigUnknownSignee)
+		})
+		Convey("The envelope should carry multisig binding transaction", func() {
+			var newCfg = &MultiSigConfig{Threshold: 1, PublicKeys: cfg.PublicKeys[:2]}
+			tx.Tx = NewBindMultiSig(&BindMultiSigHeader{
+				Address: addr,
+				Config:  *newCfg,
+				Nonce:   1,
+			})
+			So(tx.Sign(privKeys[0]), ShouldBeNil)
+			So(tx.Sign(privKeys[1]), ShouldBeNil)
+			So(tx.VerifyThreshold(), ShouldBeNil)
+			So(tx.GetAccountAddress(), ShouldEqual, addr)
+
+			buf, err := utils.EncodeMsgPack(tx)
+			So(err, ShouldBeNil)
+			var out pi.Transaction
+			err = utils.DecodeMsgPack(buf.Bytes(), &out)
+			So(err, ShouldBeNil)
+			dec, ok := out.(*pi.TransactionWrapper).Unwrap().(*MultiSigTx)
+			So(ok, ShouldBeTrue)
+			So(dec.VerifyThreshold(), ShouldBeNil)
+			bind, ok := dec.Unwrap().(*BindMultiSig)
+			So(ok, ShouldBeTrue)
+			So(bind.Config.Equal(newCfg), ShouldBeTrue)
+			So(bind.Config.Equal(cfg), ShouldBeFalse)
+		})
+		Convey("The key set should verify threshold signatures of any hash", func() {
+			var (
+				h    = hash.THashH([]byte("owner operation"))
+				sigs []*MultiSignature
+			)
+			sigs, err = AddMultiSignature(h, sigs, privKeys[1])
+			So(err, ShouldBeNil)
+			So(cfg.VerifySignatures(h, sigs), ShouldEqual, ErrMultiSigThreshold)
+			sigs, err = AddMultiSignature(h, sigs, privKeys[1])
+			So(err, ShouldBeNil)
+			So(sigs, ShouldHaveLength, 1)
+			sigs, err = AddMultiSignature(h, sigs, privKeys[2])
+			So(err, ShouldBeNil)
+			So(cfg.VerifySignatures(h, sigs), ShouldBeNil)
+			So(cfg.VerifySignatures(hash.THashH([]byte("other")), sigs), ShouldEqual,
+				ErrSignVerification)
+
+			priv, _, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			sigs, err = AddMultiSignature(h, sigs, priv)
+			So(err, ShouldBeNil)
+			So(cfg.VerifySignatures(h, sigs), ShouldEqual, ErrSignVerification)
+		})
+		Convey("The envelope should reject unsupported transaction", func() {
+			tx.Tx = NewBaseAccount(&Account{Address: addr})
+			So(tx.Sign(privKeys[0]), ShouldBeNil)
+			So(tx.Verify(), ShouldEqual, ErrMultiSigInvalidTx)
+		})
+	})
+}
@@ -18,7 +18,7 @@ package types
 
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -57,7 +57,7 @@ func (t *Transfer) GetAccountNonce() pi.AccountNonce {
 }
 
 // Sign implements interfaces/Transaction.Sign.
-func (t *Transfer) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (t *Transfer) Sign(signer kms.Signer) (err error) {
 	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferHeader, signer)
 }
 
@@ -24,6 +24,8 @@ import (
 const (
 	paramKeyDebug          = "debug"
 	paramKeyUpdateInterval = "update_interval"
+	paramKeyEncryption     = "column_encryption"
+	paramKeyVerifyResults  = "verify_results"
 )
 
 var (
@@ -38,6 +40,14 @@ type Config struct {
 	Debug               bool
 	PeersUpdateInterval time.Duration
 
+	// ColumnEncryption is the path of the client-side column encryption schema file,
+	// see ColumnEncryptionConfig for the file format.
+	ColumnEncryption string
+
+	// VerifyResults requests row inclusion proofs for read queries and verifies them against
+	// the state root committed in the latest sqlchain block.
+	VerifyResults bool
+
 	// additional configs should be filled
 	// such as read/write/exec timeout
 	// currently no timeout is supported.
@@ -70,6 +80,14 @@ func (cfg *Config) FormatDSN() string {
 		newQuery.Set(paramKeyUpdateInterval, cfg.PeersUpdateInterval.String())
 	}
 
+	if cfg.ColumnEncryption != "" {
+		newQuery.Set(paramKeyEncryption, cfg.ColumnEncryption)
+	}
+
+	if cfg.VerifyResults {
+		newQuery.Set(paramKeyVerifyResults, "true")
+	}
+
 	u.RawQuery = newQuery.Encode()
 
 	return u.String()
@@ -96,6 +114,10 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 			return
 		}
 	}
+	cfg.ColumnEncryption = urlQuery.Get(paramKeyEncryption)
+	if urlQuery.Get(paramKeyVerifyResults) == "true" {
+		cfg.VerifyResults = true
+	}
 
 	return
 }
@@ -47,5 +47,17 @@ func TestConfig(t *testing.T) {
 		cfg.Debug = true
 		cfg.PeersUpdateInterval = DefaultPeersUpdateInterval
 		So(cfg.FormatDSN(), ShouldEqual, "covenantsql://db?debug=true")
+
+		// test with column encryption schema
+		cfg, err = ParseDSN("covenantsql://db?column_encryption=schema.yaml")
+		So(err, ShouldBeNil)
+		So(cfg.ColumnEncryption, ShouldEqual, "schema.yaml")
+		So(cfg.FormatDSN(), ShouldEqual, "covenantsql://db?column_encryption=schema.yaml")
+
+		// test with result verification
+		cfg, err = ParseDSN("covenantsql://db?verify_results=true")
+		So(err, ShouldBeNil)
+		So(cfg.VerifyResults, ShouldBeTrue)
+		So(cfg.FormatDSN(), ShouldEqual, "covenantsql://db?verify_results=true")
 	})
 }
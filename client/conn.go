@@ -33,14 +33,27 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
 )
 
+const (
+	// maxHeadBlockClockSkew is the max allowed time a head block is ahead of local time.
+	maxHeadBlockClockSkew = 10 * time.Minute
+)
+
 var (
 	connectionID uint64
 	seqNo        uint64
 	randSource   = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// headBlocks records the latest verified head block of databases, the head block fetched
+	// from a random peer should be at least as recent as it.
+	headBlocks     = make(map[proto.DatabaseID]*ct.Block)
+	headBlocksLock sync.Mutex
 )
 
 // conn implements an interface sql.Conn.
@@ -51,10 +64,13 @@ type conn struct {
 	peers     *kayak.Peers
 	peersLock sync.RWMutex
 	nodeID    proto.NodeID
-	privKey   *asymmetric.PrivateKey
+	signer    kms.Signer
 	pubKey    *asymmetric.PublicKey
+	cipher    *columnCipher
 
+	verifyResults bool
 	inTransaction bool
+	txContext     context.Context
 	closed        int32
 	closeCh       chan struct{}
 }
@@ -74,8 +90,8 @@ func newConn(cfg *Config) (c *conn, err error) {
 	}
 
 	// get local private key
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -85,13 +101,28 @@ func newConn(cfg *Config) (c *conn, err error) {
 		return
 	}
 
+	// load client-side column encryption schema
+	var cipher *columnCipher
+	if cfg.ColumnEncryption != "" {
+		var encCfg *ColumnEncryptionConfig
+		if encCfg, err = LoadColumnEncryptionConfig(cfg.ColumnEncryption); err != nil {
+			return
+		}
+		if cipher, err = newColumnCipher(encCfg); err != nil {
+			return
+		}
+	}
+
 	c = &conn{
 		dbID:    proto.DatabaseID(cfg.DatabaseID),
 		nodeID:  nodeID,
-		privKey: privKey,
+		signer:  signer,
 		pubKey:  pubKey,
+		cipher:  cipher,
 		queries: make([]wt.Query, 0),
 		closeCh: make(chan struct{}),
+
+		verifyResults: cfg.VerifyResults,
 	}
 
 	c.log("new conn database ", c.dbID)
@@ -165,8 +196,9 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 		return nil, sql.ErrTxDone
 	}
 
-	// TODO(xq262144): make use of the ctx argument
+	// the transaction queries are sent on commit in the context of transaction
 	c.inTransaction = true
+	c.txContext = ctx
 	c.queries = c.queries[:0]
 
 	return c, nil
@@ -190,8 +222,11 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	}
 
 	// TODO(xq262144): make use of the ctx argument
-	sq := convertQuery(query, args)
-	if _, err = c.addQuery(wt.WriteQuery, sq); err != nil {
+	var sq *wt.Query
+	if sq, err = convertQuery(query, args, c.cipher); err != nil {
+		return
+	}
+	if _, err = c.addQuery(ctx, wt.WriteQuery, sq); err != nil {
 		return
 	}
 
@@ -208,8 +243,11 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 	}
 
 	// TODO(xq262144): make use of the ctx argument
-	sq := convertQuery(query, args)
-	return c.addQuery(wt.ReadQuery, sq)
+	var sq *wt.Query
+	if sq, err = convertQuery(query, args, c.cipher); err != nil {
+		return
+	}
+	return c.addQuery(ctx, wt.ReadQuery, sq)
 }
 
 // Commit implements the driver.Tx.Commit method.
@@ -225,11 +263,12 @@ func (c *conn) Commit() (err error) {
 	defer func() {
 		c.queries = c.queries[:0]
 		c.inTransaction = false
+		c.txContext = nil
 	}()
 
 	if len(c.queries) > 0 {
 		// send query
-		if _, err = c.sendQuery(wt.WriteQuery, c.queries); err != nil {
+		if _, err = c.sendQuery(c.txContext, wt.WriteQuery, c.queries); err != nil {
 			return
 		}
 	}
@@ -250,6 +289,7 @@ func (c *conn) Rollback() error {
 	defer func() {
 		c.queries = c.queries[:0]
 		c.inTransaction = false
+		c.txContext = nil
 	}()
 
 	if len(c.queries) == 0 {
@@ -259,7 +299,7 @@ func (c *conn) Rollback() error {
 	return nil
 }
 
-func (c *conn) addQuery(queryType wt.QueryType, query *wt.Query) (rows driver.Rows, err error) {
+func (c *conn) addQuery(ctx context.Context, queryType wt.QueryType, query *wt.Query) (rows driver.Rows, err error) {
 	if c.inTransaction {
 		// check query type, enqueue query
 		if queryType == wt.ReadQuery {
@@ -273,13 +313,19 @@ func (c *conn) addQuery(queryType wt.QueryType, query *wt.Query) (rows driver.Ro
 		return
 	}
 
-	return c.sendQuery(queryType, []wt.Query{*query})
+	return c.sendQuery(ctx, queryType, []wt.Query{*query})
 }
 
-func (c *conn) sendQuery(queryType wt.QueryType, queries []wt.Query) (rows driver.Rows, err error) {
+func (c *conn) sendQuery(ctx context.Context, queryType wt.QueryType, queries []wt.Query) (rows driver.Rows, err error) {
 	c.peersLock.RLock()
 	defer c.peersLock.RUnlock()
 
+	ctx, span := trace.StartSpan(ctx, "client.sendQuery")
+	defer func() { span.End(err) }()
+	span.SetAttribute("database", c.dbID)
+	span.SetAttribute("query.type", queryType)
+	span.SetAttribute("query.count", len(queries))
+
 	// build request
 	seqNo := atomic.AddUint64(&seqNo, 1)
 	req := &wt.Request{
@@ -294,30 +340,41 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []wt.Query) (rows drive
 			},
 		},
 		Payload: wt.RequestPayload{
-			Queries: queries,
+			Queries:   queries,
+			WithProof: queryType == wt.ReadQuery && c.verifyResults,
 		},
 	}
 
-	if err = req.Sign(c.privKey); err != nil {
+	if err = c.signRequest(ctx, req); err != nil {
 		return
 	}
 
-	pCaller := rpc.NewPersistentCaller(c.peers.Leader.ID)
+	// result proofs are served by the producer of the head block, against its state snapshot
+	target := c.peers.Leader.ID
+	var head *ct.Block
+	if req.Payload.WithProof {
+		if head, err = c.fetchHeadBlock(); err != nil {
+			return
+		}
+		target = head.Producer()
+	}
+
+	pCaller := rpc.NewPersistentCaller(target)
 	defer pCaller.Close()
 	var response wt.Response
-	if err = pCaller.Call(route.DBSQuery.String(), req, &response); err != nil {
+	if err = c.callWithSpan(ctx, pCaller, route.DBSQuery, req, &response); err != nil {
 		if strings.Contains(err.Error(), "invalid request sequence") {
 			// request sequence failure, try again
 			atomic.StoreUint64(&connectionID, randSource.Uint64())
 			req.Header.ConnectionID = atomic.LoadUint64(&connectionID)
 			req.Header.SeqNo = atomic.AddUint64(&seqNo, 1)
 
-			if err = req.Sign(c.privKey); err != nil {
+			if err = c.signRequest(ctx, req); err != nil {
 				return
 			}
 
 			// send request again
-			if err = pCaller.Call(route.DBSQuery.String(), req, &response); err != nil {
+			if err = c.callWithSpan(ctx, pCaller, route.DBSQuery, req, &response); err != nil {
 				return
 			}
 		} else {
@@ -325,8 +382,8 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []wt.Query) (rows drive
 		}
 	}
 
-	// verify response
-	if err = response.Verify(); err != nil {
+	// verify response and query result proofs
+	if err = c.verifyResponse(ctx, req, &response, head); err != nil {
 		return
 	}
 
@@ -341,23 +398,60 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []wt.Query) (rows drive
 		},
 	}
 
-	if err = ack.Sign(c.privKey); err != nil {
+	if err = ack.Sign(c.signer); err != nil {
 		return
 	}
 
 	var ackRes wt.AckResponse
 
 	// send ack back
-	if err = pCaller.Call(route.DBSAck.String(), ack, &ackRes); err != nil {
+	if err = c.callWithSpan(ctx, pCaller, route.DBSAck, ack, &ackRes); err != nil {
 		log.Warningf("ack query failed: %v", err)
 		err = nil
 	}
 
-	rows = newRows(&response)
+	rows = newRows(&response, c.cipher)
 
 	return
 }
 
+// signRequest signs the query request in a traced span.
+func (c *conn) signRequest(ctx context.Context, req *wt.Request) (err error) {
+	_, span := trace.StartSpan(ctx, "client.sign")
+	defer func() { span.End(err) }()
+	return req.Sign(c.signer)
+}
+
+// verifyResponse verifies the response signature and the result proofs if requested.
+func (c *conn) verifyResponse(
+	ctx context.Context, req *wt.Request, response *wt.Response, head *ct.Block) (err error,
+) {
+	_, span := trace.StartSpan(ctx, "client.verify")
+	defer func() { span.End(err) }()
+
+	if err = response.Verify(); err != nil {
+		return
+	}
+	if req.Payload.WithProof {
+		if err = verifyResultProofs(req.Payload.Queries[0], response, head); err != nil {
+			return
+		}
+		err = projectProvableResult(req.Payload.Queries[0].Pattern, response)
+	}
+	return
+}
+
+// callWithSpan calls the rpc method in a traced span, the span context is carried in the request
+// envelope to the remote.
+func (c *conn) callWithSpan(ctx context.Context, caller *rpc.PersistentCaller, method route.RemoteFunc,
+	req proto.EnvelopeAPI, resp interface{}) (err error) {
+	ctx, span := trace.StartSpan(ctx, "client."+method.String())
+	defer func() { span.End(err) }()
+
+	trace.InjectEnvelope(ctx, req)
+	return caller.Call(method.String(), req, resp)
+}
+
 func (c *conn) getPeers() (err error) {
 	c.peersLock.Lock()
 	defer c.peersLock.Unlock()
@@ -365,7 +459,7 @@ func (c *conn) getPeers() (err error) {
 	req := new(bp.GetDatabaseRequest)
 	req.Header.DatabaseID = c.dbID
 
-	if err = req.Sign(c.privKey); err != nil {
+	if err = req.Sign(c.signer); err != nil {
 		return
 	}
 
@@ -384,11 +478,182 @@ func (c *conn) getPeers() (err error) {
 	return
 }
 
+// fetchHeadBlock fetches and verifies the head block from a random peer.
+func (c *conn) fetchHeadBlock() (block *ct.Block, err error) {
+	if len(c.peers.Servers) == 0 {
+		return nil, ErrInvalidResultProof
+	}
+
+	req := &sqlchain.MuxFetchBlockReq{
+		DatabaseID: c.dbID,
+		FetchBlockReq: sqlchain.FetchBlockReq{
+			// negative height fetches the head block
+			Height: -1,
+		},
+	}
+	resp := &sqlchain.MuxFetchBlockResp{}
+	peerID := c.peers.Servers[randSource.Intn(len(c.peers.Servers))].ID
+	if err = rpc.NewCaller().CallNode(peerID, route.SQLCFetchBlock.String(), req, resp); err != nil {
+		return
+	}
+
+	// verify block and its producer
+	if block = resp.Block; block == nil {
+		return nil, ErrStateRootMismatch
+	}
+	if err = block.Verify(); err != nil {
+		return
+	}
+	if _, found := c.peers.Find(block.Producer()); !found {
+		return nil, ErrInvalidResultProof
+	}
+	if !kms.IsNodePublicKeyAt(block.Producer(), block.SignedHeader.Signee, block.Timestamp()) {
+		return nil, ErrInvalidResultProof
+	}
+	if err = updateHeadBlock(c.dbID, block); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// updateHeadBlock records block as the latest head block of database, a peer serving a block
+// older than the latest one seen is rejected, so it can't prove the rows of a stale state.
+func updateHeadBlock(dbID proto.DatabaseID, block *ct.Block) (err error) {
+	if block.Timestamp().After(getLocalTime().Add(maxHeadBlockClockSkew)) {
+		return ErrStaleHeadBlock
+	}
+
+	headBlocksLock.Lock()
+	defer headBlocksLock.Unlock()
+	if last, ok := headBlocks[dbID]; ok {
+		if block.Timestamp().Before(last.Timestamp()) {
+			return ErrStaleHeadBlock
+		}
+		if block.Timestamp().Equal(last.Timestamp()) && !block.BlockHash().IsEqual(last.BlockHash()) {
+			return ErrStaleHeadBlock
+		}
+	}
+	headBlocks[dbID] = block
+	return
+}
+
+// verifyResultProofs verifies the response rows against the state root of the head block, each
+// row should be of the queried table and one of the requested rowids.
+func verifyResultProofs(query wt.Query, response *wt.Response, head *ct.Block) (err error) {
+	if head == nil || len(response.Payload.Proofs) != len(response.Payload.Rows) {
+		return ErrInvalidResultProof
+	}
+
+	var (
+		table  string
+		rowIDs []int64
+	)
+	if table, rowIDs, err = wt.ProvableRowIDs(query.Pattern, query.Args); err != nil {
+		return
+	}
+	requested := make(map[int64]bool, len(rowIDs))
+	for _, rowID := range rowIDs {
+		requested[rowID] = true
+	}
+
+	root := head.SignedHeader.StateRoot
+	if !root.IsEqual(&response.Header.StateRoot) {
+		return ErrStateRootMismatch
+	}
+
+	for i, row := range response.Payload.Rows {
+		if !strings.EqualFold(response.Payload.Proofs[i].Table, table) || len(row.Values) == 0 {
+			return ErrInvalidResultProof
+		}
+		rowID, ok := wt.ToRowID(row.Values[0])
+		if !ok || !requested[rowID] {
+			return ErrInvalidResultProof
+		}
+		// each requested row is returned at most once
+		delete(requested, rowID)
+		if err = response.Payload.Proofs[i].Verify(row.Values, &root); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// projectProvableResult projects the requested columns of query from the verified whole rows,
+// which start with the rowid column.
+func projectProvableResult(query string, response *wt.Response) (err error) {
+	var columns []wt.ProvableColumn
+	if _, _, columns, err = wt.ParseProvableQuery(query); err != nil {
+		return
+	}
+
+	payload := &response.Payload
+	if len(payload.Columns) == 0 || len(payload.DeclTypes) != len(payload.Columns) {
+		return ErrInvalidResultProof
+	}
+
+	var (
+		indexes []int
+		names   []string
+	)
+	if columns == nil {
+		// all columns except the rowid
+		for i := 1; i < len(payload.Columns); i++ {
+			indexes = append(indexes, i)
+			names = append(names, payload.Columns[i])
+		}
+	} else {
+		for _, col := range columns {
+			index := -1
+			for i, name := range payload.Columns {
+				if strings.EqualFold(name, col.Name) {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return ErrInvalidResultProof
+			}
+			indexes = append(indexes, index)
+			if col.Alias != "" {
+				names = append(names, col.Alias)
+			} else {
+				names = append(names, payload.Columns[index])
+			}
+		}
+	}
+
+	declTypes := make([]string, len(indexes))
+	for i, index := range indexes {
+		declTypes[i] = payload.DeclTypes[index]
+	}
+	for i, row := range payload.Rows {
+		if len(row.Values) != len(payload.Columns) {
+			return ErrInvalidResultProof
+		}
+		values := make([]interface{}, len(indexes))
+		for j, index := range indexes {
+			values[j] = row.Values[index]
+		}
+		payload.Rows[i].Values = values
+	}
+	payload.Columns = names
+	payload.DeclTypes = declTypes
+
+	return
+}
+
 func getLocalTime() time.Time {
 	return time.Now().UTC()
 }
 
-func convertQuery(query string, args []driver.NamedValue) (sq *wt.Query) {
+func convertQuery(query string, args []driver.NamedValue, cipher *columnCipher) (sq *wt.Query, err error) {
+	// encrypt args of encrypted columns before leaving the client
+	if args, err = cipher.encryptArgs(query, args); err != nil {
+		return
+	}
+
 	// rebuild args to named args
 	sq = &wt.Query{
 		Pattern: query,
@@ -19,8 +19,14 @@ package client
 import (
 	"database/sql"
 	"testing"
+	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -250,3 +256,123 @@ func TestTransaction(t *testing.T) {
 		So(err, ShouldNotBeNil)
 	})
 }
+
+func TestProjectProvableResult(t *testing.T) {
+	Convey("test provable result projection", t, func() {
+		newResponse := func() *wt.Response {
+			return &wt.Response{
+				Payload: wt.ResponsePayload{
+					Columns:   []string{"rowid", "id", "name"},
+					DeclTypes: []string{"INTEGER", "INT", "TEXT"},
+					Rows: []wt.ResponseRow{
+						{Values: []interface{}{int64(1), int64(10), "a"}},
+						{Values: []interface{}{int64(2), int64(20), "b"}},
+					},
+				},
+			}
+		}
+
+		res := newResponse()
+		err := projectProvableResult("SELECT * FROM t WHERE rowid IN (1, 2)", res)
+		So(err, ShouldBeNil)
+		So(res.Payload.Columns, ShouldResemble, []string{"id", "name"})
+		So(res.Payload.DeclTypes, ShouldResemble, []string{"INT", "TEXT"})
+		So(res.Payload.Rows[1].Values, ShouldResemble, []interface{}{int64(20), "b"})
+
+		res = newResponse()
+		err = projectProvableResult("SELECT name AS n, rowid FROM t WHERE rowid IN (1, 2)", res)
+		So(err, ShouldBeNil)
+		So(res.Payload.Columns, ShouldResemble, []string{"n", "rowid"})
+		So(res.Payload.Rows[0].Values, ShouldResemble, []interface{}{"a", int64(1)})
+
+		res = newResponse()
+		err = projectProvableResult("SELECT age FROM t WHERE rowid = 1", res)
+		So(err, ShouldEqual, ErrInvalidResultProof)
+	})
+}
+
+func TestVerifyResultProofs(t *testing.T) {
+	Convey("test provable result verification", t, func() {
+		rows := [][]interface{}{
+			{int64(1), int64(10), "a"},
+			{int64(2), int64(20), "b"},
+		}
+		rowHashes := make([]*hash.Hash, len(rows))
+		for i, row := range rows {
+			h, err := wt.RowHash(row)
+			So(err, ShouldBeNil)
+			rowHashes[i] = &h
+		}
+		tableTree := merkle.NewMerkle(rowHashes)
+		tableHash := wt.TableHash("t", tableTree.GetRoot())
+		root := *merkle.NewMerkle([]*hash.Hash{&tableHash}).GetRoot()
+		head := &ct.Block{}
+		head.SignedHeader.StateRoot = root
+
+		newResponse := func(table string) *wt.Response {
+			res := &wt.Response{}
+			res.Header.StateRoot = root
+			for i, row := range rows {
+				rowPath, err := tableTree.GetProof(uint64(i))
+				So(err, ShouldBeNil)
+				res.Payload.Rows = append(res.Payload.Rows, wt.ResponseRow{Values: row})
+				res.Payload.Proofs = append(res.Payload.Proofs, wt.RowProof{
+					Table:    table,
+					RowIndex: uint64(i),
+					RowPath:  rowPath,
+				})
+			}
+			return res
+		}
+
+		err := verifyResultProofs(wt.Query{
+			Pattern: "SELECT * FROM T WHERE rowid IN (1, ?)",
+			Args:    []sql.NamedArg{{Value: int64(2)}},
+		}, newResponse("t"), head)
+		So(err, ShouldBeNil)
+
+		// rows of other rowids or other tables
+		err = verifyResultProofs(wt.Query{Pattern: "SELECT * FROM t WHERE rowid = 1"}, newResponse("t"), head)
+		So(err, ShouldEqual, ErrInvalidResultProof)
+		err = verifyResultProofs(wt.Query{Pattern: "SELECT * FROM t2 WHERE rowid IN (1, 2)"}, newResponse("t"), head)
+		So(err, ShouldEqual, ErrInvalidResultProof)
+		err = verifyResultProofs(wt.Query{Pattern: "SELECT * FROM t2 WHERE rowid IN (1, 2)"}, newResponse("t2"), head)
+		So(err, ShouldEqual, wt.ErrRowProofVerification)
+		err = verifyResultProofs(wt.Query{Pattern: "SELECT * FROM t WHERE id > 1"}, newResponse("t"), head)
+		So(err, ShouldEqual, wt.ErrUnprovableQuery)
+
+		// duplicate rows
+		res := newResponse("t")
+		res.Payload.Rows[1] = res.Payload.Rows[0]
+		res.Payload.Proofs[1] = res.Payload.Proofs[0]
+		err = verifyResultProofs(wt.Query{Pattern: "SELECT * FROM t WHERE rowid IN (1, 2)"}, res, head)
+		So(err, ShouldEqual, ErrInvalidResultProof)
+	})
+}
+
+func TestUpdateHeadBlock(t *testing.T) {
+	Convey("test head block freshness", t, func() {
+		dbID := proto.DatabaseID("head_block_test")
+		defer func() {
+			headBlocksLock.Lock()
+			defer headBlocksLock.Unlock()
+			delete(headBlocks, dbID)
+		}()
+
+		newBlock := func(ts time.Time, h byte) *ct.Block {
+			b := &ct.Block{}
+			b.SignedHeader.Timestamp = ts
+			b.SignedHeader.BlockHash[0] = h
+			return b
+		}
+		now := getLocalTime()
+
+		So(updateHeadBlock(dbID, newBlock(now, 1)), ShouldBeNil)
+		So(updateHeadBlock(dbID, newBlock(now, 1)), ShouldBeNil)
+		So(updateHeadBlock(dbID, newBlock(now, 2)), ShouldEqual, ErrStaleHeadBlock)
+		So(updateHeadBlock(dbID, newBlock(now.Add(-time.Second), 3)), ShouldEqual, ErrStaleHeadBlock)
+		So(updateHeadBlock(dbID, newBlock(now.Add(2*maxHeadBlockClockSkew), 4)), ShouldEqual, ErrStaleHeadBlock)
+		So(updateHeadBlock(dbID, newBlock(now.Add(time.Second), 5)), ShouldBeNil)
+		So(updateHeadBlock(dbID, newBlock(now, 1)), ShouldEqual, ErrStaleHeadBlock)
+	})
+}
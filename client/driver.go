@@ -76,18 +76,50 @@ func Init(configFile string, masterKey []byte) (err error) {
 	return
 }
 
+// MultiSigOwner defines the multisig wallet owning a database, and the key holders of the wallet
+// signing the database owner operations, at least threshold signers are required.
+type MultiSigOwner struct {
+	Wallet  proto.AccountAddress
+	Signers []kms.Signer
+}
+
+func (o *MultiSigOwner) sign(signOwner func(kms.Signer) error) (err error) {
+	if o == nil {
+		return
+	}
+	for _, signer := range o.Signers {
+		if err = signOwner(signer); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // Create send create database operation to block producer.
 func Create(meta ResourceMeta) (dsn string, err error) {
+	return CreateWithOwner(meta, nil)
+}
+
+// CreateWithOwner sends create database operation to block producer, the database is owned by
+// the multisig wallet of owner, and the owner operations of the database require threshold
+// signatures of the wallet key set.
+func CreateWithOwner(meta ResourceMeta, owner *MultiSigOwner) (dsn string, err error) {
 	req := new(bp.CreateDatabaseRequest)
 	req.Header.ResourceMeta = wt.ResourceMeta(meta)
+	if owner != nil {
+		req.Header.OwnerWallet = owner.Wallet
+	}
 	if req.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
 		return
 	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
-	if err = req.Sign(privateKey); err != nil {
+	if err = req.Sign(signer); err != nil {
+		return
+	}
+	if err = owner.sign(req.SignOwner); err != nil {
 		return
 	}
 	res := new(bp.CreateDatabaseResponse)
@@ -108,6 +140,12 @@ func Create(meta ResourceMeta) (dsn string, err error) {
 
 // Drop send drop database operation to block producer.
 func Drop(dsn string) (err error) {
+	return DropWithOwner(dsn, nil)
+}
+
+// DropWithOwner sends drop database operation of database owned by multisig wallet to block
+// producer.
+func DropWithOwner(dsn string, owner *MultiSigOwner) (err error) {
 	var cfg *Config
 	if cfg, err = ParseDSN(dsn); err != nil {
 		return
@@ -118,11 +156,14 @@ func Drop(dsn string) (err error) {
 	if req.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
 		return
 	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+	if err = req.Sign(signer); err != nil {
 		return
 	}
-	if err = req.Sign(privateKey); err != nil {
+	if err = owner.sign(req.SignOwner); err != nil {
 		return
 	}
 	res := new(bp.DropDatabaseResponse)
@@ -131,6 +172,39 @@ func Drop(dsn string) (err error) {
 	return
 }
 
+// UpdatePolicy send update database sql policy operation to block producer, only the creator of
+// database is permitted.
+func UpdatePolicy(dsn string, policy wt.SQLPolicy) (err error) {
+	return UpdatePolicyWithOwner(dsn, policy, nil)
+}
+
+// UpdatePolicyWithOwner sends update database sql policy operation of database owned by multisig
+// wallet to block producer.
+func UpdatePolicyWithOwner(dsn string, policy wt.SQLPolicy, owner *MultiSigOwner) (err error) {
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+
+	req := new(bp.UpdateDatabasePolicyRequest)
+	req.Header.DatabaseID = proto.DatabaseID(cfg.DatabaseID)
+	req.Header.Policy = policy
+	var signer kms.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+	if err = req.Sign(signer); err != nil {
+		return
+	}
+	if err = owner.sign(req.SignOwner); err != nil {
+		return
+	}
+	res := new(bp.UpdateDatabasePolicyResponse)
+	err = requestBP(route.BPDBUpdateDatabasePolicy, req, res)
+
+	return
+}
+
 // GetStableCoinBalance get the stable coin balance of current account.
 func GetStableCoinBalance() (balance uint64, err error) {
 	req := new(bp.QueryAccountStableBalanceReq)
@@ -0,0 +1,479 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/sqlparser"
+	"gopkg.in/yaml.v2"
+)
+
+// ColumnEncryptionMode defines how values of an encrypted column are encrypted.
+type ColumnEncryptionMode string
+
+const (
+	// ColumnEncryptionDeterministic encrypts the same plain value to the same cipher value,
+	// so the column could be used in equality lookups, but equal values are visible to miners.
+	ColumnEncryptionDeterministic ColumnEncryptionMode = "deterministic"
+	// ColumnEncryptionRandomized encrypts with a random nonce, the column could not be
+	// used in any condition of the query.
+	ColumnEncryptionRandomized ColumnEncryptionMode = "randomized"
+)
+
+// Encrypted value layout, the header and the normalized column name are authenticated as
+// additional data of AES-256-GCM, so cipher values could not be moved to other columns:
+//
+//	magic(4) | mode(1) | nonce(12) | ciphertext(type(1) + value) + tag(16)
+const (
+	encryptedMagic     = "CQLC"
+	encryptedHeaderLen = len(encryptedMagic) + 1 + columnNonceLen
+	columnNonceLen     = 12
+	columnKeyMinLen    = 32
+
+	modeDeterministic byte = 1
+	modeRandomized    byte = 2
+)
+
+// Plain value type tags, so the decrypted value has the same type as before encryption.
+const (
+	valueNil byte = iota
+	valueInt64
+	valueFloat64
+	valueBool
+	valueBytes
+	valueString
+	valueTime
+)
+
+// ColumnEncryptionConfig defines the client-side encryption schema of a database. Columns are
+// matched by name against the named arguments of queries and the columns of query results.
+type ColumnEncryptionConfig struct {
+	// KeyFile contains the hex encoded column key of at least 32 bytes, relative paths are
+	// resolved against the directory of the schema file. The key never leaves the client.
+	KeyFile string `yaml:"KeyFile"`
+	// Columns maps column names to encryption modes.
+	Columns map[string]ColumnEncryptionMode `yaml:"Columns"`
+}
+
+// LoadColumnEncryptionConfig loads the encryption schema from yaml file.
+func LoadColumnEncryptionConfig(path string) (cfg *ColumnEncryptionConfig, err error) {
+	var content []byte
+	if content, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+
+	cfg = &ColumnEncryptionConfig{}
+	if err = yaml.Unmarshal(content, cfg); err != nil {
+		return
+	}
+
+	if cfg.KeyFile != "" && !filepath.IsAbs(cfg.KeyFile) {
+		cfg.KeyFile = filepath.Join(filepath.Dir(path), cfg.KeyFile)
+	}
+
+	return
+}
+
+type columnCipher struct {
+	aead    cipher.AEAD
+	macKey  []byte
+	columns map[string]byte
+}
+
+func newColumnCipher(cfg *ColumnEncryptionConfig) (c *columnCipher, err error) {
+	var content []byte
+	if content, err = ioutil.ReadFile(cfg.KeyFile); err != nil {
+		return
+	}
+
+	var key []byte
+	if key, err = hex.DecodeString(strings.TrimSpace(string(content))); err != nil {
+		return
+	}
+	if len(key) < columnKeyMinLen {
+		err = ErrInvalidColumnKey
+		return
+	}
+
+	c = &columnCipher{
+		macKey:  deriveColumnKey(key, "mac"),
+		columns: make(map[string]byte, len(cfg.Columns)),
+	}
+
+	for name, mode := range cfg.Columns {
+		switch ColumnEncryptionMode(strings.ToLower(string(mode))) {
+		case ColumnEncryptionDeterministic:
+			c.columns[strings.ToLower(name)] = modeDeterministic
+		case ColumnEncryptionRandomized:
+			c.columns[strings.ToLower(name)] = modeRandomized
+		default:
+			err = ErrInvalidEncryptionMode
+			return
+		}
+	}
+
+	// key is 256 bits, there should not be any error
+	block, _ := aes.NewCipher(deriveColumnKey(key, "enc"))
+	c.aead, err = cipher.NewGCM(block)
+
+	return
+}
+
+// deriveColumnKey derives independent sub keys for encryption and deterministic nonce generation.
+func deriveColumnKey(key []byte, usage string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("CovenantSQL column encryption " + usage))
+	return mac.Sum(nil)
+}
+
+// columnName normalizes column or named argument name for encrypted column lookups.
+func columnName(column string) string {
+	return strings.ToLower(strings.TrimLeft(column, ":@$"))
+}
+
+// mode returns the encryption mode of column, or 0 if the column is not encrypted.
+func (c *columnCipher) mode(column string) byte {
+	if c == nil || column == "" {
+		return 0
+	}
+	return c.columns[columnName(column)]
+}
+
+// referencesEncryptedColumn returns if the query mentions any encrypted column as an identifier.
+// String literals and named parameters are skipped, the check is conservative, e.g. a table
+// having the same name as an encrypted column is also reported.
+func (c *columnCipher) referencesEncryptedColumn(query string) bool {
+	isIdent := func(b byte) bool {
+		return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+	}
+	for i := 0; i < len(query); {
+		switch ch := query[i]; {
+		case ch == '\'':
+			// skip string literal, quotes are escaped by doubling
+			for i++; i < len(query); i++ {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case ch == '"' || ch == '`' || ch == '[':
+			end := ch
+			if ch == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(query[i+1:], end)
+			if j < 0 {
+				j = len(query) - i - 1
+			}
+			if c.mode(query[i+1:i+1+j]) != 0 {
+				return true
+			}
+			i += j + 2
+		case ch == ':' || ch == '@' || ch == '$':
+			// skip named parameter
+			for i++; i < len(query) && isIdent(query[i]); i++ {
+			}
+		case isIdent(ch):
+			j := i
+			for ; j < len(query) && isIdent(query[j]); j++ {
+			}
+			if c.mode(query[i:j]) != 0 {
+				return true
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// columnAdditionalData returns the additional data authenticating the header and the column.
+func columnAdditionalData(header []byte, column string) []byte {
+	ad := make([]byte, 0, len(header)+len(column))
+	ad = append(ad, header...)
+	return append(ad, column...)
+}
+
+func (c *columnCipher) encrypt(column string, mode byte, v driver.Value) (out []byte, err error) {
+	column = columnName(column)
+	var plain []byte
+	if plain, err = marshalColumnValue(v); err != nil {
+		return
+	}
+
+	out = make([]byte, encryptedHeaderLen, encryptedHeaderLen+len(plain)+c.aead.Overhead())
+	copy(out, encryptedMagic)
+	out[len(encryptedMagic)] = mode
+	nonce := out[len(encryptedMagic)+1:]
+
+	if mode == modeDeterministic {
+		// synthetic nonce, same plain value of the same column leads to same cipher value,
+		// the column name is mixed in so equal values in different columns are not linkable
+		var colLen [4]byte
+		binary.BigEndian.PutUint32(colLen[:], uint32(len(column)))
+		mac := hmac.New(sha256.New, c.macKey)
+		mac.Write(colLen[:])
+		mac.Write([]byte(column))
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(out, nonce, plain, columnAdditionalData(out[:encryptedHeaderLen], column)), nil
+}
+
+func (c *columnCipher) decrypt(column string, in []byte) (v driver.Value, err error) {
+	if len(in) < encryptedHeaderLen+c.aead.Overhead() {
+		return nil, ErrDecryptColumn
+	}
+
+	nonce := in[len(encryptedMagic)+1 : encryptedHeaderLen]
+	ad := columnAdditionalData(in[:encryptedHeaderLen], columnName(column))
+	var plain []byte
+	if plain, err = c.aead.Open(nil, nonce, in[encryptedHeaderLen:], ad); err != nil {
+		return nil, ErrDecryptColumn
+	}
+
+	return unmarshalColumnValue(plain)
+}
+
+// checkPlainValues returns error if any value compared to or assigned to an encrypted column in
+// query is not a named argument of the column name, such as literals, which would be sent to
+// miners in plain text. Queries referencing encrypted columns which could not be parsed are
+// rejected as well.
+func (c *columnCipher) checkPlainValues(query string) (err error) {
+	if !c.referencesEncryptedColumn(query) {
+		return
+	}
+
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	for {
+		stmt, perr := sqlparser.ParseNext(tokenizer)
+		if perr == io.EOF {
+			return
+		}
+		if perr != nil {
+			return ErrPlainEncryptedValue
+		}
+		if err = sqlparser.Walk(c.visitPlainValues, stmt); err != nil {
+			return
+		}
+	}
+}
+
+func (c *columnCipher) visitPlainValues(node sqlparser.SQLNode) (kontinue bool, err error) {
+	switch n := node.(type) {
+	case *sqlparser.ComparisonExpr:
+		err = c.checkColumnValue(n.Left, n.Right)
+		if err == nil {
+			err = c.checkColumnValue(n.Right, n.Left)
+		}
+	case *sqlparser.RangeCond:
+		err = c.checkColumnValue(n.Left, n.From)
+		if err == nil {
+			err = c.checkColumnValue(n.Left, n.To)
+		}
+	case *sqlparser.UpdateExpr:
+		err = c.checkColumnValue(n.Name, n.Expr)
+	case *sqlparser.Insert:
+		rows, ok := n.Rows.(sqlparser.Values)
+		if !ok {
+			break
+		}
+		for _, row := range rows {
+			for i, col := range n.Columns {
+				if i < len(row) {
+					if err = c.checkColumnValue(&sqlparser.ColName{Name: col}, row[i]); err != nil {
+						return
+					}
+				}
+			}
+		}
+	}
+	return err == nil, err
+}
+
+// checkColumnValue returns error if col is an encrypted column and expr contains any value other
+// than null or the named argument of the column name.
+func (c *columnCipher) checkColumnValue(col sqlparser.Expr, expr sqlparser.Expr) error {
+	name, ok := col.(*sqlparser.ColName)
+	if !ok || c.mode(name.Name.String()) == 0 {
+		return nil
+	}
+	column := columnName(name.Name.String())
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch v := node.(type) {
+		case *sqlparser.Subquery:
+			// values of subquery are checked against its own columns
+			return false, nil
+		case *sqlparser.SQLVal:
+			if v.Type != sqlparser.ValArg || columnName(string(v.Val)) != column {
+				return false, ErrPlainEncryptedValue
+			}
+		}
+		return true, nil
+	}, expr)
+}
+
+// encryptArgs encrypts the named arguments declared as encrypted columns. Positional arguments
+// could not be matched with columns, so they are rejected if the query references any encrypted
+// column, otherwise plain values would be sent to miners silently. For the same reason, values
+// of encrypted columns in query should be named arguments of the column names.
+func (c *columnCipher) encryptArgs(query string, args []driver.NamedValue) (out []driver.NamedValue, err error) {
+	if c == nil {
+		return args, nil
+	}
+
+	for _, a := range args {
+		if a.Name == "" && c.referencesEncryptedColumn(query) {
+			return nil, ErrPositionalEncryptedArg
+		}
+	}
+	if err = c.checkPlainValues(query); err != nil {
+		return
+	}
+
+	out = make([]driver.NamedValue, len(args))
+	copy(out, args)
+
+	for i := range out {
+		mode := c.mode(out[i].Name)
+		if mode == 0 || out[i].Value == nil {
+			continue
+		}
+		if out[i].Value, err = c.encrypt(columnName(out[i].Name), mode, out[i].Value); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// decryptValue decrypts the value of column, values not encrypted by the client are returned as is.
+func (c *columnCipher) decryptValue(column string, v driver.Value) (driver.Value, error) {
+	if c.mode(column) == 0 {
+		return v, nil
+	}
+
+	var raw []byte
+	switch d := v.(type) {
+	case []byte:
+		raw = d
+	case string:
+		raw = []byte(d)
+	default:
+		return v, nil
+	}
+
+	if !bytes.HasPrefix(raw, []byte(encryptedMagic)) {
+		return v, nil
+	}
+
+	return c.decrypt(column, raw)
+}
+
+func marshalColumnValue(v driver.Value) (out []byte, err error) {
+	switch d := v.(type) {
+	case nil:
+		out = []byte{valueNil}
+	case int64:
+		out = make([]byte, 9)
+		out[0] = valueInt64
+		binary.BigEndian.PutUint64(out[1:], uint64(d))
+	case float64:
+		out = make([]byte, 9)
+		out[0] = valueFloat64
+		binary.BigEndian.PutUint64(out[1:], math.Float64bits(d))
+	case bool:
+		out = []byte{valueBool, 0}
+		if d {
+			out[1] = 1
+		}
+	case []byte:
+		out = append([]byte{valueBytes}, d...)
+	case string:
+		out = append([]byte{valueString}, d...)
+	case time.Time:
+		var b []byte
+		if b, err = d.MarshalBinary(); err != nil {
+			return
+		}
+		out = append([]byte{valueTime}, b...)
+	default:
+		err = ErrUnsupportedColumnValue
+	}
+	return
+}
+
+func unmarshalColumnValue(in []byte) (v driver.Value, err error) {
+	if len(in) == 0 {
+		return nil, ErrDecryptColumn
+	}
+
+	switch in[0] {
+	case valueNil:
+		return nil, nil
+	case valueInt64:
+		if len(in) != 9 {
+			return nil, ErrDecryptColumn
+		}
+		return int64(binary.BigEndian.Uint64(in[1:])), nil
+	case valueFloat64:
+		if len(in) != 9 {
+			return nil, ErrDecryptColumn
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(in[1:])), nil
+	case valueBool:
+		if len(in) != 2 {
+			return nil, ErrDecryptColumn
+		}
+		return in[1] != 0, nil
+	case valueBytes:
+		return in[1:], nil
+	case valueString:
+		return string(in[1:]), nil
+	case valueTime:
+		var t time.Time
+		if err = t.UnmarshalBinary(in[1:]); err != nil {
+			return nil, ErrDecryptColumn
+		}
+		return t, nil
+	default:
+		return nil, ErrDecryptColumn
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestColumnEncryption(t *testing.T) {
+	Convey("Given a column encryption schema", t, func() {
+		dir, err := ioutil.TempDir("", "column_encryption")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+		schemaFile := filepath.Join(dir, "schema.yaml")
+		err = ioutil.WriteFile(filepath.Join(dir, "column.key"),
+			[]byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f\n"), 0600)
+		So(err, ShouldBeNil)
+		err = ioutil.WriteFile(schemaFile, []byte(`
+KeyFile: column.key
+Columns:
+  email: deterministic
+  ssn: randomized
+`), 0600)
+		So(err, ShouldBeNil)
+
+		cfg, err := LoadColumnEncryptionConfig(schemaFile)
+		So(err, ShouldBeNil)
+		So(cfg.KeyFile, ShouldEqual, filepath.Join(dir, "column.key"))
+		c, err := newColumnCipher(cfg)
+		So(err, ShouldBeNil)
+
+		Convey("Only args of encrypted columns should be encrypted", func() {
+			now := time.Now().UTC()
+			args := []driver.NamedValue{
+				{Name: "email", Value: "alice@example.com"},
+				{Name: "ssn", Value: int64(123456789)},
+				{Name: "name", Value: "alice"},
+				{Ordinal: 4, Value: "positional"},
+			}
+			sq, err := convertQuery("INSERT INTO t VALUES(:email, :ssn, :name, ?)", args, c)
+			So(err, ShouldBeNil)
+			So(sq.Args[0].Value, ShouldHaveSameTypeAs, []byte{})
+			So(sq.Args[1].Value, ShouldHaveSameTypeAs, []byte{})
+			So(sq.Args[2].Value, ShouldEqual, "alice")
+			So(sq.Args[3].Value, ShouldEqual, "positional")
+			So(args[0].Value, ShouldEqual, "alice@example.com")
+
+			// deterministic mode should produce same cipher value for lookups
+			sq2, err := convertQuery("SELECT * FROM t WHERE email = :email", args[:1], c)
+			So(err, ShouldBeNil)
+			So(sq2.Args[0].Value, ShouldResemble, sq.Args[0].Value)
+
+			// randomized mode should not
+			sq3, err := convertQuery("SELECT * FROM t WHERE ssn = :ssn", args[1:2], c)
+			So(err, ShouldBeNil)
+			So(sq3.Args[0].Value, ShouldNotResemble, sq.Args[1].Value)
+
+			// deterministic values of different columns should not be linkable
+			enc1, err := c.encrypt("email", modeDeterministic, "alice")
+			So(err, ShouldBeNil)
+			enc2, err := c.encrypt("name", modeDeterministic, "alice")
+			So(err, ShouldBeNil)
+			So(enc1, ShouldNotResemble, enc2)
+
+			Convey("The rows should be decrypted", func() {
+				r := newRows(&wt.Response{
+					Payload: wt.ResponsePayload{
+						Columns: []string{"email", "ssn", "name", "created"},
+						Rows: []wt.ResponseRow{
+							{Values: []interface{}{
+								// blobs might be decoded as string by msgpack
+								string(sq.Args[0].Value.([]byte)),
+								sq.Args[1].Value,
+								"alice",
+								now,
+							}},
+						},
+					},
+				}, c)
+				dest := make([]driver.Value, 4)
+				err = r.Next(dest)
+				So(err, ShouldBeNil)
+				So(dest[0], ShouldEqual, "alice@example.com")
+				So(dest[1], ShouldEqual, int64(123456789))
+				So(dest[2], ShouldEqual, "alice")
+				So(dest[3], ShouldEqual, now)
+			})
+			Convey("The tampered value should fail to decrypt", func() {
+				raw := sq.Args[1].Value.([]byte)
+				raw[len(raw)-1] ^= 0xff
+				_, err = c.decryptValue("ssn", raw)
+				So(err, ShouldEqual, ErrDecryptColumn)
+			})
+		})
+		Convey("Positional args should be rejected if encrypted columns are referenced", func() {
+			args := []driver.NamedValue{{Ordinal: 1, Value: "alice@example.com"}}
+			for _, q := range []string{
+				"INSERT INTO t(name, email) VALUES(?, ?)",
+				"SELECT * FROM t WHERE \"Email\" = ?",
+				"UPDATE t SET [ssn] = ? WHERE id = 1",
+			} {
+				_, err = convertQuery(q, args, c)
+				So(err, ShouldEqual, ErrPositionalEncryptedArg)
+			}
+			for _, q := range []string{
+				"SELECT * FROM t WHERE name = ?",
+				"SELECT * FROM t WHERE name = 'email' AND id = ?",
+			} {
+				_, err = convertQuery(q, args, c)
+				So(err, ShouldBeNil)
+			}
+		})
+		Convey("Plain values of encrypted columns should be rejected", func() {
+			args := []driver.NamedValue{{Name: "email", Value: "alice@example.com"}}
+			for _, q := range []string{
+				"INSERT INTO t (ssn) VALUES ('123')",
+				"INSERT INTO t (name, email) VALUES (:email, :name)",
+				"INSERT INTO t (email) VALUES (:email), (lower('ALICE'))",
+				"SELECT * FROM t WHERE ssn = '123'",
+				"SELECT * FROM t WHERE '123' = t.ssn",
+				"SELECT * FROM t WHERE email IN (:email, 'bob@example.com')",
+				"SELECT * FROM t WHERE email BETWEEN :email AND 'z'",
+				"SELECT * FROM t WHERE email = :other",
+				"UPDATE t SET email = :email, ssn = 123 WHERE id = 1",
+				"SELECT * FROM t WHERE email = :email; DELETE FROM t WHERE ssn = x'00'",
+				"SELECT * FROM t WHERE email = :email AND (",
+			} {
+				_, err = convertQuery(q, args, c)
+				So(err, ShouldEqual, ErrPlainEncryptedValue)
+			}
+			for _, q := range []string{
+				"INSERT INTO t (name, email, ssn) VALUES ('alice', :email, NULL)",
+				"SELECT * FROM t WHERE email = :email AND name = 'alice'",
+				"SELECT * FROM t WHERE email IN (SELECT email FROM u WHERE id = 1)",
+				"UPDATE t SET ssn = NULL, name = 'bob' WHERE \"Email\" = :email",
+				"CREATE TABLE t (id INT PRIMARY KEY, email BLOB, ssn BLOB)",
+			} {
+				_, err = convertQuery(q, args, c)
+				So(err, ShouldBeNil)
+			}
+		})
+		Convey("Cipher values should be bound to the column", func() {
+			enc, err := c.encrypt("email", modeDeterministic, "alice")
+			So(err, ShouldBeNil)
+			dec, err := c.decryptValue("EMAIL", enc)
+			So(err, ShouldBeNil)
+			So(dec, ShouldEqual, "alice")
+			_, err = c.decryptValue("ssn", enc)
+			So(err, ShouldEqual, ErrDecryptColumn)
+		})
+		Convey("Values of all supported types should survive encryption", func() {
+			for _, v := range []driver.Value{
+				int64(-1), 3.14, true, []byte("blob"), "text", time.Unix(1, 2).UTC(),
+			} {
+				enc, err := c.encrypt("ssn", modeRandomized, v)
+				So(err, ShouldBeNil)
+				dec, err := c.decryptValue("SSN", enc)
+				So(err, ShouldBeNil)
+				So(dec, ShouldResemble, v)
+			}
+			_, err = c.encrypt("ssn", modeRandomized, struct{}{})
+			So(err, ShouldEqual, ErrUnsupportedColumnValue)
+		})
+		Convey("Invalid schema should be rejected", func() {
+			cfg.Columns["email"] = "unknown"
+			_, err = newColumnCipher(cfg)
+			So(err, ShouldEqual, ErrInvalidEncryptionMode)
+
+			err = ioutil.WriteFile(cfg.KeyFile, []byte("0001"), 0600)
+			So(err, ShouldBeNil)
+			_, err = newColumnCipher(cfg)
+			So(err, ShouldEqual, ErrInvalidColumnKey)
+		})
+	})
+}
@@ -20,5 +20,14 @@ import "errors"
 
 // Various errors the driver might returns.
 var (
-	ErrQueryInTransaction = errors.New("only write is supported during transaction")
+	ErrQueryInTransaction     = errors.New("only write is supported during transaction")
+	ErrInvalidColumnKey       = errors.New("column encryption key should be at least 32 bytes")
+	ErrInvalidEncryptionMode  = errors.New("column encryption mode should be deterministic or randomized")
+	ErrUnsupportedColumnValue = errors.New("unsupported value type of encrypted column")
+	ErrDecryptColumn          = errors.New("decrypt column value failed")
+	ErrPositionalEncryptedArg = errors.New("positional args are not supported in queries referencing encrypted columns")
+	ErrPlainEncryptedValue    = errors.New("values of encrypted columns should be named args of the column names")
+	ErrInvalidResultProof     = errors.New("invalid query result proof")
+	ErrStateRootMismatch      = errors.New("query result state root mismatch latest block, try again after next block")
+	ErrStaleHeadBlock         = errors.New("head block is older than the latest block seen")
 )
@@ -28,13 +28,15 @@ type rows struct {
 	columns []string
 	types   []string
 	data    []wt.ResponseRow
+	cipher  *columnCipher
 }
 
-func newRows(res *wt.Response) *rows {
+func newRows(res *wt.Response, cipher *columnCipher) *rows {
 	return &rows{
 		columns: res.Payload.Columns,
 		types:   res.Payload.DeclTypes,
 		data:    res.Payload.Rows,
+		cipher:  cipher,
 	}
 }
 
@@ -56,6 +58,12 @@ func (r *rows) Next(dest []driver.Value) error {
 	}
 
 	for i, d := range r.data[0].Values {
+		if r.cipher != nil && i < len(r.columns) {
+			var err error
+			if d, err = r.cipher.decryptValue(r.columns[i], d); err != nil {
+				return err
+			}
+		}
 		dest[i] = d
 	}
 
@@ -21,6 +21,7 @@ import (
 	"net/http"
 
 	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
@@ -37,29 +38,38 @@ type queryAPI struct{}
 
 // Query defines read query for database.
 func (a *queryAPI) Query(rw http.ResponseWriter, r *http.Request) {
-	query := buildQuery(rw, r)
-	if query == "" {
+	req := buildRequest(rw, r)
+	if req == nil {
 		return
 	}
 
-	dbID := getDatabaseID(rw, r)
-	if dbID == "" {
-		return
-	}
+	results := make([]map[string]interface{}, 0, len(req.queries))
 
-	log.WithField("db", dbID).WithField("query", query).Infof("got query")
+	for _, q := range req.queries {
+		log.WithField("db", req.database).WithField("query", q.Pattern).Infof("got query")
 
-	assoc := r.FormValue("assoc")
+		var columns []string
+		var types []string
+		var rows [][]interface{}
+		var err error
+		if columns, types, rows, err = config.GetConfig().StorageInstance.Query(req.database, q.Pattern, q.Args...); err != nil {
+			sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+			return
+		}
 
-	var columns []string
-	var types []string
-	var rows [][]interface{}
-	var err error
-	if columns, types, rows, err = config.GetConfig().StorageInstance.Query(dbID, query); err != nil {
-		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
-		return
+		results = append(results, buildQueryResult(columns, types, rows, req.assoc))
+	}
+
+	if req.batch {
+		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+			"results": results,
+		}, rw)
+	} else {
+		sendResponse(http.StatusOK, true, nil, results[0], rw)
 	}
+}
 
+func buildQueryResult(columns []string, types []string, rows [][]interface{}, assoc bool) map[string]interface{} {
 	// assign names to empty columns
 	for i, c := range columns {
 		if c == "" {
@@ -67,32 +77,33 @@ func (a *queryAPI) Query(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if assoc == "" {
-		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+	if !assoc {
+		return map[string]interface{}{
 			"types":   types,
 			"columns": columns,
 			"rows":    rows,
-		}, rw)
-	} else {
-		// combine columns
-		assocRows := make([]map[string]interface{}, 0, len(rows))
+		}
+	}
 
-		for _, row := range rows {
-			assocRow := make(map[string]interface{}, len(row))
+	// combine columns
+	assocRows := make([]map[string]interface{}, 0, len(rows))
 
-			for i, v := range row {
-				if i >= len(columns) {
-					break
-				}
-				assocRow[columns[i]] = v
-			}
+	for _, row := range rows {
+		assocRow := make(map[string]interface{}, len(row))
 
-			assocRows = append(assocRows, assocRow)
+		for i, v := range row {
+			if i >= len(columns) {
+				break
+			}
+			assocRow[columns[i]] = v
 		}
 
-		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
-			"rows": assocRows,
-		}, rw)
+		assocRows = append(assocRows, assocRow)
+	}
+
+	return map[string]interface{}{
+		"types": types,
+		"rows":  assocRows,
 	}
 }
 
@@ -126,23 +137,44 @@ func (a *queryAPI) Write(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := buildQuery(rw, r)
-	if query == "" {
+	req := buildRequest(rw, r)
+	if req == nil {
 		return
 	}
 
-	dbID := getDatabaseID(rw, r)
-	if dbID == "" {
-		return
+	for _, q := range req.queries {
+		log.WithField("db", req.database).WithField("query", q.Pattern).Infof("got exec")
 	}
 
-	log.WithField("db", dbID).WithField("query", query).Infof("got exec")
-
+	var results []storage.ExecResult
 	var err error
-	if err = config.GetConfig().StorageInstance.Exec(dbID, query); err != nil {
+
+	if req.batch {
+		results, err = config.GetConfig().StorageInstance.ExecBatch(req.database, req.queries, req.atomic)
+	} else {
+		var result storage.ExecResult
+		result, err = config.GetConfig().StorageInstance.Exec(req.database, req.queries[0].Pattern, req.queries[0].Args...)
+		results = append(results, result)
+	}
+
+	if err != nil {
 		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
 		return
 	}
 
-	sendResponse(http.StatusOK, true, nil, nil, rw)
+	data := make([]map[string]interface{}, len(results))
+	for i, result := range results {
+		data[i] = map[string]interface{}{
+			"affected_rows":  result.RowsAffected,
+			"last_insert_id": result.LastInsertID,
+		}
+	}
+
+	if req.batch {
+		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+			"results": data,
+		}, rw)
+	} else {
+		sendResponse(http.StatusOK, true, nil, data[0], rw)
+	}
 }
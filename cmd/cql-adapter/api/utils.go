@@ -17,16 +17,58 @@
 package api
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
 )
 
 var (
 	dbIDRegex = regexp.MustCompile("^[a-zA-Z0-9_\\.]+$")
+
+	// errInvalidArgs defines invalid query arguments error.
+	errInvalidArgs = errors.New("invalid query arguments, requires an array or an object of scalar values")
 )
 
+// queryRequest defines a single statement in json request.
+type queryRequest struct {
+	Query string          `json:"query"`
+	Args  json.RawMessage `json:"args"`
+}
+
+// apiRequest defines the json request of query/exec api.
+type apiRequest struct {
+	Database string          `json:"database"`
+	Query    string          `json:"query"`
+	Args     json.RawMessage `json:"args"`
+	Queries  []queryRequest  `json:"queries"`
+	Atomic   bool            `json:"atomic"`
+	Assoc    bool            `json:"assoc"`
+}
+
+// parsedRequest defines the decoded query/exec request.
+type parsedRequest struct {
+	database string
+	queries  []storage.Query
+	batch    bool
+	atomic   bool
+	assoc    bool
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
 func getDatabaseID(rw http.ResponseWriter, r *http.Request) string {
 	// try form
 	if database := r.FormValue("database"); database != "" {
@@ -51,14 +93,142 @@ func validateDatabaseID(dbID string, rw http.ResponseWriter) string {
 	return dbID
 }
 
-func buildQuery(rw http.ResponseWriter, r *http.Request) string {
+func buildRequest(rw http.ResponseWriter, r *http.Request) *parsedRequest {
 	// TODO(xq262144), support partial query and big query using application/octet-stream content-type
-	if query := r.FormValue("query"); query != "" {
-		return query
+	var req apiRequest
+
+	if isJSONRequest(r) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendResponse(http.StatusBadRequest, false, "Invalid json request: "+err.Error(), nil, rw)
+			return nil
+		}
+	} else {
+		req.Query = r.FormValue("query")
+		req.Args = json.RawMessage(r.FormValue("args"))
+		req.Atomic, _ = strconv.ParseBool(r.FormValue("atomic"))
+		req.Assoc = r.FormValue("assoc") != ""
+
+		if queries := r.FormValue("queries"); queries != "" {
+			if err := json.Unmarshal([]byte(queries), &req.Queries); err != nil {
+				sendResponse(http.StatusBadRequest, false, "Invalid queries parameter: "+err.Error(), nil, rw)
+				return nil
+			}
+		}
 	}
 
-	sendResponse(http.StatusBadRequest, false, "Missing query parameter", nil, rw)
-	return ""
+	result := &parsedRequest{
+		atomic: req.Atomic,
+		assoc:  req.Assoc,
+	}
+
+	// resolve database
+	if req.Database != "" {
+		result.database = validateDatabaseID(req.Database, rw)
+	} else {
+		result.database = getDatabaseID(rw, r)
+	}
+
+	if result.database == "" {
+		return nil
+	}
+
+	if len(req.Queries) > 0 {
+		if req.Query != "" {
+			sendResponse(http.StatusBadRequest, false, "Query and queries parameter are exclusive", nil, rw)
+			return nil
+		}
+
+		result.batch = true
+	} else if req.Query != "" {
+		req.Queries = []queryRequest{{Query: req.Query, Args: req.Args}}
+	} else {
+		sendResponse(http.StatusBadRequest, false, "Missing query parameter", nil, rw)
+		return nil
+	}
+
+	result.queries = make([]storage.Query, len(req.Queries))
+
+	for i, q := range req.Queries {
+		if q.Query == "" {
+			sendResponse(http.StatusBadRequest, false, fmt.Sprintf("Missing query of statement #%d", i), nil, rw)
+			return nil
+		}
+
+		args, err := decodeArgs(q.Args)
+		if err != nil {
+			sendResponse(http.StatusBadRequest, false, err, nil, rw)
+			return nil
+		}
+
+		result.queries[i] = storage.Query{
+			Pattern: q.Query,
+			Args:    args,
+		}
+	}
+
+	return result
+}
+
+// decodeArgs converts json array to positional arguments and json object to named arguments.
+func decodeArgs(raw json.RawMessage) (args []interface{}, err error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err = decoder.Decode(&v); err != nil {
+		err = errInvalidArgs
+		return
+	}
+
+	switch vs := v.(type) {
+	case []interface{}:
+		args = make([]interface{}, len(vs))
+		for i, a := range vs {
+			if args[i], err = convertArg(a); err != nil {
+				return
+			}
+		}
+	case map[string]interface{}:
+		// sort names for stable argument order
+		names := make([]string, 0, len(vs))
+		for name := range vs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		args = make([]interface{}, len(names))
+		for i, name := range names {
+			var a interface{}
+			if a, err = convertArg(vs[name]); err != nil {
+				return
+			}
+			// strip sqlite named parameter prefix
+			args[i] = sql.Named(strings.TrimLeft(name, ":@$"), a)
+		}
+	default:
+		err = errInvalidArgs
+	}
+
+	return
+}
+
+func convertArg(v interface{}) (arg interface{}, err error) {
+	switch a := v.(type) {
+	case json.Number:
+		if i, e := a.Int64(); e == nil {
+			return i, nil
+		}
+		return a.Float64()
+	case nil, bool, string:
+		return a, nil
+	default:
+		return nil, errInvalidArgs
+	}
 }
 
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConvertArg(t *testing.T) {
+	Convey("convert json scalar values to query arguments", t, func() {
+		arg, err := convertArg(json.Number("1"))
+		So(err, ShouldBeNil)
+		So(arg, ShouldEqual, int64(1))
+		arg, err = convertArg(json.Number("1.5"))
+		So(err, ShouldBeNil)
+		So(arg, ShouldEqual, 1.5)
+		arg, err = convertArg("a")
+		So(err, ShouldBeNil)
+		So(arg, ShouldEqual, "a")
+		arg, err = convertArg(true)
+		So(err, ShouldBeNil)
+		So(arg, ShouldEqual, true)
+		arg, err = convertArg(nil)
+		So(err, ShouldBeNil)
+		So(arg, ShouldBeNil)
+		_, err = convertArg([]interface{}{1})
+		So(err, ShouldEqual, errInvalidArgs)
+		_, err = convertArg(map[string]interface{}{})
+		So(err, ShouldEqual, errInvalidArgs)
+	})
+}
+
+func TestDecodeArgs(t *testing.T) {
+	Convey("decode json arguments", t, func() {
+		args, err := decodeArgs(nil)
+		So(err, ShouldBeNil)
+		So(args, ShouldBeNil)
+		args, err = decodeArgs(json.RawMessage(" null "))
+		So(err, ShouldBeNil)
+		So(args, ShouldBeNil)
+
+		args, err = decodeArgs(json.RawMessage(`[1, "a", null, 2.5, false]`))
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []interface{}{int64(1), "a", nil, 2.5, false})
+
+		args, err = decodeArgs(json.RawMessage(`{":b": 2, "a": "x", "@c": null}`))
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []interface{}{
+			sql.Named("b", int64(2)),
+			sql.Named("c", nil),
+			sql.Named("a", "x"),
+		})
+
+		_, err = decodeArgs(json.RawMessage(`1`))
+		So(err, ShouldEqual, errInvalidArgs)
+		_, err = decodeArgs(json.RawMessage(`[[1]]`))
+		So(err, ShouldEqual, errInvalidArgs)
+		_, err = decodeArgs(json.RawMessage(`{"a": {}}`))
+		So(err, ShouldEqual, errInvalidArgs)
+		_, err = decodeArgs(json.RawMessage(`[1,`))
+		So(err, ShouldEqual, errInvalidArgs)
+	})
+}
+
+func TestBuildRequest(t *testing.T) {
+	Convey("build request from json body", t, func() {
+		build := func(body string) (*parsedRequest, *httptest.ResponseRecorder) {
+			rw := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/exec", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json; charset=utf-8")
+			return buildRequest(rw, r), rw
+		}
+
+		req, _ := build(`{"database": "db", "query": "SELECT ?", "args": [1], "assoc": true}`)
+		So(req, ShouldNotBeNil)
+		So(req.database, ShouldEqual, "db")
+		So(req.batch, ShouldBeFalse)
+		So(req.assoc, ShouldBeTrue)
+		So(req.queries, ShouldResemble, []storage.Query{{Pattern: "SELECT ?", Args: []interface{}{int64(1)}}})
+
+		req, _ = build(`{"database": "db", "atomic": true, "queries": [
+			{"query": "INSERT INTO t VALUES(?)", "args": ["a"]},
+			{"query": "DELETE FROM t"}
+		]}`)
+		So(req, ShouldNotBeNil)
+		So(req.batch, ShouldBeTrue)
+		So(req.atomic, ShouldBeTrue)
+		So(req.queries, ShouldResemble, []storage.Query{
+			{Pattern: "INSERT INTO t VALUES(?)", Args: []interface{}{"a"}},
+			{Pattern: "DELETE FROM t"},
+		})
+
+		for _, body := range []string{
+			`{"database": "db", "query": "SELECT 1", "queries": [{"query": "SELECT 2"}]}`,
+			`{"database": "db"}`,
+			`{"database": "db", "queries": [{"query": ""}]}`,
+			`{"database": "db", "query": "SELECT ?", "args": [[1]]}`,
+			`{"database": "db;", "query": "SELECT 1"}`,
+			`{"query": "SELECT 1"}`,
+			`{`,
+		} {
+			req, rw := build(body)
+			So(req, ShouldBeNil)
+			So(rw.Code, ShouldEqual, http.StatusBadRequest)
+		}
+	})
+	Convey("build request from form values", t, func() {
+		form := url.Values{}
+		form.Set("query", "SELECT :a")
+		form.Set("args", `{"a": 1}`)
+		form.Set("atomic", "true")
+		form.Set("assoc", "1")
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/query", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Database-ID", "db")
+
+		req := buildRequest(rw, r)
+		So(req, ShouldNotBeNil)
+		So(req.database, ShouldEqual, "db")
+		So(req.atomic, ShouldBeTrue)
+		So(req.assoc, ShouldBeTrue)
+		So(req.queries, ShouldResemble, []storage.Query{
+			{Pattern: "SELECT :a", Args: []interface{}{sql.Named("a", int64(1))}},
+		})
+
+		form = url.Values{}
+		form.Set("database", "db")
+		form.Set("queries", `[{"query": "SELECT 1"}, {"query": "SELECT ?", "args": [2]}]`)
+		rw = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/v1/query", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		req = buildRequest(rw, r)
+		So(req, ShouldNotBeNil)
+		So(req.batch, ShouldBeTrue)
+		So(req.queries, ShouldHaveLength, 2)
+
+		form.Set("queries", `[`)
+		rw = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/v1/query", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		So(buildRequest(rw, r), ShouldBeNil)
+		So(rw.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
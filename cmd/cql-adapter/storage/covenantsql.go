@@ -56,7 +56,7 @@ func (s *ThunderDBStorage) Drop(dbID string) (err error) {
 }
 
 // Query implements the Storage abstraction interface.
-func (s *ThunderDBStorage) Query(dbID string, query string) (columns []string, types []string, result [][]interface{}, err error) {
+func (s *ThunderDBStorage) Query(dbID string, query string, args ...interface{}) (columns []string, types []string, result [][]interface{}, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID); err != nil {
 		return
@@ -64,7 +64,7 @@ func (s *ThunderDBStorage) Query(dbID string, query string) (columns []string, t
 	defer conn.Close()
 
 	var rows *sql.Rows
-	if rows, err = conn.Query(query); err != nil {
+	if rows, err = conn.Query(query, args...); err != nil {
 		return
 	}
 	defer rows.Close()
@@ -73,35 +73,34 @@ func (s *ThunderDBStorage) Query(dbID string, query string) (columns []string, t
 		return
 	}
 
-	var colTypes []*sql.ColumnType
-
-	if colTypes, err = rows.ColumnTypes(); err != nil {
+	if types, err = readColumnTypes(rows); err != nil {
 		return
 	}
 
-	types = make([]string, len(colTypes))
-
-	for i, c := range colTypes {
-		if c != nil {
-			types[i] = c.DatabaseTypeName()
-		}
-	}
-
 	result, err = readAllRows(rows)
 	return
 }
 
 // Exec implements the Storage abstraction interface.
-func (s *ThunderDBStorage) Exec(dbID string, query string) (err error) {
+func (s *ThunderDBStorage) Exec(dbID string, query string, args ...interface{}) (result ExecResult, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID); err != nil {
 		return
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(query)
+	return execQuery(conn, query, args...)
+}
 
-	return
+// ExecBatch implements the Storage abstraction interface.
+func (s *ThunderDBStorage) ExecBatch(dbID string, queries []Query, atomic bool) (results []ExecResult, err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	return execBatch(conn, queries, atomic)
 }
 
 func (s *ThunderDBStorage) getConn(dbID string) (db *sql.DB, err error) {
@@ -74,7 +74,7 @@ func (s *SQLite3Storage) Drop(dbID string) (err error) {
 }
 
 // Query implements the Storage abstraction interface.
-func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, types []string, result [][]interface{}, err error) {
+func (s *SQLite3Storage) Query(dbID string, query string, args ...interface{}) (columns []string, types []string, result [][]interface{}, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID, true); err != nil {
 		return
@@ -88,7 +88,7 @@ func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, typ
 	defer tx.Rollback()
 
 	var rows *sql.Rows
-	if rows, err = tx.Query(query); err != nil {
+	if rows, err = tx.Query(query, args...); err != nil {
 		return
 	}
 	defer rows.Close()
@@ -97,35 +97,34 @@ func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, typ
 		return
 	}
 
-	var colTypes []*sql.ColumnType
-
-	if colTypes, err = rows.ColumnTypes(); err != nil {
+	if types, err = readColumnTypes(rows); err != nil {
 		return
 	}
 
-	types = make([]string, len(colTypes))
-
-	for i, c := range colTypes {
-		if c != nil {
-			types[i] = c.DatabaseTypeName()
-		}
-	}
-
 	result, err = readAllRows(rows)
 	return
 }
 
 // Exec implements the Storage abstraction interface.
-func (s *SQLite3Storage) Exec(dbID string, query string) (err error) {
+func (s *SQLite3Storage) Exec(dbID string, query string, args ...interface{}) (result ExecResult, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID, false); err != nil {
 		return
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(query)
+	return execQuery(conn, query, args...)
+}
 
-	return
+// ExecBatch implements the Storage abstraction interface.
+func (s *SQLite3Storage) ExecBatch(dbID string, queries []Query, atomic bool) (results []ExecResult, err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID, false); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	return execBatch(conn, queries, atomic)
 }
 
 func (s *SQLite3Storage) getConn(dbID string, readonly bool) (db *sql.DB, err error) {
@@ -21,6 +21,19 @@ import (
 	"io"
 )
 
+// Query defines a single statement with positional or named (sql.NamedArg) arguments.
+type Query struct {
+	Pattern string
+	Args    []interface{}
+}
+
+// ExecResult defines the write result of a single statement, the fields are nil if the storage
+// driver doesn't report them, e.g. the covenantsql driver.
+type ExecResult struct {
+	RowsAffected *int64
+	LastInsertID *int64
+}
+
 // Storage defines the storage abstraction layer interface.
 type Storage interface {
 	// Create operation.
@@ -28,9 +41,16 @@ type Storage interface {
 	// Drop operation.
 	Drop(dbID string) (err error)
 	// Query for result.
-	Query(dbID string, query string) (columns []string, types []string, rows [][]interface{}, err error)
+	Query(dbID string, query string, args ...interface{}) (columns []string, types []string, rows [][]interface{}, err error)
 	// Exec for update.
-	Exec(dbID string, query string) (err error)
+	Exec(dbID string, query string, args ...interface{}) (result ExecResult, err error)
+	// ExecBatch for multiple updates, statements are executed in a single transaction if atomic is set.
+	ExecBatch(dbID string, queries []Query, atomic bool) (results []ExecResult, err error)
+}
+
+// execer defines the common exec method of sql.DB and sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
 // golang does trick convert, use rowScanner to return the original result type in sqlite3 driver
@@ -85,6 +105,74 @@ func (s *rowScanner) ScanArgs() []interface{} {
 	return s.scanArgs
 }
 
+func readColumnTypes(rows *sql.Rows) (types []string, err error) {
+	var colTypes []*sql.ColumnType
+
+	if colTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+
+	types = make([]string, len(colTypes))
+
+	for i, c := range colTypes {
+		if c != nil {
+			types[i] = c.DatabaseTypeName()
+		}
+	}
+
+	return
+}
+
+func execQuery(e execer, query string, args ...interface{}) (result ExecResult, err error) {
+	var r sql.Result
+	if r, err = e.Exec(query, args...); err != nil {
+		return
+	}
+
+	// drivers without write result support (like covenantsql) report errors here, leave them as nil
+	if affected, rerr := r.RowsAffected(); rerr == nil {
+		result.RowsAffected = &affected
+	}
+	if lastInsertID, rerr := r.LastInsertId(); rerr == nil {
+		result.LastInsertID = &lastInsertID
+	}
+
+	return
+}
+
+func execBatch(conn *sql.DB, queries []Query, atomic bool) (results []ExecResult, err error) {
+	var e execer = conn
+	var tx *sql.Tx
+
+	if atomic {
+		if tx, err = conn.Begin(); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+			}
+		}()
+		e = tx
+	}
+
+	results = make([]ExecResult, 0, len(queries))
+
+	for _, q := range queries {
+		var result ExecResult
+		if result, err = execQuery(e, q.Pattern, q.Args...); err != nil {
+			return
+		}
+		results = append(results, result)
+	}
+
+	if tx != nil {
+		err = tx.Commit()
+	}
+
+	return
+}
+
 func readAllRows(rows *sql.Rows) (result [][]interface{}, err error) {
 	var columns []string
 	if columns, err = rows.Columns(); err != nil {
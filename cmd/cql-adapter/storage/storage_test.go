@@ -0,0 +1,80 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExecBatch(t *testing.T) {
+	Convey("execute batch of statements", t, func() {
+		dir, err := ioutil.TempDir("", "cql-adapter-storage")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		conn, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		_, err = conn.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT UNIQUE)")
+		So(err, ShouldBeNil)
+
+		count := func() (n int) {
+			So(conn.QueryRow("SELECT COUNT(1) FROM t").Scan(&n), ShouldBeNil)
+			return
+		}
+
+		results, err := execBatch(conn, []Query{
+			{Pattern: "INSERT INTO t (v) VALUES (?)", Args: []interface{}{"a"}},
+			{Pattern: "INSERT INTO t (v) VALUES (:v)", Args: []interface{}{sql.Named("v", "b")}},
+			{Pattern: "UPDATE t SET v = v || '!'"},
+		}, true)
+		So(err, ShouldBeNil)
+		int64Ptr := func(i int64) *int64 { return &i }
+		So(results, ShouldResemble, []ExecResult{
+			{RowsAffected: int64Ptr(1), LastInsertID: int64Ptr(1)},
+			{RowsAffected: int64Ptr(1), LastInsertID: int64Ptr(2)},
+			{RowsAffected: int64Ptr(2), LastInsertID: int64Ptr(2)},
+		})
+		So(count(), ShouldEqual, 2)
+
+		Convey("atomic batch should be rolled back on failure", func() {
+			_, err = execBatch(conn, []Query{
+				{Pattern: "INSERT INTO t (v) VALUES (?)", Args: []interface{}{"c"}},
+				{Pattern: "INSERT INTO t (v) VALUES (?)", Args: []interface{}{"a!"}},
+			}, true)
+			So(err, ShouldNotBeNil)
+			So(count(), ShouldEqual, 2)
+		})
+		Convey("non-atomic batch should keep executed statements on failure", func() {
+			results, err = execBatch(conn, []Query{
+				{Pattern: "INSERT INTO t (v) VALUES (?)", Args: []interface{}{"c"}},
+				{Pattern: "INSERT INTO t (v) VALUES (?)", Args: []interface{}{"a!"}},
+				{Pattern: "INSERT INTO t (v) VALUES (?)", Args: []interface{}{"d"}},
+			}, false)
+			So(err, ShouldNotBeNil)
+			So(results, ShouldHaveLength, 1)
+			So(count(), ShouldEqual, 3)
+		})
+	})
+}
@@ -18,10 +18,12 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
@@ -34,6 +36,11 @@ import (
 
 var (
 	apiTimeout = time.Second * 10
+
+	// listDefaultLimit defines the default page size of transaction listing
+	listDefaultLimit = 20
+	// listMaxLimit defines the max page size of transaction listing
+	listMaxLimit = 100
 )
 
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
@@ -79,6 +86,51 @@ func getUintFromVars(field string, r *http.Request) (value uint32, err error) {
 	return
 }
 
+func getListPage(r *http.Request) (cursor []byte, limit int, err error) {
+	query := r.URL.Query()
+	limit = listDefaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			err = ErrBadRequest
+			return
+		}
+		if limit <= 0 || limit > listMaxLimit {
+			limit = listMaxLimit
+		}
+	}
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		if cursor, err = hex.DecodeString(cursorStr); err != nil {
+			err = ErrBadRequest
+		}
+	}
+	return
+}
+
+func getTxTypeFromQuery(r *http.Request) (txType *pi.TransactionType, err error) {
+	typeStr := r.URL.Query().Get("type")
+	if typeStr == "" {
+		return
+	}
+	for t := pi.TransactionType(0); t < pi.TransactionTypeNumber; t++ {
+		if strings.EqualFold(t.String(), typeStr) {
+			txType = &t
+			return
+		}
+	}
+	err = ErrBadRequest
+	return
+}
+
+func getAccountAddress(addrStr string) (addr proto.AccountAddress, err error) {
+	h, err := hash.NewHashFromStr(addrStr)
+	if err != nil {
+		err = ErrBadRequest
+		return
+	}
+	addr = proto.AccountAddress(*h)
+	return
+}
+
 type explorerAPI struct {
 	service *Service
 }
@@ -163,6 +215,143 @@ func (a *explorerAPI) GetTxByHash(rw http.ResponseWriter, r *http.Request) {
 	sendResponse(200, true, nil, a.formatTx(count, height, tx), rw)
 }
 
+func (a *explorerAPI) GetAccount(rw http.ResponseWriter, r *http.Request) {
+	addr, err := getAccountAddress(mux.Vars(r)["addr"])
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+	txType, err := getTxTypeFromQuery(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+	cursor, limit, err := getListPage(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	account, err := a.service.getAccount(addr)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+	history, next, err := a.service.listAccountTxs(addr, txType, cursor, limit)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	txs := make([]map[string]interface{}, 0, len(history))
+	for _, e := range history {
+		txs = append(txs, a.formatAccountTx(e))
+	}
+
+	sendResponse(200, true, nil, map[string]interface{}{
+		"account": map[string]interface{}{
+			"address":          account.Address.String(),
+			"stable_balance":   account.StableBalance,
+			"covenant_balance": account.CovenantBalance,
+			"next_nonce":       account.NextNonce,
+			"history":          txs,
+			"next":             hex.EncodeToString(next),
+		},
+	}, rw)
+}
+
+func (a *explorerAPI) GetDatabase(rw http.ResponseWriter, r *http.Request) {
+	dbID := proto.DatabaseID(mux.Vars(r)["id"])
+	cursor, limit, err := getListPage(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	db, err := a.service.getDatabase(dbID)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+	refs, next, err := a.service.listDatabaseBillings(dbID, cursor, limit)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+	billings, err := a.formatTxRefs(refs)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	miners := make([]string, 0, len(db.Miners))
+	for _, m := range db.Miners {
+		miners = append(miners, m.String())
+	}
+
+	sendResponse(200, true, nil, map[string]interface{}{
+		"database": map[string]interface{}{
+			"id":                 db.ID,
+			"miners":             miners,
+			"billing_count":      db.BillingCount,
+			"last_billed_block":  db.LastHighBlock.String(),
+			"last_billed_height": db.LastHeight,
+			"billings":           billings,
+			"next":               hex.EncodeToString(next),
+		},
+	}, rw)
+}
+
+func (a *explorerAPI) ListTxs(rw http.ResponseWriter, r *http.Request) {
+	txType, err := getTxTypeFromQuery(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+	cursor, limit, err := getListPage(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	var (
+		refs []*txRef
+		next []byte
+	)
+	if addrStr := r.URL.Query().Get("account"); addrStr != "" {
+		var (
+			addr    proto.AccountAddress
+			history []*accountTx
+		)
+		if addr, err = getAccountAddress(addrStr); err != nil {
+			sendError(err, rw)
+			return
+		}
+		if history, next, err = a.service.listAccountTxs(addr, txType, cursor, limit); err != nil {
+			sendError(err, rw)
+			return
+		}
+		refs = make([]*txRef, 0, len(history))
+		for _, e := range history {
+			refs = append(refs, &txRef{Count: e.Count, Index: e.Index, Hash: e.Hash})
+		}
+	} else if refs, next, err = a.service.listTxs(txType, cursor, limit); err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	txs, err := a.formatTxRefs(refs)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	sendResponse(200, true, nil, map[string]interface{}{
+		"txs":  txs,
+		"next": hex.EncodeToString(next),
+	}, rw)
+}
+
 func (a *explorerAPI) formatTime(t time.Time) float64 {
 	return float64(t.UnixNano()) / 1e6
 }
@@ -283,6 +472,42 @@ func (a *explorerAPI) formatTx(count uint32, height uint32, tx pi.Transaction) m
 	}
 }
 
+func (a *explorerAPI) formatTxRefs(refs []*txRef) (txs []map[string]interface{}, err error) {
+	txs = make([]map[string]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		var (
+			tx     pi.Transaction
+			height uint32
+		)
+		if tx, height, err = a.service.getTxByRef(ref); err != nil {
+			return
+		}
+		res := a.formatTx(ref.Count, height, tx)["tx"].(map[string]interface{})
+		res["hash"] = ref.Hash.String()
+		txs = append(txs, res)
+	}
+	return
+}
+
+func (a *explorerAPI) formatAccountTx(e *accountTx) map[string]interface{} {
+	res := map[string]interface{}{
+		"hash":             e.Hash.String(),
+		"type":             e.Type.String(),
+		"count":            e.Count,
+		"height":           e.Height,
+		"direction":        e.Direction,
+		"stable_amount":    e.StableAmount,
+		"covenant_amount":  e.CovenantAmount,
+		"stable_balance":   e.StableBalance,
+		"covenant_balance": e.CovenantBalance,
+		"next_nonce":       e.NextNonce,
+	}
+	if e.Counterparty != nil {
+		res["counterparty"] = e.Counterparty.String()
+	}
+	return res
+}
+
 func (a *explorerAPI) getHash(r *http.Request) (h *hash.Hash, err error) {
 	vars := mux.Vars(r)
 	hStr := vars["hash"]
@@ -304,6 +529,9 @@ func startAPI(service *Service, listenAddr string) (server *http.Server, err err
 	v1Router.HandleFunc("/block/{hash}", api.GetBlockByHash).Methods("GET")
 	v1Router.HandleFunc("/count/{count:[0-9]+}", api.GetBlockByCount).Methods("GET")
 	v1Router.HandleFunc("/head", api.GetHighestBlock).Methods("GET")
+	v1Router.HandleFunc("/account/{addr}", api.GetAccount).Methods("GET")
+	v1Router.HandleFunc("/database/{id}", api.GetDatabase).Methods("GET")
+	v1Router.HandleFunc("/txs", api.ListTxs).Methods("GET")
 
 	server = &http.Server{
 		Addr:         listenAddr,
@@ -29,4 +29,8 @@ var (
 	ErrNotFound = errors.New("resource not found")
 	// ErrBadRequest defines errors on error input field.
 	ErrBadRequest = errors.New("request field not fulfilled")
+	// ErrBlockDiverged defines error on fetched block not extending the saved chain.
+	ErrBlockDiverged = errors.New("block diverged from saved chain")
+	// ErrGenesisDiverged defines error on no common ancestor with main chain, even the genesis block.
+	ErrGenesisDiverged = errors.New("genesis block diverged from main chain")
 )
@@ -0,0 +1,673 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Following contains the account, database and transaction indexes of explorer. The indexes are
+// updated in a single batch for each block by the subscription worker, the transaction references
+// are keyed by block count and transaction index, so that they are listed in chain order. Each
+// batch also saves the undo record of the block, which reverts the indexes on chain reorganization.
+
+const (
+	// txDirectionIn defines the account history entry of incoming transfers and rewards.
+	txDirectionIn = "in"
+	// txDirectionOut defines the account history entry of outgoing transfers and sent transactions.
+	txDirectionOut = "out"
+	// txDirectionSelf defines the account history entry of transactions both sent and received by
+	// the account, e.g. transfers to itself.
+	txDirectionSelf = "self"
+
+	txRefLength = 8
+)
+
+var (
+	// index storage keys
+	accountKeyPrefix         = []byte("ACCOUNT_")
+	accountTxKeyPrefix       = []byte("ACCOUNTTX_")
+	databaseKeyPrefix        = []byte("DATABASE_")
+	databaseBillingKeyPrefix = []byte("DBBILLING_")
+	txOrderKeyPrefix         = []byte("TXORDER_")
+	txTypeKeyPrefix          = []byte("TXTYPE_")
+	indexUndoKeyPrefix       = []byte("UNDO_")
+	indexHeadKey             = []byte("INDEX_HEAD")
+)
+
+// accountState defines the account state indexed from transactions.
+type accountState struct {
+	Address         proto.AccountAddress
+	StableBalance   uint64
+	CovenantBalance uint64
+	NextNonce       pi.AccountNonce
+}
+
+// accountTx defines a transaction in account history, with the account state after it.
+type accountTx struct {
+	Count           uint32
+	Index           uint32
+	Height          uint32
+	Hash            hash.Hash
+	Type            pi.TransactionType
+	Direction       string
+	Counterparty    *proto.AccountAddress
+	StableAmount    uint64
+	CovenantAmount  uint64
+	StableBalance   uint64
+	CovenantBalance uint64
+	NextNonce       pi.AccountNonce
+}
+
+// databaseState defines the database state indexed from billing transactions.
+type databaseState struct {
+	ID            proto.DatabaseID
+	Miners        []proto.AccountAddress
+	BillingCount  uint32
+	LastHighBlock hash.Hash
+	LastHeight    int32
+}
+
+// indexUndo defines the undo record of block indexes, the keys added by the block are deleted and
+// the states modified are restored to the values before the block.
+type indexUndo struct {
+	Deletes  [][]byte
+	Restores []*indexUndoEntry
+}
+
+// indexUndoEntry defines the previous value of key, the key is deleted if it did not exist.
+type indexUndoEntry struct {
+	Key    []byte
+	Value  []byte
+	Exists bool
+}
+
+// txRef defines a reference of transaction by block count and index in block.
+type txRef struct {
+	Count uint32
+	Index uint32
+	Hash  hash.Hash
+}
+
+func txRefKey(prefix []byte, count uint32, index int) (key []byte) {
+	key = append(key, prefix...)
+	key = append(key, uint32ToBytes(count)...)
+	key = append(key, uint32ToBytes(uint32(index))...)
+	return
+}
+
+func accountTxPrefix(addr proto.AccountAddress) (prefix []byte) {
+	prefix = append(prefix, accountTxKeyPrefix...)
+	return append(prefix, addr[:]...)
+}
+
+func txTypePrefix(t pi.TransactionType) (prefix []byte) {
+	prefix = append(prefix, txTypeKeyPrefix...)
+	return append(prefix, uint32ToBytes(uint32(t))...)
+}
+
+func indexUndoKey(count uint32) (key []byte) {
+	key = append(key, indexUndoKeyPrefix...)
+	return append(key, uint32ToBytes(count)...)
+}
+
+func databaseBillingPrefix(dbID proto.DatabaseID) (prefix []byte) {
+	prefix = append(prefix, databaseBillingKeyPrefix...)
+	prefix = append(prefix, dbID...)
+	return append(prefix, 0)
+}
+
+func unwrapTx(t pi.Transaction) pi.Transaction {
+	for {
+		switch w := t.(type) {
+		case *pi.TransactionWrapper:
+			t = w.Unwrap()
+		case *pt.MultiSigTx:
+			t = w.Unwrap()
+		default:
+			return t
+		}
+	}
+}
+
+// indexBatch collects the index updates of a block.
+type indexBatch struct {
+	db        *leveldb.DB
+	batch     *leveldb.Batch
+	accounts  map[proto.AccountAddress]*accountState
+	databases map[proto.DatabaseID]*databaseState
+	undo      indexUndo
+}
+
+func newIndexBatch(db *leveldb.DB) *indexBatch {
+	return &indexBatch{
+		db:        db,
+		batch:     new(leveldb.Batch),
+		accounts:  make(map[proto.AccountAddress]*accountState),
+		databases: make(map[proto.DatabaseID]*databaseState),
+	}
+}
+
+// put adds the new index entry.
+func (b *indexBatch) put(key []byte, value []byte) {
+	b.batch.Put(key, value)
+	b.undo.Deletes = append(b.undo.Deletes, key)
+}
+
+// load loads the state to be modified by the block and saves its undo entry.
+func (b *indexBatch) load(key []byte, state interface{}) (exists bool, err error) {
+	var data []byte
+	if data, err = b.db.Get(key, nil); err == leveldb.ErrNotFound {
+		err = nil
+	} else if err != nil {
+		return
+	} else if err = utils.DecodeMsgPack(data, state); err != nil {
+		return
+	} else {
+		exists = true
+	}
+	b.undo.Restores = append(b.undo.Restores, &indexUndoEntry{Key: key, Value: data, Exists: exists})
+	return
+}
+
+func (b *indexBatch) getAccount(addr proto.AccountAddress) (a *accountState, err error) {
+	if a = b.accounts[addr]; a != nil {
+		return
+	}
+	var exists bool
+	if exists, err = b.load(append(append([]byte{}, accountKeyPrefix...), addr[:]...), &a); err != nil {
+		return
+	}
+	if !exists {
+		a = &accountState{Address: addr}
+	}
+	b.accounts[addr] = a
+	return
+}
+
+func (b *indexBatch) getDatabase(dbID proto.DatabaseID) (d *databaseState, err error) {
+	if d = b.databases[dbID]; d != nil {
+		return
+	}
+	var exists bool
+	if exists, err = b.load(append(append([]byte{}, databaseKeyPrefix...), dbID...), &d); err != nil {
+		return
+	}
+	if !exists {
+		d = &databaseState{ID: dbID}
+	}
+	b.databases[dbID] = d
+	return
+}
+
+func (b *indexBatch) write(c uint32) (err error) {
+	for addr, a := range b.accounts {
+		var buf []byte
+		if buf, err = encodeIndex(a); err != nil {
+			return
+		}
+		b.batch.Put(append(append([]byte{}, accountKeyPrefix...), addr[:]...), buf)
+	}
+	for dbID, d := range b.databases {
+		var buf []byte
+		if buf, err = encodeIndex(d); err != nil {
+			return
+		}
+		b.batch.Put(append(append([]byte{}, databaseKeyPrefix...), dbID...), buf)
+	}
+	var buf []byte
+	if buf, err = encodeIndex(&b.undo); err != nil {
+		return
+	}
+	b.batch.Put(indexUndoKey(c), buf)
+	b.batch.Put(indexHeadKey, uint32ToBytes(c+1))
+	return b.db.Write(b.batch, nil)
+}
+
+func encodeIndex(v interface{}) (data []byte, err error) {
+	buf, err := utils.EncodeMsgPack(v)
+	if err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// txChanges collects the account changes of a transaction.
+type txChanges map[proto.AccountAddress]*accountTx
+
+func (c txChanges) get(addr proto.AccountAddress, direction string) (e *accountTx) {
+	if e = c[addr]; e == nil {
+		e = &accountTx{Direction: direction}
+		c[addr] = e
+	} else if e.Direction != direction {
+		e.Direction = txDirectionSelf
+	}
+	return
+}
+
+func subBalance(balance *uint64, amount uint64) {
+	if *balance < amount {
+		// balances before the indexed blocks are unknown
+		*balance = 0
+		return
+	}
+	*balance -= amount
+}
+
+// indexTx applies the transaction to indexed accounts and databases.
+func (b *indexBatch) indexTx(c uint32, h uint32, index int, t pi.Transaction) (err error) {
+	var (
+		txHash  = t.GetHash()
+		txType  = t.GetTransactionType()
+		changes = make(txChanges)
+		ref     = &txRef{Count: c, Index: uint32(index), Hash: txHash}
+		refData []byte
+	)
+	if refData, err = encodeIndex(ref); err != nil {
+		return
+	}
+	b.put(txRefKey(txOrderKeyPrefix, c, index), refData)
+	b.put(txRefKey(txTypePrefix(txType), c, index), refData)
+
+	var a *accountState
+	switch inner := unwrapTx(t).(type) {
+	case *pt.BaseAccount:
+		if a, err = b.getAccount(inner.Address); err != nil {
+			return
+		}
+		a.StableBalance = inner.StableCoinBalance
+		a.CovenantBalance = inner.CovenantCoinBalance
+		a.NextNonce = inner.NextNonce
+		changes.get(inner.Address, txDirectionIn)
+	case *pt.Transfer:
+		if a, err = b.getAccount(inner.Sender); err != nil {
+			return
+		}
+		subBalance(&a.StableBalance, inner.Amount)
+		out := changes.get(inner.Sender, txDirectionOut)
+		out.Counterparty = &inner.Receiver
+		out.StableAmount = inner.Amount
+
+		if a, err = b.getAccount(inner.Receiver); err != nil {
+			return
+		}
+		a.StableBalance += inner.Amount
+		in := changes.get(inner.Receiver, txDirectionIn)
+		in.Counterparty = &inner.Sender
+		in.StableAmount = inner.Amount
+	case *pt.Billing:
+		for i, r := range inner.Receivers {
+			if r == nil || i >= len(inner.Fees) || i >= len(inner.Rewards) {
+				continue
+			}
+			if a, err = b.getAccount(*r); err != nil {
+				return
+			}
+			a.CovenantBalance += inner.Fees[i]
+			a.StableBalance += inner.Rewards[i]
+			in := changes.get(*r, txDirectionIn)
+			in.CovenantAmount += inner.Fees[i]
+			in.StableAmount += inner.Rewards[i]
+		}
+		if err = b.indexBilling(c, index, refData, &inner.BillingRequest); err != nil {
+			return
+		}
+	}
+
+	// sent transactions increase the account nonce
+	if txType != pi.TransactionTypeBaseAccount {
+		sender := t.GetAccountAddress()
+		if a, err = b.getAccount(sender); err != nil {
+			return
+		}
+		if nonce := t.GetAccountNonce(); nonce >= a.NextNonce {
+			a.NextNonce = nonce + 1
+		}
+		changes.get(sender, txDirectionOut)
+	}
+
+	for addr, e := range changes {
+		if a, err = b.getAccount(addr); err != nil {
+			return
+		}
+		e.Count = c
+		e.Index = uint32(index)
+		e.Height = h
+		e.Hash = txHash
+		e.Type = txType
+		e.StableBalance = a.StableBalance
+		e.CovenantBalance = a.CovenantBalance
+		e.NextNonce = a.NextNonce
+		var data []byte
+		if data, err = encodeIndex(e); err != nil {
+			return
+		}
+		b.put(txRefKey(accountTxPrefix(addr), c, index), data)
+	}
+	return
+}
+
+// indexBilling records the billing of database and the miners billed.
+func (b *indexBatch) indexBilling(c uint32, index int, refData []byte, br *pt.BillingRequest) (err error) {
+	var d *databaseState
+	if d, err = b.getDatabase(br.Header.DatabaseID); err != nil {
+		return
+	}
+	d.BillingCount++
+	d.LastHighBlock = br.Header.HighBlock
+	d.LastHeight = br.Header.HighHeight
+	for _, g := range br.Header.GasAmounts {
+		if g == nil {
+			continue
+		}
+		exists := false
+		for _, m := range d.Miners {
+			if m == g.AccountAddress {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			d.Miners = append(d.Miners, g.AccountAddress)
+		}
+	}
+	b.put(txRefKey(databaseBillingPrefix(br.Header.DatabaseID), c, index), refData)
+	return
+}
+
+func (s *Service) getIndexHead() (head uint32, err error) {
+	var data []byte
+	if data, err = s.db.Get(indexHeadKey, nil); err == leveldb.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return
+	}
+	head = bytesToUint32(data)
+	return
+}
+
+// indexBlock updates the indexes with transactions of block, the blocks already indexed are
+// skipped, so that the block could be processed again on failures.
+func (s *Service) indexBlock(c uint32, h uint32, b *pt.Block) (err error) {
+	var head uint32
+	if head, err = s.getIndexHead(); err != nil {
+		return
+	}
+	if c < head {
+		return
+	}
+
+	batch := newIndexBatch(s.db)
+	for i, t := range b.Transactions {
+		if t == nil {
+			continue
+		}
+		if err = batch.indexTx(c, h, i, t); err != nil {
+			return
+		}
+	}
+	return batch.write(c)
+}
+
+// rollbackBlock removes the block of count and reverts its indexes, the blocks should be rolled
+// back from the highest one. If the block is indexed without undo record, e.g. indexed by previous
+// versions, all indexes are cleared and should be built from genesis again.
+func (s *Service) rollbackBlock(c uint32) (cleared bool, err error) {
+	var (
+		b      *pt.Block
+		height uint32
+		head   uint32
+		batch  = new(leveldb.Batch)
+	)
+	if b, _, height, err = s.getBlockByCount(c); err != nil {
+		return
+	}
+	if head, err = s.getIndexHead(); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = s.db.Get(indexUndoKey(c), nil); err == nil {
+		var undo *indexUndo
+		if err = utils.DecodeMsgPack(data, &undo); err != nil {
+			return
+		}
+		for _, k := range undo.Deletes {
+			batch.Delete(k)
+		}
+		for _, e := range undo.Restores {
+			if e.Exists {
+				batch.Put(e.Key, e.Value)
+			} else {
+				batch.Delete(e.Key)
+			}
+		}
+		batch.Delete(indexUndoKey(c))
+		batch.Put(indexHeadKey, uint32ToBytes(c))
+	} else if err != leveldb.ErrNotFound {
+		return
+	} else if c < head {
+		log.WithFields(log.Fields{"count": c}).Warning("undo record of block not found, clear indexes")
+		if err = s.clearIndexes(batch); err != nil {
+			return
+		}
+		cleared = true
+	}
+
+	bHash := b.BlockHash()
+	for _, t := range b.Transactions {
+		if t == nil {
+			continue
+		}
+		txHash := t.GetHash()
+		batch.Delete(append(append([]byte{}, txKeyPrefix...), txHash[:]...))
+	}
+	batch.Delete(append(append(append([]byte{}, blockKeyPrefix...), uint32ToBytes(c)...), uint32ToBytes(height)...))
+	batch.Delete(append(append([]byte{}, blockHashPrefix...), bHash[:]...))
+	batch.Delete(append(append([]byte{}, blockHeightPrefix...), uint32ToBytes(height)...))
+
+	err = s.db.Write(batch, nil)
+	return
+}
+
+// clearIndexes adds the deletion of all index entries to batch.
+func (s *Service) clearIndexes(batch *leveldb.Batch) (err error) {
+	for _, prefix := range [][]byte{
+		accountKeyPrefix,
+		accountTxKeyPrefix,
+		databaseKeyPrefix,
+		databaseBillingKeyPrefix,
+		txOrderKeyPrefix,
+		txTypeKeyPrefix,
+		indexUndoKeyPrefix,
+	} {
+		it := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for it.Next() {
+			batch.Delete(append([]byte{}, it.Key()...))
+		}
+		it.Release()
+		if err = it.Error(); err != nil {
+			return
+		}
+	}
+	batch.Delete(indexHeadKey)
+	return
+}
+
+// buildIndexes indexes the blocks saved before the indexes are introduced.
+func (s *Service) buildIndexes() (err error) {
+	var head uint32
+	if head, err = s.getIndexHead(); err != nil {
+		return
+	}
+	next := s.nextBlockToFetch
+	if head >= next {
+		return
+	}
+	log.WithFields(log.Fields{"from": head, "to": next}).Info("build indexes of saved blocks")
+	for c := head; c < next; c++ {
+		var (
+			b      *pt.Block
+			height uint32
+		)
+		if b, _, height, err = s.getBlockByCount(c); err == ErrNotFound {
+			err = nil
+			continue
+		} else if err != nil {
+			return
+		}
+		if err = s.indexBlock(c, height, b); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Service) getAccount(addr proto.AccountAddress) (a *accountState, err error) {
+	var data []byte
+	if data, err = s.db.Get(append(append([]byte{}, accountKeyPrefix...), addr[:]...), nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = ErrNotFound
+		}
+		return
+	}
+	err = utils.DecodeMsgPack(data, &a)
+	return
+}
+
+func (s *Service) getDatabase(dbID proto.DatabaseID) (d *databaseState, err error) {
+	var data []byte
+	if data, err = s.db.Get(append(append([]byte{}, databaseKeyPrefix...), dbID...), nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = ErrNotFound
+		}
+		return
+	}
+	err = utils.DecodeMsgPack(data, &d)
+	return
+}
+
+// listIndex iterates the index entries of prefix in reverse chain order, starting after the
+// cursor returned by previous listing, which is the last entry listed. The returned cursor is nil
+// if there are no more entries.
+func (s *Service) listIndex(prefix []byte, cursor []byte, limit int, fn func(v []byte) (bool, error)) (
+	next []byte, err error) {
+	if cursor != nil && len(cursor) != txRefLength {
+		err = ErrBadRequest
+		return
+	}
+	r := util.BytesPrefix(prefix)
+	if cursor != nil {
+		r.Limit = append(append([]byte{}, prefix...), cursor...)
+	}
+
+	it := s.db.NewIterator(r, nil)
+	defer it.Release()
+
+	var (
+		count int
+		last  []byte
+	)
+	for ok := it.Last(); ok; ok = it.Prev() {
+		if len(it.Key()) != len(prefix)+txRefLength {
+			continue
+		}
+		if count >= limit {
+			next = last
+			break
+		}
+		var matched bool
+		if matched, err = fn(it.Value()); err != nil {
+			return
+		}
+		if matched {
+			count++
+			last = append([]byte{}, it.Key()[len(prefix):]...)
+		}
+	}
+	if err == nil {
+		err = it.Error()
+	}
+	return
+}
+
+// listAccountTxs lists the account history, all types are listed if txType is nil.
+func (s *Service) listAccountTxs(addr proto.AccountAddress, txType *pi.TransactionType, cursor []byte, limit int) (
+	txs []*accountTx, next []byte, err error) {
+	txs = make([]*accountTx, 0)
+	next, err = s.listIndex(accountTxPrefix(addr), cursor, limit, func(v []byte) (matched bool, err error) {
+		var e *accountTx
+		if err = utils.DecodeMsgPack(v, &e); err != nil {
+			return
+		}
+		if txType != nil && e.Type != *txType {
+			return
+		}
+		txs = append(txs, e)
+		return true, nil
+	})
+	return
+}
+
+// listTxs lists the transactions of type, all types are listed if txType is nil.
+func (s *Service) listTxs(txType *pi.TransactionType, cursor []byte, limit int) (refs []*txRef, next []byte, err error) {
+	prefix := txOrderKeyPrefix
+	if txType != nil {
+		prefix = txTypePrefix(*txType)
+	}
+	return s.listTxRefs(prefix, cursor, limit)
+}
+
+// listDatabaseBillings lists the billing transactions of database.
+func (s *Service) listDatabaseBillings(dbID proto.DatabaseID, cursor []byte, limit int) (
+	refs []*txRef, next []byte, err error) {
+	return s.listTxRefs(databaseBillingPrefix(dbID), cursor, limit)
+}
+
+func (s *Service) listTxRefs(prefix []byte, cursor []byte, limit int) (refs []*txRef, next []byte, err error) {
+	refs = make([]*txRef, 0)
+	next, err = s.listIndex(prefix, cursor, limit, func(v []byte) (matched bool, err error) {
+		var ref *txRef
+		if err = utils.DecodeMsgPack(v, &ref); err != nil {
+			return
+		}
+		refs = append(refs, ref)
+		return true, nil
+	})
+	return
+}
+
+// getTxByRef returns the transaction referenced and the height of block containing it.
+func (s *Service) getTxByRef(ref *txRef) (tx pi.Transaction, height uint32, err error) {
+	var b *pt.Block
+	if b, _, height, err = s.getBlockByCount(ref.Count); err != nil {
+		return
+	}
+	if int(ref.Index) >= len(b.Transactions) || b.Transactions[ref.Index] == nil {
+		err = ErrNotFound
+		return
+	}
+	tx = b.Transactions[ref.Index]
+	return
+}
@@ -65,6 +65,9 @@ type Service struct {
 
 	// next block to fetch
 	nextBlockToFetch uint32
+
+	// requestBP sends request to current block producer
+	requestBP func(method string, request interface{}, response interface{}) error
 }
 
 // NewService creates new explorer service handler.
@@ -90,6 +93,7 @@ func NewService(checkInterval time.Duration) (service *Service, err error) {
 		triggerCh:     make(chan struct{}, 1),
 		checkInterval: checkInterval,
 	}
+	service.requestBP = service.callBP
 
 	return
 }
@@ -104,6 +108,10 @@ func (s *Service) start() (err error) {
 		return
 	}
 
+	if err = s.buildIndexes(); err != nil {
+		return
+	}
+
 	// start subscription worker
 	s.wg.Add(1)
 	go s.subscriptionWorker()
@@ -191,7 +199,7 @@ func (s *Service) getTxByHash(h *hash.Hash) (tx pi.Transaction, c uint32, height
 	txKey = append(txKey, h[:]...)
 
 	var bCountData []byte
-	if bCountData, err = s.db.Get(txKeyPrefix, nil); err != nil {
+	if bCountData, err = s.db.Get(txKey, nil); err != nil {
 		if err == leveldb.ErrNotFound {
 			err = ErrNotFound
 		}
@@ -302,22 +310,37 @@ func (s *Service) requestBlock() {
 	blockCount := atomic.LoadUint32(&s.nextBlockToFetch)
 	log.WithFields(log.Fields{"count": blockCount}).Infof("try fetch next block")
 
-	req := &bp.FetchBlockByCountReq{Count: blockCount}
-	resp := &bp.FetchBlockResp{}
-
-	if err := s.requestBP(route.MCCFetchBlockByCount.String(), req, resp); err != nil {
+	b, height, err := s.fetchBlock(blockCount)
+	if err != nil {
 		// fetch block failed
 		log.Warningf("fetch block failed，wait for next round: %v", err)
+		// the main chain may be switched to a shorter branch
+		if blockCount > 0 {
+			if err = s.verifyTip(blockCount - 1); err != nil {
+				log.Warningf("verify saved chain tip failed: %v", err)
+			}
+		}
 		return
 	}
 
-	// process block
-	if err := s.processBlock(blockCount, resp.Height, resp.Block); err != nil {
-		log.Warningf("process block failed, try fetch/process again: %v", err)
+	if err = s.verifyParent(blockCount, b); err == ErrBlockDiverged {
+		log.WithFields(log.Fields{"count": blockCount}).Warning("main chain reorganized")
+		if err = s.reorganize(blockCount - 1); err != nil {
+			log.Warningf("reorganize saved chain failed, try again: %v", err)
+			return
+		}
+	} else if err != nil {
+		log.Warningf("verify block parent failed, try fetch/process again: %v", err)
 		return
-	}
+	} else {
+		// process block
+		if err = s.processBlock(blockCount, height, b); err != nil {
+			log.Warningf("process block failed, try fetch/process again: %v", err)
+			return
+		}
 
-	atomic.AddUint32(&s.nextBlockToFetch, 1)
+		atomic.AddUint32(&s.nextBlockToFetch, 1)
+	}
 
 	// last fetch success, trigger next fetch for fast sync
 	select {
@@ -326,6 +349,116 @@ func (s *Service) requestBlock() {
 	}
 }
 
+func (s *Service) fetchBlock(c uint32) (b *pt.Block, height uint32, err error) {
+	req := &bp.FetchBlockByCountReq{Count: c}
+	resp := &bp.FetchBlockResp{}
+
+	if err = s.requestBP(route.MCCFetchBlockByCount.String(), req, resp); err != nil {
+		return
+	}
+	if resp.Block == nil {
+		err = ErrNilBlock
+		return
+	}
+
+	return resp.Block, resp.Height, nil
+}
+
+// isNoSuchBlock returns if the block producer reports the block count is not on main chain, the
+// error is passed by message through rpc.
+func isNoSuchBlock(err error) bool {
+	return err != nil && err.Error() == bp.ErrNoSuchBlock.Error()
+}
+
+// verifyParent checks if block of count extends the saved chain.
+func (s *Service) verifyParent(c uint32, b *pt.Block) (err error) {
+	if c == 0 || b == nil {
+		return
+	}
+
+	var parent *pt.Block
+	if parent, _, _, err = s.getBlockByCount(c - 1); err != nil {
+		return
+	}
+	if !parent.BlockHash().IsEqual(b.ParentHash()) {
+		err = ErrBlockDiverged
+	}
+
+	return
+}
+
+// verifyTip checks if the saved block of count is still on main chain.
+func (s *Service) verifyTip(c uint32) (err error) {
+	var local, remote *pt.Block
+	if local, _, _, err = s.getBlockByCount(c); err != nil {
+		return
+	}
+	if remote, _, err = s.fetchBlock(c); isNoSuchBlock(err) {
+		// main chain is reorganized to a shorter branch
+		err = nil
+	} else if err != nil {
+		// main chain is not reachable
+		return nil
+	} else if local.BlockHash().IsEqual(remote.BlockHash()) {
+		return
+	}
+
+	log.WithFields(log.Fields{"count": c}).Warning("main chain reorganized")
+	return s.reorganize(c)
+}
+
+// reorganize finds the common ancestor of saved chain and main chain from count downwards, and
+// rolls back the saved blocks after the ancestor, the new branch is fetched and indexed later.
+func (s *Service) reorganize(c uint32) (err error) {
+	ancestor := int64(c)
+	for ; ancestor >= 0; ancestor-- {
+		var local, remote *pt.Block
+		if local, _, _, err = s.getBlockByCount(uint32(ancestor)); err != nil {
+			return
+		}
+		if remote, _, err = s.fetchBlock(uint32(ancestor)); isNoSuchBlock(err) {
+			// main chain is shorter than saved chain
+			err = nil
+			continue
+		} else if err != nil {
+			return
+		}
+		if local.BlockHash().IsEqual(remote.BlockHash()) {
+			break
+		}
+	}
+	if ancestor < 0 {
+		return ErrGenesisDiverged
+	}
+
+	var tip uint32
+	if tip, err = s.getHighestCount(); err != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"ancestor": ancestor,
+		"tip":      tip,
+	}).Info("roll back saved blocks to common ancestor")
+
+	var rebuild bool
+	for count := int64(tip); count > ancestor; count-- {
+		var cleared bool
+		if cleared, err = s.rollbackBlock(uint32(count)); err != nil {
+			return
+		}
+		rebuild = rebuild || cleared
+		atomic.StoreUint32(&s.nextBlockToFetch, uint32(count))
+	}
+
+	if rebuild {
+		// index the saved blocks from genesis again
+		err = s.buildIndexes()
+	}
+
+	return
+}
+
 func (s *Service) processBlock(c uint32, h uint32, b *pt.Block) (err error) {
 	if b == nil {
 		log.Warningf("processed nil block on count: %v", c)
@@ -339,6 +472,10 @@ func (s *Service) processBlock(c uint32, h uint32, b *pt.Block) (err error) {
 		"count":  c,
 	}).Info("process new block")
 
+	if err = s.indexBlock(c, h, b); err != nil {
+		return
+	}
+
 	if err = s.saveTransactions(c, b.Transactions); err != nil {
 		return
 	}
@@ -421,7 +558,7 @@ func (s *Service) saveBlock(c uint32, h uint32, b *pt.Block) (err error) {
 	return
 }
 
-func (s *Service) requestBP(method string, request interface{}, response interface{}) (err error) {
+func (s *Service) callBP(method string, request interface{}, response interface{}) (err error) {
 	var bpNodeID proto.NodeID
 	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
 		return
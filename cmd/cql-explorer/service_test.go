@@ -0,0 +1,223 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	testAlice = proto.AccountAddress(hash.HashH([]byte("alice")))
+	testBob   = proto.AccountAddress(hash.HashH([]byte("bob")))
+)
+
+// testChain builds the main chain blocks for explorer.
+type testChain struct {
+	priv   *asymmetric.PrivateKey
+	blocks []*pt.Block
+}
+
+func newTestChain(priv *asymmetric.PrivateKey) (c *testChain, err error) {
+	c = &testChain{priv: priv}
+	err = c.add(
+		pt.NewBaseAccount(&pt.Account{Address: testAlice, StableCoinBalance: 100}),
+		pt.NewBaseAccount(&pt.Account{Address: testBob, StableCoinBalance: 100}),
+	)
+	return
+}
+
+// fork returns a new chain sharing the blocks before count.
+func (c *testChain) fork(count int) *testChain {
+	return &testChain{priv: c.priv, blocks: append([]*pt.Block{}, c.blocks[:count]...)}
+}
+
+func (c *testChain) add(txs ...pi.Transaction) (err error) {
+	b := &pt.Block{Transactions: txs}
+	b.SignedHeader.Timestamp = time.Unix(int64(len(c.blocks)), int64(len(txs))).UTC()
+	if len(c.blocks) > 0 {
+		b.SignedHeader.ParentHash = *c.blocks[len(c.blocks)-1].BlockHash()
+	}
+	for _, t := range txs {
+		if err = t.Sign(c.priv); err != nil {
+			return
+		}
+	}
+	if err = b.PackAndSignBlock(c.priv); err != nil {
+		return
+	}
+	c.blocks = append(c.blocks, b)
+	return
+}
+
+func (c *testChain) requestBP(method string, request interface{}, response interface{}) (err error) {
+	req := request.(*bp.FetchBlockByCountReq)
+	resp := response.(*bp.FetchBlockResp)
+	if int(req.Count) >= len(c.blocks) {
+		return bp.ErrNoSuchBlock
+	}
+	resp.Block = c.blocks[req.Count]
+	resp.Count = req.Count
+	resp.Height = req.Count * 2
+	return
+}
+
+func newTestTransfer(sender, receiver proto.AccountAddress, nonce pi.AccountNonce, amount uint64) pi.Transaction {
+	return pt.NewTransfer(&pt.TransferHeader{
+		Sender:   sender,
+		Receiver: receiver,
+		Nonce:    nonce,
+		Amount:   amount,
+	})
+}
+
+func newTestBilling(dbID proto.DatabaseID, nonce pi.AccountNonce, miner proto.AccountAddress) pi.Transaction {
+	req := &pt.BillingRequest{Header: pt.BillingRequestHeader{
+		DatabaseID: dbID,
+		HighHeight: int32(nonce),
+		GasAmounts: []*proto.AddrAndGas{{AccountAddress: miner, GasAmount: 1}},
+	}}
+	return pt.NewBilling(pt.NewBillingHeader(
+		nonce, req, testAlice, []*proto.AccountAddress{&miner}, []uint64{1}, []uint64{2}))
+}
+
+func newTestService() (s *Service, closeFn func(), err error) {
+	var dir string
+	if dir, err = ioutil.TempDir("", "explorer"); err != nil {
+		return
+	}
+	conf.GConf = &conf.Config{WorkingRoot: dir}
+	if s, err = NewService(time.Second); err != nil {
+		os.RemoveAll(dir)
+		return
+	}
+	closeFn = func() {
+		s.db.Close()
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+// syncTestService fetches and processes blocks until the saved chain is the same as main chain.
+func syncTestService(s *Service, chain *testChain) {
+	s.requestBP = chain.requestBP
+	for i := 0; i < 4*len(chain.blocks); i++ {
+		s.requestBlock()
+	}
+}
+
+// dumpTestService returns the saved blocks and indexes, the undo records are skipped as the
+// account entries of a transaction are recorded in map order.
+func dumpTestService(s *Service) (data map[string]string) {
+	data = make(map[string]string)
+	it := s.db.NewIterator(&util.Range{}, nil)
+	defer it.Release()
+	for it.Next() {
+		if bytes.HasPrefix(it.Key(), indexUndoKeyPrefix) {
+			continue
+		}
+		data[string(it.Key())] = string(it.Value())
+	}
+	return
+}
+
+func TestReorganize(t *testing.T) {
+	Convey("Given an explorer indexed a branch of main chain", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		chain, err := newTestChain(priv)
+		So(err, ShouldBeNil)
+		So(chain.add(newTestTransfer(testAlice, testBob, 0, 10)), ShouldBeNil)
+		fork := chain.fork(len(chain.blocks))
+		So(chain.add(newTestBilling("db1", 1, testBob)), ShouldBeNil)
+		So(chain.add(newTestTransfer(testBob, testAlice, 0, 5)), ShouldBeNil)
+		So(chain.add(newTestTransfer(testAlice, testAlice, 2, 1)), ShouldBeNil)
+
+		s, closeFn, err := newTestService()
+		So(err, ShouldBeNil)
+		Reset(closeFn)
+		syncTestService(s, chain)
+		So(s.nextBlockToFetch, ShouldEqual, len(chain.blocks))
+		a, err := s.getAccount(testBob)
+		So(err, ShouldBeNil)
+		So(a.StableBalance, ShouldEqual, 107)
+		So(a.CovenantBalance, ShouldEqual, 1)
+		_, err = s.getDatabase("db1")
+		So(err, ShouldBeNil)
+
+		expectFreshIndexes := func() {
+			syncTestService(s, fork)
+			So(s.nextBlockToFetch, ShouldEqual, len(fork.blocks))
+
+			fresh, closeFresh, err := newTestService()
+			So(err, ShouldBeNil)
+			defer closeFresh()
+			syncTestService(fresh, fork)
+			So(fresh.nextBlockToFetch, ShouldEqual, len(fork.blocks))
+			So(dumpTestService(s), ShouldResemble, dumpTestService(fresh))
+
+			_, err = s.getDatabase("db1")
+			So(err, ShouldEqual, ErrNotFound)
+			_, err = s.getDatabase("db2")
+			So(err, ShouldBeNil)
+			refs, _, err := s.listTxs(nil, nil, 100)
+			So(err, ShouldBeNil)
+			freshRefs, _, err := fresh.listTxs(nil, nil, 100)
+			So(err, ShouldBeNil)
+			So(refs, ShouldResemble, freshRefs)
+		}
+
+		Convey("The indexes should be the same as new branch after switching to a longer fork", func() {
+			So(fork.add(newTestBilling("db2", 1, testAlice)), ShouldBeNil)
+			So(fork.add(newTestTransfer(testBob, testAlice, 0, 50)), ShouldBeNil)
+			So(fork.add(newTestTransfer(testAlice, testBob, 2, 20)), ShouldBeNil)
+			So(fork.add(newTestTransfer(testBob, testAlice, 1, 3)), ShouldBeNil)
+			So(len(fork.blocks), ShouldBeGreaterThan, len(chain.blocks))
+			expectFreshIndexes()
+		})
+
+		Convey("The indexes should be the same as new branch after switching to a shorter fork", func() {
+			So(fork.add(newTestBilling("db2", 1, testAlice)), ShouldBeNil)
+			So(len(fork.blocks), ShouldBeLessThan, len(chain.blocks))
+			expectFreshIndexes()
+		})
+
+		Convey("The indexes should be built from genesis if the undo records are missing", func() {
+			it := s.db.NewIterator(util.BytesPrefix(indexUndoKeyPrefix), nil)
+			for it.Next() {
+				So(s.db.Delete(it.Key(), nil), ShouldBeNil)
+			}
+			it.Release()
+			So(fork.add(newTestBilling("db2", 1, testAlice)), ShouldBeNil)
+			So(fork.add(newTestTransfer(testBob, testAlice, 0, 50)), ShouldBeNil)
+			expectFreshIndexes()
+		})
+	})
+}
@@ -31,6 +31,9 @@ const (
 	argAddress       = "address"
 	argMediaURL      = "media_url"
 	argApplicationID = "id"
+	argPlatform      = "platform"
+	argToken         = "token"
+	argAccount       = "account"
 )
 
 var (
@@ -65,6 +68,7 @@ func corsHandler(rw http.ResponseWriter, r *http.Request) {
 
 type tokenDispenser struct {
 	p *Persistence
+	v *Verifier
 }
 
 func (d *tokenDispenser) poll(rw http.ResponseWriter, r *http.Request) {
@@ -101,23 +105,56 @@ func (d *tokenDispenser) poll(rw http.ResponseWriter, r *http.Request) {
 
 func (d *tokenDispenser) application(rw http.ResponseWriter, r *http.Request) {
 	// get args
-	address := r.FormValue(argAddress)
-	mediaURL := r.FormValue(argMediaURL)
+	app := &application{
+		address:  r.FormValue(argAddress),
+		platform: r.FormValue(argPlatform),
+		mediaURL: r.FormValue(argMediaURL),
+		token:    r.FormValue(argToken),
+		account:  r.FormValue(argAccount),
+	}
 
 	// validate args
-	if !regexAddress.MatchString(address) {
+	if !regexAddress.MatchString(app.address) {
 		// error
 		sendResponse(http.StatusBadRequest, false, ErrInvalidAddress.Error(), nil, rw)
 		return
 	}
 
-	if !regexMediaURL.MatchString(mediaURL) {
+	if app.mediaURL != "" && !regexMediaURL.MatchString(app.mediaURL) {
 		// error
 		sendResponse(http.StatusBadRequest, false, ErrInvalidURL, nil, rw)
 		return
 	}
 
-	if applicationID, err := d.p.enqueueApplication(address, mediaURL); err != nil {
+	// resolve verification backend
+	backend, account, proof, err := resolveApplication(d.v.backends, app)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"address":  app.address,
+			"platform": app.platform,
+			"mediaURL": app.mediaURL,
+		}).Errorf("enqueue unsupported application: %v", err)
+		sendResponse(http.StatusBadRequest, false, err.Error(), nil, rw)
+		return
+	}
+
+	if sv, ok := backend.(SubmitVerifier); ok {
+		if err = sv.VerifySubmit(account, proof); err != nil {
+			var status = http.StatusBadRequest
+			if err == ErrVerifyToken {
+				status = http.StatusInternalServerError
+			}
+			sendResponse(status, false, err.Error(), nil, rw)
+			return
+		}
+	}
+
+	meta := urlMeta{
+		platform: backend.Name(),
+		account:  account,
+	}
+
+	if applicationID, err := d.p.enqueueApplication(app.address, meta, proof); err != nil {
 		var status = http.StatusBadRequest
 		if err == ErrAddressQuotaExceeded || err == ErrAccountQuotaExceeded {
 			status = http.StatusTooManyRequests
@@ -142,6 +179,7 @@ func startAPI(v *Verifier, p *Persistence, listenAddr string) (server *http.Serv
 
 	dispenser := &tokenDispenser{
 		p: p,
+		v: v,
 	}
 
 	v1Router := router.PathPrefix("/v1").Subrouter()
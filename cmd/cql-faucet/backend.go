@@ -0,0 +1,306 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// VerificationBackend defines a pluggable faucet application verification method.
+type VerificationBackend interface {
+	// Name returns the platform name recorded with applications accepted by the backend.
+	Name() string
+	// Resolve returns the applicant account and the proof to persist if the application
+	// is acceptable by the backend.
+	Resolve(app *application) (account string, proof string, ok bool)
+	// Verify checks the persisted application record, proof is stored as record media url.
+	Verify(r *applicationRecord) error
+}
+
+// SubmitVerifier is implemented by backends verifying applications on submission, whose proofs
+// expire soon or are single use, so they could not be verified by the verifier later.
+type SubmitVerifier interface {
+	// VerifySubmit checks the resolved account and proof before the application is persisted.
+	VerifySubmit(account string, proof string) error
+}
+
+// application defines the arguments of a faucet application request.
+type application struct {
+	address  string
+	platform string
+	mediaURL string
+	token    string
+	account  string
+}
+
+// socialBackend verifies applications by scraping the shared social media post.
+type socialBackend struct {
+	name            string
+	hosts           []string
+	contentRequired []string
+	urlRequired     string
+	verifyFunc      func(string, []string, string) error
+}
+
+// Name implements VerificationBackend.Name.
+func (b *socialBackend) Name() string {
+	return b.name
+}
+
+// Resolve implements VerificationBackend.Resolve.
+func (b *socialBackend) Resolve(app *application) (account string, proof string, ok bool) {
+	if app.mediaURL == "" {
+		return
+	}
+	if account, ok = extractAccountInURL(app.mediaURL, b.hosts); ok {
+		proof = app.mediaURL
+	}
+	return
+}
+
+// Verify implements VerificationBackend.Verify.
+func (b *socialBackend) Verify(r *applicationRecord) error {
+	return b.verifyFunc(r.mediaURL, b.contentRequired, b.urlRequired)
+}
+
+// tokenBackend verifies applications carrying a captcha response or an email token against a
+// reCAPTCHA siteverify compatible endpoint.
+type tokenBackend struct {
+	name            string
+	verifyURL       string
+	secret          string
+	accountRequired bool
+}
+
+// tokenVerifyResponse defines the siteverify endpoint response.
+type tokenVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Name implements VerificationBackend.Name.
+func (b *tokenBackend) Name() string {
+	return b.name
+}
+
+// Resolve implements VerificationBackend.Resolve.
+func (b *tokenBackend) Resolve(app *application) (account string, proof string, ok bool) {
+	if app.token == "" || (b.accountRequired && app.account == "") {
+		return
+	}
+	if account = app.account; account == "" {
+		account = app.address
+	}
+	return account, app.token, true
+}
+
+// VerifySubmit implements SubmitVerifier.VerifySubmit.
+func (b *tokenBackend) VerifySubmit(account string, proof string) (err error) {
+	form := url.Values{}
+	form.Set("secret", b.secret)
+	form.Set("response", proof)
+	if b.accountRequired {
+		form.Set("account", account)
+	}
+
+	var resp *http.Response
+	if resp, err = medClient.PostForm(b.verifyURL, form); err != nil {
+		log.WithError(err).WithField("platform", b.name).Warning("token verification failed")
+		return ErrVerifyToken
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.WithFields(log.Fields{
+			"platform": b.name,
+			"status":   resp.StatusCode,
+		}).Warning("token verification failed")
+		return ErrVerifyToken
+	}
+
+	var result tokenVerifyResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.WithError(err).WithField("platform", b.name).Warning("token verification failed")
+		return ErrVerifyToken
+	}
+	if !result.Success {
+		log.WithFields(log.Fields{
+			"platform": b.name,
+			"errors":   result.ErrorCodes,
+		}).Info("token verification rejected")
+		return ErrInvalidToken
+	}
+
+	return
+}
+
+// Verify implements VerificationBackend.Verify, the token is verified on submission already.
+func (b *tokenBackend) Verify(r *applicationRecord) error {
+	return nil
+}
+
+// allowListBackend accepts applications of the configured addresses only, suitable for private
+// test nets without access to the social platforms.
+type allowListBackend struct {
+	name      string
+	addresses map[string]bool
+}
+
+// Name implements VerificationBackend.Name.
+func (b *allowListBackend) Name() string {
+	return b.name
+}
+
+// Resolve implements VerificationBackend.Resolve.
+func (b *allowListBackend) Resolve(app *application) (account string, proof string, ok bool) {
+	if !b.addresses[app.address] {
+		return
+	}
+	return app.address, "", true
+}
+
+// Verify implements VerificationBackend.Verify.
+func (b *allowListBackend) Verify(r *applicationRecord) error {
+	if !b.addresses[r.address] {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
+
+// newVerificationBackends builds the verification backends in config order.
+func newVerificationBackends(cfg *Config) (backends []VerificationBackend, err error) {
+	names := make(map[string]bool)
+
+	for _, bc := range cfg.Backends {
+		var backend VerificationBackend
+		if backend, err = newVerificationBackend(cfg, bc); err != nil {
+			return
+		}
+		if names[backend.Name()] {
+			log.Errorf("duplicate faucet verification backend: %v", backend.Name())
+			err = ErrInvalidFaucetConfig
+			return
+		}
+		names[backend.Name()] = true
+		backends = append(backends, backend)
+	}
+
+	if len(backends) == 0 {
+		log.Error("at least one faucet verification backend is required")
+		err = ErrInvalidFaucetConfig
+	}
+
+	return
+}
+
+func newVerificationBackend(cfg *Config, bc *BackendConfig) (backend VerificationBackend, err error) {
+	typ := strings.ToLower(bc.Type)
+	name := bc.Name
+	if name == "" {
+		name = typ
+	}
+
+	switch typ {
+	case platformFacebook, platformTwitter, platformWeibo:
+		if cfg.URLRequired == "" && len(cfg.ContentRequired) == 0 {
+			log.Error("at least one URL/Content config for faucet application is required")
+			err = ErrInvalidFaucetConfig
+			return
+		}
+
+		b := &socialBackend{
+			name:            name,
+			hosts:           bc.Hosts,
+			contentRequired: cfg.ContentRequired,
+			urlRequired:     cfg.URLRequired,
+		}
+		if len(b.hosts) == 0 {
+			b.hosts = []string{typ}
+		}
+		switch typ {
+		case platformFacebook:
+			b.verifyFunc = verifyFacebook
+		case platformTwitter:
+			b.verifyFunc = verifyTwitter
+		case platformWeibo:
+			b.verifyFunc = verifyWeibo
+		}
+		backend = b
+	case platformCaptcha, platformEmail:
+		if bc.VerifyURL == "" {
+			log.Errorf("VerifyURL is required for %v faucet verification backend", name)
+			err = ErrInvalidFaucetConfig
+			return
+		}
+
+		backend = &tokenBackend{
+			name:            name,
+			verifyURL:       bc.VerifyURL,
+			secret:          bc.Secret,
+			accountRequired: typ == platformEmail,
+		}
+	case platformAllowList:
+		if len(bc.Addresses) == 0 {
+			log.Errorf("Addresses are required for %v faucet verification backend", name)
+			err = ErrInvalidFaucetConfig
+			return
+		}
+
+		b := &allowListBackend{
+			name:      name,
+			addresses: make(map[string]bool),
+		}
+		for _, addr := range bc.Addresses {
+			b.addresses[addr] = true
+		}
+		backend = b
+	default:
+		log.Errorf("unknown faucet verification backend type: %v", bc.Type)
+		err = ErrInvalidFaucetConfig
+	}
+
+	return
+}
+
+// resolveApplication finds the first backend accepting the application, only the backend named
+// by the application platform is considered if provided.
+func resolveApplication(backends []VerificationBackend, app *application) (
+	backend VerificationBackend, account string, proof string, err error) {
+	var ok bool
+	for _, backend = range backends {
+		if app.platform != "" && app.platform != backend.Name() {
+			continue
+		}
+		if account, proof, ok = backend.Resolve(app); ok {
+			return
+		}
+	}
+
+	backend = nil
+	if app.mediaURL != "" {
+		err = ErrInvalidURL
+	} else {
+		err = ErrUnsupportedApplication
+	}
+
+	return
+}
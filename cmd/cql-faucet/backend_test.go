@@ -0,0 +1,178 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testAddress1 = "4kcCg4niPjWURuFyT633V8TF9Xb9PvUR5Xbf6aTvGxFZkJFQaS9"
+	testAddress2 = "4jXvNvPHKNPU8Sncz5u5F5WSGcgXmzC1g8RuAXTCJzLsbmX8KY5"
+)
+
+func TestVerificationBackends(t *testing.T) {
+	Convey("Given verification backends served by stub", t, func() {
+		stub := newVerificationStub()
+		Reset(stub.Close)
+
+		stubURL, err := url.Parse(stub.URL)
+		So(err, ShouldBeNil)
+
+		cfg := &Config{
+			URLRequired:     "https://github.com/CovenantSQL",
+			ContentRequired: []string{"CovenantSQL"},
+			Backends: []*BackendConfig{
+				{Type: "allowlist", Addresses: []string{testAddress1}},
+				{Type: "Facebook"},
+				{Type: "twitter", Name: "stub", Hosts: []string{stubURL.Hostname()}},
+				{Type: "captcha", VerifyURL: stub.URL + "/siteverify", Secret: stubSecret},
+				{Type: "email", VerifyURL: stub.URL + "/siteverify", Secret: stubSecret},
+			},
+		}
+		backends, err := newVerificationBackends(cfg)
+		So(err, ShouldBeNil)
+		So(backends, ShouldHaveLength, 5)
+
+		Convey("The applications should be resolved to the first accepting backend", func() {
+			b, account, proof, err := resolveApplication(backends, &application{
+				address:  testAddress1,
+				mediaURL: "https://www.facebook.com/covenantsql/posts/1",
+			})
+			So(err, ShouldBeNil)
+			So(b.Name(), ShouldEqual, "allowlist")
+			So(account, ShouldEqual, testAddress1)
+			So(proof, ShouldBeEmpty)
+
+			b, account, proof, err = resolveApplication(backends, &application{
+				address:  testAddress1,
+				platform: "facebook",
+				mediaURL: "https://www.facebook.com/covenantsql/posts/1",
+			})
+			So(err, ShouldBeNil)
+			So(b.Name(), ShouldEqual, "facebook")
+			So(account, ShouldEqual, "covenantsql")
+			So(proof, ShouldEqual, "https://www.facebook.com/covenantsql/posts/1")
+
+			b, account, proof, err = resolveApplication(backends, &application{
+				address: testAddress2,
+				token:   "token",
+			})
+			So(err, ShouldBeNil)
+			So(b.Name(), ShouldEqual, "captcha")
+			So(account, ShouldEqual, testAddress2)
+			So(proof, ShouldEqual, "token")
+
+			b, account, _, err = resolveApplication(backends, &application{
+				address:  testAddress2,
+				platform: "email",
+				token:    "token",
+				account:  "foo@example.com",
+			})
+			So(err, ShouldBeNil)
+			So(b.Name(), ShouldEqual, "email")
+			So(account, ShouldEqual, "foo@example.com")
+
+			_, _, _, err = resolveApplication(backends, &application{
+				address:  testAddress2,
+				platform: "email",
+				token:    "token",
+			})
+			So(err, ShouldEqual, ErrUnsupportedApplication)
+			_, _, _, err = resolveApplication(backends, &application{
+				address:  testAddress2,
+				mediaURL: "https://www.weibo.com/covenantsql/1",
+			})
+			So(err, ShouldEqual, ErrInvalidURL)
+			_, _, _, err = resolveApplication(backends, &application{address: testAddress2})
+			So(err, ShouldEqual, ErrUnsupportedApplication)
+		})
+
+		Convey("The applications should be verified by backends", func() {
+			verify := func(app *application) error {
+				b, account, proof, err := resolveApplication(backends, app)
+				So(err, ShouldBeNil)
+				if sv, ok := b.(SubmitVerifier); ok {
+					if err = sv.VerifySubmit(account, proof); err != nil {
+						return err
+					}
+				}
+				return b.Verify(&applicationRecord{
+					platform: b.Name(),
+					address:  app.address,
+					mediaURL: proof,
+					account:  account,
+				})
+			}
+
+			link := stub.addLink("/t.co/covenantsql", "https://github.com/CovenantSQL/CovenantSQL")
+			post := stub.addPost("/twitter/covenantsql/status/1", "CovenantSQL "+link)
+			So(verify(&application{address: testAddress2, mediaURL: post}), ShouldBeNil)
+			post = stub.addPost("/twitter/covenantsql/status/2", "CovenantSQL")
+			So(verify(&application{address: testAddress2, mediaURL: post}), ShouldEqual, ErrRequiredURLNotExists)
+
+			stub.addToken("captcha-token", "")
+			So(verify(&application{address: testAddress2, token: "captcha-token"}), ShouldBeNil)
+			// token is single use
+			So(verify(&application{address: testAddress2, token: "captcha-token"}), ShouldEqual, ErrInvalidToken)
+
+			stub.addToken("email-token", "foo@example.com")
+			So(verify(&application{address: testAddress2, platform: "email", token: "email-token",
+				account: "bar@example.com"}), ShouldEqual, ErrInvalidToken)
+			So(verify(&application{address: testAddress2, platform: "email", token: "email-token",
+				account: "foo@example.com"}), ShouldBeNil)
+
+			// failures of the endpoint are not accepted
+			stub.addToken("status-token", "")
+			stub.setStatus(http.StatusServiceUnavailable)
+			So(verify(&application{address: testAddress2, token: "status-token"}), ShouldEqual, ErrVerifyToken)
+			stub.setStatus(0)
+			So(verify(&application{address: testAddress2, token: "status-token"}), ShouldBeNil)
+
+			// tokens are verified on submission only
+			So(backends[3].Verify(&applicationRecord{address: testAddress2, mediaURL: "captcha-token"}), ShouldBeNil)
+
+			So(verify(&application{address: testAddress1}), ShouldBeNil)
+			So(backends[0].Verify(&applicationRecord{address: testAddress2}), ShouldEqual, ErrAddressNotAllowed)
+		})
+
+		Convey("The invalid backend configs should be rejected", func() {
+			for _, bc := range []*BackendConfig{
+				{Type: "unknown"},
+				{Type: "captcha"},
+				{Type: "allowlist"},
+			} {
+				_, err = newVerificationBackends(&Config{Backends: []*BackendConfig{bc}})
+				So(err, ShouldEqual, ErrInvalidFaucetConfig)
+			}
+
+			_, err = newVerificationBackends(&Config{Backends: []*BackendConfig{{Type: "weibo"}}})
+			So(err, ShouldEqual, ErrInvalidFaucetConfig)
+			_, err = newVerificationBackends(&Config{Backends: []*BackendConfig{
+				{Type: "allowlist", Addresses: []string{testAddress1}},
+				{Type: "allowlist", Addresses: []string{testAddress2}},
+			}})
+			So(err, ShouldEqual, ErrInvalidFaucetConfig)
+			_, err = newVerificationBackends(&Config{})
+			So(err, ShouldEqual, ErrInvalidFaucetConfig)
+		})
+	})
+}
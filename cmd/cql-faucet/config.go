@@ -36,6 +36,28 @@ type Config struct {
 	AddressDailyQuota    uint          `yaml:"AddressDailyQuota"`
 	AccountDailyQuota    uint          `yaml:"AccountDailyQuota"`
 	VerificationInterval time.Duration `yaml:"VerificationInterval"`
+	DailyBudget          int64         `yaml:"DailyBudget"`         // daily total dispense amount, 0 for unlimited
+	DispenseBatchSize    int           `yaml:"DispenseBatchSize"`   // max dispense transactions sent per round
+	DispenseMaxAttempts  int           `yaml:"DispenseMaxAttempts"` // max sending attempts of a dispense transaction
+
+	// verification backends, social platform backends are assumed if not defined
+	Backends []*BackendConfig `yaml:"Backends"`
+}
+
+// BackendConfig defines the options of a faucet application verification backend.
+type BackendConfig struct {
+	Type string `yaml:"Type"` // facebook/twitter/weibo/captcha/email/allowlist
+	Name string `yaml:"Name"` // platform name of applications, defaults to Type
+
+	// social platform backends
+	Hosts []string `yaml:"Hosts"` // accepted media url host keywords, defaults to Type
+
+	// captcha/email token backends
+	VerifyURL string `yaml:"VerifyURL"` // reCAPTCHA siteverify compatible endpoint
+	Secret    string `yaml:"Secret"`
+
+	// allow-list backend
+	Addresses []string `yaml:"Addresses"`
 }
 
 type confWrapper struct {
@@ -71,9 +93,15 @@ func LoadConfig(configPath string) (config *Config, err error) {
 		return
 	}
 
-	if config.URLRequired == "" && len(config.ContentRequired) == 0 {
-		err = ErrInvalidFaucetConfig
-		log.Error("at least one URL/Content config for faucet application is required")
+	if len(config.Backends) == 0 {
+		config.Backends = []*BackendConfig{
+			{Type: platformFacebook},
+			{Type: platformTwitter},
+			{Type: platformWeibo},
+		}
+	}
+
+	if _, err = newVerificationBackends(config); err != nil {
 		return
 	}
 
@@ -89,6 +117,20 @@ func LoadConfig(configPath string) (config *Config, err error) {
 		return
 	}
 
+	if config.DailyBudget < 0 {
+		err = ErrInvalidFaucetConfig
+		log.Error("DailyBudget should not be negative")
+		return
+	}
+
+	if config.DispenseBatchSize <= 0 {
+		config.DispenseBatchSize = dispensePerRound
+	}
+
+	if config.DispenseMaxAttempts <= 0 {
+		config.DispenseMaxAttempts = dispenseMaxAttempts
+	}
+
 	if config.AddressDailyQuota == 0 || config.AccountDailyQuota == 0 {
 		log.Warningf("AddressDailyQuota & AccountDailyQuota should be valid positive number, 1 assumed")
 
@@ -0,0 +1,415 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// metaConfirmCount is the faucet meta name of the next block count to scan for confirmations.
+	metaConfirmCount = "confirm_count"
+	// maxRetryBackoffShift limits the retry backoff to 2^shift verification intervals.
+	maxRetryBackoffShift = 4
+)
+
+// dispense confirms the sent dispense transactions, resends the ones not accepted by block
+// producer and dispenses a new batch of verified applications with locally tracked nonces if
+// all sent transactions are accepted.
+func (v *Verifier) dispense() (err error) {
+	if err = v.confirm(); err != nil {
+		// confirmation is retried in next round
+		log.Warningf("confirm dispense transactions failed: %v", err)
+	}
+
+	var pending []*dispenseRecord
+	if pending, err = v.p.getDispensing(); err != nil {
+		return
+	}
+
+	var nonce pi.AccountNonce
+	if nonce, err = v.bp.nextNonce(v.vaultAddress); err != nil {
+		log.Warningf("query vault account nonce failed: %v", err)
+		return
+	}
+
+	var unaccepted int
+	if nonce, unaccepted, err = v.resend(pending, nonce); err != nil || unaccepted > 0 {
+		return
+	}
+
+	return v.dispenseBatch(nonce)
+}
+
+// confirm scans the new blocks of block producer and marks the packed dispenses as dispensed by
+// matching the transaction hashes, including the given up ones. The dispenses whose nonces are
+// used by other transactions are left without transaction to be assigned new nonces.
+func (v *Verifier) confirm() (err error) {
+	var pending, givenUp []*dispenseRecord
+	if pending, err = v.p.getDispensing(); err != nil {
+		return
+	}
+	if givenUp, err = v.p.getGivenUp(); err != nil {
+		return
+	}
+
+	var count int64
+	if count, err = v.p.getMeta(metaConfirmCount); err != nil {
+		return
+	}
+
+	txs := make(map[string]*dispenseRecord)
+	nonces := make(map[pi.AccountNonce]*dispenseRecord)
+	for _, d := range givenUp {
+		txs[d.txHash] = d
+	}
+	for _, d := range pending {
+		if d.txHash == "" {
+			continue
+		}
+		txs[d.txHash] = d
+		nonces[d.nonce] = d
+	}
+
+	for i := 0; i < confirmPerRound; i++ {
+		var b *pt.Block
+		if b, err = v.bp.fetchBlock(uint32(count)); err != nil {
+			// reached the chain head
+			log.Debugf("fetch block %d for confirmation stopped: %v", count, err)
+			err = nil
+			break
+		}
+
+		for _, tx := range b.Transactions {
+			if tx.GetAccountAddress() != v.vaultAddress {
+				continue
+			}
+
+			h := tx.GetHash()
+			d, ok := txs[h.String()]
+			if !ok {
+				// nonce used by a given up dispense or an empty transaction
+				if d, ok = nonces[tx.GetAccountNonce()]; ok {
+					log.WithFields(log.Fields{
+						"applicationID": d.applicationID,
+						"nonce":         d.nonce,
+						"tx":            d.txHash,
+						"block":         b.BlockHash().String(),
+					}).Warning("dispense transaction nonce used by other transaction")
+
+					delete(txs, d.txHash)
+					delete(nonces, d.nonce)
+					d.txHash = ""
+					d.attempts = 0
+					if err = v.p.updateDispense(d); err != nil {
+						return
+					}
+				}
+				continue
+			}
+
+			if err = v.p.finishDispense(d, nil); err != nil {
+				return
+			}
+			delete(txs, d.txHash)
+			if nonces[d.nonce] == d {
+				delete(nonces, d.nonce)
+			}
+
+			log.WithFields(log.Fields{
+				"applicationID": d.applicationID,
+				"nonce":         d.nonce,
+				"tx":            d.txHash,
+				"block":         b.BlockHash().String(),
+			}).Info("confirmed dispense transaction")
+		}
+
+		count++
+	}
+
+	return v.p.setMeta(metaConfirmCount, count)
+}
+
+// resend sends the dispense transactions not accepted by block producer again in nonce order.
+// A dispense is only given up at the vault nonce of block producer, which proves its nonce unused,
+// and the nonce is used by an empty transaction instead of the following dispenses, whose
+// transactions sent before could still be accepted. The dispenses without transaction are
+// assigned new nonces. It returns the next nonce to allocate and the count of transactions not
+// accepted yet.
+func (v *Verifier) resend(pending []*dispenseRecord, nonce pi.AccountNonce) (
+	next pi.AccountNonce, unaccepted int, err error) {
+	var (
+		now       = time.Now()
+		due       = false
+		records   []*dispenseRecord
+		txs       []*pt.Transfer
+		unsettled []*dispenseRecord
+	)
+
+	next = nonce
+
+	for _, d := range pending {
+		if d.txHash == "" {
+			unsettled = append(unsettled, d)
+			continue
+		}
+		if d.nonce < nonce {
+			// accepted by block producer, waiting for confirmation
+			continue
+		}
+
+		if d.nonce == nonce && d.attempts >= v.maxAttempts {
+			log.WithFields(log.Fields{
+				"applicationID": d.applicationID,
+				"nonce":         d.nonce,
+				"attempts":      d.attempts,
+			}).Warning("give up dispense transaction")
+
+			if err = v.p.finishDispense(d, ErrDispenseFailed); err != nil {
+				return
+			}
+			continue
+		}
+
+		// use the nonces given up by empty transactions
+		for ; next < d.nonce; next++ {
+			var tx *pt.Transfer
+			if tx, err = v.newEmptyTx(next); err != nil {
+				return
+			}
+			records = append(records, nil)
+			txs = append(txs, tx)
+			due = true
+		}
+
+		if len(records) == 0 && now.Sub(d.mtime) >= v.retryBackoff(d.attempts) {
+			// following transactions could not be accepted before the first one
+			due = true
+		}
+
+		var tx *pt.Transfer
+		if tx, err = v.newDispenseTx(d); err != nil {
+			return
+		}
+
+		records = append(records, d)
+		txs = append(txs, tx)
+		next = d.nonce + 1
+	}
+
+	for _, d := range unsettled {
+		d.nonce = next
+		var tx *pt.Transfer
+		if tx, err = v.newDispenseTx(d); err != nil {
+			return
+		}
+
+		records = append(records, d)
+		txs = append(txs, tx)
+		next++
+		due = true
+	}
+
+	unaccepted = len(records)
+
+	if !due {
+		return
+	}
+
+	for i, d := range records {
+		if d == nil {
+			v.sendEmptyTx(txs[i])
+			continue
+		}
+		if err = v.sendDispense(d, txs[i]); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// dispenseBatch dispenses verified applications within vault balance and daily budget.
+func (v *Verifier) dispenseBatch(nonce pi.AccountNonce) (err error) {
+	var records []*applicationRecord
+	if records, err = v.p.getRecords(0, "", StateVerified, v.batchSize); err != nil {
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	var balance uint64
+	if balance, err = v.bp.stableBalance(v.vaultAddress); err != nil {
+		log.Warningf("get account balance failed: %v", err)
+		return
+	}
+
+	log.Infof("get account balance success, balance: %v", balance)
+
+	for _, r := range records {
+		// decode target account address
+		var addrVersion byte
+		if addrVersion, _, err = crypto.Addr2Hash(r.address); err != nil || addrVersion != crypto.TestNet {
+			if err == nil && addrVersion != crypto.TestNet {
+				err = ErrInvalidAddress
+			}
+
+			// log error
+			log.Warningf("decode transfer target address failed: %v", err)
+
+			// mark failed
+			r.failReason = err.Error()
+			r.state = StateFailed
+			if err = v.p.updateRecord(r); err != nil {
+				return
+			}
+
+			log.WithFields(log.Fields(r.asMap())).Infof("dispensed application record failed")
+
+			// skip invalid address faucet application
+			err = nil
+			continue
+		}
+
+		if uint64(r.tokenAmount) > balance {
+			log.WithFields(log.Fields(r.asMap())).Warningf("dispense postponed: %v", ErrInsufficientBalance)
+			return
+		}
+
+		d := &dispenseRecord{
+			rowID:         r.rowID,
+			applicationID: r.applicationID,
+			address:       r.address,
+			tokenAmount:   r.tokenAmount,
+			nonce:         nonce,
+		}
+
+		var tx *pt.Transfer
+		if tx, err = v.newDispenseTx(d); err != nil {
+			return
+		}
+
+		// record the dispense before sending as the idempotency key of application
+		if err = v.p.startDispense(r, d); err == ErrDailyBudgetExceeded {
+			log.WithFields(log.Fields(r.asMap())).Warningf("dispense postponed: %v", err)
+			err = nil
+			return
+		} else if err != nil {
+			return
+		}
+
+		balance -= uint64(r.tokenAmount)
+		nonce++
+
+		if err = v.sendDispense(d, tx); err != nil {
+			return
+		}
+
+		log.WithFields(log.Fields(r.asMap())).Infof("dispensed application record")
+	}
+
+	return
+}
+
+// newDispenseTx builds and signs the transfer transaction of dispense, the same transaction is
+// built for unchanged dispense nonce.
+func (v *Verifier) newDispenseTx(d *dispenseRecord) (tx *pt.Transfer, err error) {
+	var targetAddress proto.AccountAddress
+	if _, targetAddress, err = crypto.Addr2Hash(d.address); err != nil {
+		return
+	}
+
+	tx = pt.NewTransfer(
+		&pt.TransferHeader{
+			Sender:   v.vaultAddress,
+			Receiver: targetAddress,
+			Nonce:    d.nonce,
+			Amount:   uint64(d.tokenAmount),
+		},
+	)
+	if err = tx.Sign(v.signer); err != nil {
+		return
+	}
+
+	h := tx.GetHash()
+	d.txHash = h.String()
+
+	return
+}
+
+// newEmptyTx builds and signs the transfer transaction of vault to itself, which uses the nonce
+// only.
+func (v *Verifier) newEmptyTx(nonce pi.AccountNonce) (tx *pt.Transfer, err error) {
+	tx = pt.NewTransfer(
+		&pt.TransferHeader{
+			Sender:   v.vaultAddress,
+			Receiver: v.vaultAddress,
+			Nonce:    nonce,
+		},
+	)
+	err = tx.Sign(v.signer)
+	return
+}
+
+// sendEmptyTx sends the empty transaction to block producer, a failed sending is retried in next
+// round.
+func (v *Verifier) sendEmptyTx(tx *pt.Transfer) {
+	if err := v.bp.addTx(tx); err != nil {
+		log.WithFields(log.Fields{
+			"nonce": tx.Nonce,
+		}).Warningf("send empty transaction failed: %v", err)
+	}
+}
+
+// sendDispense saves the attempt of dispense and sends the transaction to block producer, a failed
+// sending is retried after backoff.
+func (v *Verifier) sendDispense(d *dispenseRecord, tx *pt.Transfer) (err error) {
+	d.attempts++
+	d.mtime = time.Now().UTC()
+	if err = v.p.updateDispense(d); err != nil {
+		return
+	}
+
+	if err = v.bp.addTx(tx); err != nil {
+		log.WithFields(log.Fields{
+			"applicationID": d.applicationID,
+			"nonce":         d.nonce,
+			"attempts":      d.attempts,
+		}).Warningf("send transaction failed: %v", err)
+		err = nil
+	}
+
+	return
+}
+
+// retryBackoff returns the wait duration before the next attempt of a dispense transaction.
+func (v *Verifier) retryBackoff(attempts int) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+	if attempts > maxRetryBackoffShift {
+		attempts = maxRetryBackoffShift + 1
+	}
+	return v.interval << uint(attempts-1)
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeChain simulates the nonce check, tx pool and block packing of block producer.
+type fakeChain struct {
+	committed pi.AccountNonce
+	pool      []pi.Transaction
+	blocks    []*pt.Block
+	balance   uint64
+	drop      bool
+	sent      []hash.Hash
+}
+
+func (c *fakeChain) nextNonce(addr proto.AccountAddress) (pi.AccountNonce, error) {
+	return c.committed + pi.AccountNonce(len(c.pool)), nil
+}
+
+func (c *fakeChain) stableBalance(addr proto.AccountAddress) (uint64, error) {
+	return c.balance, nil
+}
+
+func (c *fakeChain) addTx(tx pi.Transaction) error {
+	c.sent = append(c.sent, tx.GetHash())
+	if c.drop {
+		return nil
+	}
+	for _, t := range c.pool {
+		if t.GetHash() == tx.GetHash() {
+			return nil
+		}
+	}
+	if n, _ := c.nextNonce(tx.GetAccountAddress()); tx.GetAccountNonce() != n {
+		return nil
+	}
+	c.pool = append(c.pool, tx)
+	c.balance -= tx.(*pt.Transfer).Amount
+	return nil
+}
+
+func (c *fakeChain) fetchBlock(count uint32) (*pt.Block, error) {
+	if int(count) >= len(c.blocks) {
+		return nil, ErrNilBlock
+	}
+	return c.blocks[count], nil
+}
+
+// pack packs the pooled transactions to a new block.
+func (c *fakeChain) pack() {
+	b := &pt.Block{Transactions: c.pool}
+	b.SignedHeader.BlockHash = hash.HashH([]byte{byte(len(c.blocks))})
+	c.blocks = append(c.blocks, b)
+	c.committed += pi.AccountNonce(len(c.pool))
+	c.pool = nil
+}
+
+// reset drops the pooled transactions like a restarted block producer.
+func (c *fakeChain) reset() {
+	for _, tx := range c.pool {
+		c.balance += tx.(*pt.Transfer).Amount
+	}
+	c.pool = nil
+}
+
+func TestDispense(t *testing.T) {
+	Convey("Given a faucet verifier with fake block producer", t, func() {
+		tmp, err := ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		conf.GConf = &conf.Config{WorkingRoot: tmp}
+		Reset(func() { os.RemoveAll(tmp) })
+
+		p, err := NewPersistence(&Config{
+			DatabaseID:        "faucet.db3",
+			LocalDatabase:     true,
+			FaucetAmount:      10,
+			AddressDailyQuota: 10,
+			AccountDailyQuota: 10,
+			DailyBudget:       30,
+		})
+		So(err, ShouldBeNil)
+		Reset(func() { p.db.Close() })
+
+		signer, err := kms.NewTestSigner()
+		So(err, ShouldBeNil)
+		chain := &fakeChain{committed: 5, balance: 100}
+		v := &Verifier{
+			lastVerified: make(map[string]int64),
+			signer:       signer,
+			bp:           chain,
+			batchSize:    2,
+			maxAttempts:  3,
+			p:            p,
+		}
+		v.vaultAddress, err = crypto.PubKeyHash(signer.PubKey())
+		So(err, ShouldBeNil)
+
+		apply := func() (id string) {
+			_, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			addr, err := crypto.PubKey2Addr(pub, crypto.TestNet)
+			So(err, ShouldBeNil)
+			id, err = p.enqueueApplication(addr, urlMeta{platform: platformAllowList, account: addr}, "")
+			So(err, ShouldBeNil)
+			records, err := p.getRecords(0, "", StateApplication, 0)
+			So(err, ShouldBeNil)
+			for _, r := range records {
+				r.state = StateVerified
+				So(p.updateRecord(r), ShouldBeNil)
+			}
+			return
+		}
+		stateOf := func(id string) State {
+			records, err := p.getRecords(0, "", StateUnknown, 0)
+			So(err, ShouldBeNil)
+			for _, r := range records {
+				if r.applicationID == id {
+					return r.state
+				}
+			}
+			return StateUnknown
+		}
+
+		ids := []string{apply(), apply(), apply(), apply()}
+
+		Convey("The verified applications should be dispensed in batches and confirmed", func() {
+			So(v.dispense(), ShouldBeNil)
+			So(chain.pool, ShouldHaveLength, 2)
+			So(chain.pool[0].GetAccountNonce(), ShouldEqual, 5)
+			So(chain.pool[1].GetAccountNonce(), ShouldEqual, 6)
+			So(stateOf(ids[0]), ShouldEqual, StateDispensing)
+			So(stateOf(ids[2]), ShouldEqual, StateVerified)
+
+			chain.pack()
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[1]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[2]), ShouldEqual, StateDispensing)
+			So(chain.pool, ShouldHaveLength, 1)
+			So(chain.pool[0].GetAccountNonce(), ShouldEqual, 7)
+
+			// daily budget exhausted
+			chain.pack()
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[2]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[3]), ShouldEqual, StateVerified)
+			So(chain.pool, ShouldBeEmpty)
+			_, err = p.enqueueApplication("4jXvNvPHKNPU8Sncz5u5F5WSGcgXmzC1g8RuAXTCJzLsbmX8KY5",
+				urlMeta{platform: platformAllowList, account: "x"}, "")
+			So(err, ShouldEqual, ErrDailyBudgetExceeded)
+		})
+
+		Convey("The dropped transactions should be resent with the same hashes", func() {
+			chain.drop = true
+			So(v.dispense(), ShouldBeNil)
+			So(chain.sent, ShouldHaveLength, 2)
+			So(chain.pool, ShouldBeEmpty)
+
+			chain.drop = false
+			So(v.dispense(), ShouldBeNil)
+			So(chain.sent, ShouldHaveLength, 4)
+			So(chain.sent[2], ShouldEqual, chain.sent[0])
+			So(chain.sent[3], ShouldEqual, chain.sent[1])
+			So(chain.pool, ShouldHaveLength, 2)
+
+			// pooled transactions lost on block producer restart
+			chain.reset()
+			So(v.dispense(), ShouldBeNil)
+			So(chain.pool, ShouldHaveLength, 2)
+			So(chain.sent[4], ShouldEqual, chain.sent[0])
+
+			pending, err := p.getDispensing()
+			So(err, ShouldBeNil)
+			So(pending, ShouldHaveLength, 2)
+			So(pending[0].attempts, ShouldEqual, 3)
+		})
+
+		Convey("The nonce given up should be used by an empty transaction", func() {
+			chain.drop = true
+			So(v.dispense(), ShouldBeNil)
+			pending, err := p.getDispensing()
+			So(err, ShouldBeNil)
+			So(pending, ShouldHaveLength, 2)
+			for _, d := range pending {
+				d.attempts = v.maxAttempts
+				So(p.updateDispense(d), ShouldBeNil)
+			}
+
+			// only the dispense at vault nonce is given up
+			chain.drop = false
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateFailed)
+			So(stateOf(ids[1]), ShouldEqual, StateDispensing)
+			So(chain.pool, ShouldHaveLength, 2)
+			empty := chain.pool[0].(*pt.Transfer)
+			So(empty.Nonce, ShouldEqual, 5)
+			So(empty.Receiver, ShouldEqual, v.vaultAddress)
+			So(empty.Amount, ShouldEqual, 0)
+			So(chain.pool[1].GetAccountNonce(), ShouldEqual, 6)
+			So(chain.pool[1].GetHash(), ShouldEqual, chain.sent[1])
+
+			// budget of failed dispense is released
+			chain.pack()
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateFailed)
+			So(stateOf(ids[1]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[2]), ShouldEqual, StateDispensing)
+			So(stateOf(ids[3]), ShouldEqual, StateDispensing)
+		})
+
+		Convey("The given up dispense accepted later should be confirmed", func() {
+			chain.drop = true
+			So(v.dispense(), ShouldBeNil)
+			pending, err := p.getDispensing()
+			So(err, ShouldBeNil)
+			So(pending, ShouldHaveLength, 2)
+			pending[0].attempts = v.maxAttempts
+			So(p.updateDispense(pending[0]), ShouldBeNil)
+
+			chain.drop = false
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateFailed)
+
+			// the given up transaction arrives at block producer before the empty one
+			chain.reset()
+			late, err := v.newDispenseTx(pending[0])
+			So(err, ShouldBeNil)
+			So(chain.addTx(late), ShouldBeNil)
+			So(v.dispense(), ShouldBeNil)
+			So(chain.pool, ShouldHaveLength, 2)
+
+			chain.pack()
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[1]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[2]), ShouldEqual, StateDispensing)
+			// budget of confirmed dispense is counted again
+			So(stateOf(ids[3]), ShouldEqual, StateVerified)
+		})
+
+		Convey("The dispense should be assigned a new nonce if its nonce is used", func() {
+			chain.drop = true
+			So(v.dispense(), ShouldBeNil)
+			chain.drop = false
+			other, err := v.newEmptyTx(5)
+			So(err, ShouldBeNil)
+			So(chain.addTx(other), ShouldBeNil)
+			chain.pack()
+
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateDispensing)
+			So(chain.pool, ShouldHaveLength, 2)
+			So(chain.pool[0].GetHash(), ShouldEqual, chain.sent[1])
+			So(chain.pool[1].GetAccountNonce(), ShouldEqual, 7)
+			So(chain.pool[1].GetHash(), ShouldNotEqual, chain.sent[0])
+
+			chain.pack()
+			So(v.dispense(), ShouldBeNil)
+			So(stateOf(ids[0]), ShouldEqual, StateDispensed)
+			So(stateOf(ids[1]), ShouldEqual, StateDispensed)
+		})
+
+		Convey("The dispenses should be postponed on insufficient balance", func() {
+			chain.balance = 15
+			So(v.dispense(), ShouldBeNil)
+			So(chain.pool, ShouldHaveLength, 1)
+			So(stateOf(ids[1]), ShouldEqual, StateVerified)
+		})
+	})
+}
@@ -37,9 +37,25 @@ var (
 	ErrRequiredContentNotExists = errors.New("NO_REQUIRED_CONTENT")
 	// ErrRequiredURLNotExists represents invalid application which contains no advertising url.
 	ErrRequiredURLNotExists = errors.New("NO_REQUIRED_LINK")
+	// ErrUnsupportedApplication represents the application is not acceptable by any verification backend.
+	ErrUnsupportedApplication = errors.New("UNSUPPORTED_APPLICATION")
+	// ErrInvalidToken represents the captcha/email token provided is rejected.
+	ErrInvalidToken = errors.New("INVALID_TOKEN")
+	// ErrVerifyToken represents the captcha/email token could not be verified by the verification endpoint.
+	ErrVerifyToken = errors.New("TOKEN_VERIFICATION_FAILED")
+	// ErrAddressNotAllowed represents the address is not in the faucet allow-list.
+	ErrAddressNotAllowed = errors.New("ADDRESS_NOT_ALLOWED")
+	// ErrDailyBudgetExceeded represents the faucet has exceeded the daily total dispense budget.
+	ErrDailyBudgetExceeded = errors.New("DAILY_BUDGET_EXCEEDED")
+	// ErrDispenseFailed represents the dispense transaction is not accepted after retries.
+	ErrDispenseFailed = errors.New("DISPENSE_FAILED")
 
 	// system errors
 
 	// ErrInvalidFaucetConfig represents invalid faucet config without enough configurations.
 	ErrInvalidFaucetConfig = errors.New("invalid faucet config")
+	// ErrNilBlock represents a nil block returned by block producer.
+	ErrNilBlock = errors.New("nil block returned")
+	// ErrInsufficientBalance represents the vault account balance is not enough for dispensing.
+	ErrInsufficientBalance = errors.New("insufficient vault balance")
 )
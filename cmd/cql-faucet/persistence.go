@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"time"
 
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/client"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -42,6 +43,8 @@ const (
 	StateDispensed
 	// StateFailed represents the application is invalid or maybe quota exceeded.
 	StateFailed
+	// StateDispensing represents the dispense transaction is sent and waiting for confirmation.
+	StateDispensing
 	// StateUnknown represents invalid state
 	StateUnknown
 )
@@ -56,6 +59,8 @@ func (s State) String() string {
 		return "StateDispensed"
 	case StateFailed:
 		return "StateFailed"
+	case StateDispensing:
+		return "StateDispensing"
 	case StateUnknown:
 		return "StateUnknown"
 	}
@@ -69,6 +74,7 @@ type Persistence struct {
 	accountDailyQuota uint
 	addressDailyQuota uint
 	tokenAmount       int64
+	dailyBudget       int64
 }
 
 // applicationRecord defines single record for verification.
@@ -84,6 +90,19 @@ type applicationRecord struct {
 	failReason    string
 }
 
+// dispenseRecord defines the dispense transaction of an application record, the application id
+// is used as the idempotency key of dispensing.
+type dispenseRecord struct {
+	rowID         int64
+	applicationID string
+	address       string
+	tokenAmount   int64
+	nonce         pi.AccountNonce
+	txHash        string
+	attempts      int
+	mtime         time.Time // last sent time
+}
+
 func (r *applicationRecord) asMap() (result map[string]interface{}) {
 	result = make(map[string]interface{})
 
@@ -106,6 +125,7 @@ func NewPersistence(faucetCfg *Config) (p *Persistence, err error) {
 		accountDailyQuota: faucetCfg.AccountDailyQuota,
 		addressDailyQuota: faucetCfg.AddressDailyQuota,
 		tokenAmount:       faucetCfg.FaucetAmount,
+		dailyBudget:       faucetCfg.DailyBudget,
 	}
 
 	// connect database
@@ -143,6 +163,27 @@ func (p *Persistence) initDB() (err error) {
 				reason string, 
 				ctime datetime
 			  )`)
+	if err != nil {
+		return
+	}
+	_, err = p.db.ExecContext(context.Background(),
+		`CREATE TABLE IF NOT EXISTS faucet_dispenses (
+				id string unique,
+				nonce bigint,
+				tx_hash string,
+				amount bigint,
+				attempts int,
+				mtime bigint,
+				ctime datetime
+			  )`)
+	if err != nil {
+		return
+	}
+	_, err = p.db.ExecContext(context.Background(),
+		`CREATE TABLE IF NOT EXISTS faucet_meta (
+				name string unique,
+				value bigint
+			  )`)
 	return
 }
 
@@ -153,8 +194,8 @@ func (p *Persistence) checkAccountLimit(platform string, account string) (err er
 	// account limit check
 	row := p.db.QueryRowContext(context.Background(),
 		`SELECT COUNT(1) AS cnt FROM faucet_records
-		WHERE ctime >= ? AND platform = ? AND account = ? AND state IN (?, ?, ?)`,
-		timeOfDayStart, platform, account, StateApplication, StateVerified, StateDispensed)
+		WHERE ctime >= ? AND platform = ? AND account = ? AND state IN (?, ?, ?, ?)`,
+		timeOfDayStart, platform, account, StateApplication, StateVerified, StateDispensing, StateDispensed)
 
 	var result uint
 
@@ -182,8 +223,8 @@ func (p *Persistence) checkAddressLimit(address string) (err error) {
 	// account limit check
 	row := p.db.QueryRowContext(context.Background(),
 		`SELECT COUNT(1) AS cnt FROM faucet_records
-		WHERE ctime >= ? AND address = ? AND state IN (?, ?, ?)`,
-		timeOfDayStart, address, StateApplication, StateVerified, StateDispensed)
+		WHERE ctime >= ? AND address = ? AND state IN (?, ?, ?, ?)`,
+		timeOfDayStart, address, StateApplication, StateVerified, StateDispensing, StateDispensed)
 
 	var result uint
 
@@ -204,18 +245,7 @@ func (p *Persistence) checkAddressLimit(address string) (err error) {
 }
 
 // enqueueApplication record a new token application to CovenantSQL database.
-func (p *Persistence) enqueueApplication(address string, mediaURL string) (applicationID string, err error) {
-	// resolve account name in address
-	var meta urlMeta
-	meta, err = extractPlatformInURL(mediaURL)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"address":  address,
-			"mediaURL": mediaURL,
-		}).Errorf("enqueue application with invalid url: %v", err)
-		return
-	}
-
+func (p *Persistence) enqueueApplication(address string, meta urlMeta, proof string) (applicationID string, err error) {
 	// check limits
 	if err = p.checkAccountLimit(meta.platform, meta.account); err != nil {
 		return
@@ -223,6 +253,9 @@ func (p *Persistence) enqueueApplication(address string, mediaURL string) (appli
 	if err = p.checkAddressLimit(address); err != nil {
 		return
 	}
+	if err = p.checkDailyBudget(p.tokenAmount); err != nil {
+		return
+	}
 
 	// generate uuid
 	applicationID = uuid.Must(uuid.NewV4()).String()
@@ -240,12 +273,13 @@ func (p *Persistence) enqueueApplication(address string, mediaURL string) (appli
 				reason,
 				ctime
 			  ) VALUES (?, ?, ?, ?, ?, ?, ?, '', CURRENT_TIMESTAMP)`,
-		applicationID, meta.platform, meta.account, mediaURL, address, StateApplication, p.tokenAmount)
+		applicationID, meta.platform, meta.account, proof, address, StateApplication, p.tokenAmount)
 
 	if err != nil {
 		log.WithFields(log.Fields{
 			"address":  address,
-			"mediaURL": mediaURL,
+			"platform": meta.platform,
+			"account":  meta.account,
 		}).Errorf("enqueue application failed: %v", err)
 
 		err = ErrEnqueueApplication
@@ -333,3 +367,160 @@ func (p *Persistence) updateRecord(record *applicationRecord) (err error) {
 
 	return
 }
+
+// checkDailyBudget checks if the daily dispense budget allows dispensing amount more tokens.
+func (p *Persistence) checkDailyBudget(amount int64) (err error) {
+	if p.dailyBudget <= 0 {
+		return
+	}
+
+	timeOfDayStart := time.Now().UTC().Format("2006-01-02 00:00:00")
+
+	row := p.db.QueryRowContext(context.Background(),
+		`SELECT COALESCE(SUM(amount), 0) FROM faucet_dispenses WHERE ctime >= ?`, timeOfDayStart)
+
+	var dispensed int64
+
+	if err = row.Scan(&dispensed); err != nil {
+		return
+	}
+
+	if dispensed+amount > p.dailyBudget {
+		log.WithFields(log.Fields{
+			"dispensed": dispensed,
+			"budget":    p.dailyBudget,
+		}).Warning("daily dispense budget exceeded")
+		return ErrDailyBudgetExceeded
+	}
+
+	return
+}
+
+// startDispense records the dispense transaction of a verified application record within the
+// daily budget and marks the record as dispensing, the transaction should be sent afterwards.
+func (p *Persistence) startDispense(r *applicationRecord, d *dispenseRecord) (err error) {
+	if err = p.checkDailyBudget(r.tokenAmount); err != nil {
+		return
+	}
+
+	// replace the dispense left by an interrupted start, the transaction is never sent
+	_, err = p.db.ExecContext(context.Background(),
+		`REPLACE INTO faucet_dispenses (
+				id,
+				nonce,
+				tx_hash,
+				amount,
+				attempts,
+				mtime,
+				ctime
+			  ) VALUES (?, ?, ?, ?, 0, 0, CURRENT_TIMESTAMP)`,
+		r.applicationID, int64(d.nonce), d.txHash, r.tokenAmount)
+	if err != nil {
+		return
+	}
+
+	r.state = StateDispensing
+
+	return p.updateRecord(r)
+}
+
+// getDispensing returns the unconfirmed dispenses in nonce order.
+func (p *Persistence) getDispensing() (records []*dispenseRecord, err error) {
+	return p.getDispenses(StateDispensing, "")
+}
+
+// getGivenUp returns the dispenses given up after max attempts, their transactions might still be
+// accepted by block producer.
+func (p *Persistence) getGivenUp() (records []*dispenseRecord, err error) {
+	return p.getDispenses(StateFailed, ErrDispenseFailed.Error())
+}
+
+func (p *Persistence) getDispenses(state State, reason string) (records []*dispenseRecord, err error) {
+	var rows *sql.Rows
+	if rows, err = p.db.QueryContext(context.Background(),
+		`SELECT r.rowid, r.id, r.address, r.amount, d.nonce, d.tx_hash, d.attempts, d.mtime
+		FROM faucet_records r JOIN faucet_dispenses d ON r.id = d.id
+		WHERE r.state = ? AND r.reason = ? ORDER BY d.nonce`, state, reason); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			d     = &dispenseRecord{}
+			nonce int64
+			mtime int64
+		)
+
+		if err = rows.Scan(&d.rowID, &d.applicationID, &d.address, &d.tokenAmount,
+			&nonce, &d.txHash, &d.attempts, &mtime); err != nil {
+			return
+		}
+
+		d.nonce = pi.AccountNonce(nonce)
+		if mtime > 0 {
+			d.mtime = time.Unix(0, mtime).UTC()
+		}
+		records = append(records, d)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// updateDispense updates the dispense transaction after it is resent or reassigned.
+func (p *Persistence) updateDispense(d *dispenseRecord) (err error) {
+	var mtime int64
+	if !d.mtime.IsZero() {
+		mtime = d.mtime.UnixNano()
+	}
+
+	_, err = p.db.ExecContext(context.Background(),
+		`UPDATE faucet_dispenses SET nonce = ?, tx_hash = ?, attempts = ?, mtime = ? WHERE id = ?`,
+		int64(d.nonce), d.txHash, d.attempts, mtime, d.applicationID)
+
+	return
+}
+
+// finishDispense marks the application record of the dispense as dispensed or failed with reason,
+// a given up dispense is marked as dispensed again if its transaction is confirmed later.
+func (p *Persistence) finishDispense(d *dispenseRecord, reason error) (err error) {
+	state := StateDispensed
+	failReason := ""
+	amount := d.tokenAmount
+	if reason != nil {
+		state = StateFailed
+		failReason = reason.Error()
+		// failed dispense should not be counted in budget
+		amount = 0
+	}
+
+	if _, err = p.db.ExecContext(context.Background(),
+		`UPDATE faucet_dispenses SET amount = ? WHERE id = ?`, amount, d.applicationID); err != nil {
+		return
+	}
+
+	_, err = p.db.ExecContext(context.Background(),
+		`UPDATE faucet_records SET state = ?, reason = ? WHERE rowid = ?`,
+		int(state), failReason, d.rowID)
+
+	return
+}
+
+// getMeta returns the integer value of name in faucet meta.
+func (p *Persistence) getMeta(name string) (value int64, err error) {
+	row := p.db.QueryRowContext(context.Background(),
+		`SELECT value FROM faucet_meta WHERE name = ?`, name)
+	if err = row.Scan(&value); err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// setMeta saves the integer value of name to faucet meta.
+func (p *Persistence) setMeta(name string, value int64) (err error) {
+	_, err = p.db.ExecContext(context.Background(),
+		`REPLACE INTO faucet_meta (name, value) VALUES (?, ?)`, name, value)
+	return
+}
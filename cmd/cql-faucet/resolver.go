@@ -22,9 +22,12 @@ import (
 )
 
 const (
-	platformFacebook = "facebook"
-	platformTwitter  = "twitter"
-	platformWeibo    = "weibo"
+	platformFacebook  = "facebook"
+	platformTwitter   = "twitter"
+	platformWeibo     = "weibo"
+	platformCaptcha   = "captcha"
+	platformEmail     = "email"
+	platformAllowList = "allowlist"
 )
 
 type urlMeta struct {
@@ -32,38 +35,31 @@ type urlMeta struct {
 	account  string
 }
 
-func extractPlatformInURL(mediaURL string) (meta urlMeta, err error) {
+// extractAccountInURL returns the account of media url if the url host contains one of hosts.
+func extractAccountInURL(mediaURL string, hosts []string) (account string, ok bool) {
 	if !strings.HasPrefix(mediaURL, "http") {
 		mediaURL = "http://" + mediaURL
 	}
 
 	u, err := url.Parse(mediaURL)
-	if strings.Contains(u.Hostname(), "facebook") {
-		// facebook
-		meta.platform = platformFacebook
-		pathSegs := strings.Split(u.Path, "/")
-		// account in first path seg
-		if len(pathSegs) >= 2 {
-			meta.account = pathSegs[1]
-		}
-	} else if strings.Contains(u.Hostname(), "twitter") {
-		// twitter
-		meta.platform = platformTwitter
-		pathSegs := strings.Split(u.Path, "/")
-		// account in first path seg
-		if len(pathSegs) >= 2 {
-			meta.account = pathSegs[1]
-		}
-	} else if strings.Contains(u.Hostname(), "weibo") {
-		// weibo
-		meta.platform = platformWeibo
-		pathSegs := strings.Split(u.Path, "/")
-		// account in first path seg
-		if len(pathSegs) >= 2 {
-			meta.account = pathSegs[1]
+	if err != nil {
+		return
+	}
+
+	for _, host := range hosts {
+		if strings.Contains(u.Hostname(), host) {
+			ok = true
+			break
 		}
-	} else {
-		err = ErrInvalidURL
+	}
+	if !ok {
+		return
+	}
+
+	pathSegs := strings.Split(u.Path, "/")
+	// account in first path seg
+	if len(pathSegs) >= 2 {
+		account = pathSegs[1]
 	}
 
 	return
@@ -17,10 +17,62 @@
 package main
 
 import (
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 )
 
+// chainClient defines the block producer apis used by faucet dispensing.
+type chainClient interface {
+	nextNonce(addr proto.AccountAddress) (pi.AccountNonce, error)
+	stableBalance(addr proto.AccountAddress) (uint64, error)
+	addTx(tx pi.Transaction) error
+	fetchBlock(count uint32) (*pt.Block, error)
+}
+
+// bpClient implements chainClient by calling the current block producer.
+type bpClient struct{}
+
+func (c *bpClient) nextNonce(addr proto.AccountAddress) (nonce pi.AccountNonce, err error) {
+	req := &bp.NextAccountNonceReq{Addr: addr}
+	resp := &bp.NextAccountNonceResp{}
+	if err = requestBP(route.MCCNextAccountNonce.String(), req, resp); err != nil {
+		return
+	}
+	return resp.Nonce, nil
+}
+
+func (c *bpClient) stableBalance(addr proto.AccountAddress) (balance uint64, err error) {
+	req := &bp.QueryAccountStableBalanceReq{Addr: addr}
+	resp := &bp.QueryAccountStableBalanceResp{}
+	if err = requestBP(route.MCCQueryAccountStableBalance.String(), req, resp); err != nil {
+		return
+	}
+	return resp.Balance, nil
+}
+
+func (c *bpClient) addTx(tx pi.Transaction) (err error) {
+	req := &bp.AddTxReq{Tx: tx}
+	resp := &bp.AddTxResp{}
+	return requestBP(route.MCCAddTx.String(), req, resp)
+}
+
+func (c *bpClient) fetchBlock(count uint32) (b *pt.Block, err error) {
+	req := &bp.FetchBlockByCountReq{Count: count}
+	resp := &bp.FetchBlockResp{}
+	if err = requestBP(route.MCCFetchBlockByCount.String(), req, resp); err != nil {
+		return
+	}
+	if resp.Block == nil {
+		err = ErrNilBlock
+		return
+	}
+	return resp.Block, nil
+}
+
 func requestBP(method string, req interface{}, resp interface{}) (err error) {
 	var bp proto.NodeID
 	if bp, err = rpc.GetCurrentBP(); err != nil {
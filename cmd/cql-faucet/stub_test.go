@@ -0,0 +1,137 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const stubSecret = "stub-secret"
+
+// verificationStub stands in for the social platforms and the token siteverify endpoint.
+type verificationStub struct {
+	*httptest.Server
+
+	sync.Mutex
+	posts  map[string]string // post path -> post content
+	links  map[string]string // short link path -> redirect target
+	tokens map[string]string // valid token -> bound account
+	status int               // status code of siteverify endpoint if not zero
+}
+
+func newVerificationStub() (s *verificationStub) {
+	s = &verificationStub{
+		posts:  make(map[string]string),
+		links:  make(map[string]string),
+		tokens: make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return
+}
+
+// addPost publishes a post on the stub and returns its url.
+func (s *verificationStub) addPost(path string, content string) string {
+	s.Lock()
+	defer s.Unlock()
+	s.posts[path] = content
+	return s.URL + path
+}
+
+// addLink registers a short link redirecting to target and returns the short link url.
+func (s *verificationStub) addLink(path string, target string) string {
+	s.Lock()
+	defer s.Unlock()
+	s.links[path] = target
+	return s.URL + path
+}
+
+// addToken registers a single use token, account is only checked if not empty.
+func (s *verificationStub) addToken(token string, account string) {
+	s.Lock()
+	defer s.Unlock()
+	s.tokens[token] = account
+}
+
+func (s *verificationStub) serve(rw http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.URL.Path == "/siteverify" {
+		s.siteVerify(rw, r)
+		return
+	}
+
+	if target, ok := s.links[r.URL.Path]; ok {
+		http.Redirect(rw, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	content, ok := s.posts[r.URL.Path]
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/weibo/") {
+		// weibo renders post as inline json data
+		text, _ := json.Marshal(content)
+		fmt.Fprintf(rw, "<script>var $render_data = [{\"status\": {\n\"text\": %s,\n\"id\": 1}}];</script>", text)
+		return
+	}
+
+	fmt.Fprintf(rw, "<html><head><meta property=\"og:description\" content=\"%s\" /></head></html>",
+		html.EscapeString(content))
+}
+
+// setStatus makes the siteverify endpoint respond with status code, the tokens are accepted.
+func (s *verificationStub) setStatus(status int) {
+	s.Lock()
+	defer s.Unlock()
+	s.status = status
+}
+
+func (s *verificationStub) siteVerify(rw http.ResponseWriter, r *http.Request) {
+	var result tokenVerifyResponse
+
+	if s.status != 0 {
+		rw.WriteHeader(s.status)
+		result.Success = true
+		json.NewEncoder(rw).Encode(&result)
+		return
+	}
+
+	account, ok := s.tokens[r.PostFormValue("response")]
+	switch {
+	case r.PostFormValue("secret") != stubSecret:
+		result.ErrorCodes = []string{"invalid-input-secret"}
+	case !ok:
+		result.ErrorCodes = []string{"invalid-input-response"}
+	case account != "" && account != r.PostFormValue("account"):
+		result.ErrorCodes = []string{"invalid-account"}
+	default:
+		delete(s.tokens, r.PostFormValue("response"))
+		result.Success = true
+	}
+
+	json.NewEncoder(rw).Encode(&result)
+}
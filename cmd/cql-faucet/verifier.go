@@ -27,14 +27,11 @@ import (
 	"sync"
 	"time"
 
-	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
-	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
-	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/CovenantSQL/xurls"
 	"github.com/dyatlov/go-opengraph/opengraph"
@@ -58,19 +55,24 @@ const (
 	retryTime            = time.Second
 	verificationPerRound = 100
 	dispensePerRound     = 100
+	dispenseMaxAttempts  = 10
+	confirmPerRound      = 100
 )
 
 // Verifier defines the social media post content verifier.
 type Verifier struct {
 	// settings
-	interval        time.Duration
-	lastVerified    int64
-	lastDispensed   int64
-	contentRequired []string
-	urlRequired     string
-	vaultAddress    proto.AccountAddress
-	privateKey      *asymmetric.PrivateKey
-	publicKey       *asymmetric.PublicKey
+	interval     time.Duration
+	lastVerified map[string]int64
+	backends     []VerificationBackend
+	vaultAddress proto.AccountAddress
+	signer       kms.Signer
+	publicKey    *asymmetric.PublicKey
+
+	// dispensing
+	bp          chainClient
+	batchSize   int
+	maxAttempts int
 
 	// persistence
 	p *Persistence
@@ -81,20 +83,24 @@ type Verifier struct {
 // NewVerifier returns a new verifier instance.
 func NewVerifier(cfg *Config, p *Persistence) (v *Verifier, err error) {
 	v = &Verifier{
-		interval:        cfg.VerificationInterval,
-		lastVerified:    0,
-		lastDispensed:   0,
-		contentRequired: cfg.ContentRequired,
-		urlRequired:     cfg.URLRequired,
-		p:               p,
-		stopCh:          make(chan struct{}),
+		interval:     cfg.VerificationInterval,
+		lastVerified: make(map[string]int64),
+		bp:           &bpClient{},
+		batchSize:    cfg.DispenseBatchSize,
+		maxAttempts:  cfg.DispenseMaxAttempts,
+		p:            p,
+		stopCh:       make(chan struct{}),
+	}
+
+	if v.backends, err = newVerificationBackends(cfg); err != nil {
+		return
 	}
 
 	if v.publicKey, err = kms.GetLocalPublicKey(); err != nil {
 		return
 	}
 
-	if v.privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	if v.signer, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -116,7 +122,9 @@ func (v *Verifier) run() {
 		v.verify()
 
 		// dispense
-		v.dispense()
+		if err := v.dispense(); err != nil {
+			log.Warningf("dispense applications failed: %v", err)
+		}
 
 		log.Infof("end verification iteration")
 
@@ -137,166 +145,49 @@ func (v *Verifier) stop() {
 }
 
 func (v *Verifier) verify() {
-	wg := &sync.WaitGroup{}
-	ch := make(chan int64, 3)
-	runTask := func(wg *sync.WaitGroup, ch chan int64, f func() (int64, error)) {
-		defer wg.Done()
-		verified, err := f()
-		if err != nil {
-			log.Warningf("verify applications failed: %v", err)
-			ch <- verified
-		}
+	type result struct {
+		platform string
+		verified int64
 	}
 
-	wg.Add(1)
-	go runTask(wg, ch, v.verifyFacebook)
-	wg.Add(1)
-	go runTask(wg, ch, v.verifyTwitter)
-	wg.Add(1)
-	go runTask(wg, ch, v.verifyWeibo)
+	wg := &sync.WaitGroup{}
+	ch := make(chan result, len(v.backends))
+
+	for _, b := range v.backends {
+		wg.Add(1)
+		go func(b VerificationBackend, lastVerified int64) {
+			defer wg.Done()
+			verified, err := v.verifyBackend(b, lastVerified)
+			if err != nil {
+				log.Warningf("verify %v applications failed: %v", b.Name(), err)
+			}
+			ch <- result{platform: b.Name(), verified: verified}
+		}(b, v.lastVerified[b.Name()])
+	}
 
 	wg.Wait()
 	close(ch)
 
-	for verified := range ch {
-		if verified >= v.lastVerified {
-			v.lastVerified = verified
+	for r := range ch {
+		if r.verified > v.lastVerified[r.platform] {
+			v.lastVerified[r.platform] = r.verified
 		}
 	}
 }
 
-func (v *Verifier) verifyFacebook() (verified int64, err error) {
-	var records []*applicationRecord
-	if records, err = v.p.getRecords(v.lastVerified, platformFacebook, StateApplication, verificationPerRound); err != nil {
-		return
-	}
-
-	// check records
-	return v.doVerify(records, verifyFacebook)
-}
-
-func (v *Verifier) verifyTwitter() (verified int64, err error) {
-	var records []*applicationRecord
-	if records, err = v.p.getRecords(v.lastVerified, platformTwitter, StateApplication, verificationPerRound); err != nil {
-		return
-	}
-
-	// check records
-	return v.doVerify(records, verifyTwitter)
-}
-
-func (v *Verifier) verifyWeibo() (verified int64, err error) {
+func (v *Verifier) verifyBackend(b VerificationBackend, lastVerified int64) (verified int64, err error) {
 	var records []*applicationRecord
-	if records, err = v.p.getRecords(v.lastVerified, platformWeibo, StateApplication, verificationPerRound); err != nil {
+	if records, err = v.p.getRecords(lastVerified, b.Name(), StateApplication, verificationPerRound); err != nil {
 		return
 	}
 
 	// check records
-	return v.doVerify(records, verifyWeibo)
-}
-
-func (v *Verifier) dispense() (err error) {
-	var records []*applicationRecord
-	if records, err = v.p.getRecords(v.lastDispensed, "", StateVerified, dispensePerRound); err != nil {
-		return
-	}
-
-	// dispense
-	for _, record := range records {
-		if err = v.dispenseOne(record); err != nil {
-			return
-		}
-	}
-
-	return
-}
-
-func (v *Verifier) dispenseOne(r *applicationRecord) (err error) {
-	balanceReq := &bp.QueryAccountStableBalanceReq{}
-	balanceRes := &bp.QueryAccountStableBalanceResp{}
-	balanceReq.Addr = v.vaultAddress
-
-	// get current balance
-	if err = requestBP(route.MCCQueryAccountStableBalance.String(), balanceReq, balanceRes); err != nil {
-		log.Warningf("get account balance failed: %v", err)
-	} else {
-		log.Infof("get account balance success, balance: %v", balanceRes.Balance)
-	}
-
-	// allocate nonce
-	nonceReq := &bp.NextAccountNonceReq{}
-	nonceResp := &bp.NextAccountNonceResp{}
-	nonceReq.Addr = v.vaultAddress
-
-	if err = requestBP(route.MCCNextAccountNonce.String(), nonceReq, nonceResp); err != nil {
-		// allocate nonce failed
-		log.Warningf("allocate nonce for transaction failed: %v", err)
-		return
-	}
-
-	// decode target account address
-	var targetAddress proto.AccountAddress
-	var addrVersion byte
-	if addrVersion, targetAddress, err = crypto.Addr2Hash(r.address); err != nil || addrVersion != crypto.TestNet {
-		if err == nil && addrVersion != crypto.TestNet {
-			err = ErrInvalidAddress
-		}
-
-		// log error
-		log.Warningf("decode transfer target address failed: %v", err)
-
-		// mark failed
-		r.failReason = err.Error()
-		r.state = StateFailed
-		if err = v.p.updateRecord(r); err != nil {
-			return
-		}
-
-		log.WithFields(log.Fields(r.asMap())).Infof("dispensed application record failed")
-
-		// skip invalid address faucet application
-		err = nil
-		return
-	}
-
-	req := &bp.AddTxReq{}
-	resp := &bp.AddTxResp{}
-	req.Tx = pt.NewTransfer(
-		&pt.TransferHeader{
-			Sender:   v.vaultAddress,
-			Receiver: targetAddress,
-			Nonce:    nonceResp.Nonce,
-			Amount:   uint64(r.tokenAmount),
-		},
-	)
-	if err = req.Tx.Sign(v.privateKey); err != nil {
-		// sign failed?
-		return
-	}
-
-	if err = requestBP(route.MCCAddTx.String(), req, resp); err != nil {
-		// add transaction failed, try again
-		log.Warningf("send transaction failed: %v", err)
-
-		return
-	}
-
-	// save dispense result
-	r.state = StateDispensed
-
-	if err = v.p.updateRecord(r); err != nil {
-		// failed
-		return
-	}
-
-	log.WithFields(log.Fields(r.asMap())).Infof("dispensed application record")
-
-	return
+	return v.doVerify(records, b)
 }
 
-func (v *Verifier) doVerify(records []*applicationRecord, verifyFunc func(string, []string, string) error) (verified int64, err error) {
+func (v *Verifier) doVerify(records []*applicationRecord, b VerificationBackend) (verified int64, err error) {
 	for _, r := range records {
-		if err = verifyFunc(r.mediaURL, v.contentRequired, v.urlRequired); err != nil {
+		if err = b.Verify(r); err != nil {
 			r.failReason = err.Error()
 			r.state = StateFailed
 		} else {
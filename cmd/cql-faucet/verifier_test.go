@@ -24,45 +24,64 @@ import (
 
 func TestVerifyFacebook(t *testing.T) {
 	Convey("", t, func() {
+		stub := newVerificationStub()
+		defer stub.Close()
+		post1 := stub.addPost("/facebook/hupili/posts/1700877176661446",
+			"Initium Media reports https://github.com/initiumlab/beijinguprooted")
+		post2 := stub.addPost("/facebook/dualipaofficial/posts/1832797603472815",
+			"ELECTRICITY out now http://smarturl.it/SilkCityElectricity/youtube")
+
 		var err error
-		err = verifyFacebook("https://www.facebook.com/hupili/posts/1700877176661446",
+		err = verifyFacebook(post1,
 			[]string{"xxx", "Initium Media"}, "https://github.com/initiumlab/beijinguprooted")
 		So(err, ShouldBeNil)
-		err = verifyFacebook("facebook.com/dualipaofficial/posts/1832797603472815",
+		err = verifyFacebook(post2,
 			[]string{"xxx", "ELECTRICITY"}, "http://www.baidu.com")
-		So(err, ShouldNotBeNil)
-		err = verifyFacebook("facebook.com/dualipaofficial/posts/1832797603472815",
+		So(err, ShouldEqual, ErrRequiredURLNotExists)
+		err = verifyFacebook(post2,
 			[]string{"xxx", "哈哈"}, "http://smarturl.it/SilkCityElectricity/youtube")
-		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ErrRequiredContentNotExists)
 	})
 }
 
 func TestVerifyTwitter(t *testing.T) {
 	Convey("", t, func() {
+		stub := newVerificationStub()
+		defer stub.Close()
+		link1 := stub.addLink("/t.co/qdaily", "http://m.qdaily.com/mobile/articles/57143.html")
+		link2 := stub.addLink("/t.co/alibaba", "https://www.alibabagroup.com/cn/news/article")
+		post1 := stub.addPost("/twitter/tualatrix/status/1040460103898394624", "好奇心日报 "+link1)
+		post2 := stub.addPost("/twitter/Fenng/status/1040487918995791873", "阿里巴巴 "+link2)
+
 		var err error
-		err = verifyTwitter("https://twitter.com/tualatrix/status/1040460103898394624",
+		err = verifyTwitter(post1,
 			[]string{"xxx", "好奇心日报"}, "http://m.qdaily.com")
 		So(err, ShouldBeNil)
-		err = verifyTwitter("https://twitter.com/Fenng/status/1040487918995791873",
+		err = verifyTwitter(post2,
 			[]string{"xxx", "阿里巴巴"}, "http://www.baidu.com")
-		So(err, ShouldNotBeNil)
-		err = verifyTwitter("https://twitter.com/Fenng/status/1040487918995791873",
+		So(err, ShouldEqual, ErrRequiredURLNotExists)
+		err = verifyTwitter(post2,
 			[]string{"xxx", "百度"}, "https://twitter.com")
-		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ErrRequiredContentNotExists)
 	})
 }
 
 func TestVerifyWeibo(t *testing.T) {
 	Convey("", t, func() {
+		stub := newVerificationStub()
+		defer stub.Close()
+		post1 := stub.addPost("/weibo/2104296457/GzhcXuPNB", "Mavic 2 https://www.chiphell.com/thread-1")
+		post2 := stub.addPost("/weibo/2104296457/Gz8vO2gOc", "卡西欧 https://www.chiphell.com/thread-2")
+
 		var err error
-		err = verifyWeibo("https://weibo.com/2104296457/GzhcXuPNB",
+		err = verifyWeibo(post1,
 			[]string{"xxx", "Mavic"}, "https://www.chiphell.com")
 		So(err, ShouldBeNil)
-		err = verifyWeibo("https://weibo.com/2104296457/Gz8vO2gOc",
+		err = verifyWeibo(post2,
 			[]string{"xxx", "卡西欧"}, "http://www.baidu.com")
-		So(err, ShouldNotBeNil)
-		err = verifyWeibo("https://weibo.com/2104296457/Gz8vO2gOc",
+		So(err, ShouldEqual, ErrRequiredURLNotExists)
+		err = verifyWeibo(post2,
 			[]string{"xxx", "哈哈"}, "https://www.chiphell.com")
-		So(err, ShouldNotBeNil)
+		So(err, ShouldEqual, ErrRequiredContentNotExists)
 	})
 }
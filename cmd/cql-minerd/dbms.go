@@ -65,12 +65,12 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 		// in test mode
 
 		var pubKey *asymmetric.PublicKey
-		var privKey *asymmetric.PrivateKey
+		var signer kms.Signer
 
 		if pubKey, err = kms.GetLocalPublicKey(); err != nil {
 			return
 		}
-		if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		if signer, err = kms.GetLocalSigner(); err != nil {
 			return
 		}
 
@@ -101,7 +101,7 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 				PubKey: pubKey,
 			}
 
-			if err = dbPeers.Sign(privKey); err != nil {
+			if err = dbPeers.Sign(signer); err != nil {
 				return
 			}
 
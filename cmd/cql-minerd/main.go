@@ -35,6 +35,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/CovenantSQL/CovenantSQL/worker"
@@ -73,6 +74,13 @@ var (
 	memProfile    string
 	profileServer string
 
+	// metric
+	metricWeb string
+
+	// trace
+	traceCollector  string
+	traceSampleRate float64
+
 	// other
 	noLogo      bool
 	showVersion bool
@@ -94,6 +102,12 @@ func init() {
 	flag.StringVar(&cpuProfile, "cpu-profile", "", "Path to file for CPU profiling information")
 	flag.StringVar(&memProfile, "mem-profile", "", "Path to file for memory profiling information")
 
+	flag.StringVar(&metricWeb, "metric-web", "", "Address to listen for prometheus metrics, default not started")
+
+	flag.StringVar(&traceCollector, "trace-collector", "",
+		"OTLP/HTTP traces endpoint, e.g. http://127.0.0.1:4318/v1/traces, default not traced")
+	flag.Float64Var(&traceSampleRate, "trace-sample-rate", 1.0, "Probability of sampling a new trace")
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "\n%s\n\n", desc)
 		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n", name)
@@ -176,6 +190,19 @@ func main() {
 		}()
 	}
 
+	if len(metricWeb) > 0 {
+		if _, err = metric.StartMetricWeb(metricWeb); err != nil {
+			log.Fatalf("start metric web server on %s failed: %v", metricWeb, err)
+		}
+	}
+
+	if len(traceCollector) > 0 {
+		trace.SetSampleRate(traceSampleRate)
+		exporter := trace.NewOTLPExporter(traceCollector, "cql-minerd")
+		trace.RegisterExporter(exporter)
+		defer exporter.Stop()
+	}
+
 	// start metric collector
 	go func() {
 		mc := metric.NewCollectClient()
@@ -0,0 +1,352 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/CovenantSQL/go-sqlite3-encrypt"
+	my "github.com/siddontang/go-mysql/mysql"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuery(t *testing.T) {
+	Convey("split statements", t, func() {
+		So(splitStatements("SELECT 1; SELECT ';'; # c;\nSELECT `a;b` /* ; */"), ShouldResemble, []string{
+			"SELECT 1",
+			"SELECT ';'",
+			"# c;\nSELECT `a;b` /* ; */",
+		})
+		So(splitStatements("SELECT 'it\\'s;'"), ShouldResemble, []string{"SELECT 'it\\'s;'"})
+		So(splitStatements(" ; ;"), ShouldBeEmpty)
+	})
+	Convey("count params", t, func() {
+		So(countParams("SELECT * FROM t WHERE a = ? AND b = '?' AND `?` = ? -- ?\n"), ShouldEqual, 2)
+		So(countParams("INSERT INTO t VALUES (?, ?, \"?\") /* ? */"), ShouldEqual, 2)
+	})
+	Convey("detect column types", t, func() {
+		So(detectColumnType("INTEGER"), ShouldEqual, my.MYSQL_TYPE_LONGLONG)
+		So(detectColumnType("varchar(20)"), ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+		So(detectColumnType("DATETIME"), ShouldEqual, my.MYSQL_TYPE_DATETIME)
+		So(detectColumnType("BOOLEAN"), ShouldEqual, my.MYSQL_TYPE_TINY)
+		So(detectColumnType(""), ShouldEqual, 0)
+		So(inferColumnType([][]interface{}{{nil}, {int64(1)}, {1.5}}, 0), ShouldEqual, my.MYSQL_TYPE_DOUBLE)
+		So(inferColumnType([][]interface{}{{int64(1)}, {"a"}}, 0), ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+	})
+	Convey("encode result set", t, func() {
+		values := [][]interface{}{{int64(1), 1.5, "2018-01-02 03:04:05", nil}}
+
+		rs, err := buildResultset("db", []string{"a", "b", "c", "d"},
+			[]string{"INT", "REAL", "DATETIME", "TEXT"}, values, false)
+		So(err, ShouldBeNil)
+		So(rs.Fields[2].Type, ShouldEqual, my.MYSQL_TYPE_DATETIME)
+		So(string(rs.RowDatas[0]), ShouldEqual, "\x011\x031.5\x132018-01-02 03:04:05\xfb")
+
+		rs, err = buildResultset("db", []string{"a", "b", "c", "d"},
+			[]string{"INT", "REAL", "DATETIME", "TEXT"}, values, true)
+		So(err, ShouldBeNil)
+		row := rs.RowDatas[0]
+		// header and null bitmap with the 4th column set
+		So(row[0], ShouldEqual, 0)
+		So(row[1], ShouldEqual, 1<<5)
+		So(binary.LittleEndian.Uint64(row[2:]), ShouldEqual, 1)
+		So(math.Float64frombits(binary.LittleEndian.Uint64(row[10:])), ShouldEqual, 1.5)
+		So([]byte(row[18:]), ShouldResemble, []byte{7, 0xe2, 0x07, 1, 2, 3, 4, 5})
+
+		// invalid values are sent as strings
+		rs, err = buildResultset("db", []string{"a"}, []string{"INT"}, [][]interface{}{{"abc"}}, true)
+		So(err, ShouldBeNil)
+		So(rs.Fields[0].Type, ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+		So(string(rs.RowDatas[0][2:]), ShouldEqual, "\x03abc")
+	})
+}
+
+func TestDialect(t *testing.T) {
+	Convey("translate mysql dialect", t, func() {
+		tq, err := translateQuery("CREATE TABLE IF NOT EXISTS `users` ("+
+			"`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, "+
+			"`name` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT \"x\", "+
+			"`created_at` datetime(3) DEFAULT CURRENT_TIMESTAMP(3), "+
+			"PRIMARY KEY (`id`), KEY `idx_name` (`name`(10)), UNIQUE KEY (`created_at`)"+
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", nil)
+		So(err, ShouldBeNil)
+		So(tq.ifNotExists, ShouldEqual, "users")
+		So(tq.query, ShouldEqual, "CREATE TABLE IF NOT EXISTS `users`(`id` INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "+
+			"`name` varchar(255) COLLATE NOCASE DEFAULT 'x', `created_at` datetime(3) DEFAULT CURRENT_TIMESTAMP); "+
+			"CREATE INDEX `idx_name` ON `users`(`name`); "+
+			"CREATE UNIQUE INDEX `users_created_at` ON `users`(`created_at`)")
+
+		tq, err = translateQuery("ALTER TABLE `users` ADD COLUMN `age` int NOT NULL DEFAULT 0 AFTER `name`, "+
+			"ADD INDEX `idx_age` (`age`)", nil)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "ALTER TABLE `users` ADD COLUMN `age` int NOT NULL DEFAULT 0; "+
+			"CREATE INDEX `idx_age` ON `users`(`age`)")
+		_, err = translateQuery("ALTER TABLE users MODIFY name text", nil)
+		So(err, ShouldNotBeNil)
+
+		users := &tableInfo{
+			name: "users",
+			columns: []*columnInfo{
+				{name: "id", declType: "INTEGER", pk: 1},
+				{name: "name", declType: "TEXT"},
+				{name: "age", declType: "INTEGER"},
+			},
+		}
+		logs := &tableInfo{
+			name: "logs",
+			columns: []*columnInfo{
+				{name: "k", declType: "TEXT"},
+				{name: "v", declType: "TEXT"},
+				{name: "n", declType: "INTEGER"},
+			},
+			indexes: []*indexInfo{{name: "idx_k", unique: true, columns: []string{"k"}}},
+		}
+		lookup := func(table string) (*tableInfo, error) {
+			switch table {
+			case "users":
+				return users, nil
+			case "logs":
+				return logs, nil
+			}
+			return nil, nil
+		}
+
+		tq, err = translateQuery("INSERT INTO users (id, name) VALUES (1, 'a') "+
+			"ON DUPLICATE KEY UPDATE name = VALUES(name), `age` = age + 1", lookup)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "INSERT INTO users (id, name) VALUES (1, 'a') "+
+			"ON CONFLICT(`id`) DO UPDATE SET `name` = excluded.`name`, `age` = age + 1")
+		tq, err = translateQuery("INSERT IGNORE INTO `logs` VALUES ('a', 'b', 1) "+
+			"ON DUPLICATE KEY UPDATE n = n + VALUES(n)", lookup)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "INSERT INTO `logs` VALUES ('a', 'b', 1) "+
+			"ON CONFLICT(`k`) DO UPDATE SET `n` = n + excluded.`n`")
+		tq, err = translateQuery("INSERT IGNORE INTO users (id, name) VALUES (1, 'a')", lookup)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "INSERT OR IGNORE INTO users (id, name) VALUES (1, 'a')")
+
+		// replacement is only allowed if the assignments cover every inserted non-key column
+		tq, err = translateQuery("INSERT INTO users (id, name) VALUES (1, 'a') "+
+			"ON DUPLICATE KEY UPDATE id = VALUES(id), name = VALUES(name)", nil)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "INSERT OR REPLACE INTO users (id, name) VALUES (1, 'a')")
+		_, err = translateQuery("INSERT INTO users (id, name) VALUES (1, 'a') "+
+			"ON DUPLICATE KEY UPDATE id = VALUES(id), name = 'b'", nil)
+		So(err, ShouldNotBeNil)
+		_, err = translateQuery("INSERT INTO users (id, name) VALUES (1, 'a') "+
+			"ON DUPLICATE KEY UPDATE name = VALUES(name)", nil)
+		So(err, ShouldNotBeNil)
+		_, err = translateQuery("INSERT INTO users (id, name, age) SELECT id, name, age FROM others "+
+			"ON DUPLICATE KEY UPDATE name = VALUES(name)", lookup)
+		So(err, ShouldNotBeNil)
+		_, err = translateQuery("INSERT INTO users VALUES (1, 'a', 2) "+
+			"ON DUPLICATE KEY UPDATE name = VALUES(name)", nil)
+		So(err, ShouldNotBeNil)
+		tq, err = translateQuery("INSERT INTO users (id, name, age) SELECT id, name, age FROM others "+
+			"ON DUPLICATE KEY UPDATE name = VALUES(name), age = VALUES(age)", lookup)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "INSERT OR REPLACE INTO users (id, name, age) SELECT id, name, age FROM others")
+
+		tq, err = translateQuery("TRUNCATE TABLE `users`", nil)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "DELETE FROM `users`")
+		tq, err = translateQuery("DROP INDEX idx_age ON users", nil)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "DROP INDEX idx_age")
+		tq, err = translateQuery("SELECT * FROM users WHERE name = \"it's\" LIMIT 1, 2 FOR UPDATE", nil)
+		So(err, ShouldBeNil)
+		So(tq.query, ShouldEqual, "SELECT * FROM users WHERE name = 'it''s' LIMIT 1, 2")
+	})
+	Convey("emulate catalog", t, func() {
+		So(isCatalogQuery("SHOW FULL TABLES FROM `test` LIKE 'a%'"), ShouldBeTrue)
+		So(isCatalogQuery("SELECT * FROM `INFORMATION_SCHEMA`.`columns`"), ShouldBeTrue)
+		So(isCatalogQuery("SELECT * FROM t"), ShouldBeFalse)
+
+		q, ok := translateShowQuery("SHOW COLUMNS FROM `test`.`users` LIKE \"n%\"", "test")
+		So(ok, ShouldBeTrue)
+		So(q, ShouldContainSubstring, "WHERE TABLE_NAME = 'users' AND COLUMN_NAME LIKE 'n%'")
+
+		idx := parseIndexSQL("idx", "CREATE UNIQUE INDEX `idx` ON `users`(`name`, `age` DESC)")
+		So(idx.unique, ShouldBeTrue)
+		So(idx.columns, ShouldResemble, []string{"name", "age"})
+
+		dataType, columnType, charLength, _, _ := mysqlColumnType("varchar(20)")
+		So(dataType, ShouldEqual, "varchar")
+		So(columnType, ShouldEqual, "varchar(20)")
+		So(charLength, ShouldEqual, 20)
+
+		c := NewCursor(&Server{})
+		catalogDB, err := c.buildCatalog(nil, "test", map[string]bool{"SCHEMATA": true})
+		So(err, ShouldBeNil)
+		defer catalogDB.Close()
+
+		table := &tableInfo{
+			name: "users",
+			columns: []*columnInfo{
+				{name: "id", declType: "INTEGER", pk: 1},
+				{name: "name", declType: "varchar(255)", notNull: true, defaultValue: "'x'"},
+			},
+			indexes: []*indexInfo{{name: "idx_name", unique: true, columns: []string{"name"}}},
+		}
+		So(fillCatalog(catalogDB, "test", table), ShouldBeNil)
+
+		var key, extra string
+		var def sql.NullString
+		err = catalogDB.QueryRow("SELECT COLUMN_KEY, EXTRA, COLUMN_DEFAULT FROM information_schema.COLUMNS "+
+			"WHERE COLUMN_NAME = 'id'").Scan(&key, &extra, &def)
+		So(err, ShouldBeNil)
+		So(key, ShouldEqual, "PRI")
+		So(extra, ShouldEqual, "auto_increment")
+		So(def.Valid, ShouldBeFalse)
+		err = catalogDB.QueryRow("SELECT COLUMN_KEY, EXTRA, COLUMN_DEFAULT FROM information_schema.COLUMNS "+
+			"WHERE COLUMN_NAME = 'name'").Scan(&key, &extra, &def)
+		So(err, ShouldBeNil)
+		So(key, ShouldEqual, "UNI")
+		So(def.String, ShouldEqual, "x")
+
+		var count int
+		err = catalogDB.QueryRow("SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_NAME = 'users'").
+			Scan(&count)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+	})
+}
+
+func TestCursor(t *testing.T) {
+	Convey("test cursor with prepared statements and transactions", t, func() {
+		dir, err := ioutil.TempDir("", "mysql_adapter")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db3"))
+		So(err, ShouldBeNil)
+
+		c := NewCursor(&Server{mysqlUser: "root"})
+		c.curDB = "test"
+		c.curDBInstance = db
+		defer c.Close()
+
+		r, err := c.HandleQuery("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO t VALUES (1, 'a')")
+		So(err, ShouldBeNil)
+		So(r.AffectedRows, ShouldEqual, 1)
+
+		r, err = c.HandleQuery("SELECT USER()")
+		So(err, ShouldBeNil)
+		So(string(r.RowDatas[0]), ShouldEqual, "\x04root")
+
+		params, columns, ctx, err := c.HandleStmtPrepare("SELECT id, name FROM t WHERE id = ?")
+		So(err, ShouldBeNil)
+		So(params, ShouldEqual, 1)
+		So(columns, ShouldEqual, 2)
+
+		_, _, ctx2, err := c.HandleStmtPrepare("SELECT id, name FROM t WHERE id = ?")
+		So(err, ShouldBeNil)
+		So(ctx2, ShouldEqual, ctx)
+
+		r, err = c.HandleStmtExecute(ctx, "", []interface{}{int64(1)})
+		So(err, ShouldBeNil)
+		So(r.Fields[0].Type, ShouldEqual, my.MYSQL_TYPE_LONGLONG)
+		So(r.Fields[1].Type, ShouldEqual, my.MYSQL_TYPE_VAR_STRING)
+		So(r.RowDatas, ShouldHaveLength, 1)
+		So(string(r.RowDatas[0][10:]), ShouldEqual, "\x01a")
+
+		_, _, _, err = c.HandleStmtPrepare("SELECT 1; SELECT 2")
+		So(err, ShouldNotBeNil)
+
+		Convey("mysql dialect", func() {
+			_, err = c.HandleQuery("CREATE TABLE IF NOT EXISTS `users` (`id` int(11) NOT NULL AUTO_INCREMENT, " +
+				"`name` varchar(32), PRIMARY KEY (`id`), KEY `idx_name` (`name`)) ENGINE=InnoDB")
+			So(err, ShouldBeNil)
+			// created table is skipped
+			_, err = c.HandleQuery("CREATE TABLE IF NOT EXISTS `users` (`id` int(11), KEY `idx_name` (`id`))")
+			So(err, ShouldBeNil)
+
+			r, err = c.HandleQuery("SHOW FULL TABLES")
+			So(err, ShouldBeNil)
+			So(r.Fields[0].Name, ShouldResemble, []byte("Tables_in_test"))
+			So(r.RowDatas, ShouldHaveLength, 2)
+			So(string(r.RowDatas[0]), ShouldEqual, "\x01t\nBASE TABLE")
+
+			r, err = c.HandleQuery("SELECT table_name FROM information_schema.tables " +
+				"WHERE table_schema = DATABASE() AND table_name = \"users\"")
+			So(err, ShouldBeNil)
+			So(r.RowDatas, ShouldHaveLength, 1)
+
+			_, columns, _, err = c.HandleStmtPrepare("SELECT * FROM information_schema.tables WHERE table_name = ?")
+			So(err, ShouldBeNil)
+			So(columns, ShouldEqual, 12)
+
+			r, err = c.HandleQuery("SHOW CREATE TABLE `users`")
+			So(err, ShouldBeNil)
+			So(string(r.RowDatas[0]), ShouldStartWith, "\x05users")
+			_, err = c.HandleQuery("SHOW CREATE TABLE `missing`")
+			So(err, ShouldNotBeNil)
+
+			r, err = c.HandleQuery("INSERT INTO users (name) VALUES ('a'); " +
+				"INSERT IGNORE INTO users (id, name) VALUES (1, 'c')")
+			So(err, ShouldBeNil)
+
+			// the upsert translation is run by sqlite
+			tq, err := translateQuery("INSERT INTO users (id, name) VALUES (1, 'b') "+
+				"ON DUPLICATE KEY UPDATE name = VALUES(name)", func(table string) (*tableInfo, error) {
+				return &tableInfo{name: table, columns: []*columnInfo{{name: "id", pk: 1}, {name: "name"}}}, nil
+			})
+			So(err, ShouldBeNil)
+			_, err = db.Exec(tq.query)
+			So(err, ShouldBeNil)
+
+			r, err = c.HandleQuery("SELECT name FROM users LIMIT 0, 10")
+			So(err, ShouldBeNil)
+			So(r.RowDatas, ShouldHaveLength, 1)
+			So(string(r.RowDatas[0]), ShouldEqual, "\x01b")
+		})
+
+		Convey("transaction", func() {
+			r, err = c.HandleQuery("BEGIN")
+			So(err, ShouldBeNil)
+			So(r.Status&my.SERVER_STATUS_IN_TRANS, ShouldNotEqual, 0)
+
+			_, _, ctx, err = c.HandleStmtPrepare("INSERT INTO t VALUES (?, ?)")
+			So(err, ShouldBeNil)
+			_, err = c.HandleStmtExecute(ctx, "", []interface{}{int64(2), []byte("b")})
+			So(err, ShouldBeNil)
+
+			So(c.UseDB("other"), ShouldNotBeNil)
+
+			r, err = c.HandleQuery("ROLLBACK")
+			So(err, ShouldBeNil)
+			So(r.Status&my.SERVER_STATUS_IN_TRANS, ShouldEqual, 0)
+
+			r, err = c.HandleQuery("SELECT count(*) AS cnt FROM t")
+			So(err, ShouldBeNil)
+			So(string(r.RowDatas[0]), ShouldEqual, "\x011")
+
+			_, err = c.HandleQuery("START TRANSACTION; INSERT INTO t VALUES (3, 'c'); COMMIT")
+			So(err, ShouldBeNil)
+
+			r, err = c.HandleQuery("SELECT name FROM t WHERE name = 'c'")
+			So(err, ShouldBeNil)
+			So(r.RowDatas, ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,593 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	my "github.com/siddontang/go-mysql/mysql"
+)
+
+const (
+	// catalogSchema defines the attached schema name of emulated catalog tables.
+	catalogSchema = "information_schema"
+	// catalogCharset defines the charset reported in emulated catalog.
+	catalogCharset = "utf8mb4"
+	// catalogCollation defines the collation reported in emulated catalog.
+	catalogCollation = "utf8mb4_general_ci"
+)
+
+const identPattern = "((?:`[^`]+`|\\w+)(?:\\.(?:`[^`]+`|\\w+))?)"
+
+var (
+	catalogTableRef    = regexp.MustCompile("(?i)`?information_schema`?\\s*\\.\\s*`?(\\w+)`?")
+	currentSchemaFunc  = regexp.MustCompile("(?i)\\b(?:DATABASE|SCHEMA)\\s*\\(\\s*\\)")
+	showTablesQuery    = regexp.MustCompile("^(?is)\\s*SHOW\\s+(FULL\\s+)?TABLES(?:\\s+(?:FROM|IN)\\s+" + identPattern + ")?(?:\\s+(LIKE|WHERE)\\s+(.+?))?\\s*$")
+	showColumnsQuery   = regexp.MustCompile("^(?is)\\s*SHOW\\s+(FULL\\s+)?(?:COLUMNS|FIELDS)\\s+(?:FROM|IN)\\s+" + identPattern + "(?:\\s+(?:FROM|IN)\\s+" + identPattern + ")?(?:\\s+(LIKE|WHERE)\\s+(.+?))?\\s*$")
+	showIndexQuery     = regexp.MustCompile("^(?is)\\s*SHOW\\s+(?:INDEX|INDEXES|KEYS)\\s+(?:FROM|IN)\\s+" + identPattern + "(?:\\s+(?:FROM|IN)\\s+" + identPattern + ")?(?:\\s+WHERE\\s+(.+?))?\\s*$")
+	showCreateTableSQL = regexp.MustCompile("^(?is)\\s*SHOW\\s+CREATE\\s+TABLE\\s+" + identPattern + "\\s*$")
+
+	// catalogTables defines the emulated information_schema tables.
+	catalogTables = []struct {
+		name    string
+		columns string
+	}{
+		{"SCHEMATA", "CATALOG_NAME TEXT, SCHEMA_NAME TEXT, DEFAULT_CHARACTER_SET_NAME TEXT, " +
+			"DEFAULT_COLLATION_NAME TEXT, SQL_PATH TEXT"},
+		{"TABLES", "TABLE_CATALOG TEXT, TABLE_SCHEMA TEXT, TABLE_NAME TEXT, TABLE_TYPE TEXT, ENGINE TEXT, " +
+			"VERSION INTEGER, ROW_FORMAT TEXT, TABLE_ROWS INTEGER, AUTO_INCREMENT INTEGER, CREATE_TIME DATETIME, " +
+			"TABLE_COLLATION TEXT, TABLE_COMMENT TEXT"},
+		{"COLUMNS", "TABLE_CATALOG TEXT, TABLE_SCHEMA TEXT, TABLE_NAME TEXT, COLUMN_NAME TEXT, " +
+			"ORDINAL_POSITION INTEGER, COLUMN_DEFAULT TEXT, IS_NULLABLE TEXT, DATA_TYPE TEXT, " +
+			"CHARACTER_MAXIMUM_LENGTH INTEGER, CHARACTER_OCTET_LENGTH INTEGER, NUMERIC_PRECISION INTEGER, " +
+			"NUMERIC_SCALE INTEGER, DATETIME_PRECISION INTEGER, CHARACTER_SET_NAME TEXT, COLLATION_NAME TEXT, " +
+			"COLUMN_TYPE TEXT, COLUMN_KEY TEXT, EXTRA TEXT, PRIVILEGES TEXT, COLUMN_COMMENT TEXT"},
+		{"STATISTICS", "TABLE_CATALOG TEXT, TABLE_SCHEMA TEXT, TABLE_NAME TEXT, NON_UNIQUE INTEGER, " +
+			"INDEX_SCHEMA TEXT, INDEX_NAME TEXT, SEQ_IN_INDEX INTEGER, COLUMN_NAME TEXT, COLLATION TEXT, " +
+			"CARDINALITY INTEGER, SUB_PART INTEGER, PACKED TEXT, NULLABLE TEXT, INDEX_TYPE TEXT, " +
+			"COMMENT TEXT, INDEX_COMMENT TEXT"},
+		{"KEY_COLUMN_USAGE", "CONSTRAINT_CATALOG TEXT, CONSTRAINT_SCHEMA TEXT, CONSTRAINT_NAME TEXT, " +
+			"TABLE_CATALOG TEXT, TABLE_SCHEMA TEXT, TABLE_NAME TEXT, COLUMN_NAME TEXT, ORDINAL_POSITION INTEGER, " +
+			"POSITION_IN_UNIQUE_CONSTRAINT INTEGER, REFERENCED_TABLE_SCHEMA TEXT, REFERENCED_TABLE_NAME TEXT, " +
+			"REFERENCED_COLUMN_NAME TEXT"},
+	}
+)
+
+// columnInfo defines a column of sqlite table.
+type columnInfo struct {
+	name         string
+	declType     string
+	notNull      bool
+	defaultValue interface{}
+	pk           int64
+}
+
+// indexInfo defines an index of sqlite table, implicit indexes of constraints are not included.
+type indexInfo struct {
+	name    string
+	unique  bool
+	columns []string
+}
+
+// tableInfo defines the schema of sqlite table or view.
+type tableInfo struct {
+	name    string
+	view    bool
+	columns []*columnInfo
+	indexes []*indexInfo
+}
+
+// primaryKey returns the primary key columns in key order.
+func (t *tableInfo) primaryKey() (columns []string) {
+	for pk := int64(1); ; pk++ {
+		var found bool
+		for _, c := range t.columns {
+			if c.pk == pk {
+				columns = append(columns, c.name)
+				found = true
+			}
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// columnKey returns the COLUMN_KEY of mysql column.
+func (t *tableInfo) columnKey(c *columnInfo) string {
+	if c.pk > 0 {
+		return "PRI"
+	}
+	for _, idx := range t.indexes {
+		if idx.unique && len(idx.columns) == 1 && strings.EqualFold(idx.columns[0], c.name) {
+			return "UNI"
+		}
+	}
+	for _, idx := range t.indexes {
+		if len(idx.columns) > 0 && strings.EqualFold(idx.columns[0], c.name) {
+			return "MUL"
+		}
+	}
+	return ""
+}
+
+// isAutoIncrement checks if the column is an alias of sqlite rowid.
+func (t *tableInfo) isAutoIncrement(c *columnInfo) bool {
+	return c.pk > 0 && len(t.primaryKey()) == 1 && strings.EqualFold(c.declType, "INTEGER")
+}
+
+// isCatalogQuery checks if the query should be answered by the emulated catalog.
+func isCatalogQuery(query string) bool {
+	return showTablesQuery.MatchString(query) || showColumnsQuery.MatchString(query) ||
+		showIndexQuery.MatchString(query) || showCreateTableSQL.MatchString(query) ||
+		catalogTableRef.MatchString(query)
+}
+
+// identName returns the unqualified name of a matched identifier.
+func identName(ident string) string {
+	return lastName(significant(tokenize(ident)))
+}
+
+// translateShowQuery converts SHOW statements to queries of emulated information_schema tables.
+func translateShowQuery(query string, schema string) (out string, ok bool) {
+	// tail expressions are converted to sqlite string literals
+	tail := func(s string) string {
+		return render(tokenize(s))
+	}
+
+	if m := showTablesQuery.FindStringSubmatch(query); m != nil {
+		out = "SELECT TABLE_NAME AS " + quoteIdent("Tables_in_"+schema)
+		if m[1] != "" {
+			out += ", TABLE_TYPE AS Table_type"
+		}
+		out += " FROM information_schema.TABLES"
+		switch strings.ToUpper(m[3]) {
+		case "LIKE":
+			out += " WHERE TABLE_NAME LIKE " + tail(m[4])
+		case "WHERE":
+			out += " WHERE " + tail(m[4])
+		}
+		return out + " ORDER BY TABLE_NAME", true
+	}
+
+	if m := showColumnsQuery.FindStringSubmatch(query); m != nil {
+		out = "SELECT COLUMN_NAME AS Field, COLUMN_TYPE AS Type"
+		if m[1] != "" {
+			out += ", COLLATION_NAME AS Collation"
+		}
+		out += ", IS_NULLABLE AS `Null`, COLUMN_KEY AS `Key`, COLUMN_DEFAULT AS `Default`, EXTRA AS Extra"
+		if m[1] != "" {
+			out += ", PRIVILEGES AS Privileges, COLUMN_COMMENT AS Comment"
+		}
+		out += " FROM information_schema.COLUMNS WHERE TABLE_NAME = " + quoteString(identName(m[2]))
+		switch strings.ToUpper(m[4]) {
+		case "LIKE":
+			out += " AND COLUMN_NAME LIKE " + tail(m[5])
+		case "WHERE":
+			out += " AND (" + tail(m[5]) + ")"
+		}
+		return out + " ORDER BY ORDINAL_POSITION", true
+	}
+
+	if m := showIndexQuery.FindStringSubmatch(query); m != nil {
+		out = "SELECT TABLE_NAME AS `Table`, NON_UNIQUE AS Non_unique, INDEX_NAME AS Key_name, " +
+			"SEQ_IN_INDEX AS Seq_in_index, COLUMN_NAME AS Column_name, COLLATION AS Collation, " +
+			"CARDINALITY AS Cardinality, SUB_PART AS Sub_part, PACKED AS Packed, NULLABLE AS `Null`, " +
+			"INDEX_TYPE AS Index_type, COMMENT AS Comment, INDEX_COMMENT AS Index_comment " +
+			"FROM information_schema.STATISTICS WHERE TABLE_NAME = " + quoteString(identName(m[1]))
+		if m[3] != "" {
+			out += " AND (" + tail(m[3]) + ")"
+		}
+		return out + " ORDER BY INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX", true
+	}
+
+	return
+}
+
+// queryCatalog answers SHOW statements and information_schema queries using an in-memory sqlite database,
+// the emulated catalog tables are filled by the schema of current database.
+func (c *Cursor) queryCatalog(query string, args []interface{}, binary bool) (r *my.Result, err error) {
+	var conn *sql.DB
+	if conn, _, err = c.ensureDatabase(); err != nil {
+		return
+	}
+
+	c.curDBLock.Lock()
+	schema := c.curDB
+	c.curDBLock.Unlock()
+
+	if m := showCreateTableSQL.FindStringSubmatch(query); m != nil {
+		return c.showCreateTable(conn, identName(m[1]), binary)
+	}
+
+	if showQuery, ok := translateShowQuery(query, schema); ok {
+		query = showQuery
+	} else {
+		var tq *translatedQuery
+		if tq, err = translateQuery(currentSchemaFunc.ReplaceAllString(query, quoteString(schema)), nil); err != nil {
+			return
+		}
+		query = tq.query
+	}
+
+	// collect referenced catalog tables
+	referenced := make(map[string]bool)
+	for _, m := range catalogTableRef.FindAllStringSubmatch(query, -1) {
+		referenced[strings.ToUpper(m[1])] = true
+	}
+
+	var catalogDB *sql.DB
+	if catalogDB, err = c.buildCatalog(conn, schema, referenced); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+	defer catalogDB.Close()
+
+	var rows *sql.Rows
+	if rows, err = catalogDB.Query(query, args...); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+
+	return c.buildResultSet(rows, binary)
+}
+
+// showCreateTable returns the table definition stored in sqlite.
+func (c *Cursor) showCreateTable(conn *sql.DB, table string, binary bool) (r *my.Result, err error) {
+	var createSQL sql.NullString
+	err = conn.QueryRow("SELECT sql FROM sqlite_master WHERE type IN ('table', 'view') AND name = ?", table).
+		Scan(&createSQL)
+	if err == sql.ErrNoRows {
+		err = my.NewError(my.ER_NO_SUCH_TABLE, fmt.Sprintf("table '%s' doesn't exist", table))
+		return
+	} else if err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+
+	var resultSet *my.Resultset
+	if resultSet, err = buildResultset("", []string{"Table", "Create Table"}, nil,
+		[][]interface{}{{table, createSQL.String}}, binary); err != nil {
+		return
+	}
+
+	r = c.emptyResult()
+	r.Resultset = resultSet
+	return
+}
+
+// buildCatalog creates the in-memory catalog database with referenced tables filled.
+func (c *Cursor) buildCatalog(conn *sql.DB, schema string, referenced map[string]bool) (catalogDB *sql.DB, err error) {
+	if catalogDB, err = sql.Open("sqlite3", ":memory:"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			catalogDB.Close()
+		}
+	}()
+
+	// in-memory database is bound to connection
+	catalogDB.SetMaxOpenConns(1)
+
+	if _, err = catalogDB.Exec("ATTACH DATABASE ':memory:' AS " + catalogSchema); err != nil {
+		return
+	}
+	for _, t := range catalogTables {
+		if _, err = catalogDB.Exec(fmt.Sprintf("CREATE TABLE %s.%s (%s)", catalogSchema, t.name, t.columns)); err != nil {
+			return
+		}
+	}
+
+	if referenced["SCHEMATA"] {
+		if _, err = catalogDB.Exec("INSERT INTO information_schema.SCHEMATA VALUES ('def', ?, ?, ?, NULL)",
+			schema, catalogCharset, catalogCollation); err != nil {
+			return
+		}
+	}
+
+	if !referenced["TABLES"] && !referenced["COLUMNS"] && !referenced["STATISTICS"] && !referenced["KEY_COLUMN_USAGE"] {
+		return
+	}
+
+	var tables []*tableInfo
+	if tables, err = loadTables(conn, referenced["COLUMNS"] || referenced["STATISTICS"] || referenced["KEY_COLUMN_USAGE"]); err != nil {
+		return
+	}
+
+	for _, t := range tables {
+		if err = fillCatalog(catalogDB, schema, t); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// fillCatalog inserts the table schema to the emulated catalog tables.
+func fillCatalog(catalogDB *sql.DB, schema string, t *tableInfo) (err error) {
+	tableType, engine := "BASE TABLE", "InnoDB"
+	if t.view {
+		tableType, engine = "VIEW", ""
+	}
+	if _, err = catalogDB.Exec("INSERT INTO information_schema.TABLES VALUES ('def', ?, ?, ?, ?, 10, 'Dynamic', "+
+		"NULL, NULL, NULL, ?, '')", schema, t.name, tableType, engine, catalogCollation); err != nil {
+		return
+	}
+
+	for i, col := range t.columns {
+		dataType, columnType, charLength, precision, scale := mysqlColumnType(col.declType)
+		nullable := "YES"
+		if col.notNull || col.pk > 0 {
+			nullable = "NO"
+		}
+		var charset, collation interface{}
+		if charLength != nil {
+			charset, collation = catalogCharset, catalogCollation
+		}
+		extra := ""
+		if t.isAutoIncrement(col) {
+			extra = "auto_increment"
+		}
+		if _, err = catalogDB.Exec("INSERT INTO information_schema.COLUMNS VALUES ('def', ?, ?, ?, ?, ?, ?, ?, ?, ?, "+
+			"?, ?, NULL, ?, ?, ?, ?, ?, 'select,insert,update,references', '')",
+			schema, t.name, col.name, i+1, defaultValue(col.defaultValue), nullable, dataType, charLength, charLength,
+			precision, scale, charset, collation, columnType, t.columnKey(col), extra); err != nil {
+			return
+		}
+	}
+
+	// primary key and indexes
+	indexes := t.indexes
+	if pk := t.primaryKey(); len(pk) > 0 {
+		indexes = append([]*indexInfo{{name: "PRIMARY", unique: true, columns: pk}}, indexes...)
+	}
+	for _, idx := range indexes {
+		nonUnique := 1
+		if idx.unique {
+			nonUnique = 0
+		}
+		for i, col := range idx.columns {
+			if _, err = catalogDB.Exec("INSERT INTO information_schema.STATISTICS VALUES ('def', ?, ?, ?, ?, ?, ?, ?, "+
+				"'A', NULL, NULL, NULL, '', 'BTREE', '', '')",
+				schema, t.name, nonUnique, schema, idx.name, i+1, col); err != nil {
+				return
+			}
+			if !idx.unique {
+				continue
+			}
+			if _, err = catalogDB.Exec("INSERT INTO information_schema.KEY_COLUMN_USAGE VALUES ('def', ?, ?, 'def', ?, ?, "+
+				"?, ?, NULL, NULL, NULL, NULL)", schema, idx.name, schema, t.name, col, i+1); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// defaultValue converts the sqlite default expression to mysql column default.
+func defaultValue(v interface{}) interface{} {
+	var s string
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		s = string(value)
+	case string:
+		s = value
+	default:
+		return fmt.Sprint(v)
+	}
+
+	if strings.EqualFold(s, "NULL") {
+		return nil
+	}
+	if tokens := significant(tokenize(s)); len(tokens) == 1 && tokens[0].kind == tokenString {
+		return tokens[0].value
+	}
+	return s
+}
+
+// mysqlColumnType converts the sqlite declared type to DATA_TYPE and COLUMN_TYPE of mysql.
+func mysqlColumnType(declType string) (dataType string, columnType string, charLength interface{},
+	precision interface{}, scale interface{}) {
+	columnType = strings.ToLower(strings.TrimSpace(declType))
+	dataType = columnType
+	if pos := strings.IndexAny(dataType, "( "); pos >= 0 {
+		dataType = dataType[:pos]
+	}
+
+	var modifiers []string
+	if start, end := strings.IndexByte(columnType, '('), strings.IndexByte(columnType, ')'); start >= 0 && end > start {
+		for _, m := range strings.Split(columnType[start+1:end], ",") {
+			modifiers = append(modifiers, strings.TrimSpace(m))
+		}
+	}
+
+	switch dataType {
+	case "integer":
+		dataType, columnType = "int", "int"
+	case "bool", "boolean":
+		dataType, columnType = "tinyint", "tinyint(1)"
+	case "":
+		dataType, columnType = "blob", "blob"
+	}
+
+	switch detectColumnType(dataType) {
+	case my.MYSQL_TYPE_VAR_STRING:
+		charLength = int64(65535)
+		if len(modifiers) > 0 {
+			var n int64
+			if _, err := fmt.Sscan(modifiers[0], &n); err == nil {
+				charLength = n
+			}
+		}
+	case my.MYSQL_TYPE_NEWDECIMAL:
+		precision, scale = int64(10), int64(0)
+		if len(modifiers) > 0 {
+			fmt.Sscan(modifiers[0], &precision)
+		}
+		if len(modifiers) > 1 {
+			fmt.Sscan(modifiers[1], &scale)
+		}
+	case my.MYSQL_TYPE_LONGLONG:
+		precision, scale = int64(19), int64(0)
+	case my.MYSQL_TYPE_DOUBLE:
+		precision = int64(22)
+	}
+
+	return
+}
+
+// loadTables reads the tables of current database, columns and indexes are loaded on demand.
+func loadTables(conn *sql.DB, withColumns bool) (tables []*tableInfo, err error) {
+	var rows *sql.Rows
+	if rows, err = conn.Query("SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') " +
+		"AND name NOT LIKE 'sqlite_%' ORDER BY name"); err != nil {
+		return
+	}
+
+	byName := make(map[string]*tableInfo)
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			rows.Close()
+			return
+		}
+		t := &tableInfo{name: name, view: typ == "view"}
+		tables = append(tables, t)
+		byName[strings.ToLower(name)] = t
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || !withColumns {
+		return
+	}
+
+	for _, t := range tables {
+		if t.columns, err = loadColumns(conn, t.name); err != nil {
+			return
+		}
+	}
+
+	// indexes with sql are created explicitly, the column list is parsed from the definition
+	if rows, err = conn.Query("SELECT name, tbl_name, sql FROM sqlite_master WHERE type = 'index' " +
+		"AND sql IS NOT NULL ORDER BY name"); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, table, createSQL string
+		if err = rows.Scan(&name, &table, &createSQL); err != nil {
+			return
+		}
+		t, ok := byName[strings.ToLower(table)]
+		if !ok {
+			continue
+		}
+		if idx := parseIndexSQL(name, createSQL); idx != nil {
+			t.indexes = append(t.indexes, idx)
+		}
+	}
+
+	err = rows.Err()
+	return
+}
+
+// loadTable reads the columns and indexes of a table, nil is returned if the table does not exist.
+func loadTable(conn *sql.DB, table string) (t *tableInfo, err error) {
+	var exists bool
+	if exists, err = tableExists(conn, table); err != nil || !exists {
+		return
+	}
+
+	t = &tableInfo{name: table}
+	if t.columns, err = loadColumns(conn, table); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	if rows, err = conn.Query("SELECT name, sql FROM sqlite_master WHERE type = 'index' "+
+		"AND sql IS NOT NULL AND tbl_name = ? ORDER BY name", table); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, createSQL string
+		if err = rows.Scan(&name, &createSQL); err != nil {
+			return nil, err
+		}
+		if idx := parseIndexSQL(name, createSQL); idx != nil {
+			t.indexes = append(t.indexes, idx)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// loadColumns reads the columns of a table.
+func loadColumns(conn *sql.DB, table string) (columns []*columnInfo, err error) {
+	// DESC is translated to PRAGMA table_info by the worker
+	var rows *sql.Rows
+	if rows, err = conn.Query("DESC " + quoteIdent(table)); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int64
+		col := &columnInfo{}
+		if err = rows.Scan(&cid, &col.name, &col.declType, &col.notNull, &col.defaultValue, &col.pk); err != nil {
+			return
+		}
+		columns = append(columns, col)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// parseIndexSQL parses the column list of CREATE INDEX statement.
+func parseIndexSQL(name string, createSQL string) *indexInfo {
+	sig := significant(tokenize(createSQL))
+	start := -1
+	for i, t := range sig {
+		if t.is("(") {
+			start = i
+			break
+		}
+	}
+	if len(sig) < 2 || start < 0 {
+		return nil
+	}
+
+	idx := &indexInfo{name: name, unique: sig[1].is("UNIQUE")}
+	for _, col := range splitTopLevel(sig[start+1:matchParen(sig, start)], ",") {
+		if len(col) > 0 {
+			idx.columns = append(idx.columns, col[0].name())
+		}
+	}
+	return idx
+}
@@ -28,28 +28,47 @@ import (
 	my "github.com/siddontang/go-mysql/mysql"
 )
 
+const (
+	// maxCachedStatements defines the max number of prepared statements cached in a connection.
+	maxCachedStatements = 256
+)
+
 var (
 	dbIDRegex          = regexp.MustCompile("^[a-zA-Z0-9_\\.]+$")
 	specialSelectQuery = regexp.MustCompile("^(?i)SELECT\\s+(DATABASE|USER)\\(\\)\\s*;?\\s*$")
-	emptyResultQuery   = regexp.MustCompile("^(?i)\\s*(?:(?:SELECT\\s+)?@@(?:\\w+\\.)?|SHOW\\s+VARIABLES|SHOW\\s+DATABASES|SET|ROLLBACK).*$")
+	emptyResultQuery   = regexp.MustCompile("^(?i)\\s*(?:(?:SELECT\\s+)?@@(?:\\w+\\.)?|SHOW\\s+VARIABLES|SHOW\\s+DATABASES|SET).*$")
 	useDatabaseQuery   = regexp.MustCompile("^(?i)\\s*USE\\s+`?(\\w+)`?\\s*$")
 	readQuery          = regexp.MustCompile("^(?i)\\s*(?:SELECT|SHOW|DESC)")
 )
 
+// statement defines the prepared statement context, statements are cached by query in a connection.
+type statement struct {
+	query   string
+	params  int
+	columns int
+}
+
 // Cursor is a mysql connection handler, like a cursor of normal database.
 type Cursor struct {
 	server        *Server
 	curDBLock     sync.Mutex
 	curDB         string
 	curDBInstance *sql.DB
+	curTx         *sql.Tx
+	stmtCache     map[string]*statement
 }
 
 // NewCursor returns a new cursor.
 func NewCursor(s *Server) (c *Cursor) {
-	return &Cursor{server: s}
+	return &Cursor{
+		server:    s,
+		stmtCache: make(map[string]*statement),
+	}
 }
 
-func (c *Cursor) buildResultSet(rows *sql.Rows) (r *my.Result, err error) {
+func (c *Cursor) buildResultSet(rows *sql.Rows, binary bool) (r *my.Result, err error) {
+	defer rows.Close()
+
 	// get columns
 	var columns []string
 	if columns, err = rows.Columns(); err != nil {
@@ -57,6 +76,17 @@ func (c *Cursor) buildResultSet(rows *sql.Rows) (r *my.Result, err error) {
 		return
 	}
 
+	// get declared column types
+	var columnTypes []*sql.ColumnType
+	if columnTypes, err = rows.ColumnTypes(); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+	declTypes := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		declTypes[i] = ct.DatabaseTypeName()
+	}
+
 	// read all rows
 	var resultData [][]interface{}
 	if resultData, err = readAllRows(rows); err != nil {
@@ -65,13 +95,13 @@ func (c *Cursor) buildResultSet(rows *sql.Rows) (r *my.Result, err error) {
 	}
 
 	var resultSet *my.Resultset
-	if resultSet, err = my.BuildSimpleTextResultset(columns, resultData); err != nil {
+	if resultSet, err = buildResultset(c.curDB, columns, declTypes, resultData, binary); err != nil {
 		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
 		return
 	}
 
 	r = &my.Result{
-		Status:       0,
+		Status:       c.status(),
 		InsertId:     0,
 		AffectedRows: 0,
 		Resultset:    resultSet,
@@ -79,7 +109,27 @@ func (c *Cursor) buildResultSet(rows *sql.Rows) (r *my.Result, err error) {
 	return
 }
 
-func (c *Cursor) ensureDatabase() (conn *sql.DB, err error) {
+func (c *Cursor) emptyResult() *my.Result {
+	return &my.Result{
+		Status:       c.status(),
+		InsertId:     0,
+		AffectedRows: 0,
+		Resultset:    nil,
+	}
+}
+
+// status returns the server status flags of current connection.
+func (c *Cursor) status() (status uint16) {
+	c.curDBLock.Lock()
+	defer c.curDBLock.Unlock()
+
+	if c.curTx != nil {
+		status |= my.SERVER_STATUS_IN_TRANS
+	}
+	return
+}
+
+func (c *Cursor) ensureDatabase() (conn *sql.DB, tx *sql.Tx, err error) {
 	c.curDBLock.Lock()
 	defer c.curDBLock.Unlock()
 
@@ -89,33 +139,67 @@ func (c *Cursor) ensureDatabase() (conn *sql.DB, err error) {
 	}
 
 	conn = c.curDBInstance
+	tx = c.curTx
 
 	return
 }
 
-func (c *Cursor) detectColumnType(typeStr string) (typeByte uint8) {
-	typeStr = strings.ToUpper(typeStr)
-
-	if strings.Contains(typeStr, "INT") {
-		return my.MYSQL_TYPE_LONGLONG
-	} else if strings.Contains(typeStr, "CHAR") || strings.Contains(typeStr, "CLOB") ||
-		strings.Contains(typeStr, "TEXT") {
-		return my.MYSQL_TYPE_VAR_STRING
-	} else if strings.Contains(typeStr, "BLOB") || typeStr == "" {
-		return my.MYSQL_TYPE_LONG_BLOB
-	} else if strings.Contains(typeStr, "REAL") || strings.Contains(typeStr, "FLOA") ||
-		strings.Contains(typeStr, "DOUB") {
-		return my.MYSQL_TYPE_DOUBLE
-	} else if strings.Contains(typeStr, "BOOLEAN") {
-		return my.MYSQL_TYPE_BIT
-	} else if strings.Contains(typeStr, "TIMESTAMP") || strings.Contains(typeStr, "DATETIME") {
-		return my.MYSQL_TYPE_TIMESTAMP
-	} else if strings.Contains(typeStr, "TIME") {
-		return my.MYSQL_TYPE_TIME
-	} else if strings.Contains(typeStr, "DATE") {
-		return my.MYSQL_TYPE_DATE
+// beginTransaction starts a client transaction, the running transaction is committed implicitly as mysql does.
+func (c *Cursor) beginTransaction() (err error) {
+	if err = c.endTransaction(true); err != nil {
+		return
+	}
+
+	var conn *sql.DB
+	if conn, _, err = c.ensureDatabase(); err != nil {
+		return
+	}
+
+	var tx *sql.Tx
+	if tx, err = conn.Begin(); err != nil {
+		return my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+	}
+
+	c.curDBLock.Lock()
+	c.curTx = tx
+	c.curDBLock.Unlock()
+
+	return
+}
+
+// endTransaction commits or rollbacks the running transaction.
+func (c *Cursor) endTransaction(commit bool) (err error) {
+	c.curDBLock.Lock()
+	tx := c.curTx
+	c.curTx = nil
+	c.curDBLock.Unlock()
+
+	if tx == nil {
+		return
+	}
+
+	if commit {
+		err = tx.Commit()
 	} else {
-		return my.MYSQL_TYPE_LONG_BLOB
+		err = tx.Rollback()
+	}
+	if err != nil && err != sql.ErrTxDone {
+		return my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+	}
+
+	return nil
+}
+
+// Close rollbacks the running transaction and closes the database instance.
+func (c *Cursor) Close() {
+	c.endTransaction(false)
+
+	c.curDBLock.Lock()
+	defer c.curDBLock.Unlock()
+
+	if c.curDBInstance != nil {
+		c.curDBInstance.Close()
+		c.curDBInstance = nil
 	}
 }
 
@@ -130,37 +214,83 @@ func (c *Cursor) UseDB(dbName string) (err error) {
 		return my.NewError(my.ER_BAD_DB_ERROR, fmt.Sprintf("invalid database: %v", dbName))
 	}
 
-	// connect database
-	cfg := client.NewConfig()
-	cfg.DatabaseID = dbName
+	// transaction is bound to current database
+	if c.curTx != nil {
+		return my.NewError(my.ER_CANT_DO_THIS_DURING_AN_TRANSACTION, "switch database during transaction is not supported")
+	}
 
+	// connect database
 	var db *sql.DB
 
-	if db, err = sql.Open("covenantsql", cfg.FormatDSN()); err != nil {
+	if observerAddr != "" {
+		db, err = sql.Open(replicaDriverName, replicaDSN(observerAddr, dbName))
+	} else {
+		cfg := client.NewConfig()
+		cfg.DatabaseID = dbName
+		db, err = sql.Open("covenantsql", cfg.FormatDSN())
+	}
+	if err != nil {
 		return
 	}
 
+	if c.curDBInstance != nil {
+		c.curDBInstance.Close()
+	}
+
 	c.curDB = dbName
 	c.curDBInstance = db
+	c.stmtCache = make(map[string]*statement)
 
 	return
 }
 
 // HandleQuery handle COM_QUERY comamnd, like SELECT, INSERT, UPDATE, etc...
 // if Result has a Resultset (SELECT, SHOW, etc...), we will send this as the repsonse, otherwise, we will send Result.
+// Multiple statements are executed in order and the result of the last statement is returned.
 func (c *Cursor) HandleQuery(query string) (r *my.Result, err error) {
+	stmts := splitStatements(query)
+	if len(stmts) == 0 {
+		err = my.NewError(my.ER_EMPTY_QUERY, "query was empty")
+		return
+	}
+
+	for _, stmt := range stmts {
+		if r, err = c.execute(stmt, nil, false); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// execute runs a single statement, result set is encoded in binary protocol for prepared statements.
+func (c *Cursor) execute(query string, args []interface{}, binary bool) (r *my.Result, err error) {
 	var conn *sql.DB
+	var tx *sql.Tx
+
+	// transaction control, mapped to client transactions
+	switch {
+	case beginQuery.MatchString(query):
+		if err = c.beginTransaction(); err == nil {
+			r = c.emptyResult()
+		}
+		return
+	case commitQuery.MatchString(query):
+		if err = c.endTransaction(true); err == nil {
+			r = c.emptyResult()
+		}
+		return
+	case rollbackQuery.MatchString(query):
+		if err = c.endTransaction(false); err == nil {
+			r = c.emptyResult()
+		}
+		return
+	}
 
 	// send empty result for variables query/table listing
 	if emptyResultQuery.MatchString(query) {
 		// return empty result
-		r = &my.Result{
-			Status:       0,
-			InsertId:     0,
-			AffectedRows: 0,
-			Resultset:    nil,
-		}
-
+		r = c.emptyResult()
 		return
 	}
 
@@ -169,12 +299,7 @@ func (c *Cursor) HandleQuery(query string) (r *my.Result, err error) {
 		dbID := matches[1]
 
 		if err = c.UseDB(dbID); err == nil {
-			r = &my.Result{
-				Status:       0,
-				InsertId:     0,
-				AffectedRows: 0,
-				Resultset:    nil,
-			}
+			r = c.emptyResult()
 		}
 
 		return
@@ -185,50 +310,79 @@ func (c *Cursor) HandleQuery(query string) (r *my.Result, err error) {
 	// https://github.com/mysql/mysql-server/blob/4f1d7cf5fcb11a3f84cff27e37100d7295e7d5ca/client/mysql.cc#L4266
 	if matches := specialSelectQuery.FindStringSubmatch(query); len(matches) > 1 {
 		var resultSet *my.Resultset
+		var name string
+		var value interface{}
 
 		switch strings.ToUpper(matches[1]) {
 		case "DATABASE":
 			c.curDBLock.Lock()
-			resultSet, _ = my.BuildSimpleTextResultset(
-				[]string{"DATABASE()"},
-				[][]interface{}{{c.curDB}},
-			)
+			name, value = "DATABASE()", c.curDB
 			c.curDBLock.Unlock()
 		case "USER":
-			resultSet, _ = my.BuildSimpleTextResultset(
-				[]string{"USER()"},
-				[][]interface{}{{c.server.mysqlUser}},
-			)
+			name, value = "USER()", c.server.mysqlUser
 		}
 
-		r = &my.Result{
-			Status:       0,
-			InsertId:     0,
-			AffectedRows: 0,
-			Resultset:    resultSet,
+		if resultSet, err = buildResultset("", []string{name}, nil, [][]interface{}{{value}}, binary); err != nil {
+			return
 		}
 
+		r = c.emptyResult()
+		r.Resultset = resultSet
+
+		return
+	}
+
+	// show statements and information_schema queries are answered by the emulated catalog
+	if isCatalogQuery(query) {
+		return c.queryCatalog(query, args, binary)
+	}
+
+	if conn, tx, err = c.ensureDatabase(); err != nil {
 		return
 	}
 
-	if conn, err = c.ensureDatabase(); err != nil {
+	// translate mysql dialect to sqlite
+	var tq *translatedQuery
+	if tq, err = translateQuery(query, func(table string) (*tableInfo, error) {
+		return loadTable(conn, table)
+	}); err != nil {
 		return
 	}
+	if tq.query == "" {
+		r = c.emptyResult()
+		return
+	}
+	if tq.ifNotExists != "" {
+		var exists bool
+		if exists, err = tableExists(conn, tq.ifNotExists); err != nil || exists {
+			if err == nil {
+				r = c.emptyResult()
+			}
+			return
+		}
+	}
+	query = tq.query
 
 	// as normal query
 	if readQuery.MatchString(query) {
+		// read query is not supported by client transaction, queries committed data directly
 		var rows *sql.Rows
-		if rows, err = conn.Query(query); err != nil {
+		if rows, err = conn.Query(query, args...); err != nil {
 			err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
 			return
 		}
 
 		// build result set
-		return c.buildResultSet(rows)
+		return c.buildResultSet(rows, binary)
 	}
 
 	var result sql.Result
-	if result, err = conn.Exec(query); err != nil {
+	if tx != nil {
+		result, err = tx.Exec(query, args...)
+	} else {
+		result, err = conn.Exec(query, args...)
+	}
+	if err != nil {
 		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
 		return
 	}
@@ -236,21 +390,30 @@ func (c *Cursor) HandleQuery(query string) (r *my.Result, err error) {
 	lastInsertID, _ := result.LastInsertId()
 	affectedRows, _ := result.RowsAffected()
 
-	r = &my.Result{
-		Status:       0,
-		InsertId:     uint64(lastInsertID),
-		AffectedRows: uint64(affectedRows),
-		Resultset:    nil,
-	}
+	r = c.emptyResult()
+	r.InsertId = uint64(lastInsertID)
+	r.AffectedRows = uint64(affectedRows)
 
 	return
 }
 
+// tableExists checks if the table or view exists in current database.
+func tableExists(conn *sql.DB, table string) (exists bool, err error) {
+	var count int64
+	if err = conn.QueryRow("SELECT COUNT(1) FROM sqlite_master WHERE type IN ('table', 'view') AND name = ?",
+		table).Scan(&count); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+	exists = count > 0
+	return
+}
+
 // HandleFieldList handle COM_FILED_LIST command.
 func (c *Cursor) HandleFieldList(table string, fieldWildcard string) (fields []*my.Field, err error) {
 	var conn *sql.DB
 
-	if conn, err = c.ensureDatabase(); err != nil {
+	if conn, _, err = c.ensureDatabase(); err != nil {
 		return
 	}
 
@@ -297,17 +460,17 @@ func (c *Cursor) HandleFieldList(table string, fieldWildcard string) (fields []*
 			colFlag |= my.PRI_KEY_FLAG
 		}
 
-		fields = append(fields, &my.Field{
-			Name:         []byte(columnName),
-			OrgName:      []byte(columnName),
-			Table:        []byte(table),
-			OrgTable:     []byte(table),
-			Schema:       []byte(c.curDB),
-			Flag:         colFlag,
-			Charset:      uint16(my.DEFAULT_COLLATION_ID),
-			ColumnLength: 0, // no column length specified
-			Type:         c.detectColumnType(typeString),
-		})
+		typ := detectColumnType(typeString)
+		if typ == 0 {
+			typ = my.MYSQL_TYPE_VAR_STRING
+		}
+
+		field := buildField(c.curDB, columnName, typ)
+		field.Table = []byte(table)
+		field.OrgTable = []byte(table)
+		field.Flag |= colFlag
+
+		fields = append(fields, field)
 	}
 
 	return
@@ -316,26 +479,117 @@ func (c *Cursor) HandleFieldList(table string, fieldWildcard string) (fields []*
 // HandleStmtPrepare handle COM_STMT_PREPARE, params is the param number for this statement, columns is the column number
 // context will be used later for statement execute.
 func (c *Cursor) HandleStmtPrepare(query string) (params int, columns int, context interface{}, err error) {
-	// TODO(xq26144), not implemented
-	// According to the libmysql standard: https://github.com/mysql/mysql-server/blob/8.0/libmysql/libmysql.cc#L1599
-	// the COM_STMT_PREPARE should return the correct bind parameter count (which can be implemented by newly created parser)
-	// and should return the correct number of return fields (which can not be implemented right now with new query plan logic embedded)
+	stmts := splitStatements(query)
+	if len(stmts) != 1 {
+		err = my.NewError(my.ER_UNSUPPORTED_PS, "prepared statement should contain exactly one statement")
+		return
+	}
 
-	err = my.NewError(my.ER_NOT_SUPPORTED_YET, "stmt prepare is not supported yet")
-	return
+	query = stmts[0]
+
+	c.curDBLock.Lock()
+	st, cached := c.stmtCache[query]
+	c.curDBLock.Unlock()
+
+	if !cached {
+		st = &statement{
+			query:  query,
+			params: countParams(query),
+		}
+
+		if st.columns, err = c.describeColumns(st.query, st.params); err != nil {
+			return
+		}
+
+		c.curDBLock.Lock()
+		if len(c.stmtCache) >= maxCachedStatements {
+			c.stmtCache = make(map[string]*statement)
+		}
+		c.stmtCache[query] = st
+		c.curDBLock.Unlock()
+	}
+
+	return st.params, st.columns, st, nil
+}
+
+// describeColumns returns the result column count of a statement,
+// select statements are executed as sub query with no rows returned.
+func (c *Cursor) describeColumns(query string, params int) (columns int, err error) {
+	switch {
+	case specialSelectQuery.MatchString(query):
+		return 1, nil
+	case emptyResultQuery.MatchString(query), !readQuery.MatchString(query):
+		return 0, nil
+	case !describeQuery.MatchString(query) && params > 0:
+		// show/desc statements with params could not be described
+		return 0, nil
+	}
+
+	args := make([]interface{}, params)
+	if isCatalogQuery(query) {
+		var r *my.Result
+		if r, err = c.queryCatalog(query, args, false); err != nil {
+			return
+		}
+		if r.Resultset != nil {
+			columns = len(r.Resultset.Fields)
+		}
+		return
+	}
+
+	var conn *sql.DB
+	if conn, _, err = c.ensureDatabase(); err != nil {
+		return
+	}
+
+	var tq *translatedQuery
+	if tq, err = translateQuery(query, nil); err != nil {
+		return
+	}
+	query = tq.query
+	if describeQuery.MatchString(query) {
+		query = "SELECT * FROM (" + query + ") AS _describe LIMIT 0"
+	}
+
+	var rows *sql.Rows
+	if rows, err = conn.Query(query, args...); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var names []string
+	if names, err = rows.Columns(); err != nil {
+		err = my.NewError(my.ER_UNKNOWN_ERROR, err.Error())
+		return
+	}
+
+	return len(names), nil
 }
 
 // HandleStmtExecute handle COM_STMT_EXECUTE, context is the previous one set in prepare
 // query is the statement prepare query, and args is the params for this statement.
 func (c *Cursor) HandleStmtExecute(context interface{}, query string, args []interface{}) (result *my.Result, err error) {
-	// same to COM_STMT_PREPARE
-	err = my.NewError(my.ER_NOT_SUPPORTED_YET, "stmt execute is not supported yet")
-	return
+	st, ok := context.(*statement)
+	if !ok {
+		err = my.NewError(my.ER_UNKNOWN_STMT_HANDLER, "unknown prepared statement")
+		return
+	}
+
+	// string and blob params are both sent as bytes, bind as string to match text columns
+	for i, arg := range args {
+		if b, ok := arg.([]byte); ok {
+			args[i] = string(b)
+		}
+	}
+
+	return c.execute(st.query, args, true)
 }
 
 // HandleStmtClose handle COM_STMT_CLOSE, context is the previous one set in prepare
 // this handler has no response.
 func (c *Cursor) HandleStmtClose(context interface{}) (err error) {
+	// statement metadata is kept in cursor cache for later prepares
 	return
 }
 
@@ -0,0 +1,1048 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	my "github.com/siddontang/go-mysql/mysql"
+)
+
+type tokenKind int
+
+const (
+	tokenSpace tokenKind = iota
+	tokenComment
+	tokenWord
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+// multiCharSymbols defines the operators which should not be split while formatting.
+var multiCharSymbols = []string{"<=>", "<=", ">=", "<>", "!=", "||", "&&", ":=", "<<", ">>"}
+
+// token defines a lexical token of mysql dialect, value holds the unquoted content of strings and identifiers.
+type token struct {
+	kind  tokenKind
+	text  string
+	value string
+}
+
+// is checks if the token is one of the keywords or symbols.
+func (t token) is(words ...string) bool {
+	if t.kind != tokenWord && t.kind != tokenSymbol {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the identifier name of the token.
+func (t token) name() string {
+	if t.kind == tokenQuotedIdent || t.kind == tokenString {
+		return t.value
+	}
+	return t.text
+}
+
+// sql returns the token in sqlite dialect, strings are always single quoted without backslash escapes.
+func (t token) sql() string {
+	if t.kind == tokenString {
+		return quoteString(t.value)
+	}
+	return t.text
+}
+
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func quoteIdent(s string) string {
+	return "`" + strings.Replace(s, "`", "``", -1) + "`"
+}
+
+func identToken(name string) token {
+	return token{kind: tokenQuotedIdent, text: quoteIdent(name), value: name}
+}
+
+func wordToken(word string) token {
+	return token{kind: tokenWord, text: word}
+}
+
+func symbolToken(symbol string) token {
+	return token{kind: tokenSymbol, text: symbol}
+}
+
+// tokenize splits a statement into mysql tokens, whitespaces and comments are kept.
+func tokenize(query string) (tokens []token) {
+	for i := 0; i < len(query); {
+		ch := query[i]
+		start := i
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f':
+			for i < len(query) && strings.IndexByte(" \t\n\r\f", query[i]) >= 0 {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenSpace, text: query[start:i]})
+		case ch == '#' || strings.HasPrefix(query[i:], "-- "):
+			i = skipLineComment(query, i)
+			tokens = append(tokens, token{kind: tokenComment, text: query[start:i]})
+		case strings.HasPrefix(query[i:], "/*"):
+			i = skipBlockComment(query, i)
+			tokens = append(tokens, token{kind: tokenComment, text: query[start:i]})
+		case ch == '\'' || ch == '"':
+			i = skipQuoted(query, i) + 1
+			tokens = append(tokens, token{kind: tokenString, text: query[start:i], value: unquoteString(query[start:i])})
+		case ch == '`':
+			i = skipQuoted(query, i) + 1
+			value := strings.Replace(strings.Trim(query[start:i], "`"), "``", "`", -1)
+			tokens = append(tokens, token{kind: tokenQuotedIdent, text: query[start:i], value: value})
+		case isDigit(ch) || (ch == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.' || isWordChar(query[i]) ||
+				((query[i] == '-' || query[i] == '+') && (query[i-1] == 'e' || query[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: query[start:i]})
+		case isWordChar(ch):
+			for i < len(query) && (isWordChar(query[i]) || isDigit(query[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: query[start:i]})
+		default:
+			i++
+			for _, s := range multiCharSymbols {
+				if strings.HasPrefix(query[start:], s) {
+					i = start + len(s)
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: query[start:i]})
+		}
+	}
+
+	return
+}
+
+// unquoteString decodes a mysql string literal with backslash escapes.
+func unquoteString(s string) string {
+	quote := s[0]
+	if len(s) < 2 || s[len(s)-1] != quote {
+		s = s[1:]
+	} else {
+		s = s[1 : len(s)-1]
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case '0':
+				b.WriteByte(0)
+			case 'b':
+				b.WriteByte('\b')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'Z':
+				b.WriteByte(26)
+			case '%', '_':
+				// kept for like patterns
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte(s[i])
+			}
+		case ch == quote && i+1 < len(s) && s[i+1] == quote:
+			b.WriteByte(ch)
+			i++
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= 0x80
+}
+
+// significant removes whitespaces and comments.
+func significant(tokens []token) (sig []token) {
+	for _, t := range tokens {
+		if t.kind != tokenSpace && t.kind != tokenComment {
+			sig = append(sig, t)
+		}
+	}
+	return
+}
+
+// render joins the original tokens, strings are converted to sqlite literals.
+func render(tokens []token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.sql())
+	}
+	return b.String()
+}
+
+// format joins the significant tokens of rebuilt statements.
+func format(tokens []token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && needSpace(tokens[i-1], t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.sql())
+	}
+	return b.String()
+}
+
+func needSpace(prev token, cur token) bool {
+	switch {
+	case cur.is(",", ")", "."), prev.is("(", "."):
+		return false
+	case cur.is("(") && (prev.kind == tokenWord || prev.kind == tokenQuotedIdent):
+		// functions and type modifiers, keywords are spaced
+		return prev.is("KEY", "INDEX", "UNIQUE", "IN", "ON", "AS", "VALUES", "CHECK", "REFERENCES", "AND", "OR", "NOT")
+	default:
+		return true
+	}
+}
+
+// splitTopLevel splits tokens by the separator outside parentheses.
+func splitTopLevel(tokens []token, sep string) (parts [][]token) {
+	var depth, start int
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && t.is(sep):
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		parts = append(parts, tokens[start:])
+	}
+	return
+}
+
+// matchParen returns the position of the parenthesis closing the one at start.
+func matchParen(tokens []token, start int) int {
+	var depth int
+	for i := start; i < len(tokens); i++ {
+		if tokens[i].is("(") {
+			depth++
+		} else if tokens[i].is(")") {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// findTopLevel returns the position of the keyword sequence outside parentheses, -1 is returned if not found.
+func findTopLevel(tokens []token, words ...string) int {
+	var depth int
+	for i, t := range tokens {
+		if t.is("(") {
+			depth++
+		} else if t.is(")") {
+			depth--
+		} else if depth == 0 && i+len(words) <= len(tokens) {
+			matched := true
+			for j, w := range words {
+				if !tokens[i+j].is(w) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// translatedQuery defines the sqlite equivalent of a mysql statement.
+type translatedQuery struct {
+	// query is the translated statements, empty for statements take no effect in sqlite
+	query string
+	// ifNotExists is the table name of CREATE TABLE IF NOT EXISTS statement,
+	// the statement should be skipped if the table exists
+	ifNotExists string
+}
+
+// tableLookup returns the schema of table, nil is returned if the table does not exist.
+type tableLookup func(table string) (*tableInfo, error)
+
+// translateQuery rewrites common mysql ddl/dml syntax to sqlite equivalents,
+// unsupported statements are returned as is and left for the database to report.
+// The table schema is looked up for the conflict target of upserts if lookup is provided.
+func translateQuery(query string, lookup tableLookup) (tq *translatedQuery, err error) {
+	tokens := tokenize(query)
+	sig := significant(tokens)
+	tq = &translatedQuery{}
+
+	if len(sig) == 0 {
+		// comments only
+		return
+	}
+
+	switch {
+	case sig[0].is("CREATE") && len(sig) > 2 && (sig[1].is("TABLE") || (sig[1].is("TEMPORARY") && sig[2].is("TABLE"))):
+		return translateCreateTable(sig)
+	case sig[0].is("CREATE") && findTopLevel(sig[:3], "INDEX") > 0:
+		tq.query, err = translateCreateIndex(sig)
+	case sig[0].is("ALTER") && findTopLevel(sig, "TABLE") > 0:
+		tq.query, err = translateAlterTable(sig)
+	case sig[0].is("DROP") && len(sig) > 2 && sig[1].is("INDEX", "KEY"):
+		// DROP INDEX name ON table
+		if pos := findTopLevel(sig, "ON"); pos > 0 {
+			sig = sig[:pos]
+		}
+		sig[1] = wordToken("INDEX")
+		tq.query = format(sig)
+	case sig[0].is("TRUNCATE"):
+		// TRUNCATE [TABLE] name
+		name := sig[1:]
+		if len(name) > 0 && name[0].is("TABLE") {
+			name = name[1:]
+		}
+		tq.query = format(append([]token{wordToken("DELETE"), wordToken("FROM")}, name...))
+	case sig[0].is("INSERT"):
+		tq.query, err = translateInsert(tokens, lookup)
+	case sig[0].is("SELECT") || sig[0].is("("):
+		tq.query = translateSelect(tokens)
+	default:
+		tq.query = render(tokens)
+	}
+
+	return
+}
+
+// translateInsert converts INSERT IGNORE to INSERT OR IGNORE, and ON DUPLICATE KEY UPDATE to the sqlite upsert
+// clause ON CONFLICT(<primary key>) DO UPDATE with VALUES(col) references rewritten to excluded.col.
+// Statements without a known conflict target fall back to INSERT OR REPLACE, which replaces the existing row
+// as a whole, so the assignments must be col = VALUES(col) covering every inserted non-key column.
+func translateInsert(tokens []token, lookup tableLookup) (query string, err error) {
+	var sigPos []int
+	for i, t := range tokens {
+		if t.kind != tokenSpace && t.kind != tokenComment {
+			sigPos = append(sigPos, i)
+		}
+	}
+	sig := significant(tokens)
+
+	ignore := len(sig) > 1 && sig[1].is("IGNORE")
+	if ignore {
+		// drop the IGNORE keyword with the preceding space
+		tokens[sigPos[1]].text = ""
+		if prev := sigPos[1] - 1; tokens[prev].kind == tokenSpace {
+			tokens[prev].text = ""
+		}
+	}
+
+	pos := findTopLevel(sig, "ON", "DUPLICATE", "KEY", "UPDATE")
+	if pos < 0 {
+		if ignore {
+			tokens[sigPos[0]].text = "INSERT OR IGNORE"
+		}
+		return render(tokens), nil
+	}
+
+	// INSERT [IGNORE] [INTO] table [(columns)] VALUES ...
+	start := 1
+	for start < pos && sig[start].is("IGNORE", "INTO", "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY") {
+		start++
+	}
+	end := tableNameEnd(sig, start)
+	table := lastName(sig[start:end])
+
+	var columns []string
+	if end < pos && sig[end].is("(") {
+		closing := matchParen(sig, end)
+		for _, col := range splitTopLevel(sig[end+1:closing], ",") {
+			columns = append(columns, lastName(col))
+		}
+		end = closing + 1
+	}
+	isValues := end < pos && sig[end].is("VALUES", "VALUE")
+
+	var info *tableInfo
+	if lookup != nil {
+		if info, err = lookup(table); err != nil {
+			return
+		}
+	}
+
+	assignments := splitTopLevel(sig[pos+4:], ",")
+	target := conflictTarget(info)
+	prefix := strings.TrimSpace(render(tokens[:sigPos[pos]]))
+
+	if len(target) > 0 && isValues {
+		upsert := []token{wordToken("ON"), wordToken("CONFLICT"), symbolToken("(")}
+		for i, col := range target {
+			if i > 0 {
+				upsert = append(upsert, symbolToken(","))
+			}
+			upsert = append(upsert, identToken(col))
+		}
+		upsert = append(upsert, symbolToken(")"), wordToken("DO"), wordToken("UPDATE"), wordToken("SET"))
+
+		for i, assignment := range assignments {
+			eq := tableNameEnd(assignment, 0)
+			if eq >= len(assignment) || !assignment[eq].is("=") {
+				err = my.NewError(my.ER_PARSE_ERROR, "invalid ON DUPLICATE KEY UPDATE assignment")
+				return
+			}
+			if i > 0 {
+				upsert = append(upsert, symbolToken(","))
+			}
+			upsert = append(upsert, identToken(lastName(assignment[:eq])), symbolToken("="))
+			upsert = append(upsert, excludedValues(assignment[eq+1:])...)
+		}
+
+		return prefix + " " + format(upsert), nil
+	}
+
+	// replace the existing row with inserted values
+	if len(columns) == 0 && info != nil {
+		for _, c := range info.columns {
+			columns = append(columns, c.name)
+		}
+	}
+
+	assigned := make(map[string]bool)
+	for _, assignment := range assignments {
+		// col = VALUES(col)
+		if len(assignment) != 6 || !assignment[1].is("=") || !assignment[2].is("VALUES") ||
+			!assignment[3].is("(") || !assignment[5].is(")") ||
+			!strings.EqualFold(lastName(assignment[:1]), assignment[4].name()) {
+			err = my.NewError(my.ER_NOT_SUPPORTED_YET,
+				"ON DUPLICATE KEY UPDATE without primary key only supports col = VALUES(col) assignments")
+			return
+		}
+		assigned[strings.ToLower(assignment[4].name())] = true
+	}
+
+	keys := make(map[string]bool)
+	if info != nil {
+		for _, col := range info.primaryKey() {
+			keys[strings.ToLower(col)] = true
+		}
+		for _, idx := range info.indexes {
+			if idx.unique {
+				for _, col := range idx.columns {
+					keys[strings.ToLower(col)] = true
+				}
+			}
+		}
+	}
+
+	if len(columns) == 0 {
+		err = my.NewError(my.ER_NOT_SUPPORTED_YET,
+			"ON DUPLICATE KEY UPDATE without primary key requires the inserted column list")
+		return
+	}
+	for _, col := range columns {
+		if !keys[strings.ToLower(col)] && !assigned[strings.ToLower(col)] {
+			err = my.NewError(my.ER_NOT_SUPPORTED_YET, fmt.Sprintf(
+				"ON DUPLICATE KEY UPDATE without primary key must assign every inserted column, missing %s", col))
+			return
+		}
+	}
+
+	tokens[sigPos[0]].text = "INSERT OR REPLACE"
+
+	return strings.TrimSpace(render(tokens[:sigPos[pos]])), nil
+}
+
+// conflictTarget returns the primary key columns of table, or the columns of the only unique index
+// if the table has no primary key.
+func conflictTarget(info *tableInfo) (columns []string) {
+	if info == nil {
+		return
+	}
+	if columns = info.primaryKey(); len(columns) > 0 {
+		return
+	}
+	for _, idx := range info.indexes {
+		if idx.unique {
+			if columns != nil {
+				// ambiguous
+				return nil
+			}
+			columns = idx.columns
+		}
+	}
+	return
+}
+
+// excludedValues rewrites the VALUES(col) references of upsert assignment to excluded.col.
+func excludedValues(expr []token) (out []token) {
+	for i := 0; i < len(expr); i++ {
+		if expr[i].is("VALUES") && i+3 < len(expr) && expr[i+1].is("(") && expr[i+3].is(")") {
+			out = append(out, wordToken("excluded"), symbolToken("."), identToken(expr[i+2].name()))
+			i += 3
+			continue
+		}
+		out = append(out, expr[i])
+	}
+	return
+}
+
+// translateSelect removes the locking clauses which are not supported by sqlite.
+func translateSelect(tokens []token) string {
+	sig := significant(tokens)
+	pos := findTopLevel(sig, "FOR", "UPDATE")
+	if pos < 0 {
+		pos = findTopLevel(sig, "FOR", "SHARE")
+	}
+	if pos < 0 {
+		pos = findTopLevel(sig, "LOCK", "IN", "SHARE", "MODE")
+	}
+	if pos < 0 {
+		return render(tokens)
+	}
+	return format(sig[:pos])
+}
+
+// lastName returns the unqualified name of a possibly qualified identifier.
+func lastName(tokens []token) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	return tokens[len(tokens)-1].name()
+}
+
+// tableNameEnd returns the end position of a possibly qualified table name at start.
+func tableNameEnd(tokens []token, start int) int {
+	end := start + 1
+	for end+1 < len(tokens) && tokens[end].is(".") {
+		end += 2
+	}
+	return end
+}
+
+// indexDef defines a secondary index extracted from mysql table definition.
+type indexDef struct {
+	name    string
+	unique  bool
+	columns [][]token
+}
+
+func (d *indexDef) sql(table string, ifNotExists bool) string {
+	tokens := []token{wordToken("CREATE")}
+	if d.unique {
+		tokens = append(tokens, wordToken("UNIQUE"))
+	}
+	tokens = append(tokens, wordToken("INDEX"))
+	if ifNotExists {
+		tokens = append(tokens, wordToken("IF"), wordToken("NOT"), wordToken("EXISTS"))
+	}
+	tokens = append(tokens, identToken(d.name), wordToken("ON"), identToken(table), token{kind: tokenSymbol, text: "("})
+	for i, col := range d.columns {
+		if i > 0 {
+			tokens = append(tokens, token{kind: tokenSymbol, text: ","})
+		}
+		tokens = append(tokens, col...)
+	}
+	tokens = append(tokens, token{kind: tokenSymbol, text: ")"})
+	return format(tokens)
+}
+
+// parseIndexDef parses [name] [USING type] (col[(length)] [ASC|DESC], ...) [options] of index definition.
+func parseIndexDef(tokens []token, table string, unique bool) (d *indexDef, err error) {
+	d = &indexDef{unique: unique}
+
+	i := 0
+	for i < len(tokens) && !tokens[i].is("(") {
+		if tokens[i].is("USING") {
+			i += 2
+			continue
+		}
+		d.name = tokens[i].name()
+		i++
+	}
+	if i >= len(tokens) {
+		err = my.NewError(my.ER_PARSE_ERROR, "invalid index definition")
+		return
+	}
+
+	end := matchParen(tokens, i)
+	for _, col := range splitTopLevel(tokens[i+1:end], ",") {
+		// remove prefix length
+		if len(col) > 1 && col[1].is("(") {
+			col = append(col[:1:1], col[matchParen(col, 1)+1:]...)
+		}
+		d.columns = append(d.columns, col)
+	}
+
+	if d.name == "" {
+		// index names are global in sqlite
+		names := []string{table}
+		for _, col := range d.columns {
+			names = append(names, col[0].name())
+		}
+		d.name = strings.Join(names, "_")
+	}
+
+	return
+}
+
+// translateCreateTable removes mysql specific column attributes and table options,
+// auto increment columns are converted to INTEGER PRIMARY KEY AUTOINCREMENT and
+// secondary indexes are created by separate statements.
+func translateCreateTable(sig []token) (tq *translatedQuery, err error) {
+	tq = &translatedQuery{}
+
+	i := 2
+	if sig[1].is("TEMPORARY") {
+		i++
+	}
+	ifNotExists := i+2 < len(sig) && sig[i].is("IF") && sig[i+1].is("NOT") && sig[i+2].is("EXISTS")
+	if ifNotExists {
+		i += 3
+	}
+	if i >= len(sig) {
+		tq.query = format(sig)
+		return
+	}
+
+	nameEnd := tableNameEnd(sig, i)
+	table := lastName(sig[i:nameEnd])
+	if nameEnd >= len(sig) || !sig[nameEnd].is("(") {
+		// CREATE TABLE ... LIKE/AS
+		tq.query = format(sig)
+		return
+	}
+
+	defEnd := matchParen(sig, nameEnd)
+
+	var (
+		columns    [][]token
+		constraint [][]token
+		indexes    []*indexDef
+		primaryKey []string
+		autoInc    = -1
+		inlinePK   bool
+	)
+
+	for _, def := range splitTopLevel(sig[nameEnd+1:defEnd], ",") {
+		if len(def) == 0 {
+			continue
+		}
+
+		var name string
+		if def[0].is("CONSTRAINT") && len(def) > 1 {
+			if !def[1].is("PRIMARY", "UNIQUE", "FOREIGN", "CHECK") {
+				name = def[1].name()
+				def = def[1:]
+			}
+			def = def[1:]
+		}
+
+		switch {
+		case def[0].is("PRIMARY"):
+			var d *indexDef
+			if d, err = parseIndexDef(def[2:], table, true); err != nil {
+				return
+			}
+			for _, col := range d.columns {
+				primaryKey = append(primaryKey, col[0].name())
+			}
+			d.name = ""
+			constraint = append(constraint, append(def[:2:2], indexColumns(d)...))
+		case def[0].is("UNIQUE"):
+			rest := def[1:]
+			if len(rest) > 0 && rest[0].is("KEY", "INDEX") {
+				rest = rest[1:]
+			}
+			var d *indexDef
+			if d, err = parseIndexDef(rest, table, true); err != nil {
+				return
+			}
+			if name != "" && (len(rest) == 0 || rest[0].is("(")) {
+				d.name = name
+			}
+			indexes = append(indexes, d)
+		case def[0].is("KEY", "INDEX", "FULLTEXT", "SPATIAL"):
+			rest := def[1:]
+			if def[0].is("FULLTEXT", "SPATIAL") && len(rest) > 0 && rest[0].is("KEY", "INDEX") {
+				rest = rest[1:]
+			}
+			var d *indexDef
+			if d, err = parseIndexDef(rest, table, false); err != nil {
+				return
+			}
+			indexes = append(indexes, d)
+		case def[0].is("FOREIGN", "CHECK"):
+			if name != "" {
+				def = append([]token{wordToken("CONSTRAINT"), identToken(name)}, def...)
+			}
+			constraint = append(constraint, def)
+		default:
+			col, isAutoInc, isPK := translateColumnDef(def)
+			if isAutoInc {
+				autoInc = len(columns)
+				inlinePK = isPK
+			}
+			columns = append(columns, col)
+		}
+	}
+
+	if autoInc >= 0 {
+		col := columns[autoInc]
+		switch {
+		case inlinePK:
+			pos := findTopLevel(col, "PRIMARY", "KEY")
+			col = append(col[:pos+2:pos+2], append([]token{wordToken("AUTOINCREMENT")}, col[pos+2:]...)...)
+		case len(primaryKey) == 1 && strings.EqualFold(primaryKey[0], col[0].name()):
+			col = append(col, wordToken("PRIMARY"), wordToken("KEY"), wordToken("AUTOINCREMENT"))
+			// remove table primary key constraint
+			for i, c := range constraint {
+				if c[0].is("PRIMARY") {
+					constraint = append(constraint[:i], constraint[i+1:]...)
+					break
+				}
+			}
+		default:
+			// sqlite only supports auto increment on integer primary key, rowid is increased anyway
+			col[1] = wordToken("INTEGER")
+		}
+		columns[autoInc] = col
+	}
+
+	tokens := append([]token{}, sig[:i]...)
+	tokens = append(tokens, identToken(table), token{kind: tokenSymbol, text: "("})
+	for i, def := range append(columns, constraint...) {
+		if i > 0 {
+			tokens = append(tokens, token{kind: tokenSymbol, text: ","})
+		}
+		tokens = append(tokens, def...)
+	}
+	tokens = append(tokens, token{kind: tokenSymbol, text: ")"})
+
+	// keep sqlite table options only
+	if pos := findTopLevel(sig[defEnd+1:], "WITHOUT", "ROWID"); pos >= 0 {
+		tokens = append(tokens, wordToken("WITHOUT"), wordToken("ROWID"))
+	}
+
+	stmts := []string{format(tokens)}
+	for _, d := range indexes {
+		stmts = append(stmts, d.sql(table, false))
+	}
+
+	tq.query = strings.Join(stmts, "; ")
+	if ifNotExists {
+		tq.ifNotExists = table
+	}
+
+	return
+}
+
+// indexColumns returns the column list tokens of an index.
+func indexColumns(d *indexDef) (tokens []token) {
+	tokens = append(tokens, token{kind: tokenSymbol, text: "("})
+	for i, col := range d.columns {
+		if i > 0 {
+			tokens = append(tokens, token{kind: tokenSymbol, text: ","})
+		}
+		tokens = append(tokens, col...)
+	}
+	return append(tokens, token{kind: tokenSymbol, text: ")"})
+}
+
+// translateColumnDef removes mysql specific column attributes.
+func translateColumnDef(def []token) (col []token, autoInc bool, primaryKey bool) {
+	col = append(col, def[0])
+	if len(def) < 2 {
+		return
+	}
+
+	// column type, enum and set values are not supported by sqlite
+	i := 1
+	switch {
+	case def[1].is("ENUM", "SET"):
+		col = append(col, wordToken("TEXT"))
+		i = 2
+		if i < len(def) && def[i].is("(") {
+			i = matchParen(def, i) + 1
+		}
+	default:
+		for ; i < len(def); i++ {
+			t := def[i]
+			if t.is("(") {
+				end := matchParen(def, i)
+				col = append(col, def[i:end+1]...)
+				i = end
+				continue
+			}
+			if i > 1 && isColumnAttribute(def, i) {
+				break
+			}
+			if !t.is("UNSIGNED", "SIGNED", "ZEROFILL") {
+				col = append(col, t)
+			}
+		}
+	}
+
+	for i < len(def) {
+		t := def[i]
+		switch {
+		case t.is("AUTO_INCREMENT"):
+			autoInc = true
+			i++
+		case t.is("PRIMARY"):
+			primaryKey = true
+			col = append(col, wordToken("PRIMARY"), wordToken("KEY"))
+			i += 2
+		case t.is("KEY"):
+			primaryKey = true
+			col = append(col, wordToken("PRIMARY"), wordToken("KEY"))
+			i++
+		case t.is("UNIQUE"):
+			col = append(col, wordToken("UNIQUE"))
+			i++
+			if i < len(def) && def[i].is("KEY") {
+				i++
+			}
+		case t.is("COMMENT"), t.is("CHARSET"), t.is("COLUMN_FORMAT"), t.is("STORAGE"):
+			i += 2
+		case t.is("CHARACTER"):
+			i += 3
+		case t.is("VISIBLE", "INVISIBLE"):
+			i++
+		case t.is("COLLATE") && i+1 < len(def):
+			// map collations to sqlite builtin ones
+			collation := strings.ToLower(def[i+1].name())
+			if strings.HasSuffix(collation, "_ci") {
+				col = append(col, t, wordToken("NOCASE"))
+			}
+			i += 2
+		case t.is("ON") && i+1 < len(def) && def[i+1].is("UPDATE"):
+			i = skipExpr(def, i+2)
+		case t.is("DEFAULT") && i+1 < len(def):
+			end := skipExpr(def, i+1)
+			expr := def[i+1 : end]
+			if expr[0].is("CURRENT_TIMESTAMP", "NOW", "LOCALTIMESTAMP") {
+				expr = []token{wordToken("CURRENT_TIMESTAMP")}
+			}
+			col = append(col, t)
+			col = append(col, expr...)
+			i = end
+		default:
+			col = append(col, t)
+			i++
+		}
+	}
+
+	if autoInc {
+		col[1] = wordToken("INTEGER")
+		col = append(col[:2:2], removeTypeModifier(col[2:])...)
+	}
+
+	return
+}
+
+// removeTypeModifier removes the (n) modifier following the type name.
+func removeTypeModifier(tokens []token) []token {
+	if len(tokens) > 0 && tokens[0].is("(") {
+		return tokens[matchParen(tokens, 0)+1:]
+	}
+	return tokens
+}
+
+// isColumnAttribute checks if the token at i starts the attribute list of column definition.
+func isColumnAttribute(def []token, i int) bool {
+	t := def[i]
+	switch {
+	case t.is("CHARACTER"):
+		// CHARACTER SET vs CHARACTER VARYING
+		return i+1 < len(def) && def[i+1].is("SET")
+	case t.is("NOT", "NULL", "DEFAULT", "AUTO_INCREMENT", "PRIMARY", "KEY", "UNIQUE", "COMMENT", "COLLATE",
+		"CHARSET", "ON", "REFERENCES", "CHECK", "GENERATED", "AS", "CONSTRAINT", "COLUMN_FORMAT", "STORAGE",
+		"VISIBLE", "INVISIBLE"):
+		return true
+	default:
+		return false
+	}
+}
+
+// skipExpr returns the end position of a simple expression: literal, function call or parenthesized expression.
+func skipExpr(tokens []token, start int) int {
+	if start >= len(tokens) {
+		return start
+	}
+	i := start
+	if tokens[i].is("-", "+") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].is("(") {
+		return matchParen(tokens, i) + 1
+	}
+	i++
+	if i < len(tokens) && tokens[i].is("(") {
+		return matchParen(tokens, i) + 1
+	}
+	return i
+}
+
+// translateCreateIndex removes the index type and options of CREATE INDEX statement.
+func translateCreateIndex(sig []token) (query string, err error) {
+	pos := findTopLevel(sig, "INDEX")
+	unique := sig[1].is("UNIQUE")
+
+	on := findTopLevel(sig, "ON")
+	if on < 0 || on+1 >= len(sig) {
+		return format(sig), nil
+	}
+
+	nameEnd := tableNameEnd(sig, on+1)
+	table := lastName(sig[on+1 : nameEnd])
+
+	var d *indexDef
+	if d, err = parseIndexDef(append(sig[pos+1:on:on], sig[nameEnd:]...), table, unique); err != nil {
+		return
+	}
+
+	return d.sql(table, false), nil
+}
+
+// translateAlterTable converts each alter specification to sqlite statements,
+// table options and foreign keys are ignored since they could not be altered in sqlite.
+func translateAlterTable(sig []token) (query string, err error) {
+	pos := findTopLevel(sig, "TABLE")
+	if pos+1 >= len(sig) {
+		return format(sig), nil
+	}
+
+	nameEnd := tableNameEnd(sig, pos+1)
+	table := lastName(sig[pos+1 : nameEnd])
+	prefix := []token{wordToken("ALTER"), wordToken("TABLE"), identToken(table)}
+
+	var stmts []string
+	for _, spec := range splitTopLevel(sig[nameEnd:], ",") {
+		if len(spec) == 0 {
+			continue
+		}
+
+		var name string
+		if len(spec) > 2 && spec[0].is("ADD") && spec[1].is("CONSTRAINT") {
+			if !spec[2].is("PRIMARY", "UNIQUE", "FOREIGN", "CHECK") {
+				name = spec[2].name()
+				spec = append(spec[:1:1], spec[3:]...)
+			} else {
+				spec = append(spec[:1:1], spec[2:]...)
+			}
+		}
+
+		switch {
+		case spec[0].is("ADD") && len(spec) > 1 && spec[1].is("INDEX", "KEY", "FULLTEXT", "SPATIAL", "UNIQUE"):
+			rest := spec[2:]
+			if spec[1].is("FULLTEXT", "SPATIAL", "UNIQUE") && len(rest) > 0 && rest[0].is("INDEX", "KEY") {
+				rest = rest[1:]
+			}
+			var d *indexDef
+			if d, err = parseIndexDef(rest, table, spec[1].is("UNIQUE")); err != nil {
+				return
+			}
+			if name != "" && (len(rest) == 0 || rest[0].is("(")) {
+				d.name = name
+			}
+			stmts = append(stmts, d.sql(table, false))
+		case spec[0].is("ADD") && len(spec) > 1 && spec[1].is("FOREIGN", "CHECK"):
+			// constraints could not be added to existing sqlite tables
+		case spec[0].is("ADD") && len(spec) > 1 && spec[1].is("PRIMARY"):
+			err = my.NewError(my.ER_NOT_SUPPORTED_YET, "adding primary key to existing table is not supported")
+			return
+		case spec[0].is("ADD"):
+			def := spec[1:]
+			if len(def) > 0 && def[0].is("COLUMN") {
+				def = def[1:]
+			}
+			if len(def) > 0 && def[0].is("(") {
+				// ADD COLUMN (col1 ..., col2 ...)
+				def = def[1:matchParen(def, 0)]
+			}
+			for _, colDef := range splitTopLevel(def, ",") {
+				// column position is not supported by sqlite
+				if p := findTopLevel(colDef, "FIRST"); p > 0 {
+					colDef = colDef[:p]
+				} else if p := findTopLevel(colDef, "AFTER"); p > 0 {
+					colDef = colDef[:p]
+				}
+				col, _, _ := translateColumnDef(colDef)
+				stmts = append(stmts, format(append(append(prefix, wordToken("ADD"), wordToken("COLUMN")), col...)))
+			}
+		case spec[0].is("DROP") && len(spec) > 2 && spec[1].is("INDEX", "KEY"):
+			stmts = append(stmts, format([]token{wordToken("DROP"), wordToken("INDEX"), spec[2]}))
+		case spec[0].is("DROP") && len(spec) > 1 && spec[1].is("FOREIGN", "CHECK", "CONSTRAINT"):
+			// constraints could not be dropped from existing sqlite tables
+		case spec[0].is("DROP"):
+			def := spec[1:]
+			if len(def) > 0 && def[0].is("COLUMN") {
+				def = def[1:]
+			}
+			stmts = append(stmts, format(append(append(prefix, wordToken("DROP"), wordToken("COLUMN")), def...)))
+		case spec[0].is("RENAME") && len(spec) > 1 && spec[1].is("INDEX", "KEY"):
+			err = my.NewError(my.ER_NOT_SUPPORTED_YET, "renaming index is not supported")
+			return
+		case spec[0].is("RENAME") && len(spec) > 1 && spec[1].is("COLUMN"):
+			stmts = append(stmts, format(append(prefix, spec...)))
+		case spec[0].is("RENAME"):
+			def := spec[1:]
+			if len(def) > 0 && def[0].is("TO", "AS") {
+				def = def[1:]
+			}
+			stmts = append(stmts, format(append(append(prefix, wordToken("RENAME"), wordToken("TO")), def...)))
+		case spec[0].is("MODIFY", "CHANGE") || (spec[0].is("ALTER") && findTopLevel(spec, "DEFAULT") < 0):
+			err = my.NewError(my.ER_NOT_SUPPORTED_YET,
+				fmt.Sprintf("ALTER TABLE %s is not supported", strings.ToUpper(spec[0].text)))
+			return
+		default:
+			// table options such as ENGINE, CHARSET, AUTO_INCREMENT and column defaults take no effect
+		}
+	}
+
+	return strings.Join(stmts, "; "), nil
+}
@@ -34,6 +34,7 @@ var (
 	listenAddr    string
 	mysqlUser     string
 	mysqlPassword string
+	observerAddr  string
 )
 
 func init() {
@@ -45,6 +46,8 @@ func init() {
 	flag.StringVar(&listenAddr, "listen", "127.0.0.1:4664", "listen address for mysql adapter")
 	flag.StringVar(&mysqlUser, "mysql-user", "root", "mysql user for adapter server")
 	flag.StringVar(&mysqlPassword, "mysql-password", "calvin", "mysql password for adapter server")
+	flag.StringVar(&observerAddr, "observer", "",
+		"serve read-only queries from replicas of cql-observer at the http address instead of miners")
 }
 
 func main() {
@@ -53,10 +56,12 @@ func main() {
 		log.Infof("Args %s : %v", f.Name, f.Value)
 	})
 
-	// init client
-	if err := client.Init(configFile, []byte(password)); err != nil {
-		log.Fatalf("init covenantsql client failed: %v", err)
-		return
+	// init client, the replicas are queried through observer api without client
+	if observerAddr == "" {
+		if err := client.Init(configFile, []byte(password)); err != nil {
+			log.Fatalf("init covenantsql client failed: %v", err)
+			return
+		}
 	}
 
 	stop := make(chan os.Signal, 1)
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	beginQuery    = regexp.MustCompile("^(?i)\\s*(?:BEGIN(?:\\s+WORK)?|START\\s+TRANSACTION)\\s*$")
+	commitQuery   = regexp.MustCompile("^(?i)\\s*COMMIT(?:\\s+WORK)?\\s*$")
+	rollbackQuery = regexp.MustCompile("^(?i)\\s*ROLLBACK(?:\\s+WORK)?\\s*$")
+	describeQuery = regexp.MustCompile("^(?i)\\s*SELECT\\b")
+)
+
+// splitStatements splits a multi-statement query into single statements,
+// quoted strings, identifiers and comments are respected.
+func splitStatements(query string) (stmts []string) {
+	var start int
+
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'', '"', '`':
+			i = skipQuoted(query, i)
+		case '#':
+			i = skipLineComment(query, i) - 1
+		case '-':
+			if strings.HasPrefix(query[i:], "-- ") {
+				i = skipLineComment(query, i) - 1
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "/*") {
+				i = skipBlockComment(query, i) - 1
+			}
+		case ';':
+			if stmt := strings.TrimSpace(query[start:i]); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+		}
+	}
+
+	if stmt := strings.TrimSpace(query[start:]); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+
+	return
+}
+
+// countParams returns the number of ? placeholders outside of quotes and comments.
+func countParams(query string) (params int) {
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'', '"', '`':
+			i = skipQuoted(query, i)
+		case '#':
+			i = skipLineComment(query, i) - 1
+		case '-':
+			if strings.HasPrefix(query[i:], "-- ") {
+				i = skipLineComment(query, i) - 1
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "/*") {
+				i = skipBlockComment(query, i) - 1
+			}
+		case '?':
+			params++
+		}
+	}
+
+	return
+}
+
+// skipQuoted returns the position of the closing quote, doubled quotes and backslash escapes
+// in strings are skipped, the last position is returned for unterminated quotes.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(query) - 1
+}
+
+// skipLineComment returns the end position (exclusive) of a -- or # comment.
+func skipLineComment(query string, start int) int {
+	if pos := strings.IndexByte(query[start:], '\n'); pos >= 0 {
+		return start + pos
+	}
+	return len(query)
+}
+
+// skipBlockComment returns the end position (exclusive) of a /* */ comment.
+func skipBlockComment(query string, start int) int {
+	if pos := strings.Index(query[start+2:], "*/"); pos >= 0 {
+		return start + 2 + pos + 2
+	}
+	return len(query)
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Following contains the sql driver of observer read-only replicas, the adapter serves queries
+// from replicas instead of miners if the observer address is specified.
+
+const (
+	// replicaDriverName defines the registered sql driver name of observer replicas.
+	replicaDriverName = "cql-observer-replica"
+	// replicaRequestTimeout defines the timeout of a single replica query.
+	replicaRequestTimeout = 10 * time.Second
+)
+
+var (
+	// ErrReadOnlyReplica defines error on executing write queries on read-only replica.
+	ErrReadOnlyReplica = errors.New("observer replica is read-only")
+)
+
+func init() {
+	sql.Register(replicaDriverName, &replicaDriver{})
+}
+
+// replicaDSN returns the dsn of database replica served by observer at addr.
+func replicaDSN(addr string, dbID string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/") + "/v1/replica/" + dbID + "/query"
+}
+
+type replicaDriver struct{}
+
+// Open implements driver.Driver.Open, the dsn is the replica query url of observer.
+func (d *replicaDriver) Open(dsn string) (driver.Conn, error) {
+	return &replicaConn{
+		url:    dsn,
+		client: &http.Client{Timeout: replicaRequestTimeout},
+	}, nil
+}
+
+type replicaConn struct {
+	url    string
+	client *http.Client
+}
+
+func (c *replicaConn) Prepare(query string) (driver.Stmt, error) {
+	return &replicaStmt{conn: c, query: query}, nil
+}
+
+func (c *replicaConn) Close() error {
+	return nil
+}
+
+// Begin implements driver.Conn.Begin, the transaction is a no-op as there are only reads.
+func (c *replicaConn) Begin() (driver.Tx, error) {
+	return replicaTx{}, nil
+}
+
+func (c *replicaConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return nil, ErrReadOnlyReplica
+}
+
+func (c *replicaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (
+	rows driver.Rows, err error) {
+	req := map[string]interface{}{
+		"query": query,
+	}
+	reqArgs := make([]map[string]interface{}, len(args))
+	for i, a := range args {
+		value := a.Value
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		reqArgs[i] = map[string]interface{}{"name": a.Name, "value": value}
+	}
+	req["args"] = reqArgs
+
+	var body []byte
+	if body, err = json.Marshal(req); err != nil {
+		return
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status  string `json:"status"`
+		Success bool   `json:"success"`
+		Data    struct {
+			Columns []string        `json:"columns"`
+			Types   []string        `json:"types"`
+			Rows    [][]interface{} `json:"rows"`
+		} `json:"data"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err = dec.Decode(&result); err != nil {
+		return
+	}
+	if !result.Success {
+		err = fmt.Errorf("replica query failed: %s", result.Status)
+		return
+	}
+
+	for _, row := range result.Data.Rows {
+		for i, v := range row {
+			if n, ok := v.(json.Number); ok {
+				if iv, err := n.Int64(); err == nil {
+					row[i] = iv
+				} else if fv, err := n.Float64(); err == nil {
+					row[i] = fv
+				}
+			}
+		}
+	}
+
+	rows = &replicaRows{
+		columns: result.Data.Columns,
+		types:   result.Data.Types,
+		data:    result.Data.Rows,
+	}
+	return
+}
+
+type replicaStmt struct {
+	conn  *replicaConn
+	query string
+}
+
+func (s *replicaStmt) Close() error {
+	return nil
+}
+
+func (s *replicaStmt) NumInput() int {
+	return -1
+}
+
+func (s *replicaStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, ErrReadOnlyReplica
+}
+
+func (s *replicaStmt) Query(args []driver.Value) (driver.Rows, error) {
+	namedArgs := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		namedArgs[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return s.conn.QueryContext(context.Background(), s.query, namedArgs)
+}
+
+type replicaTx struct{}
+
+func (replicaTx) Commit() error {
+	return nil
+}
+
+func (replicaTx) Rollback() error {
+	return nil
+}
+
+type replicaRows struct {
+	columns []string
+	types   []string
+	data    [][]interface{}
+}
+
+func (r *replicaRows) Columns() []string {
+	return r.columns
+}
+
+func (r *replicaRows) Close() error {
+	r.data = nil
+	return nil
+}
+
+func (r *replicaRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	for i, v := range r.data[0] {
+		dest[i] = v
+	}
+	r.data = r.data[1:]
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName.
+func (r *replicaRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.types) {
+		return strings.ToUpper(r.types[index])
+	}
+	return ""
+}
@@ -0,0 +1,501 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	my "github.com/siddontang/go-mysql/mysql"
+)
+
+const (
+	// binaryCollationID defines the charset of numeric and binary fields.
+	binaryCollationID = 63
+	// notFixedDecimals defines the decimals of floating point fields.
+	notFixedDecimals = 31
+)
+
+// timeFormats defines the time layouts accepted in sqlite time columns.
+var timeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// detectColumnType maps the sqlite declared type to mysql field type following the sqlite type affinity rules,
+// zero is returned for columns without declared type.
+func detectColumnType(declType string) (typ uint8) {
+	declType = strings.ToUpper(declType)
+
+	switch {
+	case declType == "":
+		return 0
+	case strings.Contains(declType, "BOOL"):
+		return my.MYSQL_TYPE_TINY
+	case strings.Contains(declType, "INT"):
+		return my.MYSQL_TYPE_LONGLONG
+	case strings.Contains(declType, "CHAR") || strings.Contains(declType, "CLOB") ||
+		strings.Contains(declType, "TEXT"):
+		return my.MYSQL_TYPE_VAR_STRING
+	case strings.Contains(declType, "BLOB"):
+		return my.MYSQL_TYPE_BLOB
+	case strings.Contains(declType, "REAL") || strings.Contains(declType, "FLOA") ||
+		strings.Contains(declType, "DOUB"):
+		return my.MYSQL_TYPE_DOUBLE
+	case strings.Contains(declType, "DEC") || strings.Contains(declType, "NUMERIC"):
+		return my.MYSQL_TYPE_NEWDECIMAL
+	case strings.Contains(declType, "TIMESTAMP"):
+		return my.MYSQL_TYPE_TIMESTAMP
+	case strings.Contains(declType, "DATETIME"):
+		return my.MYSQL_TYPE_DATETIME
+	case strings.Contains(declType, "TIME"):
+		return my.MYSQL_TYPE_TIME
+	case strings.Contains(declType, "DATE"):
+		return my.MYSQL_TYPE_DATE
+	default:
+		return my.MYSQL_TYPE_VAR_STRING
+	}
+}
+
+// inferColumnType detects the field type of column without declared type by the column values.
+func inferColumnType(values [][]interface{}, column int) (typ uint8) {
+	for _, row := range values {
+		var valueType uint8
+
+		switch row[column].(type) {
+		case nil:
+			continue
+		case int64, int32, int16, int8, int, uint64, uint32, uint16, uint8, uint:
+			valueType = my.MYSQL_TYPE_LONGLONG
+		case float64, float32:
+			valueType = my.MYSQL_TYPE_DOUBLE
+		case bool:
+			valueType = my.MYSQL_TYPE_TINY
+		case time.Time:
+			valueType = my.MYSQL_TYPE_DATETIME
+		default:
+			return my.MYSQL_TYPE_VAR_STRING
+		}
+
+		switch {
+		case typ == 0 || typ == valueType:
+			typ = valueType
+		case (typ == my.MYSQL_TYPE_LONGLONG && valueType == my.MYSQL_TYPE_DOUBLE) ||
+			(typ == my.MYSQL_TYPE_DOUBLE && valueType == my.MYSQL_TYPE_LONGLONG):
+			typ = my.MYSQL_TYPE_DOUBLE
+		default:
+			return my.MYSQL_TYPE_VAR_STRING
+		}
+	}
+
+	if typ == 0 {
+		typ = my.MYSQL_TYPE_VAR_STRING
+	}
+
+	return
+}
+
+// buildField returns the column definition of a field type.
+func buildField(schema string, name string, typ uint8) (field *my.Field) {
+	field = &my.Field{
+		Schema:  []byte(schema),
+		Name:    []byte(name),
+		OrgName: []byte(name),
+		Type:    typ,
+		Charset: binaryCollationID,
+		Flag:    my.BINARY_FLAG,
+	}
+
+	switch typ {
+	case my.MYSQL_TYPE_TINY:
+		field.ColumnLength = 1
+		field.Flag |= my.NUM_FLAG
+	case my.MYSQL_TYPE_LONGLONG:
+		field.ColumnLength = 20
+		field.Flag |= my.NUM_FLAG
+	case my.MYSQL_TYPE_DOUBLE:
+		field.ColumnLength = 22
+		field.Decimal = notFixedDecimals
+		field.Flag |= my.NUM_FLAG
+	case my.MYSQL_TYPE_NEWDECIMAL:
+		field.ColumnLength = 65
+		field.Decimal = notFixedDecimals
+		field.Flag |= my.NUM_FLAG
+	case my.MYSQL_TYPE_DATE:
+		field.ColumnLength = 10
+	case my.MYSQL_TYPE_TIME:
+		field.ColumnLength = 17
+	case my.MYSQL_TYPE_DATETIME, my.MYSQL_TYPE_TIMESTAMP:
+		field.ColumnLength = 26
+	case my.MYSQL_TYPE_BLOB:
+		field.Flag |= my.BLOB_FLAG
+	default:
+		field.Charset = uint16(my.DEFAULT_COLLATION_ID)
+		field.Flag = 0
+	}
+
+	return
+}
+
+// buildResultset encodes the rows in text or binary protocol, field types are derived
+// from the declared column types, columns containing values which could not be converted
+// to the declared type are sent as strings.
+func buildResultset(schema string, columns []string, declTypes []string,
+	values [][]interface{}, binaryProtocol bool) (r *my.Resultset, err error) {
+	r = &my.Resultset{
+		Fields: make([]*my.Field, len(columns)),
+	}
+
+	for i, name := range columns {
+		var typ uint8
+		if i < len(declTypes) {
+			typ = detectColumnType(declTypes[i])
+		}
+		if typ == 0 {
+			typ = inferColumnType(values, i)
+		} else if !isConvertible(values, i, typ) {
+			typ = my.MYSQL_TYPE_VAR_STRING
+		}
+
+		r.Fields[i] = buildField(schema, name, typ)
+		if isTimeType(typ) && hasFraction(values, i) {
+			r.Fields[i].Decimal = 6
+		}
+	}
+
+	r.RowDatas = make([]my.RowData, 0, len(values))
+
+	for _, row := range values {
+		if len(row) != len(columns) {
+			err = fmt.Errorf("row has %d columns, %d expected", len(row), len(columns))
+			return
+		}
+
+		var data []byte
+		if binaryProtocol {
+			data, err = encodeBinaryRow(r.Fields, row)
+		} else {
+			data, err = encodeTextRow(r.Fields, row)
+		}
+		if err != nil {
+			return
+		}
+
+		r.RowDatas = append(r.RowDatas, data)
+	}
+
+	return
+}
+
+func encodeTextRow(fields []*my.Field, row []interface{}) (data []byte, err error) {
+	for i, v := range row {
+		if v == nil {
+			// NULL value is encoded as 0xfb in text protocol
+			data = append(data, 0xfb)
+			continue
+		}
+
+		var b []byte
+		if b, err = formatText(fields[i], v); err != nil {
+			return
+		}
+		data = append(data, my.PutLengthEncodedString(b)...)
+	}
+
+	return
+}
+
+func encodeBinaryRow(fields []*my.Field, row []interface{}) (data []byte, err error) {
+	// packet header and null bitmap with 2 bits offset
+	nullBitmap := make([]byte, (len(fields)+7+2)>>3)
+	data = append(data, 0)
+	data = append(data, nullBitmap...)
+
+	for i, v := range row {
+		if v == nil {
+			nullBitmap[(i+2)>>3] |= 1 << (uint(i+2) % 8)
+			continue
+		}
+
+		var b []byte
+		if b, err = formatBinary(fields[i], v); err != nil {
+			return
+		}
+		data = append(data, b...)
+	}
+
+	copy(data[1:], nullBitmap)
+
+	return
+}
+
+func formatText(field *my.Field, v interface{}) (b []byte, err error) {
+	switch field.Type {
+	case my.MYSQL_TYPE_TINY, my.MYSQL_TYPE_LONGLONG:
+		i, _ := toInt64(v)
+		return strconv.AppendInt(nil, i, 10), nil
+	case my.MYSQL_TYPE_DOUBLE:
+		f, _ := toFloat64(v)
+		return strconv.AppendFloat(nil, f, 'g', -1, 64), nil
+	case my.MYSQL_TYPE_DATE, my.MYSQL_TYPE_TIME, my.MYSQL_TYPE_DATETIME, my.MYSQL_TYPE_TIMESTAMP:
+		t, _ := toTime(v)
+		return []byte(formatTime(field, t)), nil
+	}
+
+	switch value := v.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	case bool:
+		if value {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case time.Time:
+		return []byte(value.Format("2006-01-02 15:04:05.999999")), nil
+	case float64:
+		return strconv.AppendFloat(nil, value, 'g', -1, 64), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(value), 'g', -1, 32), nil
+	default:
+		if i, ok := toInt64(v); ok {
+			return strconv.AppendInt(nil, i, 10), nil
+		}
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+func formatBinary(field *my.Field, v interface{}) (b []byte, err error) {
+	switch field.Type {
+	case my.MYSQL_TYPE_TINY:
+		i, _ := toInt64(v)
+		return []byte{byte(i)}, nil
+	case my.MYSQL_TYPE_LONGLONG:
+		i, _ := toInt64(v)
+		return my.Uint64ToBytes(uint64(i)), nil
+	case my.MYSQL_TYPE_DOUBLE:
+		f, _ := toFloat64(v)
+		return my.Uint64ToBytes(math.Float64bits(f)), nil
+	case my.MYSQL_TYPE_DATE, my.MYSQL_TYPE_DATETIME, my.MYSQL_TYPE_TIMESTAMP:
+		t, _ := toTime(v)
+		return formatBinaryDateTime(field, t), nil
+	case my.MYSQL_TYPE_TIME:
+		t, _ := toTime(v)
+		return formatBinaryTime(t), nil
+	}
+
+	if b, err = formatText(field, v); err != nil {
+		return
+	}
+	return my.PutLengthEncodedString(b), nil
+}
+
+func formatTime(field *my.Field, t time.Time) string {
+	switch field.Type {
+	case my.MYSQL_TYPE_DATE:
+		return t.Format("2006-01-02")
+	case my.MYSQL_TYPE_TIME:
+		if field.Decimal > 0 {
+			return t.Format("15:04:05.000000")
+		}
+		return t.Format("15:04:05")
+	default:
+		if field.Decimal > 0 {
+			return t.Format("2006-01-02 15:04:05.000000")
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+}
+
+// formatBinaryDateTime encodes date and datetime values in the binary protocol layout.
+func formatBinaryDateTime(field *my.Field, t time.Time) []byte {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint16(data[1:], uint16(t.Year()))
+	data[3] = byte(t.Month())
+	data[4] = byte(t.Day())
+
+	if field.Type == my.MYSQL_TYPE_DATE {
+		data[0] = 4
+		return data[:5]
+	}
+
+	data[5] = byte(t.Hour())
+	data[6] = byte(t.Minute())
+	data[7] = byte(t.Second())
+
+	if micro := t.Nanosecond() / 1000; micro != 0 {
+		data[0] = 11
+		binary.LittleEndian.PutUint32(data[8:], uint32(micro))
+		return data
+	}
+
+	data[0] = 7
+	return data[:8]
+}
+
+// formatBinaryTime encodes time values in the binary protocol layout.
+func formatBinaryTime(t time.Time) []byte {
+	data := make([]byte, 13)
+	// is_negative and days are always zero
+	data[6] = byte(t.Hour())
+	data[7] = byte(t.Minute())
+	data[8] = byte(t.Second())
+
+	if micro := t.Nanosecond() / 1000; micro != 0 {
+		data[0] = 12
+		binary.LittleEndian.PutUint32(data[9:], uint32(micro))
+		return data
+	}
+
+	data[0] = 8
+	return data[:9]
+}
+
+func isTimeType(typ uint8) bool {
+	return typ == my.MYSQL_TYPE_TIME || typ == my.MYSQL_TYPE_DATETIME || typ == my.MYSQL_TYPE_TIMESTAMP
+}
+
+func hasFraction(values [][]interface{}, column int) bool {
+	for _, row := range values {
+		if t, ok := toTime(row[column]); ok && t.Nanosecond() != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isConvertible checks if all values of a column could be encoded as the field type.
+func isConvertible(values [][]interface{}, column int, typ uint8) bool {
+	for _, row := range values {
+		v := row[column]
+		if v == nil {
+			continue
+		}
+
+		var ok bool
+		switch typ {
+		case my.MYSQL_TYPE_TINY, my.MYSQL_TYPE_LONGLONG:
+			_, ok = toInt64(v)
+		case my.MYSQL_TYPE_DOUBLE, my.MYSQL_TYPE_NEWDECIMAL:
+			_, ok = toFloat64(v)
+		case my.MYSQL_TYPE_DATE, my.MYSQL_TYPE_TIME, my.MYSQL_TYPE_DATETIME, my.MYSQL_TYPE_TIMESTAMP:
+			_, ok = toTime(v)
+		default:
+			ok = true
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func toInt64(v interface{}) (i int64, ok bool) {
+	switch value := v.(type) {
+	case int64:
+		return value, true
+	case int32:
+		return int64(value), true
+	case int16:
+		return int64(value), true
+	case int8:
+		return int64(value), true
+	case int:
+		return int64(value), true
+	case uint64:
+		return int64(value), true
+	case uint32:
+		return int64(value), true
+	case uint16:
+		return int64(value), true
+	case uint8:
+		return int64(value), true
+	case uint:
+		return int64(value), true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	case float64:
+		if value == math.Trunc(value) {
+			return int64(value), true
+		}
+	case string:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i, true
+		}
+	case []byte:
+		return toInt64(string(value))
+	}
+
+	return
+}
+
+func toFloat64(v interface{}) (f float64, ok bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case string:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, true
+		}
+	case []byte:
+		return toFloat64(string(value))
+	default:
+		var i int64
+		if i, ok = toInt64(v); ok {
+			return float64(i), true
+		}
+	}
+
+	return
+}
+
+func toTime(v interface{}) (t time.Time, ok bool) {
+	switch value := v.(type) {
+	case time.Time:
+		return value, true
+	case string:
+		value = strings.TrimSuffix(value, "Z")
+		for _, layout := range timeFormats {
+			if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+				return t, true
+			}
+		}
+	case []byte:
+		return toTime(string(value))
+	}
+
+	return
+}
@@ -19,7 +19,6 @@ package main
 import (
 	"database/sql"
 	"io"
-	"time"
 )
 
 type rowScanner struct {
@@ -50,19 +49,10 @@ func (s *rowScanner) Scan(src interface{}) error {
 		return io.EOF
 	}
 
-	// type conversions
-	switch srcValue := src.(type) {
-	case []byte:
-		s.fields[s.column] = string(srcValue)
-	case bool:
-		if srcValue {
-			s.fields[s.column] = int8(1)
-		} else {
-			s.fields[s.column] = int8(0)
-		}
-	case time.Time:
-		s.fields[s.column] = srcValue.String()
-	default:
+	// copy bytes, the buffer may be reused by driver
+	if srcValue, ok := src.([]byte); ok {
+		s.fields[s.column] = append([]byte{}, srcValue...)
+	} else {
 		s.fields[s.column] = src
 	}
 
@@ -18,6 +18,8 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -35,6 +37,18 @@ import (
 
 var (
 	apiTimeout = time.Second * 10
+
+	// cdcMaxWait defines the max duration of change long-polling and streaming, within write timeout
+	cdcMaxWait = apiTimeout - 2*time.Second
+	// cdcStreamRetry defines the reconnection delay of change stream clients
+	cdcStreamRetry = time.Second
+	// cdcDefaultLimit defines the default max changes returned at a time
+	cdcDefaultLimit = 100
+
+	// listDefaultLimit defines the default page size of block and query listing
+	listDefaultLimit = 20
+	// listMaxLimit defines the max page size of block and query listing
+	listMaxLimit = 100
 )
 
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
@@ -77,24 +91,7 @@ func (a *explorerAPI) GetAck(rw http.ResponseWriter, r *http.Request) {
 
 	// format ack to json response
 	sendResponse(200, true, "", map[string]interface{}{
-		"ack": map[string]interface{}{
-			"request": map[string]interface{}{
-				"hash":      ack.Response.Request.HeaderHash.String(),
-				"timestamp": a.formatTime(ack.Response.Request.Timestamp),
-				"node":      ack.Response.Request.NodeID,
-				"type":      ack.Response.Request.QueryType.String(),
-				"count":     ack.Response.Request.BatchCount,
-			},
-			"response": map[string]interface{}{
-				"hash":         ack.Response.HeaderHash.String(),
-				"timestamp":    a.formatTime(ack.Response.Timestamp),
-				"node":         ack.Response.NodeID,
-				"log_position": ack.Response.LogOffset,
-			},
-			"hash":      ack.HeaderHash.String(),
-			"timestamp": a.formatTime(ack.AckHeader.Timestamp),
-			"node":      ack.AckHeader.NodeID,
-		},
+		"ack": a.formatAck(ack),
 	}, rw)
 }
 
@@ -240,6 +237,433 @@ func (a *explorerAPI) GetBlockByHeight(rw http.ResponseWriter, r *http.Request)
 	sendResponse(200, true, "", a.formatBlock(height, block), rw)
 }
 
+func (a *explorerAPI) ExportAudit(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = auditFormatJSONL
+	}
+	if format != auditFormatJSONL && format != auditFormatCSV {
+		sendResponse(400, false, ErrUnknownAuditFormat, nil, rw)
+		return
+	}
+
+	filter, err := parseAuditFilter(query.Get("from_height"), query.Get("to_height"),
+		query.Get("since"), query.Get("until"))
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	// records are streamed, start the response on first record so that errors could be reported
+	var aw auditWriter
+	startResponse := func() (err error) {
+		if format == auditFormatCSV {
+			rw.Header().Set("Content-Type", "text/csv")
+		} else {
+			rw.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		aw, err = newAuditWriter(rw, format)
+		return
+	}
+
+	err = a.service.exportAudit(dbID, filter, func(rec *auditRecord) (err error) {
+		if aw == nil {
+			if err = startResponse(); err != nil {
+				return
+			}
+		}
+		return aw.Write(rec)
+	})
+	if err != nil {
+		if aw == nil {
+			sendResponse(500, false, err, nil, rw)
+		} else {
+			log.WithError(err).WithField("db", dbID).Warning("export audit log failed")
+		}
+		return
+	}
+	if aw == nil {
+		if err = startResponse(); err != nil {
+			sendResponse(500, false, err, nil, rw)
+			return
+		}
+	}
+	if err = aw.Flush(); err != nil {
+		log.WithError(err).WithField("db", dbID).Warning("export audit log failed")
+	}
+}
+
+func (a *explorerAPI) getChangesCursor(r *http.Request, dbID proto.DatabaseID) (after uint64, err error) {
+	// reconnecting stream clients keep the original url, so the last event id goes first
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		return strconv.ParseUint(lastID, 10, 64)
+	}
+	query := r.URL.Query()
+	if afterStr := query.Get("after"); afterStr != "" {
+		return strconv.ParseUint(afterStr, 10, 64)
+	}
+	if consumer := query.Get("consumer"); consumer != "" {
+		return a.service.getCheckpoint(dbID, consumer)
+	}
+	return
+}
+
+func (a *explorerAPI) GetChanges(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	after, err := a.getChangesCursor(r, dbID)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	limit := cdcDefaultLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			sendResponse(400, false, "invalid limit", nil, rw)
+			return
+		}
+	}
+
+	var wait time.Duration
+	if waitStr := r.URL.Query().Get("wait"); waitStr != "" {
+		var seconds int
+		if seconds, err = strconv.Atoi(waitStr); err != nil || seconds < 0 {
+			sendResponse(400, false, "invalid wait", nil, rw)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > cdcMaxWait {
+			wait = cdcMaxWait
+		}
+	}
+
+	events, cursor, err := a.service.waitChanges(dbID, after, limit, wait)
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+	if events == nil {
+		events = []*cdcEvent{}
+	}
+
+	sendResponse(200, true, "", map[string]interface{}{
+		"events": events,
+		"cursor": cursor,
+	}, rw)
+}
+
+func (a *explorerAPI) StreamChanges(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	after, err := a.getChangesCursor(r, dbID)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		sendResponse(500, false, "streaming unsupported", nil, rw)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(200)
+	// the response is bounded by the write timeout of server, clients reconnect with the last
+	// event id to resume the stream
+	fmt.Fprintf(rw, "retry: %d\n\n", cdcStreamRetry/time.Millisecond)
+	flusher.Flush()
+
+	deadline := time.Now().Add(cdcMaxWait)
+	for {
+		wait := deadline.Sub(time.Now())
+		if wait <= 0 {
+			return
+		}
+
+		events, cursor, err := a.service.waitChanges(dbID, after, cdcDefaultLimit, wait)
+		if err != nil {
+			log.WithError(err).WithField("db", dbID).Warning("stream changes failed")
+			return
+		}
+
+		for i, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.WithError(err).WithField("db", dbID).Warning("stream changes failed")
+				return
+			}
+			// only the last event of a request carries the id, so the requests are resumed as a whole
+			if i == len(events)-1 || events[i+1].Seq != e.Seq {
+				fmt.Fprintf(rw, "id: %d\n", e.Seq)
+			}
+			fmt.Fprintf(rw, "event: change\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+		after = cursor
+	}
+}
+
+func (a *explorerAPI) GetCheckpoint(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	cursor, err := a.service.getCheckpoint(dbID, vars["consumer"])
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(200, true, "", map[string]interface{}{
+		"consumer": vars["consumer"],
+		"cursor":   cursor,
+	}, rw)
+}
+
+func (a *explorerAPI) SetCheckpoint(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	consumer := vars["consumer"]
+	if consumer == cdcFileConsumer {
+		sendResponse(400, false, "reserved consumer", nil, rw)
+		return
+	}
+
+	cursor, err := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	if err = a.service.setCheckpoint(dbID, consumer, cursor); err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(200, true, "", map[string]interface{}{
+		"consumer": consumer,
+		"cursor":   cursor,
+	}, rw)
+}
+
+// replicaQueryRequest defines the read query sent to replica, the args are bound to the
+// placeholders of query, unnamed args are positional.
+type replicaQueryRequest struct {
+	Query string `json:"query"`
+	Args  []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	} `json:"args"`
+}
+
+func (a *explorerAPI) QueryReplica(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	var req replicaQueryRequest
+	if r.Method == http.MethodPost {
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err = dec.Decode(&req); err != nil {
+			sendResponse(400, false, err, nil, rw)
+			return
+		}
+	} else {
+		req.Query = r.URL.Query().Get("query")
+	}
+	if req.Query == "" {
+		sendResponse(400, false, "empty query", nil, rw)
+		return
+	}
+
+	q := wt.Query{Pattern: req.Query}
+	for _, arg := range req.Args {
+		value := arg.Value
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				value = i
+			} else if f, err := n.Float64(); err == nil {
+				value = f
+			}
+		}
+		q.Args = append(q.Args, sql.Named(arg.Name, value))
+	}
+
+	columns, types, data, offset, err := a.service.queryReplica(dbID, q)
+	if err == ErrReplicaDisabled || err == ErrNotFound {
+		sendResponse(404, false, err, nil, rw)
+		return
+	} else if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	// blobs are encoded as strings, like the text values returned by sqlite
+	for _, row := range data {
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+	}
+
+	sendResponse(200, true, "", map[string]interface{}{
+		"columns": columns,
+		"types":   types,
+		"rows":    data,
+		"offset":  offset,
+	}, rw)
+}
+
+func (a *explorerAPI) getListPage(r *http.Request) (cursor []byte, limit int, err error) {
+	query := r.URL.Query()
+	limit = listDefaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			return
+		}
+		if limit <= 0 || limit > listMaxLimit {
+			limit = listMaxLimit
+		}
+	}
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		if cursor, err = hex.DecodeString(cursorStr); err != nil {
+			err = ErrInvalidCursor
+		}
+	}
+	return
+}
+
+func (a *explorerAPI) ListBlocks(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := parseAuditFilter(query.Get("from_height"), query.Get("to_height"),
+		query.Get("since"), query.Get("until"))
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+	cursor, limit, err := a.getListPage(r)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	records, next, err := a.service.listBlocks(dbID, filter, proto.NodeID(query.Get("producer")), cursor, limit)
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	blocks := make([]interface{}, 0, len(records))
+	for _, rec := range records {
+		blocks = append(blocks, a.formatBlock(rec.Height, rec.Block)["block"])
+	}
+	sendResponse(200, true, "", map[string]interface{}{
+		"blocks": blocks,
+		"next":   hex.EncodeToString(next),
+	}, rw)
+}
+
+func (a *explorerAPI) ListQueries(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &queryFilter{
+		Node:   proto.NodeID(query.Get("node")),
+		Type:   query.Get("type"),
+		Table:  query.Get("table"),
+		Search: query.Get("q"),
+	}
+	if filter.Type != "" && filter.Type != wt.ReadQuery.String() && filter.Type != wt.WriteQuery.String() {
+		sendResponse(400, false, "invalid query type", nil, rw)
+		return
+	}
+	if filter.Range, err = parseAuditFilter("", "", query.Get("since"), query.Get("until")); err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+	cursor, limit, err := a.getListPage(r)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	records, next, err := a.service.listQueries(dbID, filter, cursor, limit)
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	queries := make([]interface{}, 0, len(records))
+	for _, rec := range records {
+		q := a.formatAck(rec.Ack)
+		if rec.Height >= 0 {
+			q["height"] = rec.Height
+		}
+		if rec.Request != nil {
+			q["request"].(map[string]interface{})["queries"] = a.formatQueries(rec.Request.Payload.Queries)
+		}
+		queries = append(queries, q)
+	}
+	sendResponse(200, true, "", map[string]interface{}{
+		"queries": queries,
+		"next":    hex.EncodeToString(next),
+	}, rw)
+}
+
 func (a *explorerAPI) getHighestBlock(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
@@ -343,11 +767,45 @@ func (a *explorerAPI) formatBlockV2(count, height int32, b *ct.Block) map[string
 	}
 }
 
+func (a *explorerAPI) formatAck(ack *wt.SignedAckHeader) map[string]interface{} {
+	return map[string]interface{}{
+		"request": map[string]interface{}{
+			"hash":      ack.Response.Request.HeaderHash.String(),
+			"timestamp": a.formatTime(ack.Response.Request.Timestamp),
+			"node":      ack.Response.Request.NodeID,
+			"type":      ack.Response.Request.QueryType.String(),
+			"count":     ack.Response.Request.BatchCount,
+		},
+		"response": map[string]interface{}{
+			"hash":         ack.Response.HeaderHash.String(),
+			"timestamp":    a.formatTime(ack.Response.Timestamp),
+			"node":         ack.Response.NodeID,
+			"log_position": ack.Response.LogOffset,
+		},
+		"hash":      ack.HeaderHash.String(),
+		"timestamp": a.formatTime(ack.AckHeader.Timestamp),
+		"node":      ack.AckHeader.NodeID,
+	}
+}
+
 func (a *explorerAPI) formatRequest(req *wt.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"request": map[string]interface{}{
+			"hash":      req.Header.HeaderHash.String(),
+			"timestamp": a.formatTime(req.Header.Timestamp),
+			"node":      req.Header.NodeID,
+			"type":      req.Header.QueryType.String(),
+			"count":     req.Header.BatchCount,
+			"queries":   a.formatQueries(req.Payload.Queries),
+		},
+	}
+}
+
+func (a *explorerAPI) formatQueries(inQueries []wt.Query) []map[string]interface{} {
 	// get queries
-	queries := make([]map[string]interface{}, 0, req.Header.BatchCount)
+	queries := make([]map[string]interface{}, 0, len(inQueries))
 
-	for _, q := range req.Payload.Queries {
+	for _, q := range inQueries {
 		args := make([]map[string]interface{}, 0, len(q.Args))
 
 		for _, a := range q.Args {
@@ -363,16 +821,7 @@ func (a *explorerAPI) formatRequest(req *wt.Request) map[string]interface{} {
 		})
 	}
 
-	return map[string]interface{}{
-		"request": map[string]interface{}{
-			"hash":      req.Header.HeaderHash.String(),
-			"timestamp": a.formatTime(req.Header.Timestamp),
-			"node":      req.Header.NodeID,
-			"type":      req.Header.QueryType.String(),
-			"count":     req.Header.BatchCount,
-			"queries":   queries,
-		},
-	}
+	return queries
 }
 
 func (a *explorerAPI) formatTime(t time.Time) float64 {
@@ -412,6 +861,14 @@ func startAPI(service *Service, listenAddr string) (server *http.Server, err err
 	v1Router.HandleFunc("/count/{db}/{count:[0-9]+}", api.GetBlockByCount).Methods("GET")
 	v1Router.HandleFunc("/height/{db}/{height:[0-9]+}", api.GetBlockByHeight).Methods("GET")
 	v1Router.HandleFunc("/head/{db}", api.getHighestBlock).Methods("GET")
+	v1Router.HandleFunc("/blocks/{db}", api.ListBlocks).Methods("GET")
+	v1Router.HandleFunc("/queries/{db}", api.ListQueries).Methods("GET")
+	v1Router.HandleFunc("/audit/{db}", api.ExportAudit).Methods("GET")
+	v1Router.HandleFunc("/cdc/{db}", api.GetChanges).Methods("GET")
+	v1Router.HandleFunc("/cdc/{db}/stream", api.StreamChanges).Methods("GET")
+	v1Router.HandleFunc("/cdc/{db}/checkpoint/{consumer}", api.GetCheckpoint).Methods("GET")
+	v1Router.HandleFunc("/cdc/{db}/checkpoint/{consumer}", api.SetCheckpoint).Methods("POST")
+	v1Router.HandleFunc("/replica/{db}/query", api.QueryReplica).Methods("GET", "POST")
 	v2Router := router.PathPrefix("/v2").Subrouter()
 	v2Router.HandleFunc("/head/{db}", api.getHighestBlockV2).Methods("GET")
 
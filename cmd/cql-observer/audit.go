@@ -0,0 +1,531 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// auditFormatJSONL defines the JSON Lines audit log format, which is verifiable offline.
+	auditFormatJSONL = "jsonl"
+	// auditFormatCSV defines the CSV audit log format.
+	auditFormatCSV = "csv"
+)
+
+var (
+	// ErrUnknownAuditFormat defines error on exporting audit log in unknown format.
+	ErrUnknownAuditFormat = errors.New("unknown audit log format")
+	// ErrInvalidAuditFilter defines error on exporting audit log with invalid filter.
+	ErrInvalidAuditFilter = errors.New("invalid audit log filter")
+	// ErrAuditVerification defines error on audit log containing unverifiable records.
+	ErrAuditVerification = errors.New("audit log verification failed")
+
+	auditCSVHeader = []string{
+		"database", "height", "block_hash", "timestamp", "signer", "node", "type",
+		"request_hash", "ack_hash", "log_offset", "sql", "proof_index", "proof",
+	}
+)
+
+// auditFilter defines the block height and query time range of audit log export, both inclusive.
+type auditFilter struct {
+	FromHeight int32
+	ToHeight   int32 // negative for no limit
+	Since      time.Time
+	Until      time.Time
+}
+
+func (f *auditFilter) matchTime(t time.Time) bool {
+	return (f.Since.IsZero() || !t.Before(f.Since)) && (f.Until.IsZero() || !t.After(f.Until))
+}
+
+// parseAuditFilter parses the audit filter from string arguments, the time range is in RFC3339
+// format, empty arguments are not limited.
+func parseAuditFilter(fromHeight, toHeight, since, until string) (f *auditFilter, err error) {
+	f = &auditFilter{ToHeight: -1}
+	var h int64
+	if fromHeight != "" {
+		if h, err = strconv.ParseInt(fromHeight, 10, 32); err != nil {
+			return
+		}
+		if h < 0 {
+			err = ErrInvalidAuditFilter
+			return
+		}
+		f.FromHeight = int32(h)
+	}
+	if toHeight != "" {
+		if h, err = strconv.ParseInt(toHeight, 10, 32); err != nil {
+			return
+		}
+		f.ToHeight = int32(h)
+	}
+	if since != "" {
+		if f.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return
+		}
+	}
+	if until != "" {
+		if f.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// auditQuery defines a single query in the audited request.
+type auditQuery struct {
+	Pattern string     `json:"pattern"`
+	Args    []auditArg `json:"args,omitempty"`
+}
+
+type auditArg struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// auditRecord defines a single acknowledged query of audit log. The raw fields contain the signed
+// block header, ack and request, so the record could be verified without the observer.
+type auditRecord struct {
+	Database    proto.DatabaseID `json:"database"`
+	Height      int32            `json:"height"`
+	BlockHash   string           `json:"block_hash"`
+	Timestamp   time.Time        `json:"timestamp"`
+	Signer      string           `json:"signer"`
+	Node        proto.NodeID     `json:"node"`
+	Type        string           `json:"type"`
+	RequestHash string           `json:"request_hash"`
+	AckHash     string           `json:"ack_hash"`
+	LogOffset   uint64           `json:"log_offset"`
+	Queries     []auditQuery     `json:"queries,omitempty"`
+	ProofIndex  uint64           `json:"proof_index"`
+	Proof       []string         `json:"proof"`
+
+	RawBlockHeader []byte `json:"raw_block_header"`
+	RawAck         []byte `json:"raw_ack,omitempty"`
+	RawRequest     []byte `json:"raw_request,omitempty"`
+}
+
+func (r *auditRecord) setAck(ack *wt.SignedAckHeader) (err error) {
+	req := ack.SignedRequestHeader()
+	var signer proto.AccountAddress
+	if signer, err = crypto.PubKeyHash(req.Signee); err != nil {
+		return
+	}
+
+	r.Timestamp = req.Timestamp.UTC()
+	r.Signer = signer.String()
+	r.Node = req.NodeID
+	r.Type = req.QueryType.String()
+	r.RequestHash = req.HeaderHash.String()
+	r.LogOffset = ack.SignedResponseHeader().LogOffset
+	return
+}
+
+func (r *auditRecord) setRequest(req *wt.Request) {
+	r.Queries = make([]auditQuery, 0, len(req.Payload.Queries))
+	for _, q := range req.Payload.Queries {
+		aq := auditQuery{Pattern: q.Pattern}
+		for _, a := range q.Args {
+			aq.Args = append(aq.Args, auditArg{Name: a.Name, Value: a.Value})
+		}
+		r.Queries = append(r.Queries, aq)
+	}
+}
+
+func (r *auditRecord) sql() string {
+	patterns := make([]string, len(r.Queries))
+	for i, q := range r.Queries {
+		patterns[i] = q.Pattern
+	}
+	return strings.Join(patterns, "; ")
+}
+
+// exportAudit iterates the acknowledged queries of blocks in the filter range ordered by block
+// height. The read requests are not logged by miners, so only write requests have sql text.
+func (s *Service) exportAudit(dbID proto.DatabaseID, f *auditFilter, fn func(*auditRecord) error) error {
+	return s.db.View(func(tx *bolt.Tx) (err error) {
+		bb := tx.Bucket(blockBucket).Bucket([]byte(dbID))
+		if bb == nil {
+			return ErrNotFound
+		}
+		ab := tx.Bucket(ackBucket).Bucket([]byte(dbID))
+		ob := tx.Bucket(logOffsetBucket).Bucket([]byte(dbID))
+		rb := tx.Bucket(requestBucket).Bucket([]byte(dbID))
+
+		cur := bb.Cursor()
+		for k, v := cur.Seek(int32ToBytes(f.FromHeight)); k != nil; k, v = cur.Next() {
+			height := bytesToInt32(k[:4])
+			if f.ToHeight >= 0 && height > f.ToHeight {
+				break
+			}
+
+			var b *ct.Block
+			if err = utils.DecodeMsgPack(v, &b); err != nil {
+				return
+			}
+			if len(b.Queries) == 0 {
+				continue
+			}
+
+			var rawHeader *bytes.Buffer
+			if rawHeader, err = utils.EncodeMsgPack(&b.SignedHeader); err != nil {
+				return
+			}
+			tree := merkle.NewMerkle(b.Queries)
+
+			for i, q := range b.Queries {
+				r := &auditRecord{
+					Database:       dbID,
+					Height:         height,
+					BlockHash:      b.BlockHash().String(),
+					Timestamp:      b.Timestamp().UTC(),
+					AckHash:        q.String(),
+					ProofIndex:     uint64(i),
+					RawBlockHeader: rawHeader.Bytes(),
+				}
+
+				var proof []hash.Hash
+				if proof, err = tree.GetProof(uint64(i)); err != nil {
+					return
+				}
+				r.Proof = make([]string, len(proof))
+				for j := range proof {
+					r.Proof[j] = proof[j].String()
+				}
+
+				// the ack may be missing if the observer has not received it, keep the record with
+				// block information only, which is reported by the verifier
+				var ack *wt.SignedAckHeader
+				if ab != nil {
+					if r.RawAck = ab.Get(q[:]); r.RawAck != nil {
+						if err = utils.DecodeMsgPack(r.RawAck, &ack); err != nil {
+							return
+						}
+						if err = r.setAck(ack); err != nil {
+							return
+						}
+					}
+				}
+
+				if ack != nil && ack.SignedRequestHeader().QueryType == wt.WriteQuery && ob != nil && rb != nil {
+					reqHash := ack.SignedRequestHeader().HeaderHash
+					if offset := ob.Get(reqHash[:]); offset != nil {
+						reqKey := append(append([]byte{}, offset...), reqHash[:]...)
+						if r.RawRequest = rb.Get(reqKey); r.RawRequest != nil {
+							var req *wt.Request
+							if err = utils.DecodeMsgPack(r.RawRequest, &req); err != nil {
+								return
+							}
+							r.setRequest(req)
+						}
+					}
+				}
+
+				if !f.matchTime(r.Timestamp) {
+					continue
+				}
+
+				if err = fn(r); err != nil {
+					return
+				}
+			}
+		}
+
+		return
+	})
+}
+
+// auditWriter defines the audit log writer of specified format.
+type auditWriter interface {
+	Write(r *auditRecord) error
+	Flush() error
+}
+
+func newAuditWriter(w io.Writer, format string) (aw auditWriter, err error) {
+	switch format {
+	case "", auditFormatJSONL:
+		aw = &jsonlAuditWriter{enc: json.NewEncoder(w)}
+	case auditFormatCSV:
+		cw := csv.NewWriter(w)
+		if err = cw.Write(auditCSVHeader); err != nil {
+			return
+		}
+		aw = &csvAuditWriter{w: cw}
+	default:
+		err = ErrUnknownAuditFormat
+	}
+	return
+}
+
+type jsonlAuditWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlAuditWriter) Write(r *auditRecord) error {
+	return w.enc.Encode(r)
+}
+
+func (w *jsonlAuditWriter) Flush() error {
+	return nil
+}
+
+type csvAuditWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvAuditWriter) Write(r *auditRecord) error {
+	return w.w.Write([]string{
+		string(r.Database),
+		strconv.FormatInt(int64(r.Height), 10),
+		r.BlockHash,
+		r.Timestamp.Format(time.RFC3339Nano),
+		r.Signer,
+		string(r.Node),
+		r.Type,
+		r.RequestHash,
+		r.AckHash,
+		strconv.FormatUint(r.LogOffset, 10),
+		r.sql(),
+		strconv.FormatUint(r.ProofIndex, 10),
+		strings.Join(r.Proof, " "),
+	})
+}
+
+func (w *csvAuditWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// verifyAuditRecord checks the block header signature, the inclusion proof of ack, the signatures
+// of ack and request, and the readable fields of record against the signed data.
+func verifyAuditRecord(r *auditRecord) (err error) {
+	var header *ct.SignedHeader
+	if err = utils.DecodeMsgPack(r.RawBlockHeader, &header); err != nil {
+		return
+	}
+	var enc []byte
+	if enc, err = header.Header.MarshalHash(); err != nil {
+		return
+	}
+	if h := hash.THashH(enc); !h.IsEqual(&header.BlockHash) || h.String() != r.BlockHash {
+		return fmt.Errorf("block hash mismatch")
+	}
+	if err = header.Verify(); err != nil {
+		return fmt.Errorf("invalid block signature: %v", err)
+	}
+
+	if r.RawAck == nil {
+		return fmt.Errorf("ack not found")
+	}
+	var ack *wt.SignedAckHeader
+	if err = utils.DecodeMsgPack(r.RawAck, &ack); err != nil {
+		return
+	}
+	if err = ack.Verify(); err != nil {
+		return fmt.Errorf("invalid ack signature: %v", err)
+	}
+	if ack.HeaderHash.String() != r.AckHash {
+		return fmt.Errorf("ack hash mismatch")
+	}
+	proof := make([]hash.Hash, len(r.Proof))
+	for i, p := range r.Proof {
+		var h *hash.Hash
+		if h, err = hash.NewHashFromStr(p); err != nil {
+			return
+		}
+		proof[i] = *h
+	}
+	if !merkle.VerifyProof(&ack.HeaderHash, r.ProofIndex, proof, &header.MerkleRoot) {
+		return fmt.Errorf("invalid inclusion proof")
+	}
+
+	expected := &auditRecord{}
+	if err = expected.setAck(ack); err != nil {
+		return
+	}
+	if expected.Timestamp != r.Timestamp || expected.Signer != r.Signer || expected.Node != r.Node ||
+		expected.Type != r.Type || expected.RequestHash != r.RequestHash || expected.LogOffset != r.LogOffset {
+		return fmt.Errorf("record fields mismatch signed ack")
+	}
+	if ack.SignedRequestHeader().DatabaseID != r.Database {
+		return fmt.Errorf("record database mismatch signed ack")
+	}
+
+	if r.RawRequest == nil {
+		if len(r.Queries) > 0 {
+			return fmt.Errorf("request not found")
+		}
+		return nil
+	}
+	var req *wt.Request
+	if err = utils.DecodeMsgPack(r.RawRequest, &req); err != nil {
+		return
+	}
+	if err = req.Verify(); err != nil {
+		return fmt.Errorf("invalid request signature: %v", err)
+	}
+	if req.Header.HeaderHash.String() != r.RequestHash {
+		return fmt.Errorf("request hash mismatch")
+	}
+	if req.Header.DatabaseID != r.Database {
+		return fmt.Errorf("record database mismatch signed request")
+	}
+	expected.setRequest(req)
+	if err = compareAuditQueries(expected.Queries, r.Queries); err != nil {
+		return
+	}
+
+	return nil
+}
+
+// compareAuditQueries compares the queries of signed request with the ones of record, which are
+// decoded from JSON, so the signed ones take the same JSON round trip to normalize arg values.
+func compareAuditQueries(signed []auditQuery, record []auditQuery) (err error) {
+	var enc []byte
+	if enc, err = json.Marshal(signed); err != nil {
+		return
+	}
+	var normalized []auditQuery
+	if err = json.Unmarshal(enc, &normalized); err != nil {
+		return
+	}
+	if len(normalized) == 0 && len(record) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(normalized, record) {
+		return fmt.Errorf("record queries mismatch signed request")
+	}
+	return
+}
+
+// verifyAuditLog verifies all records of JSON Lines audit log, returns the number of records and
+// the failed ones.
+func verifyAuditLog(in io.Reader) (total int, failed int, err error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		total++
+
+		var r auditRecord
+		if err = json.Unmarshal(line, &r); err == nil {
+			err = verifyAuditRecord(&r)
+		}
+		if err != nil {
+			failed++
+			log.WithFields(log.Fields{
+				"record": total,
+				"height": r.Height,
+				"ack":    r.AckHash,
+			}).WithError(err).Error("audit record verification failed")
+			err = nil
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
+
+func runAuditExport(file string) (err error) {
+	if dbID == "" {
+		return errors.New("database is required for audit log export")
+	}
+
+	var filter *auditFilter
+	if filter, err = parseAuditFilter(auditFromHeight, auditToHeight, auditSince, auditUntil); err != nil {
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if file != "-" {
+		var f *os.File
+		if f, err = os.Create(file); err != nil {
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var service *Service
+	if service, err = NewService(); err != nil {
+		return
+	}
+	defer service.db.Close()
+
+	var aw auditWriter
+	if aw, err = newAuditWriter(out, auditFormat); err != nil {
+		return
+	}
+	var count int
+	if err = service.exportAudit(proto.DatabaseID(dbID), filter, func(r *auditRecord) error {
+		count++
+		return aw.Write(r)
+	}); err != nil {
+		return
+	}
+	if err = aw.Flush(); err != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{"db": dbID, "records": count}).Info("exported audit log")
+	return
+}
+
+func runAuditVerify(file string) (err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var total, failed int
+	if total, failed, err = verifyAuditLog(f); err != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{"records": total, "failed": failed}).Info("verified audit log")
+	if failed > 0 {
+		err = ErrAuditVerification
+	}
+	return
+}
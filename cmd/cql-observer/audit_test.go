@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/coreos/bbolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func addTestAuditQuery(
+	s *Service, dbID proto.DatabaseID, priv *asymmetric.PrivateKey, offset uint64, queries ...string,
+) (ack *wt.SignedAckHeader, err error) {
+	req := &wt.Request{
+		Header: wt.SignedRequestHeader{
+			RequestHeader: wt.RequestHeader{
+				QueryType:    wt.WriteQuery,
+				NodeID:       proto.NodeID("client"),
+				DatabaseID:   dbID,
+				ConnectionID: 1,
+				SeqNo:        offset,
+				Timestamp:    time.Now().UTC(),
+			},
+		},
+	}
+	for _, q := range queries {
+		req.Payload.Queries = append(req.Payload.Queries, wt.Query{
+			Pattern: q,
+			Args:    []sql.NamedArg{sql.Named("offset", int64(offset))},
+		})
+	}
+	if err = req.Sign(priv); err != nil {
+		return
+	}
+	resp := &wt.Response{
+		Header: wt.SignedResponseHeader{
+			ResponseHeader: wt.ResponseHeader{
+				Request:   req.Header,
+				NodeID:    proto.NodeID("miner"),
+				Timestamp: time.Now().UTC(),
+				LogOffset: offset,
+			},
+		},
+	}
+	if err = resp.Sign(priv); err != nil {
+		return
+	}
+	a := &wt.Ack{
+		Header: wt.SignedAckHeader{
+			AckHeader: wt.AckHeader{
+				Response:  resp.Header,
+				NodeID:    proto.NodeID("client"),
+				Timestamp: time.Now().UTC(),
+			},
+		},
+	}
+	if err = a.Sign(priv); err != nil {
+		return
+	}
+	ack = &a.Header
+
+	reqBytes, err := utils.EncodeMsgPack(req)
+	if err != nil {
+		return
+	}
+	ackBytes, err := utils.EncodeMsgPack(ack)
+	if err != nil {
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		qb, err := tx.Bucket(requestBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		key := append(offsetToBytes(offset), req.Header.HeaderHash.CloneBytes()...)
+		if err = qb.Put(key, reqBytes.Bytes()); err != nil {
+			return
+		}
+		ob, err := tx.Bucket(logOffsetBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		if err = ob.Put(req.Header.HeaderHash.CloneBytes(), offsetToBytes(offset)); err != nil {
+			return
+		}
+		ab, err := tx.Bucket(ackBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		return ab.Put(ack.HeaderHash.CloneBytes(), ackBytes.Bytes())
+	})
+	return
+}
+
+func addTestAuditBlock(
+	s *Service, dbID proto.DatabaseID, priv *asymmetric.PrivateKey, height int32, acks ...*wt.SignedAckHeader,
+) (err error) {
+	b := &ct.Block{
+		SignedHeader: ct.SignedHeader{
+			Header: ct.Header{
+				Version:   0x01000000,
+				Producer:  proto.NodeID("miner"),
+				Timestamp: time.Now().UTC(),
+			},
+		},
+	}
+	for _, ack := range acks {
+		b.PushAckedQuery(&ack.HeaderHash)
+	}
+	if err = b.PackAndSignBlock(priv); err != nil {
+		return
+	}
+	blockBytes, err := utils.EncodeMsgPack(b)
+	if err != nil {
+		return
+	}
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		bb, err := tx.Bucket(blockBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		key := append(int32ToBytes(height), b.BlockHash().CloneBytes()...)
+		return bb.Put(key, blockBytes.Bytes())
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	Convey("Given an observer database with acknowledged queries", t, func() {
+		tmp, err := ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		conf.GConf = &conf.Config{WorkingRoot: tmp}
+		s, err := NewService()
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.db.Close()
+			os.RemoveAll(tmp)
+		})
+
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		dbID := proto.DatabaseID("db")
+
+		var acks []*wt.SignedAckHeader
+		for i := 0; i < 3; i++ {
+			ack, err := addTestAuditQuery(s, dbID, priv, uint64(i), "INSERT INTO t VALUES (1)", "DELETE FROM t")
+			So(err, ShouldBeNil)
+			acks = append(acks, ack)
+		}
+		So(addTestAuditBlock(s, dbID, priv, 1, acks[0]), ShouldBeNil)
+		So(addTestAuditBlock(s, dbID, priv, 2, acks[1:]...), ShouldBeNil)
+
+		Convey("The audit log should be exported and verified", func() {
+			var buf bytes.Buffer
+			aw, err := newAuditWriter(&buf, auditFormatJSONL)
+			So(err, ShouldBeNil)
+			err = s.exportAudit(dbID, &auditFilter{ToHeight: -1}, aw.Write)
+			So(err, ShouldBeNil)
+			So(aw.Flush(), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(lines, ShouldHaveLength, 3)
+			var r auditRecord
+			So(json.Unmarshal([]byte(lines[2]), &r), ShouldBeNil)
+			So(r.Height, ShouldEqual, 2)
+			So(r.LogOffset, ShouldEqual, 2)
+			So(r.sql(), ShouldEqual, "INSERT INTO t VALUES (1); DELETE FROM t")
+
+			total, failed, err := verifyAuditLog(bytes.NewReader(buf.Bytes()))
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 3)
+			So(failed, ShouldEqual, 0)
+
+			// tamper the sql text
+			r.Queries[1].Pattern = "DROP TABLE t"
+			tampered, err := json.Marshal(&r)
+			So(err, ShouldBeNil)
+			lines[2] = string(tampered)
+			// tamper the proof
+			So(json.Unmarshal([]byte(lines[1]), &r), ShouldBeNil)
+			r.Proof[0] = hash.Hash{}.String()
+			tampered, err = json.Marshal(&r)
+			So(err, ShouldBeNil)
+			lines[1] = string(tampered)
+			total, failed, err = verifyAuditLog(strings.NewReader(strings.Join(lines, "\n")))
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 3)
+			So(failed, ShouldEqual, 2)
+
+			// tamper the args and the database
+			load := func() (r *auditRecord) {
+				r = &auditRecord{}
+				So(json.Unmarshal([]byte(lines[0]), r), ShouldBeNil)
+				return
+			}
+			So(verifyAuditRecord(load()), ShouldBeNil)
+			r0 := load()
+			r0.Queries[0].Args[0].Value = 100
+			So(verifyAuditRecord(r0), ShouldNotBeNil)
+			r0 = load()
+			r0.Queries[0].Args = nil
+			So(verifyAuditRecord(r0), ShouldNotBeNil)
+			r0 = load()
+			r0.Database = proto.DatabaseID("other")
+			So(verifyAuditRecord(r0), ShouldNotBeNil)
+		})
+
+		Convey("The audit log should be filtered by height and exported as csv", func() {
+			var buf bytes.Buffer
+			aw, err := newAuditWriter(&buf, auditFormatCSV)
+			So(err, ShouldBeNil)
+			filter, err := parseAuditFilter("2", "2", "", "")
+			So(err, ShouldBeNil)
+			So(s.exportAudit(dbID, filter, aw.Write), ShouldBeNil)
+			So(aw.Flush(), ShouldBeNil)
+
+			records, err := csv.NewReader(&buf).ReadAll()
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 3)
+			So(records[0], ShouldResemble, auditCSVHeader)
+			So(records[1][1], ShouldEqual, "2")
+
+			filter, err = parseAuditFilter("", "", "", time.Now().Add(-time.Hour).Format(time.RFC3339))
+			So(err, ShouldBeNil)
+			var count int
+			So(s.exportAudit(dbID, filter, func(*auditRecord) error {
+				count++
+				return nil
+			}), ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			_, err = newAuditWriter(&buf, "xml")
+			So(err, ShouldEqual, ErrUnknownAuditFormat)
+			_, err = parseAuditFilter("-1", "", "", "")
+			So(err, ShouldEqual, ErrInvalidAuditFilter)
+			So(s.exportAudit("unknown", filter, nil), ShouldEqual, ErrNotFound)
+		})
+	})
+}
@@ -0,0 +1,760 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/coreos/bbolt"
+)
+
+// Following contains the change data capture of observer, the write requests are decoded to row
+// level change events once the acks are received. The events are published to the stream of
+// database in log offset order once the blocks containing the acks are received, each published
+// request gets a sequence number of the stream, which is used as the resumable cursor of consumers.
+
+const (
+	// cdcOpInsert defines the insert change operation.
+	cdcOpInsert = "insert"
+	// cdcOpReplace defines the replace change operation.
+	cdcOpReplace = "replace"
+	// cdcOpUpdate defines the update change operation.
+	cdcOpUpdate = "update"
+	// cdcOpDelete defines the delete change operation.
+	cdcOpDelete = "delete"
+	// cdcOpDDL defines the schema change operation.
+	cdcOpDDL = "ddl"
+	// cdcOpUnknown defines the change operation of statements could not be decoded.
+	cdcOpUnknown = "unknown"
+
+	// cdcFileConsumer defines the reserved consumer name of the ndjson file sink.
+	cdcFileConsumer = "_file"
+	// cdcFileBatch defines the max events read by file sink at a time.
+	cdcFileBatch = 1000
+	// cdcMaxGapBlocks defines the blocks to wait for the missing log offsets before skipping them.
+	cdcMaxGapBlocks = 10
+)
+
+// cdcEvent defines a single row level change of database.
+type cdcEvent struct {
+	Database    proto.DatabaseID       `json:"database"`
+	Seq         uint64                 `json:"seq"`
+	Index       int                    `json:"index"`
+	Height      int32                  `json:"height"`
+	LogOffset   uint64                 `json:"log_offset"`
+	Timestamp   time.Time              `json:"timestamp"`
+	RequestHash string                 `json:"request_hash"`
+	Table       string                 `json:"table,omitempty"`
+	Operation   string                 `json:"operation"`
+	Key         map[string]interface{} `json:"key,omitempty"`
+	Values      map[string]interface{} `json:"values,omitempty"`
+	Statement   string                 `json:"statement,omitempty"`
+}
+
+// cdcRequest defines the changes of a write request waiting to be published.
+type cdcRequest struct {
+	LogOffset uint64      `json:"log_offset"`
+	Height    int32       `json:"height"`
+	Events    []*cdcEvent `json:"events"`
+}
+
+// cdcTable defines the table schema learned from the create table statements of stream.
+type cdcTable struct {
+	Columns    []string `json:"columns"`
+	PrimaryKey []string `json:"primary_key,omitempty"`
+}
+
+// cdcDecoder decodes write requests to change events with the table schemas of database.
+type cdcDecoder struct {
+	schema *bolt.Bucket
+}
+
+func (d *cdcDecoder) getTable(name string) (t *cdcTable) {
+	if raw := d.schema.Get([]byte(name)); raw != nil {
+		if err := json.Unmarshal(raw, &t); err != nil {
+			t = nil
+		}
+	}
+	return
+}
+
+func (d *cdcDecoder) putTable(name string, t *cdcTable) (err error) {
+	var raw []byte
+	if raw, err = json.Marshal(t); err != nil {
+		return
+	}
+	return d.schema.Put([]byte(name), raw)
+}
+
+// decode returns the change events of request, the events are not published yet.
+func (d *cdcDecoder) decode(req *wt.Request) (events []*cdcEvent, err error) {
+	for _, q := range req.Payload.Queries {
+		var qe []*cdcEvent
+		if qe, err = d.decodeQuery(&q); err != nil {
+			return
+		}
+		events = append(events, qe...)
+	}
+
+	for i, e := range events {
+		e.Database = req.Header.DatabaseID
+		e.Index = i
+		e.Height = -1
+		e.Timestamp = req.Header.Timestamp.UTC()
+		e.RequestHash = req.Header.HeaderHash.String()
+	}
+	return
+}
+
+func (d *cdcDecoder) decodeQuery(q *wt.Query) (events []*cdcEvent, err error) {
+	tokenizer := sqlparser.NewStringTokenizer(q.Pattern)
+	args := &cdcArgs{args: q.Args}
+
+	for {
+		stmt, perr := sqlparser.ParseNext(tokenizer)
+		if perr == io.EOF {
+			break
+		}
+		if perr != nil {
+			// the rest of query could not be split reliably
+			events = append(events, &cdcEvent{Operation: cdcOpUnknown, Statement: q.Pattern})
+			break
+		}
+
+		var se []*cdcEvent
+		if se, err = d.decodeStatement(stmt, args); err != nil {
+			return
+		}
+		events = append(events, se...)
+		args.next(stmt)
+	}
+	return
+}
+
+func (d *cdcDecoder) decodeStatement(stmt sqlparser.Statement, args *cdcArgs) (events []*cdcEvent, err error) {
+	switch s := stmt.(type) {
+	case *sqlparser.Insert:
+		table := strings.ToLower(s.Table.Name.String())
+		op := cdcOpInsert
+		if s.Action == sqlparser.ReplaceStr {
+			op = cdcOpReplace
+		}
+		rows, ok := s.Rows.(sqlparser.Values)
+		if !ok {
+			// insert from select, the rows are not derivable
+			events = append(events, &cdcEvent{Table: table, Operation: op, Statement: sqlparser.String(s)})
+			return
+		}
+
+		t := d.getTable(table)
+		columns := make([]string, len(s.Columns))
+		for i, c := range s.Columns {
+			columns[i] = c.Lowered()
+		}
+		if len(columns) == 0 && t != nil {
+			columns = t.Columns
+		}
+
+		for _, row := range rows {
+			e := &cdcEvent{Table: table, Operation: op}
+			if len(row) == len(columns) {
+				e.Values = make(map[string]interface{}, len(row))
+				for i, expr := range row {
+					if v, ok := args.eval(expr); ok {
+						e.Values[columns[i]] = v
+					}
+				}
+				if t != nil {
+					e.Key = primaryKey(t, e.Values)
+				}
+			}
+			events = append(events, e)
+		}
+	case *sqlparser.Update:
+		e := &cdcEvent{Table: tableOf(s.TableExprs), Operation: cdcOpUpdate}
+		e.Values = make(map[string]interface{}, len(s.Exprs))
+		for _, ue := range s.Exprs {
+			if v, ok := args.eval(ue.Expr); ok {
+				e.Values[ue.Name.Name.Lowered()] = v
+			}
+		}
+		e.Key = d.whereKey(e.Table, s.Where, args)
+		events = append(events, e)
+	case *sqlparser.Delete:
+		e := &cdcEvent{Table: tableOf(s.TableExprs), Operation: cdcOpDelete}
+		e.Key = d.whereKey(e.Table, s.Where, args)
+		events = append(events, e)
+	case *sqlparser.DDL:
+		table := strings.ToLower(s.Table.Name.String())
+		if table == "" {
+			table = strings.ToLower(s.NewName.Name.String())
+		}
+		events = append(events, &cdcEvent{Table: table, Operation: cdcOpDDL, Statement: sqlparser.String(s)})
+		err = d.applyDDL(s)
+	}
+	return
+}
+
+func (d *cdcDecoder) applyDDL(s *sqlparser.DDL) (err error) {
+	switch s.Action {
+	case sqlparser.CreateStr:
+		if s.TableSpec == nil {
+			return
+		}
+		t := &cdcTable{}
+		for _, c := range s.TableSpec.Columns {
+			t.Columns = append(t.Columns, c.Name.Lowered())
+			// the column key option is not exported by parser
+			if strings.Contains(sqlparser.String(&c.Type), "primary key") {
+				t.PrimaryKey = append(t.PrimaryKey, c.Name.Lowered())
+			}
+		}
+		for _, idx := range s.TableSpec.Indexes {
+			if idx.Info.Primary {
+				t.PrimaryKey = t.PrimaryKey[:0]
+				for _, c := range idx.Columns {
+					t.PrimaryKey = append(t.PrimaryKey, c.Column.Lowered())
+				}
+			}
+		}
+		return d.putTable(strings.ToLower(s.NewName.Name.String()), t)
+	case sqlparser.DropStr:
+		return d.schema.Delete([]byte(strings.ToLower(s.Table.Name.String())))
+	case sqlparser.RenameStr:
+		from := strings.ToLower(s.Table.Name.String())
+		if t := d.getTable(from); t != nil {
+			if err = d.putTable(strings.ToLower(s.NewName.Name.String()), t); err != nil {
+				return
+			}
+			return d.schema.Delete([]byte(from))
+		}
+	}
+	return
+}
+
+// whereKey returns the equality conditions of where clause, only the primary key columns are
+// returned if the table schema is known and the conditions contain the whole primary key.
+func (d *cdcDecoder) whereKey(table string, where *sqlparser.Where, args *cdcArgs) (key map[string]interface{}) {
+	if where == nil {
+		return
+	}
+	key = make(map[string]interface{})
+	collectEqualities(where.Expr, args, key)
+	if t := d.getTable(table); t != nil {
+		if pk := primaryKey(t, key); pk != nil {
+			key = pk
+		}
+	}
+	if len(key) == 0 {
+		key = nil
+	}
+	return
+}
+
+func collectEqualities(expr sqlparser.Expr, args *cdcArgs, key map[string]interface{}) {
+	switch e := expr.(type) {
+	case *sqlparser.AndExpr:
+		collectEqualities(e.Left, args, key)
+		collectEqualities(e.Right, args, key)
+	case *sqlparser.ParenExpr:
+		collectEqualities(e.Expr, args, key)
+	case *sqlparser.ComparisonExpr:
+		if e.Operator != sqlparser.EqualStr {
+			return
+		}
+		col, ok := e.Left.(*sqlparser.ColName)
+		value := e.Right
+		if !ok {
+			if col, ok = e.Right.(*sqlparser.ColName); !ok {
+				return
+			}
+			value = e.Left
+		}
+		if v, ok := args.eval(value); ok {
+			key[col.Name.Lowered()] = v
+		}
+	}
+}
+
+func primaryKey(t *cdcTable, values map[string]interface{}) (key map[string]interface{}) {
+	if len(t.PrimaryKey) == 0 {
+		return
+	}
+	key = make(map[string]interface{}, len(t.PrimaryKey))
+	for _, c := range t.PrimaryKey {
+		v, ok := values[c]
+		if !ok {
+			return nil
+		}
+		key[c] = v
+	}
+	return
+}
+
+func tableOf(exprs sqlparser.TableExprs) string {
+	if len(exprs) != 1 {
+		return ""
+	}
+	if ate, ok := exprs[0].(*sqlparser.AliasedTableExpr); ok {
+		if tn, ok := ate.Expr.(sqlparser.TableName); ok {
+			return strings.ToLower(tn.Name.String())
+		}
+	}
+	return ""
+}
+
+// cdcArgs binds the arguments of query to placeholders, the positional placeholders of each
+// statement are numbered from 1 by parser and consume the unnamed arguments in order.
+type cdcArgs struct {
+	args []sql.NamedArg
+	base int
+}
+
+func (a *cdcArgs) eval(expr sqlparser.Expr) (v interface{}, ok bool) {
+	switch e := expr.(type) {
+	case *sqlparser.NullVal:
+		return nil, true
+	case sqlparser.BoolVal:
+		return bool(e), true
+	case *sqlparser.UnaryExpr:
+		if e.Operator != sqlparser.UMinusStr {
+			return
+		}
+		if v, ok = a.eval(e.Expr); !ok {
+			return
+		}
+		switch n := v.(type) {
+		case int64:
+			return -n, true
+		case float64:
+			return -n, true
+		}
+		return nil, false
+	case *sqlparser.SQLVal:
+		switch e.Type {
+		case sqlparser.StrVal:
+			return string(e.Val), true
+		case sqlparser.IntVal:
+			if i, err := strconv.ParseInt(string(e.Val), 10, 64); err == nil {
+				return i, true
+			}
+			return string(e.Val), true
+		case sqlparser.FloatVal:
+			if f, err := strconv.ParseFloat(string(e.Val), 64); err == nil {
+				return f, true
+			}
+		case sqlparser.HexVal:
+			if b, err := hex.DecodeString(string(e.Val)); err == nil {
+				return b, true
+			}
+		case sqlparser.ValArg:
+			return a.lookup(string(e.Val))
+		}
+	}
+	return
+}
+
+func (a *cdcArgs) lookup(name string) (v interface{}, ok bool) {
+	if n, isPos := positionalIndex(name); isPos {
+		pos := a.base + n - 1
+		for _, arg := range a.args {
+			if arg.Name != "" {
+				continue
+			}
+			if pos == 0 {
+				return arg.Value, true
+			}
+			pos--
+		}
+		return
+	}
+	name = strings.TrimPrefix(name, ":")
+	for _, arg := range a.args {
+		if arg.Name == name {
+			return arg.Value, true
+		}
+	}
+	return
+}
+
+// next advances the positional arguments consumed by statement.
+func (a *cdcArgs) next(stmt sqlparser.Statement) {
+	var count int
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if v, ok := node.(*sqlparser.SQLVal); ok && v.Type == sqlparser.ValArg {
+			if n, isPos := positionalIndex(string(v.Val)); isPos && n > count {
+				count = n
+			}
+		}
+		return true, nil
+	}, stmt)
+	a.base += count
+}
+
+func positionalIndex(name string) (n int, ok bool) {
+	if !strings.HasPrefix(name, ":v") {
+		return
+	}
+	var err error
+	if n, err = strconv.Atoi(name[2:]); err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// addChanges decodes the write request of ack and stages the changes if the block containing
+// the ack is received, otherwise the changes are kept pending until the block arrives.
+func (s *Service) addChanges(tx *bolt.Tx, dbID proto.DatabaseID, ack *wt.SignedAckHeader, req *wt.Request) (err error) {
+	sb, err := tx.Bucket(cdcSchemaBucket).CreateBucketIfNotExists([]byte(dbID))
+	if err != nil {
+		return
+	}
+	d := &cdcDecoder{schema: sb}
+	var events []*cdcEvent
+	if events, err = d.decode(req); err != nil {
+		return
+	}
+	// requests without changes are still staged to advance the log offset of stream
+	c := &cdcRequest{LogOffset: ack.Response.LogOffset, Height: -1, Events: events}
+	for _, e := range events {
+		e.LogOffset = c.LogOffset
+	}
+
+	if hb := tx.Bucket(ackHeightBucket).Bucket([]byte(dbID)); hb != nil {
+		if h := hb.Get(ack.HeaderHash[:]); h != nil {
+			c.Height = bytesToInt32(h)
+			if err = stageChanges(tx, dbID, c); err != nil {
+				return
+			}
+			return s.flushChanges(tx, dbID, -1)
+		}
+	}
+
+	pb, err := tx.Bucket(cdcPendingBucket).CreateBucketIfNotExists([]byte(dbID))
+	if err != nil {
+		return
+	}
+	var raw []byte
+	if raw, err = json.Marshal(c); err != nil {
+		return
+	}
+	return pb.Put(ack.HeaderHash[:], raw)
+}
+
+// publishPendingChanges stages the pending changes of acks in the block and publishes the staged
+// changes in log offset order.
+func (s *Service) publishPendingChanges(tx *bolt.Tx, dbID proto.DatabaseID, height int32, acks [][]byte) (err error) {
+	if pb := tx.Bucket(cdcPendingBucket).Bucket([]byte(dbID)); pb != nil {
+		for _, ack := range acks {
+			raw := pb.Get(ack)
+			if raw == nil {
+				continue
+			}
+			c := &cdcRequest{}
+			if err = json.Unmarshal(raw, c); err != nil {
+				return
+			}
+			c.Height = height
+			if err = stageChanges(tx, dbID, c); err != nil {
+				return
+			}
+			if err = pb.Delete(ack); err != nil {
+				return
+			}
+		}
+	}
+	return s.flushChanges(tx, dbID, height)
+}
+
+// stageChanges keeps the changes of request with known block height until all the requests
+// before its log offset are published.
+func stageChanges(tx *bolt.Tx, dbID proto.DatabaseID, c *cdcRequest) (err error) {
+	rb, err := tx.Bucket(cdcStagedBucket).CreateBucketIfNotExists([]byte(dbID))
+	if err != nil {
+		return
+	}
+	var raw []byte
+	if raw, err = json.Marshal(c); err != nil {
+		return
+	}
+	return rb.Put(offsetToBytes(c.LogOffset), raw)
+}
+
+// flushChanges publishes the staged changes from the next expected log offset of stream and
+// stops at the first gap. A gap is skipped if the request after it has been staged for
+// cdcMaxGapBlocks blocks before height, the missing requests are never acked in this case.
+// The gap is never skipped with a negative height.
+func (s *Service) flushChanges(tx *bolt.Tx, dbID proto.DatabaseID, height int32) (err error) {
+	rb := tx.Bucket(cdcStagedBucket).Bucket([]byte(dbID))
+	if rb == nil {
+		return
+	}
+	ob := tx.Bucket(cdcOffsetBucket)
+	next := uint64(1)
+	if raw := ob.Get([]byte(dbID)); raw != nil {
+		next = bytesToOffset(raw)
+	}
+
+	cur := rb.Cursor()
+	for k, v := cur.First(); k != nil; k, v = cur.First() {
+		c := &cdcRequest{}
+		if err = json.Unmarshal(v, c); err != nil {
+			return
+		}
+		if c.LogOffset > next {
+			if height < 0 || height-c.Height < cdcMaxGapBlocks {
+				break
+			}
+			log.WithFields(log.Fields{
+				"database": dbID,
+				"from":     next,
+				"to":       c.LogOffset - 1,
+			}).Warning("skip change log offsets never acked")
+		} else if c.LogOffset < next {
+			log.WithFields(log.Fields{
+				"database": dbID,
+				"offset":   c.LogOffset,
+			}).Warning("publish change acked after skipped")
+		}
+		if len(c.Events) > 0 {
+			if err = s.publishChanges(tx, dbID, c.Height, c.Events); err != nil {
+				return
+			}
+		}
+		if err = rb.Delete(k); err != nil {
+			return
+		}
+		if c.LogOffset >= next {
+			next = c.LogOffset + 1
+		}
+	}
+	return ob.Put([]byte(dbID), offsetToBytes(next))
+}
+
+func (s *Service) publishChanges(tx *bolt.Tx, dbID proto.DatabaseID, height int32, events []*cdcEvent) (err error) {
+	cb, err := tx.Bucket(cdcBucket).CreateBucketIfNotExists([]byte(dbID))
+	if err != nil {
+		return
+	}
+	var seq uint64
+	if seq, err = cb.NextSequence(); err != nil {
+		return
+	}
+	for _, e := range events {
+		e.Seq = seq
+		e.Height = height
+	}
+	var raw []byte
+	if raw, err = json.Marshal(events); err != nil {
+		return
+	}
+	if err = cb.Put(offsetToBytes(seq), raw); err != nil {
+		return
+	}
+
+	// notify the waiting consumers after commit
+	tx.OnCommit(s.notifyChanges)
+	return
+}
+
+func (s *Service) notifyChanges() {
+	s.cdcLock.Lock()
+	defer s.cdcLock.Unlock()
+	close(s.cdcNotify)
+	s.cdcNotify = make(chan struct{})
+}
+
+func (s *Service) waitChangesNotify() <-chan struct{} {
+	s.cdcLock.Lock()
+	defer s.cdcLock.Unlock()
+	return s.cdcNotify
+}
+
+// readChanges returns the changes published after the cursor, the changes of a request are not
+// split even if the limit is exceeded. The returned cursor is the sequence of last request read.
+func (s *Service) readChanges(dbID proto.DatabaseID, after uint64, limit int) (
+	events []*cdcEvent, cursor uint64, err error) {
+	cursor = after
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		cb := tx.Bucket(cdcBucket).Bucket([]byte(dbID))
+		if cb == nil {
+			return
+		}
+		cur := cb.Cursor()
+		for k, v := cur.Seek(offsetToBytes(after + 1)); k != nil; k, v = cur.Next() {
+			var re []*cdcEvent
+			if err = json.Unmarshal(v, &re); err != nil {
+				return
+			}
+			events = append(events, re...)
+			cursor = bytesToOffset(k)
+			if limit > 0 && len(events) >= limit {
+				break
+			}
+		}
+		return
+	})
+	return
+}
+
+// waitChanges reads the changes after cursor, and waits for new changes up to timeout if there is
+// none yet.
+func (s *Service) waitChanges(dbID proto.DatabaseID, after uint64, limit int, timeout time.Duration) (
+	events []*cdcEvent, cursor uint64, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		notify := s.waitChangesNotify()
+		if events, cursor, err = s.readChanges(dbID, after, limit); err != nil || len(events) > 0 {
+			return
+		}
+		select {
+		case <-notify:
+		case <-timer.C:
+			return
+		case <-s.stopCh:
+			err = ErrStopped
+			return
+		}
+	}
+}
+
+// getCheckpoint returns the cursor committed by consumer, 0 if the consumer is new.
+func (s *Service) getCheckpoint(dbID proto.DatabaseID, consumer string) (cursor uint64, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if cb := tx.Bucket(cdcCheckpointBucket).Bucket([]byte(dbID)); cb != nil {
+			if raw := cb.Get([]byte(consumer)); raw != nil {
+				cursor = bytesToOffset(raw)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// setCheckpoint commits the cursor of consumer.
+func (s *Service) setCheckpoint(dbID proto.DatabaseID, consumer string, cursor uint64) (err error) {
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		cb, err := tx.Bucket(cdcCheckpointBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		return cb.Put([]byte(consumer), offsetToBytes(cursor))
+	})
+}
+
+// startFileSink starts appending the changes of all databases to newline-delimited json files in
+// dir, named by database id. The sink commits its own checkpoints after the files are synced, so
+// the changes are delivered at least once, consumers could deduplicate them by seq and index.
+func (s *Service) startFileSink(dir string) {
+	s.wg.Add(1)
+	go s.runFileSink(dir)
+}
+
+func (s *Service) runFileSink(dir string) {
+	defer s.wg.Done()
+
+	for {
+		notify := s.waitChangesNotify()
+		if err := s.syncFiles(dir); err != nil {
+			log.WithError(err).Warning("write change files failed")
+		}
+		select {
+		case <-notify:
+		case <-time.After(blockProducePeriod):
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *Service) syncFiles(dir string) (err error) {
+	var dbs []proto.DatabaseID
+	if err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(cdcBucket).ForEach(func(k, _ []byte) error {
+			dbs = append(dbs, proto.DatabaseID(string(k)))
+			return nil
+		})
+	}); err != nil {
+		return
+	}
+
+	for _, dbID := range dbs {
+		if err = s.syncFile(dir, dbID); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Service) syncFile(dir string, dbID proto.DatabaseID) (err error) {
+	var after uint64
+	if after, err = s.getCheckpoint(dbID, cdcFileConsumer); err != nil {
+		return
+	}
+
+	var f *os.File
+	for {
+		var (
+			events []*cdcEvent
+			cursor uint64
+		)
+		if events, cursor, err = s.readChanges(dbID, after, cdcFileBatch); err != nil || len(events) == 0 {
+			break
+		}
+		if f == nil {
+			path := filepath.Join(dir, string(dbID)+".ndjson")
+			if f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+				return
+			}
+			defer f.Close()
+		}
+
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for _, e := range events {
+			if err = enc.Encode(e); err != nil {
+				return
+			}
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+		if err = f.Sync(); err != nil {
+			return
+		}
+		if err = s.setCheckpoint(dbID, cdcFileConsumer, cursor); err != nil {
+			return
+		}
+		after = cursor
+	}
+	return
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/coreos/bbolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestChangeRequest(offset uint64, pattern string, args ...sql.NamedArg) (
+	ack *wt.SignedAckHeader, req *wt.Request) {
+	req = &wt.Request{}
+	req.Header.DatabaseID = proto.DatabaseID("db")
+	req.Header.Timestamp = time.Now().UTC()
+	req.Header.HeaderHash = hash.HashH([]byte(pattern))
+	req.Payload.Queries = []wt.Query{{Pattern: pattern, Args: args}}
+	ack = &wt.SignedAckHeader{}
+	ack.Response.LogOffset = offset
+	ack.HeaderHash = hash.HashH(req.Header.HeaderHash[:])
+	return
+}
+
+func TestChangeDataCapture(t *testing.T) {
+	Convey("Given an observer database", t, func() {
+		tmp, err := ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		conf.GConf = &conf.Config{WorkingRoot: tmp}
+		s, err := NewService()
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.db.Close()
+			os.RemoveAll(tmp)
+		})
+		dbID := proto.DatabaseID("db")
+
+		addChanges := func(ack *wt.SignedAckHeader, req *wt.Request) error {
+			return s.db.Update(func(tx *bolt.Tx) error {
+				return s.addChanges(tx, dbID, ack, req)
+			})
+		}
+		publish := func(height int32, acks ...*wt.SignedAckHeader) error {
+			return s.db.Update(func(tx *bolt.Tx) (err error) {
+				keys := make([][]byte, len(acks))
+				for i, ack := range acks {
+					keys[i] = ack.HeaderHash.CloneBytes()
+				}
+				return s.publishPendingChanges(tx, dbID, height, keys)
+			})
+		}
+
+		Convey("The write requests should be decoded and published with block", func() {
+			ack1, req1 := newTestChangeRequest(1,
+				"CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL); "+
+					"INSERT INTO t VALUES (?, :name, -1.5), (2, 'b', NULL)",
+				sql.Named("", 1), sql.Named("name", "a"))
+			ack2, req2 := newTestChangeRequest(2,
+				"UPDATE t SET name = ? WHERE id = ? AND name = 'a'; DELETE FROM t WHERE (id = ?)",
+				sql.Named("", "c"), sql.Named("", 1), sql.Named("", 2))
+			ack3, req3 := newTestChangeRequest(3, "INSERT INTO t SELECT * FROM t; PRAGMA foreign_keys = ON")
+			So(addChanges(ack1, req1), ShouldBeNil)
+			So(addChanges(ack2, req2), ShouldBeNil)
+
+			// not published before the block arrives
+			events, cursor, err := s.readChanges(dbID, 0, 0)
+			So(err, ShouldBeNil)
+			So(events, ShouldBeEmpty)
+			So(cursor, ShouldEqual, 0)
+
+			So(publish(5, ack1, ack2), ShouldBeNil)
+			events, cursor, err = s.readChanges(dbID, 0, 0)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldEqual, 2)
+			So(events, ShouldHaveLength, 5)
+
+			So(events[0].Operation, ShouldEqual, cdcOpDDL)
+			So(events[0].Table, ShouldEqual, "t")
+			So(events[1].Operation, ShouldEqual, cdcOpInsert)
+			So(events[1].Seq, ShouldEqual, 1)
+			So(events[1].Height, ShouldEqual, 5)
+			So(events[1].LogOffset, ShouldEqual, 1)
+			So(events[1].Index, ShouldEqual, 1)
+			So(events[1].Key, ShouldResemble, map[string]interface{}{"id": float64(1)})
+			So(events[1].Values, ShouldResemble, map[string]interface{}{
+				"id": float64(1), "name": "a", "score": -1.5,
+			})
+			So(events[2].Key, ShouldResemble, map[string]interface{}{"id": float64(2)})
+			So(events[2].Values["score"], ShouldBeNil)
+
+			So(events[3].Operation, ShouldEqual, cdcOpUpdate)
+			So(events[3].Seq, ShouldEqual, 2)
+			So(events[3].Key, ShouldResemble, map[string]interface{}{"id": float64(1)})
+			So(events[3].Values, ShouldResemble, map[string]interface{}{"name": "c"})
+			So(events[4].Operation, ShouldEqual, cdcOpDelete)
+			So(events[4].Key, ShouldResemble, map[string]interface{}{"id": float64(2)})
+
+			// block received before the ack
+			So(s.db.Update(func(tx *bolt.Tx) (err error) {
+				hb, err := tx.Bucket(ackHeightBucket).CreateBucketIfNotExists([]byte(dbID))
+				if err != nil {
+					return
+				}
+				return hb.Put(ack3.HeaderHash[:], int32ToBytes(6))
+			}), ShouldBeNil)
+			So(addChanges(ack3, req3), ShouldBeNil)
+			events, cursor, err = s.readChanges(dbID, 2, 1)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldEqual, 3)
+			So(events, ShouldHaveLength, 2)
+			So(events[0].Height, ShouldEqual, 6)
+			So(events[0].Statement, ShouldNotBeEmpty)
+			So(events[1].Operation, ShouldEqual, cdcOpUnknown)
+
+			// limit should not split changes of a request
+			events, cursor, err = s.readChanges(dbID, 0, 1)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldEqual, 1)
+			So(events, ShouldHaveLength, 3)
+		})
+
+		Convey("The changes should be published in log offset order", func() {
+			ack1, req1 := newTestChangeRequest(1, "INSERT INTO t (a) VALUES (1)")
+			ack2, req2 := newTestChangeRequest(2, "INSERT INTO t (a) VALUES (2)")
+			ack3, req3 := newTestChangeRequest(3, "SELECT 1")
+			ack4, req4 := newTestChangeRequest(4, "INSERT INTO t (a) VALUES (4)")
+			ack5, req5 := newTestChangeRequest(5, "INSERT INTO t (a) VALUES (5)")
+			ack6, req6 := newTestChangeRequest(6, "INSERT INTO t (a) VALUES (6)")
+			So(addChanges(ack3, req3), ShouldBeNil)
+			So(addChanges(ack2, req2), ShouldBeNil)
+
+			// offset 1 is not received yet
+			So(publish(1, ack3, ack2), ShouldBeNil)
+			events, _, err := s.readChanges(dbID, 0, 0)
+			So(err, ShouldBeNil)
+			So(events, ShouldBeEmpty)
+
+			So(addChanges(ack1, req1), ShouldBeNil)
+			So(publish(2, ack1), ShouldBeNil)
+			events, cursor, err := s.readChanges(dbID, 0, 0)
+			So(err, ShouldBeNil)
+			So(cursor, ShouldEqual, 2)
+			So(events, ShouldHaveLength, 2)
+			So(events[0].LogOffset, ShouldEqual, 1)
+			So(events[0].Height, ShouldEqual, 2)
+			So(events[1].LogOffset, ShouldEqual, 2)
+			So(events[1].Height, ShouldEqual, 1)
+
+			// offset 4 is held until the gap times out
+			So(addChanges(ack5, req5), ShouldBeNil)
+			So(publish(3, ack5), ShouldBeNil)
+			So(publish(3+cdcMaxGapBlocks-1), ShouldBeNil)
+			events, _, err = s.readChanges(dbID, cursor, 0)
+			So(err, ShouldBeNil)
+			So(events, ShouldBeEmpty)
+			So(publish(3+cdcMaxGapBlocks), ShouldBeNil)
+			events, cursor, err = s.readChanges(dbID, cursor, 0)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].LogOffset, ShouldEqual, 5)
+
+			// skipped offset acked later is still published
+			So(addChanges(ack4, req4), ShouldBeNil)
+			So(publish(3+cdcMaxGapBlocks, ack4), ShouldBeNil)
+			So(addChanges(ack6, req6), ShouldBeNil)
+			So(publish(4+cdcMaxGapBlocks, ack6), ShouldBeNil)
+			events, _, err = s.readChanges(dbID, cursor, 0)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 2)
+			So(events[0].LogOffset, ShouldEqual, 4)
+			So(events[1].LogOffset, ShouldEqual, 6)
+		})
+
+		Convey("The consumers should wait for changes and commit checkpoints", func() {
+			ack, req := newTestChangeRequest(1, "INSERT INTO t (a) VALUES (1)")
+			So(addChanges(ack, req), ShouldBeNil)
+
+			events, _, err := s.waitChanges(dbID, 0, 0, 10*time.Millisecond)
+			So(err, ShouldBeNil)
+			So(events, ShouldBeEmpty)
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				publish(1, ack)
+			}()
+			events, cursor, err := s.waitChanges(dbID, 0, 0, time.Second)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Values, ShouldResemble, map[string]interface{}{"a": float64(1)})
+			So(events[0].Key, ShouldBeNil)
+
+			cp, err := s.getCheckpoint(dbID, "search")
+			So(err, ShouldBeNil)
+			So(cp, ShouldEqual, 0)
+			So(s.setCheckpoint(dbID, "search", cursor), ShouldBeNil)
+			cp, err = s.getCheckpoint(dbID, "search")
+			So(err, ShouldBeNil)
+			So(cp, ShouldEqual, cursor)
+
+			// file sink
+			So(s.syncFiles(tmp), ShouldBeNil)
+			So(s.syncFiles(tmp), ShouldBeNil)
+			content, err := ioutil.ReadFile(filepath.Join(tmp, "db.ndjson"))
+			So(err, ShouldBeNil)
+			So(strings.Count(string(content), "\n"), ShouldEqual, 1)
+			cp, err = s.getCheckpoint(dbID, cdcFileConsumer)
+			So(err, ShouldBeNil)
+			So(cp, ShouldEqual, cursor)
+		})
+	})
+}
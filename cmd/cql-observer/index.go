@@ -0,0 +1,392 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/coreos/bbolt"
+)
+
+// Following contains the secondary indexes of observer for listing and searching blocks and
+// queries. Each index entry is keyed by the indexed field and value, followed by the sort key of
+// the indexed object, which is the height and hash of blocks, or the request timestamp and ack
+// hash of queries. So the entries of a field value are iterated in height or time order, and the
+// other filters are checked by probing the entries with the same sort key.
+
+const (
+	// indexFieldProducer defines the index field of block producer.
+	indexFieldProducer = "producer"
+	// indexFieldTime defines the index field of query time, which indexes all queries.
+	indexFieldTime = "time"
+	// indexFieldNode defines the index field of query signer.
+	indexFieldNode = "node"
+	// indexFieldType defines the index field of query type.
+	indexFieldType = "type"
+	// indexFieldTable defines the index field of tables referenced by write queries.
+	indexFieldTable = "table"
+	// indexFieldTerm defines the index field of terms in sql patterns of write queries.
+	indexFieldTerm = "term"
+
+	// indexMaxTermLength defines the max length of indexed terms, longer terms are skipped.
+	indexMaxTermLength = 64
+
+	blockSortKeyLength = 4 + 32
+	querySortKeyLength = 8 + 32
+)
+
+var (
+	// ErrInvalidCursor defines error on listing with malformed pagination cursor.
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+)
+
+// queryFilter defines the filter of listing queries, the time range is inclusive and the empty
+// fields are not limited.
+type queryFilter struct {
+	Range  *auditFilter
+	Node   proto.NodeID
+	Type   string
+	Table  string
+	Search string
+}
+
+// queryRecord defines an acknowledged query in listing, the request is only available for write
+// queries and the height is negative if the block containing the ack is not received yet.
+type queryRecord struct {
+	Ack     *wt.SignedAckHeader
+	Request *wt.Request
+	Height  int32
+}
+
+// blockRecord defines a block in listing.
+type blockRecord struct {
+	Height int32
+	Block  *ct.Block
+}
+
+func indexPrefix(field string, value string) []byte {
+	prefix := make([]byte, 0, len(field)+len(value)+2)
+	prefix = append(prefix, field...)
+	prefix = append(prefix, 0)
+	prefix = append(prefix, value...)
+	return append(prefix, 0)
+}
+
+func indexKey(field string, value string, sortKey []byte) []byte {
+	return append(indexPrefix(field, value), sortKey...)
+}
+
+// indexTerms splits text to lower case terms of letters, digits and underscores.
+func indexTerms(text string) (terms []string) {
+	seen := make(map[string]bool)
+	for _, t := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if len(t) > indexMaxTermLength || seen[t] {
+			continue
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	return
+}
+
+// requestTables returns the tables referenced by queries of request, the queries could not be
+// parsed are skipped.
+func requestTables(req *wt.Request) (tables []string) {
+	seen := make(map[string]bool)
+	for _, q := range req.Payload.Queries {
+		tokenizer := sqlparser.NewStringTokenizer(q.Pattern)
+		for {
+			stmt, err := sqlparser.ParseNext(tokenizer)
+			if err != nil {
+				break
+			}
+			sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+				if tn, ok := node.(sqlparser.TableName); ok && !tn.IsEmpty() {
+					name := strings.ToLower(tn.Name.String())
+					if !seen[name] {
+						seen[name] = true
+						tables = append(tables, name)
+					}
+				}
+				return true, nil
+			}, stmt)
+		}
+	}
+	return
+}
+
+func querySortKey(ack *wt.SignedAckHeader) []byte {
+	key := offsetToBytes(uint64(ack.Response.Request.Timestamp.UnixNano()))
+	return append(key, ack.HeaderHash.CloneBytes()...)
+}
+
+// indexQuery adds the index entries of acknowledged query, the request is nil for read queries.
+func indexQuery(tx *bolt.Tx, dbID proto.DatabaseID, ack *wt.SignedAckHeader, req *wt.Request) (err error) {
+	ib, err := tx.Bucket(queryIndexBucket).CreateBucketIfNotExists([]byte(dbID))
+	if err != nil {
+		return
+	}
+	sortKey := querySortKey(ack)
+	keys := [][]byte{
+		indexKey(indexFieldTime, "", sortKey),
+		indexKey(indexFieldNode, string(ack.Response.Request.NodeID), sortKey),
+		indexKey(indexFieldType, ack.Response.Request.QueryType.String(), sortKey),
+	}
+	if req != nil {
+		for _, t := range requestTables(req) {
+			keys = append(keys, indexKey(indexFieldTable, t, sortKey))
+		}
+		patterns := make([]string, 0, len(req.Payload.Queries))
+		for _, q := range req.Payload.Queries {
+			patterns = append(patterns, q.Pattern)
+		}
+		for _, t := range indexTerms(strings.Join(patterns, "\n")) {
+			keys = append(keys, indexKey(indexFieldTerm, t, sortKey))
+		}
+	}
+	for _, k := range keys {
+		if err = ib.Put(k, []byte{}); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// indexBlock adds the index entries of block stored with key of height and hash.
+func indexBlock(tx *bolt.Tx, dbID proto.DatabaseID, key []byte, b *ct.Block) (err error) {
+	ib, err := tx.Bucket(blockIndexBucket).CreateBucketIfNotExists([]byte(dbID))
+	if err != nil {
+		return
+	}
+	return ib.Put(indexKey(indexFieldProducer, string(b.Producer()), key), []byte{})
+}
+
+// buildIndexes builds the indexes of blocks and queries stored before the indexes are introduced.
+func buildIndexes(tx *bolt.Tx) (err error) {
+	if err = tx.Bucket(blockBucket).ForEach(func(rawDBID, v []byte) (err error) {
+		bb := tx.Bucket(blockBucket).Bucket(rawDBID)
+		if v != nil || bb == nil {
+			return
+		}
+		return bb.ForEach(func(k, v []byte) (err error) {
+			var b *ct.Block
+			if err = utils.DecodeMsgPack(v, &b); err != nil {
+				return
+			}
+			return indexBlock(tx, proto.DatabaseID(rawDBID), append([]byte{}, k...), b)
+		})
+	}); err != nil {
+		return
+	}
+
+	return tx.Bucket(ackBucket).ForEach(func(rawDBID, v []byte) (err error) {
+		ab := tx.Bucket(ackBucket).Bucket(rawDBID)
+		if v != nil || ab == nil {
+			return
+		}
+		dbID := proto.DatabaseID(rawDBID)
+		return ab.ForEach(func(k, v []byte) (err error) {
+			var ack *wt.SignedAckHeader
+			if err = utils.DecodeMsgPack(v, &ack); err != nil {
+				return
+			}
+			var req *wt.Request
+			if ack.Response.Request.QueryType == wt.WriteQuery {
+				if req, err = getRequestTx(tx, dbID, ack.Response.Request.HeaderHash[:]); err == ErrNotFound {
+					err = nil
+				} else if err != nil {
+					return
+				}
+			}
+			return indexQuery(tx, dbID, ack, req)
+		})
+	})
+}
+
+// listQueries lists the acknowledged queries matching filter in time order, starting from the
+// cursor returned by previous listing. The returned cursor is nil if there are no more queries.
+func (s *Service) listQueries(dbID proto.DatabaseID, f *queryFilter, cursor []byte, limit int) (
+	records []*queryRecord, next []byte, err error) {
+	if cursor != nil && len(cursor) != querySortKeyLength {
+		err = ErrInvalidCursor
+		return
+	}
+
+	// the most selective field drives the iteration, others are probed
+	prefixes := make([][]byte, 0)
+	for _, t := range indexTerms(f.Search) {
+		prefixes = append(prefixes, indexPrefix(indexFieldTerm, t))
+	}
+	if f.Table != "" {
+		prefixes = append(prefixes, indexPrefix(indexFieldTable, strings.ToLower(f.Table)))
+	}
+	if f.Node != "" {
+		prefixes = append(prefixes, indexPrefix(indexFieldNode, string(f.Node)))
+	}
+	if f.Type != "" {
+		prefixes = append(prefixes, indexPrefix(indexFieldType, f.Type))
+	}
+	prefixes = append(prefixes, indexPrefix(indexFieldTime, ""))
+
+	var since, until []byte
+	if !f.Range.Since.IsZero() {
+		since = offsetToBytes(uint64(f.Range.Since.UnixNano()))
+	}
+	if !f.Range.Until.IsZero() {
+		until = offsetToBytes(uint64(f.Range.Until.UnixNano()))
+	}
+	if cursor == nil || bytes.Compare(cursor, since) < 0 {
+		cursor = since
+	}
+
+	records = make([]*queryRecord, 0)
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		ib := tx.Bucket(queryIndexBucket).Bucket([]byte(dbID))
+		ab := tx.Bucket(ackBucket).Bucket([]byte(dbID))
+		if ib == nil || ab == nil {
+			return
+		}
+		hb := tx.Bucket(ackHeightBucket).Bucket([]byte(dbID))
+
+		cur := ib.Cursor()
+		for k, _ := cur.Seek(append(prefixes[0], cursor...)); k != nil && bytes.HasPrefix(k, prefixes[0]); k, _ = cur.Next() {
+			sortKey := k[len(prefixes[0]):]
+			if len(sortKey) != querySortKeyLength {
+				continue
+			}
+			if until != nil && bytes.Compare(sortKey[:8], until) > 0 {
+				break
+			}
+			if !probeIndex(ib, prefixes[1:], sortKey) {
+				continue
+			}
+			if len(records) >= limit {
+				next = append([]byte{}, sortKey...)
+				break
+			}
+
+			rec := &queryRecord{Height: -1}
+			ackBytes := ab.Get(sortKey[8:])
+			if ackBytes == nil {
+				continue
+			}
+			if err = utils.DecodeMsgPack(ackBytes, &rec.Ack); err != nil {
+				return
+			}
+			if rec.Ack.Response.Request.QueryType == wt.WriteQuery {
+				if rec.Request, err = getRequestTx(
+					tx, dbID, rec.Ack.Response.Request.HeaderHash[:]); err == ErrNotFound {
+					err = nil
+				} else if err != nil {
+					return
+				}
+			}
+			if hb != nil {
+				if h := hb.Get(sortKey[8:]); h != nil {
+					rec.Height = bytesToInt32(h)
+				}
+			}
+			records = append(records, rec)
+		}
+		return
+	})
+	return
+}
+
+func probeIndex(ib *bolt.Bucket, prefixes [][]byte, sortKey []byte) bool {
+	for _, p := range prefixes {
+		if ib.Get(append(append([]byte{}, p...), sortKey...)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// listBlocks lists the blocks in height and time range of filter in height order, starting from
+// the cursor returned by previous listing. The returned cursor is nil if there are no more blocks.
+func (s *Service) listBlocks(dbID proto.DatabaseID, f *auditFilter, producer proto.NodeID,
+	cursor []byte, limit int) (records []*blockRecord, next []byte, err error) {
+	if cursor != nil && len(cursor) != blockSortKeyLength {
+		err = ErrInvalidCursor
+		return
+	}
+	from := int32ToBytes(f.FromHeight)
+	if cursor == nil || bytes.Compare(cursor, from) < 0 {
+		cursor = from
+	}
+
+	records = make([]*blockRecord, 0)
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		bb := tx.Bucket(blockBucket).Bucket([]byte(dbID))
+		if bb == nil {
+			return
+		}
+
+		// iterate the producer index or the blocks directly, both are keyed by height and hash
+		var (
+			cur    = bb.Cursor()
+			prefix []byte
+		)
+		if producer != "" {
+			ib := tx.Bucket(blockIndexBucket).Bucket([]byte(dbID))
+			if ib == nil {
+				return
+			}
+			cur = ib.Cursor()
+			prefix = indexPrefix(indexFieldProducer, string(producer))
+		}
+
+		for k, _ := cur.Seek(append(prefix, cursor...)); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+			key := k[len(prefix):]
+			if len(key) != blockSortKeyLength {
+				continue
+			}
+			height := bytesToInt32(key[:4])
+			if f.ToHeight >= 0 && height > f.ToHeight {
+				break
+			}
+			blockBytes := bb.Get(key)
+			if blockBytes == nil {
+				continue
+			}
+			var b *ct.Block
+			if err = utils.DecodeMsgPack(blockBytes, &b); err != nil {
+				return
+			}
+			if !f.matchTime(b.Timestamp()) {
+				continue
+			}
+			if len(records) >= limit {
+				next = append([]byte{}, key...)
+				break
+			}
+			records = append(records, &blockRecord{Height: height, Block: b})
+		}
+		return
+	})
+	return
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/coreos/bbolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIndex(t *testing.T) {
+	Convey("Given an observer database", t, func() {
+		tmp, err := ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		conf.GConf = &conf.Config{WorkingRoot: tmp}
+		s, err := NewService()
+		So(err, ShouldBeNil)
+		Reset(func() {
+			s.db.Close()
+			os.RemoveAll(tmp)
+		})
+		dbID := proto.DatabaseID("db")
+		base := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+		addQuery := func(i int, node proto.NodeID, pattern string) error {
+			ack := &wt.SignedAckHeader{}
+			ack.HeaderHash = hash.HashH([]byte(fmt.Sprintf("ack%d", i)))
+			ack.Response.Request.NodeID = node
+			ack.Response.Request.Timestamp = base.Add(time.Duration(i) * time.Second)
+			ack.Response.Request.HeaderHash = hash.HashH([]byte(fmt.Sprintf("req%d", i)))
+			ack.Response.LogOffset = uint64(i)
+			var req *wt.Request
+			if pattern != "" {
+				ack.Response.Request.QueryType = wt.WriteQuery
+				req = &wt.Request{}
+				req.Header = ack.Response.Request
+				req.Payload.Queries = []wt.Query{{Pattern: pattern}}
+			}
+			return s.db.Update(func(tx *bolt.Tx) (err error) {
+				ab, err := tx.Bucket(ackBucket).CreateBucketIfNotExists([]byte(dbID))
+				if err != nil {
+					return
+				}
+				ackBytes, err := utils.EncodeMsgPack(ack)
+				if err != nil {
+					return
+				}
+				if err = ab.Put(ack.HeaderHash[:], ackBytes.Bytes()); err != nil {
+					return
+				}
+				if req != nil {
+					var rb, ob *bolt.Bucket
+					if rb, err = tx.Bucket(requestBucket).CreateBucketIfNotExists([]byte(dbID)); err != nil {
+						return
+					}
+					if ob, err = tx.Bucket(logOffsetBucket).CreateBucketIfNotExists([]byte(dbID)); err != nil {
+						return
+					}
+					reqBytes, err := utils.EncodeMsgPack(req)
+					if err != nil {
+						return err
+					}
+					key := append(offsetToBytes(uint64(i)), req.Header.HeaderHash[:]...)
+					if err = rb.Put(key, reqBytes.Bytes()); err != nil {
+						return err
+					}
+					if err = ob.Put(req.Header.HeaderHash[:], offsetToBytes(uint64(i))); err != nil {
+						return err
+					}
+				}
+				return indexQuery(tx, dbID, ack, req)
+			})
+		}
+		addBlock := func(height int32, producer proto.NodeID) error {
+			b := &ct.Block{}
+			b.SignedHeader.Producer = producer
+			b.SignedHeader.Timestamp = base.Add(time.Duration(height) * blockProducePeriod)
+			b.SignedHeader.BlockHash = hash.HashH([]byte(fmt.Sprintf("block%d", height)))
+			return s.db.Update(func(tx *bolt.Tx) (err error) {
+				bb, err := tx.Bucket(blockBucket).CreateBucketIfNotExists([]byte(dbID))
+				if err != nil {
+					return
+				}
+				blockBytes, err := utils.EncodeMsgPack(b)
+				if err != nil {
+					return
+				}
+				key := append(int32ToBytes(height), b.BlockHash()[:]...)
+				if err = bb.Put(key, blockBytes.Bytes()); err != nil {
+					return
+				}
+				return indexBlock(tx, dbID, key, b)
+			})
+		}
+		listQueries := func(f *queryFilter, limit int) (offsets []uint64) {
+			if f.Range == nil {
+				f.Range = &auditFilter{ToHeight: -1}
+			}
+			var cursor []byte
+			for {
+				records, next, err := s.listQueries(dbID, f, cursor, limit)
+				So(err, ShouldBeNil)
+				for _, rec := range records {
+					offsets = append(offsets, rec.Ack.Response.LogOffset)
+				}
+				if next == nil {
+					return
+				}
+				cursor = next
+			}
+		}
+
+		So(addQuery(1, "node1", "CREATE TABLE Users (id INTEGER, name TEXT)"), ShouldBeNil)
+		So(addQuery(2, "node2", ""), ShouldBeNil)
+		So(addQuery(3, "node1", "INSERT INTO users VALUES (1, 'alice')"), ShouldBeNil)
+		So(addQuery(4, "node2", "UPDATE orders SET paid = 1 WHERE id IN (SELECT id FROM users)"), ShouldBeNil)
+		So(addQuery(5, "node1", ""), ShouldBeNil)
+		So(addBlock(0, "miner1"), ShouldBeNil)
+		So(addBlock(1, "miner2"), ShouldBeNil)
+		So(addBlock(2, "miner1"), ShouldBeNil)
+		So(addBlock(3, "miner1"), ShouldBeNil)
+
+		Convey("The queries should be listed by filters", func() {
+			So(listQueries(&queryFilter{}, 2), ShouldResemble, []uint64{1, 2, 3, 4, 5})
+			So(listQueries(&queryFilter{Node: "node1"}, 1), ShouldResemble, []uint64{1, 3, 5})
+			So(listQueries(&queryFilter{Type: "read"}, 10), ShouldResemble, []uint64{2, 5})
+			So(listQueries(&queryFilter{Table: "USERS"}, 10), ShouldResemble, []uint64{1, 3, 4})
+			So(listQueries(&queryFilter{Table: "users", Node: "node2"}, 10), ShouldResemble, []uint64{4})
+			So(listQueries(&queryFilter{Search: "Alice"}, 10), ShouldResemble, []uint64{3})
+			So(listQueries(&queryFilter{Search: "id users"}, 10), ShouldResemble, []uint64{1, 4})
+			So(listQueries(&queryFilter{Search: "missing"}, 10), ShouldBeEmpty)
+			So(listQueries(&queryFilter{Range: &auditFilter{
+				Since: base.Add(2 * time.Second),
+				Until: base.Add(4 * time.Second),
+			}}, 10), ShouldResemble, []uint64{2, 3, 4})
+
+			records, _, err := s.listQueries(dbID, &queryFilter{Range: &auditFilter{}, Type: "write"}, nil, 1)
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Request, ShouldNotBeNil)
+			So(records[0].Request.Payload.Queries[0].Pattern, ShouldStartWith, "CREATE TABLE")
+			So(records[0].Height, ShouldEqual, -1)
+
+			_, _, err = s.listQueries(dbID, &queryFilter{Range: &auditFilter{}}, []byte("invalid"), 1)
+			So(err, ShouldEqual, ErrInvalidCursor)
+		})
+
+		Convey("The blocks should be listed by filters", func() {
+			listBlocks := func(f *auditFilter, producer proto.NodeID, limit int) (heights []int32) {
+				var cursor []byte
+				for {
+					records, next, err := s.listBlocks(dbID, f, producer, cursor, limit)
+					So(err, ShouldBeNil)
+					for _, rec := range records {
+						heights = append(heights, rec.Height)
+					}
+					if next == nil {
+						return
+					}
+					cursor = next
+				}
+			}
+			So(listBlocks(&auditFilter{ToHeight: -1}, "", 3), ShouldResemble, []int32{0, 1, 2, 3})
+			So(listBlocks(&auditFilter{FromHeight: 1, ToHeight: 2}, "", 1), ShouldResemble, []int32{1, 2})
+			So(listBlocks(&auditFilter{ToHeight: -1}, "miner1", 1), ShouldResemble, []int32{0, 2, 3})
+			So(listBlocks(&auditFilter{ToHeight: -1, Since: base.Add(blockProducePeriod)}, "miner1", 10),
+				ShouldResemble, []int32{2, 3})
+		})
+
+		Convey("The indexes should be rebuilt from existing data", func() {
+			So(s.db.Update(func(tx *bolt.Tx) (err error) {
+				if err = tx.DeleteBucket(blockIndexBucket); err != nil {
+					return
+				}
+				return tx.DeleteBucket(queryIndexBucket)
+			}), ShouldBeNil)
+			s.db.Close()
+			s, err = NewService()
+			So(err, ShouldBeNil)
+
+			So(listQueries(&queryFilter{Table: "users"}, 10), ShouldResemble, []uint64{1, 3, 4})
+			records, _, err := s.listBlocks(dbID, &auditFilter{ToHeight: -1}, "miner2", nil, 10)
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 1)
+		})
+	})
+}
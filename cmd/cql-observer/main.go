@@ -44,6 +44,17 @@ var (
 	dbID          string
 	listenAddr    string
 	resetPosition string
+	cdcDir        string
+	replicaDir    string
+
+	// audit log
+	auditExport     string
+	auditFormat     string
+	auditFromHeight string
+	auditToHeight   string
+	auditSince      string
+	auditUntil      string
+	auditVerify     string
 )
 
 func init() {
@@ -53,6 +64,15 @@ func init() {
 		"Disable signature sign and verify, for testing")
 	flag.StringVar(&resetPosition, "reset", "", "reset subscribe position")
 	flag.StringVar(&listenAddr, "listen", "127.0.0.1:4663", "listen address for http explorer api")
+	flag.StringVar(&cdcDir, "cdc-dir", "", "directory to write change data capture files, disabled if empty")
+	flag.StringVar(&replicaDir, "replica-dir", "", "directory to store read-only replicas of subscribed databases, disabled if empty")
+	flag.StringVar(&auditExport, "export", "", "export audit log of database to file and exit, - for stdout")
+	flag.StringVar(&auditFormat, "format", auditFormatJSONL, "audit log format, jsonl or csv")
+	flag.StringVar(&auditFromHeight, "from-height", "", "export audit log from block height")
+	flag.StringVar(&auditToHeight, "to-height", "", "export audit log to block height")
+	flag.StringVar(&auditSince, "since", "", "export audit log of queries since time in RFC3339 format")
+	flag.StringVar(&auditUntil, "until", "", "export audit log of queries until time in RFC3339 format")
+	flag.StringVar(&auditVerify, "verify", "", "verify signatures and proofs of jsonl audit log file and exit")
 }
 
 func main() {
@@ -65,11 +85,27 @@ func main() {
 	})
 
 	var err error
+	if auditVerify != "" {
+		// verify audit log offline
+		if err = runAuditVerify(auditVerify); err != nil {
+			log.Fatalf("verify audit log failed: %v", err)
+		}
+		return
+	}
+
 	conf.GConf, err = conf.LoadConfig(configFile)
 	if err != nil {
 		log.Fatalf("load config from %s failed: %s", configFile, err)
 	}
 
+	if auditExport != "" {
+		// export audit log from observer database, the observer should not be running
+		if err = runAuditExport(auditExport); err != nil {
+			log.Fatalf("export audit log failed: %v", err)
+		}
+		return
+	}
+
 	kms.InitBP()
 
 	// start rpc
@@ -84,6 +120,22 @@ func main() {
 		log.Fatalf("start observation failed: %v", err)
 	}
 
+	// start change data capture file sink
+	if cdcDir != "" {
+		if err = os.MkdirAll(cdcDir, 0755); err != nil {
+			log.Fatalf("create change data capture directory failed: %v", err)
+		}
+		service.startFileSink(cdcDir)
+	}
+
+	// start read-only replicas
+	if replicaDir != "" {
+		if err = os.MkdirAll(replicaDir, 0755); err != nil {
+			log.Fatalf("create replica directory failed: %v", err)
+		}
+		service.startReplicas(replicaDir)
+	}
+
 	// start explorer api
 	httpServer, err := startAPI(service, listenAddr)
 	if err != nil {
@@ -0,0 +1,344 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain/storage"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/worker"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/coreos/bbolt"
+)
+
+// Following contains the read-only replica of observer, the write requests of subscribed databases
+// are replayed in log offset order to local sqlite databases. The requests missed by observer,
+// e.g. the ones before subscription, are fetched from miners by offset.
+
+const (
+	// replicaOffsetTable defines the table recording the applied log offset in replica database,
+	// which is updated in the same transaction of replayed queries.
+	replicaOffsetTable = "__cql_replica"
+	// replicaSyncInterval defines the interval of replaying new write requests.
+	replicaSyncInterval = time.Second
+	// replicaQueryTimeout defines the timeout of replica read queries.
+	replicaQueryTimeout = 5 * time.Second
+)
+
+var (
+	// ErrReplicaDisabled defines error on querying replica while replica is not enabled.
+	ErrReplicaDisabled = errors.New("replica is not enabled")
+)
+
+// replica defines the read-only replica of a database.
+type replica struct {
+	// writes are replayed through storage, reads are served by a query only connection
+	st *storage.Storage
+	ro *sql.DB
+
+	lock    sync.RWMutex
+	applied uint64
+}
+
+func openReplica(file string) (r *replica, err error) {
+	r = &replica{}
+
+	var dsn *storage.DSN
+	if dsn, err = storage.NewDSN(file); err != nil {
+		return
+	}
+	if r.st, err = storage.New(dsn.Format()); err != nil {
+		return
+	}
+
+	if _, err = r.st.Exec(context.Background(), []storage.Query{{
+		Pattern: `CREATE TABLE IF NOT EXISTS "` + replicaOffsetTable + `" ("offset" INTEGER NOT NULL)`,
+	}}); err != nil {
+		r.st.Close()
+		return
+	}
+	var rows [][]interface{}
+	if _, _, rows, err = r.st.Query(context.Background(), []storage.Query{{
+		Pattern: `SELECT "offset" FROM "` + replicaOffsetTable + `"`,
+	}}); err != nil {
+		r.st.Close()
+		return
+	}
+	if len(rows) > 0 {
+		if offset, ok := rows[0][0].(int64); ok {
+			r.applied = uint64(offset)
+		}
+	}
+
+	// keep the journal mode of storage connection, or the driver switches it back on open
+	dsn.AddParam("_journal_mode", "WAL")
+	dsn.AddParam("_query_only", "true")
+	if r.ro, err = sql.Open("sqlite3", dsn.Format()); err != nil {
+		r.st.Close()
+		return
+	}
+
+	return
+}
+
+// apply replays the write request at the next log offset, the failed queries are rolled back and
+// skipped as miners do, only the applied offset is recorded then.
+func (r *replica) apply(offset uint64, req *wt.Request) (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	setOffset := []storage.Query{
+		{Pattern: `DELETE FROM "` + replicaOffsetTable + `"`},
+		{
+			Pattern: `INSERT INTO "` + replicaOffsetTable + `" VALUES (?)`,
+			Args:    []sql.NamedArg{sql.Named("", int64(offset))},
+		},
+	}
+
+	queries, err := worker.ConvertWriteRequest(req)
+	if err == nil {
+		_, err = r.st.Exec(context.Background(), append(queries, setOffset...))
+	}
+	if err != nil {
+		log.WithError(err).WithField("offset", offset).Debug("replay write request failed")
+		if _, err = r.st.Exec(context.Background(), setOffset); err != nil {
+			return
+		}
+	}
+
+	r.applied = offset
+	return
+}
+
+func (r *replica) getApplied() uint64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.applied
+}
+
+// query runs a single read query against replica, the statements are sanitized by the default
+// sql policy of miners.
+func (r *replica) query(q wt.Query) (columns []string, types []string, data [][]interface{}, err error) {
+	queries, err := worker.ConvertReadQueries([]wt.Query{q})
+	if err != nil {
+		return
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaQueryTimeout)
+	defer cancel()
+
+	args := make([]interface{}, len(queries[0].Args))
+	for i, v := range queries[0].Args {
+		args[i] = v
+	}
+
+	var rows *sql.Rows
+	if rows, err = r.ro.QueryContext(ctx, queries[0].Pattern, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+	var columnTypes []*sql.ColumnType
+	if columnTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+	types = make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = ct.DatabaseTypeName()
+	}
+
+	data = make([][]interface{}, 0)
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		data = append(data, row)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (r *replica) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ro.Close()
+	r.st.Close()
+}
+
+// startReplicas starts replaying the write requests of subscribed databases to replicas in dir.
+func (s *Service) startReplicas(dir string) {
+	atomic.StoreInt32(&s.replicaEnabled, 1)
+	s.wg.Add(1)
+	go s.runReplicas(dir)
+}
+
+func (s *Service) runReplicas(dir string) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(replicaSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		s.lock.Lock()
+		dbs := make([]proto.DatabaseID, 0, len(s.subscription))
+		for dbID := range s.subscription {
+			dbs = append(dbs, dbID)
+		}
+		s.lock.Unlock()
+
+		for _, dbID := range dbs {
+			if err := s.syncReplica(dir, dbID); err != nil {
+				log.WithError(err).WithField("db", dbID).Warning("sync replica failed")
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stopCh:
+			s.replicas.Range(func(_, r interface{}) bool {
+				r.(*replica).close()
+				return true
+			})
+			return
+		}
+	}
+}
+
+func (s *Service) syncReplica(dir string, dbID proto.DatabaseID) (err error) {
+	var r *replica
+	if rv, ok := s.replicas.Load(dbID); ok {
+		r = rv.(*replica)
+	} else {
+		if r, err = openReplica(filepath.Join(dir, string(dbID)+".db3")); err != nil {
+			return
+		}
+		s.replicas.Store(dbID, r)
+	}
+
+	var highest uint64
+	if highest, err = s.getHighestOffset(dbID); err != nil {
+		return
+	}
+
+	for offset := r.getApplied() + 1; offset <= highest; offset++ {
+		select {
+		case <-s.stopCh:
+			return ErrStopped
+		default:
+		}
+
+		var req *wt.Request
+		if req, err = s.getRequestByOffset(dbID, offset); err == ErrNotFound {
+			req, err = s.fetchRequest(dbID, offset)
+		}
+		if err != nil {
+			return
+		}
+		if err = r.apply(offset, req); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getHighestOffset returns the highest log offset of write requests received.
+func (s *Service) getHighestOffset(dbID proto.DatabaseID) (offset uint64, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if rb := tx.Bucket(requestBucket).Bucket([]byte(dbID)); rb != nil {
+			if k, _ := rb.Cursor().Last(); k != nil {
+				offset = bytesToOffset(k[:8])
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// fetchRequest fetches the write request missed by observer from miner, the request is stored
+// without offset index, which is only built for acknowledged requests.
+func (s *Service) fetchRequest(dbID proto.DatabaseID, offset uint64) (request *wt.Request, err error) {
+	req := &wt.GetRequestReq{}
+	resp := &wt.GetRequestResp{}
+	req.DatabaseID = dbID
+	req.LogOffset = offset
+
+	if err = s.minerRequest(dbID, route.DBSGetRequest.String(), req, resp); err != nil {
+		return
+	}
+	if err = resp.Request.Verify(); err != nil {
+		return
+	}
+
+	var reqBytes *bytes.Buffer
+	if reqBytes, err = utils.EncodeMsgPack(resp.Request); err != nil {
+		return
+	}
+	key := append(offsetToBytes(offset), resp.Request.Header.HeaderHash.CloneBytes()...)
+	if err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		qb, err := tx.Bucket(requestBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		return qb.Put(key, reqBytes.Bytes())
+	}); err != nil {
+		return
+	}
+
+	request = resp.Request
+	return
+}
+
+// queryReplica runs a read query against the replica of database.
+func (s *Service) queryReplica(dbID proto.DatabaseID, q wt.Query) (
+	columns []string, types []string, data [][]interface{}, offset uint64, err error) {
+	if atomic.LoadInt32(&s.replicaEnabled) == 0 {
+		err = ErrReplicaDisabled
+		return
+	}
+	rv, ok := s.replicas.Load(dbID)
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	r := rv.(*replica)
+	offset = r.getApplied()
+	columns, types, data, err = r.query(q)
+	return
+}
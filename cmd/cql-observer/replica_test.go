@@ -0,0 +1,87 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestReplicaRequest(seqNo uint64, pattern string) (req *wt.Request) {
+	req = &wt.Request{}
+	req.Header.DatabaseID = proto.DatabaseID("db")
+	req.Header.QueryType = wt.WriteQuery
+	req.Header.ConnectionID = 1
+	req.Header.SeqNo = seqNo
+	req.Header.Timestamp = time.Now().UTC()
+	req.Payload.Queries = []wt.Query{{Pattern: pattern}}
+	return
+}
+
+func TestReplica(t *testing.T) {
+	Convey("Given a replica database", t, func() {
+		tmp, err := ioutil.TempDir("", "covenantsql")
+		So(err, ShouldBeNil)
+		file := filepath.Join(tmp, "db.db3")
+		r, err := openReplica(file)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			r.close()
+			os.RemoveAll(tmp)
+		})
+		So(r.getApplied(), ShouldEqual, 0)
+
+		Convey("The write requests should be replayed in offset order", func() {
+			So(r.apply(1, newTestReplicaRequest(1,
+				"CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT)")), ShouldBeNil)
+			So(r.apply(2, newTestReplicaRequest(2, "INSERT INTO t VALUES (1, 'a')")), ShouldBeNil)
+			// failed requests are skipped but still advance the applied offset
+			So(r.apply(3, newTestReplicaRequest(3, "INSERT INTO t VALUES (1, 'b')")), ShouldBeNil)
+			So(r.getApplied(), ShouldEqual, 3)
+
+			columns, _, data, err := r.query(wt.Query{
+				Pattern: "SELECT v FROM t WHERE id = ?",
+				Args:    []sql.NamedArg{sql.Named("", 1)},
+			})
+			So(err, ShouldBeNil)
+			So(columns, ShouldResemble, []string{"v"})
+			So(data, ShouldHaveLength, 1)
+			So(fmt.Sprintf("%s", data[0][0]), ShouldEqual, "a")
+
+			// replica is read-only
+			_, _, _, err = r.query(wt.Query{Pattern: "DELETE FROM t"})
+			So(err, ShouldNotBeNil)
+			_, _, _, err = r.query(wt.Query{Pattern: "ATTACH DATABASE 'x.db3' AS x"})
+			So(err, ShouldNotBeNil)
+
+			// applied offset should be restored on reopen
+			r.close()
+			r, err = openReplica(file)
+			So(err, ShouldBeNil)
+			So(r.getApplied(), ShouldEqual, 3)
+		})
+	})
+}
@@ -69,8 +69,44 @@ const (
   |    |             \--> [offset+hash] => request
   |    |
   |  [offset]-->[`dbID`]
-  |                 |---> [hash] => offset
-  |                  \--> [hash] => offset
+  |    |            |---> [hash] => offset
+  |    |             \--> [hash] => offset
+  |    |
+  |  [ack-height]-->[`dbID`]
+  |    |                |---> [ack hash] => height
+  |    |                 \--> [ack hash] => height
+  |    |
+  |  [cdc]-->[`dbID`]
+  |    |        |---> [seq] => changes
+  |    |         \--> [seq] => changes
+  |    |
+  |  [cdc-pending]-->[`dbID`]
+  |    |                |---> [ack hash] => changes
+  |    |                 \--> [ack hash] => changes
+  |    |
+  |  [cdc-staged]-->[`dbID`]
+  |    |               |---> [offset] => changes
+  |    |                \--> [offset] => changes
+  |    |
+  |  [cdc-offset]
+  |    |     |---> [`dbID`] => next offset
+  |    |      \--> [`dbID`] => next offset
+  |    |
+  |  [cdc-schema]-->[`dbID`]
+  |    |               |---> [table] => schema
+  |    |                \--> [table] => schema
+  |    |
+  |  [cdc-checkpoint]-->[`dbID`]
+  |    |                   |---> [consumer] => seq
+  |    |                    \--> [consumer] => seq
+  |    |
+  |  [index-block]-->[`dbID`]
+  |    |                |---> [field+value+height+hash] => nil
+  |    |                 \--> [field+value+height+hash] => nil
+  |    |
+  |  [index-query]-->[`dbID`]
+  |                     |---> [field+value+timestamp+ack hash] => nil
+  |                      \--> [field+value+timestamp+ack hash] => nil
   |
    \-> [subscription]
              \---> [`dbID`] => height
@@ -91,6 +127,17 @@ var (
 
 	blockHeightBucket = []byte("height")
 	logOffsetBucket   = []byte("offset")
+	ackHeightBucket   = []byte("ack-height")
+
+	cdcBucket           = []byte("cdc")
+	cdcPendingBucket    = []byte("cdc-pending")
+	cdcStagedBucket     = []byte("cdc-staged")
+	cdcOffsetBucket     = []byte("cdc-offset")
+	cdcSchemaBucket     = []byte("cdc-schema")
+	cdcCheckpointBucket = []byte("cdc-checkpoint")
+
+	blockIndexBucket = []byte("index-block")
+	queryIndexBucket = []byte("index-query")
 
 	// blockProducePeriod defines the block producing interval
 	blockProducePeriod = 60 * time.Second
@@ -105,6 +152,14 @@ type Service struct {
 	db      *bolt.DB
 	caller  *rpc.Caller
 	stopped int32
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+
+	cdcLock   sync.Mutex
+	cdcNotify chan struct{}
+
+	replicaEnabled int32
+	replicas       sync.Map
 }
 
 // NewService creates new observer service and load previous subscription from the meta database.
@@ -142,8 +197,41 @@ func NewService() (service *Service, err error) {
 		if _, err = tx.CreateBucketIfNotExists(blockHeightBucket); err != nil {
 			return
 		}
-		_, err = tx.CreateBucketIfNotExists(logOffsetBucket)
-		return
+		if _, err = tx.CreateBucketIfNotExists(logOffsetBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(ackHeightBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(cdcBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(cdcPendingBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(cdcStagedBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(cdcOffsetBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(cdcSchemaBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(cdcCheckpointBucket); err != nil {
+			return
+		}
+		// build indexes of existing data on first open
+		if tx.Bucket(queryIndexBucket) != nil {
+			return
+		}
+		if _, err = tx.CreateBucket(blockIndexBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucket(queryIndexBucket); err != nil {
+			return
+		}
+		return buildIndexes(tx)
 	}); err != nil {
 		return
 	}
@@ -153,6 +241,8 @@ func NewService() (service *Service, err error) {
 		subscription: make(map[proto.DatabaseID]int32),
 		db:           db,
 		caller:       rpc.NewCaller(),
+		stopCh:       make(chan struct{}),
+		cdcNotify:    make(chan struct{}),
 	}
 
 	// load previous subscriptions
@@ -333,6 +423,7 @@ func (s *Service) addAckedQuery(dbID proto.DatabaseID, ack *wt.SignedAckHeader)
 	}
 
 	// fetch original query
+	var request *wt.Request
 	if ack.Response.Request.QueryType == wt.WriteQuery {
 		req := &wt.GetRequestReq{}
 		resp := &wt.GetRequestResp{}
@@ -367,11 +458,18 @@ func (s *Service) addAckedQuery(dbID proto.DatabaseID, ack *wt.SignedAckHeader)
 			if err != nil {
 				return
 			}
+			// decode changes only once for each request
+			if ob.Get(resp.Request.Header.HeaderHash[:]) == nil {
+				if err = s.addChanges(tx, dbID, ack, resp.Request); err != nil {
+					return
+				}
+			}
 			err = ob.Put(resp.Request.Header.HeaderHash.CloneBytes(), offsetToBytes(req.LogOffset))
 			return
 		}); err != nil {
 			return
 		}
+		request = resp.Request
 	}
 
 	// store ack
@@ -384,7 +482,10 @@ func (s *Service) addAckedQuery(dbID proto.DatabaseID, ack *wt.SignedAckHeader)
 		if err != nil {
 			return
 		}
-		err = ab.Put(ack.HeaderHash.CloneBytes(), ackBytes.Bytes())
+		if err = ab.Put(ack.HeaderHash.CloneBytes(), ackBytes.Bytes()); err != nil {
+			return
+		}
+		err = indexQuery(tx, dbID, ack, request)
 		return
 	})
 }
@@ -415,6 +516,9 @@ func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *ct.Block) (err
 		if err = bb.Put(key, blockBytes.Bytes()); err != nil {
 			return
 		}
+		if err = indexBlock(tx, dbID, key, b); err != nil {
+			return
+		}
 		cb, err := tx.Bucket(blockCount2HeightBucket).CreateBucketIfNotExists([]byte(dbID))
 		if err != nil {
 			return
@@ -428,7 +532,21 @@ func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *ct.Block) (err
 		if err != nil {
 			return
 		}
-		err = hb.Put(b.BlockHash()[:], int32ToBytes(h))
+		if err = hb.Put(b.BlockHash()[:], int32ToBytes(h)); err != nil {
+			return
+		}
+		ahb, err := tx.Bucket(ackHeightBucket).CreateBucketIfNotExists([]byte(dbID))
+		if err != nil {
+			return
+		}
+		acks := make([][]byte, len(b.Queries))
+		for i, q := range b.Queries {
+			acks[i] = q.CloneBytes()
+			if err = ahb.Put(acks[i], int32ToBytes(h)); err != nil {
+				return
+			}
+		}
+		err = s.publishPendingChanges(tx, dbID, h, acks)
 		return
 	})
 }
@@ -457,6 +575,10 @@ func (s *Service) stop() (err error) {
 		}
 	}
 
+	// stop change consumers
+	close(s.stopCh)
+	s.wg.Wait()
+
 	// close the subscription database
 	s.db.Close()
 
@@ -485,14 +607,14 @@ func (s *Service) getUpstream(dbID proto.DatabaseID) (instance *wt.ServiceInstan
 		return
 	}
 
-	privateKey, err := kms.GetLocalPrivateKey()
+	signer, err := kms.GetLocalSigner()
 	if err != nil {
 		return
 	}
 
 	req := &bp.GetDatabaseRequest{}
 	req.Header.DatabaseID = dbID
-	if err = req.Sign(privateKey); err != nil {
+	if err = req.Sign(signer); err != nil {
 		return
 	}
 	resp := &bp.GetDatabaseResponse{}
@@ -530,34 +652,40 @@ func (s *Service) getAck(dbID proto.DatabaseID, h *hash.Hash) (ack *wt.SignedAck
 }
 
 func (s *Service) getRequest(dbID proto.DatabaseID, h *hash.Hash) (request *wt.Request, err error) {
-	err = s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(logOffsetBucket).Bucket([]byte(dbID))
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		request, err = getRequestTx(tx, dbID, h.CloneBytes())
+		return
+	})
 
-		if bucket == nil {
-			return ErrNotFound
-		}
+	return
+}
 
-		reqKey := bucket.Get(h.CloneBytes())
-		if reqKey == nil {
-			return ErrNotFound
-		}
+func getRequestTx(tx *bolt.Tx, dbID proto.DatabaseID, h []byte) (request *wt.Request, err error) {
+	bucket := tx.Bucket(logOffsetBucket).Bucket([]byte(dbID))
 
-		reqKey = append([]byte{}, reqKey...)
-		reqKey = append(reqKey, h.CloneBytes()...)
+	if bucket == nil {
+		return nil, ErrNotFound
+	}
 
-		bucket = tx.Bucket(requestBucket).Bucket([]byte(dbID))
-		if bucket == nil {
-			return ErrNotFound
-		}
+	reqKey := bucket.Get(h)
+	if reqKey == nil {
+		return nil, ErrNotFound
+	}
 
-		reqBytes := bucket.Get(reqKey)
-		if reqBytes == nil {
-			return ErrNotFound
-		}
+	reqKey = append([]byte{}, reqKey...)
+	reqKey = append(reqKey, h...)
 
-		return utils.DecodeMsgPack(reqBytes, &request)
-	})
+	bucket = tx.Bucket(requestBucket).Bucket([]byte(dbID))
+	if bucket == nil {
+		return nil, ErrNotFound
+	}
+
+	reqBytes := bucket.Get(reqKey)
+	if reqBytes == nil {
+		return nil, ErrNotFound
+	}
 
+	err = utils.DecodeMsgPack(reqBytes, &request)
 	return
 }
 
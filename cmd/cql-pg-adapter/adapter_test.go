@@ -0,0 +1,227 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/CovenantSQL/go-sqlite3-encrypt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryRewrite(t *testing.T) {
+	Convey("split statements", t, func() {
+		So(splitStatements("SELECT 1; SELECT ';'; -- c;\nSELECT \"a;b\" /* ; */"), ShouldResemble, []string{
+			"SELECT 1",
+			"SELECT ';'",
+			"-- c;\nSELECT \"a;b\" /* ; */",
+		})
+		So(splitStatements(" ; ;"), ShouldBeEmpty)
+		So(splitStatements("SELECT $$a;b$$"), ShouldResemble, []string{"SELECT $$a;b$$"})
+	})
+	Convey("rewrite postgres syntax", t, func() {
+		q, argIndex, paramCnt := rewriteQuery(`SELECT "id", $2::text FROM "my""tbl" WHERE a = $1 OR b = $2`)
+		So(q, ShouldEqual, "SELECT `id`, ? FROM `my\"tbl` WHERE a = ? OR b = ?")
+		So(argIndex, ShouldResemble, []int{1, 0, 1})
+		So(paramCnt, ShouldEqual, 2)
+
+		q, argIndex, paramCnt = rewriteQuery(`SELECT 'it''s $1', $tag$a'b$tag$, x::double precision, y::varchar(10)[]`)
+		So(q, ShouldEqual, `SELECT 'it''s $1', 'a''b', x, y`)
+		So(argIndex, ShouldBeEmpty)
+		So(paramCnt, ShouldEqual, 0)
+
+		q, _, _ = rewriteQuery("SELECT now()::timestamp with time zone AS t")
+		So(q, ShouldEqual, "SELECT now() AS t")
+	})
+	Convey("command tags", t, func() {
+		So(commandTag("insert into t values (1)", 1), ShouldEqual, "INSERT 0 1")
+		So(commandTag("UPDATE t SET a = 1", 3), ShouldEqual, "UPDATE 3")
+		So(commandTag("select 1", 1), ShouldEqual, "SELECT 1")
+		So(commandTag("create table t (a int)", 0), ShouldEqual, "CREATE TABLE")
+		So(commandTag("VACUUM", 0), ShouldEqual, "VACUUM")
+		So(isReadQuery(" (SELECT 1)"), ShouldBeTrue)
+		So(isReadQuery("INSERT INTO t SELECT 1"), ShouldBeFalse)
+	})
+	Convey("catalog column projection", t, func() {
+		rs := newTextResult([]string{"table_schema", "table_name"}, []interface{}{"public", "t"})
+		p := projectColumns("SELECT table_name AS name FROM information_schema.tables", rs)
+		So(p.columns, ShouldResemble, []string{"name"})
+		So(p.rows, ShouldResemble, [][]interface{}{{"t"}})
+		So(projectColumns("SELECT * FROM information_schema.tables", rs), ShouldEqual, rs)
+		So(projectColumns("SELECT count(*) FROM information_schema.tables", rs), ShouldEqual, rs)
+	})
+}
+
+func TestTypes(t *testing.T) {
+	Convey("detect column types", t, func() {
+		So(detectColumnOID("INTEGER", nil), ShouldEqual, oidInt8)
+		So(detectColumnOID("varchar(20)", nil), ShouldEqual, oidText)
+		So(detectColumnOID("DATETIME", nil), ShouldEqual, oidTimestamp)
+		So(detectColumnOID("", 1.5), ShouldEqual, oidFloat8)
+		So(detectColumnOID("", []byte{1}), ShouldEqual, oidBytea)
+		So(detectColumnOID("", nil), ShouldEqual, oidText)
+	})
+	Convey("encode values", t, func() {
+		b, err := encodeText(oidBool, int64(1))
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "t")
+		b, err = encodeText(oidBytea, []byte{0xde, 0xad})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `\xdead`)
+		b, err = encodeBinary(oidInt8, "42")
+		So(err, ShouldBeNil)
+		So(binary.BigEndian.Uint64(b), ShouldEqual, 42)
+		b, err = encodeBinary(oidTimestamp, "2000-01-01 00:00:01")
+		So(err, ShouldBeNil)
+		So(binary.BigEndian.Uint64(b), ShouldEqual, 1000000)
+		_, err = encodeBinary(oidInt8, "abc")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("decode parameters", t, func() {
+		v, err := decodeParam(oidInt4, formatBinary, []byte{0, 0, 1, 0})
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, int64(256))
+		v, err = decodeParam(oidBool, formatText, []byte("true"))
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, true)
+		v, err = decodeParam(oidUnknown, formatText, []byte("abc"))
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "abc")
+		v, err = decodeParam(oidText, formatText, nil)
+		So(err, ShouldBeNil)
+		So(v, ShouldBeNil)
+		_, err = decodeParam(oidInt8, formatBinary, []byte{1})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *testClient) send(w *messageWriter) {
+	c.conn.Write(w.Bytes())
+}
+
+// receive reads messages until the expected message type.
+func (c *testClient) receive(until byte) (types []byte, payloads [][]byte) {
+	for {
+		typ, payload, err := readMessage(c.r)
+		So(err, ShouldBeNil)
+		types = append(types, typ)
+		payloads = append(payloads, payload)
+		if typ == until {
+			return
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	Convey("test postgres protocol session", t, func() {
+		dir, err := ioutil.TempDir("", "pg_adapter")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		server := &Server{
+			pgUser:     "postgres",
+			pgPassword: "calvin",
+			openDB: func(dbID string) (*sql.DB, error) {
+				return sql.Open("sqlite3", filepath.Join(dir, dbID+".db3"))
+			},
+		}
+
+		serverConn, clientConn := net.Pipe()
+		go NewSession(server, serverConn).Serve()
+		defer clientConn.Close()
+
+		c := &testClient{conn: clientConn, r: bufio.NewReader(clientConn)}
+
+		// startup message
+		startup := newMessageWriter(0).int32(protocolVersion3).
+			string("user").string("postgres").string("database").string("test").byte(0).Bytes()
+		clientConn.Write(startup[1:])
+		types, payloads := c.receive(msgAuthentication)
+		So(binary.BigEndian.Uint32(payloads[0]), ShouldEqual, authCleartextPassword)
+
+		c.send(newMessageWriter(msgPassword).string("calvin"))
+		types, _ = c.receive(msgReadyForQuery)
+		So(types[0], ShouldEqual, msgAuthentication)
+		So(types, ShouldContain, byte(msgParameterStatus))
+		So(types, ShouldContain, byte(msgBackendKeyData))
+
+		Convey("simple query", func() {
+			c.send(newMessageWriter(msgSimpleQuery).string(
+				`CREATE TABLE "t" (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO t VALUES (1, 'a'); SELECT * FROM t`))
+			types, payloads = c.receive(msgReadyForQuery)
+			So(string(types), ShouldEqual, "CCTDCZ")
+			So(string(payloads[1]), ShouldEqual, "INSERT 0 1\x00")
+			So(string(payloads[4]), ShouldEqual, "SELECT 1\x00")
+
+			c.send(newMessageWriter(msgSimpleQuery).string("SELECT * FROM not_exists; SELECT 1"))
+			types, _ = c.receive(msgReadyForQuery)
+			So(string(types), ShouldEqual, "EZ")
+
+			Convey("extended query", func() {
+				c.send(newMessageWriter(msgParse).string("s1").string("SELECT name FROM t WHERE id = $1").int16(1).int32(int32(oidInt4)))
+				c.send(newMessageWriter(msgDescribe).byte('S').string("s1"))
+				c.send(newMessageWriter(msgSync))
+				types, _ = c.receive(msgReadyForQuery)
+				So(string(types), ShouldEqual, "1tTZ")
+
+				c.send(newMessageWriter(msgBind).string("").string("s1").
+					int16(1).int16(formatBinary).
+					int16(1).int32(4).bytes([]byte{0, 0, 0, 1}).
+					int16(0))
+				c.send(newMessageWriter(msgExecute).string("").int32(0))
+				c.send(newMessageWriter(msgSync))
+				types, payloads = c.receive(msgReadyForQuery)
+				So(string(types), ShouldEqual, "2DCZ")
+				So(string(payloads[1][len(payloads[1])-1:]), ShouldEqual, "a")
+
+				// errors skip messages until sync
+				c.send(newMessageWriter(msgBind).string("").string("not_exists").int16(0).int16(0).int16(0))
+				c.send(newMessageWriter(msgExecute).string("").int32(0))
+				c.send(newMessageWriter(msgSync))
+				types, _ = c.receive(msgReadyForQuery)
+				So(string(types), ShouldEqual, "EZ")
+			})
+
+			Convey("transaction", func() {
+				c.send(newMessageWriter(msgSimpleQuery).string("BEGIN; INSERT INTO t VALUES (2, 'b')"))
+				types, payloads = c.receive(msgReadyForQuery)
+				So(string(types), ShouldEqual, "CCZ")
+				So(payloads[2], ShouldResemble, []byte{txStatusInTx})
+
+				c.send(newMessageWriter(msgSimpleQuery).string("ROLLBACK"))
+				types, payloads = c.receive(msgReadyForQuery)
+				So(payloads[1], ShouldResemble, []byte{txStatusIdle})
+
+				c.send(newMessageWriter(msgSimpleQuery).string("SELECT count(*) FROM t"))
+				types, payloads = c.receive(msgReadyForQuery)
+				So(string(payloads[1][len(payloads[1])-1:]), ShouldEqual, "1")
+			})
+		})
+	})
+}
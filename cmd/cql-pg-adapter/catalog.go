@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// serverVersion defines the postgres version reported to clients.
+	serverVersion = "9.6.0"
+	// defaultSchema defines the only schema name exposed to clients.
+	defaultSchema = "public"
+)
+
+// catalogHandler answers a query locally or by translating it to sqlite equivalents.
+type catalogHandler func(s *Session, matches []string) (*resultSet, error)
+
+// catalogQuery defines a special query pattern and its handler.
+type catalogQuery struct {
+	pattern *regexp.Regexp
+	handler catalogHandler
+}
+
+var (
+	tableNameFilter = regexp.MustCompile("(?i)\\btable_name\\s*=\\s*'([^']+)'")
+	selectList      = regexp.MustCompile("(?is)^\\s*SELECT\\s+(.+?)\\s+FROM\\s")
+	selectItem      = regexp.MustCompile("(?i)^(?:\\w+\\.)?`?(\\w+)`?(?:\\s+(?:AS\\s+)?`?(\\w+)`?)?$")
+	relNameFilter   = regexp.MustCompile("(?i)\\brelname\\s*(?:=|~)\\s*'\\^?\\(?([\\w.]+?)\\)?\\$?'")
+
+	catalogQueries = []catalogQuery{
+		{regexp.MustCompile("^(?i)\\s*SELECT\\s+(?:pg_catalog\\.)?version\\(\\)\\s*$"), selectVersion},
+		{regexp.MustCompile("^(?i)\\s*SELECT\\s+(?:pg_catalog\\.)?current_database\\(\\)\\s*$"), selectCurrentDatabase},
+		{regexp.MustCompile("^(?i)\\s*SELECT\\s+(?:current_user|session_user|user)\\s*$"), selectCurrentUser},
+		{regexp.MustCompile("^(?i)\\s*SELECT\\s+(?:pg_catalog\\.)?current_schema\\(\\)\\s*$"), selectCurrentSchema},
+		{regexp.MustCompile("^(?i)\\s*SHOW\\s+(\\w+)\\s*$"), showParameter},
+		{setQuery, setParameter},
+		{regexp.MustCompile("(?is)^\\s*SELECT\\b.*\\bFROM\\s+(?:pg_catalog\\.)?pg_tables\\b"), selectPgTables},
+		{regexp.MustCompile("(?is)^\\s*SELECT\\b.*\\bFROM\\s+information_schema\\.tables\\b"), selectSchemaTables},
+		{regexp.MustCompile("(?is)^\\s*SELECT\\b.*\\bFROM\\s+information_schema\\.columns\\b"), selectSchemaColumns},
+		{regexp.MustCompile("(?is)^\\s*SELECT\\b.*\\bFROM\\s+pg_catalog\\.pg_class\\s+c\\b.*\\brelkind\\b"), selectPsqlTables},
+	}
+)
+
+func matchCatalogQuery(query string) (handler catalogHandler, matches []string) {
+	for _, q := range catalogQueries {
+		if matches = q.pattern.FindStringSubmatch(query); matches != nil {
+			return q.handler, matches
+		}
+	}
+	return
+}
+
+// projectColumns picks the selected columns of emulated catalog table,
+// the full result is returned if any select item is not a plain column.
+func projectColumns(query string, rs *resultSet) *resultSet {
+	m := selectList.FindStringSubmatch(query)
+	if m == nil || rs == nil || rs.columns == nil {
+		return rs
+	}
+
+	items := strings.Split(m[1], ",")
+	indexes := make([]int, len(items))
+	names := make([]string, len(items))
+
+	for i, item := range items {
+		// rewritten identifiers are back quoted
+		im := selectItem.FindStringSubmatch(strings.TrimSpace(item))
+		if im == nil {
+			return rs
+		}
+
+		indexes[i] = -1
+		for j, c := range rs.columns {
+			if strings.EqualFold(c, im[1]) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return rs
+		}
+
+		names[i] = rs.columns[indexes[i]]
+		if im[2] != "" {
+			names[i] = im[2]
+		}
+	}
+
+	projected := &resultSet{
+		columns: names,
+		oids:    make([]uint32, len(indexes)),
+		rows:    make([][]interface{}, 0, len(rs.rows)),
+		tag:     rs.tag,
+	}
+	for i, idx := range indexes {
+		projected.oids[i] = rs.oids[idx]
+	}
+	for _, row := range rs.rows {
+		r := make([]interface{}, len(indexes))
+		for i, idx := range indexes {
+			r[i] = row[idx]
+		}
+		projected.rows = append(projected.rows, r)
+	}
+
+	return projected
+}
+
+func newTextResult(columns []string, rows ...[]interface{}) *resultSet {
+	rs := &resultSet{
+		columns: columns,
+		oids:    make([]uint32, len(columns)),
+		rows:    rows,
+	}
+	for i := range rs.oids {
+		rs.oids[i] = oidText
+	}
+	return rs
+}
+
+func selectVersion(s *Session, _ []string) (*resultSet, error) {
+	return newTextResult([]string{"version"},
+		[]interface{}{fmt.Sprintf("PostgreSQL %s on CovenantSQL", serverVersion)}), nil
+}
+
+func selectCurrentDatabase(s *Session, _ []string) (*resultSet, error) {
+	return newTextResult([]string{"current_database"}, []interface{}{s.database}), nil
+}
+
+func selectCurrentUser(s *Session, _ []string) (*resultSet, error) {
+	return newTextResult([]string{"current_user"}, []interface{}{s.user}), nil
+}
+
+func selectCurrentSchema(s *Session, _ []string) (*resultSet, error) {
+	return newTextResult([]string{"current_schema"}, []interface{}{defaultSchema}), nil
+}
+
+func showParameter(s *Session, matches []string) (*resultSet, error) {
+	name := strings.ToLower(matches[1])
+	value, ok := s.parameters()[name]
+	if !ok {
+		return nil, newError(codeUndefinedObject, fmt.Sprintf("unrecognized configuration parameter \"%s\"", name))
+	}
+	rs := newTextResult([]string{name}, []interface{}{value})
+	rs.tag = "SHOW"
+	return rs, nil
+}
+
+func setParameter(s *Session, _ []string) (*resultSet, error) {
+	// session parameters are accepted and ignored
+	return &resultSet{tag: "SET"}, nil
+}
+
+// listTables returns the table and view names of current database.
+func (s *Session) listTables(filter string) (names []string, types []string, err error) {
+	query := "SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'"
+	var args []interface{}
+	if filter != "" {
+		query += " AND name = ?"
+		args = append(args, filter)
+	}
+
+	var rows *sql.Rows
+	if rows, err = s.db.Query(query+" ORDER BY name", args...); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			return
+		}
+		names = append(names, name)
+		types = append(types, typ)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func selectPgTables(s *Session, _ []string) (rs *resultSet, err error) {
+	var names, types []string
+	if names, types, err = s.listTables(""); err != nil {
+		return
+	}
+
+	rs = newTextResult([]string{"schemaname", "tablename", "tableowner"})
+	for i, name := range names {
+		if types[i] == "table" {
+			rs.rows = append(rs.rows, []interface{}{defaultSchema, name, s.user})
+		}
+	}
+	return
+}
+
+func selectSchemaTables(s *Session, matches []string) (rs *resultSet, err error) {
+	var filter string
+	if m := tableNameFilter.FindStringSubmatch(matches[0]); m != nil {
+		filter = m[1]
+	}
+
+	var names, types []string
+	if names, types, err = s.listTables(filter); err != nil {
+		return
+	}
+
+	rs = newTextResult([]string{"table_catalog", "table_schema", "table_name", "table_type"})
+	for i, name := range names {
+		tableType := "BASE TABLE"
+		if types[i] == "view" {
+			tableType = "VIEW"
+		}
+		rs.rows = append(rs.rows, []interface{}{s.database, defaultSchema, name, tableType})
+	}
+	return
+}
+
+func selectSchemaColumns(s *Session, matches []string) (rs *resultSet, err error) {
+	m := tableNameFilter.FindStringSubmatch(matches[0])
+	if m == nil {
+		return nil, newError(codeFeatureNotSupported, "information_schema.columns requires a table_name filter")
+	}
+	table := m[1]
+
+	rs = newTextResult([]string{"table_catalog", "table_schema", "table_name", "column_name",
+		"ordinal_position", "column_default", "is_nullable", "data_type"})
+	rs.oids[4] = oidInt8
+
+	// DESC is translated to PRAGMA table_info by the worker
+	var rows *sql.Rows
+	if rows, err = s.db.Query("DESC `" + strings.Replace(table, "`", "``", -1) + "`"); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int64
+		var name, typ string
+		var notNull, pk bool
+		var defaultValue interface{}
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return
+		}
+		nullable := "YES"
+		if notNull || pk {
+			nullable = "NO"
+		}
+		rs.rows = append(rs.rows, []interface{}{s.database, defaultSchema, table, name,
+			cid + 1, defaultValue, nullable, strings.ToLower(typ)})
+	}
+
+	err = rows.Err()
+	return
+}
+
+// selectPsqlTables answers the table listing query of psql \dt and \d commands.
+func selectPsqlTables(s *Session, matches []string) (rs *resultSet, err error) {
+	var filter string
+	if m := relNameFilter.FindStringSubmatch(matches[0]); m != nil {
+		filter = m[1]
+	}
+
+	var names, types []string
+	if names, types, err = s.listTables(filter); err != nil {
+		return
+	}
+
+	rs = newTextResult([]string{"Schema", "Name", "Type", "Owner"})
+	for i, name := range names {
+		rs.rows = append(rs.rows, []interface{}{defaultSchema, name, types[i], s.user})
+	}
+	return
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+// SQLSTATE error codes, see https://www.postgresql.org/docs/current/static/errcodes-appendix.html.
+const (
+	codeProtocolViolation     = "08P01"
+	codeFeatureNotSupported   = "0A000"
+	codeInvalidPassword       = "28P01"
+	codeInvalidCatalogName    = "3D000"
+	codeInFailedTransaction   = "25P02"
+	codeInvalidParameterValue = "22023"
+	codeUndefinedObject       = "42704"
+	codeInvalidSQLStatement   = "26000"
+	codeInvalidCursorName     = "34000"
+	codeInternalError         = "XX000"
+)
+
+// error severities.
+const (
+	severityError = "ERROR"
+	severityFatal = "FATAL"
+)
+
+// Error defines a postgres protocol error with SQLSTATE code.
+type Error struct {
+	Severity string
+	Code     string
+	Message  string
+}
+
+func newError(code string, message string) *Error {
+	return &Error{
+		Severity: severityError,
+		Code:     code,
+		Message:  message,
+	}
+}
+
+func newFatalError(code string, message string) *Error {
+	return &Error{
+		Severity: severityFatal,
+		Code:     code,
+		Message:  message,
+	}
+}
+
+// wrapError converts any error to protocol error.
+func wrapError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return newError(codeInternalError, err.Error())
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
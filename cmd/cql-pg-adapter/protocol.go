@@ -0,0 +1,257 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// PostgreSQL v3 protocol constants.
+// https://www.postgresql.org/docs/current/static/protocol-message-formats.html
+const (
+	protocolVersion3   = 196608   // 3.0
+	sslRequestCode     = 80877103 // 1234.5679
+	cancelRequestCode  = 80877102 // 1234.5678
+	gssEncRequestCode  = 80877104 // 1234.5680
+	maxStartupPacketSz = 10000
+	maxMessageSize     = 1 << 30
+)
+
+// frontend message types.
+const (
+	msgBind        = 'B'
+	msgClose       = 'C'
+	msgDescribe    = 'D'
+	msgExecute     = 'E'
+	msgFlush       = 'H'
+	msgParse       = 'P'
+	msgPassword    = 'p'
+	msgSimpleQuery = 'Q'
+	msgSync        = 'S'
+	msgTerminate   = 'X'
+)
+
+// backend message types.
+const (
+	msgAuthentication       = 'R'
+	msgBackendKeyData       = 'K'
+	msgBindComplete         = '2'
+	msgCloseComplete        = '3'
+	msgCommandComplete      = 'C'
+	msgDataRow              = 'D'
+	msgEmptyQueryResponse   = 'I'
+	msgErrorResponse        = 'E'
+	msgNoData               = 'n'
+	msgParameterDescription = 't'
+	msgParameterStatus      = 'S'
+	msgParseComplete        = '1'
+	msgPortalSuspended      = 's'
+	msgReadyForQuery        = 'Z'
+	msgRowDescription       = 'T'
+)
+
+// authentication request codes.
+const (
+	authOK                = 0
+	authCleartextPassword = 3
+)
+
+// transaction status indicators in ReadyForQuery message.
+const (
+	txStatusIdle   = 'I'
+	txStatusInTx   = 'T'
+	txStatusFailed = 'E'
+)
+
+// format codes of parameters and results.
+const (
+	formatText   int16 = 0
+	formatBinary int16 = 1
+)
+
+var (
+	// ErrMessageTooLarge defines error on oversize frontend message.
+	ErrMessageTooLarge = errors.New("message too large")
+	// ErrInvalidMessage defines error on malformed frontend message.
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// readStartupMessage reads the untyped startup packet which begins every connection.
+func readStartupMessage(r io.Reader) (code uint32, payload []byte, err error) {
+	var header [8]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+
+	size := binary.BigEndian.Uint32(header[:4])
+	if size < 8 || size > maxStartupPacketSz {
+		err = ErrInvalidMessage
+		return
+	}
+
+	code = binary.BigEndian.Uint32(header[4:])
+	payload = make([]byte, size-8)
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+// readMessage reads a typed frontend message.
+func readMessage(r *bufio.Reader) (typ byte, payload []byte, err error) {
+	if typ, err = r.ReadByte(); err != nil {
+		return
+	}
+
+	var header [4]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 4 {
+		err = ErrInvalidMessage
+		return
+	}
+	if size > maxMessageSize {
+		err = ErrMessageTooLarge
+		return
+	}
+
+	payload = make([]byte, size-4)
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+// messageReader decodes fields of a frontend message payload.
+type messageReader struct {
+	buf []byte
+	err error
+}
+
+func newMessageReader(payload []byte) *messageReader {
+	return &messageReader{buf: payload}
+}
+
+func (r *messageReader) byte() (b byte) {
+	if r.err != nil {
+		return
+	}
+	if len(r.buf) < 1 {
+		r.err = ErrInvalidMessage
+		return
+	}
+	b, r.buf = r.buf[0], r.buf[1:]
+	return
+}
+
+func (r *messageReader) int16() (v int16) {
+	if r.err != nil {
+		return
+	}
+	if len(r.buf) < 2 {
+		r.err = ErrInvalidMessage
+		return
+	}
+	v, r.buf = int16(binary.BigEndian.Uint16(r.buf)), r.buf[2:]
+	return
+}
+
+func (r *messageReader) int32() (v int32) {
+	if r.err != nil {
+		return
+	}
+	if len(r.buf) < 4 {
+		r.err = ErrInvalidMessage
+		return
+	}
+	v, r.buf = int32(binary.BigEndian.Uint32(r.buf)), r.buf[4:]
+	return
+}
+
+func (r *messageReader) string() (s string) {
+	if r.err != nil {
+		return
+	}
+	pos := bytes.IndexByte(r.buf, 0)
+	if pos < 0 {
+		r.err = ErrInvalidMessage
+		return
+	}
+	s, r.buf = string(r.buf[:pos]), r.buf[pos+1:]
+	return
+}
+
+func (r *messageReader) bytes(n int) (b []byte) {
+	if r.err != nil {
+		return
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = ErrInvalidMessage
+		return
+	}
+	b, r.buf = r.buf[:n:n], r.buf[n:]
+	return
+}
+
+// messageWriter encodes a single backend message.
+type messageWriter struct {
+	buf bytes.Buffer
+}
+
+func newMessageWriter(typ byte) *messageWriter {
+	w := &messageWriter{}
+	w.buf.WriteByte(typ)
+	// length placeholder
+	w.buf.Write([]byte{0, 0, 0, 0})
+	return w
+}
+
+func (w *messageWriter) byte(b byte) *messageWriter {
+	w.buf.WriteByte(b)
+	return w
+}
+
+func (w *messageWriter) int16(v int16) *messageWriter {
+	binary.Write(&w.buf, binary.BigEndian, v)
+	return w
+}
+
+func (w *messageWriter) int32(v int32) *messageWriter {
+	binary.Write(&w.buf, binary.BigEndian, v)
+	return w
+}
+
+func (w *messageWriter) string(s string) *messageWriter {
+	w.buf.WriteString(s)
+	w.buf.WriteByte(0)
+	return w
+}
+
+func (w *messageWriter) bytes(b []byte) *messageWriter {
+	w.buf.Write(b)
+	return w
+}
+
+// Bytes returns the encoded message with length filled.
+func (w *messageWriter) Bytes() []byte {
+	b := w.buf.Bytes()
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(b)-1))
+	return b
+}
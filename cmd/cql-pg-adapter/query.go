@@ -0,0 +1,274 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	readQuery     = regexp.MustCompile("^(?i)\\s*\\(?\\s*(?:SELECT|SHOW|DESC|DESCRIBE|WITH|VALUES|EXPLAIN)\\b")
+	selectQuery   = regexp.MustCompile("^(?i)\\s*SELECT\\b")
+	setQuery      = regexp.MustCompile("^(?i)\\s*SET\\b")
+	beginQuery    = regexp.MustCompile("^(?i)\\s*(?:BEGIN|START\\s+TRANSACTION)\\b")
+	commitQuery   = regexp.MustCompile("^(?i)\\s*(?:COMMIT|END)\\b")
+	rollbackQuery = regexp.MustCompile("^(?i)\\s*(?:ROLLBACK|ABORT)\\b")
+	firstWords    = regexp.MustCompile("^\\s*(\\w+)(?:\\s+(\\w+))?")
+
+	// multi-word type names following a :: cast.
+	castTypeWords = map[string]bool{
+		"precision": true,
+		"varying":   true,
+		"with":      true,
+		"without":   true,
+		"time":      true,
+		"zone":      true,
+	}
+)
+
+// splitStatements splits a simple query message into single statements, quoted strings,
+// identifiers and comments are respected.
+func splitStatements(query string) (stmts []string) {
+	var start int
+
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'', '"':
+			i = skipQuoted(query, i)
+		case '$':
+			if end, ok := skipDollarQuoted(query, i); ok {
+				i = end
+			}
+		case '-':
+			if i+1 < len(query) && query[i+1] == '-' {
+				i = skipLineComment(query, i) - 1
+			}
+		case '/':
+			if i+1 < len(query) && query[i+1] == '*' {
+				i = skipBlockComment(query, i) - 1
+			}
+		case ';':
+			if stmt := strings.TrimSpace(query[start:i]); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+		}
+	}
+
+	if stmt := strings.TrimSpace(query[start:]); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+
+	return
+}
+
+// rewriteQuery translates postgres specific syntax to the dialect accepted by CovenantSQL:
+// $n placeholders are replaced by positional ? with argIndex recording the referenced parameter,
+// double quoted identifiers are replaced by back quoted ones, dollar quoted strings are replaced
+// by standard string literals and :: type casts are removed.
+func rewriteQuery(query string) (out string, argIndex []int, paramCnt int) {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+
+		switch {
+		case ch == '\'':
+			end := skipQuoted(query, i)
+			b.WriteString(query[i : end+1])
+			i = end
+		case ch == '"':
+			end := skipQuoted(query, i)
+			ident := strings.Replace(query[i+1:end], `""`, `"`, -1)
+			b.WriteByte('`')
+			b.WriteString(strings.Replace(ident, "`", "``", -1))
+			b.WriteByte('`')
+			i = end
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := skipLineComment(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+		case ch == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := skipBlockComment(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+		case ch == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			argIndex = append(argIndex, n-1)
+			if n > paramCnt {
+				paramCnt = n
+			}
+			b.WriteByte('?')
+			i = j - 1
+		case ch == '$':
+			if end, ok := skipDollarQuoted(query, i); ok {
+				tagEnd := strings.IndexByte(query[i+1:], '$') + i + 1
+				tag := query[i : tagEnd+1]
+				content := query[tagEnd+1 : end-len(tag)+1]
+				b.WriteByte('\'')
+				b.WriteString(strings.Replace(content, "'", "''", -1))
+				b.WriteByte('\'')
+				i = end
+			} else {
+				b.WriteByte(ch)
+			}
+		case ch == ':' && i+1 < len(query) && query[i+1] == ':':
+			i = skipCastType(query, i+2) - 1
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	out = b.String()
+	return
+}
+
+// commandTag builds the CommandComplete tag of a statement.
+func commandTag(query string, rows int64) string {
+	matches := firstWords.FindStringSubmatch(query)
+	if len(matches) < 2 {
+		return ""
+	}
+
+	verb := strings.ToUpper(matches[1])
+	switch verb {
+	case "INSERT":
+		return fmt.Sprintf("INSERT 0 %d", rows)
+	case "SELECT", "UPDATE", "DELETE", "SHOW", "DESC", "DESCRIBE", "WITH", "VALUES":
+		if verb != "UPDATE" && verb != "DELETE" {
+			verb = "SELECT"
+		}
+		return fmt.Sprintf("%s %d", verb, rows)
+	case "CREATE", "DROP", "ALTER":
+		if len(matches) > 2 && matches[2] != "" {
+			return verb + " " + strings.ToUpper(matches[2])
+		}
+		return verb
+	default:
+		return verb
+	}
+}
+
+func isReadQuery(query string) bool {
+	return readQuery.MatchString(query)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || isDigit(ch) || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// skipQuoted returns the position of the closing quote, doubled quotes are treated as escapes,
+// the last position is returned for unterminated quotes.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		if query[i] == quote {
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(query) - 1
+}
+
+// skipDollarQuoted returns the position of the last byte of the closing $tag$.
+func skipDollarQuoted(query string, start int) (end int, ok bool) {
+	j := start + 1
+	for j < len(query) && isIdentChar(query[j]) {
+		j++
+	}
+	if j >= len(query) || query[j] != '$' {
+		return
+	}
+	tag := query[start : j+1]
+	pos := strings.Index(query[j+1:], tag)
+	if pos < 0 {
+		return
+	}
+	return j + 1 + pos + len(tag) - 1, true
+}
+
+// skipLineComment returns the end position (exclusive) of a -- comment.
+func skipLineComment(query string, start int) int {
+	if pos := strings.IndexByte(query[start:], '\n'); pos >= 0 {
+		return start + pos
+	}
+	return len(query)
+}
+
+// skipBlockComment returns the end position (exclusive) of a /* */ comment.
+func skipBlockComment(query string, start int) int {
+	if pos := strings.Index(query[start+2:], "*/"); pos >= 0 {
+		return start + 2 + pos + 2
+	}
+	return len(query)
+}
+
+// skipCastType returns the position after the type name of a :: cast.
+func skipCastType(query string, start int) int {
+	i := start
+	for {
+		for i < len(query) && query[i] == ' ' {
+			i++
+		}
+		j := i
+		for j < len(query) && (isIdentChar(query[j]) || query[j] == '.') {
+			j++
+		}
+		if j == i {
+			return start
+		}
+		i = j
+		// type modifiers and array suffix
+		if i < len(query) && query[i] == '(' {
+			if pos := strings.IndexByte(query[i:], ')'); pos >= 0 {
+				i += pos + 1
+			}
+		}
+		for i+1 < len(query) && query[i] == '[' && query[i+1] == ']' {
+			i += 2
+		}
+		start = i
+		// continue on multi-word type names
+		k := i
+		for k < len(query) && query[k] == ' ' {
+			k++
+		}
+		l := k
+		for l < len(query) && isIdentChar(query[l]) {
+			l++
+		}
+		if !castTypeWords[strings.ToLower(query[k:l])] {
+			return start
+		}
+		i = k
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"io"
+	"net"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// Server defines the main logic of postgresql protocol adapter.
+type Server struct {
+	listenAddr string
+	listener   net.Listener
+	pgUser     string
+	pgPassword string
+	openDB     func(dbID string) (*sql.DB, error)
+}
+
+// NewServer bind the service port and return a runnable adapter.
+func NewServer(listenAddr string, user string, password string) (s *Server, err error) {
+	s = &Server{
+		listenAddr: listenAddr,
+		pgUser:     user,
+		pgPassword: password,
+		openDB:     openCovenantSQL,
+	}
+
+	if s.listener, err = net.Listen("tcp", listenAddr); err != nil {
+		return
+	}
+
+	return
+}
+
+// Serve starts the server.
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	if err := NewSession(s, conn).Serve(); err != nil && err != io.EOF {
+		log.Errorf("process connection failed: %v", err)
+	}
+}
+
+// Shutdown ends the server.
+func (s *Server) Shutdown() {
+	s.listener.Close()
+}
+
+func openCovenantSQL(dbID string) (db *sql.DB, err error) {
+	cfg := client.NewConfig()
+	cfg.DatabaseID = dbID
+
+	return sql.Open("covenantsql", cfg.FormatDSN())
+}
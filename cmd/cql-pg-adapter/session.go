@@ -0,0 +1,839 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	dbIDRegex = regexp.MustCompile("^[a-zA-Z0-9_\\.]+$")
+)
+
+// resultSet defines the columns and rows of a statement result.
+type resultSet struct {
+	columns []string
+	oids    []uint32
+	rows    [][]interface{}
+	tag     string
+}
+
+// preparedStatement defines a statement created by Parse message.
+type preparedStatement struct {
+	query      string   // original query
+	rewritten  string   // query in CovenantSQL dialect
+	argIndex   []int    // parameter index of each placeholder in rewritten query
+	paramTypes []uint32 // parameter type oids
+	described  *resultSet
+}
+
+// portal defines a bound statement created by Bind message.
+type portal struct {
+	stmt          *preparedStatement
+	args          []interface{}
+	resultFormats []int16
+	result        *resultSet
+	sent          int
+}
+
+// Session defines a postgres protocol client connection.
+type Session struct {
+	server   *Server
+	conn     net.Conn
+	r        *bufio.Reader
+	w        *bufio.Writer
+	user     string
+	database string
+	db       *sql.DB
+	tx       *sql.Tx
+	txFailed bool
+
+	statements    map[string]*preparedStatement
+	portals       map[string]*portal
+	ignoreToSync  bool
+	clientOptions map[string]string
+}
+
+// NewSession returns a new session handler of connection.
+func NewSession(s *Server, conn net.Conn) *Session {
+	return &Session{
+		server:        s,
+		conn:          conn,
+		r:             bufio.NewReader(conn),
+		w:             bufio.NewWriter(conn),
+		statements:    make(map[string]*preparedStatement),
+		portals:       make(map[string]*portal),
+		clientOptions: make(map[string]string),
+	}
+}
+
+// Serve processes the connection until terminated.
+func (s *Session) Serve() (err error) {
+	defer s.close()
+
+	if err = s.startup(); err != nil {
+		return
+	}
+
+	for {
+		var typ byte
+		var payload []byte
+		if typ, payload, err = readMessage(s.r); err != nil {
+			return
+		}
+
+		// skip messages until sync on extended query error
+		if s.ignoreToSync && typ != msgSync && typ != msgTerminate {
+			continue
+		}
+
+		switch typ {
+		case msgSimpleQuery:
+			r := newMessageReader(payload)
+			query := r.string()
+			if r.err != nil {
+				return r.err
+			}
+			s.handleSimpleQuery(query)
+		case msgParse, msgBind, msgDescribe, msgExecute, msgClose:
+			if e := s.handleExtended(typ, payload); e != nil {
+				s.sendError(e)
+				s.ignoreToSync = true
+			}
+			// responses of extended query are sent on sync or flush
+			continue
+		case msgSync:
+			s.ignoreToSync = false
+			s.sendReadyForQuery()
+		case msgFlush:
+		case msgTerminate:
+			return
+		default:
+			s.sendError(newError(codeProtocolViolation, fmt.Sprintf("unsupported message type: %c", typ)))
+			s.sendReadyForQuery()
+		}
+
+		if err = s.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Session) close() {
+	if s.tx != nil {
+		s.tx.Rollback()
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+	s.conn.Close()
+}
+
+func (s *Session) startup() (err error) {
+	for {
+		var code uint32
+		var payload []byte
+		if code, payload, err = readStartupMessage(s.conn); err != nil {
+			return
+		}
+
+		switch code {
+		case sslRequestCode, gssEncRequestCode:
+			// encryption is not supported, client should continue in plain text
+			if _, err = s.conn.Write([]byte{'N'}); err != nil {
+				return
+			}
+			continue
+		case cancelRequestCode:
+			// query cancellation is not supported, the connection carrying the cancel key is closed
+			return ErrInvalidMessage
+		case protocolVersion3:
+		default:
+			e := newFatalError(codeFeatureNotSupported, fmt.Sprintf("unsupported frontend protocol %d.%d",
+				code>>16, code&0xffff))
+			s.sendError(e)
+			s.w.Flush()
+			return e
+		}
+
+		r := newMessageReader(payload)
+		for {
+			key := r.string()
+			if key == "" || r.err != nil {
+				break
+			}
+			s.clientOptions[key] = r.string()
+		}
+		if r.err != nil {
+			return r.err
+		}
+		break
+	}
+
+	s.user = s.clientOptions["user"]
+	s.database = s.clientOptions["database"]
+	if s.database == "" {
+		s.database = s.user
+	}
+
+	// cleartext password authentication
+	s.write(newMessageWriter(msgAuthentication).int32(authCleartextPassword))
+	if err = s.w.Flush(); err != nil {
+		return
+	}
+
+	var typ byte
+	var payload []byte
+	if typ, payload, err = readMessage(s.r); err != nil {
+		return
+	}
+	r := newMessageReader(payload)
+	password := r.string()
+	if typ != msgPassword || r.err != nil {
+		e := newFatalError(codeProtocolViolation, "expected password response")
+		s.sendError(e)
+		s.w.Flush()
+		return e
+	}
+	if s.user != s.server.pgUser || password != s.server.pgPassword {
+		e := newFatalError(codeInvalidPassword, fmt.Sprintf("password authentication failed for user \"%s\"", s.user))
+		s.sendError(e)
+		s.w.Flush()
+		return e
+	}
+
+	// connect database
+	if !dbIDRegex.MatchString(s.database) {
+		e := newFatalError(codeInvalidCatalogName, fmt.Sprintf("invalid database: %v", s.database))
+		s.sendError(e)
+		s.w.Flush()
+		return e
+	}
+
+	if s.db, err = s.server.openDB(s.database); err != nil {
+		s.sendError(newFatalError(codeInvalidCatalogName, err.Error()))
+		s.w.Flush()
+		return
+	}
+
+	s.write(newMessageWriter(msgAuthentication).int32(authOK))
+	for k, v := range s.parameters() {
+		s.write(newMessageWriter(msgParameterStatus).string(k).string(v))
+	}
+	s.write(newMessageWriter(msgBackendKeyData).int32(rand.Int31()).int32(rand.Int31()))
+	s.sendReadyForQuery()
+
+	return s.w.Flush()
+}
+
+// parameters returns the run-time parameters reported to client.
+func (s *Session) parameters() map[string]string {
+	return map[string]string{
+		"server_version":              serverVersion,
+		"server_encoding":             "UTF8",
+		"client_encoding":             "UTF8",
+		"application_name":            s.clientOptions["application_name"],
+		"datestyle":                   "ISO, MDY",
+		"integer_datetimes":           "on",
+		"intervalstyle":               "postgres",
+		"is_superuser":                "off",
+		"session_authorization":       s.user,
+		"standard_conforming_strings": "on",
+		"timezone":                    "UTC",
+		"transaction_isolation":       "serializable",
+	}
+}
+
+func (s *Session) write(w *messageWriter) {
+	s.w.Write(w.Bytes())
+}
+
+func (s *Session) sendError(err error) {
+	e := wrapError(err)
+	log.WithField("code", e.Code).WithError(err).Debug("send error response")
+
+	if s.tx != nil {
+		s.txFailed = true
+	}
+
+	s.write(newMessageWriter(msgErrorResponse).
+		byte('S').string(e.Severity).
+		byte('V').string(e.Severity).
+		byte('C').string(e.Code).
+		byte('M').string(e.Message).
+		byte(0))
+}
+
+func (s *Session) sendReadyForQuery() {
+	status := byte(txStatusIdle)
+	if s.tx != nil {
+		status = txStatusInTx
+		if s.txFailed {
+			status = txStatusFailed
+		}
+	}
+	s.write(newMessageWriter(msgReadyForQuery).byte(status))
+}
+
+func (s *Session) sendRowDescription(rs *resultSet, formats []int16) {
+	w := newMessageWriter(msgRowDescription).int16(int16(len(rs.columns)))
+	for i, c := range rs.columns {
+		w.string(c).
+			int32(0). // table oid
+			int16(0). // column attribute number
+			int32(int32(rs.oids[i])).
+			int16(typeSize(rs.oids[i])).
+			int32(-1). // type modifier
+			int16(columnFormat(formats, i))
+	}
+	s.write(w)
+}
+
+func (s *Session) sendDataRow(rs *resultSet, row []interface{}, formats []int16) (err error) {
+	w := newMessageWriter(msgDataRow).int16(int16(len(row)))
+	for i, v := range row {
+		if v == nil {
+			w.int32(-1)
+			continue
+		}
+
+		var b []byte
+		if columnFormat(formats, i) == formatBinary {
+			b, err = encodeBinary(rs.oids[i], v)
+		} else {
+			b, err = encodeText(rs.oids[i], v)
+		}
+		if err != nil {
+			return newError(codeInvalidParameterValue, fmt.Sprintf("encode column %s failed: %v", rs.columns[i], err))
+		}
+
+		w.int32(int32(len(b))).bytes(b)
+	}
+	s.write(w)
+	return
+}
+
+func columnFormat(formats []int16, i int) int16 {
+	switch len(formats) {
+	case 0:
+		return formatText
+	case 1:
+		return formats[0]
+	default:
+		if i < len(formats) {
+			return formats[i]
+		}
+		return formatText
+	}
+}
+
+func (s *Session) handleSimpleQuery(query string) {
+	defer s.sendReadyForQuery()
+
+	stmts := splitStatements(query)
+	if len(stmts) == 0 {
+		s.write(newMessageWriter(msgEmptyQueryResponse))
+		return
+	}
+
+	for _, q := range stmts {
+		rewritten, argIndex, _ := rewriteQuery(q)
+		if len(argIndex) > 0 {
+			s.sendError(newError(codeProtocolViolation, "bind parameters are not allowed in simple query"))
+			return
+		}
+
+		stmt := &preparedStatement{
+			query:     q,
+			rewritten: rewritten,
+		}
+
+		rs, err := s.execute(stmt, nil)
+		if err != nil {
+			s.sendError(err)
+			return
+		}
+
+		if rs.columns != nil {
+			s.sendRowDescription(rs, nil)
+			for _, row := range rs.rows {
+				if err = s.sendDataRow(rs, row, nil); err != nil {
+					s.sendError(err)
+					return
+				}
+			}
+		}
+
+		s.write(newMessageWriter(msgCommandComplete).string(rs.tag))
+	}
+}
+
+// execute runs the statement and returns the result set, columns is nil for statements without result set.
+func (s *Session) execute(stmt *preparedStatement, args []interface{}) (rs *resultSet, err error) {
+	query := stmt.query
+
+	// transaction control
+	switch {
+	case beginQuery.MatchString(query):
+		if s.tx != nil {
+			// postgres only warns on nested begin
+			return &resultSet{tag: "BEGIN"}, nil
+		}
+		if s.tx, err = s.db.Begin(); err != nil {
+			return
+		}
+		s.txFailed = false
+		return &resultSet{tag: "BEGIN"}, nil
+	case commitQuery.MatchString(query):
+		return s.endTransaction(!s.txFailed)
+	case rollbackQuery.MatchString(query):
+		return s.endTransaction(false)
+	}
+
+	if s.txFailed {
+		return nil, newError(codeInFailedTransaction,
+			"current transaction is aborted, commands ignored until end of transaction block")
+	}
+
+	// local answers and catalog queries
+	if handler, matches := matchCatalogQuery(query); handler != nil {
+		if rs, err = handler(s, matches); err != nil {
+			return
+		}
+		rs = projectColumns(stmt.rewritten, rs)
+		if rs.tag == "" {
+			rs.tag = commandTag("SELECT", int64(len(rs.rows)))
+		}
+		return
+	}
+
+	if isReadQuery(query) {
+		// read query is not supported by CovenantSQL transaction, queries committed data directly
+		var rows *sql.Rows
+		if rows, err = s.db.Query(stmt.rewritten, args...); err != nil {
+			return
+		}
+		defer rows.Close()
+
+		if rs, err = readResultSet(rows, stmt.described); err != nil {
+			return
+		}
+		rs.tag = commandTag(query, int64(len(rs.rows)))
+		return
+	}
+
+	var result sql.Result
+	if s.tx != nil {
+		result, err = s.tx.Exec(stmt.rewritten, args...)
+	} else {
+		result, err = s.db.Exec(stmt.rewritten, args...)
+	}
+	if err != nil {
+		return
+	}
+
+	affectedRows, _ := result.RowsAffected()
+	rs = &resultSet{tag: commandTag(query, affectedRows)}
+	return
+}
+
+func (s *Session) endTransaction(commit bool) (rs *resultSet, err error) {
+	if s.tx == nil {
+		// postgres only warns when there is no transaction in progress
+		if commit {
+			return &resultSet{tag: "COMMIT"}, nil
+		}
+		return &resultSet{tag: "ROLLBACK"}, nil
+	}
+
+	tx := s.tx
+	s.tx = nil
+	s.txFailed = false
+
+	if commit {
+		if err = tx.Commit(); err != nil {
+			return
+		}
+		return &resultSet{tag: "COMMIT"}, nil
+	}
+
+	if err = tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return
+	}
+	return &resultSet{tag: "ROLLBACK"}, nil
+}
+
+// readResultSet reads all rows, column types are detected from declared types or sampled values,
+// the described result of prepared statement is used to keep type oids consistent.
+func readResultSet(rows *sql.Rows, described *resultSet) (rs *resultSet, err error) {
+	rs = &resultSet{}
+
+	if rs.columns, err = rows.Columns(); err != nil {
+		return
+	}
+
+	var colTypes []*sql.ColumnType
+	if colTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+
+	if rs.rows, err = readAllRows(rows); err != nil {
+		return
+	}
+
+	if described != nil && len(described.oids) == len(rs.columns) {
+		rs.oids = described.oids
+		return
+	}
+
+	rs.oids = make([]uint32, len(rs.columns))
+	for i := range rs.columns {
+		var typeName string
+		if i < len(colTypes) && colTypes[i] != nil {
+			typeName = colTypes[i].DatabaseTypeName()
+		}
+
+		var sample interface{}
+		for _, row := range rs.rows {
+			if row[i] != nil {
+				sample = row[i]
+				break
+			}
+		}
+
+		rs.oids[i] = detectColumnOID(typeName, sample)
+	}
+
+	return
+}
+
+func (s *Session) handleExtended(typ byte, payload []byte) (err error) {
+	r := newMessageReader(payload)
+
+	switch typ {
+	case msgParse:
+		err = s.handleParse(r)
+	case msgBind:
+		err = s.handleBind(r)
+	case msgDescribe:
+		err = s.handleDescribe(r)
+	case msgExecute:
+		err = s.handleExecute(r)
+	case msgClose:
+		err = s.handleClose(r)
+	}
+
+	if err == nil && r.err != nil {
+		err = newError(codeProtocolViolation, r.err.Error())
+	}
+
+	return
+}
+
+func (s *Session) handleParse(r *messageReader) (err error) {
+	name := r.string()
+	query := strings.TrimRight(strings.TrimSpace(r.string()), ";")
+	paramCnt := int(r.int16())
+	paramTypes := make([]uint32, 0, paramCnt)
+	for i := 0; i < paramCnt; i++ {
+		paramTypes = append(paramTypes, uint32(r.int32()))
+	}
+	if r.err != nil {
+		return
+	}
+
+	if _, exists := s.statements[name]; exists && name != "" {
+		return newError(codeInvalidSQLStatement, fmt.Sprintf("prepared statement \"%s\" already exists", name))
+	}
+
+	stmt := &preparedStatement{query: query}
+	var placeholders int
+	stmt.rewritten, stmt.argIndex, placeholders = rewriteQuery(query)
+	for len(paramTypes) < placeholders {
+		paramTypes = append(paramTypes, oidUnknown)
+	}
+	stmt.paramTypes = paramTypes
+
+	s.statements[name] = stmt
+	s.write(newMessageWriter(msgParseComplete))
+	return
+}
+
+func (s *Session) handleBind(r *messageReader) (err error) {
+	portalName := r.string()
+	stmtName := r.string()
+
+	formatCnt := int(r.int16())
+	formats := make([]int16, 0, formatCnt)
+	for i := 0; i < formatCnt && r.err == nil; i++ {
+		formats = append(formats, r.int16())
+	}
+
+	paramCnt := int(r.int16())
+	params := make([]interface{}, 0, paramCnt)
+
+	stmt, ok := s.statements[stmtName]
+	if !ok {
+		return newError(codeInvalidSQLStatement, fmt.Sprintf("prepared statement \"%s\" does not exist", stmtName))
+	}
+	if paramCnt != len(stmt.paramTypes) {
+		return newError(codeProtocolViolation, fmt.Sprintf(
+			"bind message supplies %d parameters, but prepared statement \"%s\" requires %d",
+			paramCnt, stmtName, len(stmt.paramTypes)))
+	}
+
+	for i := 0; i < paramCnt && r.err == nil; i++ {
+		size := r.int32()
+		var data []byte
+		if size >= 0 {
+			data = r.bytes(int(size))
+		}
+		var v interface{}
+		if v, err = decodeParam(stmt.paramTypes[i], columnFormat(formats, i), data); err != nil {
+			return newError(codeInvalidParameterValue, fmt.Sprintf("invalid parameter $%d: %v", i+1, err))
+		}
+		params = append(params, v)
+	}
+
+	resultFormatCnt := int(r.int16())
+	resultFormats := make([]int16, 0, resultFormatCnt)
+	for i := 0; i < resultFormatCnt && r.err == nil; i++ {
+		resultFormats = append(resultFormats, r.int16())
+	}
+	if r.err != nil {
+		return
+	}
+
+	// placeholders referencing parameters
+	args := make([]interface{}, len(stmt.argIndex))
+	for i, idx := range stmt.argIndex {
+		if idx < 0 || idx >= len(params) {
+			return newError(codeProtocolViolation, fmt.Sprintf("there is no parameter $%d", idx+1))
+		}
+		args[i] = params[idx]
+	}
+
+	s.portals[portalName] = &portal{
+		stmt:          stmt,
+		args:          args,
+		resultFormats: resultFormats,
+	}
+	s.write(newMessageWriter(msgBindComplete))
+	return
+}
+
+func (s *Session) handleDescribe(r *messageReader) (err error) {
+	kind := r.byte()
+	name := r.string()
+	if r.err != nil {
+		return
+	}
+
+	switch kind {
+	case 'S':
+		stmt, ok := s.statements[name]
+		if !ok {
+			return newError(codeInvalidSQLStatement, fmt.Sprintf("prepared statement \"%s\" does not exist", name))
+		}
+
+		w := newMessageWriter(msgParameterDescription).int16(int16(len(stmt.paramTypes)))
+		for _, oid := range stmt.paramTypes {
+			if oid == oidUnknown {
+				// parameters are sent as text and converted by sqlite type affinity
+				oid = oidText
+			}
+			w.int32(int32(oid))
+		}
+		s.write(w)
+
+		var rs *resultSet
+		if rs, err = s.describeStatement(stmt); err != nil {
+			return
+		}
+		if rs == nil || rs.columns == nil {
+			s.write(newMessageWriter(msgNoData))
+		} else {
+			s.sendRowDescription(rs, nil)
+		}
+	case 'P':
+		p, ok := s.portals[name]
+		if !ok {
+			return newError(codeInvalidCursorName, fmt.Sprintf("portal \"%s\" does not exist", name))
+		}
+
+		if !s.hasResultSet(p.stmt) {
+			s.write(newMessageWriter(msgNoData))
+			return
+		}
+
+		// read queries are executed on describe to build accurate row description
+		if p.result == nil {
+			if p.result, err = s.execute(p.stmt, p.args); err != nil {
+				return
+			}
+		}
+		if p.result.columns == nil {
+			s.write(newMessageWriter(msgNoData))
+		} else {
+			s.sendRowDescription(p.result, p.resultFormats)
+		}
+	default:
+		return newError(codeProtocolViolation, fmt.Sprintf("invalid describe target: %c", kind))
+	}
+
+	return
+}
+
+func (s *Session) hasResultSet(stmt *preparedStatement) bool {
+	if stmt.query == "" {
+		return false
+	}
+	if handler, _ := matchCatalogQuery(stmt.query); handler != nil {
+		return !setQuery.MatchString(stmt.query)
+	}
+	return isReadQuery(stmt.query)
+}
+
+// describeStatement resolves the result columns of a prepared statement without parameters.
+func (s *Session) describeStatement(stmt *preparedStatement) (rs *resultSet, err error) {
+	if stmt.described != nil || !s.hasResultSet(stmt) {
+		return stmt.described, nil
+	}
+
+	if handler, matches := matchCatalogQuery(stmt.query); handler != nil {
+		if rs, err = handler(s, matches); err != nil {
+			return
+		}
+		rs = projectColumns(stmt.rewritten, rs)
+		stmt.described = &resultSet{columns: rs.columns, oids: rs.oids}
+		return stmt.described, nil
+	}
+
+	// bind all parameters as null, select queries are wrapped to skip fetching rows
+	args := make([]interface{}, len(stmt.argIndex))
+	var rows *sql.Rows
+	if selectQuery.MatchString(stmt.query) {
+		rows, err = s.db.Query("SELECT * FROM ("+stmt.rewritten+") AS _describe LIMIT 0", args...)
+	}
+	if rows == nil {
+		if rows, err = s.db.Query(stmt.rewritten, args...); err != nil {
+			return
+		}
+	}
+	defer rows.Close()
+
+	if rs, err = readResultSet(rows, nil); err != nil {
+		return
+	}
+	stmt.described = &resultSet{columns: rs.columns, oids: rs.oids}
+	return stmt.described, nil
+}
+
+func (s *Session) handleExecute(r *messageReader) (err error) {
+	name := r.string()
+	maxRows := int(r.int32())
+	if r.err != nil {
+		return
+	}
+
+	p, ok := s.portals[name]
+	if !ok {
+		return newError(codeInvalidCursorName, fmt.Sprintf("portal \"%s\" does not exist", name))
+	}
+
+	if p.stmt.query == "" {
+		s.write(newMessageWriter(msgEmptyQueryResponse))
+		return
+	}
+
+	if p.result == nil {
+		if p.result, err = s.execute(p.stmt, p.args); err != nil {
+			return
+		}
+	}
+
+	rs := p.result
+	if rs.columns != nil {
+		end := len(rs.rows)
+		if maxRows > 0 && p.sent+maxRows < end {
+			end = p.sent + maxRows
+		}
+		for ; p.sent < end; p.sent++ {
+			if err = s.sendDataRow(rs, rs.rows[p.sent], p.resultFormats); err != nil {
+				return
+			}
+		}
+		if p.sent < len(rs.rows) {
+			s.write(newMessageWriter(msgPortalSuspended))
+			return
+		}
+	}
+
+	s.write(newMessageWriter(msgCommandComplete).string(rs.tag))
+	return
+}
+
+func (s *Session) handleClose(r *messageReader) (err error) {
+	kind := r.byte()
+	name := r.string()
+	if r.err != nil {
+		return
+	}
+
+	switch kind {
+	case 'S':
+		delete(s.statements, name)
+	case 'P':
+		delete(s.portals, name)
+	default:
+		return newError(codeProtocolViolation, fmt.Sprintf("invalid close target: %c", kind))
+	}
+
+	s.write(newMessageWriter(msgCloseComplete))
+	return
+}
+
+// readAllRows reads all rows with driver values kept.
+func readAllRows(rows *sql.Rows) (result [][]interface{}, err error) {
+	var columns []string
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		scanArgs := make([]interface{}, len(columns))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err = rows.Scan(scanArgs...); err != nil {
+			return
+		}
+		result = append(result, values)
+	}
+
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,452 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostgreSQL type oids, see pg_type.h.
+const (
+	oidUnknown     uint32 = 0
+	oidBool        uint32 = 16
+	oidBytea       uint32 = 17
+	oidInt8        uint32 = 20
+	oidInt2        uint32 = 21
+	oidInt4        uint32 = 23
+	oidText        uint32 = 25
+	oidFloat4      uint32 = 700
+	oidFloat8      uint32 = 701
+	oidVarchar     uint32 = 1043
+	oidDate        uint32 = 1082
+	oidTime        uint32 = 1083
+	oidTimestamp   uint32 = 1114
+	oidTimestampTZ uint32 = 1184
+)
+
+const (
+	timestampLayout = "2006-01-02 15:04:05.999999"
+	dateLayout      = "2006-01-02"
+	timeLayout      = "15:04:05.999999"
+)
+
+var (
+	// postgres binary timestamp epoch.
+	pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// layouts for parsing sqlite stored time strings.
+	timeParseLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04",
+		dateLayout,
+	}
+)
+
+// typeSize returns the pg_type.typlen field of oid.
+func typeSize(oid uint32) int16 {
+	switch oid {
+	case oidBool:
+		return 1
+	case oidInt2:
+		return 2
+	case oidInt4, oidFloat4, oidDate:
+		return 4
+	case oidInt8, oidFloat8, oidTime, oidTimestamp, oidTimestampTZ:
+		return 8
+	default:
+		return -1
+	}
+}
+
+// detectColumnOID maps sqlite declared column type to postgres type oid using sqlite affinity rules,
+// sample is used for expression columns without declared type.
+func detectColumnOID(typeStr string, sample interface{}) uint32 {
+	typeStr = strings.ToUpper(typeStr)
+
+	switch {
+	case typeStr == "":
+		return detectValueOID(sample)
+	case strings.Contains(typeStr, "INT"):
+		return oidInt8
+	case strings.Contains(typeStr, "CHAR") || strings.Contains(typeStr, "CLOB") ||
+		strings.Contains(typeStr, "TEXT"):
+		return oidText
+	case strings.Contains(typeStr, "BLOB"):
+		return oidBytea
+	case strings.Contains(typeStr, "REAL") || strings.Contains(typeStr, "FLOA") ||
+		strings.Contains(typeStr, "DOUB") || strings.Contains(typeStr, "NUMERIC") ||
+		strings.Contains(typeStr, "DECIMAL"):
+		return oidFloat8
+	case strings.Contains(typeStr, "BOOL"):
+		return oidBool
+	case strings.Contains(typeStr, "TIMESTAMP") || strings.Contains(typeStr, "DATETIME"):
+		return oidTimestamp
+	case strings.Contains(typeStr, "TIME"):
+		return oidTime
+	case strings.Contains(typeStr, "DATE"):
+		return oidDate
+	default:
+		return detectValueOID(sample)
+	}
+}
+
+func detectValueOID(v interface{}) uint32 {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return oidInt8
+	case float32, float64:
+		return oidFloat8
+	case bool:
+		return oidBool
+	case []byte:
+		return oidBytea
+	case time.Time:
+		return oidTimestamp
+	default:
+		return oidText
+	}
+}
+
+func toInt64(v interface{}) (i int64, err error) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), nil
+	case int8:
+		return int64(x), nil
+	case int16:
+		return int64(x), nil
+	case int32:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case uint:
+		return int64(x), nil
+	case uint8:
+		return int64(x), nil
+	case uint16:
+		return int64(x), nil
+	case uint32:
+		return int64(x), nil
+	case uint64:
+		return int64(x), nil
+	case float32:
+		return int64(x), nil
+	case float64:
+		return int64(x), nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+	case []byte:
+		return strconv.ParseInt(strings.TrimSpace(string(x)), 10, 64)
+	default:
+		return 0, fmt.Errorf("can not convert %T to integer", v)
+	}
+}
+
+func toFloat64(v interface{}) (f float64, err error) {
+	switch x := v.(type) {
+	case float32:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(x), 64)
+	case []byte:
+		return strconv.ParseFloat(strings.TrimSpace(string(x)), 64)
+	default:
+		var i int64
+		if i, err = toInt64(v); err != nil {
+			return
+		}
+		return float64(i), nil
+	}
+}
+
+func toBool(v interface{}) (b bool, err error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		return parseBool(x)
+	case []byte:
+		return parseBool(string(x))
+	default:
+		var i int64
+		if i, err = toInt64(v); err != nil {
+			return
+		}
+		return i != 0, nil
+	}
+}
+
+func parseBool(s string) (b bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "t", "true", "y", "yes", "on", "1":
+		return true, nil
+	case "f", "false", "n", "no", "off", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean value: %v", s)
+	}
+}
+
+func toTime(v interface{}) (t time.Time, err error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case string:
+		return parseTime(x)
+	case []byte:
+		return parseTime(string(x))
+	default:
+		// sqlite unix timestamp
+		var i int64
+		if i, err = toInt64(v); err != nil {
+			return
+		}
+		return time.Unix(i, 0).UTC(), nil
+	}
+}
+
+func parseTime(s string) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeParseLayouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("invalid time value: %v", s)
+	return
+}
+
+// encodeText encodes value in postgres text format.
+func encodeText(oid uint32, v interface{}) (b []byte, err error) {
+	switch oid {
+	case oidBool:
+		var bv bool
+		if bv, err = toBool(v); err != nil {
+			return
+		}
+		if bv {
+			return []byte("t"), nil
+		}
+		return []byte("f"), nil
+	case oidBytea:
+		var raw []byte
+		switch x := v.(type) {
+		case []byte:
+			raw = x
+		case string:
+			raw = []byte(x)
+		default:
+			raw = []byte(fmt.Sprint(x))
+		}
+		return []byte(`\x` + hex.EncodeToString(raw)), nil
+	}
+
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return []byte(x), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(x), 'g', -1, 32), nil
+	case float64:
+		return strconv.AppendFloat(nil, x, 'g', -1, 64), nil
+	case bool:
+		if x {
+			return []byte("t"), nil
+		}
+		return []byte("f"), nil
+	case time.Time:
+		switch oid {
+		case oidDate:
+			return []byte(x.Format(dateLayout)), nil
+		case oidTime:
+			return []byte(x.Format(timeLayout)), nil
+		default:
+			return []byte(x.UTC().Format(timestampLayout)), nil
+		}
+	default:
+		return []byte(fmt.Sprint(x)), nil
+	}
+}
+
+// encodeBinary encodes value in postgres binary format.
+func encodeBinary(oid uint32, v interface{}) (b []byte, err error) {
+	switch oid {
+	case oidBool:
+		var bv bool
+		if bv, err = toBool(v); err != nil {
+			return
+		}
+		if bv {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case oidInt2, oidInt4, oidInt8:
+		var i int64
+		if i, err = toInt64(v); err != nil {
+			return
+		}
+		switch oid {
+		case oidInt2:
+			b = make([]byte, 2)
+			binary.BigEndian.PutUint16(b, uint16(i))
+		case oidInt4:
+			b = make([]byte, 4)
+			binary.BigEndian.PutUint32(b, uint32(i))
+		default:
+			b = make([]byte, 8)
+			binary.BigEndian.PutUint64(b, uint64(i))
+		}
+		return
+	case oidFloat4, oidFloat8:
+		var f float64
+		if f, err = toFloat64(v); err != nil {
+			return
+		}
+		if oid == oidFloat4 {
+			b = make([]byte, 4)
+			binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+		} else {
+			b = make([]byte, 8)
+			binary.BigEndian.PutUint64(b, math.Float64bits(f))
+		}
+		return
+	case oidTimestamp, oidTimestampTZ, oidDate, oidTime:
+		var t time.Time
+		if t, err = toTime(v); err != nil {
+			return
+		}
+		t = t.UTC()
+		switch oid {
+		case oidDate:
+			b = make([]byte, 4)
+			days := int32(t.Sub(pgEpoch).Hours() / 24)
+			binary.BigEndian.PutUint32(b, uint32(days))
+		case oidTime:
+			b = make([]byte, 8)
+			midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			binary.BigEndian.PutUint64(b, uint64(t.Sub(midnight)/time.Microsecond))
+		default:
+			b = make([]byte, 8)
+			binary.BigEndian.PutUint64(b, uint64(t.Sub(pgEpoch)/time.Microsecond))
+		}
+		return
+	default:
+		// text, varchar and bytea binary format is the raw bytes
+		switch x := v.(type) {
+		case []byte:
+			return x, nil
+		case string:
+			return []byte(x), nil
+		default:
+			return encodeText(oid, v)
+		}
+	}
+}
+
+// decodeParam converts bind parameter to driver value according to its type oid and format.
+func decodeParam(oid uint32, format int16, data []byte) (v interface{}, err error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	if format == formatBinary {
+		switch oid {
+		case oidBool:
+			if len(data) != 1 {
+				return nil, ErrInvalidMessage
+			}
+			return data[0] != 0, nil
+		case oidInt2:
+			if len(data) != 2 {
+				return nil, ErrInvalidMessage
+			}
+			return int64(int16(binary.BigEndian.Uint16(data))), nil
+		case oidInt4:
+			if len(data) != 4 {
+				return nil, ErrInvalidMessage
+			}
+			return int64(int32(binary.BigEndian.Uint32(data))), nil
+		case oidInt8:
+			if len(data) != 8 {
+				return nil, ErrInvalidMessage
+			}
+			return int64(binary.BigEndian.Uint64(data)), nil
+		case oidFloat4:
+			if len(data) != 4 {
+				return nil, ErrInvalidMessage
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+		case oidFloat8:
+			if len(data) != 8 {
+				return nil, ErrInvalidMessage
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+		case oidTimestamp, oidTimestampTZ:
+			if len(data) != 8 {
+				return nil, ErrInvalidMessage
+			}
+			usec := int64(binary.BigEndian.Uint64(data))
+			return pgEpoch.Add(time.Duration(usec) * time.Microsecond).Format(timestampLayout), nil
+		case oidDate:
+			if len(data) != 4 {
+				return nil, ErrInvalidMessage
+			}
+			days := int32(binary.BigEndian.Uint32(data))
+			return pgEpoch.AddDate(0, 0, int(days)).Format(dateLayout), nil
+		case oidBytea:
+			return data, nil
+		default:
+			return string(data), nil
+		}
+	}
+
+	s := string(data)
+
+	switch oid {
+	case oidBool:
+		return parseBool(s)
+	case oidInt2, oidInt4, oidInt8:
+		return strconv.ParseInt(s, 10, 64)
+	case oidFloat4, oidFloat8:
+		return strconv.ParseFloat(s, 64)
+	case oidBytea:
+		if strings.HasPrefix(s, `\x`) {
+			return hex.DecodeString(s[2:])
+		}
+		return data, nil
+	default:
+		// unknown and text typed parameter is sent as string, sqlite handles type affinity
+		return s, nil
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
@@ -29,16 +30,23 @@ import (
 )
 
 var (
-	isTestNetAddr bool
+	isTestNetAddr     bool
+	multiSigThreshold uint
 )
 
 func init() {
 	flag.BoolVar(&isTestNetAddr, "addrgen", false, "addrgen generates a testnet address from your key pair")
+	flag.UintVar(&multiSigThreshold, "threshold", 0, "signature threshold to generate multisig address, public keys are separated by comma")
 }
 
 func runAddrgen() {
 	var publicKey *asymmetric.PublicKey
 
+	if multiSigThreshold > 0 {
+		runMultiSigAddrgen()
+		return
+	}
+
 	if publicKeyHex != "" {
 		publicKeyBytes, err := hex.DecodeString(publicKeyHex)
 		if err != nil {
@@ -70,3 +78,27 @@ func runAddrgen() {
 	}
 	fmt.Printf("wallet address: %s\n", addr)
 }
+
+func runMultiSigAddrgen() {
+	internalAddr, err := crypto.MultiSigPubKeyHash(uint32(multiSigThreshold), parsePublicKeys(publicKeyHex))
+	if err != nil {
+		log.Fatalf("unexpected error: %v\n", err)
+	}
+	fmt.Printf("multisig wallet address: %s\n", crypto.Hash2Addr(internalAddr, crypto.TestNet))
+}
+
+// parsePublicKeys parses the public key hex strings separated by comma.
+func parsePublicKeys(keysHex string) (publicKeys []*asymmetric.PublicKey) {
+	for _, keyHex := range strings.Split(keysHex, ",") {
+		publicKeyBytes, err := hex.DecodeString(strings.TrimSpace(keyHex))
+		if err != nil {
+			log.Fatalf("error converting hex: %s\n", err)
+		}
+		publicKey, err := asymmetric.ParsePubKey(publicKeyBytes)
+		if err != nil {
+			log.Fatalf("error converting public key: %s\n", err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return
+}
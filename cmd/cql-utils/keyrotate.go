@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	newPrivateKeyFile string
+)
+
+func init() {
+	flag.StringVar(&newPrivateKeyFile, "new-private", "new_private.key", "new private key file to rotate to")
+}
+
+// runKeyRotate rotates the node key of config to a new private key, the rotation
+// record is signed by the current key and submitted to all block producers.
+func runKeyRotate() {
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.Errorf("read master key failed: %v", err)
+		os.Exit(1)
+	}
+
+	if err = client.Init(configFile, []byte(masterKey)); err != nil {
+		log.Errorf("init rpc client failed: %v", err)
+		os.Exit(1)
+	}
+
+	nodeID, err := kms.GetLocalNodeID()
+	if err != nil {
+		log.Errorf("get local node id failed: %v", err)
+		os.Exit(1)
+	}
+	oldNonce, err := kms.GetLocalNonce()
+	if err != nil {
+		log.Errorf("get local nonce failed: %v", err)
+		os.Exit(1)
+	}
+	signer, err := kms.GetLocalSigner()
+	if err != nil {
+		log.Errorf("get local signer failed: %v", err)
+		os.Exit(1)
+	}
+
+	newKey, err := loadOrGenPrivateKey(newPrivateKeyFile, []byte(masterKey))
+	if err != nil {
+		log.Errorf("load new private key failed: %v", err)
+		os.Exit(1)
+	}
+
+	var sequence uint64 = 1
+	rotations, err := rpc.FetchKeyRotations(nodeID, 0)
+	if err != nil {
+		log.Errorf("fetch key rotations failed: %v", err)
+		os.Exit(1)
+	}
+	if len(rotations) > 0 {
+		sequence = rotations[len(rotations)-1].Sequence + 1
+	}
+
+	minDifficulty := difficulty
+	if minDifficulty < conf.GConf.MinNodeIDDifficulty {
+		minDifficulty = conf.GConf.MinNodeIDDifficulty
+	}
+	log.Infof("mining nonce for new key with difficulty %d", minDifficulty)
+	nonceCh := make(chan mine.NonceInfo, 1)
+	mine.NewCPUMiner(nil).ComputeBlockNonce(mine.MiningBlock{
+		Data:      newKey.PubKey().Serialize(),
+		NonceChan: nonceCh,
+	}, mine.Uint256{}, minDifficulty)
+	newNonce := <-nonceCh
+
+	r, err := kms.NewKeyRotation(nodeID, sequence, *oldNonce, newKey.PubKey(), newNonce.Nonce, signer)
+	if err != nil {
+		log.Errorf("sign key rotation failed: %v", err)
+		os.Exit(1)
+	}
+
+	// the record is replicated to all BPs by the BP leader, followers reject the submission
+	req := &proto.RotateKeyReq{Rotation: *r}
+	submitted := false
+	for _, bp := range route.GetBPs() {
+		resp := new(proto.RotateKeyResp)
+		if err = rpc.NewCaller().CallNode(bp, route.DHTRotateKey.String(), req, resp); err != nil {
+			log.Warnf("submit key rotation to %s failed: %v", bp, err)
+			continue
+		}
+		log.Infof("key rotation submitted to %s: %s", bp, resp.Msg)
+		submitted = true
+		break
+	}
+	if !submitted {
+		log.Error("submit key rotation to block producers failed")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Node id: %s\n", nodeID)
+	fmt.Printf("Rotation sequence: %d\n", sequence)
+	fmt.Printf("New private key file: %s\n", newPrivateKeyFile)
+	fmt.Printf("New public key's hex: %s\n", hex.EncodeToString(newKey.PubKey().Serialize()))
+	fmt.Printf("New nonce: %v\n", newNonce.Nonce)
+	fmt.Printf("Old key is valid until: %s\n", r.Timestamp.Add(kms.RotationGracePeriod))
+	fmt.Println("Replace PrivateKeyFile and Nonce of this node in config before the old key expires")
+}
+
+func loadOrGenPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.PrivateKey, err error) {
+	if _, err = os.Stat(keyFilePath); err == nil {
+		return kms.LoadPrivateKey(keyFilePath, masterKey)
+	}
+	if key, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+		return
+	}
+	err = kms.SavePrivateKey(keyFilePath, key, masterKey)
+	return
+}
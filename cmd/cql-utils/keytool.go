@@ -18,14 +18,29 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
+	"syscall"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/crypto/symmetric"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
+// runKeytool shows the private key info, or upgrades/re-encrypts the private key file
+// with the action specified by the first argument: show, upgrade or passwd.
 func runKeytool() {
+	action := flag.Arg(0)
+	if action == "" {
+		action = "show"
+	}
+	if action != "show" && action != "upgrade" && action != "passwd" {
+		log.Errorf("unknown keytool action: %s, should be show, upgrade or passwd", action)
+		os.Exit(1)
+	}
+
 	masterKey, err := readMasterKey()
 	if err != nil {
 		fmt.Printf("read master key failed: %v\n", err)
@@ -35,7 +50,61 @@ func runKeytool() {
 	privateKey, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
 	if err != nil {
 		log.Errorf("load private key failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "upgrade":
+		// re-encrypt with the same master key in the current format
+		if err = kms.ReEncryptPrivateKey(privateKeyFile, []byte(masterKey), []byte(masterKey)); err != nil {
+			log.Errorf("upgrade private key failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "passwd":
+		newMasterKey, err := readNewMasterKey()
+		if err != nil {
+			fmt.Printf("read new master key failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err = kms.ReEncryptPrivateKey(privateKeyFile, []byte(masterKey), []byte(newMasterKey)); err != nil {
+			log.Errorf("re-encrypt private key failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	version, params, err := kms.PrivateKeyFileVersion(privateKeyFile)
+	if err != nil {
+		log.Errorf("read private key file version failed: %v\n", err)
+		os.Exit(1)
 	}
 
 	fmt.Printf("Public key's hex: %s\n", hex.EncodeToString(privateKey.PubKey().Serialize()))
+	if version == 0 {
+		fmt.Println("Key file format: legacy, run \"cql-utils -tool keytool upgrade\" to upgrade")
+	} else {
+		fmt.Printf("Key file format: version %d, scrypt N=%d r=%d p=%d\n", version, 1<<params.LogN, params.R, params.P)
+		if params != symmetric.DefaultKDFParams {
+			fmt.Println("Key derivation parameters differ from default, run upgrade to update")
+		}
+	}
+}
+
+// readNewMasterKey reads the new master key twice for confirmation.
+func readNewMasterKey() (string, error) {
+	fmt.Println("Enter new master key(press Enter for default: \"\"): ")
+	bytePwd, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("Confirm new master key: ")
+	confirmPwd, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(bytePwd) != string(confirmPwd) {
+		return "", fmt.Errorf("master keys do not match")
+	}
+	return string(bytePwd), nil
 }
@@ -32,15 +32,19 @@ var (
 	publicKeyHex   string
 	privateKeyFile string
 	configFile     string
+	signerSocket   string
+	signerKeyLabel string
 )
 
 func init() {
 	log.SetLevel(log.InfoLevel)
 
-	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, rpc, nonce, confgen, addrgen, adapterconfgen")
+	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, keyrotate, multisig, signer, rpc, nonce, confgen, addrgen, adapterconfgen")
 	flag.StringVar(&publicKeyHex, "public", "", "public key hex string to mine node id/nonce")
 	flag.StringVar(&privateKeyFile, "private", "private.key", "private key file to generate/show")
 	flag.StringVar(&configFile, "config", "config.yaml", "config file to use")
+	flag.StringVar(&signerSocket, "socket", "signer.sock", "unix socket path of remote signer")
+	flag.StringVar(&signerKeyLabel, "label", "node", "key label of remote signer")
 }
 
 func main() {
@@ -69,6 +73,27 @@ func main() {
 			os.Exit(1)
 		}
 		runKeytool()
+	case "keyrotate":
+		if configFile == "" {
+			// error
+			log.Error("config file path is required for keyrotate")
+			os.Exit(1)
+		}
+		runKeyRotate()
+	case "multisig":
+		if configFile == "" || privateKeyFile == "" {
+			// error
+			log.Error("config file path and privateKey path are required for multisig")
+			os.Exit(1)
+		}
+		runMultiSig()
+	case "signer":
+		if privateKeyFile == "" {
+			// error
+			log.Error("privateKey path is required for signer")
+			os.Exit(1)
+		}
+		runSigner()
 	case "rpc":
 		runRPC()
 	case "nonce":
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	multiSigAddress      string
+	newMultiSigThreshold uint
+	newMultiSigKeysHex   string
+	multiSigEnvelopeFile string
+	multiSigSubmit       bool
+)
+
+func init() {
+	flag.StringVar(&multiSigAddress, "wallet", "", "multisig wallet address to bind, derived from -threshold and -public by default")
+	flag.UintVar(&newMultiSigThreshold, "new-threshold", 0, "new signature threshold of the multisig wallet")
+	flag.StringVar(&newMultiSigKeysHex, "new-public", "", "new public keys of the multisig wallet separated by comma")
+	flag.StringVar(&multiSigEnvelopeFile, "envelope", "multisig.envelope", "multisig envelope file to create/sign")
+	flag.BoolVar(&multiSigSubmit, "submit", false, "submit the multisig envelope to block producer")
+}
+
+// runMultiSig creates the envelope binding a wallet to a multisig key set, or replacing the key set
+// of a bound wallet, signs it with the private key and submits it once the threshold is reached.
+// The envelope file is passed around and signed by each key holder in turn.
+func runMultiSig() {
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.Errorf("read master key failed: %v", err)
+		os.Exit(1)
+	}
+	if err = client.Init(configFile, []byte(masterKey)); err != nil {
+		log.Errorf("init rpc client failed: %v", err)
+		os.Exit(1)
+	}
+	privateKey, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
+	if err != nil {
+		log.Errorf("load private key failed: %v", err)
+		os.Exit(1)
+	}
+
+	var tx *pt.MultiSigTx
+	if _, err = os.Stat(multiSigEnvelopeFile); err == nil {
+		if tx, err = loadMultiSigEnvelope(multiSigEnvelopeFile); err != nil {
+			log.Errorf("load multisig envelope failed: %v", err)
+			os.Exit(1)
+		}
+	} else if tx, err = newMultiSigBindEnvelope(); err != nil {
+		log.Errorf("create multisig envelope failed: %v", err)
+		os.Exit(1)
+	}
+
+	if err = tx.Sign(privateKey); err != nil {
+		log.Errorf("sign multisig envelope failed: %v", err)
+		os.Exit(1)
+	}
+	if err = saveMultiSigEnvelope(multiSigEnvelopeFile, tx); err != nil {
+		log.Errorf("save multisig envelope failed: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("multisig envelope file: %s\n", multiSigEnvelopeFile)
+	fmt.Printf("signatures: %d/%d\n", len(tx.Signatures), tx.Config.Threshold)
+
+	if !multiSigSubmit {
+		return
+	}
+	if err = tx.VerifyThreshold(); err != nil {
+		log.Errorf("verify multisig envelope failed: %v", err)
+		os.Exit(1)
+	}
+	req := &bp.AddTxReq{Tx: tx}
+	resp := &bp.AddTxResp{}
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		log.Errorf("submit multisig envelope failed: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("multisig envelope submitted: %s\n", tx.GetHash())
+}
+
+func newMultiSigBindEnvelope() (tx *pt.MultiSigTx, err error) {
+	if multiSigThreshold == 0 || publicKeyHex == "" {
+		err = crypto.ErrInvalidMultiSigKeys
+		return
+	}
+	var (
+		config    = &pt.MultiSigConfig{Threshold: uint32(multiSigThreshold), PublicKeys: parsePublicKeys(publicKeyHex)}
+		newConfig = config
+		addr      proto.AccountAddress
+	)
+	if multiSigAddress != "" {
+		if _, addr, err = crypto.Addr2Hash(multiSigAddress); err != nil {
+			return
+		}
+	} else if addr, err = config.Address(); err != nil {
+		return
+	}
+	if newMultiSigThreshold > 0 || newMultiSigKeysHex != "" {
+		newConfig = &pt.MultiSigConfig{
+			Threshold:  uint32(newMultiSigThreshold),
+			PublicKeys: parsePublicKeys(newMultiSigKeysHex),
+		}
+	}
+	if _, err = newConfig.Address(); err != nil {
+		return
+	}
+
+	req := &bp.NextAccountNonceReq{Addr: addr}
+	resp := &bp.NextAccountNonceResp{}
+	if err = requestBP(route.MCCNextAccountNonce, req, resp); err != nil {
+		return
+	}
+	tx = pt.NewMultiSigTx(config, pt.NewBindMultiSig(&pt.BindMultiSigHeader{
+		Address: addr,
+		Config:  *newConfig,
+		Nonce:   resp.Nonce,
+	}))
+	return
+}
+
+func loadMultiSigEnvelope(path string) (tx *pt.MultiSigTx, err error) {
+	var (
+		enc []byte
+		out pi.Transaction
+		ok  bool
+	)
+	if enc, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	if err = utils.DecodeMsgPack(enc, &out); err != nil {
+		return
+	}
+	if w, isWrapper := out.(*pi.TransactionWrapper); isWrapper {
+		out = w.Unwrap()
+	}
+	if tx, ok = out.(*pt.MultiSigTx); !ok {
+		err = pt.ErrMultiSigInvalidTx
+	}
+	return
+}
+
+func saveMultiSigEnvelope(path string, tx *pt.MultiSigTx) (err error) {
+	var out pi.Transaction = tx
+	enc, err := utils.EncodeMsgPack(out)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, enc.Bytes(), 0600)
+}
+
+func requestBP(method route.RemoteFunc, req interface{}, resp interface{}) (err error) {
+	var bpNodeID proto.NodeID
+	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
+		return
+	}
+	return rpc.NewCaller().CallNode(bpNodeID, method.String(), req, resp)
+}
@@ -27,7 +27,6 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/blockproducer"
 	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
 	"github.com/CovenantSQL/CovenantSQL/client"
-	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
@@ -52,7 +51,7 @@ var (
 )
 
 type canSign interface {
-	Sign(signer *asymmetric.PrivateKey) error
+	Sign(signer kms.Signer) error
 }
 
 func init() {
@@ -117,11 +116,11 @@ func checkAndSign(req interface{}) (err error) {
 	}
 
 	if canSignObj, ok := req.(canSign); ok {
-		var privKey *asymmetric.PrivateKey
-		if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		var signer kms.Signer
+		if signer, err = kms.GetLocalSigner(); err != nil {
 			return
 		}
-		if err = canSignObj.Sign(privKey); err != nil {
+		if err = canSignObj.Sign(signer); err != nil {
 			return
 		}
 	}
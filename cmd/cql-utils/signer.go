@@ -0,0 +1,67 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// runSigner serves the private key over a Unix socket as a remote signer,
+// so the node process could sign without holding the private key.
+func runSigner() {
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.Errorf("read master key failed: %v", err)
+		os.Exit(1)
+	}
+
+	signer, err := kms.LoadLocalSigner(privateKeyFile, []byte(masterKey))
+	if err != nil {
+		log.Errorf("load private key failed: %v", err)
+		os.Exit(1)
+	}
+
+	os.Remove(signerSocket)
+	listener, err := net.Listen("unix", signerSocket)
+	if err != nil {
+		log.Errorf("listen on %s failed: %v", signerSocket, err)
+		os.Exit(1)
+	}
+	// only the owner could connect to the signer
+	if err = os.Chmod(signerSocket, 0600); err != nil {
+		log.Errorf("change permission of %s failed: %v", signerSocket, err)
+		os.Exit(1)
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalCh
+		listener.Close()
+	}()
+
+	log.Infof("serving key %s with label %s on %s", privateKeyFile, signerKeyLabel, signerSocket)
+	service := kms.NewRemoteSignerService(map[string]kms.Signer{signerKeyLabel: signer})
+	service.Serve(listener)
+	os.Remove(signerSocket)
+}
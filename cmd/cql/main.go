@@ -56,6 +56,9 @@ var (
 	createDB   string // as a instance meta json string or simply a node count
 	dropDB     string // database id to drop
 	getBalance bool   // get balance of current account
+
+	// migration variables
+	migrationDir string // directory of versioned migration files
 )
 
 type varsFlag struct {
@@ -184,6 +187,9 @@ func init() {
 	flag.StringVar(&createDB, "create", "", "create database, argument can be instance requirement json or simply a node count requirement")
 	flag.StringVar(&dropDB, "drop", "", "drop database, argument should be a database id (without covenantsql:// scheme is acceptable)")
 	flag.BoolVar(&getBalance, "get-balance", false, "get balance of current account")
+
+	// migration flags
+	flag.StringVar(&migrationDir, "migrations", "migrations", "migration files directory for the migrate command")
 }
 
 func main() {
@@ -198,6 +204,15 @@ func main() {
 		return
 	}
 
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		// run schema migrations
+		if err = runMigrate(dsn, migrationDir, args[1:]); err != nil {
+			log.Errorf("migrate database failed: %v", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
 	if getBalance {
 		var stableCoinBalance, covenantCoinBalance uint64
 
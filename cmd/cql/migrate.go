@@ -0,0 +1,333 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// migrationTable defines the reserved table recording applied migrations.
+	migrationTable = "_cql_schema_migrations"
+)
+
+var (
+	// migrationFile matches migration file names like 0001_create_users.up.sql.
+	migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+	// ErrMigrationDiverged indicates the applied history in database does not match local migration files.
+	ErrMigrationDiverged = errors.New("migration history diverged")
+)
+
+// migration defines a versioned schema change with the up and down scripts.
+type migration struct {
+	version  uint64
+	name     string
+	up       string
+	down     string
+	checksum string
+}
+
+// appliedMigration defines a migration recorded in database.
+type appliedMigration struct {
+	version   uint64
+	name      string
+	checksum  string
+	appliedAt string
+}
+
+// loadMigrations reads migration files from directory, migrations are sorted by version.
+func loadMigrations(dir string) (migrations []*migration, err error) {
+	var files []os.FileInfo
+	if files, err = ioutil.ReadDir(dir); err != nil {
+		err = errors.Wrapf(err, "read migration directory %v failed", dir)
+		return
+	}
+
+	byVersion := make(map[uint64]*migration)
+	for _, f := range files {
+		matches := migrationFile.FindStringSubmatch(f.Name())
+		if f.IsDir() || matches == nil {
+			continue
+		}
+
+		var version uint64
+		if version, err = strconv.ParseUint(matches[1], 10, 64); err != nil {
+			err = errors.Wrapf(err, "invalid migration version of %v", f.Name())
+			return
+		}
+
+		var content []byte
+		if content, err = ioutil.ReadFile(filepath.Join(dir, f.Name())); err != nil {
+			err = errors.Wrapf(err, "read migration file %v failed", f.Name())
+			return
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: matches[2]}
+			byVersion[version] = m
+			migrations = append(migrations, m)
+		} else if m.name != matches[2] {
+			err = errors.Errorf("migration version %d is used by both %v and %v", version, m.name, matches[2])
+			return
+		}
+
+		if matches[3] == "up" {
+			m.up = string(content)
+			sum := sha256.Sum256(content)
+			m.checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	for _, m := range migrations {
+		if strings.TrimSpace(m.up) == "" {
+			err = errors.Errorf("migration %d_%v has no up script", m.version, m.name)
+			return
+		}
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return
+}
+
+// checkHistory verifies the applied migrations are exactly the leading local migrations.
+func checkHistory(migrations []*migration, applied []*appliedMigration) (err error) {
+	if len(applied) > len(migrations) {
+		return errors.Wrapf(ErrMigrationDiverged, "migration %d_%v is applied but not found locally",
+			applied[len(migrations)].version, applied[len(migrations)].name)
+	}
+
+	for i, a := range applied {
+		m := migrations[i]
+		switch {
+		case m.version != a.version:
+			return errors.Wrapf(ErrMigrationDiverged, "expect migration %d_%v, but %d_%v is applied",
+				m.version, m.name, a.version, a.name)
+		case m.name != a.name:
+			return errors.Wrapf(ErrMigrationDiverged, "migration %d is applied as %v, but named %v locally",
+				m.version, a.name, m.name)
+		case m.checksum != a.checksum:
+			return errors.Wrapf(ErrMigrationDiverged, "migration %d_%v is modified after applied",
+				m.version, m.name)
+		}
+	}
+
+	return
+}
+
+// openMigrationDB opens the database specified by dsn, plain database id is accepted.
+func openMigrationDB(dsn string) (db *sql.DB, err error) {
+	if cfg, err := client.ParseDSN(dsn); err != nil || cfg.DatabaseID == "" {
+		cfg = client.NewConfig()
+		cfg.DatabaseID = dsn
+		dsn = cfg.FormatDSN()
+	}
+
+	return sql.Open("covenantsql", dsn)
+}
+
+// loadAppliedMigrations reads the applied migrations, the reserved table is created if not exists.
+func loadAppliedMigrations(db *sql.DB) (applied []*appliedMigration, err error) {
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + migrationTable + ` (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		err = errors.Wrap(err, "create migration table failed")
+		return
+	}
+
+	var rows *sql.Rows
+	if rows, err = db.Query(`SELECT version, name, checksum, applied_at FROM ` + migrationTable +
+		` ORDER BY version`); err != nil {
+		err = errors.Wrap(err, "query applied migrations failed")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := &appliedMigration{}
+		if err = rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			err = errors.Wrap(err, "scan applied migration failed")
+			return
+		}
+		applied = append(applied, a)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// applyMigration runs the migration script and records the history in a single client transaction.
+func applyMigration(db *sql.DB, m *migration, up bool) (err error) {
+	var tx *sql.Tx
+	if tx, err = db.Begin(); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	script := m.up
+	if !up {
+		script = m.down
+	}
+	if _, err = tx.Exec(script); err != nil {
+		return
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO `+migrationTable+` (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+			m.version, m.name, m.checksum, time.Now().UTC().Format(time.RFC3339))
+	} else {
+		_, err = tx.Exec(`DELETE FROM `+migrationTable+` WHERE version = ?`, m.version)
+	}
+	if err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+// runMigrate executes the migrate sub command: up [N], down [N] or status.
+func runMigrate(dsn string, dir string, args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("migrate command requires an action: up, down or status")
+	}
+	if dsn == "" {
+		return errors.New("migrate command requires -dsn")
+	}
+
+	action, steps := args[0], 0
+	if len(args) > 1 {
+		if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+			return errors.Errorf("invalid migration steps: %v", args[1])
+		}
+	} else if action == "down" {
+		// roll back the latest migration by default
+		steps = 1
+	}
+
+	var migrations []*migration
+	if migrations, err = loadMigrations(dir); err != nil {
+		return
+	}
+
+	var db *sql.DB
+	if db, err = openMigrationDB(dsn); err != nil {
+		return
+	}
+	defer db.Close()
+
+	var applied []*appliedMigration
+	if applied, err = loadAppliedMigrations(db); err != nil {
+		return
+	}
+
+	switch action {
+	case "status":
+		printMigrationStatus(migrations, applied)
+		return checkHistory(migrations, applied)
+	case "up":
+		if err = checkHistory(migrations, applied); err != nil {
+			return
+		}
+		pending := migrations[len(applied):]
+		if steps > 0 && steps < len(pending) {
+			pending = pending[:steps]
+		}
+		if len(pending) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		for _, m := range pending {
+			if err = applyMigration(db, m, true); err != nil {
+				return errors.Wrapf(err, "apply migration %d_%v failed", m.version, m.name)
+			}
+			fmt.Printf("applied migration %d_%v\n", m.version, m.name)
+		}
+	case "down":
+		if err = checkHistory(migrations, applied); err != nil {
+			return
+		}
+		for i := len(applied) - 1; i >= 0 && i >= len(applied)-steps; i-- {
+			m := migrations[i]
+			if strings.TrimSpace(m.down) == "" {
+				return errors.Errorf("migration %d_%v has no down script", m.version, m.name)
+			}
+			if err = applyMigration(db, m, false); err != nil {
+				return errors.Wrapf(err, "revert migration %d_%v failed", m.version, m.name)
+			}
+			fmt.Printf("reverted migration %d_%v\n", m.version, m.name)
+		}
+	default:
+		return errors.Errorf("unknown migrate action: %v", action)
+	}
+
+	return
+}
+
+// printMigrationStatus prints local migrations with applied states.
+func printMigrationStatus(migrations []*migration, applied []*appliedMigration) {
+	appliedByVersion := make(map[uint64]*appliedMigration)
+	for _, a := range applied {
+		appliedByVersion[a.version] = a
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, m := range migrations {
+		status, appliedAt := "pending", ""
+		if a, ok := appliedByVersion[m.version]; ok {
+			status, appliedAt = "applied", a.appliedAt
+			if a.checksum != m.checksum || a.name != m.name {
+				status = "modified"
+			}
+			delete(appliedByVersion, m.version)
+		}
+		fmt.Fprintf(w, "%d\t%v\t%v\t%v\n", m.version, m.name, status, appliedAt)
+	}
+	for _, a := range applied {
+		if _, ok := appliedByVersion[a.version]; ok {
+			fmt.Fprintf(w, "%d\t%v\t%v\t%v\n", a.version, a.name, "missing", a.appliedAt)
+		}
+	}
+}
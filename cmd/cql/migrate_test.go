@@ -0,0 +1,79 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrations(t *testing.T) {
+	Convey("load and check migrations", t, func() {
+		dir, err := ioutil.TempDir("", "cql_migrations")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		files := map[string]string{
+			"0002_add_email.up.sql":      "ALTER TABLE users ADD COLUMN email TEXT",
+			"0001_create_users.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY)",
+			"0001_create_users.down.sql": "DROP TABLE users",
+			"README.md":                  "not a migration",
+		}
+		for name, content := range files {
+			So(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), ShouldBeNil)
+		}
+
+		migrations, err := loadMigrations(dir)
+		So(err, ShouldBeNil)
+		So(migrations, ShouldHaveLength, 2)
+		So(migrations[0].version, ShouldEqual, 1)
+		So(migrations[0].name, ShouldEqual, "create_users")
+		So(migrations[0].down, ShouldEqual, "DROP TABLE users")
+		So(migrations[1].version, ShouldEqual, 2)
+		So(migrations[1].down, ShouldBeEmpty)
+
+		applied := []*appliedMigration{{version: 1, name: "create_users", checksum: migrations[0].checksum}}
+		So(checkHistory(migrations, nil), ShouldBeNil)
+		So(checkHistory(migrations, applied), ShouldBeNil)
+
+		// modified after applied
+		applied[0].checksum = "modified"
+		So(errors.Cause(checkHistory(migrations, applied)), ShouldEqual, ErrMigrationDiverged)
+
+		// applied out of order
+		applied = []*appliedMigration{{version: 2, name: "add_email", checksum: migrations[1].checksum}}
+		So(errors.Cause(checkHistory(migrations, applied)), ShouldEqual, ErrMigrationDiverged)
+
+		// applied but missing locally
+		applied = []*appliedMigration{
+			{version: 1, name: "create_users", checksum: migrations[0].checksum},
+			{version: 2, name: "add_email", checksum: migrations[1].checksum},
+			{version: 3, name: "drop_email", checksum: ""},
+		}
+		So(errors.Cause(checkHistory(migrations, applied)), ShouldEqual, ErrMigrationDiverged)
+
+		// down only migration is invalid
+		So(ioutil.WriteFile(filepath.Join(dir, "0003_x.down.sql"), []byte("SELECT 1"), 0644), ShouldBeNil)
+		_, err = loadMigrations(dir)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -43,6 +43,8 @@ const (
 	CmdSetDatabase = "set_database"
 	// CmdDeleteDatabase is the command to del database
 	CmdDeleteDatabase = "delete_database"
+	// CmdRotateKey is the command to rotate node key
+	CmdRotateKey = "rotate_key"
 )
 
 // LocalStorage holds consistent and storage struct
@@ -64,6 +66,10 @@ func initStorage(dbFile string) (stor *LocalStorage, err error) {
 		{
 			Pattern: "CREATE TABLE IF NOT EXISTS `databases` (`id` TEXT NOT NULL PRIMARY KEY, `meta` BLOB);",
 		},
+		{
+			Pattern: "CREATE TABLE IF NOT EXISTS `key_rotations` (`id` TEXT NOT NULL, `sequence` INTEGER NOT NULL, " +
+				"`rotation` BLOB, PRIMARY KEY (`id`, `sequence`));",
+		},
 	})
 	if err != nil {
 		wd, _ := os.Getwd()
@@ -104,6 +110,10 @@ func (s *LocalStorage) Commit(ctx context.Context, wb twopc.WriteBatch) (err err
 }
 
 func (s *LocalStorage) commit(ctx context.Context, payload *KayakPayload) (err error) {
+	if payload.Command == CmdRotateKey {
+		return s.commitKeyRotation(ctx, payload)
+	}
+
 	var nodeToSet proto.Node
 	err = utils.DecodeMsgPack(payload.Data, &nodeToSet)
 	if err != nil {
@@ -132,6 +142,28 @@ func (s *LocalStorage) commit(ctx context.Context, payload *KayakPayload) (err e
 	return s.Storage.Commit(ctx, execLog)
 }
 
+// commitKeyRotation applies the key rotation record to kms and DHT cache.
+func (s *LocalStorage) commitKeyRotation(ctx context.Context, payload *KayakPayload) (err error) {
+	var kr KeyRotationPayload
+	if err = utils.DecodeMsgPack(payload.Data, &kr); err != nil {
+		log.Errorf("unmarshal key rotation from payload failed: %s", err)
+		return
+	}
+	execLog, err := s.compileExecLog(payload)
+	if err != nil {
+		log.Errorf("compile exec log failed: %s", err)
+		return
+	}
+	if err = kms.ApplyKeyRotation(&kr.Rotation); err != nil {
+		log.Errorf("kms apply key rotation of node %s failed: %v", kr.Rotation.NodeID, err)
+	}
+	if s.consistent != nil && kr.Node.ID != "" {
+		s.consistent.AddCache(kr.Node)
+	}
+
+	return s.Storage.Commit(ctx, execLog)
+}
+
 // Rollback implements twopc Worker.Rollback
 func (s *LocalStorage) Rollback(ctx context.Context, wb twopc.WriteBatch) (err error) {
 	payload, err := s.decodeLog(wb)
@@ -207,6 +239,42 @@ func (s *LocalStorage) compileExecLog(payload *KayakPayload) (execLog *storage.E
 				},
 			},
 		}
+	case CmdRotateKey:
+		var kr KeyRotationPayload
+		if err = utils.DecodeMsgPack(payload.Data, &kr); err != nil {
+			log.Errorf("compileExecLog: unmarshal key rotation failed: %v", err)
+			return
+		}
+		var rotationBuf *bytes.Buffer
+		if rotationBuf, err = utils.EncodeMsgPack(kr.Rotation); err != nil {
+			return
+		}
+		execLog = &storage.ExecLog{
+			Queries: []storage.Query{
+				{
+					Pattern: "INSERT OR REPLACE INTO `key_rotations` (`id`, `sequence`, `rotation`) VALUES (?, ?, ?);",
+					Args: []sql.NamedArg{
+						sql.Named("", string(kr.Rotation.NodeID)),
+						sql.Named("", int64(kr.Rotation.Sequence)),
+						sql.Named("", rotationBuf.Bytes()),
+					},
+				},
+			},
+		}
+		if kr.Node.ID != "" {
+			// keep the rotated key of node in DHT
+			var nodeBuf *bytes.Buffer
+			if nodeBuf, err = utils.EncodeMsgPack(kr.Node); err != nil {
+				return
+			}
+			execLog.Queries = append(execLog.Queries, storage.Query{
+				Pattern: "INSERT OR REPLACE INTO `dht` (`id`, `node`) VALUES (?, ?);",
+				Args: []sql.NamedArg{
+					sql.Named("", kr.Node.ID),
+					sql.Named("", nodeBuf.Bytes()),
+				},
+			})
+		}
 	default:
 		err = errors.New("undefined command: " + payload.Command)
 		log.Error(err)
@@ -305,6 +373,50 @@ func (s *KayakKVServer) SetNode(node *proto.Node) (err error) {
 	return
 }
 
+// KeyRotationPayload is the payload data of CmdRotateKey, Node is the DHT node info with rotated key
+// if the node is already in DHT.
+type KeyRotationPayload struct {
+	Rotation proto.KeyRotation
+	Node     proto.Node
+}
+
+// SetKeyRotation implements route.KeyRotationPersistence.
+func (s *KayakKVServer) SetKeyRotation(r *proto.KeyRotation) (err error) {
+	kr := &KeyRotationPayload{
+		Rotation: *r,
+	}
+	if s.KVStorage.consistent != nil {
+		if node, errGet := s.KVStorage.consistent.GetNode(string(r.NodeID)); errGet == nil {
+			kr.Node = *node
+			kr.Node.PublicKey = r.NewPublicKey
+			kr.Node.Nonce = r.NewNonce
+		}
+	}
+
+	krBuf, err := utils.EncodeMsgPack(kr)
+	if err != nil {
+		log.Errorf("marshal key rotation failed: %v", err)
+		return
+	}
+	payload := &KayakPayload{
+		Command: CmdRotateKey,
+		Data:    krBuf.Bytes(),
+	}
+
+	writeData, err := utils.EncodeMsgPack(payload)
+	if err != nil {
+		log.Errorf("marshal payload failed: %v", err)
+		return err
+	}
+
+	_, err = s.Runtime.Apply(writeData.Bytes())
+	if err != nil {
+		log.Errorf("Apply key rotation failed: %s\nPayload:\n	%s", err, writeData)
+	}
+
+	return
+}
+
 // DelNode implements consistent.Persistence
 func (s *KayakKVServer) DelNode(nodeID proto.NodeID) (err error) {
 	// no need to del node currently
@@ -148,6 +148,16 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		return
 	}
 
+	// start node health checker
+	log.Infof("start node health checker")
+	healthChecker := bp.NewNodeHealthChecker(
+		dbService,
+		metric.NewHealthCriteria(conf.GConf.BP.NodeMetricTimeout),
+		conf.GConf.BP.NodeHealthCheckInterval,
+	)
+	healthChecker.Start()
+	defer healthChecker.Stop()
+
 	// init main chain service
 	log.Infof("register main chain service rpc")
 	chainConfig := bp.NewConfig(
@@ -164,6 +174,7 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		log.Errorf("init chain failed: %v", err)
 		return
 	}
+	dbService.LoadMultiSig = chain.LoadMultiSig
 	chain.Start()
 	defer chain.Stop()
 
@@ -297,12 +308,18 @@ func loadGenesis() *types.Block {
 			"stableCoinBalance":   ba.StableCoinBalance,
 			"covenantCoinBalance": ba.CovenantCoinBalance,
 		}).Debugf("setting one balance fixture in genesis block")
-		genesis.Transactions = append(genesis.Transactions, pt.NewBaseAccount(
-			&pt.Account{
-				Address:             proto.AccountAddress(ba.Address),
-				StableCoinBalance:   ba.StableCoinBalance,
-				CovenantCoinBalance: ba.CovenantCoinBalance,
-			}))
+		account := &pt.Account{
+			Address:             proto.AccountAddress(ba.Address),
+			StableCoinBalance:   ba.StableCoinBalance,
+			CovenantCoinBalance: ba.CovenantCoinBalance,
+		}
+		if ba.MultiSig != nil {
+			account.MultiSig = &pt.MultiSigConfig{
+				Threshold:  ba.MultiSig.Threshold,
+				PublicKeys: ba.MultiSig.PublicKeys,
+			}
+		}
+		genesis.Transactions = append(genesis.Transactions, pt.NewBaseAccount(account))
 	}
 
 	return genesis
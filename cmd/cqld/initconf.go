@@ -27,7 +27,7 @@ import (
 )
 
 func initNodePeers(nodeID proto.NodeID, publicKeystorePath string) (nodes *[]proto.Node, peers *kayak.Peers, thisNode *proto.Node, err error) {
-	privateKey, err := kms.GetLocalPrivateKey()
+	signer, err := kms.GetLocalSigner()
 	if err != nil {
 		log.Fatalf("get local private key failed: %s", err)
 	}
@@ -65,7 +65,7 @@ func initNodePeers(nodeID proto.NodeID, publicKeystorePath string) (nodes *[]pro
 
 	log.Debugf("AllNodes:\n %v\n", conf.GConf.KnownNodes)
 
-	err = peers.Sign(privateKey)
+	err = peers.Sign(signer)
 	if err != nil {
 		log.Errorf("sign peers failed: %s", err)
 		return nil, nil, nil, err
@@ -27,6 +27,8 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
@@ -51,6 +53,13 @@ var (
 	cpuProfile string
 	memProfile string
 
+	// metric
+	metricWeb string
+
+	// trace
+	traceCollector  string
+	traceSampleRate float64
+
 	// other
 	noLogo      bool
 	showVersion bool
@@ -74,6 +83,12 @@ func init() {
 	flag.StringVar(&cpuProfile, "cpu-profile", "", "Path to file for CPU profiling information")
 	flag.StringVar(&memProfile, "mem-profile", "", "Path to file for memory profiling information")
 
+	flag.StringVar(&metricWeb, "metric-web", "", "Address to listen for prometheus metrics, default not started")
+
+	flag.StringVar(&traceCollector, "trace-collector", "",
+		"OTLP/HTTP traces endpoint, e.g. http://127.0.0.1:4318/v1/traces, default not traced")
+	flag.Float64Var(&traceSampleRate, "trace-sample-rate", 1.0, "Probability of sampling a new trace")
+
 	flag.BoolVar(&clientMode, "client", false, "run as client")
 	flag.StringVar(&clientOperation, "operation", "FindNeighbor", "client operation")
 
@@ -136,6 +151,19 @@ func main() {
 		return
 	}
 
+	if len(metricWeb) > 0 {
+		if _, err = metric.StartMetricWeb(metricWeb); err != nil {
+			log.Fatalf("start metric web server on %s failed: %v", metricWeb, err)
+		}
+	}
+
+	if len(traceCollector) > 0 {
+		trace.SetSampleRate(traceSampleRate)
+		exporter := trace.NewOTLPExporter(traceCollector, "cqld")
+		trace.RegisterExporter(exporter)
+		defer exporter.Stop()
+	}
+
 	if err := runNode(conf.GConf.ThisNodeID, conf.GConf.ListenAddr); err != nil {
 		log.Fatalf("run kayak failed: %v", err.Error())
 	}
@@ -48,6 +48,14 @@ type BaseAccountInfo struct {
 	Address             hash.Hash `yaml:"Address"`
 	StableCoinBalance   uint64    `yaml:"StableCoinBalance"`
 	CovenantCoinBalance uint64    `yaml:"CovenantCoinBalance"`
+	// MultiSig binds the account to a multisig key set, the address must be derived from it.
+	MultiSig *MultiSigInfo `yaml:"MultiSig,omitempty"`
+}
+
+// MultiSigInfo defines the key set and signature threshold of a multisig account.
+type MultiSigInfo struct {
+	Threshold  uint32                  `yaml:"Threshold"`
+	PublicKeys []*asymmetric.PublicKey `yaml:"PublicKeys"`
 }
 
 // BPGenesisInfo hold all genesis info fields.
@@ -82,6 +90,10 @@ type BPInfo struct {
 	ChainFileName string `yaml:"ChainFileName"`
 	// BPGenesis is the genesis block filed
 	BPGenesis BPGenesisInfo `yaml:"BPGenesisInfo,omitempty"`
+	// NodeHealthCheckInterval is the interval to evaluate miner health from uploaded metrics
+	NodeHealthCheckInterval time.Duration `yaml:"NodeHealthCheckInterval,omitempty"`
+	// NodeMetricTimeout is the max age of uploaded metrics for a miner to be alive
+	NodeMetricTimeout time.Duration `yaml:"NodeMetricTimeout,omitempty"`
 }
 
 // MinerDatabaseFixture config.
@@ -106,6 +118,14 @@ type MinerInfo struct {
 	TestFixtures []*MinerDatabaseFixture `yaml:"TestFixtures,omitempty"`
 }
 
+// RemoteSignerInfo defines the remote signer holding the node private key.
+type RemoteSignerInfo struct {
+	// Socket is the Unix socket path of remote signer
+	Socket string `yaml:"Socket"`
+	// KeyLabel is the label of node key in remote signer
+	KeyLabel string `yaml:"KeyLabel"`
+}
+
 // DNSSeed defines seed DNS info.
 type DNSSeed struct {
 	EnforcedDNSSEC bool     `yaml:"EnforcedDNSSEC"`
@@ -129,6 +149,9 @@ type Config struct {
 
 	DNSSeed DNSSeed `yaml:"DNSSeed"`
 
+	// RemoteSigner is used instead of PrivateKeyFile if set
+	RemoteSigner *RemoteSignerInfo `yaml:"RemoteSigner,omitempty"`
+
 	BP    *BPInfo    `yaml:"BlockProducer"`
 	Miner *MinerInfo `yaml:"Miner,omitempty"`
 
@@ -68,6 +68,16 @@ func TestConf(t *testing.T) {
 			ParentHash: h,
 			Timestamp:  time.Now().UTC(),
 			BlockHash:  h,
+			BaseAccounts: []BaseAccountInfo{
+				{
+					Address:           h,
+					StableCoinBalance: 100,
+					MultiSig: &MultiSigInfo{
+						Threshold:  1,
+						PublicKeys: []*asymmetric.PublicKey{BPPubkey},
+					},
+				},
+			},
 		},
 	}
 	Convey("LoadConfig", t, func() {
@@ -154,6 +164,11 @@ func TestConf(t *testing.T) {
 		So(configNew.BP.NodeID, ShouldResemble, config.BP.NodeID)
 		So(configNew.BP.Nonce, ShouldResemble, config.BP.Nonce)
 		So(configNew.BP.PublicKey.Serialize(), ShouldResemble, config.BP.PublicKey.Serialize())
+		So(configNew.BP.BPGenesis.BaseAccounts, ShouldHaveLength, 1)
+		So(configNew.BP.BPGenesis.BaseAccounts[0].MultiSig, ShouldNotBeNil)
+		So(configNew.BP.BPGenesis.BaseAccounts[0].MultiSig.Threshold, ShouldEqual, 1)
+		So(configNew.BP.BPGenesis.BaseAccounts[0].MultiSig.PublicKeys[0].IsEqual(BPPubkey),
+			ShouldBeTrue)
 
 		configNew, err = LoadConfig("notExistFile")
 		So(err, ShouldNotBeNil)
@@ -74,6 +74,9 @@ type Consistent struct {
 	count            int64
 	persist          Persistence
 	cacheLock        sync.RWMutex
+	// unhealthy nodes are kept in circle but should be skipped on resource allocation
+	unhealthy     map[proto.NodeID]bool
+	unhealthyLock sync.RWMutex
 	sync.RWMutex
 }
 
@@ -220,6 +223,28 @@ func (c *Consistent) ResetCache() {
 	c.sortedHashes = NodeKeys{}
 }
 
+// SetNodeHealth marks the node healthy or unhealthy, unhealthy nodes are still in the circle.
+func (c *Consistent) SetNodeHealth(nodeID proto.NodeID, healthy bool) {
+	c.unhealthyLock.Lock()
+	defer c.unhealthyLock.Unlock()
+
+	if healthy {
+		delete(c.unhealthy, nodeID)
+		return
+	}
+	if c.unhealthy == nil {
+		c.unhealthy = make(map[proto.NodeID]bool)
+	}
+	c.unhealthy[nodeID] = true
+}
+
+// IsNodeHealthy returns if the node is not marked unhealthy.
+func (c *Consistent) IsNodeHealthy(nodeID proto.NodeID) bool {
+	c.unhealthyLock.RLock()
+	defer c.unhealthyLock.RUnlock()
+	return !c.unhealthy[nodeID]
+}
+
 // GetNeighbor returns an node close to where name hashes to in the circle.
 func (c *Consistent) GetNeighbor(name string) (proto.Node, error) {
 	c.RLock()
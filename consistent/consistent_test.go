@@ -109,6 +109,33 @@ func TestRemoveNonExisting(t *testing.T) {
 	CheckNum(len(x.circle), x.NumberOfReplicas, t)
 }
 
+func TestNodeHealth(t *testing.T) {
+	kms.Unittest = true
+	os.Remove(testStorePath)
+	kms.ResetBucket()
+
+	x, _ := InitConsistent(testStorePath, new(KMSStorage), false)
+	defer os.Remove(testStorePath)
+	x.Add(NewNodeFromID("abcdefg"))
+	x.Add(NewNodeFromID("qwer"))
+
+	if !x.IsNodeHealthy("abcdefg") {
+		t.Errorf("expected node to be healthy by default")
+	}
+	x.SetNodeHealth("abcdefg", false)
+	if x.IsNodeHealthy("abcdefg") || !x.IsNodeHealthy("qwer") {
+		t.Errorf("expected only abcdefg to be unhealthy")
+	}
+
+	// unhealthy nodes are kept in circle
+	CheckNum(len(x.circle), 2*x.NumberOfReplicas, t)
+
+	x.SetNodeHealth("abcdefg", true)
+	if !x.IsNodeHealthy("abcdefg") {
+		t.Errorf("expected node to be healthy again")
+	}
+}
+
 func TestGetEmpty(t *testing.T) {
 	kms.Unittest = true
 	os.Remove(testStorePath)
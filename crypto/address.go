@@ -17,12 +17,30 @@
 package crypto
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/btcsuite/btcutil/base58"
 )
 
+var (
+	// ErrInvalidMultiSigKeys indicates the key set or threshold of a multisig account is invalid.
+	ErrInvalidMultiSigKeys = errors.New("invalid multisig keys or threshold")
+)
+
+const (
+	// MaxMultiSigKeys is the max number of keys of a multisig account.
+	MaxMultiSigKeys = 16
+
+	// multiSigAddressPrefix separates multisig account addresses from single key ones.
+	multiSigAddressPrefix = "CQL-MULTISIG"
+)
+
 const (
 	// MainNet is the version byte for main net.
 	MainNet byte = 0x0
@@ -54,6 +72,44 @@ func PubKeyHash(pubKey *asymmetric.PublicKey) (addr proto.AccountAddress, err er
 	return
 }
 
+// MultiSigPubKeyHash generates the account hash address for a multisig account, which requires
+// at least threshold signatures of pubKeys. The order of pubKeys is irrelevant.
+func MultiSigPubKeyHash(
+	threshold uint32, pubKeys []*asymmetric.PublicKey) (addr proto.AccountAddress, err error,
+) {
+	if threshold == 0 || int(threshold) > len(pubKeys) || len(pubKeys) > MaxMultiSigKeys {
+		err = ErrInvalidMultiSigKeys
+		return
+	}
+
+	keys := make([][]byte, 0, len(pubKeys))
+	for _, k := range pubKeys {
+		if k == nil {
+			err = ErrInvalidMultiSigKeys
+			return
+		}
+		keys = append(keys, k.Serialize())
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	for i := 1; i < len(keys); i++ {
+		if bytes.Equal(keys[i-1], keys[i]) {
+			// duplicated key
+			err = ErrInvalidMultiSigKeys
+			return
+		}
+	}
+
+	buffer := bytes.NewBufferString(multiSigAddressPrefix)
+	binary.Write(buffer, binary.BigEndian, threshold)
+	binary.Write(buffer, binary.BigEndian, uint32(len(keys)))
+	for _, k := range keys {
+		buffer.Write(k)
+	}
+
+	addr = proto.AccountAddress(hash.THashH(buffer.Bytes()))
+	return
+}
+
 // Addr2Hash converts base58 address to internal account address hash.
 func Addr2Hash(addr string) (version byte, internalAddr proto.AccountAddress, err error) {
 	var hashBytes []byte
@@ -102,3 +102,40 @@ func TestPubKeyHashAndAddressing(t *testing.T) {
 		So(addr, ShouldEqual, "1FinCZcguUux4fxM5dJuuGCUNRTw49Dx26KnAzA8Kh4djuHeH2")
 	})
 }
+
+func TestMultiSigPubKeyHash(t *testing.T) {
+	Convey("Multisig address should be independent of key order", t, func() {
+		var keys []*asymmetric.PublicKey
+		for i := 0; i < 3; i++ {
+			_, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			keys = append(keys, pub)
+		}
+		addr1, err := MultiSigPubKeyHash(2, keys)
+		So(err, ShouldBeNil)
+		addr2, err := MultiSigPubKeyHash(2, []*asymmetric.PublicKey{keys[2], keys[0], keys[1]})
+		So(err, ShouldBeNil)
+		So(addr1, ShouldEqual, addr2)
+
+		// threshold is part of the address
+		addr3, err := MultiSigPubKeyHash(3, keys)
+		So(err, ShouldBeNil)
+		So(addr3, ShouldNotEqual, addr1)
+
+		// never collides with single key address
+		single, err := PubKeyHash(keys[0])
+		So(err, ShouldBeNil)
+		addr4, err := MultiSigPubKeyHash(1, keys[:1])
+		So(err, ShouldBeNil)
+		So(addr4, ShouldNotEqual, single)
+
+		_, err = MultiSigPubKeyHash(0, keys)
+		So(err, ShouldEqual, ErrInvalidMultiSigKeys)
+		_, err = MultiSigPubKeyHash(4, keys)
+		So(err, ShouldEqual, ErrInvalidMultiSigKeys)
+		_, err = MultiSigPubKeyHash(2, []*asymmetric.PublicKey{keys[0], keys[0]})
+		So(err, ShouldEqual, ErrInvalidMultiSigKeys)
+		_, err = MultiSigPubKeyHash(1, []*asymmetric.PublicKey{nil})
+		So(err, ShouldEqual, ErrInvalidMultiSigKeys)
+	})
+}
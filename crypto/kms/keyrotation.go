@@ -0,0 +1,426 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// kmsRotationBucketName is the boltdb bucket name of key rotation records
+	kmsRotationBucketName = "kms_rotation"
+	// kmsRotationReceivedBucketName is the boltdb bucket name of key rotation local receive time
+	kmsRotationReceivedBucketName = "kms_rotation_received"
+)
+
+// KeyRotationFetcher fetches key rotation records of node with Sequence > after
+// from an authoritative source, e.g. block producers.
+type KeyRotationFetcher func(id proto.NodeID, after uint64) ([]*proto.KeyRotation, error)
+
+var (
+	// RotationGracePeriod is the duration the old key is still valid after rotation
+	RotationGracePeriod = 24 * time.Hour
+	// RotationMaxClockSkew is the max allowed difference between record timestamp and local time
+	RotationMaxClockSkew = 10 * time.Minute
+	// RotationSyncInterval is the min interval between key rotation syncs of a node triggered by unknown keys
+	RotationSyncInterval = time.Minute
+
+	rotationFetcher     KeyRotationFetcher
+	rotationFetcherLock sync.RWMutex
+
+	// rotationSyncTime records the last key rotation sync time of nodes triggered by unknown keys
+	rotationSyncTime     = make(map[proto.NodeID]time.Time)
+	rotationSyncTimeLock sync.Mutex
+)
+
+const (
+	// maxRotationSyncRecords is the max node count of sync time records kept before pruning
+	maxRotationSyncRecords = 1024
+)
+
+var (
+	// ErrInvalidKeyRotation indicates the key rotation signature is invalid
+	ErrInvalidKeyRotation = errors.New("invalid key rotation signature")
+	// ErrKeyRotationSequence indicates the key rotation sequence is not continuous
+	ErrKeyRotationSequence = errors.New("key rotation sequence mismatch")
+	// ErrKeyRotationOldKey indicates the old key of rotation is not the current key of node
+	ErrKeyRotationOldKey = errors.New("key rotation old key not match current key")
+	// ErrKeyRotationDifficulty indicates the new key nonce difficulty is too low
+	ErrKeyRotationDifficulty = errors.New("key rotation new key difficulty too low")
+	// ErrKeyRotationTimestamp indicates the key rotation timestamp is out of range
+	ErrKeyRotationTimestamp = errors.New("key rotation timestamp out of range")
+	// ErrNoKeyRotationFetcher indicates no key rotation fetcher is set
+	ErrNoKeyRotationFetcher = errors.New("no key rotation fetcher")
+)
+
+// NewKeyRotation creates a key rotation record of node signed by the old key signer.
+func NewKeyRotation(id proto.NodeID, sequence uint64, oldNonce mine.Uint256,
+	newKey *asymmetric.PublicKey, newNonce mine.Uint256, signer Signer) (r *proto.KeyRotation, err error) {
+	r = &proto.KeyRotation{
+		NodeID:       id,
+		Sequence:     sequence,
+		OldPublicKey: signer.PubKey(),
+		OldNonce:     oldNonce,
+		NewPublicKey: newKey,
+		NewNonce:     newNonce,
+		Timestamp:    time.Now().UTC(),
+	}
+	if r.Signature, err = signer.Sign(r.Hash()); err != nil {
+		r = nil
+	}
+	return
+}
+
+// VerifyKeyRotation verifies the record r follows prev, prev is nil for the first rotation.
+func VerifyKeyRotation(prev *proto.KeyRotation, r *proto.KeyRotation) (err error) {
+	if !r.Verify() {
+		return ErrInvalidKeyRotation
+	}
+	if prev == nil {
+		if r.Sequence != 1 {
+			return ErrKeyRotationSequence
+		}
+		// first rotation, the old key is bound to node id by PoW nonce
+		if !IsIDPubNonceValid(r.NodeID.ToRawNodeID(), &r.OldNonce, r.OldPublicKey) {
+			return ErrKeyRotationOldKey
+		}
+	} else {
+		if r.Sequence != prev.Sequence+1 {
+			return ErrKeyRotationSequence
+		}
+		if !r.OldPublicKey.IsEqual(prev.NewPublicKey) || r.OldNonce != prev.NewNonce {
+			return ErrKeyRotationOldKey
+		}
+	}
+	if conf.GConf != nil && r.NewKeyDifficulty() < conf.GConf.MinNodeIDDifficulty {
+		return ErrKeyRotationDifficulty
+	}
+	return
+}
+
+// CheckKeyRotation checks the record timestamp against local time and verifies it follows the
+// local records, it's used by block producers for the newly submitted records before replication.
+func CheckKeyRotation(r *proto.KeyRotation) (err error) {
+	if r == nil {
+		return ErrInvalidKeyRotation
+	}
+	skew := time.Since(r.Timestamp)
+	if skew > RotationMaxClockSkew || skew < -RotationMaxClockSkew {
+		return ErrKeyRotationTimestamp
+	}
+	var prev *proto.KeyRotation
+	if prev, err = GetLastKeyRotation(r.NodeID); err != nil {
+		return
+	}
+	return VerifyKeyRotation(prev, r)
+}
+
+// AcceptKeyRotation checks the newly submitted record and applies it.
+func AcceptKeyRotation(r *proto.KeyRotation) (err error) {
+	if err = CheckKeyRotation(r); err != nil {
+		return
+	}
+	return ApplyKeyRotation(r)
+}
+
+// ApplyKeyRotation verifies and appends the key rotation record,
+// then updates the node public key and nonce in public keystore.
+func ApplyKeyRotation(r *proto.KeyRotation) (err error) {
+	if r == nil {
+		return ErrInvalidKeyRotation
+	}
+	if err = appendKeyRotation(r); err != nil {
+		log.Errorf("apply key rotation of node %s failed: %s", r.NodeID, err)
+		return
+	}
+
+	nodeInfo, err := GetNodeInfo(r.NodeID)
+	if err != nil {
+		if err != ErrKeyNotFound {
+			return
+		}
+		nodeInfo = &proto.Node{ID: r.NodeID}
+	}
+	nodeInfo.PublicKey = r.NewPublicKey
+	nodeInfo.Nonce = r.NewNonce
+	log.Infof("node %s key rotated, sequence: %d", r.NodeID, r.Sequence)
+	return setNode(nodeInfo)
+}
+
+func appendKeyRotation(r *proto.KeyRotation) (err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return ErrPKSNotInitialized
+	}
+
+	return pks.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket([]byte(kmsRotationBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		var rotations []*proto.KeyRotation
+		if byteVal := bucket.Get([]byte(r.NodeID)); byteVal != nil {
+			if err = utils.DecodeMsgPack(byteVal, &rotations); err != nil {
+				return
+			}
+		}
+		var prev *proto.KeyRotation
+		if len(rotations) > 0 {
+			prev = rotations[len(rotations)-1]
+		}
+		if err = VerifyKeyRotation(prev, r); err != nil {
+			return
+		}
+		rotations = append(rotations, r)
+		buf, err := utils.EncodeMsgPack(rotations)
+		if err != nil {
+			return
+		}
+		if err = bucket.Put([]byte(r.NodeID), buf.Bytes()); err != nil {
+			return
+		}
+		return putKeyRotationReceived(tx, r, time.Now().UTC())
+	})
+}
+
+// putKeyRotationReceived records the local receive time of rotation r, the signed record
+// timestamp is chosen by the rotating node and can't bound the old key grace period alone.
+func putKeyRotationReceived(tx *bolt.Tx, r *proto.KeyRotation, t time.Time) (err error) {
+	bucket := tx.Bucket([]byte(kmsRotationReceivedBucketName))
+	if bucket == nil {
+		return ErrBucketNotInitialized
+	}
+	received := make(map[uint64]time.Time)
+	if byteVal := bucket.Get([]byte(r.NodeID)); byteVal != nil {
+		if err = utils.DecodeMsgPack(byteVal, &received); err != nil {
+			return
+		}
+	}
+	received[r.Sequence] = t
+	buf, err := utils.EncodeMsgPack(received)
+	if err != nil {
+		return
+	}
+	return bucket.Put([]byte(r.NodeID), buf.Bytes())
+}
+
+// getKeyRotationReceived returns the local receive time of key rotations of node by sequence.
+func getKeyRotationReceived(id proto.NodeID) (received map[uint64]time.Time, err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return nil, ErrPKSNotInitialized
+	}
+
+	received = make(map[uint64]time.Time)
+	err = pks.db.View(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket([]byte(kmsRotationReceivedBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		if byteVal := bucket.Get([]byte(id)); byteVal != nil {
+			err = utils.DecodeMsgPack(byteVal, &received)
+		}
+		return
+	})
+	return
+}
+
+// GetKeyRotations returns the key rotation records of node with Sequence > after.
+func GetKeyRotations(id proto.NodeID, after uint64) (rotations []*proto.KeyRotation, err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return nil, ErrPKSNotInitialized
+	}
+
+	err = pks.db.View(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket([]byte(kmsRotationBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		byteVal := bucket.Get([]byte(id))
+		if byteVal == nil {
+			return
+		}
+		var all []*proto.KeyRotation
+		if err = utils.DecodeMsgPack(byteVal, &all); err != nil {
+			return
+		}
+		for _, r := range all {
+			if r.Sequence > after {
+				rotations = append(rotations, r)
+			}
+		}
+		return
+	})
+	return
+}
+
+// GetLastKeyRotation returns the latest key rotation record of node, nil if node never rotated.
+func GetLastKeyRotation(id proto.NodeID) (r *proto.KeyRotation, err error) {
+	rotations, err := GetKeyRotations(id, 0)
+	if err == nil && len(rotations) > 0 {
+		r = rotations[len(rotations)-1]
+	}
+	return
+}
+
+// SetKeyRotationFetcher sets the fetcher used to sync key rotation records of unknown keys.
+func SetKeyRotationFetcher(f KeyRotationFetcher) {
+	rotationFetcherLock.Lock()
+	defer rotationFetcherLock.Unlock()
+	rotationFetcher = f
+}
+
+// SyncKeyRotations fetches and applies the missing key rotation records of node.
+func SyncKeyRotations(id proto.NodeID) (err error) {
+	rotationFetcherLock.RLock()
+	f := rotationFetcher
+	rotationFetcherLock.RUnlock()
+	if f == nil {
+		return ErrNoKeyRotationFetcher
+	}
+
+	var after uint64
+	last, err := GetLastKeyRotation(id)
+	if err != nil {
+		return
+	}
+	if last != nil {
+		after = last.Sequence
+	}
+	rotations, err := f(id, after)
+	if err != nil {
+		return
+	}
+	for _, r := range rotations {
+		if err = ApplyKeyRotation(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// IsNodeKeyValid returns if the key and nonce are valid for node id, the rotated key
+// is valid after rotation, and the old key is still valid in RotationGracePeriod.
+func IsNodeKeyValid(id *proto.RawNodeID, nonce *mine.Uint256, key *asymmetric.PublicKey) bool {
+	if key == nil || id == nil || nonce == nil {
+		return false
+	}
+	last, err := GetLastKeyRotation(proto.NodeID(id.String()))
+	if err != nil || last == nil {
+		return IsIDPubNonceValid(id, nonce, key)
+	}
+	if key.IsEqual(last.NewPublicKey) && *nonce == last.NewNonce {
+		return true
+	}
+	return key.IsEqual(last.OldPublicKey) && *nonce == last.OldNonce &&
+		time.Since(last.Timestamp) < RotationGracePeriod
+}
+
+// IsNodePublicKey returns if key is the public key of node, the old key is also accepted
+// in RotationGracePeriod. Missing key rotation records are synced if fetcher is set.
+func IsNodePublicKey(id proto.NodeID, key *asymmetric.PublicKey) bool {
+	return IsNodePublicKeyAt(id, key, time.Now())
+}
+
+// IsNodePublicKeyAt returns if key was the public key of node at time t, each rotated out key
+// is valid until RotationGracePeriod after its rotation. As t is usually a timestamp signed by
+// the key holder, the rotated out key is also rejected once RotationGracePeriod has passed since
+// the rotation was received locally, so it can't sign blocks backdated into the grace period.
+func IsNodePublicKeyAt(id proto.NodeID, key *asymmetric.PublicKey, t time.Time) bool {
+	if key == nil {
+		return false
+	}
+	if isNodePublicKeyAt(id, key, t) {
+		return true
+	}
+	// unknown keys are rejected without asking block producers again in RotationSyncInterval
+	if !allowRotationSync(id, time.Now()) {
+		return false
+	}
+	if err := SyncKeyRotations(id); err != nil {
+		log.Debugf("sync key rotations of node %s failed: %s", id, err)
+		return false
+	}
+	return isNodePublicKeyAt(id, key, t)
+}
+
+func isNodePublicKeyAt(id proto.NodeID, key *asymmetric.PublicKey, t time.Time) bool {
+	rotations, err := GetKeyRotations(id, 0)
+	if err != nil || len(rotations) == 0 {
+		current, err := GetPublicKey(id)
+		return err == nil && current != nil && key.IsEqual(current)
+	}
+
+	received, err := getKeyRotationReceived(id)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	validFrom := time.Time{}
+	for _, r := range rotations {
+		receivedAt, ok := received[r.Sequence]
+		if !ok {
+			// records stored before receive time tracking fall back to the signed timestamp
+			receivedAt = r.Timestamp
+		}
+		if key.IsEqual(r.OldPublicKey) && !t.Before(validFrom) &&
+			t.Before(r.Timestamp.Add(RotationGracePeriod)) &&
+			now.Before(receivedAt.Add(RotationGracePeriod)) {
+			return true
+		}
+		validFrom = r.Timestamp
+	}
+	last := rotations[len(rotations)-1]
+	return key.IsEqual(last.NewPublicKey) && !t.Before(validFrom)
+}
+
+// allowRotationSync records the sync time of node and returns false if node was synced in RotationSyncInterval.
+func allowRotationSync(id proto.NodeID, now time.Time) bool {
+	rotationSyncTimeLock.Lock()
+	defer rotationSyncTimeLock.Unlock()
+
+	if last, ok := rotationSyncTime[id]; ok && now.Sub(last) < RotationSyncInterval {
+		return false
+	}
+	if len(rotationSyncTime) >= maxRotationSyncRecords {
+		for nodeID, last := range rotationSyncTime {
+			if now.Sub(last) >= RotationSyncInterval {
+				delete(rotationSyncTime, nodeID)
+			}
+		}
+		if len(rotationSyncTime) >= maxRotationSyncRecords {
+			// all records are recent, too many unknown keys
+			return false
+		}
+	}
+	rotationSyncTime[id] = now
+	return true
+}
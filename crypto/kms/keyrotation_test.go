@@ -0,0 +1,179 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/coreos/bbolt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const rotationDBFile = ".test_rotation.db"
+
+func TestKeyRotation(t *testing.T) {
+	Convey("rotate node key", t, func() {
+		pks = nil
+		os.Remove(rotationDBFile)
+		defer os.Remove(rotationDBFile)
+		So(InitPublicKeyStore(rotationDBFile, nil), ShouldBeNil)
+		defer SetKeyRotationFetcher(nil)
+
+		unittest := Unittest
+		Unittest = false
+		defer func() { Unittest = unittest }()
+
+		privKey0, pubKey0, _ := asymmetric.GenSecp256k1KeyPair()
+		privKey1, pubKey1, _ := asymmetric.GenSecp256k1KeyPair()
+		_, pubKey2, _ := asymmetric.GenSecp256k1KeyPair()
+		nonce0 := mine.Uint256{}
+		nonce1 := mine.Uint256{A: 1}
+		nonce2 := mine.Uint256{A: 2}
+		idHash := mine.HashBlock(pubKey0.Serialize(), nonce0)
+		nodeID := proto.NodeID(idHash.String())
+		rawID := nodeID.ToRawNodeID()
+
+		So(SetNode(&proto.Node{ID: nodeID, PublicKey: pubKey0, Nonce: nonce0}), ShouldBeNil)
+		So(IsNodeKeyValid(rawID, &nonce0, pubKey0), ShouldBeTrue)
+		So(IsNodeKeyValid(rawID, &nonce1, pubKey1), ShouldBeFalse)
+
+		// signed by the wrong key
+		r, err := NewKeyRotation(nodeID, 1, nonce0, pubKey1, nonce1, NewLocalSigner(privKey1))
+		So(err, ShouldBeNil)
+		So(ApplyKeyRotation(r), ShouldEqual, ErrKeyRotationOldKey)
+		r.NewNonce = nonce2
+		So(ApplyKeyRotation(r), ShouldEqual, ErrInvalidKeyRotation)
+
+		// sequence must start from 1
+		r, err = NewKeyRotation(nodeID, 2, nonce0, pubKey1, nonce1, NewLocalSigner(privKey0))
+		So(err, ShouldBeNil)
+		So(ApplyKeyRotation(r), ShouldEqual, ErrKeyRotationSequence)
+
+		// new key difficulty
+		r, err = NewKeyRotation(nodeID, 1, nonce0, pubKey1, nonce1, NewLocalSigner(privKey0))
+		So(err, ShouldBeNil)
+		minDifficulty := conf.GConf.MinNodeIDDifficulty
+		conf.GConf.MinNodeIDDifficulty = 256
+		So(ApplyKeyRotation(r), ShouldEqual, ErrKeyRotationDifficulty)
+		conf.GConf.MinNodeIDDifficulty = minDifficulty
+
+		// timestamp out of range
+		stale := *r
+		stale.Timestamp = r.Timestamp.Add(-2 * RotationMaxClockSkew)
+		So(AcceptKeyRotation(&stale), ShouldEqual, ErrKeyRotationTimestamp)
+
+		So(AcceptKeyRotation(r), ShouldBeNil)
+		pubKey, err := GetPublicKey(nodeID)
+		So(err, ShouldBeNil)
+		So(pubKey.IsEqual(pubKey1), ShouldBeTrue)
+
+		// both keys are valid in grace period
+		So(IsNodeKeyValid(rawID, &nonce1, pubKey1), ShouldBeTrue)
+		So(IsNodeKeyValid(rawID, &nonce0, pubKey0), ShouldBeTrue)
+		So(IsNodePublicKey(nodeID, pubKey1), ShouldBeTrue)
+		So(IsNodePublicKey(nodeID, pubKey0), ShouldBeTrue)
+		So(IsNodePublicKey(nodeID, pubKey2), ShouldBeFalse)
+
+		// old key registration keeps the rotated key
+		So(SetNode(&proto.Node{ID: nodeID, PublicKey: pubKey0, Nonce: nonce0}), ShouldBeNil)
+		pubKey, err = GetPublicKey(nodeID)
+		So(err, ShouldBeNil)
+		So(pubKey.IsEqual(pubKey1), ShouldBeTrue)
+
+		// key valid at block time
+		So(IsNodePublicKeyAt(nodeID, pubKey0, r.Timestamp.Add(-time.Hour)), ShouldBeTrue)
+		So(IsNodePublicKeyAt(nodeID, pubKey1, r.Timestamp.Add(-time.Hour)), ShouldBeFalse)
+		So(IsNodePublicKeyAt(nodeID, pubKey0, r.Timestamp.Add(2*RotationGracePeriod)), ShouldBeFalse)
+		So(IsNodePublicKeyAt(nodeID, pubKey1, r.Timestamp.Add(2*RotationGracePeriod)), ShouldBeTrue)
+
+		// backdated block of old key is rejected after grace period since local receive time
+		So(pks.db.Update(func(tx *bolt.Tx) error {
+			return putKeyRotationReceived(tx, r, time.Now().Add(-2*RotationGracePeriod))
+		}), ShouldBeNil)
+		So(IsNodePublicKeyAt(nodeID, pubKey0, r.Timestamp.Add(-time.Hour)), ShouldBeFalse)
+		So(IsNodePublicKeyAt(nodeID, pubKey1, r.Timestamp.Add(time.Hour)), ShouldBeTrue)
+		So(pks.db.Update(func(tx *bolt.Tx) error {
+			return putKeyRotationReceived(tx, r, time.Now())
+		}), ShouldBeNil)
+		So(IsNodePublicKeyAt(nodeID, pubKey0, r.Timestamp.Add(-time.Hour)), ShouldBeTrue)
+
+		// old key is invalid after grace period
+		gracePeriod := RotationGracePeriod
+		RotationGracePeriod = 0
+		So(IsNodeKeyValid(rawID, &nonce0, pubKey0), ShouldBeFalse)
+		So(IsNodePublicKey(nodeID, pubKey0), ShouldBeFalse)
+		So(SetNode(&proto.Node{ID: nodeID, PublicKey: pubKey0, Nonce: nonce0}), ShouldEqual,
+			ErrNodeIDKeyNonceNotMatch)
+		RotationGracePeriod = gracePeriod
+
+		// rotation chain
+		r2, err := NewKeyRotation(nodeID, 2, nonce0, pubKey2, nonce2, NewLocalSigner(privKey1))
+		So(err, ShouldBeNil)
+		So(ApplyKeyRotation(r2), ShouldEqual, ErrKeyRotationOldKey)
+		r2, err = NewKeyRotation(nodeID, 2, nonce1, pubKey2, nonce2, NewLocalSigner(privKey1))
+		So(err, ShouldBeNil)
+		So(ApplyKeyRotation(r2), ShouldBeNil)
+		rotations, err := GetKeyRotations(nodeID, 0)
+		So(err, ShouldBeNil)
+		So(rotations, ShouldHaveLength, 2)
+		rotations, err = GetKeyRotations(nodeID, 1)
+		So(err, ShouldBeNil)
+		So(rotations, ShouldHaveLength, 1)
+		So(rotations[0].NewPublicKey.IsEqual(pubKey2), ShouldBeTrue)
+
+		// sync rotation records from fetcher
+		all, err := GetKeyRotations(nodeID, 0)
+		So(err, ShouldBeNil)
+		So(ResetBucket(), ShouldBeNil)
+
+		// negative syncs are limited
+		rotationSyncTime = make(map[proto.NodeID]time.Time)
+		var fetched int
+		SetKeyRotationFetcher(func(id proto.NodeID, after uint64) ([]*proto.KeyRotation, error) {
+			fetched++
+			return nil, nil
+		})
+		So(IsNodePublicKey(nodeID, pubKey2), ShouldBeFalse)
+		So(IsNodePublicKey(nodeID, pubKey2), ShouldBeFalse)
+		So(fetched, ShouldEqual, 1)
+
+		syncInterval := RotationSyncInterval
+		RotationSyncInterval = 0
+		defer func() { RotationSyncInterval = syncInterval }()
+		So(IsNodePublicKey(nodeID, pubKey2), ShouldBeFalse)
+		SetKeyRotationFetcher(func(id proto.NodeID, after uint64) ([]*proto.KeyRotation, error) {
+			return nil, errors.New("fetch failed")
+		})
+		So(IsNodePublicKey(nodeID, pubKey2), ShouldBeFalse)
+		SetKeyRotationFetcher(func(id proto.NodeID, after uint64) ([]*proto.KeyRotation, error) {
+			So(id, ShouldEqual, nodeID)
+			So(after, ShouldEqual, 0)
+			return all, nil
+		})
+		So(IsNodePublicKey(nodeID, pubKey2), ShouldBeTrue)
+		nodeInfo, err := GetNodeInfo(nodeID)
+		So(err, ShouldBeNil)
+		So(nodeInfo.Nonce, ShouldResemble, nonce2)
+	})
+}
@@ -31,6 +31,7 @@ type LocalKeyStore struct {
 	isSet     bool
 	private   *asymmetric.PrivateKey
 	public    *asymmetric.PublicKey
+	signer    Signer
 	nodeID    []byte
 	nodeNonce *mine.Uint256
 	sync.RWMutex
@@ -74,6 +75,25 @@ func SetLocalKeyPair(private *asymmetric.PrivateKey, public *asymmetric.PublicKe
 	localKey.isSet = true
 	localKey.private = private
 	localKey.public = public
+	if private != nil {
+		localKey.signer = NewLocalSigner(private)
+	}
+}
+
+// SetLocalSigner sets the signer and its public key as local key pair, the private key
+// is not accessible by GetLocalPrivateKey unless it's a LocalSigner, this is a one time thing
+func SetLocalSigner(signer Signer) {
+	localKey.Lock()
+	defer localKey.Unlock()
+	if localKey.isSet {
+		return
+	}
+	localKey.isSet = true
+	localKey.signer = signer
+	localKey.public = signer.PubKey()
+	if s, ok := signer.(*LocalSigner); ok {
+		localKey.private = s.key
+	}
 }
 
 // SetLocalNodeIDNonce sets private and public key, this is a one time thing
@@ -140,7 +160,8 @@ func GetLocalPublicKey() (public *asymmetric.PublicKey, err error) {
 	return
 }
 
-// GetLocalPrivateKey gets local private key, if not set yet returns nil
+// GetLocalPrivateKey gets local private key, if not set yet returns nil,
+// it's also nil if a remote signer is used, signing should use GetLocalSigner instead
 //  all call to this func will be logged
 func GetLocalPrivateKey() (private *asymmetric.PrivateKey, err error) {
 	localKey.RLock()
@@ -156,3 +177,29 @@ func GetLocalPrivateKey() (private *asymmetric.PrivateKey, err error) {
 	//log.Debugf("###getting private key from###\n%s\n###getting private  key end###\n", buf[:count])
 	return
 }
+
+// GetLocalSigner gets local signer, all signing should be done by the signer
+// instead of the raw private key
+func GetLocalSigner() (signer Signer, err error) {
+	localKey.RLock()
+	signer = localKey.signer
+	if signer == nil {
+		err = ErrNilField
+	}
+	localKey.RUnlock()
+	return
+}
+
+// GenLocalSharedSecret generates the ECDH shared secret of local key and the remote public key
+func GenLocalSharedSecret(remote *asymmetric.PublicKey) (secret []byte, err error) {
+	var signer Signer
+	if signer, err = GetLocalSigner(); err != nil {
+		return
+	}
+	exchanger, ok := signer.(KeyExchanger)
+	if !ok {
+		err = ErrKeyExchangeNotSupported
+		return
+	}
+	return exchanger.GenSharedSecret(remote)
+}
@@ -37,7 +37,7 @@ var (
 )
 
 // LoadPrivateKey loads private key from keyFilePath, and verifies the hash
-// head
+// head, both versioned and legacy key files are supported
 func LoadPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.PrivateKey, err error) {
 	fileContent, err := ioutil.ReadFile(keyFilePath)
 	if err != nil {
@@ -45,7 +45,12 @@ func LoadPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.Priva
 		return
 	}
 
-	decData, err := symmetric.DecryptWithPassword(fileContent, masterKey)
+	var decData []byte
+	if symmetric.IsVersioned(fileContent) {
+		decData, err = symmetric.DecryptVersioned(fileContent, masterKey)
+	} else {
+		decData, err = symmetric.DecryptWithPassword(fileContent, masterKey)
+	}
 	if err != nil {
 		log.Errorf("decrypt private key error")
 		return
@@ -67,21 +72,64 @@ func LoadPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.Priva
 	return
 }
 
+// PrivateKeyFileVersion returns the format version of private key file, 0 for the legacy
+// format encrypted by symmetric.EncryptWithPassword
+func PrivateKeyFileVersion(keyFilePath string) (version uint8, params symmetric.KDFParams, err error) {
+	fileContent, err := ioutil.ReadFile(keyFilePath)
+	if err != nil {
+		return
+	}
+	if !symmetric.IsVersioned(fileContent) {
+		return
+	}
+	return symmetric.ParseKDFParams(fileContent)
+}
+
 // SavePrivateKey saves private key with its hash on the head to keyFilePath,
-// default perm is 0600
+// the key is encrypted in the versioned format, default perm is 0600
 func SavePrivateKey(keyFilePath string, key *asymmetric.PrivateKey, masterKey []byte) (err error) {
+	return savePrivateKey(keyFilePath, key, masterKey, symmetric.DefaultKDFParams)
+}
+
+func savePrivateKey(keyFilePath string, key *asymmetric.PrivateKey, masterKey []byte,
+	params symmetric.KDFParams) (err error) {
 	serializedKey := key.Serialize()
 	keyHash := hash.DoubleHashB(serializedKey)
 	rawData := append(keyHash, serializedKey...)
-	encKey, err := symmetric.EncryptWithPassword(rawData, masterKey)
+	encKey, err := symmetric.EncryptVersioned(rawData, masterKey, params)
 	if err != nil {
 		return
 	}
 	return ioutil.WriteFile(keyFilePath, encKey, 0400)
 }
 
+// ReEncryptPrivateKey upgrades the private key file to the current versioned format
+// and re-encrypts it with newMasterKey, the file is replaced atomically
+func ReEncryptPrivateKey(keyFilePath string, masterKey []byte, newMasterKey []byte) (err error) {
+	key, err := LoadPrivateKey(keyFilePath, masterKey)
+	if err != nil {
+		return
+	}
+
+	tmpPath := keyFilePath + ".tmp"
+	os.Remove(tmpPath)
+	if err = SavePrivateKey(tmpPath, key, newMasterKey); err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	if err = os.Rename(tmpPath, keyFilePath); err != nil {
+		os.Remove(tmpPath)
+	}
+	return
+}
+
 // InitLocalKeyPair initializes local private key
+// or connects to the remote signer if configured
 func InitLocalKeyPair(privateKeyPath string, masterKey []byte) (err error) {
+	if conf.GConf != nil && conf.GConf.RemoteSigner != nil && conf.GConf.RemoteSigner.Socket != "" {
+		return InitRemoteSigner(conf.GConf.RemoteSigner.Socket, conf.GConf.RemoteSigner.KeyLabel)
+	}
+
 	var privateKey *asymmetric.PrivateKey
 	var publicKey *asymmetric.PublicKey
 	initLocalKeyStore()
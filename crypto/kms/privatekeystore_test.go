@@ -25,6 +25,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/symmetric"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -97,6 +98,57 @@ func TestLoadPrivateKey(t *testing.T) {
 	})
 }
 
+func TestPrivateKeyFileVersion(t *testing.T) {
+	Convey("load legacy key file and upgrade", t, func() {
+		defer os.Remove(privateKeyPath)
+		pk, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		// legacy key file without version header
+		serializedKey := pk.Serialize()
+		enc, err := symmetric.EncryptWithPassword(append(hash.DoubleHashB(serializedKey), serializedKey...),
+			[]byte(password))
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(privateKeyPath, enc, 0400), ShouldBeNil)
+
+		version, _, err := PrivateKeyFileVersion(privateKeyPath)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 0)
+		lk, err := LoadPrivateKey(privateKeyPath, []byte(password))
+		So(err, ShouldBeNil)
+		So(lk.Serialize(), ShouldResemble, serializedKey)
+
+		err = ReEncryptPrivateKey(privateKeyPath, []byte("wrong"), []byte("new"))
+		So(err, ShouldNotBeNil)
+		err = ReEncryptPrivateKey(privateKeyPath, []byte(password), []byte("new"))
+		So(err, ShouldBeNil)
+
+		version, params, err := PrivateKeyFileVersion(privateKeyPath)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, symmetric.VersionScryptAESGCM)
+		So(params, ShouldResemble, symmetric.DefaultKDFParams)
+		_, err = LoadPrivateKey(privateKeyPath, []byte(password))
+		So(err, ShouldEqual, symmetric.ErrDecrypt)
+		lk, err = LoadPrivateKey(privateKeyPath, []byte("new"))
+		So(err, ShouldBeNil)
+		So(lk.Serialize(), ShouldResemble, serializedKey)
+	})
+	Convey("save with custom kdf params", t, func() {
+		defer os.Remove(privateKeyPath)
+		pk, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		params := symmetric.KDFParams{LogN: 10, R: 8, P: 1}
+		So(savePrivateKey(privateKeyPath, pk, []byte(password), params), ShouldBeNil)
+
+		_, loaded, err := PrivateKeyFileVersion(privateKeyPath)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, params)
+		lk, err := LoadPrivateKey(privateKeyPath, []byte(password))
+		So(err, ShouldBeNil)
+		So(lk.Serialize(), ShouldResemble, pk.Serialize())
+	})
+}
+
 func TestInitLocalKeyPair(t *testing.T) {
 	Convey("InitLocalKeyPair", t, func() {
 		conf.GConf.GenerateKeyPair = true
@@ -129,6 +129,14 @@ func InitPublicKeyStore(dbPath string, initNodes []proto.Node) (err error) {
 			log.Errorf("could not create bucket: %s", err)
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(kmsRotationBucketName)); err != nil {
+			log.Errorf("could not create bucket: %s", err)
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(kmsRotationReceivedBucketName)); err != nil {
+			log.Errorf("could not create bucket: %s", err)
+			return err
+		}
 		return nil // return from Update func
 	})
 	if err != nil {
@@ -230,16 +238,24 @@ func SetPublicKey(id proto.NodeID, nonce mine.Uint256, publicKey *asymmetric.Pub
 }
 
 // SetNode verifies nonce and sets {proto.Node.ID: proto.Node}
+// If the node key was rotated, the latest rotated key is always kept.
 func SetNode(nodeInfo *proto.Node) (err error) {
 	if nodeInfo == nil {
 		return ErrNilNode
 	}
 	if !Unittest {
-		if !IsIDPubNonceValid(nodeInfo.ID.ToRawNodeID(), &nodeInfo.Nonce, nodeInfo.PublicKey) {
+		if !IsNodeKeyValid(nodeInfo.ID.ToRawNodeID(), &nodeInfo.Nonce, nodeInfo.PublicKey) {
 			return ErrNodeIDKeyNonceNotMatch
 		}
 	}
 
+	if last, _ := GetLastKeyRotation(nodeInfo.ID); last != nil {
+		rotated := *nodeInfo
+		rotated.PublicKey = last.NewPublicKey
+		rotated.Nonce = last.NewNonce
+		nodeInfo = &rotated
+	}
+
 	return setNode(nodeInfo)
 }
 
@@ -308,6 +324,8 @@ func removeBucket() (err error) {
 	defer pksLock.Unlock()
 	if pks != nil {
 		err = pks.db.Update(func(tx *bolt.Tx) error {
+			tx.DeleteBucket([]byte(kmsRotationBucketName))
+			tx.DeleteBucket([]byte(kmsRotationReceivedBucketName))
 			return tx.DeleteBucket([]byte(kmsBucketName))
 		})
 		if err != nil {
@@ -329,6 +347,12 @@ func ResetBucket() error {
 	defer pksLock.Unlock()
 	bucketName := []byte(kmsBucketName)
 	err := pks.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(kmsRotationBucketName)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(kmsRotationReceivedBucketName)); err != nil {
+			return err
+		}
 		_, err := tx.CreateBucketIfNotExists(bucketName)
 		return err
 	})
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// The remote signer protocol is JSON-RPC 1.0 over a local Unix socket, so the key custody
+// process (e.g. a PKCS#11 bridge to a HSM) could be implemented in any language. Keys are
+// addressed by label like PKCS#11 objects, available methods are:
+//
+//	RemoteSigner.PublicKey       {"KeyLabel"}                 -> {"PublicKey"}
+//	RemoteSigner.Sign            {"KeyLabel", "Hash"}         -> {"Signature"}
+//	RemoteSigner.GenSharedSecret {"KeyLabel", "PublicKey"}    -> {"SharedSecret"}
+//
+// All binary fields are base64 encoded by JSON, public keys are in compressed form and
+// signatures are DER encoded.
+const remoteSignerService = "RemoteSigner"
+
+var (
+	// ErrUnknownKeyLabel indicates the key label is not found in remote signer.
+	ErrUnknownKeyLabel = errors.New("unknown key label")
+	// ErrInvalidRemoteSignature indicates the remote signer returns a signature not matching the public key.
+	ErrInvalidRemoteSignature = errors.New("invalid signature returned by remote signer")
+)
+
+// RemoteSignerRequest defines the request of remote signer methods.
+type RemoteSignerRequest struct {
+	KeyLabel  string
+	Hash      []byte `json:",omitempty"`
+	PublicKey []byte `json:",omitempty"`
+}
+
+// RemoteSignerResponse defines the response of remote signer methods.
+type RemoteSignerResponse struct {
+	PublicKey    []byte `json:",omitempty"`
+	Signature    []byte `json:",omitempty"`
+	SharedSecret []byte `json:",omitempty"`
+}
+
+// RemoteSigner is the Signer delegating signing to a key custody process over a Unix socket.
+type RemoteSigner struct {
+	socketPath string
+	keyLabel   string
+	pubKey     *asymmetric.PublicKey
+
+	clientLock sync.Mutex
+	client     *rpc.Client
+}
+
+// NewRemoteSigner connects to the remote signer listening on socketPath and fetches the public key of keyLabel.
+func NewRemoteSigner(socketPath string, keyLabel string) (s *RemoteSigner, err error) {
+	s = &RemoteSigner{
+		socketPath: socketPath,
+		keyLabel:   keyLabel,
+	}
+
+	var resp RemoteSignerResponse
+	if err = s.call("PublicKey", &RemoteSignerRequest{KeyLabel: keyLabel}, &resp); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.pubKey, err = asymmetric.ParsePubKey(resp.PublicKey); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return
+}
+
+// call invokes the remote method, the connection is re-established once if it's broken.
+func (s *RemoteSigner) call(method string, req *RemoteSignerRequest, resp *RemoteSignerResponse) (err error) {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+
+	for retry := 0; retry < 2; retry++ {
+		if s.client == nil {
+			var conn net.Conn
+			if conn, err = net.Dial("unix", s.socketPath); err != nil {
+				return
+			}
+			s.client = jsonrpc.NewClient(conn)
+		}
+
+		if err = s.client.Call(remoteSignerService+"."+method, req, resp); err == nil {
+			return
+		} else if _, ok := err.(rpc.ServerError); ok {
+			// error returned by remote signer, connection is still valid
+			return
+		}
+
+		log.Warningf("remote signer connection broken: %v", err)
+		s.client.Close()
+		s.client = nil
+	}
+
+	return
+}
+
+// PubKey implements Signer.PubKey.
+func (s *RemoteSigner) PubKey() *asymmetric.PublicKey {
+	return s.pubKey
+}
+
+// Sign implements Signer.Sign.
+func (s *RemoteSigner) Sign(hash []byte) (sig *asymmetric.Signature, err error) {
+	var resp RemoteSignerResponse
+	if err = s.call("Sign", &RemoteSignerRequest{KeyLabel: s.keyLabel, Hash: hash}, &resp); err != nil {
+		return
+	}
+	if sig, err = asymmetric.ParseSignature(resp.Signature); err != nil {
+		return
+	}
+	if !sig.Verify(hash, s.pubKey) {
+		return nil, ErrInvalidRemoteSignature
+	}
+	return
+}
+
+// GenSharedSecret implements KeyExchanger.GenSharedSecret.
+func (s *RemoteSigner) GenSharedSecret(remote *asymmetric.PublicKey) (secret []byte, err error) {
+	var resp RemoteSignerResponse
+	if err = s.call("GenSharedSecret", &RemoteSignerRequest{
+		KeyLabel:  s.keyLabel,
+		PublicKey: remote.Serialize(),
+	}, &resp); err != nil {
+		return
+	}
+	return resp.SharedSecret, nil
+}
+
+// Close closes the connection to remote signer.
+func (s *RemoteSigner) Close() {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// InitRemoteSigner connects to the remote signer and uses it as the local signer.
+func InitRemoteSigner(socketPath string, keyLabel string) (err error) {
+	var s *RemoteSigner
+	if s, err = NewRemoteSigner(socketPath, keyLabel); err != nil {
+		log.Errorf("connect to remote signer %s failed: %v", socketPath, err)
+		return
+	}
+	initLocalKeyStore()
+	log.Debugf("\n### Public Key ###\n%x\n### Public Key ###\n", s.PubKey().Serialize())
+	SetLocalSigner(s)
+	return
+}
+
+// RemoteSignerService serves the remote signer protocol with the signers, it's the reference
+// implementation of the key custody process.
+type RemoteSignerService struct {
+	signers map[string]Signer
+}
+
+// NewRemoteSignerService returns a new RemoteSignerService with signers indexed by key label.
+func NewRemoteSignerService(signers map[string]Signer) *RemoteSignerService {
+	return &RemoteSignerService{signers: signers}
+}
+
+func (s *RemoteSignerService) getSigner(label string) (signer Signer, err error) {
+	var ok bool
+	if signer, ok = s.signers[label]; !ok {
+		err = ErrUnknownKeyLabel
+	}
+	return
+}
+
+// PublicKey returns the public key of the key label.
+func (s *RemoteSignerService) PublicKey(req *RemoteSignerRequest, resp *RemoteSignerResponse) (err error) {
+	var signer Signer
+	if signer, err = s.getSigner(req.KeyLabel); err != nil {
+		return
+	}
+	resp.PublicKey = signer.PubKey().Serialize()
+	return
+}
+
+// Sign signs the hash with the key label.
+func (s *RemoteSignerService) Sign(req *RemoteSignerRequest, resp *RemoteSignerResponse) (err error) {
+	var signer Signer
+	if signer, err = s.getSigner(req.KeyLabel); err != nil {
+		return
+	}
+	var sig *asymmetric.Signature
+	if sig, err = signer.Sign(req.Hash); err != nil {
+		return
+	}
+	resp.Signature = sig.Serialize()
+	return
+}
+
+// GenSharedSecret generates the ECDH shared secret with the key label.
+func (s *RemoteSignerService) GenSharedSecret(req *RemoteSignerRequest, resp *RemoteSignerResponse) (err error) {
+	var signer Signer
+	if signer, err = s.getSigner(req.KeyLabel); err != nil {
+		return
+	}
+	exchanger, ok := signer.(KeyExchanger)
+	if !ok {
+		return ErrKeyExchangeNotSupported
+	}
+	var remote *asymmetric.PublicKey
+	if remote, err = asymmetric.ParsePubKey(req.PublicKey); err != nil {
+		return
+	}
+	resp.SharedSecret, err = exchanger.GenSharedSecret(remote)
+	return
+}
+
+// Serve accepts connections on the listener and serves the remote signer protocol,
+// it returns when the listener is closed.
+func (s *RemoteSignerService) Serve(listener net.Listener) (err error) {
+	server := rpc.NewServer()
+	if err = server.RegisterName(remoteSignerService, s); err != nil {
+		return
+	}
+
+	for {
+		var conn net.Conn
+		if conn, err = listener.Accept(); err != nil {
+			return
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
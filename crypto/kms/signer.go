@@ -0,0 +1,127 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+)
+
+var (
+	// ErrKeyExchangeNotSupported indicates the signer could not generate ECDH shared secret.
+	ErrKeyExchangeNotSupported = errors.New("key exchange not supported by signer")
+)
+
+// Signer signs hashes with a private key, the private key is not necessarily kept in process memory.
+type Signer interface {
+	// PubKey returns the public key of the signing key.
+	PubKey() *asymmetric.PublicKey
+	// Sign signs the hash.
+	Sign(hash []byte) (*asymmetric.Signature, error)
+}
+
+// KeyExchanger is implemented by signers which could generate ECDH shared secret with the signing key.
+type KeyExchanger interface {
+	// GenSharedSecret generates the ECDH shared secret with the remote public key.
+	GenSharedSecret(remote *asymmetric.PublicKey) ([]byte, error)
+}
+
+// LocalSigner is the Signer holding the private key in process memory.
+type LocalSigner struct {
+	key *asymmetric.PrivateKey
+}
+
+// NewLocalSigner returns a new LocalSigner with the private key.
+func NewLocalSigner(key *asymmetric.PrivateKey) *LocalSigner {
+	return &LocalSigner{key: key}
+}
+
+// LoadLocalSigner loads the private key file and returns a LocalSigner.
+func LoadLocalSigner(keyFilePath string, masterKey []byte) (s *LocalSigner, err error) {
+	var key *asymmetric.PrivateKey
+	if key, err = LoadPrivateKey(keyFilePath, masterKey); err != nil {
+		return
+	}
+	return NewLocalSigner(key), nil
+}
+
+// PubKey implements Signer.PubKey.
+func (s *LocalSigner) PubKey() *asymmetric.PublicKey {
+	return s.key.PubKey()
+}
+
+// Sign implements Signer.Sign.
+func (s *LocalSigner) Sign(hash []byte) (*asymmetric.Signature, error) {
+	return s.key.Sign(hash)
+}
+
+// GenSharedSecret implements KeyExchanger.GenSharedSecret.
+func (s *LocalSigner) GenSharedSecret(remote *asymmetric.PublicKey) ([]byte, error) {
+	return asymmetric.GenECDHSharedSecret(s.key, remote), nil
+}
+
+// TestSigner is a Signer test double, it records the signed hashes and fails with Err if set.
+type TestSigner struct {
+	sync.Mutex
+	Key    *asymmetric.PrivateKey
+	Err    error
+	hashes [][]byte
+}
+
+// NewTestSigner returns a TestSigner with a newly generated key.
+func NewTestSigner() (s *TestSigner, err error) {
+	var key *asymmetric.PrivateKey
+	if key, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+		return
+	}
+	return &TestSigner{Key: key}, nil
+}
+
+// PubKey implements Signer.PubKey.
+func (s *TestSigner) PubKey() *asymmetric.PublicKey {
+	return s.Key.PubKey()
+}
+
+// Sign implements Signer.Sign.
+func (s *TestSigner) Sign(hash []byte) (*asymmetric.Signature, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.hashes = append(s.hashes, append([]byte(nil), hash...))
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Key.Sign(hash)
+}
+
+// GenSharedSecret implements KeyExchanger.GenSharedSecret.
+func (s *TestSigner) GenSharedSecret(remote *asymmetric.PublicKey) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return asymmetric.GenECDHSharedSecret(s.Key, remote), nil
+}
+
+// SignedHashes returns the hashes signed by the signer.
+func (s *TestSigner) SignedHashes() [][]byte {
+	s.Lock()
+	defer s.Unlock()
+	return append([][]byte(nil), s.hashes...)
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocalSigner(t *testing.T) {
+	Convey("local signer", t, func() {
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var signer Signer = NewLocalSigner(priv)
+		So(signer.PubKey().IsEqual(pub), ShouldBeTrue)
+
+		h := hash.THashB([]byte("data"))
+		sig, err := signer.Sign(h)
+		So(err, ShouldBeNil)
+		So(sig.Verify(h, pub), ShouldBeTrue)
+
+		remotePriv, remotePub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		secret, err := signer.(KeyExchanger).GenSharedSecret(remotePub)
+		So(err, ShouldBeNil)
+		So(secret, ShouldResemble, asymmetric.GenECDHSharedSecret(remotePriv, pub))
+	})
+	Convey("test signer", t, func() {
+		signer, err := NewTestSigner()
+		So(err, ShouldBeNil)
+
+		h := hash.THashB([]byte("data"))
+		sig, err := signer.Sign(h)
+		So(err, ShouldBeNil)
+		So(sig.Verify(h, signer.PubKey()), ShouldBeTrue)
+
+		signer.Err = errors.New("signer failed")
+		_, err = signer.Sign(h)
+		So(err, ShouldEqual, signer.Err)
+		So(signer.SignedHashes(), ShouldResemble, [][]byte{h, h})
+	})
+}
+
+func TestRemoteSigner(t *testing.T) {
+	Convey("remote signer over unix socket", t, func() {
+		dir, err := ioutil.TempDir("", "remote_signer")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		socketPath := filepath.Join(dir, "signer.sock")
+		listener, err := net.Listen("unix", socketPath)
+		So(err, ShouldBeNil)
+		defer listener.Close()
+
+		local, err := NewTestSigner()
+		So(err, ShouldBeNil)
+		service := NewRemoteSignerService(map[string]Signer{"node": local})
+		go service.Serve(listener)
+
+		_, err = NewRemoteSigner(socketPath, "unknown")
+		So(err, ShouldNotBeNil)
+		_, err = NewRemoteSigner(filepath.Join(dir, "not_exist.sock"), "node")
+		So(err, ShouldNotBeNil)
+
+		signer, err := NewRemoteSigner(socketPath, "node")
+		So(err, ShouldBeNil)
+		defer signer.Close()
+		So(signer.PubKey().IsEqual(local.PubKey()), ShouldBeTrue)
+
+		h := hash.THashB([]byte("data"))
+		sig, err := signer.Sign(h)
+		So(err, ShouldBeNil)
+		So(sig.Verify(h, local.PubKey()), ShouldBeTrue)
+		So(local.SignedHashes(), ShouldResemble, [][]byte{h})
+
+		remotePriv, remotePub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		secret, err := signer.GenSharedSecret(remotePub)
+		So(err, ShouldBeNil)
+		So(secret, ShouldResemble, asymmetric.GenECDHSharedSecret(remotePriv, local.PubKey()))
+
+		// reconnect after connection broken
+		signer.client.Close()
+		_, err = signer.Sign(h)
+		So(err, ShouldBeNil)
+
+		// signer errors are returned
+		local.Err = errors.New("device removed")
+		_, err = signer.Sign(h)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "device removed")
+	})
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package symmetric
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Versioned cipher data layout, the whole header is authenticated as additional data of AES-256-GCM:
+//
+//	magic(4) | version(1) | kdf(1) | logN(1) | r(4) | p(4) | salt(16) | nonce(12) | ciphertext + tag(16)
+const (
+	// VersionScryptAESGCM is the version of scrypt derived AES-256-GCM encryption.
+	VersionScryptAESGCM = 1
+
+	versionedMagic  = "CQLK"
+	kdfScrypt       = 1
+	versionedKeyLen = 32
+	saltLen         = 16
+	nonceLen        = 12
+	headerLen       = len(versionedMagic) + 3 + 8 + saltLen + nonceLen
+
+	// scrypt parameters are read from untrusted cipher data, the limits bound the work of decryption,
+	// the memory required is 128 * r * N bytes.
+	maxKDFLogN   = 20
+	maxKDFR      = 32
+	maxKDFP      = 16
+	maxKDFMemory = 1 << 30
+)
+
+var (
+	// DefaultKDFParams is the scrypt parameters used for new cipher data, about 32MB memory is required.
+	DefaultKDFParams = KDFParams{LogN: 15, R: 8, P: 1}
+
+	// ErrUnsupportedVersion indicates the versioned cipher data is created by unknown version or kdf.
+	ErrUnsupportedVersion = errors.New("unsupported cipher data version")
+	// ErrDecrypt indicates the cipher data is tampered or the password is wrong.
+	ErrDecrypt = errors.New("decrypt cipher data failed")
+	// ErrKDFParams indicates the scrypt parameters are invalid or exceed the limits.
+	ErrKDFParams = errors.New("invalid key derivation parameters")
+)
+
+// KDFParams defines the scrypt cost parameters, N is 1 << LogN.
+type KDFParams struct {
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+// IsVersioned checks if data is encrypted by EncryptVersioned.
+func IsVersioned(in []byte) bool {
+	return len(in) >= len(versionedMagic) && string(in[:len(versionedMagic)]) == versionedMagic
+}
+
+// ParseKDFParams returns the version and scrypt parameters of versioned cipher data.
+func ParseKDFParams(in []byte) (version uint8, params KDFParams, err error) {
+	if !IsVersioned(in) || len(in) < headerLen {
+		err = ErrInputSize
+		return
+	}
+
+	h := in[len(versionedMagic):]
+	version = h[0]
+	if version != VersionScryptAESGCM || h[1] != kdfScrypt {
+		err = ErrUnsupportedVersion
+		return
+	}
+
+	params.LogN = h[2]
+	params.R = binary.BigEndian.Uint32(h[3:])
+	params.P = binary.BigEndian.Uint32(h[7:])
+	return
+}
+
+// validate checks the scrypt parameters against the limits.
+func (p KDFParams) validate() error {
+	if p.LogN < 1 || p.LogN > maxKDFLogN || p.R < 1 || p.R > maxKDFR || p.P < 1 || p.P > maxKDFP ||
+		128*uint64(p.R)<<p.LogN > maxKDFMemory {
+		return ErrKDFParams
+	}
+	return nil
+}
+
+// deriveAEAD derives the AES-256-GCM cipher from password with scrypt.
+func deriveAEAD(password, salt []byte, params KDFParams) (aead cipher.AEAD, err error) {
+	if err = params.validate(); err != nil {
+		return
+	}
+
+	var key []byte
+	if key, err = scrypt.Key(password, salt, 1<<params.LogN, int(params.R), int(params.P), versionedKeyLen); err != nil {
+		return
+	}
+
+	// key is 256 bits, there should not be any error
+	block, _ := aes.NewCipher(key)
+	return cipher.NewGCM(block)
+}
+
+// EncryptVersioned encrypts data with given password using scrypt derived AES-256-GCM key,
+// a random salt and nonce are generated for each encryption.
+func EncryptVersioned(in, password []byte, params KDFParams) (out []byte, err error) {
+	out = make([]byte, headerLen, headerLen+len(in)+16)
+	copy(out, versionedMagic)
+	h := out[len(versionedMagic):]
+	h[0] = VersionScryptAESGCM
+	h[1] = kdfScrypt
+	h[2] = params.LogN
+	binary.BigEndian.PutUint32(h[3:], params.R)
+	binary.BigEndian.PutUint32(h[7:], params.P)
+
+	salt := h[11 : 11+saltLen]
+	nonce := h[11+saltLen : 11+saltLen+nonceLen]
+	if _, err = io.ReadFull(rand.Reader, h[11:11+saltLen+nonceLen]); err != nil {
+		return nil, err
+	}
+
+	var aead cipher.AEAD
+	if aead, err = deriveAEAD(password, salt, params); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(out, nonce, in, out[:headerLen]), nil
+}
+
+// DecryptVersioned decrypts data encrypted by EncryptVersioned with given password.
+func DecryptVersioned(in, password []byte) (out []byte, err error) {
+	var params KDFParams
+	if _, params, err = ParseKDFParams(in); err != nil {
+		return
+	}
+
+	h := in[len(versionedMagic):]
+	salt := h[11 : 11+saltLen]
+	nonce := h[11+saltLen : 11+saltLen+nonceLen]
+
+	var aead cipher.AEAD
+	if aead, err = deriveAEAD(password, salt, params); err != nil {
+		return
+	}
+
+	if out, err = aead.Open(nil, nonce, in[headerLen:], in[:headerLen]); err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package symmetric
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fastKDFParams keeps tests fast.
+var fastKDFParams = KDFParams{LogN: 10, R: 8, P: 1}
+
+func TestKDFParams(t *testing.T) {
+	Convey("scrypt parameters should be limited", t, func() {
+		So(DefaultKDFParams.validate(), ShouldBeNil)
+		So(fastKDFParams.validate(), ShouldBeNil)
+		So(KDFParams{LogN: 0, R: 8, P: 1}.validate(), ShouldEqual, ErrKDFParams)
+		So(KDFParams{LogN: 21, R: 1, P: 1}.validate(), ShouldEqual, ErrKDFParams)
+		So(KDFParams{LogN: 10, R: 0, P: 1}.validate(), ShouldEqual, ErrKDFParams)
+		So(KDFParams{LogN: 10, R: 33, P: 1}.validate(), ShouldEqual, ErrKDFParams)
+		So(KDFParams{LogN: 10, R: 8, P: 17}.validate(), ShouldEqual, ErrKDFParams)
+		// 2GB memory
+		So(KDFParams{LogN: 20, R: 16, P: 1}.validate(), ShouldEqual, ErrKDFParams)
+
+		_, err := EncryptVersioned([]byte("secret"), []byte(password), KDFParams{LogN: 10, R: 8, P: 0})
+		So(err, ShouldEqual, ErrKDFParams)
+
+		// forged costly parameters are rejected before key derivation
+		enc, err := EncryptVersioned([]byte("secret"), []byte(password), fastKDFParams)
+		So(err, ShouldBeNil)
+		binary.BigEndian.PutUint32(enc[len(versionedMagic)+3:], 1<<30)
+		_, err = DecryptVersioned(enc, []byte(password))
+		So(err, ShouldEqual, ErrKDFParams)
+		enc[len(versionedMagic)+2] = 255
+		_, err = DecryptVersioned(enc, []byte(password))
+		So(err, ShouldEqual, ErrKDFParams)
+	})
+}
+
+func TestEncryptDecryptVersioned(t *testing.T) {
+	Convey("encrypt & decrypt with versioned format", t, func() {
+		enc, err := EncryptVersioned([]byte("secret"), []byte(password), fastKDFParams)
+		So(err, ShouldBeNil)
+		So(IsVersioned(enc), ShouldBeTrue)
+
+		version, params, err := ParseKDFParams(enc)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, VersionScryptAESGCM)
+		So(params, ShouldResemble, fastKDFParams)
+
+		dec, err := DecryptVersioned(enc, []byte(password))
+		So(err, ShouldBeNil)
+		So(string(dec), ShouldEqual, "secret")
+
+		// random salt and nonce
+		enc2, err := EncryptVersioned([]byte("secret"), []byte(password), fastKDFParams)
+		So(err, ShouldBeNil)
+		So(enc2, ShouldNotResemble, enc)
+
+		_, err = DecryptVersioned(enc, []byte("wrong password"))
+		So(err, ShouldEqual, ErrDecrypt)
+
+		// header is authenticated
+		enc[len(versionedMagic)+2]++
+		_, err = DecryptVersioned(enc, []byte(password))
+		So(err, ShouldEqual, ErrDecrypt)
+
+		enc[len(versionedMagic)]++
+		_, err = DecryptVersioned(enc, []byte(password))
+		So(err, ShouldEqual, ErrUnsupportedVersion)
+
+		_, err = DecryptVersioned(enc[:10], []byte(password))
+		So(err, ShouldEqual, ErrInputSize)
+
+		legacy, err := EncryptWithPassword([]byte("secret"), []byte(password))
+		So(err, ShouldBeNil)
+		So(IsVersioned(legacy), ShouldBeFalse)
+	})
+}
@@ -40,6 +40,7 @@ type TwoPCOptions struct {
 	NodeID         proto.NodeID
 	TransportID    string
 	Logger         *log.Logger
+	LogFetcher     kayak.LogFetcher
 }
 
 // NewTwoPCOptions creates empty twopc configuration options.
@@ -80,6 +81,12 @@ func (o *TwoPCOptions) WithLogger(l *log.Logger) *TwoPCOptions {
 	return o
 }
 
+// WithLogFetcher set committed log source for catching up to options.
+func (o *TwoPCOptions) WithLogFetcher(f kayak.LogFetcher) *TwoPCOptions {
+	o.LogFetcher = f
+	return o
+}
+
 // NewTwoPCKayak creates new kayak runtime.
 func NewTwoPCKayak(peers *kayak.Peers, config kayak.Config) (*kayak.Runtime, error) {
 	return kayak.NewRuntime(config, peers)
@@ -108,6 +115,7 @@ func NewTwoPCConfigWithOptions(rootDir string, service *kt.ETLSTransportService,
 			Runner:         runner,
 			Transport:      xpt,
 			ProcessTimeout: options.ProcessTimeout,
+			LogFetcher:     options.LogFetcher,
 		},
 		Storage: worker,
 	}
@@ -377,3 +377,111 @@ func TestExampleTwoPCCommit(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+// runtimeLogFetcher fetches committed logs from the leader runtime directly.
+type runtimeLogFetcher struct {
+	runtime *kayak.Runtime
+}
+
+func (f *runtimeLogFetcher) FetchLog(
+	ctx context.Context, peers *kayak.Peers, nodeID proto.NodeID, index uint64) (*kayak.Log, error) {
+	return f.runtime.GetCommittedLog(index)
+}
+
+func TestExampleTwoPCCatchUp(t *testing.T) {
+	Convey("catch up", t, func() {
+		var err error
+
+		err = initKMS()
+		So(err, ShouldBeNil)
+
+		lMock, err := testWithNewNode()
+		So(err, ShouldBeNil)
+		fMock, err := testWithNewNode()
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(lMock.rootDir)
+		defer os.RemoveAll(fMock.rootDir)
+
+		// leader commits logs alone
+		err = createRuntime(testPeersFixture(1, []*kayak.Server{
+			{Role: proto.Leader, ID: lMock.nodeID},
+		}), lMock)
+		So(err, ShouldBeNil)
+		err = lMock.runtime.Init()
+		So(err, ShouldBeNil)
+
+		payloads := [][]byte{[]byte("log 1"), []byte("log 2"), []byte("log 3"), []byte("log 4")}
+		callOrder := &CallCollector{}
+		for _, p := range payloads {
+			name := string(p)
+			lMock.worker.On("Prepare", mock.Anything, p).Return(nil)
+			lMock.worker.On("Commit", mock.Anything, p).Return(nil)
+			fMock.worker.On("Prepare", mock.Anything, p).Return(nil).Run(func(args mock.Arguments) {
+				callOrder.Append("prepare " + name)
+			})
+			fMock.worker.On("Commit", mock.Anything, p).Return(nil).Run(func(args mock.Arguments) {
+				callOrder.Append("commit " + name)
+			})
+		}
+
+		for _, p := range payloads[:2] {
+			_, err = lMock.runtime.Apply(p)
+			So(err, ShouldBeNil)
+		}
+		l, err := lMock.runtime.GetCommittedLog(3)
+		So(err, ShouldBeNil)
+		So(l, ShouldBeNil)
+
+		// the new follower catches up the committed logs on init
+		peers := testPeersFixture(2, []*kayak.Server{
+			{Role: proto.Leader, ID: lMock.nodeID},
+			{Role: proto.Follower, ID: fMock.nodeID},
+		})
+		fMock.config.(*kayak.TwoPCConfig).LogFetcher = &runtimeLogFetcher{runtime: lMock.runtime}
+		err = createRuntime(peers, fMock)
+		So(err, ShouldBeNil)
+		err = fMock.runtime.Init()
+		So(err, ShouldBeNil)
+		So(callOrder.Get(), ShouldResemble, []string{
+			"prepare log 1", "commit log 1",
+			"prepare log 2", "commit log 2",
+		})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			lMock.server.Serve()
+		}()
+		go func() {
+			defer wg.Done()
+			fMock.server.Serve()
+		}()
+		kms.SetLocalNodeIDNonce(lMock.nodeID.ToRawNodeID().CloneBytes(), &cpuminer.Uint256{})
+
+		// the log committed before leader updating peers is caught up on prepare
+		callOrder.Reset()
+		_, err = lMock.runtime.Apply(payloads[2])
+		So(err, ShouldBeNil)
+		err = lMock.runtime.UpdatePeers(peers)
+		So(err, ShouldBeNil)
+		offset, err := lMock.runtime.Apply(payloads[3])
+		So(err, ShouldBeNil)
+		So(offset, ShouldEqual, 4)
+		So(callOrder.Get(), ShouldResemble, []string{
+			"prepare log 3", "commit log 3",
+			"prepare log 4", "commit log 4",
+		})
+		data, err := fMock.runtime.GetLog(4)
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, payloads[3])
+
+		lMock.runtime.Shutdown()
+		fMock.runtime.Shutdown()
+		lMock.server.Listener.Close()
+		fMock.server.Listener.Close()
+		lMock.server.Stop()
+		fMock.server.Stop()
+		wg.Wait()
+	})
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// roleLeader labels the metrics observed by the coordinating runner.
+	roleLeader = "leader"
+	// roleFollower labels the metrics observed by the runners receiving logs from leader.
+	roleFollower = "follower"
+)
+
+var (
+	prepareDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "kayak",
+		Name:      "prepare_duration_seconds",
+		Help:      "Duration of two phase commit prepare phase, leader includes the remote prepares.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"role"})
+	commitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "kayak",
+		Name:      "commit_duration_seconds",
+		Help:      "Duration of two phase commit commit phase, leader includes the remote commits.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"role"})
+	rollbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "kayak",
+		Name:      "rollbacks_total",
+		Help:      "Count of rolled back logs.",
+	}, []string{"role"})
+)
+
+func init() {
+	prometheus.MustRegister(prepareDuration, commitDuration, rollbacks)
+}
+
+// observeSince records the seconds elapsed since start to histogram of role.
+func observeSince(h *prometheus.HistogramVec, role string, start time.Time) {
+	h.WithLabelValues(role).Observe(time.Since(start).Seconds())
+}
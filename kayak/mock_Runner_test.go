@@ -2,6 +2,7 @@
 
 package kayak
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 
 // MockRunner is an autogenerated mock type for the Runner type
@@ -30,6 +31,27 @@ func (_m *MockRunner) Apply(data []byte) (uint64, error) {
 	return r0, r1
 }
 
+// ApplyContext provides a mock function with given fields: ctx, data
+func (_m *MockRunner) ApplyContext(ctx context.Context, data []byte) (uint64, error) {
+	ret := _m.Called(ctx, data)
+
+	var r0 uint64
+	if rf, ok := ret.Get(0).(func(context.Context, []byte) uint64); ok {
+		r0 = rf(ctx, data)
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []byte) error); ok {
+		r1 = rf(ctx, data)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Init provides a mock function with given fields: config, peers, logs, stable, transport
 func (_m *MockRunner) Init(config Config, peers *Peers, logs LogStore, stable StableStore, transport Transport) error {
 	ret := _m.Called(config, peers, logs, stable, transport)
@@ -17,6 +17,7 @@
 package kayak
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -133,6 +134,21 @@ func (r *Runtime) Apply(data []byte) (offset uint64, err error) {
 	return
 }
 
+// ApplyContext is same as Apply but passes ctx to runner for tracing.
+func (r *Runtime) ApplyContext(ctx context.Context, data []byte) (offset uint64, err error) {
+	// validate if myself is leader
+	if !r.isLeader {
+		return 0, ErrNotLeader
+	}
+
+	offset, err = r.config.Runner.ApplyContext(ctx, data)
+	if err != nil {
+		return 0, err
+	}
+
+	return
+}
+
 // GetLog fetches runtime log produced by runner.
 func (r *Runtime) GetLog(offset uint64) (data []byte, err error) {
 	var l Log
@@ -145,6 +161,25 @@ func (r *Runtime) GetLog(offset uint64) (data []byte, err error) {
 	return
 }
 
+// GetCommittedLog fetches the committed runtime log, a nil log is returned if the log at offset is
+// not committed yet.
+func (r *Runtime) GetCommittedLog(offset uint64) (l *Log, err error) {
+	var committed uint64
+	if committed, err = r.logStore.GetUint64(keyCommittedIndex); err == ErrKeyNotFound {
+		err = nil
+	}
+	if err != nil || offset == 0 || offset > committed {
+		return
+	}
+
+	l = new(Log)
+	if err = r.logStore.GetLog(offset, l); err != nil {
+		l = nil
+	}
+
+	return
+}
+
 // UpdatePeers defines common peers update logic.
 func (r *Runtime) UpdatePeers(peers *Peers) error {
 	// Verify peers
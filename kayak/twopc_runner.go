@@ -24,6 +24,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/twopc"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
@@ -44,6 +45,11 @@ type TwoPCConfig struct {
 	Storage twopc.Worker
 }
 
+type logProcessRequest struct {
+	ctx  context.Context
+	data []byte
+}
+
 type logProcessResult struct {
 	offset uint64
 	err    error
@@ -74,7 +80,7 @@ type TwoPCRunner struct {
 
 	// Lock/events
 	processLock     sync.Mutex
-	processReq      chan []byte
+	processReq      chan *logProcessRequest
 	processRes      chan logProcessResult
 	updatePeersLock sync.Mutex
 	updatePeersReq  chan *Peers
@@ -98,7 +104,7 @@ type TwoPCWorkerWrapper struct {
 func NewTwoPCRunner() *TwoPCRunner {
 	return &TwoPCRunner{
 		shutdownCh:     make(chan struct{}),
-		processReq:     make(chan []byte),
+		processReq:     make(chan *logProcessRequest),
 		processRes:     make(chan logProcessResult),
 		updatePeersReq: make(chan *Peers),
 		updatePeersRes: make(chan error),
@@ -137,6 +143,14 @@ func (r *TwoPCRunner) Init(config Config, peers *Peers, logs LogStore, stable St
 		return err
 	}
 
+	// newly joined follower catches up the committed logs from leader before serving, the logs
+	// committed in the meantime are caught up on prepare
+	if r.config.LogFetcher != nil && r.lastLogIndex == 0 && r.role != proto.Leader && r.leader != nil {
+		if err := r.catchUp(context.Background(), r.leader.ID, 0); err != nil {
+			log.WithError(err).WithField("leader", r.leader.ID).Warning("catch up logs from leader failed")
+		}
+	}
+
 	r.goFunc(r.run)
 
 	return nil
@@ -249,6 +263,67 @@ func (r *TwoPCRunner) restoreUnderlying() error {
 	return nil
 }
 
+// catchUp fetches the committed logs following the local last log from node and applies them in
+// order, the logs until index to are required, or until the last committed log of node if to is 0.
+func (r *TwoPCRunner) catchUp(ctx context.Context, nodeID proto.NodeID, to uint64) (err error) {
+	for index := r.lastLogIndex + 1; to == 0 || index <= to; index++ {
+		var l *Log
+		if l, err = r.config.LogFetcher.FetchLog(ctx, r.peers, nodeID, index); err != nil {
+			return
+		}
+		if l == nil {
+			if to == 0 {
+				return nil
+			}
+			return ErrInvalidLog
+		}
+		if err = r.replayLog(ctx, l); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// replayLog verifies the fetched log against the local last log and applies it as committed.
+func (r *TwoPCRunner) replayLog(ctx context.Context, l *Log) (err error) {
+	if l.Index != r.lastLogIndex+1 || l.Term > r.currentTerm || !l.VerifyHash() {
+		return ErrInvalidLog
+	}
+	if r.lastLogHash == nil {
+		if l.LastHash != nil {
+			return ErrInvalidLog
+		}
+	} else if l.LastHash == nil || !l.LastHash.IsEqual(r.lastLogHash) {
+		return ErrInvalidLog
+	}
+
+	// the log is committed by peers already, apply it the same as commit failures are ignored
+	var storageErr error
+	if replayer, ok := r.config.Storage.(LogReplayer); ok {
+		storageErr = replayer.Replay(ctx, l.Data)
+	} else if storageErr = r.config.Storage.Prepare(ctx, l.Data); storageErr == nil {
+		storageErr = r.config.Storage.Commit(ctx, l.Data)
+	}
+	if storageErr != nil {
+		log.WithError(storageErr).WithField("index", l.Index).Debug("replay log on storage failed")
+	}
+
+	if err = r.logStore.StoreLog(l); err != nil {
+		return
+	}
+	if err = r.stableStore.SetUint64(keyCommittedIndex, l.Index); err != nil {
+		return
+	}
+
+	lastHash := l.Hash
+	r.lastLogHash = &lastHash
+	r.lastLogIndex = l.Index
+	r.lastLogTerm = l.Term
+
+	return
+}
+
 // UpdatePeers implements Runner.UpdatePeers.
 func (r *TwoPCRunner) UpdatePeers(peers *Peers) error {
 	r.updatePeersLock.Lock()
@@ -278,6 +353,11 @@ func (r *TwoPCRunner) UpdatePeers(peers *Peers) error {
 
 // Apply implements Runner.Apply.
 func (r *TwoPCRunner) Apply(data []byte) (uint64, error) {
+	return r.ApplyContext(context.Background(), data)
+}
+
+// ApplyContext implements Runner.ApplyContext.
+func (r *TwoPCRunner) ApplyContext(ctx context.Context, data []byte) (uint64, error) {
 	r.processLock.Lock()
 	defer r.processLock.Unlock()
 
@@ -286,7 +366,7 @@ func (r *TwoPCRunner) Apply(data []byte) (uint64, error) {
 		return 0, ErrNotLeader
 	}
 
-	r.processReq <- data
+	r.processReq <- &logProcessRequest{ctx: ctx, data: data}
 	res := <-r.processRes
 
 	return res.offset, res.err
@@ -315,8 +395,8 @@ func (r *TwoPCRunner) run() {
 		case <-r.shutdownCh:
 			// TODO(xq262144): cleanup logic
 			return
-		case data := <-r.processReq:
-			r.processRes <- r.processNewLog(data)
+		case req := <-r.processReq:
+			r.processRes <- r.processNewLog(req.ctx, req.data)
 		case request := <-r.transport.Process():
 			r.processRequest(request)
 			// TODO(xq262144): support timeout logic for auto rollback prepared transaction on leader change
@@ -334,7 +414,7 @@ func (r *TwoPCRunner) safeForPeersUpdate() chan *Peers {
 	return nil
 }
 
-func (r *TwoPCRunner) processNewLog(data []byte) (res logProcessResult) {
+func (r *TwoPCRunner) processNewLog(ctx context.Context, data []byte) (res logProcessResult) {
 	// build Log
 	l := &Log{
 		Index:    r.lastLogIndex + 1,
@@ -343,13 +423,30 @@ func (r *TwoPCRunner) processNewLog(data []byte) (res logProcessResult) {
 		LastHash: r.lastLogHash,
 	}
 
+	ctx, span := trace.StartSpan(ctx, "kayak.apply")
+	defer func() { span.End(res.err) }()
+	span.SetAttribute("kayak.index", l.Index)
+	span.SetAttribute("kayak.role", roleLeader)
+
 	// compute hash
 	l.ComputeHash()
 
-	localPrepare := func(ctx context.Context) error {
+	// prepare phase starts on log creation, commit phase starts after local prepare
+	phaseStart := time.Now()
+
+	localPrepare := func(ctx context.Context) (err error) {
+		_, span := trace.StartSpan(ctx, "kayak.localPrepare")
+		defer func() {
+			span.End(err)
+			if err == nil {
+				observeSince(prepareDuration, roleLeader, phaseStart)
+				phaseStart = time.Now()
+			}
+		}()
+
 		// prepare local prepare node
-		if err := r.config.Storage.Prepare(ctx, l.Data); err != nil {
-			return err
+		if err = r.config.Storage.Prepare(ctx, l.Data); err != nil {
+			return
 		}
 
 		// write log to storage
@@ -357,12 +454,20 @@ func (r *TwoPCRunner) processNewLog(data []byte) (res logProcessResult) {
 	}
 
 	localRollback := func(ctx context.Context) error {
+		_, span := trace.StartSpan(ctx, "kayak.localRollback")
+		defer span.End(nil)
+		rollbacks.WithLabelValues(roleLeader).Inc()
+
 		// prepare local rollback node
 		r.logStore.DeleteRange(r.lastLogIndex+1, l.Index)
 		return r.config.Storage.Rollback(ctx, l.Data)
 	}
 
 	localCommit := func(ctx context.Context) (err error) {
+		_, span := trace.StartSpan(ctx, "kayak.localCommit")
+		defer func() { span.End(err) }()
+		defer observeSince(commitDuration, roleLeader, phaseStart)
+
 		err = r.config.Storage.Commit(ctx, l.Data)
 
 		r.stableStore.SetUint64(keyCommittedIndex, l.Index)
@@ -392,12 +497,12 @@ func (r *TwoPCRunner) processNewLog(data []byte) (res logProcessResult) {
 			localCommit,   // after all remote nodes commit
 		))
 
-		res.err = c.Put(nodes, l)
+		res.err = c.PutContext(ctx, nodes, l)
 		res.offset = r.lastLogIndex
 	} else {
 		// single node short cut
 		// init context
-		ctx, cancel := context.WithTimeout(context.Background(), r.config.ProcessTimeout)
+		ctx, cancel := context.WithTimeout(ctx, r.config.ProcessTimeout)
 		defer cancel()
 
 		if err := localPrepare(ctx); err != nil {
@@ -485,6 +590,16 @@ func (r *TwoPCRunner) verifyLeader(req Request) error {
 	return nil
 }
 
+// startFollowerSpan starts a span as child of the leader span carried in request.
+func (r *TwoPCRunner) startFollowerSpan(req Request, name string) (ctx context.Context, span *trace.Span) {
+	ctx, span = trace.StartSpan(trace.ContextFromRequest(context.Background(), req), name)
+	span.SetAttribute("kayak.role", roleFollower)
+	if l := req.GetLog(); l != nil {
+		span.SetAttribute("kayak.index", l.Index)
+	}
+	return
+}
+
 func (r *TwoPCRunner) verifyLog(req Request) (log *Log, err error) {
 	log = req.GetLog()
 
@@ -502,7 +617,11 @@ func (r *TwoPCRunner) verifyLog(req Request) (log *Log, err error) {
 }
 
 func (r *TwoPCRunner) processPrepare(req Request) {
-	req.SendResponse(nil, func() (err error) {
+	defer observeSince(prepareDuration, roleFollower, time.Now())
+
+	ctx, span := r.startFollowerSpan(req, "kayak.prepare")
+
+	err := func() (err error) {
 		// already in transaction, try abort previous
 		if r.getState() != Idle {
 			// TODO(xq262144): has running transaction
@@ -511,7 +630,7 @@ func (r *TwoPCRunner) processPrepare(req Request) {
 
 		// init context
 		var cancelFunc context.CancelFunc
-		r.currentContext, cancelFunc = context.WithTimeout(context.Background(), r.config.ProcessTimeout)
+		r.currentContext, cancelFunc = context.WithTimeout(ctx, r.config.ProcessTimeout)
 		_ = cancelFunc
 
 		// get log
@@ -527,6 +646,14 @@ func (r *TwoPCRunner) processPrepare(req Request) {
 			return
 		}
 
+		// catch up the logs committed before joining peers
+		if lastIndex+1 < l.Index && lastIndex == r.lastLogIndex && r.config.LogFetcher != nil {
+			if err = r.catchUp(r.currentContext, req.GetPeerNodeID(), l.Index-1); err != nil {
+				return
+			}
+			lastIndex = r.lastLogIndex
+		}
+
 		// check prepare hash with last log hash
 		if l.LastHash != nil && lastIndex == 0 {
 			// invalid
@@ -558,12 +685,19 @@ func (r *TwoPCRunner) processPrepare(req Request) {
 		r.setState(Prepared)
 
 		return nil
-	}())
+	}()
+
+	span.End(err)
+	req.SendResponse(nil, err)
 }
 
 func (r *TwoPCRunner) processCommit(req Request) {
+	defer observeSince(commitDuration, roleFollower, time.Now())
+
+	_, span := r.startFollowerSpan(req, "kayak.commit")
+
 	// commit log
-	req.SendResponse(nil, func() (err error) {
+	err := func() (err error) {
 		// TODO(xq262144): check current running transaction index
 		if r.getState() != Prepared {
 			// not prepared, failed directly
@@ -609,7 +743,10 @@ func (r *TwoPCRunner) processCommit(req Request) {
 		r.setState(Idle)
 
 		return
-	}())
+	}()
+
+	span.End(err)
+	req.SendResponse(nil, err)
 }
 
 func (r *TwoPCRunner) processRollback(req Request) {
@@ -646,6 +783,8 @@ func (r *TwoPCRunner) processRollback(req Request) {
 			return
 		}
 
+		rollbacks.WithLabelValues(roleFollower).Inc()
+
 		// rollback on storage
 		if err = r.config.Storage.Rollback(r.currentContext, l.Data); err != nil {
 			return
@@ -26,6 +26,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -220,7 +221,7 @@ func (c *Peers) Serialize() []byte {
 }
 
 // Sign generates signature.
-func (c *Peers) Sign(signer *asymmetric.PrivateKey) error {
+func (c *Peers) Sign(signer kms.Signer) error {
 	h := hash.THashB(c.Serialize())
 	sig, err := signer.Sign(h)
 
@@ -281,6 +282,22 @@ type RuntimeConfig struct {
 
 	// AutoBanCount defines how many times a nodes will be banned from execution
 	AutoBanCount uint32
+
+	// LogFetcher defines the source of committed logs on catching up, catching up is disabled if nil
+	LogFetcher LogFetcher
+}
+
+// LogFetcher fetches committed logs from other peers for catching up the missing logs.
+type LogFetcher interface {
+	// FetchLog returns the committed log at index from the node, a nil log is returned if the
+	// log is not committed yet. The peers config of local node is presented for authorization.
+	FetchLog(ctx context.Context, peers *Peers, nodeID proto.NodeID, index uint64) (*Log, error)
+}
+
+// LogReplayer is an optional interface of the underlying storage to apply the committed logs
+// fetched on catching up, the logs are not necessarily fresh as the newly proposed ones.
+type LogReplayer interface {
+	Replay(ctx context.Context, data []byte) error
 }
 
 // Config interface for abstraction.
@@ -322,6 +339,9 @@ type Runner interface {
 	// and should be called by Leader role only.
 	Apply(data []byte) (uint64, error)
 
+	// ApplyContext is same as Apply, the log replication is traced as part of ctx.
+	ApplyContext(ctx context.Context, data []byte) (uint64, error)
+
 	// Shutdown defines destruct logic.
 	Shutdown(wait bool) error
 }
@@ -17,9 +17,14 @@
 package merkle
 
 import (
+	"errors"
+
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 )
 
+// ErrLeafNotFound indicates that the leaf index is out of the merkle tree leaves.
+var ErrLeafNotFound = errors.New("leaf not found in merkle tree")
+
 // Merkle is a merkle tree implementation (https://en.wikipedia.org/wiki/Merkle_tree)
 type Merkle struct {
 	tree []*hash.Hash
@@ -76,6 +81,55 @@ func (merkle *Merkle) GetRoot() *hash.Hash {
 	return merkle.tree[len(merkle.tree)-1]
 }
 
+// GetProof returns the sibling hashes along the path from the leaf at index to the root,
+// which can be checked against the root by VerifyProof.
+func (merkle *Merkle) GetProof(index uint64) (proof []hash.Hash, err error) {
+	width := (uint64(len(merkle.tree)) + 1) / 2
+	if index >= width || merkle.tree[index] == nil {
+		err = ErrLeafNotFound
+		return
+	}
+
+	for offset := uint64(0); width > 1; width /= 2 {
+		sibling := merkle.tree[offset+(index^1)]
+		if sibling == nil {
+			// only left node, it is merged with itself
+			sibling = merkle.tree[offset+index]
+		}
+		proof = append(proof, *sibling)
+		offset += width
+		index /= 2
+	}
+
+	return
+}
+
+// ProofRoot computes the merkle root from the leaf at index and its proof, ok is false if the
+// index is out of the tree width implied by the proof.
+func ProofRoot(leaf *hash.Hash, index uint64, proof []hash.Hash) (root *hash.Hash, ok bool) {
+	if len(proof) < 64 && index>>uint(len(proof)) != 0 {
+		return
+	}
+
+	root = leaf
+	for i := range proof {
+		if index&1 == 0 {
+			root = MergeTwoHash(root, &proof[i])
+		} else {
+			root = MergeTwoHash(&proof[i], root)
+		}
+		index >>= 1
+	}
+
+	return root, true
+}
+
+// VerifyProof checks if the leaf at index is included in the merkle tree of root.
+func VerifyProof(leaf *hash.Hash, index uint64, proof []hash.Hash, root *hash.Hash) bool {
+	h, ok := ProofRoot(leaf, index, proof)
+	return ok && h.IsEqual(root)
+}
+
 // MergeTwoHash computes the hash of the concatenate of two hash
 func MergeTwoHash(l *hash.Hash, r *hash.Hash) *hash.Hash {
 	result := hash.THashH(append(append([]byte{}, (*l)[:]...), (*r)[:]...))
@@ -43,6 +43,32 @@ func TestNewMerkle(t *testing.T) {
 	})
 }
 
+func TestMerkleProof(t *testing.T) {
+	Convey("Proof of each leaf should be verified against the root", t, func() {
+		for _, n := range []int{1, 2, 3, 5, 8} {
+			leaves := make([]*hash.Hash, n)
+			for i := range leaves {
+				leaves[i] = &hash.Hash{}
+				rand.Read(leaves[i][:])
+			}
+			merkle := NewMerkle(leaves)
+			root := merkle.GetRoot()
+			for i := range leaves {
+				proof, err := merkle.GetProof(uint64(i))
+				So(err, ShouldBeNil)
+				So(VerifyProof(leaves[i], uint64(i), proof, root), ShouldBeTrue)
+				So(VerifyProof(leaves[i], uint64(i)+1<<uint(len(proof)), proof, root), ShouldBeFalse)
+				if len(proof) > 0 {
+					proof[0][0] ^= 0xff
+					So(VerifyProof(leaves[i], uint64(i), proof, root), ShouldBeFalse)
+				}
+			}
+			_, err := merkle.GetProof(uint64(n))
+			So(err, ShouldEqual, ErrLeafNotFound)
+		}
+	})
+}
+
 func mergeHash(h0 *hash.Hash, h1 *hash.Hash) *hash.Hash {
 	h := hash.THashH(append(h0[:], h1[:]...))
 	return &h
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"math"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+const (
+	// DefaultMetricTimeout is the default max age of node metrics for the node to be alive.
+	DefaultMetricTimeout = 5 * time.Minute
+	// DefaultMaxLoadPerCPU is the default max 1 minute load average per cpu of a healthy node.
+	DefaultMaxLoadPerCPU = 4.0
+	// DefaultMinMemAvailable is the default min available memory bytes of a healthy node.
+	DefaultMinMemAvailable = float64(64 * MB)
+	// DefaultMaxNTPOffset is the default max clock offset in seconds of a healthy node.
+	DefaultMaxNTPOffset = 5.0
+	// DefaultMinHealthScore is the default min score of a healthy node.
+	DefaultMinHealthScore = 0.5
+)
+
+// HealthCriteria defines the thresholds to evaluate node health from the uploaded metrics,
+// the value checks with zero threshold are skipped.
+type HealthCriteria struct {
+	// MetricTimeout is the max age of last uploaded metrics, nodes not uploading within the
+	// timeout are considered dead.
+	MetricTimeout time.Duration
+	// MaxLoadPerCPU is the max 1 minute load average per cpu.
+	MaxLoadPerCPU float64
+	// MinMemAvailable is the min available memory in bytes.
+	MinMemAvailable float64
+	// MaxNTPOffset is the max absolute clock offset in seconds.
+	MaxNTPOffset float64
+	// MinScore is the min ratio of passed value checks for a live node to be healthy.
+	MinScore float64
+}
+
+// NodeHealth is the health evaluation result of a node.
+type NodeHealth struct {
+	NodeID     proto.NodeID
+	LastUpdate time.Time
+	// Alive indicates the node uploaded metrics within the metric timeout.
+	Alive bool
+	// Score is the ratio of passed value checks, 0 for dead nodes.
+	Score   float64
+	Healthy bool
+}
+
+// NewHealthCriteria returns the default health criteria with the metric timeout.
+func NewHealthCriteria(metricTimeout time.Duration) *HealthCriteria {
+	if metricTimeout <= 0 {
+		metricTimeout = DefaultMetricTimeout
+	}
+	return &HealthCriteria{
+		MetricTimeout:   metricTimeout,
+		MaxLoadPerCPU:   DefaultMaxLoadPerCPU,
+		MinMemAvailable: DefaultMinMemAvailable,
+		MaxNTPOffset:    DefaultMaxNTPOffset,
+		MinScore:        DefaultMinHealthScore,
+	}
+}
+
+// Evaluate returns the health of node with crucial metrics uploaded at lastUpdate.
+func (c *HealthCriteria) Evaluate(
+	nodeID proto.NodeID, crucial map[string]float64, lastUpdate time.Time, now time.Time) (h *NodeHealth) {
+	h = &NodeHealth{
+		NodeID:     nodeID,
+		LastUpdate: lastUpdate,
+		Alive:      now.Sub(lastUpdate) <= c.MetricTimeout,
+	}
+	if !h.Alive {
+		return
+	}
+
+	var checked, passed int
+	check := func(ok bool) {
+		checked++
+		if ok {
+			passed++
+		}
+	}
+
+	if load, ok := crucial["load1"]; ok && c.MaxLoadPerCPU > 0 {
+		cpus := crucial["cpu_count"]
+		if cpus < 1 {
+			cpus = 1
+		}
+		check(load/cpus <= c.MaxLoadPerCPU)
+	}
+	if mem, ok := crucial["mem_avail"]; ok && c.MinMemAvailable > 0 {
+		check(mem >= c.MinMemAvailable)
+	}
+	if offset, ok := crucial["ntp_offset"]; ok && c.MaxNTPOffset > 0 {
+		check(math.Abs(offset) <= c.MaxNTPOffset)
+	}
+
+	if checked == 0 {
+		h.Score = 1
+	} else {
+		h.Score = float64(passed) / float64(checked)
+	}
+	h.Healthy = h.Score >= c.MinScore
+
+	return
+}
+
+// EvaluateHealth returns the health of all nodes ever uploaded metrics, nodes without upload
+// records are unknown and not included.
+func (nmm *NodeMetricMap) EvaluateHealth(criteria *HealthCriteria, now time.Time) (ret map[proto.NodeID]*NodeHealth) {
+	ret = make(map[proto.NodeID]*NodeHealth)
+	nmm.updateTime.Range(func(key, value interface{}) bool {
+		nodeID, ok := key.(proto.NodeID)
+		if !ok {
+			return true // continue iteration
+		}
+		lastUpdate, ok := value.(time.Time)
+		if !ok {
+			return true // continue iteration
+		}
+
+		var crucial map[string]float64
+		if rawMetrics, ok := nmm.Load(nodeID); ok {
+			if mfm, ok := rawMetrics.(MetricMap); ok {
+				crucial = mfm.FilterCrucialMetrics()
+			}
+		}
+
+		ret[nodeID] = criteria.Evaluate(nodeID, crucial, lastUpdate, now)
+		return true
+	})
+
+	return
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealthCriteria_Evaluate(t *testing.T) {
+	Convey("Given the default health criteria", t, func() {
+		criteria := NewHealthCriteria(time.Minute)
+		now := time.Now()
+		healthy := map[string]float64{
+			"load1":      1,
+			"cpu_count":  4,
+			"mem_avail":  float64(GB),
+			"ntp_offset": 0.01,
+		}
+
+		Convey("The node with stale metrics should be dead", func() {
+			h := criteria.Evaluate("node", healthy, now.Add(-2*time.Minute), now)
+			So(h.Alive, ShouldBeFalse)
+			So(h.Healthy, ShouldBeFalse)
+			So(h.Score, ShouldEqual, 0)
+		})
+		Convey("The node with fresh good metrics should be healthy", func() {
+			h := criteria.Evaluate("node", healthy, now.Add(-time.Second), now)
+			So(h.Alive, ShouldBeTrue)
+			So(h.Healthy, ShouldBeTrue)
+			So(h.Score, ShouldEqual, 1)
+		})
+		Convey("The node should be scored by the passed checks", func() {
+			overloaded := map[string]float64{
+				"load1":      100,
+				"cpu_count":  4,
+				"mem_avail":  float64(GB),
+				"ntp_offset": 0.01,
+			}
+			h := criteria.Evaluate("node", overloaded, now, now)
+			So(h.Healthy, ShouldBeTrue)
+			So(h.Score, ShouldAlmostEqual, 2.0/3.0)
+
+			overloaded["ntp_offset"] = -60
+			h = criteria.Evaluate("node", overloaded, now, now)
+			So(h.Healthy, ShouldBeFalse)
+			So(h.Score, ShouldAlmostEqual, 1.0/3.0)
+		})
+		Convey("The live node without metric values should be healthy", func() {
+			h := criteria.Evaluate("node", nil, now, now)
+			So(h.Healthy, ShouldBeTrue)
+		})
+	})
+}
+
+func TestNodeMetricMap_EvaluateHealth(t *testing.T) {
+	Convey("Given a node metric map with uploaded metrics", t, func() {
+		nmm := &NodeMetricMap{}
+		nmm.StoreMetrics(proto.NodeID("node1"), MetricMap{})
+		nmm.Store(proto.NodeID("node2"), MetricMap{})
+
+		t1, ok := nmm.LastUpdateTime(proto.NodeID("node1"))
+		So(ok, ShouldBeTrue)
+		So(t1, ShouldHappenWithin, time.Second, time.Now())
+		_, ok = nmm.LastUpdateTime(proto.NodeID("node2"))
+		So(ok, ShouldBeFalse)
+
+		Convey("Only the nodes with upload records should be evaluated", func() {
+			criteria := &HealthCriteria{MetricTimeout: time.Minute}
+			health := nmm.EvaluateHealth(criteria, time.Now())
+			So(health, ShouldHaveLength, 1)
+			So(health[proto.NodeID("node1")].Healthy, ShouldBeTrue)
+
+			health = nmm.EvaluateHealth(criteria, time.Now().Add(2*time.Minute))
+			So(health[proto.NodeID("node1")].Healthy, ShouldBeFalse)
+		})
+	})
+}
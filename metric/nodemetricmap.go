@@ -18,6 +18,7 @@ package metric
 
 import (
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -37,6 +38,23 @@ type FilterFunc func(key proto.NodeID, value MetricMap) bool
 // NodeMetricMap is sync.Map version of map[proto.NodeID]MetricMap.
 type NodeMetricMap struct {
 	sync.Map // map[proto.NodeID]MetricMap
+
+	updateTime sync.Map // map[proto.NodeID]time.Time
+}
+
+// StoreMetrics saves the metrics uploaded by node and records the upload time.
+func (nmm *NodeMetricMap) StoreMetrics(nodeID proto.NodeID, metrics MetricMap) {
+	nmm.Store(nodeID, metrics)
+	nmm.updateTime.Store(nodeID, time.Now())
+}
+
+// LastUpdateTime returns the time of last metrics uploaded by node.
+func (nmm *NodeMetricMap) LastUpdateTime(nodeID proto.NodeID) (t time.Time, ok bool) {
+	var v interface{}
+	if v, ok = nmm.updateTime.Load(nodeID); ok {
+		t, ok = v.(time.Time)
+	}
+	return
 }
 
 // FilterNode return node id slice make filterFunc return true.
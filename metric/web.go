@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// MetricsPath is the http path of the prometheus exposition endpoint.
+const MetricsPath = "/metrics"
+
+// NewMetricHandler returns a http handler exposing the application metrics registered in
+// prometheus default registry, along with the host metrics collected by registry if not nil.
+func NewMetricHandler(registry *prometheus.Registry) http.Handler {
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer}
+	if registry != nil {
+		gatherers = append(gatherers, registry)
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mfs, err := gatherers.Gather()
+		if err != nil {
+			// partial result is still useful, gathering errors are reported by log
+			log.Warnf("gather metrics failed: %s", err)
+		}
+
+		contentType := expfmt.Negotiate(r.Header)
+		buf := new(bytes.Buffer)
+		enc := expfmt.NewEncoder(buf, contentType)
+		for _, mf := range mfs {
+			if err = enc.Encode(mf); err != nil {
+				http.Error(rw, "encode metrics failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		rw.Header().Set("Content-Type", string(contentType))
+		rw.Write(buf.Bytes())
+	})
+}
+
+// StartMetricWeb serves the prometheus exposition endpoint on addr, the host metrics collectors
+// are started in a separate registry.
+func StartMetricWeb(addr string) (server *http.Server, err error) {
+	var listener net.Listener
+	if listener, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, NewMetricHandler(StartMetricCollector()))
+	server = &http.Server{
+		Addr:    listener.Addr().String(),
+		Handler: mux,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("serve metric web failed: %s", err)
+		}
+	}()
+
+	log.Infof("metric web started on %s%s", server.Addr, MetricsPath)
+
+	return
+}
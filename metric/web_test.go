@@ -0,0 +1,87 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricWeb(t *testing.T) {
+	Convey("Given an application counter registered in default registry", t, func() {
+		counter := prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "covenantsql",
+			Subsystem: "test",
+			Name:      "web_requests_total",
+			Help:      "Test counter of metric web.",
+		})
+		So(prometheus.Register(counter), ShouldBeNil)
+		Reset(func() { prometheus.Unregister(counter) })
+		counter.Inc()
+
+		Convey("The handler should expose the application and host metrics", func() {
+			reg := prometheus.NewRegistry()
+			gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "test_web_gauge",
+				Help:      "Test gauge of metric web.",
+			})
+			reg.MustRegister(gauge)
+			gauge.Set(2)
+
+			rec := httptest.NewRecorder()
+			NewMetricHandler(reg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, MetricsPath, nil))
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+			body := rec.Body.String()
+			So(body, ShouldContainSubstring, "covenantsql_test_web_requests_total 1")
+			So(body, ShouldContainSubstring, "CovenantSQL_build_info")
+			So(body, ShouldContainSubstring, "node_test_web_gauge 2")
+		})
+
+		Convey("The metric web should serve on the metrics path", func() {
+			server, err := StartMetricWeb("127.0.0.1:0")
+			So(err, ShouldBeNil)
+			Reset(func() { server.Shutdown(context.Background()) })
+
+			body, err := metricBody("http://" + server.Addr + MetricsPath)
+			So(err, ShouldBeNil)
+			So(body, ShouldContainSubstring, "covenantsql_test_web_requests_total 1")
+
+			_, err = StartMetricWeb(":-1")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// metricBody fetches the exposition text from url.
+func metricBody(url string) (body string, err error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(b)), err
+}
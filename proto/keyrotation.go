@@ -0,0 +1,115 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+)
+
+// KeyRotation is a record which moves a node identity from OldPublicKey to NewPublicKey.
+// The record is signed by the old key, so only the current key holder can rotate the key.
+// NewNonce is mined against NewPublicKey, the NodeID itself is kept unchanged.
+type KeyRotation struct {
+	NodeID       NodeID
+	Sequence     uint64
+	OldPublicKey *asymmetric.PublicKey
+	OldNonce     mine.Uint256
+	NewPublicKey *asymmetric.PublicKey
+	NewNonce     mine.Uint256
+	Timestamp    time.Time
+	Signature    *asymmetric.Signature
+}
+
+// Serialize key rotation record except signature to bytes.
+func (r *KeyRotation) Serialize() []byte {
+	if r == nil {
+		return []byte{'\000'}
+	}
+
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.LittleEndian, uint64(len(r.NodeID)))
+	buffer.WriteString(string(r.NodeID))
+	binary.Write(buffer, binary.LittleEndian, r.Sequence)
+	if r.OldPublicKey != nil {
+		buffer.Write(r.OldPublicKey.Serialize())
+	} else {
+		buffer.WriteRune('\000')
+	}
+	buffer.Write(r.OldNonce.Bytes())
+	if r.NewPublicKey != nil {
+		buffer.Write(r.NewPublicKey.Serialize())
+	} else {
+		buffer.WriteRune('\000')
+	}
+	buffer.Write(r.NewNonce.Bytes())
+	binary.Write(buffer, binary.LittleEndian, r.Timestamp.UnixNano())
+
+	return buffer.Bytes()
+}
+
+// Hash returns the hash of the serialized record.
+func (r *KeyRotation) Hash() []byte {
+	return hash.THashB(r.Serialize())
+}
+
+// Verify checks the record is signed by the old public key.
+func (r *KeyRotation) Verify() bool {
+	if r == nil || r.OldPublicKey == nil || r.NewPublicKey == nil || r.Signature == nil {
+		return false
+	}
+	return r.Signature.Verify(r.Hash(), r.OldPublicKey)
+}
+
+// NewKeyDifficulty returns the difficulty of the new public key and nonce pair.
+func (r *KeyRotation) NewKeyDifficulty() int {
+	if r == nil || r.NewPublicKey == nil {
+		return -1
+	}
+	keyHash := mine.HashBlock(r.NewPublicKey.Serialize(), r.NewNonce)
+	return keyHash.Difficulty()
+}
+
+// RotateKeyReq is RotateKey RPC request
+type RotateKeyReq struct {
+	Rotation KeyRotation
+	Envelope
+}
+
+// RotateKeyResp is RotateKey RPC response
+type RotateKeyResp struct {
+	Msg string
+	Envelope
+}
+
+// GetKeyRotationReq is GetKeyRotation RPC request, returns records with Sequence > After
+type GetKeyRotationReq struct {
+	NodeID NodeID
+	After  uint64
+	Envelope
+}
+
+// GetKeyRotationResp is GetKeyRotation RPC response
+type GetKeyRotationResp struct {
+	Rotations []*KeyRotation
+	Envelope
+}
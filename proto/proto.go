@@ -30,11 +30,13 @@ type EnvelopeAPI interface {
 	GetTTL() time.Duration
 	GetExpire() time.Duration
 	GetNodeID() *RawNodeID
+	GetTraceContext() TraceContext
 
 	SetVersion(string)
 	SetTTL(time.Duration)
 	SetExpire(time.Duration)
 	SetNodeID(*RawNodeID)
+	SetTraceContext(TraceContext)
 }
 
 // Envelope is the protocol header
@@ -43,6 +45,9 @@ type Envelope struct {
 	TTL     time.Duration
 	Expire  time.Duration
 	NodeID  *RawNodeID
+
+	// TraceContext is excluded from hash, it is allowed to be changed by each hop
+	TraceContext TraceContext `hspack:"-"`
 }
 
 // PingReq is Ping RPC request
@@ -140,5 +145,15 @@ func (e *Envelope) SetNodeID(nodeID *RawNodeID) {
 	e.NodeID = nodeID
 }
 
+// GetTraceContext implements EnvelopeAPI.GetTraceContext
+func (e *Envelope) GetTraceContext() TraceContext {
+	return e.TraceContext
+}
+
+// SetTraceContext implements EnvelopeAPI.SetTraceContext
+func (e *Envelope) SetTraceContext(tc TraceContext) {
+	e.TraceContext = tc
+}
+
 // DatabaseID is database name, will be generated from UUID
 type DatabaseID string
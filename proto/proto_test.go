@@ -41,5 +41,12 @@ func TestEnvelope_GetSet(t *testing.T) {
 
 		env.SetVersion("0.0.1")
 		So(env.GetVersion(), ShouldEqual, "0.0.1")
+
+		tc := env.GetTraceContext()
+		So(tc.IsValid(), ShouldBeFalse)
+		tc = TraceContext{TraceID: [16]byte{0x1}, SpanID: [8]byte{0x1}, Sampled: true}
+		env.SetTraceContext(tc)
+		So(env.GetTraceContext(), ShouldResemble, tc)
+		So(tc.IsValid(), ShouldBeTrue)
 	})
 }
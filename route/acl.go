@@ -44,6 +44,9 @@ ACLs:
 	Miner -> Miner, Kayak.Call():
 		ACL: Open to Miner Leader.
 
+	Miner -> Miner, DBS.FetchLog():
+		ACL: Open to database peers, including the ones of newer peers config.
+
    	BP -> BP, Exchange NodeInfo, Kayak.Call():
   		ACL: Open to BP
 
@@ -55,6 +58,9 @@ ACLs:
 
    	* -> BP, DHT.FindNode(), DHT.FindNeighbor():
   		ACL: Open to world
+
+   	* -> BP, DHT.RotateKey(), DHT.GetKeyRotation():
+  		ACL: Open to world, rotation record is signed by the old node key
 */
 
 // RemoteFunc defines the RPC Call name
@@ -67,6 +73,10 @@ const (
 	DHTFindNeighbor
 	// DHTFindNode gets node info
 	DHTFindNode
+	// DHTRotateKey submits node key rotation record to BP
+	DHTRotateKey
+	// DHTGetKeyRotation gets node key rotation records
+	DHTGetKeyRotation
 	// MetricUploadMetrics uploads node metrics
 	MetricUploadMetrics
 	// KayakCall is used by BP for data consistency
@@ -79,6 +89,8 @@ const (
 	DBSDeploy
 	// DBSGetRequest is used by observer to view original request
 	DBSGetRequest
+	// DBSFetchLog is used by miner to catch up committed logs from other peers
+	DBSFetchLog
 	// DBCCall is used by Miner for data consistency
 	DBCCall
 	// BPDBCreateDatabase is used by client to create database
@@ -89,6 +101,8 @@ const (
 	BPDBGetDatabase
 	// BPDBGetNodeDatabases is used by miner to node residential databases
 	BPDBGetNodeDatabases
+	// BPDBUpdateDatabasePolicy is used by client to update database sql policy
+	BPDBUpdateDatabasePolicy
 	// SQLCAdviseNewBlock is used by sqlchain to advise new block between adjacent node
 	SQLCAdviseNewBlock
 	// SQLCAdviseBinLog is usd by sqlchain to advise binlog between adjacent node
@@ -157,6 +171,10 @@ func (s RemoteFunc) String() string {
 		return "DHT.FindNeighbor"
 	case DHTFindNode:
 		return "DHT.FindNode"
+	case DHTRotateKey:
+		return "DHT.RotateKey"
+	case DHTGetKeyRotation:
+		return "DHT.GetKeyRotation"
 	case MetricUploadMetrics:
 		return "Metric.UploadMetrics"
 	case KayakCall:
@@ -169,6 +187,8 @@ func (s RemoteFunc) String() string {
 		return "DBS.Deploy"
 	case DBSGetRequest:
 		return "DBS.GetRequest"
+	case DBSFetchLog:
+		return "DBS.FetchLog"
 	case DBCCall:
 		return "DBC.Call"
 	case BPDBCreateDatabase:
@@ -179,6 +199,8 @@ func (s RemoteFunc) String() string {
 		return "BPDB.GetDatabase"
 	case BPDBGetNodeDatabases:
 		return "BPDB.GetNodeDatabases"
+	case BPDBUpdateDatabasePolicy:
+		return "BPDB.UpdateDatabasePolicy"
 	case SQLCAdviseNewBlock:
 		return "SQLC.AdviseNewBlock"
 	case SQLCAdviseBinLog:
@@ -246,7 +268,7 @@ func IsPermitted(callerEnvelope *proto.Envelope, funcName RemoteFunc) (ok bool)
 		// non BP
 		switch funcName {
 		// DHT related
-		case DHTPing, DHTFindNode, DHTFindNeighbor, MetricUploadMetrics:
+		case DHTPing, DHTFindNode, DHTFindNeighbor, DHTRotateKey, DHTGetKeyRotation, MetricUploadMetrics:
 			return true
 			// Kayak related
 		case KayakCall:
@@ -26,9 +26,17 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
+// KeyRotationPersistence is implemented by the DHT persistence which replicates the accepted
+// key rotation records to all block producers, the records are applied on commit.
+type KeyRotationPersistence interface {
+	SetKeyRotation(r *proto.KeyRotation) (err error)
+}
+
 // DHTService is server side RPC implementation
 type DHTService struct {
 	Consistent *consistent.Consistent
+	// Rotations replicates key rotation records, the records are applied locally if nil
+	Rotations KeyRotationPersistence
 }
 
 // NewDHTServiceWithRing will return a new DHTService and set an existing hash ring
@@ -46,7 +54,10 @@ func NewDHTService(DHTStorePath string, persistImpl consistent.Persistence, init
 		log.Errorf("init DHT service failed: %s", err)
 		return
 	}
-	return NewDHTServiceWithRing(c)
+	if s, err = NewDHTServiceWithRing(c); err == nil {
+		s.Rotations, _ = persistImpl.(KeyRotationPersistence)
+	}
+	return
 }
 
 // FindNode RPC returns node with requested node id from DHT
@@ -94,8 +105,8 @@ func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error
 		return
 	}
 
-	// Checking if ID Nonce Pubkey matched
-	if !kms.IsIDPubNonceValid(req.Node.ID.ToRawNodeID(), &req.Node.Nonce, req.Node.PublicKey) {
+	// Checking if ID Nonce Pubkey matched, rotated keys are also accepted
+	if !kms.IsNodeKeyValid(req.Node.ID.ToRawNodeID(), &req.Node.Nonce, req.Node.PublicKey) {
 		err = fmt.Errorf("node: %s nonce public key not match", req.Node.ID)
 		log.Error(err)
 		return
@@ -108,6 +119,12 @@ func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error
 		return
 	}
 
+	// Old key is accepted in grace period, but DHT always keeps the rotated key
+	if last, _ := kms.GetLastKeyRotation(req.Node.ID); last != nil {
+		req.Node.PublicKey = last.NewPublicKey
+		req.Node.Nonce = last.NewNonce
+	}
+
 	err = DHT.Consistent.Add(req.Node)
 	if err != nil {
 		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", req.Node, err)
@@ -116,3 +133,74 @@ func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error
 	}
 	return
 }
+
+// RotateKey RPC accepts a key rotation record, updates the node key in DHT
+func (DHT *DHTService) RotateKey(req *proto.RotateKeyReq, resp *proto.RotateKeyResp) (err error) {
+	if !IsPermitted(&req.Envelope, DHTRotateKey) {
+		err = fmt.Errorf("calling RotateKey from node %s is not permitted", req.GetNodeID())
+		log.Error(err)
+		return
+	}
+
+	r := &req.Rotation
+	if err = kms.CheckKeyRotation(r); err != nil {
+		err = fmt.Errorf("accept key rotation of node %s failed: %s", r.NodeID, err)
+		log.Error(err)
+		return
+	}
+
+	if DHT.Rotations != nil {
+		// applied by all block producers on commit
+		if err = DHT.Rotations.SetKeyRotation(r); err != nil {
+			err = fmt.Errorf("replicate key rotation of node %s failed: %s", r.NodeID, err)
+			log.Error(err)
+			return
+		}
+		resp.Msg = "Rotated"
+		return
+	}
+
+	if err = kms.ApplyKeyRotation(r); err != nil {
+		err = fmt.Errorf("apply key rotation of node %s failed: %s", r.NodeID, err)
+		log.Error(err)
+		return
+	}
+
+	if err = DHT.applyKeyRotation(r); err == nil {
+		resp.Msg = "Rotated"
+	}
+	return
+}
+
+// applyKeyRotation updates the rotated node key in DHT.
+func (DHT *DHTService) applyKeyRotation(r *proto.KeyRotation) (err error) {
+	node, err := DHT.Consistent.GetNode(string(r.NodeID))
+	if err != nil {
+		// node not in DHT yet, it will be added on next ping
+		return nil
+	}
+	rotated := *node
+	rotated.PublicKey = r.NewPublicKey
+	rotated.Nonce = r.NewNonce
+	if err = DHT.Consistent.Add(rotated); err != nil {
+		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", rotated, err)
+		log.Error(err)
+	}
+	return
+}
+
+// GetKeyRotation RPC returns key rotation records of node
+func (DHT *DHTService) GetKeyRotation(req *proto.GetKeyRotationReq, resp *proto.GetKeyRotationResp) (err error) {
+	if !IsPermitted(&req.Envelope, DHTGetKeyRotation) {
+		err = fmt.Errorf("calling from node %s is not permitted", req.GetNodeID())
+		log.Error(err)
+		return
+	}
+
+	resp.Rotations, err = kms.GetKeyRotations(req.NodeID, req.After)
+	if err != nil {
+		err = fmt.Errorf("get key rotations of node %s failed: %s", req.NodeID, err)
+		log.Error(err)
+	}
+	return
+}
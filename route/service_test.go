@@ -27,7 +27,9 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	. "github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -267,3 +269,130 @@ func TestDHTService_Ping(t *testing.T) {
 	log.Debugf("respA2: %v", respA2)
 	rc.Close()
 }
+
+func TestDHTService_RotateKey(t *testing.T) {
+	os.Remove(DHTStorePath)
+	defer os.Remove(DHTStorePath)
+	log.SetLevel(log.DebugLevel)
+	addr := "127.0.0.1:0"
+
+	dht, _ := NewDHTService(DHTStorePath, new(consistent.KMSStorage), false)
+	server := rpc.NewServer()
+	server.RegisterName(DHTRPCName, dht)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				continue
+			}
+			go server.ServeCodec(utils.GetMsgPackServerCodec(c))
+		}
+	}()
+
+	Convey("rotate node key", t, func() {
+		conf.GConf.MinNodeIDDifficulty = 0
+		privKey0, pubKey0, _ := asymmetric.GenSecp256k1KeyPair()
+		_, pubKey1, _ := asymmetric.GenSecp256k1KeyPair()
+		nonce0 := mine.Uint256{}
+		nonce1 := mine.Uint256{A: 1}
+		idHash := mine.HashBlock(pubKey0.Serialize(), nonce0)
+		node := Node{
+			ID:        NodeID(idHash.String()),
+			Addr:      "127.0.0.1:1234",
+			PublicKey: pubKey0,
+			Nonce:     nonce0,
+		}
+
+		client, err := net.Dial("tcp", ln.Addr().String())
+		So(err, ShouldBeNil)
+		rc := rpc.NewClientWithCodec(utils.GetMsgPackClientCodec(client))
+		defer rc.Close()
+
+		err = rc.Call("DHT.Ping", &PingReq{Node: node}, new(PingResp))
+		So(err, ShouldBeNil)
+
+		r, err := kms.NewKeyRotation(node.ID, 1, nonce0, pubKey1, nonce1, kms.NewLocalSigner(privKey0))
+		So(err, ShouldBeNil)
+		respRK := new(RotateKeyResp)
+		err = rc.Call("DHT.RotateKey", &RotateKeyReq{Rotation: *r}, respRK)
+		So(err, ShouldBeNil)
+		So(respRK.Msg, ShouldEqual, "Rotated")
+
+		// replay is rejected
+		err = rc.Call("DHT.RotateKey", &RotateKeyReq{Rotation: *r}, new(RotateKeyResp))
+		So(err, ShouldNotBeNil)
+
+		respFN := new(FindNodeResp)
+		err = rc.Call("DHT.FindNode", &FindNodeReq{NodeID: node.ID}, respFN)
+		So(err, ShouldBeNil)
+		So(respFN.Node.Addr, ShouldEqual, node.Addr)
+		So(respFN.Node.PublicKey.IsEqual(pubKey1), ShouldBeTrue)
+		So(respFN.Node.Nonce, ShouldResemble, nonce1)
+
+		// ping with the old key in grace period keeps the rotated key
+		err = rc.Call("DHT.Ping", &PingReq{Node: node}, new(PingResp))
+		So(err, ShouldBeNil)
+		respFN = new(FindNodeResp)
+		err = rc.Call("DHT.FindNode", &FindNodeReq{NodeID: node.ID}, respFN)
+		So(err, ShouldBeNil)
+		So(respFN.Node.PublicKey.IsEqual(pubKey1), ShouldBeTrue)
+
+		respGR := new(GetKeyRotationResp)
+		err = rc.Call("DHT.GetKeyRotation", &GetKeyRotationReq{NodeID: node.ID}, respGR)
+		So(err, ShouldBeNil)
+		So(respGR.Rotations, ShouldHaveLength, 1)
+		So(respGR.Rotations[0].Verify(), ShouldBeTrue)
+	})
+}
+
+type stubRotationPersistence struct {
+	rotations []*KeyRotation
+}
+
+func (p *stubRotationPersistence) SetKeyRotation(r *KeyRotation) error {
+	p.rotations = append(p.rotations, r)
+	return nil
+}
+
+func TestDHTService_RotateKeyReplicated(t *testing.T) {
+	Convey("key rotation should be replicated instead of applied locally", t, func() {
+		os.Remove(DHTStorePath)
+		defer os.Remove(DHTStorePath)
+
+		dht, err := NewDHTService(DHTStorePath, new(consistent.KMSStorage), false)
+		So(err, ShouldBeNil)
+		persistence := &stubRotationPersistence{}
+		dht.Rotations = persistence
+
+		conf.GConf.MinNodeIDDifficulty = 0
+		privKey0, pubKey0, _ := asymmetric.GenSecp256k1KeyPair()
+		_, pubKey1, _ := asymmetric.GenSecp256k1KeyPair()
+		nonce0 := mine.Uint256{}
+		idHash := mine.HashBlock(pubKey0.Serialize(), nonce0)
+		nodeID := NodeID(idHash.String())
+
+		r, err := kms.NewKeyRotation(nodeID, 1, nonce0, pubKey1, mine.Uint256{A: 1}, kms.NewLocalSigner(privKey0))
+		So(err, ShouldBeNil)
+		resp := new(RotateKeyResp)
+		err = dht.RotateKey(&RotateKeyReq{Rotation: *r}, resp)
+		So(err, ShouldBeNil)
+		So(resp.Msg, ShouldEqual, "Rotated")
+		So(persistence.rotations, ShouldHaveLength, 1)
+
+		last, err := kms.GetLastKeyRotation(nodeID)
+		So(err, ShouldBeNil)
+		So(last, ShouldBeNil)
+
+		// invalid records are not replicated
+		r.Sequence = 2
+		err = dht.RotateKey(&RotateKeyReq{Rotation: *r}, new(RotateKeyResp))
+		So(err, ShouldNotBeNil)
+		So(persistence.rotations, ShouldHaveLength, 1)
+	})
+}
@@ -49,6 +49,7 @@ func init() {
 	YamuxConfig = yamux.DefaultConfig()
 	YamuxConfig.LogOutput = ioutil.Discard
 	DefaultDialer = dialToNode
+	kms.SetKeyRotationFetcher(FetchKeyRotations)
 }
 
 // dial connects to a address with a Cipher
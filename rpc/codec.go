@@ -18,6 +18,8 @@ package rpc
 
 import (
 	"net/rpc"
+	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
@@ -26,6 +28,10 @@ import (
 type NodeAwareServerCodec struct {
 	rpc.ServerCodec
 	NodeID *proto.RawNodeID
+
+	// start time of the requests in process, keyed by request sequence
+	startLock sync.Mutex
+	starts    map[uint64]time.Time
 }
 
 // NewNodeAwareServerCodec returns new NodeAwareServerCodec with normal rpc.ServerCode and proto.RawNodeID
@@ -33,9 +39,37 @@ func NewNodeAwareServerCodec(codec rpc.ServerCodec, nodeID *proto.RawNodeID) *No
 	return &NodeAwareServerCodec{
 		ServerCodec: codec,
 		NodeID:      nodeID,
+		starts:      make(map[uint64]time.Time),
 	}
 }
 
+// ReadRequestHeader override default rpc.ServerCodec behaviour and record request start time
+func (nc *NodeAwareServerCodec) ReadRequestHeader(r *rpc.Request) (err error) {
+	if err = nc.ServerCodec.ReadRequestHeader(r); err != nil {
+		return
+	}
+
+	nc.startLock.Lock()
+	defer nc.startLock.Unlock()
+	nc.starts[r.Seq] = time.Now()
+
+	return
+}
+
+// WriteResponse override default rpc.ServerCodec behaviour and record served call metrics
+func (nc *NodeAwareServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	nc.startLock.Lock()
+	start, ok := nc.starts[r.Seq]
+	delete(nc.starts, r.Seq)
+	nc.startLock.Unlock()
+
+	if ok {
+		observeServerCall(r.ServiceMethod, start, r.Error != "")
+	}
+
+	return nc.ServerCodec.WriteResponse(r, body)
+}
+
 // ReadRequestBody override default rpc.ServerCodec behaviour and inject remote node id into request
 func (nc *NodeAwareServerCodec) ReadRequestBody(body interface{}) (err error) {
 	err = nc.ServerCodec.ReadRequestBody(body)
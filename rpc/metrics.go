@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clientCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "rpc",
+		Name:      "client_calls_total",
+		Help:      "Count of outgoing RPC calls by route.RemoteFunc and result.",
+	}, []string{"method", "result"})
+	clientCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "rpc",
+		Name:      "client_call_duration_seconds",
+		Help:      "Duration of outgoing RPC calls by route.RemoteFunc.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"method"})
+	serverCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "rpc",
+		Name:      "server_calls_total",
+		Help:      "Count of served RPC calls by route.RemoteFunc and result.",
+	}, []string{"method", "result"})
+	serverCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "rpc",
+		Name:      "server_call_duration_seconds",
+		Help:      "Duration of served RPC calls by route.RemoteFunc.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(clientCalls, clientCallDuration, serverCalls, serverCallDuration)
+}
+
+// callResult returns the result label of a RPC call.
+func callResult(failed bool) string {
+	if failed {
+		return "error"
+	}
+	return "success"
+}
+
+// observeClientCall records an outgoing RPC call started at start.
+func observeClientCall(method string, start time.Time, err error) {
+	clientCalls.WithLabelValues(method, callResult(err != nil)).Inc()
+	clientCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// observeServerCall records a served RPC call started at start.
+func observeServerCall(method string, start time.Time, failed bool) {
+	serverCalls.WithLabelValues(method, callResult(failed)).Inc()
+	serverCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// newSessionPoolSize returns a gauge reporting the session count of pool.
+func newSessionPoolSize(pool SessPool) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "covenantsql",
+		Subsystem: "rpc",
+		Name:      "session_pool_size",
+		Help:      "Count of sessions in the default session pool.",
+	}, func() float64 {
+		return float64(pool.Len())
+	})
+}
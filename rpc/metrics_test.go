@@ -0,0 +1,76 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue returns the current value of counter.
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestServerCallMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServerWithService(ServiceMap{"Test": NewTestService()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetListener(l)
+	go server.Serve()
+	defer server.Stop()
+
+	client, err := initClient(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	success := serverCalls.WithLabelValues("Test.IncCounter", "success")
+	failure := serverCalls.WithLabelValues("Test.NotExists", "error")
+	successBase, failureBase := counterValue(t, success), counterValue(t, failure)
+
+	rep := new(TestRep)
+	for i := 0; i < 2; i++ {
+		if err = client.Call("Test.IncCounter", &TestReq{Step: 1}, rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = client.Call("Test.NotExists", &TestReq{Step: 1}, rep); err == nil {
+		t.Fatal("call to unknown method should fail")
+	}
+
+	if v := counterValue(t, success) - successBase; v != 2 {
+		t.Errorf("got %v successful calls, expected 2", v)
+	}
+	if v := counterValue(t, failure) - failureBase; v != 1 {
+		t.Errorf("got %v failed calls, expected 1", v)
+	}
+}
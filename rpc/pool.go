@@ -23,6 +23,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/hashicorp/yamux"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // SessPool is the session pool interface
@@ -75,6 +76,7 @@ func newSessionPool(nd NodeDialer) *SessionPool {
 func GetSessionPoolInstance() *SessionPool {
 	once.Do(func() {
 		instance = newSessionPool(DefaultDialer)
+		prometheus.MustRegister(newSessionPoolSize(instance))
 	})
 	return instance
 }
@@ -24,10 +24,12 @@ import (
 	"net"
 	"net/rpc"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/hashicorp/yamux"
 )
@@ -135,6 +137,13 @@ func (c *Caller) CallNode(
 // CallNodeWithContext invokes the named function, waits for it to complete or context timeout, and returns its error status.
 func (c *Caller) CallNodeWithContext(
 	ctx context.Context, node proto.NodeID, method string, args interface{}, reply interface{}) (err error) {
+	defer func(start time.Time) { observeClientCall(method, start, err) }(time.Now())
+
+	// carry trace context of ctx to remote
+	if e, ok := args.(proto.EnvelopeAPI); ok && !e.GetTraceContext().IsValid() {
+		trace.InjectEnvelope(ctx, e)
+	}
+
 	conn, err := DialToNode(node, c.pool, method == route.DHTPing.String())
 	if err != nil {
 		log.Errorf("dialing to node: %s failed: %s", node, err)
@@ -231,6 +240,12 @@ func GetNodeInfo(id *proto.RawNodeID) (nodeInfo *proto.Node, err error) {
 				log.Warnf("set node addr cache failed: %v", errSet)
 			}
 			errSet = kms.SetNode(nodeInfo)
+			if errSet == kms.ErrNodeIDKeyNonceNotMatch {
+				// node key may be rotated, sync rotation records and retry
+				if errSet = kms.SyncKeyRotations(nodeInfo.ID); errSet == nil {
+					errSet = kms.SetNode(nodeInfo)
+				}
+			}
 			if errSet != nil {
 				log.Warnf("set node to kms failed: %v", errSet)
 			}
@@ -239,6 +254,33 @@ func GetNodeInfo(id *proto.RawNodeID) (nodeInfo *proto.Node, err error) {
 	return
 }
 
+// FetchKeyRotations fetches key rotation records of node with Sequence > after from a random BP.
+func FetchKeyRotations(id proto.NodeID, after uint64) (rotations []*proto.KeyRotation, err error) {
+	// BP is the source of key rotation records, which are replicated among BPs by kayak
+	if localID, errID := kms.GetLocalNodeID(); errID == nil && route.IsBPNodeID(localID.ToRawNodeID()) {
+		return
+	}
+	BPs := route.GetBPs()
+	if len(BPs) == 0 {
+		err = ErrNoChiefBlockProducerAvailable
+		return
+	}
+	client := NewCaller()
+	req := &proto.GetKeyRotationReq{
+		NodeID: id,
+		After:  after,
+	}
+	resp := new(proto.GetKeyRotationResp)
+	bp := BPs[rand.Intn(len(BPs))]
+	method := route.DHTGetKeyRotation.String()
+	if err = client.CallNode(bp, method, req, resp); err != nil {
+		log.Errorf("call %s %s failed: %s", bp, method, err)
+		return
+	}
+	rotations = resp.Rotations
+	return
+}
+
 // PingBP Send DHT.Ping Request with Anonymous ETLS session.
 func PingBP(node *proto.Node, BPNodeID proto.NodeID) (err error) {
 	client := NewCaller()
@@ -51,14 +51,13 @@ func GetSharedSecretWith(nodeID *proto.RawNodeID, isAnonymous bool) (symmetricKe
 			remotePublicKey = nodeInfo.PublicKey
 		}
 
-		var localPrivateKey *asymmetric.PrivateKey
-		localPrivateKey, err = kms.GetLocalPrivateKey()
+		// shared secret is generated by local signer, the private key may be kept outside
+		symmetricKey, err = kms.GenLocalSharedSecret(remotePublicKey)
 		if err != nil {
-			log.Errorf("get local private key failed: %s", err)
+			log.Errorf("generate shared secret with local signer failed: %s", err)
 			return
 		}
 
-		symmetricKey = asymmetric.GenECDHSharedSecret(localPrivateKey, remotePublicKey)
 		log.Debugf("ECDH for %s Public Key: %x, Session Key: %x",
 			nodeID.ToNodeID(), remotePublicKey.Serialize(), symmetricKey)
 		//log.Debugf("ECDH for %s Public Key: %x, Private Key: %x Session Key: %x",
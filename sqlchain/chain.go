@@ -18,6 +18,7 @@ package sqlchain
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"os"
@@ -34,6 +35,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
@@ -391,6 +393,7 @@ func (c *Chain) pushBlock(b *ct.Block) (err error) {
 	})
 
 	if err == nil {
+		c.updateSyncLag()
 		log.WithFields(log.Fields{
 			"peer":        c.rt.getPeerInfoString()[:14],
 			"time":        c.rt.getChainTimeString(),
@@ -498,7 +501,7 @@ func (c *Chain) pushAckedQuery(ack *wt.SignedAckHeader) (err error) {
 // produceBlock prepares, signs and advises the pending block to the orther peers.
 func (c *Chain) produceBlock(now time.Time) (err error) {
 	// Retrieve local key pair
-	priv, err := kms.GetLocalPrivateKey()
+	signer, err := kms.GetLocalSigner()
 
 	if err != nil {
 		return
@@ -520,7 +523,15 @@ func (c *Chain) produceBlock(now time.Time) (err error) {
 		Queries: c.qi.markAndCollectUnsignedAcks(c.rt.getNextTurn()),
 	}
 
-	if err = block.PackAndSignBlock(priv); err != nil {
+	// Commit database state digest
+	if c.rt.stateTracker != nil {
+		if block.SignedHeader.StateLog, block.SignedHeader.StateRoot, err =
+			c.rt.stateTracker.SnapshotState(); err != nil {
+			return
+		}
+	}
+
+	if err = block.PackAndSignBlock(signer); err != nil {
 		return
 	}
 
@@ -555,6 +566,8 @@ func (c *Chain) produceBlock(now time.Time) (err error) {
 	}
 	peers := c.rt.getPeers()
 	wg := &sync.WaitGroup{}
+	rootsMutex := &sync.Mutex{}
+	roots := make(map[proto.NodeID]hash.Hash)
 
 	for _, s := range peers.Servers {
 		if s.ID != c.rt.getServer().ID {
@@ -572,6 +585,12 @@ func (c *Chain) produceBlock(now time.Time) (err error) {
 						"block_hash":      block.BlockHash().String(),
 					}).WithError(err).Error(
 						"Failed to advise new block")
+					return
+				}
+				if resp.StateKnown {
+					rootsMutex.Lock()
+					defer rootsMutex.Unlock()
+					roots[id] = resp.StateRoot
 				}
 			}(s.ID)
 		}
@@ -579,6 +598,9 @@ func (c *Chain) produceBlock(now time.Time) (err error) {
 
 	wg.Wait()
 
+	// Check local database state against the state roots replied by peers
+	c.checkStateMajority(block, roots)
+
 	// fire replication to observers
 	c.startStopReplication()
 
@@ -665,6 +687,8 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 		"using_timestamp": now.Format(time.RFC3339Nano),
 	}).Debug("Run current turn")
 
+	c.updateSyncLag()
+
 	if c.rt.getHead().Height < c.rt.getNextTurn()-1 {
 		log.WithFields(log.Fields{
 			"peer":            c.rt.getPeerInfoString(),
@@ -681,6 +705,7 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 	}
 
 	if err := c.produceBlock(now); err != nil {
+		blocksProduced.WithLabelValues(string(c.rt.databaseID), "error").Inc()
 		log.WithFields(log.Fields{
 			"peer":            c.rt.getPeerInfoString(),
 			"time":            c.rt.getChainTimeString(),
@@ -688,7 +713,10 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 			"using_timestamp": now.Format(time.RFC3339Nano),
 		}).WithError(err).Error(
 			"Failed to produce block")
+		return
 	}
+
+	blocksProduced.WithLabelValues(string(c.rt.databaseID), "success").Inc()
 }
 
 // mainCycle runs main cycle of the sql-chain.
@@ -873,6 +901,7 @@ func (c *Chain) Stop() (err error) {
 		"time": c.rt.getChainTimeString(),
 	}).Debug("Stopping chain")
 	c.rt.stop()
+	c.deleteMetrics()
 	log.WithFields(log.Fields{
 		"peer": c.rt.getPeerInfoString(),
 		"time": c.rt.getChainTimeString(),
@@ -968,7 +997,7 @@ func (c *Chain) syncAckedQuery(height int32, header *hash.Hash, id proto.NodeID)
 		return
 	}
 
-	if err = c.VerifyAndPushAckedQuery(resp.Ack); err != nil {
+	if err = c.VerifyAndPushAckedQuery(context.Background(), resp.Ack); err != nil {
 		return
 	}
 
@@ -1031,6 +1060,9 @@ func (c *Chain) CheckAndPushNewBlock(block *ct.Block) (err error) {
 		return c.pushBlock(block)
 	}
 
+	// Alert on database state mismatch, the majority decision is made by the producer
+	c.checkBlockStateDigest(block)
+
 	// Check block producer
 	index, found := peers.Find(block.Producer())
 
@@ -1091,7 +1123,12 @@ func (c *Chain) VerifyAndPushResponsedQuery(resp *wt.SignedResponseHeader) (err
 }
 
 // VerifyAndPushAckedQuery verifies a acknowledged and signed query, and pushed it if valid.
-func (c *Chain) VerifyAndPushAckedQuery(ack *wt.SignedAckHeader) (err error) {
+// The verification is traced as part of ctx.
+func (c *Chain) VerifyAndPushAckedQuery(ctx context.Context, ack *wt.SignedAckHeader) (err error) {
+	_, span := trace.StartSpan(ctx, "sqlchain.VerifyAndPushAckedQuery")
+	defer func() { span.End(err) }()
+	span.SetAttribute("database", c.rt.databaseID)
+
 	// TODO(leventeliu): check ack.
 	if c.rt.queryTimeIsExpired(ack.SignedResponseHeader().Timestamp) {
 		return ErrQueryExpired
@@ -1190,12 +1227,13 @@ func (c *Chain) getBilling(low, high int32) (req *pt.BillingRequest, err error)
 
 	req = &pt.BillingRequest{
 		Header: pt.BillingRequestHeader{
-			DatabaseID: c.rt.databaseID,
-			LowBlock:   *lowBlock.BlockHash(),
-			LowHeight:  low,
-			HighBlock:  *highBlock.BlockHash(),
-			HighHeight: high,
-			GasAmounts: gasAmounts,
+			DatabaseID:    c.rt.databaseID,
+			LowBlock:      *lowBlock.BlockHash(),
+			LowHeight:     low,
+			HighBlock:     *highBlock.BlockHash(),
+			HighHeight:    high,
+			HighStateRoot: highBlock.SignedHeader.StateRoot,
+			GasAmounts:    gasAmounts,
 		},
 	}
 	return
@@ -1329,6 +1367,12 @@ func (c *Chain) SignBilling(req *pt.BillingRequest) (
 		"high": req.Header.HighHeight,
 	}).WithError(err).Debug("Processing sign billing request")
 
+	// Refuse to sign for blocks of a database state not agreed by the local peer
+	if c.rt.isStateDiverged() {
+		err = ErrStateDiverged
+		return
+	}
+
 	// Verify billing results
 	if err = req.VerifySignatures(); err != nil {
 		return
@@ -1343,13 +1387,13 @@ func (c *Chain) SignBilling(req *pt.BillingRequest) (
 	}
 
 	// Sign block with private key
-	priv, err := kms.GetLocalPrivateKey()
+	signer, err := kms.GetLocalSigner()
 
 	if err != nil {
 		return
 	}
 
-	pub, sig, err = req.SignRequestHeader(priv, false)
+	pub, sig, err = req.SignRequestHeader(signer, false)
 
 	return
 }
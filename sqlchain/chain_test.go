@@ -18,6 +18,7 @@ package sqlchain
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"math/rand"
@@ -357,7 +358,7 @@ func TestMultiChain(t *testing.T) {
 
 						if err != nil {
 							t.Errorf("Error occurred: %v", err)
-						} else if err = c.VerifyAndPushAckedQuery(ack); err != nil {
+						} else if err = c.VerifyAndPushAckedQuery(context.Background(), ack); err != nil {
 							t.Errorf("Error occurred: %v", err)
 						}
 					}
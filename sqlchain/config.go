@@ -19,6 +19,7 @@ package sqlchain
 import (
 	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/kayak"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
@@ -45,4 +46,20 @@ type Config struct {
 
 	// QueryTTL sets the unacknowledged query TTL in block periods.
 	QueryTTL int32
+
+	// StateTracker provides the database state digests committed in produced blocks.
+	StateTracker StateTracker
+}
+
+// StateTracker tracks the database state digest after applying each write log, which is the
+// write log hash and the database state root right after applying it.
+type StateTracker interface {
+	// SnapshotState pins the current database state for the block being produced, so the query
+	// result proofs are served against the state root committed in the block. It returns the last
+	// applied write log and the current database state root.
+	SnapshotState() (log hash.Hash, root hash.Hash, err error)
+	// LookupStateRoot returns the database state root right after applying the write log.
+	LookupStateRoot(log hash.Hash) (root hash.Hash, ok bool)
+	// StateDiverged is called when the local state root disagrees with the majority of peers.
+	StateDiverged(log hash.Hash, local hash.Hash, majority hash.Hash)
 }
@@ -89,4 +89,8 @@ var (
 
 	// ErrAckQueryNotFound indicates that an acknowledged query record is not found.
 	ErrAckQueryNotFound = errors.New("acknowledged query not found")
+
+	// ErrStateDiverged indicates that the local database state disagrees with the majority of
+	// peers.
+	ErrStateDiverged = errors.New("local database state diverged from the majority of peers")
 )
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	blocksProduced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "blocks_produced_total",
+		Help:      "Count of blocks produced in the turns of local peer.",
+	}, []string{"database", "result"})
+	headHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "head_height",
+		Help:      "Height of the chain head block.",
+	}, []string{"database"})
+	syncLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "sync_lag_blocks",
+		Help:      "Count of turns the chain head falls behind the current turn.",
+	}, []string{"database"})
+)
+
+func init() {
+	prometheus.MustRegister(blocksProduced, headHeight, syncLag)
+}
+
+// updateSyncLag sets the head height and the sync lag of chain.
+func (c *Chain) updateSyncLag() {
+	dbID := string(c.rt.databaseID)
+	head := c.rt.getHead().Height
+	lag := c.rt.getNextTurn() - 1 - head
+	if lag < 0 {
+		lag = 0
+	}
+	headHeight.WithLabelValues(dbID).Set(float64(head))
+	syncLag.WithLabelValues(dbID).Set(float64(lag))
+}
+
+// deleteMetrics removes the metrics labeled by the database of chain.
+func (c *Chain) deleteMetrics() {
+	dbID := string(c.rt.databaseID)
+	for _, result := range []string{"success", "error"} {
+		blocksProduced.DeleteLabelValues(dbID, result)
+	}
+	headHeight.DeleteLabelValues(dbID)
+	syncLag.DeleteLabelValues(dbID)
+}
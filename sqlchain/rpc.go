@@ -17,6 +17,8 @@
 package sqlchain
 
 import (
+	"context"
+
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
@@ -38,6 +40,10 @@ type AdviseNewBlockReq struct {
 
 // AdviseNewBlockResp defines a response of the AdviseNewBlock RPC method.
 type AdviseNewBlockResp struct {
+	// StateRoot is the local database state root after applying the write log of the block, it's
+	// only valid if StateKnown is true.
+	StateRoot  hash.Hash
+	StateKnown bool
 }
 
 // AdviseBinLogReq defines a request of the AdviseBinLog RPC method.
@@ -66,7 +72,8 @@ type AdviseAckedQueryReq struct {
 type AdviseAckedQueryResp struct {
 }
 
-// FetchBlockReq defines a request of the FetchBlock RPC method.
+// FetchBlockReq defines a request of the FetchBlock RPC method, a negative Height fetches the
+// current head block.
 type FetchBlockReq struct {
 	Height int32
 }
@@ -131,6 +138,7 @@ type CancelSubscriptionResp struct{}
 func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNewBlockResp) (
 	err error) {
 	s.chain.blocks <- req.Block
+	resp.StateRoot, resp.StateKnown = s.chain.lookupStateRoot(req.Block)
 	return
 }
 
@@ -149,13 +157,16 @@ func (s *ChainRPCService) AdviseResponsedQuery(
 // AdviseAckedQuery is the RPC method to advise a new acknowledged query to the target server.
 func (s *ChainRPCService) AdviseAckedQuery(
 	req *AdviseAckedQueryReq, resp *AdviseAckedQueryResp) error {
-	return s.chain.VerifyAndPushAckedQuery(req.Query)
+	return s.chain.VerifyAndPushAckedQuery(context.Background(), req.Query)
 }
 
 // FetchBlock is the RPC method to fetch a known block from the target server.
 func (s *ChainRPCService) FetchBlock(req *FetchBlockReq, resp *FetchBlockResp) (err error) {
 	resp.Height = req.Height
-	resp.Block, err = s.chain.FetchBlock(req.Height)
+	if resp.Height < 0 {
+		resp.Height = s.chain.rt.getHead().Height
+	}
+	resp.Block, err = s.chain.FetchBlock(resp.Height)
 	return
 }
 
@@ -54,6 +54,8 @@ type runtime struct {
 	price           map[wt.QueryType]uint64
 	producingReward uint64
 	billingPeriods  int32
+	// stateTracker provides the database state digests committed in produced blocks.
+	stateTracker StateTracker
 
 	// peersMutex protects following peers-relative fields.
 	peersMutex sync.Mutex
@@ -75,6 +77,11 @@ type runtime struct {
 	// forks is the alternative head of the sql-chain.
 	forks []*state
 
+	// divergedMutex protects following state-digest-relative fields.
+	divergedMutex sync.Mutex
+	// diverged is set if the local database state disagrees with the majority of peers.
+	diverged bool
+
 	// timeMutex protects following time-relative fields.
 	timeMutex sync.Mutex
 	// offset is the time difference calculated by: coodinatedChainTime - time.Now().
@@ -95,6 +102,7 @@ func newRunTime(c *Config) (r *runtime) {
 		price:           c.Price,
 		producingReward: c.ProducingReward,
 		billingPeriods:  c.BillingPeriods,
+		stateTracker:    c.StateTracker,
 		peers:           c.Peers,
 		server:          c.Server,
 		index: func() int32 {
@@ -316,6 +324,18 @@ func (r *runtime) getPeers() *kayak.Peers {
 	return &peers
 }
 
+func (r *runtime) setStateDiverged() {
+	r.divergedMutex.Lock()
+	defer r.divergedMutex.Unlock()
+	r.diverged = true
+}
+
+func (r *runtime) isStateDiverged() bool {
+	r.divergedMutex.Lock()
+	defer r.divergedMutex.Unlock()
+	return r.diverged
+}
+
 func (r *runtime) getHead() *state {
 	r.stateMutex.Lock()
 	defer r.stateMutex.Unlock()
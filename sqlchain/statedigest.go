@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// Following contains the state digest consensus among peers. Each block commits the state digest
+// of its producer, and every peer replies its own state root after applying the same write log
+// when the block is advised, if the peer knows it, i.e. the peer has just applied the same log.
+// So the producer learns whether its local database state agrees with the majority of peers, and
+// each peer is checked once in its producing turn.
+
+// lookupStateRoot returns the local state root right after applying the write log of block.
+func (c *Chain) lookupStateRoot(b *ct.Block) (root hash.Hash, ok bool) {
+	if c.rt.stateTracker == nil || b == nil || b.SignedHeader.StateLog.IsEqual(&hash.Hash{}) {
+		return
+	}
+	return c.rt.stateTracker.LookupStateRoot(b.SignedHeader.StateLog)
+}
+
+// checkBlockStateDigest compares the state digest of a block from other peer with the local one.
+func (c *Chain) checkBlockStateDigest(b *ct.Block) {
+	if local, ok := c.lookupStateRoot(b); ok && !local.IsEqual(&b.SignedHeader.StateRoot) {
+		log.WithFields(log.Fields{
+			"peer":        c.rt.getPeerInfoString(),
+			"time":        c.rt.getChainTimeString(),
+			"block":       b.BlockHash().String(),
+			"producer":    b.Producer(),
+			"state_log":   b.SignedHeader.StateLog.String(),
+			"state_root":  b.SignedHeader.StateRoot.String(),
+			"local_state": local.String(),
+		}).Warning("Database state of block producer mismatches local state")
+	}
+}
+
+// checkStateMajority checks the state digest of a self-produced block against the state roots
+// replied by peers, the local state is marked as diverged if the majority of peers agree on
+// another state root.
+func (c *Chain) checkStateMajority(b *ct.Block, roots map[proto.NodeID]hash.Hash) {
+	if c.rt.stateTracker == nil || b.SignedHeader.StateLog.IsEqual(&hash.Hash{}) {
+		return
+	}
+
+	local := b.SignedHeader.StateRoot
+	total := len(c.rt.getPeers().Servers)
+	counts := map[hash.Hash]int{local: 1}
+	var majority hash.Hash
+	for _, v := range roots {
+		counts[v]++
+	}
+	for k, v := range counts {
+		if v*2 > total {
+			majority = k
+		}
+	}
+
+	fields := log.Fields{
+		"peer":        c.rt.getPeerInfoString(),
+		"time":        c.rt.getChainTimeString(),
+		"block":       b.BlockHash().String(),
+		"state_log":   b.SignedHeader.StateLog.String(),
+		"local_state": local.String(),
+		"replied":     len(roots),
+		"total":       total,
+	}
+
+	if majority.IsEqual(&local) {
+		for id, v := range roots {
+			if !v.IsEqual(&local) {
+				log.WithFields(fields).WithField("diverged_peer", id).WithField(
+					"diverged_state", v.String()).Warning("Database state of peer mismatches the majority")
+			}
+		}
+		return
+	}
+
+	if majority.IsEqual(&hash.Hash{}) {
+		if len(counts) > 1 {
+			log.WithFields(fields).Warning("Database states of peers mismatch without majority")
+		}
+		return
+	}
+
+	log.WithFields(fields).WithField("majority_state", majority.String()).Error(
+		"Local database state mismatches the majority of peers, stop serving")
+	c.rt.setStateDiverged()
+	c.rt.stateTracker.StateDiverged(b.SignedHeader.StateLog, local, majority)
+}
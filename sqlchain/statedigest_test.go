@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/kayak"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+)
+
+type testStateTracker struct {
+	roots    map[hash.Hash]hash.Hash
+	diverged bool
+}
+
+func (t *testStateTracker) SnapshotState() (log hash.Hash, root hash.Hash, err error) {
+	return
+}
+
+func (t *testStateTracker) LookupStateRoot(log hash.Hash) (root hash.Hash, ok bool) {
+	root, ok = t.roots[log]
+	return
+}
+
+func (t *testStateTracker) StateDiverged(log hash.Hash, local hash.Hash, majority hash.Hash) {
+	t.diverged = true
+}
+
+func newTestStateChain(total int) (c *Chain, tracker *testStateTracker) {
+	servers := make([]*kayak.Server, total)
+	for i := range servers {
+		servers[i] = &kayak.Server{ID: proto.NodeID(fmt.Sprintf("node%d", i))}
+	}
+
+	tracker = &testStateTracker{roots: make(map[hash.Hash]hash.Hash)}
+	c = &Chain{
+		rt: &runtime{
+			period:       time.Second,
+			peers:        &kayak.Peers{Servers: servers},
+			server:       servers[0],
+			total:        int32(total),
+			stateTracker: tracker,
+		},
+	}
+	return
+}
+
+func TestCheckStateMajority(t *testing.T) {
+	var stateLog, local, other hash.Hash
+	rand.Read(stateLog[:])
+	rand.Read(local[:])
+	rand.Read(other[:])
+
+	block := &ct.Block{
+		SignedHeader: ct.SignedHeader{
+			Header: ct.Header{
+				StateLog:  stateLog,
+				StateRoot: local,
+			},
+		},
+	}
+
+	cases := []struct {
+		total    int
+		roots    []hash.Hash
+		diverged bool
+	}{
+		{total: 3, roots: []hash.Hash{local, local}},
+		{total: 3, roots: []hash.Hash{local, other}},
+		{total: 3, roots: []hash.Hash{other}},
+		{total: 3, roots: []hash.Hash{other, other}, diverged: true},
+		{total: 4, roots: []hash.Hash{other, other}},
+		{total: 5, roots: []hash.Hash{other, other, other, local}, diverged: true},
+	}
+
+	for i, v := range cases {
+		c, tracker := newTestStateChain(v.total)
+		roots := make(map[proto.NodeID]hash.Hash)
+		for j, r := range v.roots {
+			roots[c.rt.peers.Servers[j+1].ID] = r
+		}
+
+		c.checkStateMajority(block, roots)
+
+		if tracker.diverged != v.diverged || c.rt.isStateDiverged() != v.diverged {
+			t.Fatalf("Unexpected result in case %d: diverged = %v", i, tracker.diverged)
+		}
+		if v.diverged {
+			if _, _, err := c.SignBilling(&pt.BillingRequest{}); err != ErrStateDiverged {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+}
+
+func TestLookupStateRoot(t *testing.T) {
+	c, tracker := newTestStateChain(3)
+
+	var stateLog, root hash.Hash
+	rand.Read(stateLog[:])
+	rand.Read(root[:])
+	tracker.roots[stateLog] = root
+
+	block := &ct.Block{}
+	if _, ok := c.lookupStateRoot(block); ok {
+		t.Fatal("Unexpected result: block without state digest should be unknown")
+	}
+
+	block.SignedHeader.StateLog = stateLog
+	if r, ok := c.lookupStateRoot(block); !ok || !r.IsEqual(&root) {
+		t.Fatalf("Unexpected result: ok = %v, root = %s", ok, r.String())
+	}
+}
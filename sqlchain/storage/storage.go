@@ -253,7 +253,52 @@ func (s *Storage) Query(ctx context.Context, queries []Query) (columns []string,
 	// always rollback on complete
 	defer tx.Rollback()
 
-	q := queries[0]
+	return queryTx(tx, queries[0])
+}
+
+// Snapshot represents a read-only view of the database at the time it is taken, the following
+// writes are invisible to the snapshot until it is closed.
+type Snapshot struct {
+	tx *sql.Tx
+}
+
+// Snapshot pins the current database state in a read-only transaction, it relies on the WAL
+// journal mode to keep the view while writes continue.
+func (s *Storage) Snapshot() (ss *Snapshot, err error) {
+	var tx *sql.Tx
+	if tx, err = s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true}); err != nil {
+		return
+	}
+
+	// the read transaction starts on the first read instead of BEGIN
+	var count int64
+	if err = tx.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&count); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	return &Snapshot{tx: tx}, nil
+}
+
+// Query implements read-only query feature on the snapshot.
+func (ss *Snapshot) Query(ctx context.Context, queries []Query) (columns []string, types []string,
+	data [][]interface{}, err error) {
+	data = make([][]interface{}, 0)
+
+	if len(queries) == 0 {
+		return
+	}
+
+	return queryTx(ss.tx, queries[0])
+}
+
+// Close releases the snapshot.
+func (ss *Snapshot) Close() error {
+	return ss.tx.Rollback()
+}
+
+func queryTx(tx *sql.Tx, q Query) (columns []string, types []string, data [][]interface{}, err error) {
+	data = make([][]interface{}, 0)
 
 	// convert arguments types
 	args := make([]interface{}, len(q.Args))
@@ -281,7 +326,7 @@ func (s *Storage) Query(ctx context.Context, queries []Query) (columns []string,
 	}
 
 	// get types meta
-	if types, err = s.transformColumnTypes(rows.ColumnTypes()); err != nil {
+	if types, err = transformColumnTypes(rows.ColumnTypes()); err != nil {
 		return
 	}
 
@@ -355,7 +400,7 @@ func (s *Storage) Close() (err error) {
 	return s.db.Close()
 }
 
-func (s *Storage) transformColumnTypes(columnTypes []*sql.ColumnType, e error) (types []string, err error) {
+func transformColumnTypes(columnTypes []*sql.ColumnType, e error) (types []string, err error) {
 	if e != nil {
 		err = e
 		return
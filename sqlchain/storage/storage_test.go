@@ -347,3 +347,78 @@ func TestStorage(t *testing.T) {
 		}
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	fl, err := ioutil.TempFile("", "sqlite3-")
+
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	st, err := New(fmt.Sprintf("file:%s", fl.Name()))
+
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	defer st.Close()
+
+	if _, err = st.Exec(context.Background(), []Query{
+		newQuery("CREATE TABLE IF NOT EXISTS `kv` (`key` TEXT PRIMARY KEY, `value` BLOB)"),
+	}); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	if _, err = st.Exec(context.Background(), []Query{
+		newQuery("INSERT INTO `kv` VALUES ('k1', 'v1')"),
+	}); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	ss, err := st.Snapshot()
+
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	if _, err = st.Exec(context.Background(), []Query{
+		newQuery("UPDATE `kv` SET `value` = 'v1-2' WHERE `key` = 'k1'"),
+	}); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	if _, err = st.Exec(context.Background(), []Query{
+		newQuery("INSERT INTO `kv` VALUES ('k2', 'v2')"),
+	}); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	// writes after the snapshot should be invisible
+	_, _, data, err := ss.Query(context.Background(), []Query{
+		newQuery("SELECT `value` FROM `kv` ORDER BY `key`"),
+	})
+
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	if should := [][]interface{}{{[]byte("v1")}}; !reflect.DeepEqual(data, should) {
+		t.Fatalf("Error snapshot result: %v, should: %v", data, should)
+	}
+
+	if err = ss.Close(); err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	_, _, data, err = st.Query(context.Background(), []Query{
+		newQuery("SELECT `value` FROM `kv` ORDER BY `key`"),
+	})
+
+	if err != nil {
+		t.Fatalf("Error occurred: %v", err)
+	}
+
+	if should := [][]interface{}{{[]byte("v1-2")}, {[]byte("v2")}}; !reflect.DeepEqual(data, should) {
+		t.Fatalf("Error query result: %v, should: %v", data, should)
+	}
+}
@@ -17,7 +17,6 @@
 package types
 
 import (
-	"reflect"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
@@ -37,6 +36,8 @@ type Header struct {
 	GenesisHash hash.Hash
 	ParentHash  hash.Hash
 	MerkleRoot  hash.Hash
+	StateRoot   hash.Hash // root of database state authenticated data structure
+	StateLog    hash.Hash // hash of the last write log applied before computing StateRoot
 	Timestamp   time.Time
 }
 
@@ -108,13 +109,8 @@ func (s *SignedHeader) VerifyAsGenesis() (err error) {
 	)
 
 	// Assume that we can fetch public key from kms after initialization.
-	pk, err := kms.GetPublicKey(s.Producer)
-
-	if err != nil {
-		return
-	}
-
-	if !reflect.DeepEqual(pk, s.Signee) {
+	// The producer key may have been rotated since genesis, check the key at block time.
+	if !kms.IsNodePublicKeyAt(s.Producer, s.Signee, s.Timestamp) {
 		return ErrNodePublicKeyNotMatch
 	}
 
@@ -128,7 +124,7 @@ type Block struct {
 }
 
 // PackAndSignBlock generates the signature for the Block from the given PrivateKey.
-func (b *Block) PackAndSignBlock(signer *asymmetric.PrivateKey) (err error) {
+func (b *Block) PackAndSignBlock(signer kms.Signer) (err error) {
 	// Calculate merkle root
 	b.SignedHeader.MerkleRoot = *merkle.NewMerkle(b.Queries).GetRoot()
 	buffer, err := b.SignedHeader.Header.MarshalHash()
@@ -193,13 +189,8 @@ func (b *Block) Verify() (err error) {
 // VerifyAsGenesis verifies the block as a genesis block.
 func (b *Block) VerifyAsGenesis() (err error) {
 	// Assume that we can fetch public key from kms after initialization.
-	pk, err := kms.GetPublicKey(b.Producer())
-
-	if err != nil {
-		return
-	}
-
-	if !reflect.DeepEqual(pk, b.SignedHeader.Signee) {
+	// The producer key may have been rotated since genesis, check the key at block time.
+	if !kms.IsNodePublicKeyAt(b.Producer(), b.SignedHeader.Signee, b.Timestamp()) {
 		return ErrNodePublicKeyNotMatch
 	}
 
@@ -0,0 +1,28 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package trace implements distributed tracing of queries across client, miner, kayak and
+// sqlchain. Span context is carried in context.Context locally and in proto.Envelope across rpc
+// calls, finished spans are exported to an OpenTelemetry collector by OTLPExporter.
+//
+// Spans are only sampled when an exporter is registered, e.g. for client library users:
+//
+//	exporter := trace.NewOTLPExporter("http://127.0.0.1:4318/v1/traces", "my-app")
+//	trace.RegisterExporter(exporter)
+//	defer exporter.Stop()
+//
+// Queries issued by database/sql with a traced context are then continued through the miners.
+package trace
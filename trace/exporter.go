@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"sync"
+)
+
+// Exporter receives the finished spans, ExportSpan should not block.
+type Exporter interface {
+	ExportSpan(s *SpanData)
+}
+
+var (
+	exportersLock sync.RWMutex
+	exporters     []Exporter
+)
+
+// RegisterExporter adds an exporter receiving the finished spans, root spans are sampled only if
+// at least one exporter is registered.
+func RegisterExporter(e Exporter) {
+	exportersLock.Lock()
+	defer exportersLock.Unlock()
+	exporters = append(exporters, e)
+}
+
+// UnregisterExporter removes the registered exporter.
+func UnregisterExporter(e Exporter) {
+	exportersLock.Lock()
+	defer exportersLock.Unlock()
+	for i, v := range exporters {
+		if v == e {
+			exporters = append(exporters[:i:i], exporters[i+1:]...)
+			return
+		}
+	}
+}
+
+func hasExporters() bool {
+	exportersLock.RLock()
+	defer exportersLock.RUnlock()
+	return len(exporters) > 0
+}
+
+func export(s *SpanData) {
+	exportersLock.RLock()
+	defer exportersLock.RUnlock()
+	for _, e := range exporters {
+		e.ExportSpan(s)
+	}
+}
+
+// MemoryExporter keeps the finished spans in process, mainly for tests.
+type MemoryExporter struct {
+	sync.Mutex
+	spans []*SpanData
+}
+
+// NewMemoryExporter returns a new in-process exporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// ExportSpan implements Exporter.ExportSpan.
+func (e *MemoryExporter) ExportSpan(s *SpanData) {
+	e.Lock()
+	defer e.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns the finished spans in order of end time.
+func (e *MemoryExporter) Spans() []*SpanData {
+	e.Lock()
+	defer e.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// SpansByName returns the finished spans with the name.
+func (e *MemoryExporter) SpansByName(name string) (spans []*SpanData) {
+	for _, s := range e.Spans() {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return
+}
+
+// Reset drops the finished spans.
+func (e *MemoryExporter) Reset() {
+	e.Lock()
+	defer e.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// OTLPTracesPath is the default path of OTLP/HTTP traces endpoint.
+	OTLPTracesPath = "/v1/traces"
+
+	otlpQueueSize     = 4096
+	otlpBatchSize     = 512
+	otlpFlushInterval = 5 * time.Second
+	otlpTimeout       = 10 * time.Second
+
+	// OTLP span kind and status code
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOk     = 1
+	otlpStatusCodeError  = 2
+)
+
+// OTLPExporter batches the finished spans and posts them to an OpenTelemetry collector in
+// OTLP/HTTP JSON encoding.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	queue       chan *SpanData
+	flushCh     chan chan struct{}
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+	wg          sync.WaitGroup
+	dropped     uint64
+}
+
+type otlpKeyValue struct {
+	Key   string        `json:"key"`
+	Value otlpAnyString `json:"value"`
+}
+
+type otlpAnyString struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+// NewOTLPExporter returns a started exporter posting spans to the OTLP/HTTP traces endpoint
+// url, e.g. http://127.0.0.1:4318/v1/traces. The spans are reported with resource attribute
+// service.name set to serviceName.
+func NewOTLPExporter(endpoint string, serviceName string) (e *OTLPExporter) {
+	e = &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: otlpTimeout},
+		queue:       make(chan *SpanData, otlpQueueSize),
+		flushCh:     make(chan chan struct{}),
+		stopCh:      make(chan struct{}),
+	}
+
+	e.wg.Add(1)
+	go e.run()
+
+	return
+}
+
+// ExportSpan implements Exporter.ExportSpan, spans are dropped if the queue is full.
+func (e *OTLPExporter) ExportSpan(s *SpanData) {
+	select {
+	case e.queue <- s:
+	default:
+		if atomic.AddUint64(&e.dropped, 1)%otlpBatchSize == 1 {
+			log.Warningf("otlp exporter queue is full, %d spans dropped", atomic.LoadUint64(&e.dropped))
+		}
+	}
+}
+
+// Flush posts the queued spans and waits for completion.
+func (e *OTLPExporter) Flush() {
+	done := make(chan struct{})
+	select {
+	case e.flushCh <- done:
+		<-done
+	case <-e.stopCh:
+	}
+}
+
+// Stop flushes the queued spans and stops the exporter.
+func (e *OTLPExporter) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+	})
+	e.wg.Wait()
+}
+
+func (e *OTLPExporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, otlpBatchSize)
+	drain := func() {
+		for {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+				if len(batch) >= otlpBatchSize {
+					e.post(batch)
+					batch = batch[:0]
+				}
+			default:
+				if len(batch) > 0 {
+					e.post(batch)
+					batch = batch[:0]
+				}
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= otlpBatchSize {
+				e.post(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			drain()
+		case done := <-e.flushCh:
+			drain()
+			close(done)
+		case <-e.stopCh:
+			drain()
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) post(batch []*SpanData) {
+	body, err := json.Marshal(e.buildRequest(batch))
+	if err != nil {
+		log.WithError(err).Warning("encode otlp traces failed")
+		return
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.WithError(err).Warningf("export %d spans to %s failed", len(batch), e.endpoint)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		log.Warningf("export %d spans to %s failed: %s", len(batch), e.endpoint, resp.Status)
+	}
+}
+
+func (e *OTLPExporter) buildRequest(batch []*SpanData) *otlpTracesRequest {
+	scope := &otlpScopeSpans{}
+	scope.Scope.Name = "github.com/CovenantSQL/CovenantSQL/trace"
+	for _, s := range batch {
+		scope.Spans = append(scope.Spans, newOTLPSpan(s))
+	}
+
+	rs := &otlpResourceSpans{ScopeSpans: []*otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []otlpKeyValue{
+		{Key: "service.name", Value: otlpAnyString{StringValue: e.serviceName}},
+	}
+
+	return &otlpTracesRequest{ResourceSpans: []*otlpResourceSpans{rs}}
+}
+
+func newOTLPSpan(s *SpanData) (span *otlpSpan) {
+	span = &otlpSpan{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		Name:              s.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusCodeOk},
+	}
+	if s.ParentSpanID != (SpanID{}) {
+		span.ParentSpanID = s.ParentSpanID.String()
+	}
+	if s.Error != "" {
+		span.Status = otlpStatus{Code: otlpStatusCodeError, Message: s.Error}
+	}
+
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		span.Attributes = append(span.Attributes, otlpKeyValue{
+			Key:   k,
+			Value: otlpAnyString{StringValue: s.Attributes[k]},
+		})
+	}
+
+	return
+}
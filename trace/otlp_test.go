@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	Convey("Given an OTLP exporter to a stub collector", t, func() {
+		var (
+			lock     sync.Mutex
+			requests []*otlpTracesRequest
+		)
+		collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != OTLPTracesPath || r.Header.Get("Content-Type") != "application/json" {
+				http.NotFound(rw, r)
+				return
+			}
+			req := &otlpTracesRequest{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			requests = append(requests, req)
+		}))
+		Reset(collector.Close)
+
+		e := NewOTLPExporter(collector.URL+OTLPTracesPath, "test")
+		RegisterExporter(e)
+		Reset(func() {
+			UnregisterExporter(e)
+			e.Stop()
+		})
+
+		Convey("The finished spans should be posted in OTLP/HTTP JSON", func() {
+			ctx, root := StartSpan(context.Background(), "root")
+			_, child := StartSpan(ctx, "child")
+			child.SetAttribute("database", "db")
+			child.End(errors.New("failed"))
+			root.End(nil)
+			e.Flush()
+
+			lock.Lock()
+			defer lock.Unlock()
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].ResourceSpans, ShouldHaveLength, 1)
+			rs := requests[0].ResourceSpans[0]
+			So(rs.Resource.Attributes, ShouldResemble, []otlpKeyValue{
+				{Key: "service.name", Value: otlpAnyString{StringValue: "test"}},
+			})
+			spans := rs.ScopeSpans[0].Spans
+			So(spans, ShouldHaveLength, 2)
+			So(spans[0].Name, ShouldEqual, "child")
+			So(spans[0].TraceID, ShouldEqual, root.SpanContext().TraceID.String())
+			So(spans[0].TraceID, ShouldHaveLength, 32)
+			So(spans[0].ParentSpanID, ShouldEqual, root.SpanContext().SpanID.String())
+			So(spans[0].Status, ShouldResemble, otlpStatus{Code: otlpStatusCodeError, Message: "failed"})
+			So(spans[0].Attributes, ShouldResemble, []otlpKeyValue{
+				{Key: "database", Value: otlpAnyString{StringValue: "db"}},
+			})
+			So(spans[1].ParentSpanID, ShouldBeEmpty)
+			So(spans[1].Status.Code, ShouldEqual, otlpStatusCodeOk)
+		})
+
+		Convey("The queued spans should be posted on stop", func() {
+			_, span := StartSpan(context.Background(), "root")
+			span.End(nil)
+			e.Stop()
+
+			// flush after stop should not block
+			e.Flush()
+
+			lock.Lock()
+			defer lock.Unlock()
+			So(requests, ShouldHaveLength, 1)
+		})
+	})
+}
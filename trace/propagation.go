@@ -0,0 +1,56 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// InjectEnvelope sets the span context in ctx to the rpc envelope, the envelope is kept unchanged
+// if ctx is not traced.
+func InjectEnvelope(ctx context.Context, e proto.EnvelopeAPI) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	e.SetTraceContext(proto.TraceContext{
+		TraceID: sc.TraceID,
+		SpanID:  sc.SpanID,
+		Sampled: sc.Sampled,
+	})
+}
+
+// ContextFromEnvelope returns a copy of ctx with the remote span context carried in rpc envelope.
+func ContextFromEnvelope(ctx context.Context, e proto.EnvelopeAPI) context.Context {
+	tc := e.GetTraceContext()
+	return ContextWithRemoteSpanContext(ctx, SpanContext{
+		TraceID: tc.TraceID,
+		SpanID:  tc.SpanID,
+		Sampled: tc.Sampled,
+	})
+}
+
+// ContextFromRequest returns a copy of ctx with the remote span context if req carries a rpc
+// envelope, ctx is returned if not.
+func ContextFromRequest(ctx context.Context, req interface{}) context.Context {
+	if e, ok := req.(proto.EnvelopeAPI); ok {
+		return ContextFromEnvelope(ctx, e)
+	}
+	return ctx
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, compatible with W3C trace context and OpenTelemetry.
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex encoding of trace id.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// String returns the lowercase hex encoding of span id.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the propagated part of a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns if the span context refers to a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// SpanData is the finished span passed to exporters.
+type SpanData struct {
+	SpanContext
+	ParentSpanID SpanID
+	Name         string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	Error        string
+}
+
+// Span records the timing of an operation, methods of a nil span are no-op so the callers are
+// not required to check whether the span is sampled.
+type Span struct {
+	sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteSpanContextKey
+)
+
+var (
+	idLock   sync.Mutex
+	idSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sampleLock sync.RWMutex
+	sampleRate = 1.0
+)
+
+// SetSampleRate sets the probability of a root span being sampled, spans with a parent follow
+// the sampling decision of parent.
+func SetSampleRate(rate float64) {
+	sampleLock.Lock()
+	defer sampleLock.Unlock()
+	sampleRate = rate
+}
+
+func shouldSample() bool {
+	if !hasExporters() {
+		return false
+	}
+
+	sampleLock.RLock()
+	rate := sampleRate
+	sampleLock.RUnlock()
+
+	idLock.Lock()
+	defer idLock.Unlock()
+	return idSource.Float64() < rate
+}
+
+func newIDs(traceID *TraceID, spanID *SpanID) {
+	idLock.Lock()
+	defer idLock.Unlock()
+	if traceID != nil {
+		idSource.Read(traceID[:])
+	}
+	idSource.Read(spanID[:])
+}
+
+// StartSpan starts a span as child of the span or remote span context in ctx, a new trace is
+// started if ctx has no parent. The returned context carries the new span if it is sampled.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	var sampled bool
+	if parent.IsValid() {
+		sampled = parent.Sampled
+	} else {
+		sampled = shouldSample()
+	}
+	if !sampled {
+		return ctx, nil
+	}
+
+	s := &Span{
+		data: SpanData{
+			SpanContext: SpanContext{
+				TraceID: parent.TraceID,
+				Sampled: true,
+			},
+			ParentSpanID: parent.SpanID,
+			Name:         name,
+			StartTime:    time.Now(),
+		},
+	}
+	if parent.IsValid() {
+		newIDs(nil, &s.data.SpanID)
+	} else {
+		newIDs(&s.data.TraceID, &s.data.SpanID)
+	}
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// FromContext returns the span in ctx, nil if not exists.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the context of local span in ctx, or the remote span context
+// if no local span is started yet.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := FromContext(ctx); s != nil {
+		return s.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteSpanContextKey).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx with the span context received from remote,
+// spans started in the returned context are children of the remote span.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteSpanContextKey, sc)
+}
+
+// SpanContext returns the span context to propagate.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttribute sets an attribute of span, value is formatted by fmt.Sprint.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = fmt.Sprint(value)
+}
+
+// SetError marks the span failed if err is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if !s.ended {
+		s.data.Error = err.Error()
+	}
+}
+
+// End finishes the span and passes it to the registered exporters, err is recorded by SetError.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.SetError(err)
+
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.Unlock()
+
+	export(&data)
+}
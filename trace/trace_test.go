@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpan(t *testing.T) {
+	Convey("Given no registered exporter", t, func() {
+		ctx, span := StartSpan(context.Background(), "root")
+		So(span, ShouldBeNil)
+		So(FromContext(ctx), ShouldBeNil)
+
+		// nil span is no-op
+		span.SetAttribute("key", 1)
+		span.End(errors.New("error"))
+		So(span.SpanContext().IsValid(), ShouldBeFalse)
+	})
+
+	Convey("Given a memory exporter", t, func() {
+		e := NewMemoryExporter()
+		RegisterExporter(e)
+		Reset(func() {
+			UnregisterExporter(e)
+			SetSampleRate(1)
+		})
+
+		Convey("The child spans should share trace id of root span", func() {
+			ctx, root := StartSpan(context.Background(), "root")
+			So(root, ShouldNotBeNil)
+			So(FromContext(ctx), ShouldEqual, root)
+
+			cctx, child := StartSpan(ctx, "child")
+			child.SetAttribute("count", 2)
+			_, grandChild := StartSpan(cctx, "grand child")
+			grandChild.End(errors.New("failed"))
+			child.End(nil)
+			root.End(nil)
+			root.End(nil)
+
+			spans := e.Spans()
+			So(spans, ShouldHaveLength, 3)
+			So(spans[0].Name, ShouldEqual, "grand child")
+			So(spans[0].Error, ShouldEqual, "failed")
+			So(spans[0].ParentSpanID, ShouldEqual, child.SpanContext().SpanID)
+			So(spans[1].Attributes["count"], ShouldEqual, "2")
+			So(spans[1].ParentSpanID, ShouldEqual, root.SpanContext().SpanID)
+			So(spans[2].ParentSpanID, ShouldEqual, SpanID{})
+			for _, s := range spans {
+				So(s.TraceID, ShouldEqual, root.SpanContext().TraceID)
+				So(s.EndTime, ShouldHappenOnOrAfter, s.StartTime)
+			}
+			So(e.SpansByName("child"), ShouldHaveLength, 1)
+
+			e.Reset()
+			So(e.Spans(), ShouldBeEmpty)
+		})
+
+		Convey("The span context should be propagated by rpc envelope", func() {
+			ctx, root := StartSpan(context.Background(), "client")
+			var env proto.Envelope
+			InjectEnvelope(context.Background(), &env)
+			So(env.TraceContext.IsValid(), ShouldBeFalse)
+			InjectEnvelope(ctx, &env)
+			So(env.TraceContext.IsValid(), ShouldBeTrue)
+
+			// the remote side does not register exporter, sampling follows the remote parent
+			UnregisterExporter(e)
+			rctx := ContextFromRequest(context.Background(), &env)
+			_, server := StartSpan(rctx, "server")
+			So(server, ShouldNotBeNil)
+			So(server.SpanContext().TraceID, ShouldEqual, root.SpanContext().TraceID)
+			RegisterExporter(e)
+			server.End(nil)
+			So(e.Spans()[0].ParentSpanID, ShouldEqual, root.SpanContext().SpanID)
+
+			So(ContextFromRequest(context.Background(), "not an envelope"), ShouldResemble,
+				context.Background())
+		})
+
+		Convey("The root spans should be sampled by sample rate", func() {
+			SetSampleRate(0)
+			_, span := StartSpan(context.Background(), "root")
+			So(span, ShouldBeNil)
+		})
+	})
+}
@@ -126,8 +126,14 @@ func (c *Coordinator) commit(ctx context.Context, workers []Worker, wb WriteBatc
 
 // Put initiates a 2PC process to apply given WriteBatch on all workers.
 func (c *Coordinator) Put(workers []Worker, wb WriteBatch) (err error) {
+	return c.PutContext(context.Background(), workers, wb)
+}
+
+// PutContext initiates a 2PC process to apply given WriteBatch on all workers, the hooks and
+// workers are called with a timeout context derived from ctx.
+func (c *Coordinator) PutContext(parent context.Context, workers []Worker, wb WriteBatch) (err error) {
 	// Initiate phase one: ask nodes to prepare for progress
-	ctx, cancel := context.WithTimeout(context.Background(), c.option.timeout)
+	ctx, cancel := context.WithTimeout(parent, c.option.timeout)
 	defer cancel()
 
 	if c.option.beforePrepare != nil {
@@ -19,7 +19,6 @@ package worker
 import (
 	"bytes"
 	"context"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,9 +30,12 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/kayak"
 	ka "github.com/CovenantSQL/CovenantSQL/kayak/api"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain/storage"
 	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
+	"github.com/CovenantSQL/CovenantSQL/trace"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
@@ -49,6 +51,9 @@ const (
 
 	// MaxRecordedConnectionSequences defines the max connection slots to anti reply attack.
 	MaxRecordedConnectionSequences = 1000
+
+	// MaxRecordedStateDigests defines the max state digests recorded for peer state checking.
+	MaxRecordedStateDigests = 1000
 )
 
 // Database defines a single database instance in worker runtime.
@@ -61,6 +66,11 @@ type Database struct {
 	connSeqs       sync.Map
 	connSeqEvictCh chan uint64
 	chain          *sqlchain.Chain
+	state          dbState
+	firewallLock   sync.RWMutex
+	firewall       *sqlFirewall
+	peersLock      sync.RWMutex
+	peers          *kayak.Peers
 }
 
 // NewDatabase create a single database instance using config.
@@ -80,6 +90,8 @@ func NewDatabase(cfg *DBConfig, peers *kayak.Peers, genesisBlock *ct.Block) (db
 		cfg:            cfg,
 		dbID:           cfg.DatabaseID,
 		connSeqEvictCh: make(chan uint64, 1),
+		firewall:       newSQLFirewall(&cfg.SQLPolicy),
+		peers:          peers,
 	}
 
 	defer func() {
@@ -142,6 +154,9 @@ func NewDatabase(cfg *DBConfig, peers *kayak.Peers, genesisBlock *ct.Block) (db
 		Period:   60 * time.Second,
 		Tick:     10 * time.Second,
 		QueryTTL: 10,
+
+		// commit database state digest in produced blocks
+		StateTracker: db,
 	}
 	if db.chain, err = sqlchain.NewChain(chainCfg); err != nil {
 		return
@@ -150,7 +165,7 @@ func NewDatabase(cfg *DBConfig, peers *kayak.Peers, genesisBlock *ct.Block) (db
 	}
 
 	// init kayak config
-	options := ka.NewDefaultTwoPCOptions().WithTransportID(string(cfg.DatabaseID))
+	options := ka.NewDefaultTwoPCOptions().WithTransportID(string(cfg.DatabaseID)).WithLogFetcher(db)
 	db.kayakConfig = ka.NewTwoPCConfigWithOptions(cfg.DataDir, cfg.KayakMux, db, options)
 
 	// create kayak runtime
@@ -175,20 +190,89 @@ func (db *Database) UpdatePeers(peers *kayak.Peers) (err error) {
 		return
 	}
 
+	db.peersLock.Lock()
+	db.peers = peers
+	db.peersLock.Unlock()
+
 	return db.chain.UpdatePeers(peers)
 }
 
+// FetchLog implements kayak.LogFetcher.FetchLog.
+func (db *Database) FetchLog(
+	ctx context.Context, peers *kayak.Peers, nodeID proto.NodeID, index uint64) (l *kayak.Log, err error) {
+	req := &wt.FetchLogReq{
+		DatabaseID: db.dbID,
+		Peers:      peers,
+		LogOffset:  index,
+	}
+	resp := new(wt.FetchLogResp)
+	if err = rpc.NewCaller().CallNodeWithContext(ctx, nodeID, route.DBSFetchLog.String(), req, resp); err != nil {
+		return
+	}
+
+	return resp.Log, nil
+}
+
+// GetCommittedLog returns the committed log at offset to the catching up peer. Besides the current
+// peers, the peers joining by a newer peers config signed by the same key are permitted as well.
+func (db *Database) GetCommittedLog(nodeID proto.NodeID, peers *kayak.Peers, offset uint64) (l *kayak.Log, err error) {
+	db.peersLock.RLock()
+	current := db.peers
+	db.peersLock.RUnlock()
+
+	if _, found := current.Find(nodeID); !found {
+		if peers == nil || peers.Term <= current.Term || current.PubKey == nil ||
+			!current.PubKey.IsEqual(peers.PubKey) || !peers.Verify() {
+			return nil, ErrNotPeer
+		}
+		if _, found = peers.Find(nodeID); !found {
+			return nil, ErrNotPeer
+		}
+	}
+
+	return db.kayakRuntime.GetCommittedLog(offset)
+}
+
+// UpdatePolicy defines sql policy update interface.
+func (db *Database) UpdatePolicy(policy *wt.SQLPolicy) {
+	db.firewallLock.Lock()
+	defer db.firewallLock.Unlock()
+	db.firewall = newSQLFirewall(policy)
+}
+
+func (db *Database) getFirewall() *sqlFirewall {
+	db.firewallLock.RLock()
+	defer db.firewallLock.RUnlock()
+	return db.firewall
+}
+
 // Query defines database query interface.
 func (db *Database) Query(request *wt.Request) (response *wt.Response, err error) {
+	if db.state.isDiverged() {
+		return nil, ErrStateDiverged
+	}
+
+	queryType := queryTypeInvalid
+	defer func(start time.Time) { observeQuery(queryType, start, err) }(time.Now())
+
 	if err = request.Verify(); err != nil {
 		return
 	}
 
+	// continue the trace started by client
+	ctx := trace.ContextFromEnvelope(context.Background(), &request.Envelope)
+
 	switch request.Header.QueryType {
 	case wt.ReadQuery:
-		return db.readQuery(request)
+		if request.Payload.WithProof {
+			queryType = queryTypeProvable
+			return db.provableQuery(request)
+		}
+		queryType = queryTypeRead
+		return db.readQuery(ctx, request)
 	case wt.WriteQuery:
-		return db.writeQuery(request)
+		queryType = queryTypeWrite
+		return db.writeQuery(ctx, request)
 	default:
 		// TODO(xq262144): verbose errors with custom error structure
 		return nil, ErrInvalidRequest
@@ -201,7 +285,7 @@ func (db *Database) Ack(ack *wt.Ack) (err error) {
 		return
 	}
 
-	return db.saveAck(&ack.Header)
+	return db.saveAck(trace.ContextFromEnvelope(context.Background(), &ack.Envelope), &ack.Header)
 }
 
 // Shutdown stop database handles and stop service the database.
@@ -221,7 +305,8 @@ func (db *Database) Shutdown() (err error) {
 	}
 
 	if db.storage != nil {
-		// stop storage
+		// release state snapshot and stop storage
+		db.state.setSnapshot(nil)
 		if err = db.storage.Close(); err != nil {
 			return
 		}
@@ -254,7 +339,12 @@ func (db *Database) Destroy() (err error) {
 	return
 }
 
-func (db *Database) writeQuery(request *wt.Request) (response *wt.Response, err error) {
+func (db *Database) writeQuery(ctx context.Context, request *wt.Request) (response *wt.Response, err error) {
+	ctx, span := trace.StartSpan(ctx, "worker.writeQuery")
+	defer func() { span.End(err) }()
+	span.SetAttribute("database", db.dbID)
+	span.SetAttribute("query.count", len(request.Payload.Queries))
+
 	// check database size first, wal/kayak/chain database size is not included
 	if db.cfg.SpaceLimit > 0 {
 		path := filepath.Join(db.cfg.DataDir, StorageFileName)
@@ -272,6 +362,15 @@ func (db *Database) writeQuery(request *wt.Request) (response *wt.Response, err
 		}
 	}
 
+	// reject non-deterministic and firewall denied queries before replication
+	if _, err = convertAndSanitizeQuery(request.Payload.Queries, newWriteContext(&storage.ExecLog{
+		ConnectionID: request.Header.ConnectionID,
+		SeqNo:        request.Header.SeqNo,
+		Timestamp:    request.Header.Timestamp.UnixNano(),
+	}), db.getFirewall()); err != nil {
+		return
+	}
+
 	// call kayak runtime Process
 	var buf *bytes.Buffer
 	if buf, err = utils.EncodeMsgPack(request); err != nil {
@@ -279,7 +378,7 @@ func (db *Database) writeQuery(request *wt.Request) (response *wt.Response, err
 	}
 
 	var logOffset uint64
-	logOffset, err = db.kayakRuntime.Apply(buf.Bytes())
+	logOffset, err = db.kayakRuntime.ApplyContext(ctx, buf.Bytes())
 
 	if err != nil {
 		return
@@ -288,7 +387,12 @@ func (db *Database) writeQuery(request *wt.Request) (response *wt.Response, err
 	return db.buildQueryResponse(request, logOffset, []string{}, []string{}, [][]interface{}{})
 }
 
-func (db *Database) readQuery(request *wt.Request) (response *wt.Response, err error) {
+func (db *Database) readQuery(ctx context.Context, request *wt.Request) (response *wt.Response, err error) {
+	ctx, span := trace.StartSpan(ctx, "worker.readQuery")
+	defer func() { span.End(err) }()
+	span.SetAttribute("database", db.dbID)
+	span.SetAttribute("query.count", len(request.Payload.Queries))
+
 	// call storage query directly
 	// TODO(xq262144): add timeout logic basic of client options
 	var columns, types []string
@@ -296,11 +400,11 @@ func (db *Database) readQuery(request *wt.Request) (response *wt.Response, err e
 	var queries []storage.Query
 
 	// sanitize dangerous queries
-	if queries, err = convertAndSanitizeQuery(request.Payload.Queries); err != nil {
+	if queries, err = convertAndSanitizeQuery(request.Payload.Queries, nil, db.getFirewall()); err != nil {
 		return
 	}
 
-	columns, types, data, err = db.storage.Query(context.Background(), queries)
+	columns, types, data, err = db.storage.Query(ctx, queries)
 	if err != nil {
 		return
 	}
@@ -310,12 +414,16 @@ func (db *Database) readQuery(request *wt.Request) (response *wt.Response, err e
 
 func (db *Database) buildQueryResponse(request *wt.Request, offset uint64,
 	columns []string, types []string, data [][]interface{}) (response *wt.Response, err error) {
+	response = newQueryResponse(request, offset, columns, types, data)
+	err = db.signAndSaveResponse(response)
+	return
+}
+
+func newQueryResponse(request *wt.Request, offset uint64,
+	columns []string, types []string, data [][]interface{}) (response *wt.Response) {
 	// build response
 	response = new(wt.Response)
 	response.Header.Request = request.Header
-	if response.Header.NodeID, err = kms.GetLocalNodeID(); err != nil {
-		return
-	}
 	response.Header.LogOffset = offset
 	response.Header.Timestamp = getLocalTime()
 	response.Header.RowCount = uint64(len(data))
@@ -329,12 +437,20 @@ func (db *Database) buildQueryResponse(request *wt.Request, offset uint64,
 		response.Payload.Rows[i].Values = d
 	}
 
+	return
+}
+
+func (db *Database) signAndSaveResponse(response *wt.Response) (err error) {
+	if response.Header.NodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+
 	// sign fields
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = getLocalPrivateKey(); err != nil {
+	var signer kms.Signer
+	if signer, err = getLocalSigner(); err != nil {
 		return
 	}
-	if err = response.Sign(privateKey); err != nil {
+	if err = response.Sign(signer); err != nil {
 		return
 	}
 
@@ -347,8 +463,8 @@ func (db *Database) saveResponse(respHeader *wt.SignedResponseHeader) (err error
 	return db.chain.VerifyAndPushResponsedQuery(respHeader)
 }
 
-func (db *Database) saveAck(ackHeader *wt.SignedAckHeader) (err error) {
-	return db.chain.VerifyAndPushAckedQuery(ackHeader)
+func (db *Database) saveAck(ctx context.Context, ackHeader *wt.SignedAckHeader) (err error) {
+	return db.chain.VerifyAndPushAckedQuery(ctx, ackHeader)
 }
 
 func getLocalTime() time.Time {
@@ -359,34 +475,42 @@ func getLocalPubKey() (pubKey *asymmetric.PublicKey, err error) {
 	return kms.GetLocalPublicKey()
 }
 
-func getLocalPrivateKey() (privateKey *asymmetric.PrivateKey, err error) {
-	return kms.GetLocalPrivateKey()
+func getLocalSigner() (signer kms.Signer, err error) {
+	return kms.GetLocalSigner()
 }
 
-func convertAndSanitizeQuery(inQuery []wt.Query) (outQuery []storage.Query, err error) {
+// convertAndSanitizeQuery translates the queries to sqlite dialect, the non-deterministic functions
+// are rewritten or rejected if the write context of replicated writes is provided, the statements
+// are checked by the sql firewall if provided.
+func convertAndSanitizeQuery(inQuery []wt.Query, wc *writeContext, fw *sqlFirewall) (outQuery []storage.Query, err error) {
 	outQuery = make([]storage.Query, len(inQuery))
+	var count int
 	for i, q := range inQuery {
-		tokenizer := sqlparser.NewStringTokenizer(q.Pattern)
-		var stmt sqlparser.Statement
-		var lastPos int
-		var query string
+		var statements []string
+		var tokens [][]sqlToken
 		var originalQueries []string
 
-		for {
-			stmt, err = sqlparser.ParseNext(tokenizer)
+		if statements, tokens, err = splitStatements(q.Pattern); err != nil {
+			return
+		}
 
-			if err != nil && err != io.EOF {
-				return
+		for j, query := range statements {
+			// check the original statement before translation
+			count++
+			if fw != nil {
+				if err = fw.check(query, tokens[j], count); err != nil {
+					return
+				}
 			}
 
-			if err == io.EOF {
-				err = nil
-				break
+			// statements not supported by parser are checked by firewall already
+			var stmt sqlparser.Statement
+			if rawStatementClass(tokens[j]) == "" {
+				if stmt, err = parseStatement(query); err != nil {
+					return
+				}
 			}
 
-			query = q.Pattern[lastPos : tokenizer.Position-1]
-			lastPos = tokenizer.Position + 1
-
 			// translate show statement
 			if showStmt, ok := stmt.(*sqlparser.Show); ok {
 				origQuery := query
@@ -409,6 +533,18 @@ func convertAndSanitizeQuery(inQuery []wt.Query) (outQuery []storage.Query, err
 				log.Debugf("translated query from %v to %v", origQuery, query)
 			}
 
+			// rewrite non-deterministic functions of replicated writes
+			if wc != nil {
+				origQuery := query
+				if query, err = wc.rewrite(stmt, query); err != nil {
+					return
+				}
+
+				if query != origQuery {
+					log.Debugf("translated query from %v to %v", origQuery, query)
+				}
+			}
+
 			originalQueries = append(originalQueries, query)
 		}
 
@@ -419,3 +555,46 @@ func convertAndSanitizeQuery(inQuery []wt.Query) (outQuery []storage.Query, err
 	}
 	return
 }
+
+// parseStatement parses the statement with the sql parser, which supports the mysql dialect only,
+// the sqlite conflict clauses of insert statements, INSERT OR <resolution> and the ON CONFLICT upsert
+// clause, are stripped before parsing, the original statement is executed as is.
+func parseStatement(query string) (stmt sqlparser.Statement, err error) {
+	var tokens []sqlToken
+	if tokens, err = scanTokens(query); err != nil {
+		return
+	}
+
+	isWord := func(i int, word string) bool {
+		return i < len(tokens) && tokens[i].typ != sqlparser.STRING && strings.EqualFold(tokens[i].val, word)
+	}
+
+	if !isWord(0, "insert") {
+		return sqlparser.Parse(query)
+	}
+
+	var edits []queryEdit
+	if isWord(1, "or") {
+		for _, resolution := range []string{"ignore", "abort", "fail", "rollback"} {
+			if isWord(2, resolution) {
+				edits = append(edits, queryEdit{start: tokens[1].start, end: tokens[2].end})
+				break
+			}
+		}
+	}
+
+	var depth int
+	for i, t := range tokens {
+		if t.typ == '(' {
+			depth++
+		} else if t.typ == ')' {
+			depth--
+		} else if depth == 0 && isWord(i, "on") && isWord(i+1, "conflict") &&
+			(isWord(i+2, "do") || (i+2 < len(tokens) && tokens[i+2].typ == '(')) {
+			edits = append(edits, queryEdit{start: t.start, end: len(query)})
+			break
+		}
+	}
+
+	return sqlparser.Parse(applyEdits(query, edits))
+}
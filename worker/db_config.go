@@ -22,6 +22,7 @@ import (
 	kt "github.com/CovenantSQL/CovenantSQL/kayak/transport"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
 )
 
 // DBConfig defines the database config.
@@ -33,4 +34,5 @@ type DBConfig struct {
 	MaxWriteTimeGap time.Duration
 	EncryptionKey   string
 	SpaceLimit      uint64
+	SQLPolicy       wt.SQLPolicy
 }
@@ -0,0 +1,301 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/sqlchain/storage"
+	"github.com/CovenantSQL/sqlparser"
+)
+
+// Following contains the determinism check of replicated writes. Write queries are re-executed on
+// each replica, so the non-deterministic functions are rewritten with values chosen from the write
+// log itself, or rejected if they could not be rewritten.
+
+var (
+	// timeFunctions are the date and time functions of sqlite which read the current time via
+	// the 'now' argument.
+	timeFunctions = map[string]bool{
+		"date":      true,
+		"time":      true,
+		"datetime":  true,
+		"julianday": true,
+		"strftime":  true,
+	}
+
+	// rejectedFunctions are the non-deterministic functions which could not be rewritten.
+	rejectedFunctions = map[string]bool{
+		"randomblob":        true,
+		"last_insert_rowid": true,
+		"changes":           true,
+		"total_changes":     true,
+	}
+
+	// rejectedTimeModifiers are the time modifiers depending on the local timezone of replicas.
+	rejectedTimeModifiers = map[string]bool{
+		"localtime": true,
+		"utc":       true,
+	}
+
+	// tablePrefixKeywords are the keywords followed by a table name instead of a function name.
+	tablePrefixKeywords = map[string]bool{
+		"into":       true,
+		"table":      true,
+		"exists":     true,
+		"on":         true,
+		"references": true,
+	}
+)
+
+const (
+	// nowTimeFormat is the time format of the rewritten 'now' argument of time functions.
+	nowTimeFormat = "2006-01-02 15:04:05.000"
+)
+
+// writeContext provides the values chosen by the write log for rewriting non-deterministic
+// functions, so all replicas execute the same rewritten queries.
+type writeContext struct {
+	timestamp time.Time
+	random    *rand.Rand
+}
+
+func newWriteContext(l *storage.ExecLog) *writeContext {
+	return &writeContext{
+		timestamp: time.Unix(0, l.Timestamp).UTC(),
+		random:    rand.New(rand.NewSource(l.Timestamp ^ int64(l.ConnectionID<<32) ^ int64(l.SeqNo))),
+	}
+}
+
+// sqlToken defines a token of query, the span includes the blanks and comments before the token.
+type sqlToken struct {
+	typ        int
+	val        string
+	start, end int
+}
+
+type queryEdit struct {
+	start, end int
+	text       string
+}
+
+func scanTokens(query string) (tokens []sqlToken, err error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	var lastEnd int
+
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 {
+			return
+		}
+		if typ == sqlparser.LEX_ERROR {
+			err = fmt.Errorf("syntax error near '%s'", val)
+			return
+		}
+
+		end := tokenizer.Position - 1
+		if end > len(query) {
+			end = len(query)
+		}
+		if typ != sqlparser.COMMENT {
+			tokens = append(tokens, sqlToken{typ: typ, val: string(val), start: lastEnd, end: end})
+		}
+		lastEnd = end
+	}
+}
+
+// isFunctionCall returns whether the i-th token is the name of a function call.
+func isFunctionCall(tokens []sqlToken, i int) bool {
+	if i < 0 || i+1 >= len(tokens) || tokens[i+1].typ != '(' ||
+		tokens[i].val == "" || tokens[i].typ == sqlparser.STRING {
+		return false
+	}
+	return i == 0 || !tablePrefixKeywords[strings.ToLower(tokens[i-1].val)]
+}
+
+// rewrite checks the statement and rewrites non-deterministic functions in the query text.
+func (wc *writeContext) rewrite(stmt sqlparser.Statement, query string) (out string, err error) {
+	if !isDeterministicStatement(stmt) {
+		err = ErrNonDeterministicQuery
+		return
+	}
+
+	var tokens []sqlToken
+	if tokens, err = scanTokens(query); err != nil {
+		return
+	}
+
+	var (
+		funcs []string
+		edits []queryEdit
+	)
+	now := "'" + wc.timestamp.Format(nowTimeFormat) + "'"
+	top := func() string {
+		if len(funcs) == 0 {
+			return ""
+		}
+		return funcs[len(funcs)-1]
+	}
+
+	for i, t := range tokens {
+		switch t.typ {
+		case '(':
+			var name string
+			if isFunctionCall(tokens, i-1) {
+				name = strings.ToLower(tokens[i-1].val)
+			}
+			if rejectedFunctions[name] {
+				err = ErrNonDeterministicQuery
+				return
+			}
+			funcs = append(funcs, name)
+		case ')':
+			name := top()
+			if len(funcs) > 0 {
+				funcs = funcs[:len(funcs)-1]
+			}
+			if i == 0 || tokens[i-1].typ != '(' {
+				continue
+			}
+			if name == "random" {
+				// the whole random() call is replaced by a seeded random integer, which is a
+				// constant of the statement, so it's only allowed in single row statements
+				if !isSingleRowStatement(stmt) {
+					err = ErrNonDeterministicQuery
+					return
+				}
+				v := int64(wc.random.Uint64())
+				if v == math.MinInt64 {
+					v = math.MaxInt64
+				}
+				edits = append(edits, queryEdit{
+					start: tokens[i-2].start, end: t.end, text: fmt.Sprintf(" (%d)", v)})
+			} else if timeFunctions[name] && name != "strftime" {
+				// time functions without arguments read the current time
+				edits = append(edits, queryEdit{start: t.start, end: t.end, text: now + ")"})
+			}
+		case sqlparser.STRING:
+			if !timeFunctions[top()] {
+				continue
+			}
+			if v := strings.ToLower(t.val); v == "now" {
+				edits = append(edits, queryEdit{start: t.start, end: t.end, text: " " + now})
+			} else if rejectedTimeModifiers[v] {
+				err = ErrNonDeterministicQuery
+				return
+			}
+		case sqlparser.CURRENT_TIMESTAMP:
+			edits = append(edits, queryEdit{
+				start: t.start, end: t.end, text: " '" + wc.timestamp.Format("2006-01-02 15:04:05") + "'"})
+		case sqlparser.CURRENT_DATE:
+			edits = append(edits, queryEdit{
+				start: t.start, end: t.end, text: " '" + wc.timestamp.Format("2006-01-02") + "'"})
+		case sqlparser.CURRENT_TIME:
+			edits = append(edits, queryEdit{
+				start: t.start, end: t.end, text: " '" + wc.timestamp.Format("15:04:05") + "'"})
+		}
+	}
+
+	if len(edits) == 0 {
+		return query, nil
+	}
+
+	// rewriting defaults or triggers changes the semantics of schema, reject instead
+	if _, ok := stmt.(*sqlparser.DDL); ok {
+		err = ErrNonDeterministicQuery
+		return
+	}
+
+	return applyEdits(query, edits), nil
+}
+
+// applyEdits replaces the query spans in order.
+func applyEdits(query string, edits []queryEdit) string {
+	var buf strings.Builder
+	var pos int
+	for _, e := range edits {
+		buf.WriteString(query[pos:e.start])
+		buf.WriteString(e.text)
+		pos = e.end
+	}
+	buf.WriteString(query[pos:])
+
+	return buf.String()
+}
+
+// isDeterministicStatement checks the row order dependent writes.
+func isDeterministicStatement(stmt sqlparser.Statement) bool {
+	switch s := stmt.(type) {
+	case *sqlparser.Insert:
+		// rowids are assigned in the order of selected rows
+		return isOrderedRows(s.Rows)
+	case *sqlparser.Update:
+		return s.Limit == nil || len(s.OrderBy) > 0
+	case *sqlparser.Delete:
+		return s.Limit == nil || len(s.OrderBy) > 0
+	default:
+		return true
+	}
+}
+
+// isSingleRowStatement returns whether the statement evaluates its expressions for one row only,
+// the insert of a single values row or a select without from clause, which contains no subquery.
+func isSingleRowStatement(stmt sqlparser.Statement) bool {
+	s, ok := stmt.(*sqlparser.Insert)
+	if !ok {
+		return false
+	}
+	switch r := s.Rows.(type) {
+	case sqlparser.Values:
+		if len(r) != 1 {
+			return false
+		}
+	case *sqlparser.Select:
+		if len(r.From) != 0 {
+			return false
+		}
+	default:
+		return false
+	}
+	var hasSubquery bool
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if _, ok := node.(*sqlparser.Subquery); ok {
+			hasSubquery = true
+			return false, nil
+		}
+		return true, nil
+	}, s.Rows, s.OnDup)
+	return !hasSubquery
+}
+
+func isOrderedRows(rows sqlparser.InsertRows) bool {
+	switch r := rows.(type) {
+	case *sqlparser.Select:
+		// select without from clause returns exactly one row
+		return len(r.OrderBy) > 0 || len(r.From) == 0
+	case *sqlparser.Union:
+		return len(r.OrderBy) > 0
+	case *sqlparser.ParenSelect:
+		return isOrderedRows(r.Select)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"strings"
+
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// Following contains the sql firewall of database, which checks the statements of client requests
+// against the sql policy configured by the database owner through block producer.
+
+var (
+	// rawStatementClasses maps the leading keywords of statements which are not supported by the sql
+	// parser to their classes, these statements are passed to storage as is if allowed by policy.
+	rawStatementClasses = map[string]string{
+		"attach": wt.StatementClassAttach,
+		"detach": wt.StatementClassAttach,
+		"pragma": wt.StatementClassPragma,
+		"vacuum": wt.StatementClassVacuum,
+	}
+)
+
+// sqlFirewall defines the compiled sql policy of database.
+type sqlFirewall struct {
+	classes       map[string]bool
+	allowList     map[string]bool
+	maxStatements uint32
+}
+
+func newSQLFirewall(p *wt.SQLPolicy) (f *sqlFirewall) {
+	f = &sqlFirewall{
+		classes:       make(map[string]bool, len(p.AllowedClasses)),
+		maxStatements: p.MaxStatements,
+	}
+	for _, c := range p.AllowedClasses {
+		f.classes[c] = true
+	}
+	if len(p.AllowList) > 0 {
+		f.allowList = make(map[string]bool, len(p.AllowList))
+		for _, q := range p.AllowList {
+			// policies are validated by block producer, fingerprint again in case of raw statements
+			if fp, err := wt.Fingerprint(q); err == nil {
+				f.allowList[fp] = true
+			}
+		}
+	}
+	return
+}
+
+// check checks the n-th statement of request, the statement is denied if it belongs to a dangerous
+// class not allowed explicitly, or is not in the allow-list if the list is not empty.
+func (f *sqlFirewall) check(query string, tokens []sqlToken, n int) (err error) {
+	if f.maxStatements > 0 && n > int(f.maxStatements) {
+		return errors.Wrapf(ErrTooManyStatements, "limit %d", f.maxStatements)
+	}
+
+	if class := statementClass(tokens); class != "" && !f.classes[class] {
+		return errors.Wrapf(ErrStatementDenied, "class %s", class)
+	}
+
+	if f.allowList == nil {
+		return
+	}
+
+	var fp string
+	if fp, err = wt.Fingerprint(query); err != nil {
+		return
+	}
+	if !f.allowList[fp] {
+		return errors.Wrapf(ErrStatementNotAllowed, "fingerprint %s", fp)
+	}
+
+	return
+}
+
+// statementClass returns the dangerous class of statement, or empty string for other statements.
+func statementClass(tokens []sqlToken) string {
+	if class := rawStatementClass(tokens); class != "" {
+		return class
+	}
+	for i := range tokens {
+		if isFunctionCall(tokens, i) && strings.ToLower(tokens[i].val) == "load_extension" {
+			return wt.StatementClassExtension
+		}
+	}
+	return ""
+}
+
+func rawStatementClass(tokens []sqlToken) string {
+	if len(tokens) == 0 || tokens[0].typ == sqlparser.STRING {
+		return ""
+	}
+	return rawStatementClasses[strings.ToLower(tokens[0].val)]
+}
+
+// splitStatements splits the query to statements by semicolons, the empty statements are skipped.
+func splitStatements(query string) (statements []string, tokens [][]sqlToken, err error) {
+	var all []sqlToken
+	if all, err = scanTokens(query); err != nil {
+		return
+	}
+
+	var start, first int
+	appendStatement := func(end, last int) {
+		if first < last {
+			statements = append(statements, strings.TrimSpace(query[start:end]))
+			tokens = append(tokens, all[first:last])
+		}
+	}
+
+	for i, t := range all {
+		if t.typ != ';' {
+			continue
+		}
+		// the semicolon is the last character of token span
+		appendStatement(t.end-1, i)
+		start, first = t.end, i+1
+	}
+	appendStatement(len(query), len(all))
+
+	return
+}
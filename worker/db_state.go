@@ -0,0 +1,484 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain/storage"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
+	"github.com/CovenantSQL/sqlparser"
+)
+
+// Following contains the authenticated data structure of database state, see worker/types/proof.go
+// for the tree layout.
+
+var (
+	// withoutRowIDRegex matches tables created WITHOUT ROWID, which are keyed by primary key.
+	withoutRowIDRegex = regexp.MustCompile("(?is)\\bWITHOUT\\s+ROWID\\b")
+)
+
+// tableTree defines the merkle tree over rows of a table. Rows are ordered by rowid, or by primary
+// key for WITHOUT ROWID tables, which are covered by the state root but not provable.
+type tableTree struct {
+	name         string
+	index        uint64
+	tree         *merkle.Merkle
+	rows         map[int64]uint64
+	withoutRowID bool
+}
+
+// stateTree defines the merkle tree over all tables of the database.
+type stateTree struct {
+	root   hash.Hash
+	tree   *merkle.Merkle
+	tables map[string]*tableTree
+}
+
+// stateSnapshot defines the database state pinned for the last produced block, query result
+// proofs are served from it against the state root committed in the block.
+type stateSnapshot struct {
+	tree    *stateTree
+	storage *storage.Snapshot
+}
+
+// dbState caches the state tree until the next write commit. Building the tree scans the whole
+// database, so it's only built on demand, which is at most once per block in normal: when the
+// block is produced or advised by the other peer. The state digest is recorded whenever the tree
+// is built.
+//
+// Note that the tree is rebuilt from scratch instead of updated incrementally, so each block with
+// writes costs a full scan of every table, which grows linearly with the database size.
+type dbState struct {
+	// commitLock orders state tree building and provable reads against storage commits.
+	commitLock sync.RWMutex
+	// cacheLock protects the cached tree.
+	cacheLock sync.Mutex
+	cache     *stateTree
+
+	// digestLock protects following digest-relative fields.
+	digestLock sync.Mutex
+	// lastLog is the hash of the last applied write log.
+	lastLog hash.Hash
+	// digests maps recent write logs to the state roots right after applying them, only the logs
+	// after which the state tree is built are recorded.
+	digests     map[hash.Hash]hash.Hash
+	digestOrder []hash.Hash
+	// diverged is set if the local state disagrees with the majority of peers.
+	diverged bool
+
+	// snapshotLock protects the snapshot from being released during provable reads.
+	snapshotLock sync.RWMutex
+	snapshot     *stateSnapshot
+}
+
+func (s *dbState) invalidate() {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+	s.cache = nil
+}
+
+func (s *dbState) setLastLog(log hash.Hash) {
+	s.digestLock.Lock()
+	defer s.digestLock.Unlock()
+	s.lastLog = log
+}
+
+func (s *dbState) recordDigest(root hash.Hash) {
+	s.digestLock.Lock()
+	defer s.digestLock.Unlock()
+
+	if s.digests == nil {
+		s.digests = make(map[hash.Hash]hash.Hash)
+	}
+	if _, ok := s.digests[s.lastLog]; !ok {
+		s.digestOrder = append(s.digestOrder, s.lastLog)
+	}
+	s.digests[s.lastLog] = root
+
+	// evict the oldest digests
+	for len(s.digestOrder) > MaxRecordedStateDigests {
+		delete(s.digests, s.digestOrder[0])
+		s.digestOrder = s.digestOrder[1:]
+	}
+}
+
+func (s *dbState) isDiverged() bool {
+	s.digestLock.Lock()
+	defer s.digestLock.Unlock()
+	return s.diverged
+}
+
+// loadStateTree returns the cached state tree or builds a new one, commitLock must be held.
+func (db *Database) loadStateTree() (st *stateTree, err error) {
+	db.state.cacheLock.Lock()
+	defer db.state.cacheLock.Unlock()
+
+	if db.state.cache != nil {
+		return db.state.cache, nil
+	}
+
+	if st, err = buildStateTree(db.storage); err != nil {
+		return
+	}
+
+	db.state.cache = st
+	db.state.recordDigest(st.root)
+	return
+}
+
+func buildStateTree(st *storage.Storage) (s *stateTree, err error) {
+	var data [][]interface{}
+	if _, _, data, err = st.Query(context.Background(), []storage.Query{{
+		Pattern: "SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\'",
+	}}); err != nil {
+		return
+	}
+
+	var (
+		names        []string
+		withoutRowID = make(map[string]bool, len(data))
+	)
+	for _, row := range data {
+		if len(row) < 2 {
+			continue
+		}
+		name := toString(row[0])
+		names = append(names, name)
+		withoutRowID[name] = withoutRowIDRegex.MatchString(toString(row[1]))
+	}
+	sort.Strings(names)
+
+	s = &stateTree{
+		tables: make(map[string]*tableTree, len(names)),
+	}
+	leaves := make([]*hash.Hash, 0, len(names))
+
+	for i, name := range names {
+		var t *tableTree
+		if t, err = buildTableTree(st, name, withoutRowID[name]); err != nil {
+			return
+		}
+		t.index = uint64(i)
+		s.tables[strings.ToLower(name)] = t
+
+		leaf := wt.TableHash(name, t.tree.GetRoot())
+		leaves = append(leaves, &leaf)
+	}
+
+	s.tree = merkle.NewMerkle(leaves)
+	s.root = *s.tree.GetRoot()
+	return
+}
+
+func buildTableTree(st *storage.Storage, name string, withoutRowID bool) (t *tableTree, err error) {
+	pattern := "SELECT rowid, * FROM " + quoteIdentifier(name) + " ORDER BY rowid"
+	if withoutRowID {
+		var keys []string
+		if keys, err = primaryKeyColumns(st, name); err != nil {
+			return
+		}
+		pattern = "SELECT * FROM " + quoteIdentifier(name) + " ORDER BY " + strings.Join(keys, ", ")
+	}
+
+	var data [][]interface{}
+	if _, _, data, err = st.Query(context.Background(), []storage.Query{{
+		Pattern: pattern,
+	}}); err != nil {
+		return
+	}
+
+	t = &tableTree{
+		name:         name,
+		rows:         make(map[int64]uint64, len(data)),
+		withoutRowID: withoutRowID,
+	}
+	leaves := make([]*hash.Hash, len(data))
+
+	for i, row := range data {
+		var h hash.Hash
+		if h, err = wt.RowHash(row); err != nil {
+			return
+		}
+		leaves[i] = &h
+
+		if withoutRowID {
+			continue
+		}
+		rowID, ok := row[0].(int64)
+		if !ok {
+			err = ErrInvalidStateTree
+			return
+		}
+		t.rows[rowID] = uint64(i)
+	}
+
+	t.tree = merkle.NewMerkle(leaves)
+	return
+}
+
+// primaryKeyColumns returns the quoted primary key columns of the table in key order.
+func primaryKeyColumns(st *storage.Storage, name string) (keys []string, err error) {
+	var data [][]interface{}
+	if _, _, data, err = st.Query(context.Background(), []storage.Query{{
+		Pattern: "PRAGMA table_info(" + quoteIdentifier(name) + ")",
+	}}); err != nil {
+		return
+	}
+
+	// table_info returns cid, name, type, notnull, dflt_value, pk
+	type keyColumn struct {
+		name string
+		pk   int64
+	}
+	var columns []keyColumn
+	for _, row := range data {
+		if len(row) < 6 {
+			err = ErrInvalidStateTree
+			return
+		}
+		if pk, ok := row[5].(int64); ok && pk > 0 {
+			columns = append(columns, keyColumn{name: toString(row[1]), pk: pk})
+		}
+	}
+	if len(columns) == 0 {
+		err = ErrInvalidStateTree
+		return
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].pk < columns[j].pk })
+
+	keys = make([]string, len(columns))
+	for i, c := range columns {
+		keys[i] = quoteIdentifier(c.name)
+	}
+	return
+}
+
+// StateRoot returns the root of current database state.
+func (db *Database) StateRoot() (root hash.Hash, err error) {
+	db.state.commitLock.RLock()
+	defer db.state.commitLock.RUnlock()
+
+	var st *stateTree
+	if st, err = db.loadStateTree(); err != nil {
+		return
+	}
+
+	return st.root, nil
+}
+
+// commitStateDigest drops the outdated state tree after applying the write log, commitLock must
+// be held. The tree is rebuilt on demand, so writes don't pay for scanning the whole database.
+func (db *Database) commitStateDigest(wb []byte) {
+	db.state.invalidate()
+	db.state.setLastLog(hash.THashH(wb))
+}
+
+// SnapshotState implements sqlchain.StateTracker.SnapshotState, the previous snapshot is released.
+func (db *Database) SnapshotState() (lastLog hash.Hash, root hash.Hash, err error) {
+	db.state.commitLock.RLock()
+	defer db.state.commitLock.RUnlock()
+
+	var st *stateTree
+	if st, err = db.loadStateTree(); err != nil {
+		return
+	}
+
+	var ss *storage.Snapshot
+	if ss, err = db.storage.Snapshot(); err != nil {
+		return
+	}
+	db.state.setSnapshot(&stateSnapshot{tree: st, storage: ss})
+
+	db.state.digestLock.Lock()
+	defer db.state.digestLock.Unlock()
+	return db.state.lastLog, st.root, nil
+}
+
+// setSnapshot replaces the snapshot and releases the previous one, a nil snapshot only releases.
+func (s *dbState) setSnapshot(snapshot *stateSnapshot) {
+	s.snapshotLock.Lock()
+	defer s.snapshotLock.Unlock()
+	if s.snapshot != nil {
+		s.snapshot.storage.Close()
+	}
+	s.snapshot = snapshot
+}
+
+// LookupStateRoot implements sqlchain.StateTracker.LookupStateRoot. The state tree is built if
+// lastLog is the last applied write log, the roots after the former logs are known only if the
+// tree was built at that time.
+func (db *Database) LookupStateRoot(lastLog hash.Hash) (root hash.Hash, ok bool) {
+	db.state.commitLock.RLock()
+	defer db.state.commitLock.RUnlock()
+
+	db.state.digestLock.Lock()
+	root, ok = db.state.digests[lastLog]
+	current := db.state.lastLog.IsEqual(&lastLog)
+	db.state.digestLock.Unlock()
+	if ok || !current {
+		return
+	}
+
+	st, err := db.loadStateTree()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"db": db.dbID,
+		}).WithError(err).Error("build state tree failed")
+		return
+	}
+	return st.root, true
+}
+
+// StateDiverged implements sqlchain.StateTracker.StateDiverged, the database stops serving queries.
+func (db *Database) StateDiverged(lastLog hash.Hash, local hash.Hash, majority hash.Hash) {
+	log.WithFields(log.Fields{
+		"db":       db.dbID,
+		"log":      lastLog.String(),
+		"local":    local.String(),
+		"majority": majority.String(),
+	}).Error("database state diverged from the majority of peers, stop serving")
+
+	db.state.digestLock.Lock()
+	defer db.state.digestLock.Unlock()
+	db.state.diverged = true
+}
+
+// provableQuery executes a single table read query on the state snapshot of the last produced
+// block, and returns the whole matched rows along with their inclusion proofs against the state
+// root committed in the block. The client projects the requested columns after verification.
+func (db *Database) provableQuery(request *wt.Request) (response *wt.Response, err error) {
+	var table string
+	var query storage.Query
+	if _, err = convertAndSanitizeQuery(request.Payload.Queries, nil, db.getFirewall()); err != nil {
+		return
+	}
+	if table, query, err = convertProvableQuery(request.Payload.Queries); err != nil {
+		return
+	}
+
+	db.state.snapshotLock.RLock()
+	defer db.state.snapshotLock.RUnlock()
+
+	if db.state.snapshot == nil {
+		err = ErrNoStateSnapshot
+		return
+	}
+	st := db.state.snapshot.tree
+
+	t, ok := st.tables[strings.ToLower(table)]
+	if !ok || t.withoutRowID {
+		err = wt.ErrUnprovableQuery
+		return
+	}
+
+	var tablePath []hash.Hash
+	if tablePath, err = st.tree.GetProof(t.index); err != nil {
+		return
+	}
+
+	var columns, types []string
+	var data [][]interface{}
+	if columns, types, data, err = db.state.snapshot.storage.Query(
+		context.Background(), []storage.Query{query}); err != nil {
+		return
+	}
+
+	proofs := make([]wt.RowProof, len(data))
+	for i, row := range data {
+		rowID, ok := row[0].(int64)
+		if !ok {
+			err = ErrInvalidStateTree
+			return
+		}
+		index, ok := t.rows[rowID]
+		if !ok {
+			err = ErrInvalidStateTree
+			return
+		}
+		proofs[i] = wt.RowProof{
+			Table:      t.name,
+			TableIndex: t.index,
+			TablePath:  tablePath,
+			RowIndex:   index,
+		}
+		if proofs[i].RowPath, err = t.tree.GetProof(index); err != nil {
+			return
+		}
+	}
+
+	response = newQueryResponse(request, 0, columns, types, data)
+	response.Header.StateRoot = st.root
+	response.Payload.Proofs = proofs
+	err = db.signAndSaveResponse(response)
+	return
+}
+
+// convertProvableQuery rewrites a single table select query to return whole rows ordered by rowid.
+func convertProvableQuery(inQuery []wt.Query) (table string, outQuery storage.Query, err error) {
+	if len(inQuery) != 1 {
+		err = wt.ErrUnprovableQuery
+		return
+	}
+
+	var sel *sqlparser.Select
+	if sel, table, _, err = wt.ParseProvableQuery(inQuery[0].Pattern); err != nil {
+		return
+	}
+
+	rowID := &sqlparser.ColName{Name: sqlparser.NewColIdent("rowid")}
+	sel.SelectExprs = sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: rowID}, &sqlparser.StarExpr{}}
+	sel.OrderBy = sqlparser.OrderBy{&sqlparser.Order{Expr: rowID, Direction: sqlparser.AscScr}}
+
+	// positional arguments are formatted as :v1, :v2... by the parser
+	outQuery.Pattern = sqlparser.String(sel)
+	outQuery.Args = make([]sql.NamedArg, len(inQuery[0].Args))
+	var pos int
+	for i, arg := range inQuery[0].Args {
+		if arg.Name == "" {
+			pos++
+			arg.Name = fmt.Sprintf("v%d", pos)
+		}
+		outQuery.Args[i] = arg
+	}
+
+	return
+}
+
+func quoteIdentifier(name string) string {
+	return "\"" + strings.Replace(name, "\"", "\"\"", -1) + "\""
+}
+
+func toString(v interface{}) string {
+	switch d := v.(type) {
+	case string:
+		return d
+	case []byte:
+		return string(d)
+	default:
+		return ""
+	}
+}
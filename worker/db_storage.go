@@ -46,6 +46,11 @@ func (db *Database) Commit(ctx context.Context, wb twopc.WriteBatch) (err error)
 		return
 	}
 	db.recordSequence(log)
+
+	// block state tree building during commit, the outdated state tree is dropped after commit
+	db.state.commitLock.Lock()
+	defer db.state.commitLock.Unlock()
+	defer db.commitStateDigest(wb.([]byte))
 	return db.storage.Commit(ctx, log)
 }
 
@@ -80,24 +85,50 @@ func (db *Database) verifySequence(log *storage.ExecLog) (err error) {
 	return
 }
 
-func (db *Database) convertRequest(wb twopc.WriteBatch) (log *storage.ExecLog, err error) {
-	var ok bool
+// Replay implements kayak.LogReplayer.Replay, the committed logs fetched on catching up are applied
+// without checking the request timestamp, which is checked on proposing already.
+func (db *Database) Replay(ctx context.Context, data []byte) (err error) {
+	var req *wt.Request
+	if req, err = decodeRequest(data); err != nil {
+		return
+	}
+	var log *storage.ExecLog
+	if log, err = db.convertVerifiedRequest(req); err != nil {
+		return
+	}
+	db.recordSequence(log)
+
+	db.state.commitLock.Lock()
+	defer db.state.commitLock.Unlock()
+	defer db.commitStateDigest(data)
+	if err = db.storage.Prepare(ctx, log); err != nil {
+		return
+	}
+	return db.storage.Commit(ctx, log)
+}
 
+func decodeRequest(wb twopc.WriteBatch) (req *wt.Request, err error) {
 	// type convert
-	var payloadBytes []byte
-	if payloadBytes, ok = wb.([]byte); !ok {
+	payloadBytes, ok := wb.([]byte)
+	if !ok {
 		err = ErrInvalidRequest
 		return
 	}
 
 	// decode
-	var req wt.Request
-	if err = utils.DecodeMsgPack(payloadBytes, &req); err != nil {
+	req = new(wt.Request)
+	if err = utils.DecodeMsgPack(payloadBytes, req); err != nil {
 		return
 	}
 
 	// verify
-	if err = req.Verify(); err != nil {
+	err = req.Verify()
+	return
+}
+
+func (db *Database) convertRequest(wb twopc.WriteBatch) (log *storage.ExecLog, err error) {
+	var req *wt.Request
+	if req, err = decodeRequest(wb); err != nil {
 		return
 	}
 
@@ -111,14 +142,18 @@ func (db *Database) convertRequest(wb twopc.WriteBatch) (log *storage.ExecLog, e
 		return
 	}
 
+	return db.convertVerifiedRequest(req)
+}
+
+func (db *Database) convertVerifiedRequest(req *wt.Request) (log *storage.ExecLog, err error) {
 	// convert
 	log = new(storage.ExecLog)
 	log.ConnectionID = req.Header.ConnectionID
 	log.SeqNo = req.Header.SeqNo
 	log.Timestamp = req.Header.Timestamp.UnixNano()
 
-	// sanitize dangerous query
-	if log.Queries, err = convertAndSanitizeQuery(req.Payload.Queries); err != nil {
+	// sanitize dangerous and non-deterministic query
+	if log.Queries, err = convertAndSanitizeQuery(req.Payload.Queries, newWriteContext(log), nil); err != nil {
 		return
 	}
 
@@ -130,6 +165,23 @@ func (db *Database) convertRequest(wb twopc.WriteBatch) (log *storage.ExecLog, e
 	return
 }
 
+// ConvertWriteRequest converts the logged write request to the queries executed by storage, the
+// non-deterministic functions are rewritten the same way as miners do, so replicas replaying the
+// log in order reach the same state.
+func ConvertWriteRequest(req *wt.Request) (queries []storage.Query, err error) {
+	return convertAndSanitizeQuery(req.Payload.Queries, newWriteContext(&storage.ExecLog{
+		ConnectionID: req.Header.ConnectionID,
+		SeqNo:        req.Header.SeqNo,
+		Timestamp:    req.Header.Timestamp.UnixNano(),
+	}), nil)
+}
+
+// ConvertReadQueries converts the read queries to the queries executed by storage, the
+// statements are checked by the default sql policy, which denies all dangerous statements.
+func ConvertReadQueries(queries []wt.Query) ([]storage.Query, error) {
+	return convertAndSanitizeQuery(queries, nil, newSQLFirewall(&wt.SQLPolicy{}))
+}
+
 func (db *Database) evictSequences() {
 	m := make(map[uint64]*list.Element)
 	l := list.New()
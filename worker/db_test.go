@@ -18,6 +18,7 @@ package worker
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -42,10 +43,12 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain/storage"
 	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	wt "github.com/CovenantSQL/CovenantSQL/worker/types"
 	"github.com/fortytw2/leaktest"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -235,6 +238,172 @@ func TestSingleDatabase(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 
+		Convey("test provable read", func() {
+			var writeQuery *wt.Request
+			var res *wt.Response
+			writeQuery, err = buildQuery(wt.WriteQuery, 1, 1, []string{
+				"create table test (id int, name string)",
+				"insert into test values(1, 'a')",
+				"insert into test values(2, 'b')",
+				"insert into test values(3, 'c')",
+			})
+			So(err, ShouldBeNil)
+
+			res, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			var readQuery *wt.Request
+			readQuery, err = buildQuery(wt.ReadQuery, 1, 2, []string{
+				"select name from test where rowid in (2, 3)",
+			})
+			So(err, ShouldBeNil)
+
+			var privateKey *asymmetric.PrivateKey
+			privateKey, _, err = getKeys()
+			So(err, ShouldBeNil)
+			readQuery.Payload.WithProof = true
+			err = readQuery.Sign(privateKey)
+			So(err, ShouldBeNil)
+
+			// no block state to prove against yet
+			_, err = db.Query(readQuery)
+			So(err, ShouldEqual, ErrNoStateSnapshot)
+
+			var root hash.Hash
+			_, root, err = db.SnapshotState()
+			So(err, ShouldBeNil)
+
+			// state root changes after write, but proofs are still served from the snapshot
+			writeQuery, err = buildQuery(wt.WriteQuery, 1, 3, []string{
+				"update test set name = 'd' where id = 2",
+			})
+			So(err, ShouldBeNil)
+			res, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			var newRoot hash.Hash
+			newRoot, err = db.StateRoot()
+			So(err, ShouldBeNil)
+			So(newRoot, ShouldNotResemble, root)
+
+			res, err = db.Query(readQuery)
+			So(err, ShouldBeNil)
+			err = res.Verify()
+			So(err, ShouldBeNil)
+
+			So(res.Header.StateRoot, ShouldResemble, root)
+			So(res.Header.RowCount, ShouldEqual, uint64(2))
+			So(res.Payload.Columns, ShouldResemble, []string{"rowid", "id", "name"})
+			So(res.Payload.Rows[0].Values[2], ShouldResemble, []byte("b"))
+			So(res.Payload.Proofs, ShouldHaveLength, 2)
+			for i, row := range res.Payload.Rows {
+				err = res.Payload.Proofs[i].Verify(row.Values, &root)
+				So(err, ShouldBeNil)
+			}
+
+			err = db.Shutdown()
+			So(err, ShouldBeNil)
+		})
+
+		Convey("test state digest", func() {
+			var writeQuery *wt.Request
+			writeQuery, err = buildQuery(wt.WriteQuery, 1, 1, []string{
+				"create table test (test int)",
+				"insert into test values(1)",
+			})
+			So(err, ShouldBeNil)
+
+			_, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			var lastLog, root hash.Hash
+			lastLog, root, err = db.SnapshotState()
+			So(err, ShouldBeNil)
+			So(lastLog, ShouldNotResemble, hash.Hash{})
+
+			recorded, ok := db.LookupStateRoot(lastLog)
+			So(ok, ShouldBeTrue)
+			So(recorded, ShouldResemble, root)
+
+			// the state tree is not rebuilt on write, but on lookup of the last log
+			writeQuery, err = buildQuery(wt.WriteQuery, 1, 2, []string{
+				"insert into test values(2)",
+			})
+			So(err, ShouldBeNil)
+			_, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+			So(db.state.cache, ShouldBeNil)
+
+			recorded, ok = db.LookupStateRoot(lastLog)
+			So(ok, ShouldBeTrue)
+			So(recorded, ShouldResemble, root)
+
+			newLog := db.state.lastLog
+			So(newLog, ShouldNotResemble, lastLog)
+			recorded, ok = db.LookupStateRoot(newLog)
+			So(ok, ShouldBeTrue)
+			So(recorded, ShouldNotResemble, root)
+			So(db.state.cache, ShouldNotBeNil)
+
+			_, ok = db.LookupStateRoot(hash.Hash{0x1})
+			So(ok, ShouldBeFalse)
+
+			// stop serving after state diverged
+			db.StateDiverged(lastLog, root, hash.Hash{})
+			_, err = db.Query(writeQuery)
+			So(err, ShouldEqual, ErrStateDiverged)
+
+			err = db.Shutdown()
+			So(err, ShouldBeNil)
+		})
+
+		Convey("test without rowid table state", func() {
+			var writeQuery *wt.Request
+			writeQuery, err = buildQuery(wt.WriteQuery, 1, 1, []string{
+				"create table test (a int, b string, primary key (b, a)) without rowid",
+				"insert into test values(1, 'a')",
+			})
+			So(err, ShouldBeNil)
+			_, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			var root hash.Hash
+			_, root, err = db.SnapshotState()
+			So(err, ShouldBeNil)
+			So(db.state.snapshot.tree.tables, ShouldContainKey, "test")
+
+			// rows of without rowid table are covered by the state root
+			writeQuery, err = buildQuery(wt.WriteQuery, 1, 2, []string{
+				"update test set a = 2 where b = 'a'",
+			})
+			So(err, ShouldBeNil)
+			_, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			var newRoot hash.Hash
+			newRoot, err = db.StateRoot()
+			So(err, ShouldBeNil)
+			So(newRoot, ShouldNotResemble, root)
+
+			// but not provable without rowid
+			var readQuery *wt.Request
+			readQuery, err = buildQuery(wt.ReadQuery, 1, 3, []string{
+				"select b from test where rowid = 1",
+			})
+			So(err, ShouldBeNil)
+			var privateKey *asymmetric.PrivateKey
+			privateKey, _, err = getKeys()
+			So(err, ShouldBeNil)
+			readQuery.Payload.WithProof = true
+			err = readQuery.Sign(privateKey)
+			So(err, ShouldBeNil)
+			_, err = db.Query(readQuery)
+			So(err, ShouldEqual, wt.ErrUnprovableQuery)
+
+			err = db.Shutdown()
+			So(err, ShouldBeNil)
+		})
+
 		Convey("test invalid request", func() {
 			var writeQuery *wt.Request
 			var res *wt.Response
@@ -438,6 +607,202 @@ func TestInitFailed(t *testing.T) {
 	})
 }
 
+func TestConvertSQLiteInsertQuery(t *testing.T) {
+	Convey("test sqlite insert conflict clauses", t, func() {
+		q := []wt.Query{
+			{Pattern: "insert or ignore into test values (1); INSERT OR ROLLBACK INTO test VALUES ('or ignore')"},
+			{Pattern: "INSERT INTO test (id, v) VALUES (1, 'a') " +
+				"ON CONFLICT(id) DO UPDATE SET v = excluded.v || 'on conflict'"},
+			{Pattern: "insert into test (id, v) select o.id, o.v from other o join conflict on conflict.id = o.id"},
+		}
+		out, err := convertAndSanitizeQuery(q, nil, nil)
+		So(err, ShouldBeNil)
+		So(out, ShouldHaveLength, 3)
+		for i := range q {
+			So(out[i].Pattern, ShouldEqual, q[i].Pattern)
+		}
+
+		_, err = convertAndSanitizeQuery([]wt.Query{{Pattern: "insert or into test values (1)"}}, nil, nil)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestConvertNonDeterministicQuery(t *testing.T) {
+	Convey("test non-deterministic write translation", t, func() {
+		log := &storage.ExecLog{
+			ConnectionID: 1,
+			SeqNo:        2,
+			Timestamp:    time.Date(2018, 10, 18, 16, 0, 0, 123000000, time.UTC).UnixNano(),
+		}
+
+		out, err := convertAndSanitizeQuery([]wt.Query{
+			{Pattern: "insert into test values (datetime('now'), date(), CURRENT_TIMESTAMP, 'now'); " +
+				"update test set t = strftime('%s', 'NOW', '+1 day') where id = 1"},
+		}, newWriteContext(log), nil)
+		So(err, ShouldBeNil)
+		So(out, ShouldHaveLength, 1)
+		So(out[0].Pattern, ShouldEqual, "insert into test values (datetime( '2018-10-18 16:00:00.123'), "+
+			"date('2018-10-18 16:00:00.123'), '2018-10-18 16:00:00', 'now'); "+
+			"update test set t = strftime('%s', '2018-10-18 16:00:00.123', '+1 day') where id = 1")
+
+		// random values are chosen by the write log
+		q := []wt.Query{{Pattern: "insert into test values (1 - random())"}}
+		out, err = convertAndSanitizeQuery(q, newWriteContext(log), nil)
+		So(err, ShouldBeNil)
+		So(out[0].Pattern, ShouldNotContainSubstring, "random")
+		again, err := convertAndSanitizeQuery(q, newWriteContext(log), nil)
+		So(err, ShouldBeNil)
+		So(again, ShouldResemble, out)
+
+		q = []wt.Query{{Pattern: "insert into test select random()"}}
+		out, err = convertAndSanitizeQuery(q, newWriteContext(log), nil)
+		So(err, ShouldBeNil)
+		So(out[0].Pattern, ShouldNotContainSubstring, "random")
+
+		// read queries are not rewritten
+		out, err = convertAndSanitizeQuery([]wt.Query{{Pattern: "select random(), datetime('now')"}}, nil, nil)
+		So(err, ShouldBeNil)
+		So(out[0].Pattern, ShouldEqual, "select random(), datetime('now')")
+
+		for _, p := range []string{
+			"insert into changes (a) values (1)",
+			"create table if not exists changes (a int)",
+			"insert into test select * from src order by id",
+			"insert into test select 1",
+			"delete from test order by id limit 1",
+		} {
+			out, err = convertAndSanitizeQuery([]wt.Query{{Pattern: p}}, newWriteContext(log), nil)
+			So(err, ShouldBeNil)
+			So(out[0].Pattern, ShouldEqual, p)
+		}
+
+		for _, p := range []string{
+			"insert into test select * from src",
+			"delete from test limit 1",
+			"update test set a = 1 limit 1",
+			"update test set a = changes()",
+			"insert into test values (last_insert_rowid())",
+			"insert into test values (randomblob(4))",
+			"insert into test values (random()), (random())",
+			"insert into test select random() from src order by id",
+			"insert into test values ((select max(a + random()) from src))",
+			"update test set a = random()",
+			"delete from test where random() % 2 = 0",
+			"insert into test values (datetime('now', 'localtime'))",
+			"create table test (a int default current_timestamp)",
+		} {
+			_, err = convertAndSanitizeQuery([]wt.Query{{Pattern: p}}, newWriteContext(log), nil)
+			So(err, ShouldEqual, ErrNonDeterministicQuery)
+		}
+	})
+}
+
+func TestSQLFirewall(t *testing.T) {
+	Convey("test sql firewall", t, func() {
+		fw := newSQLFirewall(&wt.SQLPolicy{})
+
+		// normal statements are allowed by default
+		out, err := convertAndSanitizeQuery([]wt.Query{
+			{Pattern: "select * from test; insert into test values (1);"},
+			{Pattern: "show tables"},
+		}, nil, fw)
+		So(err, ShouldBeNil)
+		So(out[0].Pattern, ShouldEqual, "select * from test; insert into test values (1)")
+
+		for _, p := range []string{
+			"ATTACH DATABASE '/tmp/other.db3' AS other",
+			"detach other",
+			"PRAGMA writable_schema = 1",
+			"select 1; vacuum",
+			"select load_extension('/tmp/evil.so')",
+			"create table test (a int default (load_extension('evil')))",
+		} {
+			_, err = convertAndSanitizeQuery([]wt.Query{{Pattern: p}}, nil, fw)
+			So(errors.Cause(err), ShouldEqual, ErrStatementDenied)
+		}
+
+		// explicitly allowed classes are passed as is
+		fw = newSQLFirewall(&wt.SQLPolicy{
+			AllowedClasses: []string{wt.StatementClassPragma},
+			MaxStatements:  2,
+		})
+		out, err = convertAndSanitizeQuery([]wt.Query{{Pattern: "pragma table_info(test)"}}, nil, fw)
+		So(err, ShouldBeNil)
+		So(out[0].Pattern, ShouldEqual, "pragma table_info(test)")
+		_, err = convertAndSanitizeQuery([]wt.Query{{Pattern: "vacuum"}}, nil, fw)
+		So(errors.Cause(err), ShouldEqual, ErrStatementDenied)
+
+		// statement limit counts all queries of request
+		_, err = convertAndSanitizeQuery([]wt.Query{
+			{Pattern: "select 1; select 2"},
+			{Pattern: "select 3"},
+		}, nil, fw)
+		So(errors.Cause(err), ShouldEqual, ErrTooManyStatements)
+
+		// allow-list
+		fw = newSQLFirewall(&wt.SQLPolicy{
+			AllowList: []string{
+				"SELECT * FROM test WHERE id IN (1, 2)",
+				"insert into test values (?)",
+			},
+		})
+		_, err = convertAndSanitizeQuery([]wt.Query{
+			{Pattern: "select * from test where id in (?, ?, ?)"},
+			{Pattern: "INSERT INTO test VALUES ('a'); insert into test values (:v)"},
+		}, nil, fw)
+		So(err, ShouldBeNil)
+		for _, p := range []string{
+			"select * from test",
+			"select * from test where id in (1) or 1 = 1",
+			"delete from test",
+		} {
+			_, err = convertAndSanitizeQuery([]wt.Query{{Pattern: p}}, nil, fw)
+			So(errors.Cause(err), ShouldEqual, ErrStatementNotAllowed)
+		}
+	})
+}
+
+func TestConvertProvableQuery(t *testing.T) {
+	Convey("test provable query translation", t, func() {
+		table, out, err := convertProvableQuery([]wt.Query{
+			{
+				Pattern: "SELECT name FROM users WHERE rowid IN (?, ?)",
+				Args: []sql.NamedArg{
+					sql.Named("", 1),
+					sql.Named("", 18),
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(table, ShouldEqual, "users")
+		So(out.Pattern, ShouldEqual,
+			"select rowid, * from users where rowid in (:v1, :v2) order by rowid asc")
+		So(out.Args, ShouldResemble, []sql.NamedArg{sql.Named("v1", 1), sql.Named("v2", 18)})
+
+		for _, q := range []string{
+			"select * from a, b",
+			"select * from a join b on a.id = b.id",
+			"select distinct name from users",
+			"select age from users group by age",
+			"select * from main.users",
+			"insert into users values (1)",
+			"select count(*) from users",
+			"select id + 1 from users",
+			"select id, * from users",
+			"select b.id from users",
+			"select * from users where id = 1",
+			"select * from users where rowid > 1",
+			"select * from users where rowid = 1 limit 1",
+		} {
+			_, _, err = convertProvableQuery([]wt.Query{{Pattern: q}})
+			So(err, ShouldEqual, wt.ErrUnprovableQuery)
+		}
+
+		_, _, err = convertProvableQuery([]wt.Query{{Pattern: "select 1"}, {Pattern: "select 2"}})
+		So(err, ShouldEqual, wt.ErrUnprovableQuery)
+	})
+}
+
 func TestDatabaseRecycle(t *testing.T) {
 	defer leaktest.Check(t)()
 
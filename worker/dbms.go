@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/CovenantSQL/CovenantSQL/kayak"
 	ka "github.com/CovenantSQL/CovenantSQL/kayak/api"
 	kt "github.com/CovenantSQL/CovenantSQL/kayak/transport"
 	"github.com/CovenantSQL/CovenantSQL/proto"
@@ -205,6 +206,7 @@ func (dbms *DBMS) Create(instance *wt.ServiceInstance, cleanup bool) (err error)
 		MaxWriteTimeGap: dbms.cfg.MaxReqTimeGap,
 		EncryptionKey:   instance.ResourceMeta.EncryptionKey,
 		SpaceLimit:      instance.ResourceMeta.Space,
+		SQLPolicy:       instance.SQLPolicy,
 	}
 
 	if db, err = NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock); err != nil {
@@ -248,6 +250,19 @@ func (dbms *DBMS) Update(instance *wt.ServiceInstance) (err error) {
 	return db.UpdatePeers(instance.Peers)
 }
 
+// UpdatePolicy apply the new sql policy to database.
+func (dbms *DBMS) UpdatePolicy(instance *wt.ServiceInstance) (err error) {
+	var db *Database
+	var exists bool
+
+	if db, exists = dbms.getMeta(instance.DatabaseID); !exists {
+		return ErrNotExists
+	}
+
+	db.UpdatePolicy(&instance.SQLPolicy)
+	return
+}
+
 // Query handles query request in dbms.
 func (dbms *DBMS) Query(req *wt.Request) (res *wt.Response, err error) {
 	var db *Database
@@ -304,6 +319,18 @@ func (dbms *DBMS) GetRequest(dbID proto.DatabaseID, offset uint64) (query *wt.Re
 	return
 }
 
+// FetchLog handles fetching committed log by peers catching up.
+func (dbms *DBMS) FetchLog(dbID proto.DatabaseID, nodeID proto.NodeID, peers *kayak.Peers,
+	offset uint64) (l *kayak.Log, err error) {
+	db, exists := dbms.getMeta(dbID)
+	if !exists {
+		err = ErrNotExists
+		return
+	}
+
+	return db.GetCommittedLog(nodeID, peers, offset)
+}
+
 func (dbms *DBMS) getMeta(dbID proto.DatabaseID) (db *Database, exists bool) {
 	var rawDB interface{}
 
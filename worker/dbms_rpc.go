@@ -93,7 +93,7 @@ func (rpc *DBMSRPCService) Deploy(req *wt.UpdateService, _ *wt.UpdateServiceResp
 		return
 	}
 
-	// create/drop/update
+	// create/drop/update/update policy
 	switch req.Header.Op {
 	case wt.CreateDB:
 		err = rpc.dbms.Create(&req.Header.Instance, true)
@@ -101,6 +101,8 @@ func (rpc *DBMSRPCService) Deploy(req *wt.UpdateService, _ *wt.UpdateServiceResp
 		err = rpc.dbms.Update(&req.Header.Instance)
 	case wt.DropDB:
 		err = rpc.dbms.Drop(req.Header.Instance.DatabaseID)
+	case wt.UpdatePolicy:
+		err = rpc.dbms.UpdatePolicy(&req.Header.Instance)
 	}
 
 	return
@@ -112,3 +114,16 @@ func (rpc *DBMSRPCService) GetRequest(req *wt.GetRequestReq, resp *wt.GetRequest
 	resp.Request, err = rpc.dbms.GetRequest(req.DatabaseID, req.LogOffset)
 	return
 }
+
+// FetchLog rpc, called by peer miners to catch up committed logs.
+func (rpc *DBMSRPCService) FetchLog(req *wt.FetchLogReq, resp *wt.FetchLogResp) (err error) {
+	// verify request node is the caller
+	nodeID := req.Envelope.GetNodeID()
+	if nodeID == nil {
+		err = ErrInvalidRequest
+		return
+	}
+
+	resp.Log, err = rpc.dbms.FetchLog(req.DatabaseID, nodeID.ToNodeID(), req.Peers, req.LogOffset)
+	return
+}
@@ -121,6 +121,28 @@ func TestDBMS(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(respGetRequest.Request.Header.HeaderHash, ShouldResemble, writeQuery.Header.HeaderHash)
 
+				var reqFetchLog wt.FetchLogReq
+				var respFetchLog *wt.FetchLogResp
+
+				reqFetchLog.DatabaseID = dbID
+				reqFetchLog.LogOffset = queryRes.Header.LogOffset
+				err = testRequest(route.DBSFetchLog, reqFetchLog, &respFetchLog)
+				So(err, ShouldBeNil)
+				So(respFetchLog.Log, ShouldNotBeNil)
+				So(respFetchLog.Log.Index, ShouldEqual, queryRes.Header.LogOffset)
+				So(respFetchLog.Log.VerifyHash(), ShouldBeTrue)
+
+				// log not committed yet
+				var respNotCommitted *wt.FetchLogResp
+				reqFetchLog.LogOffset++
+				err = testRequest(route.DBSFetchLog, reqFetchLog, &respNotCommitted)
+				So(err, ShouldBeNil)
+				So(respNotCommitted.Log, ShouldBeNil)
+
+				// node not in peers
+				_, err = dbms.FetchLog(dbID, proto.NodeID("not_peer"), nil, 1)
+				So(err, ShouldEqual, ErrNotPeer)
+
 				// sending read query
 				var readQuery *wt.Request
 				readQuery, err = buildQueryWithDatabaseID(wt.ReadQuery, 1, 2, dbID, []string{
@@ -39,4 +39,28 @@ var (
 
 	// ErrSpaceLimitExceeded defines errors on disk space exceeding limit.
 	ErrSpaceLimitExceeded = errors.New("space limit exceeded")
+
+	// ErrInvalidStateTree defines errors on query result rows not found in the state tree.
+	ErrInvalidStateTree = errors.New("query result mismatch state tree")
+
+	// ErrNoStateSnapshot defines errors on requesting proofs before any block state is snapshotted.
+	ErrNoStateSnapshot = errors.New("no block state snapshot to prove query result against")
+
+	// ErrStateDiverged defines errors on serving queries with database state diverged from peers.
+	ErrStateDiverged = errors.New("database state diverged from the majority of peers")
+
+	// ErrNonDeterministicQuery defines errors on write query which may lead to diverged replicas.
+	ErrNonDeterministicQuery = errors.New("non-deterministic query is not allowed in writes")
+
+	// ErrStatementDenied defines errors on statement of dangerous class denied by database sql policy.
+	ErrStatementDenied = errors.New("statement class denied by sql policy")
+
+	// ErrStatementNotAllowed defines errors on statement not in the allow-list of database sql policy.
+	ErrStatementNotAllowed = errors.New("statement not in the allow-list of sql policy")
+
+	// ErrTooManyStatements defines errors on request exceeding the statement limit of database sql policy.
+	ErrTooManyStatements = errors.New("too many statements in single request")
+
+	// ErrNotPeer defines errors on fetching committed logs by node not in the database peers.
+	ErrNotPeer = errors.New("node is not a peer of database")
 )
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	queryTypeRead     = "read"
+	queryTypeProvable = "provable"
+	queryTypeWrite    = "write"
+	queryTypeInvalid  = "invalid"
+)
+
+var queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "covenantsql",
+	Subsystem: "worker",
+	Name:      "query_duration_seconds",
+	Help:      "Duration of database queries by query type and result.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+}, []string{"type", "result"})
+
+func init() {
+	prometheus.MustRegister(queryDuration)
+}
+
+// observeQuery records the duration of a query since start.
+func observeQuery(queryType string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	queryDuration.WithLabelValues(queryType, result).Observe(time.Since(start).Seconds())
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -109,7 +110,7 @@ func (sh *SignedAckHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedAckHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedAckHeader) Sign(signer kms.Signer) (err error) {
 	// check original header signature
 	if err = sh.Response.Verify(); err != nil {
 		return
@@ -140,7 +141,7 @@ func (a *Ack) Verify() error {
 }
 
 // Sign the request.
-func (a *Ack) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (a *Ack) Sign(signer kms.Signer) (err error) {
 	// sign
 	return a.Header.Sign(signer)
 }
@@ -27,4 +27,17 @@ var (
 
 	// ErrSignRequest indicates a failed signature compute operation.
 	ErrSignRequest = errors.New("signature compute failed")
+
+	// ErrUnsupportedRowValue indicates that the row contains value of unknown type to hash.
+	ErrUnsupportedRowValue = errors.New("unsupported row value type")
+
+	// ErrRowProofVerification indicates a failed row inclusion proof verification.
+	ErrRowProofVerification = errors.New("row proof verification failed")
+
+	// ErrUnprovableQuery indicates that the query result could not be proved, only rowid point
+	// lookup of plain columns in a single table is provable.
+	ErrUnprovableQuery = errors.New("only rowid point lookup of plain columns in a single table is provable")
+
+	// ErrInvalidSQLPolicy indicates that the sql policy contains unknown statement class or invalid fingerprint.
+	ErrInvalidSQLPolicy = errors.New("invalid sql policy")
 )
@@ -0,0 +1,36 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/kayak"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// FetchLogReq defines FetchLog RPC request entity.
+type FetchLogReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	Peers      *kayak.Peers
+	LogOffset  uint64
+}
+
+// FetchLogResp defines FetchLog RPC response entity.
+type FetchLogResp struct {
+	proto.Envelope
+	Log *kayak.Log
+}
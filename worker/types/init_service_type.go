@@ -22,6 +22,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/kayak"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	ct "github.com/CovenantSQL/CovenantSQL/sqlchain/types"
@@ -50,6 +51,9 @@ type ServiceInstance struct {
 	Peers        *kayak.Peers
 	ResourceMeta ResourceMeta
 	GenesisBlock *ct.Block
+	Owner        *asymmetric.PublicKey // creator of the database, who could update the sql policy, nil for the block producer
+	OwnerWallet  proto.AccountAddress  // multisig owner wallet, owner operations require threshold signatures of its key set if set
+	SQLPolicy    SQLPolicy
 }
 
 // InitServiceResponseHeader defines worker service init response header.
@@ -102,6 +106,13 @@ func (i *ServiceInstance) Serialize() []byte {
 	} else {
 		buf.Write([]byte{'\000'})
 	}
+	if i.Owner != nil {
+		buf.Write(i.Owner.Serialize())
+	} else {
+		buf.WriteRune('\000')
+	}
+	buf.Write(i.OwnerWallet[:])
+	buf.Write(i.SQLPolicy.Serialize())
 
 	return buf.Bytes()
 }
@@ -160,7 +171,7 @@ func (sh *SignedInitServiceResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedInitServiceResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedInitServiceResponseHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.InitServiceResponseHeader, &sh.HeaderHash)
 
@@ -186,7 +197,7 @@ func (rs *InitServiceResponse) Verify() error {
 }
 
 // Sign the request.
-func (rs *InitServiceResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (rs *InitServiceResponse) Sign(signer kms.Signer) (err error) {
 	// sign
 	return rs.Header.Sign(signer)
 }
@@ -98,8 +98,8 @@ func (z *ResourceMeta) Msgsize() (s int) {
 func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 4
-	o = append(o, 0x84, 0x84)
+	// map header, size 7
+	o = append(o, 0x87, 0x87)
 	if z.GenesisBlock == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -109,7 +109,17 @@ func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x87)
+	if z.Owner == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Owner.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x87)
 	if z.Peers == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -119,18 +129,30 @@ func (z *ServiceInstance) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x87)
 	if oTemp, err := z.ResourceMeta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x87)
+	if oTemp, err := z.SQLPolicy.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x87)
 	if oTemp, err := z.DatabaseID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
+	o = append(o, 0x87)
+	if oTemp, err := z.OwnerWallet.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
 	return
 }
 
@@ -143,12 +165,18 @@ func (z *ServiceInstance) Msgsize() (s int) {
 		s += z.GenesisBlock.Msgsize()
 	}
 	s += 6
+	if z.Owner == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.Owner.Msgsize()
+	}
+	s += 6
 	if z.Peers == nil {
 		s += hsp.NilSize
 	} else {
 		s += z.Peers.Msgsize()
 	}
-	s += 13 + z.ResourceMeta.Msgsize() + 11 + z.DatabaseID.Msgsize()
+	s += 13 + z.ResourceMeta.Msgsize() + 10 + z.SQLPolicy.Msgsize() + 11 + z.DatabaseID.Msgsize() + 12 + z.OwnerWallet.Msgsize()
 	return
 }
 
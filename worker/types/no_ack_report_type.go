@@ -23,6 +23,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/kayak"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
@@ -130,7 +131,7 @@ func (sh *SignedNoAckReportHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedNoAckReportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedNoAckReportHeader) Sign(signer kms.Signer) (err error) {
 	// verify original response
 	if err = sh.Response.Verify(); err != nil {
 		return
@@ -161,7 +162,7 @@ func (r *NoAckReport) Verify() error {
 }
 
 // Sign the request.
-func (r *NoAckReport) Sign(signer *asymmetric.PrivateKey) error {
+func (r *NoAckReport) Sign(signer kms.Signer) error {
 	return r.Header.Sign(signer)
 }
 
@@ -229,7 +230,7 @@ func (sh *SignedAggrNoAckReportHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedAggrNoAckReportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedAggrNoAckReportHeader) Sign(signer kms.Signer) (err error) {
 	for _, r := range sh.Reports {
 		if err = r.Verify(); err != nil {
 			return
@@ -261,6 +262,6 @@ func (r *AggrNoAckReport) Verify() (err error) {
 }
 
 // Sign the request.
-func (r *AggrNoAckReport) Sign(signer *asymmetric.PrivateKey) error {
+func (r *AggrNoAckReport) Sign(signer kms.Signer) error {
 	return r.Header.Sign(signer)
 }
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+)
+
+//go:generate hsp
+
+// Database state is authenticated by a two level merkle tree: each table has a merkle tree over
+// its rows ordered by rowid, and the state root is the merkle root over the table leaves ordered
+// by table name, a table leaf is the hash of table name and the table root.
+
+// Canonical value type tags of row hashing, values are normalized so the row hash is the same
+// before and after the msgpack round trip between the worker and the client.
+const (
+	rowValueNil byte = iota
+	rowValueInteger
+	rowValueFloat
+	rowValueBytes
+	rowValueTime
+)
+
+// RowProof defines the inclusion proof of a table row in the database state.
+type RowProof struct {
+	Table      string
+	TableIndex uint64
+	TablePath  []hash.Hash
+	RowIndex   uint64
+	RowPath    []hash.Hash
+}
+
+// RowHash returns the leaf hash of a table row, the row values should start with the rowid.
+func RowHash(values []interface{}) (h hash.Hash, err error) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint64(len(values)))
+
+	for _, v := range values {
+		switch d := v.(type) {
+		case nil:
+			buf.WriteByte(rowValueNil)
+		case int64:
+			writeRowInteger(buf, d)
+		case int:
+			writeRowInteger(buf, int64(d))
+		case int8:
+			writeRowInteger(buf, int64(d))
+		case int16:
+			writeRowInteger(buf, int64(d))
+		case int32:
+			writeRowInteger(buf, int64(d))
+		case uint:
+			writeRowInteger(buf, int64(d))
+		case uint8:
+			writeRowInteger(buf, int64(d))
+		case uint16:
+			writeRowInteger(buf, int64(d))
+		case uint32:
+			writeRowInteger(buf, int64(d))
+		case uint64:
+			writeRowInteger(buf, int64(d))
+		case bool:
+			if d {
+				writeRowInteger(buf, 1)
+			} else {
+				writeRowInteger(buf, 0)
+			}
+		case float64:
+			buf.WriteByte(rowValueFloat)
+			binary.Write(buf, binary.LittleEndian, math.Float64bits(d))
+		case float32:
+			buf.WriteByte(rowValueFloat)
+			binary.Write(buf, binary.LittleEndian, math.Float64bits(float64(d)))
+		case []byte:
+			writeRowBytes(buf, d)
+		case string:
+			// blobs might be decoded as string by msgpack
+			writeRowBytes(buf, []byte(d))
+		case time.Time:
+			buf.WriteByte(rowValueTime)
+			binary.Write(buf, binary.LittleEndian, d.UnixNano())
+		default:
+			err = ErrUnsupportedRowValue
+			return
+		}
+	}
+
+	h = hash.THashH(buf.Bytes())
+	return
+}
+
+func writeRowInteger(buf *bytes.Buffer, i int64) {
+	buf.WriteByte(rowValueInteger)
+	binary.Write(buf, binary.LittleEndian, i)
+}
+
+func writeRowBytes(buf *bytes.Buffer, b []byte) {
+	buf.WriteByte(rowValueBytes)
+	binary.Write(buf, binary.LittleEndian, uint64(len(b)))
+	buf.Write(b)
+}
+
+// TableHash returns the leaf hash of a table in the database state.
+func TableHash(table string, root *hash.Hash) hash.Hash {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint64(len(table)))
+	buf.WriteString(table)
+	buf.Write(root[:])
+	return hash.THashH(buf.Bytes())
+}
+
+// Verify checks if the row values are included in the database state of root.
+func (p *RowProof) Verify(values []interface{}, root *hash.Hash) (err error) {
+	var rowHash hash.Hash
+	if rowHash, err = RowHash(values); err != nil {
+		return
+	}
+
+	// rebuild table root from the row path
+	tableRoot, ok := merkle.ProofRoot(&rowHash, p.RowIndex, p.RowPath)
+	if !ok {
+		return ErrRowProofVerification
+	}
+
+	tableHash := TableHash(p.Table, tableRoot)
+	if !merkle.VerifyProof(&tableHash, p.TableIndex, p.TablePath, root) {
+		return ErrRowProofVerification
+	}
+
+	return
+}
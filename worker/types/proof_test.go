@@ -0,0 +1,95 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRowProof(t *testing.T) {
+	Convey("Given a state tree of two tables", t, func() {
+		now := time.Now().UTC()
+		tables := []string{"t1", "t2"}
+		rows := [][][]interface{}{
+			{
+				{int64(1), "a", []byte("blob"), 1.5, nil},
+				{int64(2), "b", []byte{}, 2.5, now},
+				{int64(5), "c", nil, 0.0, now},
+			},
+			{
+				{int64(1), int64(100)},
+			},
+		}
+
+		var rowTrees []*merkle.Merkle
+		var tableLeaves []*hash.Hash
+		for i, tr := range rows {
+			var leaves []*hash.Hash
+			for _, r := range tr {
+				h, err := RowHash(r)
+				So(err, ShouldBeNil)
+				leaves = append(leaves, &h)
+			}
+			rowTree := merkle.NewMerkle(leaves)
+			rowTrees = append(rowTrees, rowTree)
+			leaf := TableHash(tables[i], rowTree.GetRoot())
+			tableLeaves = append(tableLeaves, &leaf)
+		}
+		stateTree := merkle.NewMerkle(tableLeaves)
+		root := stateTree.GetRoot()
+
+		proofOf := func(table, row int) *RowProof {
+			tablePath, err := stateTree.GetProof(uint64(table))
+			So(err, ShouldBeNil)
+			rowPath, err := rowTrees[table].GetProof(uint64(row))
+			So(err, ShouldBeNil)
+			return &RowProof{
+				Table:      tables[table],
+				TableIndex: uint64(table),
+				TablePath:  tablePath,
+				RowIndex:   uint64(row),
+				RowPath:    rowPath,
+			}
+		}
+
+		Convey("Each row should be verified against the state root", func() {
+			for i := range rows {
+				for j := range rows[i] {
+					So(proofOf(i, j).Verify(rows[i][j], root), ShouldBeNil)
+				}
+			}
+		})
+		Convey("Row decoded by msgpack should be verified too", func() {
+			decoded := []interface{}{uint64(1), []byte("a"), "blob", 1.5, nil}
+			So(proofOf(0, 0).Verify(decoded, root), ShouldBeNil)
+		})
+		Convey("Tampered row or proof should fail", func() {
+			p := proofOf(0, 1)
+			So(p.Verify(rows[0][0], root), ShouldEqual, ErrRowProofVerification)
+			p.Table = "t2"
+			So(p.Verify(rows[0][1], root), ShouldEqual, ErrRowProofVerification)
+			p = proofOf(1, 0)
+			So(p.Verify([]interface{}{int64(1), int64(101)}, root), ShouldEqual, ErrRowProofVerification)
+			So(p.Verify([]interface{}{int64(1), struct{}{}}, root), ShouldEqual, ErrUnsupportedRowValue)
+		})
+	})
+}
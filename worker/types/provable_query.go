@@ -0,0 +1,222 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/CovenantSQL/sqlparser"
+)
+
+// ProvableColumn defines a column selected by a provable query.
+type ProvableColumn struct {
+	Name  string
+	Alias string
+}
+
+// ParseProvableQuery parses a rowid point lookup query of a single table, of which the result rows
+// could be proved against the database state. It returns the parsed statement, the table name and
+// the selected columns, nil columns means all columns of the table are selected. Only plain column
+// references are allowed in the select list, so the client could project the requested columns
+// from the proved rows.
+//
+// The WHERE clause should be `rowid = v` or `rowid IN (v1, v2...)` of integer literals or
+// placeholders without LIMIT, so the client could check every proved row is requested by the
+// query. The proofs only cover the returned rows, a requested row missing from the result is not
+// proved to be absent from the table.
+func ParseProvableQuery(pattern string) (
+	sel *sqlparser.Select, table string, columns []ProvableColumn, err error,
+) {
+	sel, table, columns, _, err = parseProvableQuery(pattern)
+	return
+}
+
+// ProvableRowIDs returns the table name and the rowids requested by a provable query with the
+// args of the query, positional args are matched with the placeholders in order.
+func ProvableRowIDs(pattern string, args []sql.NamedArg) (table string, rowIDs []int64, err error) {
+	var values []*sqlparser.SQLVal
+	if _, table, _, values, err = parseProvableQuery(pattern); err != nil {
+		return
+	}
+
+	var positional []interface{}
+	for _, arg := range args {
+		if arg.Name == "" {
+			positional = append(positional, arg.Value)
+		}
+	}
+
+	rowIDs = make([]int64, 0, len(values))
+	for _, v := range values {
+		var rowID int64
+		if v.Type == sqlparser.IntVal {
+			if rowID, err = strconv.ParseInt(string(v.Val), 10, 64); err != nil {
+				err = ErrUnprovableQuery
+				return
+			}
+		} else {
+			// placeholders are formatted as :name, and positional ones as :v1, :v2...
+			name := strings.TrimPrefix(string(v.Val), ":")
+			value, found := lookupNamedArg(args, name)
+			if !found && strings.HasPrefix(name, "v") {
+				if pos, perr := strconv.Atoi(name[1:]); perr == nil && pos >= 1 && pos <= len(positional) {
+					value, found = positional[pos-1], true
+				}
+			}
+			var ok bool
+			if rowID, ok = ToRowID(value); !found || !ok {
+				err = ErrUnprovableQuery
+				return
+			}
+		}
+		rowIDs = append(rowIDs, rowID)
+	}
+
+	return
+}
+
+func parseProvableQuery(pattern string) (
+	sel *sqlparser.Select, table string, columns []ProvableColumn, values []*sqlparser.SQLVal, err error,
+) {
+	var stmt sqlparser.Statement
+	if stmt, err = sqlparser.Parse(pattern); err != nil {
+		return
+	}
+
+	var ok bool
+	if sel, ok = stmt.(*sqlparser.Select); !ok || len(sel.From) != 1 || sel.Distinct != "" ||
+		len(sel.GroupBy) > 0 || sel.Having != nil || sel.Limit != nil || sel.Where == nil {
+		err = ErrUnprovableQuery
+		return
+	}
+
+	from, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		err = ErrUnprovableQuery
+		return
+	}
+	tableName, ok := from.Expr.(sqlparser.TableName)
+	if !ok || !tableName.Qualifier.IsEmpty() {
+		err = ErrUnprovableQuery
+		return
+	}
+	table = tableName.Name.String()
+
+	isTable := func(t sqlparser.TableName) bool {
+		name := t.Name.String()
+		return t.Qualifier.IsEmpty() && (name == "" ||
+			strings.EqualFold(name, table) || strings.EqualFold(name, from.As.String()))
+	}
+
+	for _, expr := range sel.SelectExprs {
+		switch e := expr.(type) {
+		case *sqlparser.StarExpr:
+			if len(sel.SelectExprs) != 1 || !isTable(e.TableName) {
+				err = ErrUnprovableQuery
+				return
+			}
+		case *sqlparser.AliasedExpr:
+			col, ok := e.Expr.(*sqlparser.ColName)
+			if !ok || !isTable(col.Qualifier) {
+				err = ErrUnprovableQuery
+				return
+			}
+			columns = append(columns, ProvableColumn{
+				Name:  col.Name.String(),
+				Alias: e.As.String(),
+			})
+		default:
+			err = ErrUnprovableQuery
+			return
+		}
+	}
+
+	// rowid point lookup
+	cmp, ok := sel.Where.Expr.(*sqlparser.ComparisonExpr)
+	if !ok || (cmp.Operator != sqlparser.EqualStr && cmp.Operator != sqlparser.InStr) {
+		err = ErrUnprovableQuery
+		return
+	}
+	col, ok := cmp.Left.(*sqlparser.ColName)
+	if !ok || !isTable(col.Qualifier) || !isRowIDColumn(col.Name.String()) {
+		err = ErrUnprovableQuery
+		return
+	}
+	var exprs []sqlparser.Expr
+	if cmp.Operator == sqlparser.EqualStr {
+		exprs = []sqlparser.Expr{cmp.Right}
+	} else if tuple, ok := cmp.Right.(sqlparser.ValTuple); ok {
+		exprs = tuple
+	}
+	if len(exprs) == 0 {
+		err = ErrUnprovableQuery
+		return
+	}
+	for _, expr := range exprs {
+		v, ok := expr.(*sqlparser.SQLVal)
+		if !ok || (v.Type != sqlparser.IntVal && v.Type != sqlparser.ValArg) {
+			err = ErrUnprovableQuery
+			return
+		}
+		values = append(values, v)
+	}
+
+	return
+}
+
+func isRowIDColumn(name string) bool {
+	return strings.EqualFold(name, "rowid") || strings.EqualFold(name, "oid") ||
+		strings.EqualFold(name, "_rowid_")
+}
+
+func lookupNamedArg(args []sql.NamedArg, name string) (value interface{}, found bool) {
+	for _, arg := range args {
+		if arg.Name != "" && arg.Name == name {
+			return arg.Value, true
+		}
+	}
+	return
+}
+
+// ToRowID converts an integer query arg or result value to rowid.
+func ToRowID(v interface{}) (rowID int64, ok bool) {
+	switch d := v.(type) {
+	case int64:
+		return d, true
+	case int:
+		return int64(d), true
+	case int8:
+		return int64(d), true
+	case int16:
+		return int64(d), true
+	case int32:
+		return int64(d), true
+	case uint8:
+		return int64(d), true
+	case uint16:
+		return int64(d), true
+	case uint32:
+		return int64(d), true
+	case uint64:
+		return int64(d), d <= math.MaxInt64
+	default:
+		return
+	}
+}
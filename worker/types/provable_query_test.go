@@ -0,0 +1,76 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"database/sql"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseProvableQuery(t *testing.T) {
+	Convey("test provable query parsing", t, func() {
+		_, table, columns, err := ParseProvableQuery("SELECT * FROM users WHERE rowid = 1")
+		So(err, ShouldBeNil)
+		So(table, ShouldEqual, "users")
+		So(columns, ShouldBeNil)
+
+		_, table, columns, err = ParseProvableQuery("SELECT u.name AS n, id FROM users u WHERE u.oid IN (1, ?)")
+		So(err, ShouldBeNil)
+		So(table, ShouldEqual, "users")
+		So(columns, ShouldResemble, []ProvableColumn{{Name: "name", Alias: "n"}, {Name: "id"}})
+
+		for _, q := range []string{
+			"SELECT count(*) FROM users WHERE rowid = 1",
+			"SELECT name, * FROM users WHERE rowid = 1",
+			"SELECT other.name FROM users WHERE rowid = 1",
+			"SELECT * FROM a, b WHERE rowid = 1",
+			"SELECT * FROM users",
+			"SELECT * FROM users WHERE id > 1",
+			"SELECT * FROM users WHERE rowid > 1",
+			"SELECT * FROM users WHERE rowid = 1 OR name = 'a'",
+			"SELECT * FROM users WHERE rowid = 'a'",
+			"SELECT * FROM users WHERE rowid = 1 LIMIT 1",
+			"SELECT * FROM users WHERE other.rowid = 1",
+			"DELETE FROM users",
+		} {
+			_, _, _, err = ParseProvableQuery(q)
+			So(err, ShouldEqual, ErrUnprovableQuery)
+		}
+	})
+}
+
+func TestProvableRowIDs(t *testing.T) {
+	Convey("test provable query rowids", t, func() {
+		table, rowIDs, err := ProvableRowIDs("SELECT * FROM users WHERE _rowid_ IN (-1, ?, :id, ?)",
+			[]sql.NamedArg{{Value: int64(2)}, sql.Named("id", 3), {Value: uint8(4)}})
+		So(err, ShouldBeNil)
+		So(table, ShouldEqual, "users")
+		So(rowIDs, ShouldResemble, []int64{-1, 2, 3, 4})
+
+		for _, args := range [][]sql.NamedArg{
+			nil,
+			{{Value: "1"}},
+			{sql.Named("other", 1)},
+			{{Value: uint64(1 << 63)}},
+		} {
+			_, _, err = ProvableRowIDs("SELECT * FROM users WHERE rowid = ?", args)
+			So(err, ShouldEqual, ErrUnprovableQuery)
+		}
+	})
+}
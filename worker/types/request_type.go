@@ -24,6 +24,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 )
@@ -61,6 +62,8 @@ func (t QueryType) String() string {
 // RequestPayload defines a queries payload.
 type RequestPayload struct {
 	Queries []Query
+	// WithProof requests row inclusion proofs of the read query result against the state root.
+	WithProof bool
 }
 
 // RequestHeader defines a query request header.
@@ -164,7 +167,7 @@ func (sh *SignedRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedRequestHeader) Sign(signer kms.Signer) (err error) {
 	// compute hash
 	buildHash(&sh.RequestHeader, &sh.HeaderHash)
 
@@ -204,7 +207,7 @@ func (r *Request) Verify() (err error) {
 }
 
 // Sign the request.
-func (r *Request) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *Request) Sign(signer kms.Signer) (err error) {
 	// set query count
 	r.Header.BatchCount = uint64(len(r.Payload.Queries))
 
@@ -23,6 +23,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/pkg/errors"
@@ -40,6 +41,7 @@ type ResponsePayload struct {
 	Columns   []string
 	DeclTypes []string
 	Rows      []ResponseRow
+	Proofs    []RowProof // inclusion proofs of rows, only for reads requesting proofs
 }
 
 // ResponseHeader defines a query response header.
@@ -50,6 +52,7 @@ type ResponseHeader struct {
 	RowCount  uint64       // response row count of payload
 	LogOffset uint64       // request log offset
 	DataHash  hash.Hash    // hash of query response
+	StateRoot hash.Hash    // database state root of the row proofs
 }
 
 // SignedResponseHeader defines a signed query response header.
@@ -74,6 +77,26 @@ func (r *ResponseRow) Serialize() []byte {
 	return buf.Bytes()
 }
 
+// Serialize structure to bytes.
+func (p *RowProof) Serialize() []byte {
+	buf := new(bytes.Buffer)
+
+	binary.Write(buf, binary.LittleEndian, uint64(len(p.Table)))
+	buf.WriteString(p.Table)
+	binary.Write(buf, binary.LittleEndian, p.TableIndex)
+	binary.Write(buf, binary.LittleEndian, uint64(len(p.TablePath)))
+	for _, h := range p.TablePath {
+		buf.Write(h[:])
+	}
+	binary.Write(buf, binary.LittleEndian, p.RowIndex)
+	binary.Write(buf, binary.LittleEndian, uint64(len(p.RowPath)))
+	for _, h := range p.RowPath {
+		buf.Write(h[:])
+	}
+
+	return buf.Bytes()
+}
+
 // Serialize structure to bytes.
 func (r *ResponsePayload) Serialize() []byte {
 	if r == nil {
@@ -97,6 +120,11 @@ func (r *ResponsePayload) Serialize() []byte {
 		buf.Write(row.Serialize())
 	}
 
+	binary.Write(buf, binary.LittleEndian, uint64(len(r.Proofs)))
+	for _, p := range r.Proofs {
+		buf.Write(p.Serialize())
+	}
+
 	return buf.Bytes()
 }
 
@@ -115,6 +143,7 @@ func (h *ResponseHeader) Serialize() []byte {
 	binary.Write(buf, binary.LittleEndian, h.RowCount)
 	binary.Write(buf, binary.LittleEndian, h.LogOffset)
 	buf.Write(h.DataHash[:])
+	buf.Write(h.StateRoot[:])
 
 	return buf.Bytes()
 }
@@ -162,7 +191,7 @@ func (sh *SignedResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedResponseHeader) Sign(signer kms.Signer) (err error) {
 	// make sure original header is signed
 	if err = sh.Request.Verify(); err != nil {
 		err = errors.Wrapf(err, "SignedResponseHeader %v", sh)
@@ -204,7 +233,7 @@ func (sh *Response) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *Response) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *Response) Sign(signer kms.Signer) (err error) {
 	// set rows count
 	sh.Header.RowCount = uint64(len(sh.Payload.Rows))
 
@@ -36,37 +36,43 @@ func (z *Response) Msgsize() (s int) {
 func (z *ResponseHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 6
-	o = append(o, 0x86, 0x86)
+	// map header, size 7
+	o = append(o, 0x87, 0x87)
 	if oTemp, err := z.Request.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	if oTemp, err := z.DataHash.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x87)
+	if oTemp, err := z.StateRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x87)
 	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	o = hsp.AppendTime(o, z.Timestamp)
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	o = hsp.AppendUint64(o, z.RowCount)
-	o = append(o, 0x86)
+	o = append(o, 0x87)
 	o = hsp.AppendUint64(o, z.LogOffset)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ResponseHeader) Msgsize() (s int) {
-	s = 1 + 8 + z.Request.Msgsize() + 9 + z.DataHash.Msgsize() + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size + 10 + hsp.Uint64Size
+	s = 1 + 8 + z.Request.Msgsize() + 9 + z.DataHash.Msgsize() + 10 + z.StateRoot.Msgsize() + 7 + z.NodeID.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size + 10 + hsp.Uint64Size
 	return
 }
 
@@ -74,8 +80,17 @@ func (z *ResponseHeader) Msgsize() (s int) {
 func (z *ResponsePayload) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 3
-	o = append(o, 0x83, 0x83)
+	// map header, size 4
+	o = append(o, 0x84, 0x84)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.Proofs)))
+	for za0005 := range z.Proofs {
+		if oTemp, err := z.Proofs[za0005].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Rows)))
 	for za0003 := range z.Rows {
 		// map header, size 1
@@ -88,12 +103,12 @@ func (z *ResponsePayload) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Columns)))
 	for za0001 := range z.Columns {
 		o = hsp.AppendString(o, z.Columns[za0001])
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.DeclTypes)))
 	for za0002 := range z.DeclTypes {
 		o = hsp.AppendString(o, z.DeclTypes[za0002])
@@ -103,7 +118,11 @@ func (z *ResponsePayload) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ResponsePayload) Msgsize() (s int) {
-	s = 1 + 5 + hsp.ArrayHeaderSize
+	s = 1 + 7 + hsp.ArrayHeaderSize
+	for za0005 := range z.Proofs {
+		s += z.Proofs[za0005].Msgsize()
+	}
+	s += 5 + hsp.ArrayHeaderSize
 	for za0003 := range z.Rows {
 		s += 1 + 7 + hsp.ArrayHeaderSize
 		for za0004 := range z.Rows[za0003].Values {
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/CovenantSQL/sqlparser"
+)
+
+//go:generate hsp
+
+const (
+	// StatementClassAttach defines the ATTACH/DETACH DATABASE statements.
+	StatementClassAttach = "attach"
+	// StatementClassPragma defines the PRAGMA statements.
+	StatementClassPragma = "pragma"
+	// StatementClassVacuum defines the VACUUM statements.
+	StatementClassVacuum = "vacuum"
+	// StatementClassExtension defines the statements calling load_extension.
+	StatementClassExtension = "extension"
+)
+
+var (
+	// DangerousStatementClasses defines the statement classes denied unless allowed by policy.
+	DangerousStatementClasses = []string{
+		StatementClassAttach,
+		StatementClassPragma,
+		StatementClassVacuum,
+		StatementClassExtension,
+	}
+)
+
+// SQLPolicy defines the sql firewall policy of a database.
+type SQLPolicy struct {
+	AllowedClasses []string // dangerous statement classes allowed explicitly
+	AllowList      []string // allowed statement fingerprints, all statements are allowed if empty
+	MaxStatements  uint32   // max statements in a single request, 0 for unlimited
+}
+
+// Serialize structure to bytes.
+func (p *SQLPolicy) Serialize() []byte {
+	if p == nil {
+		return []byte{'\000'}
+	}
+
+	buf := new(bytes.Buffer)
+
+	// strings are length-prefixed, so different policies never serialize to the same bytes
+	writeStrings := func(strs []string) {
+		binary.Write(buf, binary.LittleEndian, uint64(len(strs)))
+		for _, s := range strs {
+			binary.Write(buf, binary.LittleEndian, uint64(len(s)))
+			buf.WriteString(s)
+		}
+	}
+	writeStrings(p.AllowedClasses)
+	writeStrings(p.AllowList)
+	binary.Write(buf, binary.LittleEndian, p.MaxStatements)
+
+	return buf.Bytes()
+}
+
+// Validate checks the statement classes and fingerprints of policy.
+func (p *SQLPolicy) Validate() (err error) {
+	for _, c := range p.AllowedClasses {
+		if !isDangerousStatementClass(c) {
+			return ErrInvalidSQLPolicy
+		}
+	}
+	for _, f := range p.AllowList {
+		if _, err = Fingerprint(f); err != nil {
+			return ErrInvalidSQLPolicy
+		}
+	}
+	return
+}
+
+func isDangerousStatementClass(c string) bool {
+	for _, v := range DangerousStatementClasses {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint returns the normalized form of a single statement for allow-listing, the literals
+// and placeholders are replaced by ?, and the lists of them are collapsed to a single ?. So
+//
+//	SELECT * FROM users WHERE id = 1 AND name IN ('a', 'b')
+//
+// has the fingerprint:
+//
+//	select * from users where id = ? and name in ( ? )
+//
+// Fingerprint of a fingerprint is itself.
+func Fingerprint(query string) (fp string, err error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	var parts []string
+	var lastEnd int
+
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 {
+			break
+		}
+		if typ == sqlparser.LEX_ERROR {
+			err = fmt.Errorf("syntax error near '%s'", val)
+			return
+		}
+
+		end := tokenizer.Position - 1
+		if end > len(query) {
+			end = len(query)
+		}
+		text := strings.TrimSpace(query[lastEnd:end])
+		lastEnd = end
+
+		var part string
+		switch typ {
+		case sqlparser.COMMENT:
+			continue
+		case ';':
+			err = fmt.Errorf("multiple statements in fingerprint")
+			return
+		case sqlparser.STRING:
+			if strings.HasPrefix(text, "\"") {
+				// double quoted identifier
+				part = strings.ToLower(string(val))
+			} else {
+				part = "?"
+			}
+		case sqlparser.INTEGRAL, sqlparser.FLOAT, sqlparser.HEX, sqlparser.HEXNUM,
+			sqlparser.VALUE_ARG, sqlparser.LIST_ARG:
+			part = "?"
+		case sqlparser.ID:
+			part = strings.ToLower(string(val))
+		default:
+			part = strings.ToLower(text)
+		}
+
+		// collapse the list of literals
+		if n := len(parts); part == "?" && n >= 2 && parts[n-1] == "," && parts[n-2] == "?" {
+			parts = parts[:n-1]
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	fp = strings.Join(parts, " ")
+	return
+}
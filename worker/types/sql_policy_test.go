@@ -0,0 +1,67 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFingerprint(t *testing.T) {
+	Convey("test statement fingerprint", t, func() {
+		fp, err := Fingerprint("SELECT * FROM `Users` /* c */ WHERE id = 10 AND name IN ('a', 'b', ?) AND x <= -1.5")
+		So(err, ShouldBeNil)
+		So(fp, ShouldEqual, "select * from users where id = ? and name in ( ? ) and x <= - ?")
+
+		again, err := Fingerprint(fp)
+		So(err, ShouldBeNil)
+		So(again, ShouldEqual, fp)
+
+		// double quoted strings are identifiers in sqlite
+		fp, err = Fingerprint(`select * from "Users"`)
+		So(err, ShouldBeNil)
+		So(fp, ShouldEqual, "select * from users")
+
+		fp, err = Fingerprint("insert into t values (1, 'a'), (:a, :b)")
+		So(err, ShouldBeNil)
+		So(fp, ShouldEqual, "insert into t values ( ? ) , ( ? )")
+
+		_, err = Fingerprint("select 1; select 2")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("test sql policy validation", t, func() {
+		p := &SQLPolicy{
+			AllowedClasses: []string{StatementClassPragma},
+			AllowList:      []string{"select * from t"},
+		}
+		So(p.Validate(), ShouldBeNil)
+		p.AllowedClasses = append(p.AllowedClasses, "select")
+		So(p.Validate(), ShouldEqual, ErrInvalidSQLPolicy)
+		p.AllowedClasses = nil
+		p.AllowList = append(p.AllowList, "select 1; drop table t")
+		So(p.Validate(), ShouldEqual, ErrInvalidSQLPolicy)
+	})
+	Convey("test sql policy serialization", t, func() {
+		p1 := &SQLPolicy{AllowList: []string{"select a", "select b"}}
+		p2 := &SQLPolicy{AllowList: []string{"select aselect b", ""}}
+		So(p1.Serialize(), ShouldNotResemble, p2.Serialize())
+		p3 := &SQLPolicy{AllowList: []string{"select a"}}
+		p4 := &SQLPolicy{AllowList: []string{"select a"}}
+		So(p3.Serialize(), ShouldResemble, p4.Serialize())
+	})
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -37,6 +38,8 @@ const (
 	UpdateDB
 	// DropDB indicates drop database operation.
 	DropDB
+	// UpdatePolicy indicates database sql policy update operation.
+	UpdatePolicy
 )
 
 // UpdateServiceHeader defines service update header.
@@ -114,7 +117,7 @@ func (sh *SignedUpdateServiceHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedUpdateServiceHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedUpdateServiceHeader) Sign(signer kms.Signer) (err error) {
 	// build hash
 	buildHash(&sh.UpdateServiceHeader, &sh.HeaderHash)
 
@@ -140,7 +143,7 @@ func (s *UpdateService) Verify() error {
 }
 
 // Sign the request.
-func (s *UpdateService) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (s *UpdateService) Sign(signer kms.Signer) (err error) {
 	// sign
 	return s.Header.Sign(signer)
 }